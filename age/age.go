@@ -0,0 +1,329 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+// Package age encrypts and decrypts files in the age v1 format
+// (https://age-encryption.org/v1) to X25519 and SSH recipients. A file can be
+// encrypted to several recipients at once, so a team can share encrypted links
+// without sharing a passphrase, and files are readable by the age tools.
+package age
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Intro is the first line of every age v1 file
+const Intro = "age-encryption.org/v1\n"
+
+const (
+	fileKeySize = 16
+	//tagSize is the size of ChaCha20-Poly1305 authentication tags
+	tagSize = 16
+	//Stanza bodies are wrapped at 64 columns
+	bodyColumns = 64
+	//Headers longer than this aren't read, they can't have been written for a link
+	maxHeaderSize = 1 << 20
+)
+
+var (
+	// ErrIncorrectIdentity is returned by Identity.Unwrap when the stanza
+	// wasn't wrapped for the identity
+	ErrIncorrectIdentity = errors.New("age: incorrect identity for recipient stanza")
+	// ErrNoIdentityMatch is returned by Decrypt when none of the identities
+	// is a recipient of the file
+	ErrNoIdentityMatch = errors.New("age: no identity matched any of the recipients")
+	// ErrNoRecipients is returned by Encrypt without recipients
+	ErrNoRecipients = errors.New("age: no recipients")
+	// ErrNoIdentities is returned by Decrypt without identities
+	ErrNoIdentities = errors.New("age: no identities")
+	// ErrInvalidHeader is returned when a file doesn't start with a valid age header
+	ErrInvalidHeader = errors.New("age: invalid header")
+	// ErrHeaderMAC is returned when the header was altered
+	ErrHeaderMAC = errors.New("age: bad header MAC")
+	// ErrPayload is returned when the payload was altered or truncated
+	ErrPayload = errors.New("age: payload is corrupt or truncated")
+)
+
+var b64 = base64.RawStdEncoding.Strict()
+
+// Stanza is a recipient stanza of a file header. It carries the file key
+// wrapped for one recipient.
+type Stanza struct {
+	Type string
+	Args []string
+	Body []byte
+}
+
+// Recipient wraps file keys so only the matching Identity can unwrap them
+type Recipient interface {
+	Wrap(fileKey []byte) (*Stanza, error)
+}
+
+// Identity unwraps file keys wrapped for its recipient. Unwrap returns
+// ErrIncorrectIdentity for stanzas of other recipients.
+type Identity interface {
+	Unwrap(s *Stanza) ([]byte, error)
+}
+
+// Encrypt writes an age header for recipients to w and returns a writer
+// encrypting the payload to w. The writer must be closed to write the final
+// chunk.
+func Encrypt(w io.Writer, recipients ...Recipient) (io.WriteCloser, error) {
+	if len(recipients) == 0 {
+		return nil, ErrNoRecipients
+	}
+
+	fileKey := make([]byte, fileKeySize)
+	if _, err := io.ReadFull(rand.Reader, fileKey); err != nil {
+		return nil, errors.Wrap(err, "age: failed to generate file key")
+	}
+
+	var header bytes.Buffer
+	header.WriteString(Intro)
+	for _, r := range recipients {
+		s, err := r.Wrap(fileKey)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.marshal(&header); err != nil {
+			return nil, err
+		}
+	}
+	header.WriteString("---")
+	mac := headerMAC(fileKey, header.Bytes())
+	header.WriteString(" " + b64.EncodeToString(mac) + "\n")
+
+	nonce := make([]byte, streamNonceSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Wrap(err, "age: failed to generate payload nonce")
+	}
+	header.Write(nonce)
+	if _, err := w.Write(header.Bytes()); err != nil {
+		return nil, errors.Wrap(err, "age: failed to write header")
+	}
+	return newStreamWriter(streamKey(fileKey, nonce), w)
+}
+
+// Decrypt reads an age header from r and returns a reader decrypting the
+// payload with the first identity matching one of the recipient stanzas.
+// Reads return ErrPayload if the payload was altered or truncated.
+func Decrypt(r io.Reader, identities ...Identity) (io.Reader, error) {
+	if len(identities) == 0 {
+		return nil, ErrNoIdentities
+	}
+
+	br := bufio.NewReader(r)
+	h, err := readHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	var fileKey []byte
+stanzas:
+	for _, s := range h.stanzas {
+		for _, id := range identities {
+			key, err := id.Unwrap(s)
+			if err == ErrIncorrectIdentity {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			fileKey = key
+			break stanzas
+		}
+	}
+	if fileKey == nil {
+		return nil, ErrNoIdentityMatch
+	}
+	if !hmac.Equal(headerMAC(fileKey, h.authenticated), h.mac) {
+		return nil, ErrHeaderMAC
+	}
+
+	nonce := make([]byte, streamNonceSize)
+	if _, err := io.ReadFull(br, nonce); err != nil {
+		return nil, ErrPayload
+	}
+	return newStreamReader(streamKey(fileKey, nonce), br)
+}
+
+// IsEncrypted returns true if data starts with an age header
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(Intro))
+}
+
+func (s *Stanza) marshal(w io.Writer) error {
+	line := "-> " + s.Type
+	for _, arg := range append([]string{s.Type}, s.Args...) {
+		if !validArg(arg) {
+			return errors.Errorf("age: invalid stanza argument %q", arg)
+		}
+	}
+	if len(s.Args) > 0 {
+		line += " " + strings.Join(s.Args, " ")
+	}
+	body := b64.EncodeToString(s.Body)
+	var buf bytes.Buffer
+	buf.WriteString(line + "\n")
+	//The last line is always shorter than a full line, even if it is empty
+	for len(body) >= bodyColumns {
+		buf.WriteString(body[:bodyColumns] + "\n")
+		body = body[bodyColumns:]
+	}
+	buf.WriteString(body + "\n")
+	_, err := w.Write(buf.Bytes())
+	return errors.Wrap(err, "age: failed to write stanza")
+}
+
+// validArg returns true if arg is a non-empty string of visible ASCII
+func validArg(arg string) bool {
+	if arg == "" {
+		return false
+	}
+	for _, c := range []byte(arg) {
+		if c < 33 || c > 126 {
+			return false
+		}
+	}
+	return true
+}
+
+type header struct {
+	stanzas []*Stanza
+	mac     []byte
+	//authenticated holds the header up to and including "---"
+	authenticated []byte
+}
+
+func readHeader(r *bufio.Reader) (*header, error) {
+	var (
+		h   header
+		raw bytes.Buffer
+	)
+	readLine := func() (string, error) {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", ErrInvalidHeader
+		}
+		raw.WriteString(line)
+		if raw.Len() > maxHeaderSize {
+			return "", errors.Wrap(ErrInvalidHeader, "header too long")
+		}
+		return strings.TrimSuffix(line, "\n"), nil
+	}
+
+	intro, err := readLine()
+	if err != nil || intro+"\n" != Intro {
+		return nil, errors.Wrap(ErrInvalidHeader, "not an age v1 file")
+	}
+	for {
+		line, err := readLine()
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(line, "---") {
+			mac := strings.TrimPrefix(line, "--- ")
+			if len(mac) == len(line) {
+				return nil, errors.Wrap(ErrInvalidHeader, "malformed MAC line")
+			}
+			if h.mac, err = b64.DecodeString(mac); err != nil || len(h.mac) != sha256.Size {
+				return nil, errors.Wrap(ErrInvalidHeader, "malformed MAC")
+			}
+			h.authenticated = raw.Bytes()[:raw.Len()-len(line)-1+len("---")]
+			if len(h.stanzas) == 0 {
+				return nil, errors.Wrap(ErrInvalidHeader, "no recipient stanzas")
+			}
+			return &h, nil
+		}
+
+		if !strings.HasPrefix(line, "-> ") {
+			return nil, errors.Wrap(ErrInvalidHeader, "malformed stanza")
+		}
+		args := strings.Split(line[len("-> "):], " ")
+		for _, arg := range args {
+			if !validArg(arg) {
+				return nil, errors.Wrap(ErrInvalidHeader, "malformed stanza argument")
+			}
+		}
+		s := &Stanza{Type: args[0], Args: args[1:]}
+		for {
+			line, err := readLine()
+			if err != nil {
+				return nil, err
+			}
+			chunk, err := b64.DecodeString(line)
+			if err != nil || len(line) > bodyColumns {
+				return nil, errors.Wrap(ErrInvalidHeader, "malformed stanza body")
+			}
+			s.Body = append(s.Body, chunk...)
+			if len(line) < bodyColumns {
+				break
+			}
+		}
+		h.stanzas = append(h.stanzas, s)
+	}
+}
+
+// hkdfKey derives a 32 byte key with HKDF-SHA256
+func hkdfKey(secret, salt []byte, info string) []byte {
+	key := make([]byte, chacha20poly1305.KeySize)
+	//HKDF can't fail reading 32 bytes
+	io.ReadFull(hkdf.New(sha256.New, secret, salt, []byte(info)), key)
+	return key
+}
+
+func headerMAC(fileKey, authenticated []byte) []byte {
+	h := hmac.New(sha256.New, hkdfKey(fileKey, nil, "header"))
+	h.Write(authenticated)
+	return h.Sum(nil)
+}
+
+func streamKey(fileKey, nonce []byte) []byte {
+	return hkdfKey(fileKey, nonce, "payload")
+}
+
+// wrapFileKey seals a file key with ChaCha20-Poly1305 under a zero nonce, as
+// each wrapping key is used once
+func wrapFileKey(key, fileKey []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "age: failed to create cipher")
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	return aead.Seal(nil, nonce, fileKey, nil), nil
+}
+
+// unwrapFileKey opens a file key sealed with wrapFileKey
+func unwrapFileKey(key, body []byte) ([]byte, error) {
+	if len(body) != fileKeySize+tagSize {
+		return nil, errors.New("age: invalid wrapped file key size")
+	}
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "age: failed to create cipher")
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	return aead.Open(nil, nonce, body, nil)
+}
@@ -0,0 +1,278 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package age
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/ssh"
+)
+
+func encrypt(t *testing.T, plaintext []byte, recipients ...Recipient) []byte {
+	var buf bytes.Buffer
+	w, err := Encrypt(&buf, recipients...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decrypt(encrypted []byte, identities ...Identity) ([]byte, error) {
+	r, err := Decrypt(bytes.NewReader(encrypted), identities...)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
+
+func TestEncrypt(t *testing.T) {
+	alice, err := GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mallory, err := GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 2 * chunkSize} {
+		plaintext := make([]byte, size)
+		rand.Read(plaintext)
+		encrypted := encrypt(t, plaintext, alice.Recipient(), bob.Recipient())
+		if !IsEncrypted(encrypted) {
+			t.Fatal("missing age header")
+		}
+		for _, id := range []Identity{alice, bob} {
+			decrypted, err := decrypt(encrypted, mallory, id)
+			if err != nil {
+				t.Fatal(size, err)
+			}
+			if !bytes.Equal(decrypted, plaintext) {
+				t.Error("decrypted payload of", size, "bytes differs")
+			}
+		}
+		if _, err := decrypt(encrypted, mallory); err != ErrNoIdentityMatch {
+			t.Error("expected no identity match, got", err)
+		}
+
+		//Dropping the final chunk must be detected
+		if size > chunkSize {
+			if _, err := decrypt(encrypted[:len(encrypted)-(size-chunkSize)-tagSize], alice); !errors.Is(err, ErrPayload) {
+				t.Error("expected truncated payload error, got", err)
+			}
+		}
+	}
+
+	encrypted := encrypt(t, []byte("link"), alice.Recipient())
+	tampered := append([]byte{}, encrypted...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := decrypt(tampered, alice); !errors.Is(err, ErrPayload) {
+		t.Error("expected payload error, got", err)
+	}
+	header := bytes.Replace(encrypted, []byte("\n---"), []byte("\n-> grease\n\n---"), 1)
+	if _, err := decrypt(header, alice); err != ErrHeaderMAC {
+		t.Error("expected altered header to fail, got", err)
+	}
+	if _, err := Encrypt(ioutil.Discard); err != ErrNoRecipients {
+		t.Error("expected no recipients error, got", err)
+	}
+}
+
+func TestSSHRecipients(t *testing.T) {
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPKCS8, err := x509.MarshalPKCS8PrivateKey(edPrivate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := []struct {
+		public  interface{}
+		private *pem.Block
+	}{
+		{edPublic, &pem.Block{Type: "PRIVATE KEY", Bytes: edPKCS8}},
+		{&rsaKey.PublicKey, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}},
+	}
+	for _, key := range keys {
+		sshKey, err := ssh.NewPublicKey(key.public)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recipients, err := ParseRecipients(strings.NewReader("# team\n" + string(ssh.MarshalAuthorizedKey(sshKey))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		identities, err := ParseIdentities(bytes.NewReader(pem.EncodeToMemory(key.private)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		encrypted := encrypt(t, []byte("link"), recipients...)
+		decrypted, err := decrypt(encrypted, identities...)
+		if err != nil {
+			t.Fatal(sshKey.Type(), err)
+		}
+		if string(decrypted) != "link" {
+			t.Error("decrypted payload differs for", sshKey.Type())
+		}
+	}
+
+	//The converted Ed25519 keys must be an X25519 key pair
+	identities, _ := ParseIdentities(bytes.NewReader(pem.EncodeToMemory(keys[0].private)))
+	id := identities[0].(*SSHEd25519Identity)
+	public, err := curve25519.X25519(id.secretKey, curve25519.Basepoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(public, id.ourPublicKey) {
+		t.Error("converted Ed25519 keys don't match")
+	}
+}
+
+func TestParseX25519(t *testing.T) {
+	id, err := GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(id.String(), "AGE-SECRET-KEY-1") || !strings.HasPrefix(id.Recipient().String(), "age1") {
+		t.Fatal("unexpected key encoding", id.Recipient())
+	}
+	parsed, err := ParseIdentities(strings.NewReader("# created: now\n# public key: " + id.Recipient().String() + "\n" + id.String() + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed[0].(*X25519Identity).String() != id.String() {
+		t.Error("identity doesn't round trip")
+	}
+	recipient, err := ParseRecipient(id.Recipient().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recipient.(*X25519Recipient).String() != id.Recipient().String() {
+		t.Error("recipient doesn't round trip")
+	}
+
+	//BIP 173 test vectors
+	for _, valid := range []string{"A12UEL5L", "abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw"} {
+		if _, _, err := bech32Decode(valid); err != nil {
+			t.Error(valid, err)
+		}
+	}
+	for _, invalid := range []string{"A1G7SGD8", "10a06t8", "1qzzfhee", "abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxW"} {
+		if _, _, err := bech32Decode(invalid); err == nil {
+			t.Error("expected error decoding", invalid)
+		}
+	}
+	if _, err := ParseX25519Recipient(strings.Replace(id.Recipient().String(), "age1", "agf1", 1)); err == nil {
+		t.Error("expected error parsing corrupt recipient")
+	}
+}
+
+// TestTestkit decrypts the age test vectors of c2sp.org/CCTV/age that use
+// X25519 identities without armor, checking failures fail and successful
+// decryptions produce the expected payload
+func TestTestkit(t *testing.T) {
+	files, err := ioutil.ReadDir(filepath.Join("testdata", "testkit"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(filepath.Join("testdata", "testkit", file.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		header, body := data, []byte(nil)
+		if i := bytes.Index(data, []byte("\n\n")); i >= 0 {
+			header, body = data[:i], data[i+2:]
+		}
+		var expect, payload, keys string
+		compressed := false
+		for _, line := range strings.Split(string(header), "\n") {
+			kv := strings.SplitN(line, ": ", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			switch kv[0] {
+			case "expect":
+				expect = kv[1]
+			case "payload":
+				payload = kv[1]
+			case "identity":
+				keys += kv[1] + "\n"
+			case "compressed":
+				compressed = kv[1] == "zlib"
+			}
+		}
+		if compressed {
+			z, err := zlib.NewReader(bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(file.Name(), err)
+			}
+			if body, err = ioutil.ReadAll(z); err != nil {
+				t.Fatal(file.Name(), err)
+			}
+		}
+
+		identities, err := ParseIdentities(strings.NewReader(keys))
+		if err != nil {
+			t.Fatal(file.Name(), err)
+		}
+		var plaintext []byte
+		r, err := Decrypt(bytes.NewReader(body), identities...)
+		if err == nil {
+			plaintext, err = ioutil.ReadAll(r)
+		}
+		switch {
+		case expect == "success" && err != nil:
+			t.Errorf("%s: expected success, got %v", file.Name(), err)
+		case expect == "success" && fmt.Sprintf("%x", sha256.Sum256(plaintext)) != payload:
+			t.Errorf("%s: unexpected payload", file.Name())
+		case expect != "success" && err == nil:
+			t.Errorf("%s: expected %s, decrypted successfully", file.Name(), expect)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package age
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ParseRecipient parses an age1... public key or an SSH public key in
+// authorized_keys format
+func ParseRecipient(s string) (Recipient, error) {
+	if strings.HasPrefix(s, "ssh-") {
+		return ParseSSHRecipient(s)
+	}
+	return ParseX25519Recipient(s)
+}
+
+// ParseRecipients parses a recipients file with one recipient per line, see
+// ParseRecipient. Empty lines and lines starting with # are ignored.
+func ParseRecipients(r io.Reader) ([]Recipient, error) {
+	var recipients []Recipient
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		recipient, err := ParseRecipient(line)
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", n)
+		}
+		recipients = append(recipients, recipient)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "age: failed to read recipients")
+	}
+	if len(recipients) == 0 {
+		return nil, ErrNoRecipients
+	}
+	return recipients, nil
+}
+
+// ParseIdentities parses an identity file, either AGE-SECRET-KEY-1... keys one
+// per line as written by age-keygen or an SSH private key. Empty lines and
+// lines starting with # are ignored.
+func ParseIdentities(r io.Reader) ([]Identity, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "age: failed to read identities")
+	}
+	if bytes.Contains(data, []byte("-----BEGIN")) {
+		identity, err := ParseSSHIdentity(data)
+		if err != nil {
+			return nil, err
+		}
+		return []Identity{identity}, nil
+	}
+
+	var identities []Identity
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		identity, err := ParseX25519Identity(line)
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", n)
+		}
+		identities = append(identities, identity)
+	}
+	if len(identities) == 0 {
+		return nil, ErrNoIdentities
+	}
+	return identities, nil
+}
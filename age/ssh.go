@@ -0,0 +1,275 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package age
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"io"
+	"math/big"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/ssh"
+)
+
+// SSH keys are recipients too, so teams can encrypt to the keys they already
+// publish. Ed25519 keys are converted to X25519 keys, RSA keys wrap the file
+// key with OAEP.
+const (
+	sshEd25519Type  = "ssh-ed25519"
+	sshEd25519Label = "age-encryption.org/v1/ssh-ed25519"
+	sshRSAType      = "ssh-rsa"
+	sshRSALabel     = "age-encryption.org/v1/ssh-rsa"
+)
+
+// sshTag identifies the SSH key a stanza was wrapped for
+func sshTag(pk ssh.PublicKey) string {
+	h := sha256.Sum256(pk.Marshal())
+	return b64.EncodeToString(h[:4])
+}
+
+// SSHEd25519Recipient is an ssh-ed25519 public key
+type SSHEd25519Recipient struct {
+	sshKey         ssh.PublicKey
+	theirPublicKey []byte
+}
+
+// SSHRSARecipient is an ssh-rsa public key
+type SSHRSARecipient struct {
+	sshKey ssh.PublicKey
+	pubKey *rsa.PublicKey
+}
+
+// ParseSSHRecipient parses an ssh-ed25519 or ssh-rsa public key in
+// authorized_keys format
+func ParseSSHRecipient(s string) (Recipient, error) {
+	pk, _, _, _, err := ssh.ParseAuthorizedKey([]byte(s))
+	if err != nil {
+		return nil, errors.Wrap(err, "age: malformed SSH recipient")
+	}
+	cpk, ok := pk.(ssh.CryptoPublicKey)
+	if !ok {
+		return nil, errors.Errorf("age: unsupported SSH key type %q", pk.Type())
+	}
+	switch key := cpk.CryptoPublicKey().(type) {
+	case ed25519.PublicKey:
+		theirPublicKey, err := ed25519PublicKeyToCurve25519(key)
+		if err != nil {
+			return nil, err
+		}
+		return &SSHEd25519Recipient{sshKey: pk, theirPublicKey: theirPublicKey}, nil
+	case *rsa.PublicKey:
+		if key.N.BitLen() < 2048 {
+			return nil, errors.New("age: RSA keys shorter than 2048 bits aren't supported")
+		}
+		return &SSHRSARecipient{sshKey: pk, pubKey: key}, nil
+	default:
+		return nil, errors.Errorf("age: unsupported SSH key type %q", pk.Type())
+	}
+}
+
+// Wrap wraps fileKey with a key agreed between an ephemeral key and the
+// recipient, tweaked with the SSH key
+func (r *SSHEd25519Recipient) Wrap(fileKey []byte) (*Stanza, error) {
+	ephemeral := make([]byte, curve25519.ScalarSize)
+	if _, err := io.ReadFull(rand.Reader, ephemeral); err != nil {
+		return nil, errors.Wrap(err, "age: failed to generate ephemeral key")
+	}
+	share, err := curve25519.X25519(ephemeral, curve25519.Basepoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "age: failed to compute ephemeral share")
+	}
+	secret, err := curve25519.X25519(ephemeral, r.theirPublicKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "age: invalid SSH recipient")
+	}
+	tweak := hkdfKey(nil, r.sshKey.Marshal(), sshEd25519Label)
+	if secret, err = curve25519.X25519(tweak, secret); err != nil {
+		return nil, errors.Wrap(err, "age: invalid SSH recipient")
+	}
+
+	salt := append(append([]byte{}, share...), r.theirPublicKey...)
+	body, err := wrapFileKey(hkdfKey(secret, salt, sshEd25519Label), fileKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Stanza{
+		Type: sshEd25519Type,
+		Args: []string{sshTag(r.sshKey), b64.EncodeToString(share)},
+		Body: body,
+	}, nil
+}
+
+// Wrap encrypts fileKey to the recipient with RSA-OAEP
+func (r *SSHRSARecipient) Wrap(fileKey []byte) (*Stanza, error) {
+	body, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, r.pubKey, fileKey, []byte(sshRSALabel))
+	if err != nil {
+		return nil, errors.Wrap(err, "age: failed to wrap file key")
+	}
+	return &Stanza{Type: sshRSAType, Args: []string{sshTag(r.sshKey)}, Body: body}, nil
+}
+
+// SSHEd25519Identity is an Ed25519 SSH private key
+type SSHEd25519Identity struct {
+	sshKey                  ssh.PublicKey
+	secretKey, ourPublicKey []byte
+}
+
+// SSHRSAIdentity is an RSA SSH private key
+type SSHRSAIdentity struct {
+	sshKey ssh.PublicKey
+	key    crypto.Decrypter
+}
+
+// NewSSHRSAIdentity returns the identity of an RSA key held elsewhere, such as
+// in a keychain. The decrypter must support OAEP labels.
+func NewSSHRSAIdentity(key crypto.Decrypter) (*SSHRSAIdentity, error) {
+	public, ok := key.Public().(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.Errorf("age: %T is not an RSA key", key.Public())
+	}
+	sshKey, err := ssh.NewPublicKey(public)
+	if err != nil {
+		return nil, errors.Wrap(err, "age: invalid RSA key")
+	}
+	return &SSHRSAIdentity{sshKey: sshKey, key: key}, nil
+}
+
+// ParseSSHIdentity parses an unencrypted Ed25519 or RSA SSH private key in
+// OpenSSH or PEM format
+func ParseSSHIdentity(pemBytes []byte) (Identity, error) {
+	key, err := ssh.ParseRawPrivateKey(pemBytes)
+	if _, ok := err.(*ssh.PassphraseMissingError); ok {
+		return nil, errors.New("age: passphrase-protected SSH keys aren't supported")
+	} else if err != nil {
+		return nil, errors.Wrap(err, "age: malformed SSH identity")
+	}
+	if k, ok := key.(*ed25519.PrivateKey); ok {
+		key = *k
+	}
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		sshKey, err := ssh.NewPublicKey(k.Public())
+		if err != nil {
+			return nil, errors.Wrap(err, "age: malformed SSH identity")
+		}
+		ourPublicKey, err := ed25519PublicKeyToCurve25519(k.Public().(ed25519.PublicKey))
+		if err != nil {
+			return nil, err
+		}
+		//The X25519 scalar is the hashed seed, as in Ed25519 signing
+		h := sha512.Sum512(k.Seed())
+		return &SSHEd25519Identity{sshKey: sshKey, secretKey: h[:curve25519.ScalarSize], ourPublicKey: ourPublicKey}, nil
+	case *rsa.PrivateKey:
+		return NewSSHRSAIdentity(k)
+	default:
+		return nil, errors.Errorf("age: unsupported SSH key type %T", key)
+	}
+}
+
+// Unwrap unwraps the file key of an ssh-ed25519 stanza for the key
+func (i *SSHEd25519Identity) Unwrap(s *Stanza) ([]byte, error) {
+	if s.Type != sshEd25519Type {
+		return nil, ErrIncorrectIdentity
+	}
+	if len(s.Args) != 2 {
+		return nil, errors.New("age: invalid ssh-ed25519 stanza")
+	}
+	if s.Args[0] != sshTag(i.sshKey) {
+		return nil, ErrIncorrectIdentity
+	}
+	share, err := b64.DecodeString(s.Args[1])
+	if err != nil || len(share) != curve25519.PointSize {
+		return nil, errors.New("age: invalid ssh-ed25519 stanza")
+	}
+	secret, err := curve25519.X25519(i.secretKey, share)
+	if err != nil {
+		return nil, errors.Wrap(err, "age: invalid ssh-ed25519 stanza")
+	}
+	tweak := hkdfKey(nil, i.sshKey.Marshal(), sshEd25519Label)
+	if secret, err = curve25519.X25519(tweak, secret); err != nil {
+		return nil, errors.Wrap(err, "age: invalid ssh-ed25519 stanza")
+	}
+
+	salt := append(append([]byte{}, share...), i.ourPublicKey...)
+	fileKey, err := unwrapFileKey(hkdfKey(secret, salt, sshEd25519Label), s.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "age: failed to unwrap ssh-ed25519 stanza")
+	}
+	return fileKey, nil
+}
+
+// Unwrap unwraps the file key of an ssh-rsa stanza for the key
+func (i *SSHRSAIdentity) Unwrap(s *Stanza) ([]byte, error) {
+	if s.Type != sshRSAType {
+		return nil, ErrIncorrectIdentity
+	}
+	if len(s.Args) != 1 {
+		return nil, errors.New("age: invalid ssh-rsa stanza")
+	}
+	if s.Args[0] != sshTag(i.sshKey) {
+		return nil, ErrIncorrectIdentity
+	}
+	fileKey, err := i.key.Decrypt(rand.Reader, s.Body, &rsa.OAEPOptions{Hash: crypto.SHA256, Label: []byte(sshRSALabel)})
+	if err != nil {
+		return nil, errors.Wrap(err, "age: failed to unwrap ssh-rsa stanza")
+	}
+	return fileKey, nil
+}
+
+// curve25519P is the field prime 2^255 - 19
+var curve25519P, _ = new(big.Int).SetString("57896044618658097711785492504343953926634992332820282019728792003956564819949", 10)
+
+// ed25519PublicKeyToCurve25519 maps an Edwards point to its Montgomery u
+// coordinate, u = (1 + y) / (1 - y)
+func ed25519PublicKeyToCurve25519(pk ed25519.PublicKey) ([]byte, error) {
+	if len(pk) != ed25519.PublicKeySize {
+		return nil, errors.New("age: invalid Ed25519 public key")
+	}
+	//The key is y in little-endian with the sign of x in the top bit
+	be := make([]byte, len(pk))
+	for i := range pk {
+		be[len(pk)-1-i] = pk[i]
+	}
+	be[0] &= 0x7f
+	y := new(big.Int).SetBytes(be)
+	if y.Cmp(curve25519P) >= 0 {
+		return nil, errors.New("age: invalid Ed25519 public key")
+	}
+
+	one := big.NewInt(1)
+	denominator := new(big.Int).Sub(one, y)
+	denominator.Mod(denominator, curve25519P)
+	if denominator.Sign() == 0 {
+		return nil, errors.New("age: invalid Ed25519 public key")
+	}
+	u := new(big.Int).Add(one, y)
+	u.Mul(u, denominator.ModInverse(denominator, curve25519P))
+	u.Mod(u, curve25519P)
+
+	out := make([]byte, curve25519.PointSize)
+	ub := u.Bytes()
+	for i := range ub {
+		out[i] = ub[len(ub)-1-i]
+	}
+	return out, nil
+}
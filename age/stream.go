@@ -0,0 +1,200 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package age
+
+import (
+	"crypto/cipher"
+	"io"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// The payload is split into chunks of chunkSize bytes sealed with
+// ChaCha20-Poly1305 under a counter nonce, whose last byte marks the final
+// chunk so truncation is detected
+const (
+	streamNonceSize = 16
+	chunkSize       = 64 * 1024
+	sealedChunkSize = chunkSize + tagSize
+	lastChunkFlag   = 1
+)
+
+type chunkNonce [chacha20poly1305.NonceSize]byte
+
+// next increments the 11 byte big-endian chunk counter
+func (n *chunkNonce) next() {
+	for i := len(n) - 2; i >= 0; i-- {
+		n[i]++
+		if n[i] != 0 {
+			return
+		}
+	}
+}
+
+type streamWriter struct {
+	aead   cipher.AEAD
+	dst    io.Writer
+	buf    []byte
+	sealed []byte
+	nonce  chunkNonce
+	closed bool
+}
+
+func newStreamWriter(key []byte, dst io.Writer) (*streamWriter, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "age: failed to create cipher")
+	}
+	return &streamWriter{
+		aead:   aead,
+		dst:    dst,
+		buf:    make([]byte, 0, chunkSize),
+		sealed: make([]byte, 0, sealedChunkSize),
+	}, nil
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("age: write to closed writer")
+	}
+	n := len(p)
+	for len(p) > 0 {
+		//A full chunk is only sealed once more data follows, the final
+		//chunk may be full
+		if len(w.buf) == chunkSize {
+			if err := w.seal(false); err != nil {
+				return 0, err
+			}
+		}
+		m := chunkSize - len(w.buf)
+		if m > len(p) {
+			m = len(p)
+		}
+		w.buf = append(w.buf, p[:m]...)
+		p = p[m:]
+	}
+	return n, nil
+}
+
+// Close seals the final chunk. It doesn't close the underlying writer.
+func (w *streamWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.seal(true)
+}
+
+func (w *streamWriter) seal(last bool) error {
+	if last {
+		w.nonce[len(w.nonce)-1] = lastChunkFlag
+	}
+	w.sealed = w.aead.Seal(w.sealed[:0], w.nonce[:], w.buf, nil)
+	if _, err := w.dst.Write(w.sealed); err != nil {
+		return errors.Wrap(err, "age: failed to write payload")
+	}
+	w.buf = w.buf[:0]
+	w.nonce.next()
+	return nil
+}
+
+type streamReader struct {
+	aead   cipher.AEAD
+	src    io.Reader
+	sealed []byte
+	plain  []byte
+	unread []byte
+	nonce  chunkNonce
+	first  bool
+	last   bool
+	err    error
+}
+
+func newStreamReader(key []byte, src io.Reader) (*streamReader, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "age: failed to create cipher")
+	}
+	return &streamReader{
+		aead:   aead,
+		src:    src,
+		sealed: make([]byte, sealedChunkSize),
+		plain:  make([]byte, 0, chunkSize),
+		first:  true,
+	}, nil
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	for len(r.unread) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.last {
+			return 0, io.EOF
+		}
+		r.unread, r.err = r.readChunk()
+	}
+	n := copy(p, r.unread)
+	r.unread = r.unread[n:]
+	return n, nil
+}
+
+func (r *streamReader) readChunk() ([]byte, error) {
+	n, err := io.ReadFull(r.src, r.sealed)
+	switch {
+	case err == io.ErrUnexpectedEOF:
+		//Only the final chunk is short
+		return r.open(r.sealed[:n], true)
+	case err == io.EOF:
+		return nil, ErrPayload
+	case err != nil:
+		return nil, errors.Wrap(err, "age: failed to read payload")
+	}
+
+	if plain, err := r.open(r.sealed, false); err == nil {
+		return plain, nil
+	}
+	plain, err := r.open(r.sealed, true)
+	if err != nil {
+		return nil, err
+	}
+	//Nothing may follow a full final chunk
+	if n, _ := io.ReadFull(r.src, make([]byte, 1)); n > 0 {
+		return nil, errors.Wrap(ErrPayload, "trailing data after final chunk")
+	}
+	return plain, nil
+}
+
+func (r *streamReader) open(sealed []byte, last bool) ([]byte, error) {
+	nonce := r.nonce
+	if last {
+		nonce[len(nonce)-1] = lastChunkFlag
+	}
+	plain, err := r.aead.Open(r.plain[:0], nonce[:], sealed, nil)
+	if err != nil {
+		return nil, ErrPayload
+	}
+	//An empty final chunk is only valid for an empty payload
+	if last && len(plain) == 0 && !r.first {
+		return nil, ErrPayload
+	}
+	r.nonce.next()
+	r.first = false
+	r.last = last
+	return plain, nil
+}
@@ -0,0 +1,158 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package age
+
+import (
+	"crypto/rand"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/curve25519"
+)
+
+const (
+	x25519Type  = "X25519"
+	x25519Label = "age-encryption.org/v1/X25519"
+
+	recipientHRP = "age"
+	identityHRP  = "AGE-SECRET-KEY-"
+)
+
+// X25519Recipient is a native age recipient, an age1... public key
+type X25519Recipient struct {
+	theirPublicKey []byte
+}
+
+// ParseX25519Recipient parses an age1... public key
+func ParseX25519Recipient(s string) (*X25519Recipient, error) {
+	hrp, key, err := bech32Decode(s)
+	if err != nil {
+		return nil, errors.Wrap(err, "age: malformed recipient")
+	}
+	if hrp != recipientHRP {
+		return nil, errors.Errorf("age: malformed recipient %q: unexpected type %q", s, hrp)
+	}
+	if len(key) != curve25519.PointSize {
+		return nil, errors.Errorf("age: malformed recipient %q: invalid key length", s)
+	}
+	return &X25519Recipient{theirPublicKey: key}, nil
+}
+
+// String returns the age1... encoding of the recipient
+func (r *X25519Recipient) String() string {
+	s, _ := bech32Encode(recipientHRP, r.theirPublicKey)
+	return s
+}
+
+// Wrap wraps fileKey with a key agreed between an ephemeral key and the
+// recipient
+func (r *X25519Recipient) Wrap(fileKey []byte) (*Stanza, error) {
+	ephemeral := make([]byte, curve25519.ScalarSize)
+	if _, err := io.ReadFull(rand.Reader, ephemeral); err != nil {
+		return nil, errors.Wrap(err, "age: failed to generate ephemeral key")
+	}
+	share, err := curve25519.X25519(ephemeral, curve25519.Basepoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "age: failed to compute ephemeral share")
+	}
+	secret, err := curve25519.X25519(ephemeral, r.theirPublicKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "age: invalid recipient")
+	}
+
+	salt := append(append([]byte{}, share...), r.theirPublicKey...)
+	body, err := wrapFileKey(hkdfKey(secret, salt, x25519Label), fileKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Stanza{Type: x25519Type, Args: []string{b64.EncodeToString(share)}, Body: body}, nil
+}
+
+// X25519Identity is a native age identity, an AGE-SECRET-KEY-1... secret key
+type X25519Identity struct {
+	secretKey, ourPublicKey []byte
+}
+
+// GenerateX25519Identity returns a new random identity
+func GenerateX25519Identity() (*X25519Identity, error) {
+	secretKey := make([]byte, curve25519.ScalarSize)
+	if _, err := io.ReadFull(rand.Reader, secretKey); err != nil {
+		return nil, errors.Wrap(err, "age: failed to generate key")
+	}
+	return newX25519Identity(secretKey)
+}
+
+// ParseX25519Identity parses an AGE-SECRET-KEY-1... secret key
+func ParseX25519Identity(s string) (*X25519Identity, error) {
+	hrp, key, err := bech32Decode(s)
+	if err != nil {
+		return nil, errors.Wrap(err, "age: malformed secret key")
+	}
+	if hrp != strings.ToLower(identityHRP) {
+		return nil, errors.Errorf("age: malformed secret key: unexpected type %q", hrp)
+	}
+	if len(key) != curve25519.ScalarSize {
+		return nil, errors.New("age: malformed secret key: invalid key length")
+	}
+	return newX25519Identity(key)
+}
+
+func newX25519Identity(secretKey []byte) (*X25519Identity, error) {
+	publicKey, err := curve25519.X25519(secretKey, curve25519.Basepoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "age: invalid secret key")
+	}
+	return &X25519Identity{secretKey: secretKey, ourPublicKey: publicKey}, nil
+}
+
+// Recipient returns the public key of the identity
+func (i *X25519Identity) Recipient() *X25519Recipient {
+	return &X25519Recipient{theirPublicKey: i.ourPublicKey}
+}
+
+// String returns the AGE-SECRET-KEY-1... encoding of the identity
+func (i *X25519Identity) String() string {
+	s, _ := bech32Encode(identityHRP, i.secretKey)
+	return s
+}
+
+// Unwrap unwraps the file key of an X25519 stanza
+func (i *X25519Identity) Unwrap(s *Stanza) ([]byte, error) {
+	if s.Type != x25519Type {
+		return nil, ErrIncorrectIdentity
+	}
+	if len(s.Args) != 1 {
+		return nil, errors.New("age: invalid X25519 stanza")
+	}
+	share, err := b64.DecodeString(s.Args[0])
+	if err != nil || len(share) != curve25519.PointSize {
+		return nil, errors.New("age: invalid X25519 stanza")
+	}
+	secret, err := curve25519.X25519(i.secretKey, share)
+	if err != nil {
+		return nil, errors.Wrap(err, "age: invalid X25519 stanza")
+	}
+
+	salt := append(append([]byte{}, share...), i.ourPublicKey...)
+	fileKey, err := unwrapFileKey(hkdfKey(secret, salt, x25519Label), s.Body)
+	if err != nil {
+		//The stanza doesn't say which recipient it was wrapped for
+		return nil, ErrIncorrectIdentity
+	}
+	return fileKey, nil
+}
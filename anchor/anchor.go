@@ -0,0 +1,93 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+// Package anchor timestamps chain blocks with external authorities. A block's
+// hash is submitted to RFC 3161 time-stamp authorities or OpenTimestamps
+// calendars and the returned proof is stored detached on the block, so the
+// time a snapshot was recorded can be verified without trusting the chain.
+package anchor
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"time"
+
+	"github.com/govice/golinks/block"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrUnhashedBlock is returned when anchoring a block without a hash
+	ErrUnhashedBlock = errors.New("anchor: can't anchor unhashed block")
+	// ErrBadAnchor is returned when an anchor's proof doesn't commit to its block
+	ErrBadAnchor = errors.New("anchor: invalid anchor")
+	// ErrUnknownAnchor is returned when verifying an anchor of an unknown type
+	ErrUnknownAnchor = errors.New("anchor: unknown anchor type")
+)
+
+// Anchorer submits a hash to an external timestamp authority
+type Anchorer interface {
+	// Anchor timestamps hash, returning the authority's proof
+	Anchor(ctx context.Context, hash []byte) (block.Anchor, error)
+}
+
+// Block anchors blk's hash with each anchorer and attaches the proofs to blk.
+// Anchors obtained before an error are still attached.
+func Block(ctx context.Context, blk *block.Block, anchorers ...Anchorer) error {
+	if len(blk.BlockHash) == 0 {
+		return ErrUnhashedBlock
+	}
+	for _, anchorer := range anchorers {
+		anchor, err := anchorer.Anchor(ctx, blk.BlockHash)
+		if err != nil {
+			return err
+		}
+		blk.Anchors = append(blk.Anchors, anchor)
+	}
+	return nil
+}
+
+// Verify checks that anchor commits to hash and returns the time it attests.
+// RFC 3161 tokens must be signed by their embedded certificate, which must
+// chain to roots unless roots is nil. OpenTimestamps proofs are pending
+// until upgraded with an OpenTimestamps client, so only their digest is
+// checked and the submission time is returned.
+func Verify(anchor block.Anchor, hash []byte, roots *x509.CertPool) (time.Time, error) {
+	switch anchor.Type {
+	case block.RFC3161:
+		return VerifyToken(anchor.Proof, hash, roots)
+	case block.OpenTimestamps:
+		digest := sha256.Sum256(hash)
+		if len(anchor.Proof) == 0 || !bytes.Equal(anchor.Digest, digest[:]) {
+			return time.Time{}, ErrBadAnchor
+		}
+		return time.Unix(0, anchor.Time), nil
+	default:
+		return time.Time{}, errors.Wrap(ErrUnknownAnchor, anchor.Type)
+	}
+}
+
+// VerifyBlock verifies every anchor attached to blk
+func VerifyBlock(blk *block.Block, roots *x509.CertPool) error {
+	for i, anchor := range blk.Anchors {
+		if _, err := Verify(anchor, blk.BlockHash, roots); err != nil {
+			return errors.Wrapf(err, "anchor %d", i)
+		}
+	}
+	return nil
+}
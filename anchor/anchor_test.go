@@ -0,0 +1,220 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package anchor
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/govice/golinks/block"
+)
+
+// testTSA is a minimal RFC 3161 time-stamp authority
+type testTSA struct {
+	key  *ecdsa.PrivateKey
+	cert *x509.Certificate
+	now  time.Time
+}
+
+func newTestTSA(t *testing.T) *testTSA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test tsa"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testTSA{key: key, cert: cert, now: now}
+}
+
+func (tsa *testTSA) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	var req timeStampReq
+	if _, err := asn1.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	token, err := tsa.token(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp, _ := asn1.Marshal(timeStampResp{TimeStampToken: asn1.RawValue{FullBytes: token}})
+	w.Header().Set("Content-Type", "application/timestamp-reply")
+	w.Write(resp)
+}
+
+func (tsa *testTSA) token(req timeStampReq) ([]byte, error) {
+	info, err := asn1.Marshal(tstInfo{
+		Version:        1,
+		Policy:         asn1.ObjectIdentifier{1, 2, 3},
+		MessageImprint: req.MessageImprint,
+		SerialNumber:   big.NewInt(42),
+		GenTime:        tsa.now,
+		Nonce:          req.Nonce,
+	})
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(info)
+	contentType, _ := asn1.Marshal(oidTSTInfo)
+	messageDigest, _ := asn1.Marshal(digest[:])
+	attrs, err := asn1.MarshalWithParams([]attribute{
+		{Type: oidContentType, Values: []asn1.RawValue{{FullBytes: contentType}}},
+		{Type: oidMessageDigest, Values: []asn1.RawValue{{FullBytes: messageDigest}}},
+	}, "set")
+	if err != nil {
+		return nil, err
+	}
+	attrsDigest := sha256.Sum256(attrs)
+	signature, err := tsa.key.Sign(rand.Reader, attrsDigest[:], crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	sid, _ := asn1.Marshal(issuerAndSerialNumber{Issuer: asn1.RawValue{FullBytes: tsa.cert.RawIssuer}, SerialNumber: tsa.cert.SerialNumber})
+	//Signed attributes are stored with their implicit [0] tag
+	attrs[0] = 0xa0
+
+	sha256ID := pkix.AlgorithmIdentifier{Algorithm: oidSHA256}
+	signed, err := asn1.Marshal(signedData{
+		Version:          3,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256ID},
+		EncapContentInfo: encapContentInfo{EContentType: oidTSTInfo, EContent: info},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: tsa.cert.Raw},
+		SignerInfos: []signerInfo{{
+			Version:            1,
+			SID:                asn1.RawValue{FullBytes: sid},
+			DigestAlgorithm:    sha256ID,
+			SignedAttrs:        asn1.RawValue{FullBytes: attrs},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}},
+			Signature:          signature,
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{ContentType: oidSignedData, Content: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signed}})
+}
+
+func TestTSA_Anchor(t *testing.T) {
+	tsa := newTestTSA(t)
+	server := httptest.NewServer(tsa)
+	defer server.Close()
+
+	blk := block.NewSHA512(1, []byte("snapshot"), block.NewSHA512Genesis().BlockHash)
+	if err := Block(context.Background(), blk, NewTSA(server.URL)); err != nil {
+		t.Fatal(err)
+	}
+	if len(blk.Anchors) != 1 || blk.Anchors[0].Type != block.RFC3161 {
+		t.Fatal("expected an RFC3161 anchor, got", blk.Anchors)
+	}
+	if err := blk.VerifySHA512(); err != nil {
+		t.Error("anchoring changed the block hash:", err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(tsa.cert)
+	stamped, err := Verify(blk.Anchors[0], blk.BlockHash, roots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stamped.Equal(tsa.now) {
+		t.Errorf("expected time %v, got %v", tsa.now, stamped)
+	}
+	if err := VerifyBlock(blk, nil); err != nil {
+		t.Error(err)
+	}
+
+	//The token doesn't verify for another hash or an untrusted authority
+	if _, err := Verify(blk.Anchors[0], []byte("other"), roots); !errors.Is(err, ErrBadAnchor) {
+		t.Error("expected bad anchor for another hash, got", err)
+	}
+	if _, err := Verify(blk.Anchors[0], blk.BlockHash, x509.NewCertPool()); !errors.Is(err, ErrBadAnchor) {
+		t.Error("expected bad anchor for an untrusted authority, got", err)
+	}
+	tampered := blk.Anchors[0]
+	tampered.Proof = append([]byte{}, tampered.Proof...)
+	tampered.Proof[len(tampered.Proof)-1] ^= 0xff
+	if _, err := Verify(tampered, blk.BlockHash, nil); !errors.Is(err, ErrBadAnchor) {
+		t.Error("expected bad anchor for a tampered token, got", err)
+	}
+}
+
+func TestCalendar_Anchor(t *testing.T) {
+	pending := []byte{0xf0, 0x10, 0x83, 0xdf, 0xe3, 0x0d, 0x2e, 0xf9, 0x0c, 0x8e}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.URL.Path != "/digest" || len(body) != sha256.Size {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.Write(pending)
+	}))
+	defer server.Close()
+
+	blk := block.NewSHA512(1, []byte("snapshot"), block.NewSHA512Genesis().BlockHash)
+	if err := Block(context.Background(), blk, NewCalendar(server.URL+"/")); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyBlock(blk, nil); err != nil {
+		t.Error(err)
+	}
+	file, err := OTSFile(blk.Anchors[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(file) != len(otsMagic)+2+sha256.Size+len(pending) {
+		t.Error("unexpected proof file length", len(file))
+	}
+
+	if _, err := Verify(blk.Anchors[0], []byte("other"), nil); !errors.Is(err, ErrBadAnchor) {
+		t.Error("expected bad anchor for another hash, got", err)
+	}
+	if err := Block(context.Background(), &block.Block{}, NewCalendar(server.URL)); err != ErrUnhashedBlock {
+		t.Error("expected unhashed block error, got", err)
+	}
+}
@@ -0,0 +1,110 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package anchor
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/govice/golinks/block"
+	"github.com/pkg/errors"
+)
+
+// DefaultCalendar is a public OpenTimestamps calendar server
+const DefaultCalendar = "https://alice.btc.calendar.opentimestamps.org"
+
+// otsMagic is the header of a detached OpenTimestamps proof file
+var otsMagic = []byte("\x00OpenTimestamps\x00\x00Proof\x00\xbf\x89\xe2\xe8\x84\xe8\x92\x94")
+
+const (
+	otsVersion = 1
+	otsSHA256  = 0x08
+)
+
+// Calendar submits hashes to an OpenTimestamps calendar server, which commits
+// them to Bitcoin. The returned proofs are pending until the calendar's
+// commitment is confirmed and the proof is upgraded.
+type Calendar struct {
+	url        string
+	httpClient *http.Client
+}
+
+// NewCalendar returns a client for the calendar server at url, such as
+// DefaultCalendar
+func NewCalendar(url string) *Calendar {
+	return &Calendar{url: strings.TrimSuffix(url, "/"), httpClient: http.DefaultClient}
+}
+
+// SetHTTPClient sets the HTTP client used for requests
+func (c *Calendar) SetHTTPClient(client *http.Client) {
+	c.httpClient = client
+}
+
+// Anchor submits the SHA256 digest of hash to the calendar and returns its
+// pending timestamp
+func (c *Calendar) Anchor(ctx context.Context, hash []byte) (block.Anchor, error) {
+	digest := sha256.Sum256(hash)
+	req, err := http.NewRequest(http.MethodPost, c.url+"/digest", bytes.NewReader(digest[:]))
+	if err != nil {
+		return block.Anchor{}, errors.Wrap(err, "anchor: failed to create request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/vnd.opentimestamps.v1")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return block.Anchor{}, errors.Wrap(err, "anchor: calendar request failed")
+	}
+	defer resp.Body.Close()
+	proof, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseLength))
+	if err != nil {
+		return block.Anchor{}, errors.Wrap(err, "anchor: failed to read calendar response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return block.Anchor{}, errors.Errorf("anchor: calendar returned status %d", resp.StatusCode)
+	}
+	if len(proof) == 0 {
+		return block.Anchor{}, errors.New("anchor: calendar returned an empty timestamp")
+	}
+	return block.Anchor{
+		Type:      block.OpenTimestamps,
+		Authority: c.url,
+		Digest:    digest[:],
+		Time:      time.Now().UnixNano(),
+		Proof:     proof,
+	}, nil
+}
+
+// OTSFile returns an OpenTimestamps anchor as a detached .ots proof of a file
+// holding the raw block hash, which OpenTimestamps clients can upgrade and
+// verify against Bitcoin
+func OTSFile(anchor block.Anchor) ([]byte, error) {
+	if anchor.Type != block.OpenTimestamps || len(anchor.Digest) != sha256.Size {
+		return nil, ErrBadAnchor
+	}
+	file := make([]byte, 0, len(otsMagic)+2+len(anchor.Digest)+len(anchor.Proof))
+	file = append(file, otsMagic...)
+	file = append(file, otsVersion, otsSHA256)
+	file = append(file, anchor.Digest...)
+	return append(file, anchor.Proof...), nil
+}
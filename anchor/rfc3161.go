@@ -0,0 +1,427 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package anchor
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/govice/golinks/block"
+	"github.com/pkg/errors"
+)
+
+var (
+	oidSHA256         = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384         = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512         = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	oidSignedData     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidContentType    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	maxResponseLength = int64(1 << 20)
+)
+
+// TSA requests RFC 3161 time-stamp tokens from a time-stamp authority
+type TSA struct {
+	url        string
+	hash       crypto.Hash
+	httpClient *http.Client
+}
+
+// NewTSA returns a client for the time-stamp authority at url, which imprints
+// block hashes with SHA256
+func NewTSA(url string) *TSA {
+	return &TSA{url: url, hash: crypto.SHA256, httpClient: http.DefaultClient}
+}
+
+// SetHash sets the hash used for the message imprint, one of SHA256, SHA384
+// or SHA512
+func (t *TSA) SetHash(hash crypto.Hash) error {
+	if _, err := hashOID(hash); err != nil {
+		return err
+	}
+	t.hash = hash
+	return nil
+}
+
+// SetHTTPClient sets the HTTP client used for requests
+func (t *TSA) SetHTTPClient(client *http.Client) {
+	t.httpClient = client
+}
+
+// Anchor requests a time-stamp token over hash and verifies the token answers
+// the request
+func (t *TSA) Anchor(ctx context.Context, hash []byte) (block.Anchor, error) {
+	oid, err := hashOID(t.hash)
+	if err != nil {
+		return block.Anchor{}, err
+	}
+	h := t.hash.New()
+	h.Write(hash)
+	digest := h.Sum(nil)
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return block.Anchor{}, errors.Wrap(err, "anchor: failed to generate nonce")
+	}
+	request, err := asn1.Marshal(timeStampReq{
+		Version:        1,
+		MessageImprint: messageImprint{HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oid}, HashedMessage: digest},
+		Nonce:          nonce,
+		CertReq:        true,
+	})
+	if err != nil {
+		return block.Anchor{}, errors.Wrap(err, "anchor: failed to encode time-stamp request")
+	}
+
+	token, err := t.post(ctx, request)
+	if err != nil {
+		return block.Anchor{}, err
+	}
+	info, err := verifyToken(token, hash, nil)
+	if err != nil {
+		return block.Anchor{}, err
+	}
+	if info.Nonce == nil || info.Nonce.Cmp(nonce) != 0 {
+		return block.Anchor{}, errors.Wrap(ErrBadAnchor, "time-stamp nonce does not match request")
+	}
+	return block.Anchor{
+		Type:      block.RFC3161,
+		Authority: t.url,
+		Digest:    digest,
+		Time:      info.GenTime.UnixNano(),
+		Proof:     token,
+	}, nil
+}
+
+// post sends a DER time-stamp request and returns the granted token
+func (t *TSA) post(ctx context.Context, request []byte) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodPost, t.url, bytes.NewReader(request))
+	if err != nil {
+		return nil, errors.Wrap(err, "anchor: failed to create request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/timestamp-query")
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "anchor: time-stamp request failed")
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseLength))
+	if err != nil {
+		return nil, errors.Wrap(err, "anchor: failed to read time-stamp response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("anchor: time-stamp authority returned status %d", resp.StatusCode)
+	}
+
+	var response timeStampResp
+	if _, err := asn1.Unmarshal(body, &response); err != nil {
+		return nil, errors.Wrap(err, "anchor: failed to decode time-stamp response")
+	}
+	//0 is granted and 1 granted with modifications
+	if response.Status.Status > 1 || len(response.TimeStampToken.FullBytes) == 0 {
+		return nil, errors.Errorf("anchor: time-stamp request rejected with status %d %v", response.Status.Status, response.Status.StatusString)
+	}
+	return response.TimeStampToken.FullBytes, nil
+}
+
+// VerifyToken checks an RFC 3161 time-stamp token imprints hash and is signed
+// by its embedded certificate, which must chain to roots unless roots is nil.
+// It returns the time the token attests.
+func VerifyToken(token, hash []byte, roots *x509.CertPool) (time.Time, error) {
+	info, err := verifyToken(token, hash, roots)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.GenTime, nil
+}
+
+func verifyToken(token, hash []byte, roots *x509.CertPool) (*tstInfo, error) {
+	var content contentInfo
+	if _, err := asn1.Unmarshal(token, &content); err != nil {
+		return nil, errors.Wrap(ErrBadAnchor, err.Error())
+	}
+	if !content.ContentType.Equal(oidSignedData) {
+		return nil, errors.Wrap(ErrBadAnchor, "time-stamp token is not signed data")
+	}
+	var signed signedData
+	if _, err := asn1.Unmarshal(content.Content.Bytes, &signed); err != nil {
+		return nil, errors.Wrap(ErrBadAnchor, err.Error())
+	}
+	if !signed.EncapContentInfo.EContentType.Equal(oidTSTInfo) || len(signed.SignerInfos) != 1 {
+		return nil, errors.Wrap(ErrBadAnchor, "time-stamp token has no single signed TSTInfo")
+	}
+	var info tstInfo
+	if _, err := asn1.Unmarshal(signed.EncapContentInfo.EContent, &info); err != nil {
+		return nil, errors.Wrap(ErrBadAnchor, err.Error())
+	}
+
+	//The imprint must be a digest of the anchored hash
+	imprintHash, err := oidHash(info.MessageImprint.HashAlgorithm.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	h := imprintHash.New()
+	h.Write(hash)
+	if !bytes.Equal(h.Sum(nil), info.MessageImprint.HashedMessage) {
+		return nil, errors.Wrap(ErrBadAnchor, "time-stamp imprint does not match hash")
+	}
+
+	certs, err := x509.ParseCertificates(signed.Certificates.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(ErrBadAnchor, err.Error())
+	}
+	signer := signed.SignerInfos[0]
+	cert, err := signerCertificate(signer, certs)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySigner(signer, cert, signed.EncapContentInfo.EContent); err != nil {
+		return nil, err
+	}
+	if roots != nil {
+		intermediates := x509.NewCertPool()
+		for _, c := range certs {
+			intermediates.AddCert(c)
+		}
+		_, err := cert.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			CurrentTime:   info.GenTime,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+		})
+		if err != nil {
+			return nil, errors.Wrap(ErrBadAnchor, err.Error())
+		}
+	}
+	return &info, nil
+}
+
+// signerCertificate finds the certificate identified by the signer
+func signerCertificate(signer signerInfo, certs []*x509.Certificate) (*x509.Certificate, error) {
+	var issuerSerial issuerAndSerialNumber
+	if _, err := asn1.Unmarshal(signer.SID.FullBytes, &issuerSerial); err == nil {
+		for _, cert := range certs {
+			if bytes.Equal(cert.RawIssuer, issuerSerial.Issuer.FullBytes) && cert.SerialNumber.Cmp(issuerSerial.SerialNumber) == 0 {
+				return cert, nil
+			}
+		}
+	} else if signer.SID.Class == asn1.ClassContextSpecific && signer.SID.Tag == 0 {
+		for _, cert := range certs {
+			if bytes.Equal(cert.SubjectKeyId, signer.SID.Bytes) {
+				return cert, nil
+			}
+		}
+	}
+	return nil, errors.Wrap(ErrBadAnchor, "time-stamp token does not include the signer's certificate")
+}
+
+// verifySigner checks the signer's signed attributes commit to content and
+// are signed by cert
+func verifySigner(signer signerInfo, cert *x509.Certificate, content []byte) error {
+	if len(signer.SignedAttrs.FullBytes) == 0 {
+		return errors.Wrap(ErrBadAnchor, "time-stamp signer has no signed attributes")
+	}
+	digestHash, err := oidHash(signer.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	//Signed attributes are signed as an explicit SET rather than their
+	//implicit [0] tag
+	signedAttrs := append([]byte{}, signer.SignedAttrs.FullBytes...)
+	signedAttrs[0] = 0x31
+	var attrs []attribute
+	if _, err := asn1.UnmarshalWithParams(signedAttrs, &attrs, "set"); err != nil {
+		return errors.Wrap(ErrBadAnchor, err.Error())
+	}
+	var messageDigest []byte
+	var contentType asn1.ObjectIdentifier
+	for _, attr := range attrs {
+		if len(attr.Values) != 1 {
+			continue
+		}
+		var err error
+		switch {
+		case attr.Type.Equal(oidMessageDigest):
+			_, err = asn1.Unmarshal(attr.Values[0].FullBytes, &messageDigest)
+		case attr.Type.Equal(oidContentType):
+			_, err = asn1.Unmarshal(attr.Values[0].FullBytes, &contentType)
+		}
+		if err != nil {
+			return errors.Wrap(ErrBadAnchor, err.Error())
+		}
+	}
+	if !contentType.Equal(oidTSTInfo) {
+		return errors.Wrap(ErrBadAnchor, "time-stamp signed content type is not TSTInfo")
+	}
+	h := digestHash.New()
+	h.Write(content)
+	if !bytes.Equal(h.Sum(nil), messageDigest) {
+		return errors.Wrap(ErrBadAnchor, "time-stamp message digest does not match content")
+	}
+
+	algorithm, err := signatureAlgorithm(cert, digestHash)
+	if err != nil {
+		return err
+	}
+	if err := cert.CheckSignature(algorithm, signedAttrs, signer.Signature); err != nil {
+		return errors.Wrap(ErrBadAnchor, err.Error())
+	}
+	return nil
+}
+
+// signatureAlgorithm returns the x509 signature algorithm for cert's key
+// over digests made with hash
+func signatureAlgorithm(cert *x509.Certificate, hash crypto.Hash) (x509.SignatureAlgorithm, error) {
+	algorithms := map[crypto.Hash][2]x509.SignatureAlgorithm{
+		crypto.SHA256: {x509.SHA256WithRSA, x509.ECDSAWithSHA256},
+		crypto.SHA384: {x509.SHA384WithRSA, x509.ECDSAWithSHA384},
+		crypto.SHA512: {x509.SHA512WithRSA, x509.ECDSAWithSHA512},
+	}
+	switch cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return algorithms[hash][0], nil
+	case *ecdsa.PublicKey:
+		return algorithms[hash][1], nil
+	case ed25519.PublicKey:
+		return x509.PureEd25519, nil
+	}
+	return x509.UnknownSignatureAlgorithm, errors.Errorf("anchor: unsupported time-stamp key %T", cert.PublicKey)
+}
+
+func hashOID(hash crypto.Hash) (asn1.ObjectIdentifier, error) {
+	switch hash {
+	case crypto.SHA256:
+		return oidSHA256, nil
+	case crypto.SHA384:
+		return oidSHA384, nil
+	case crypto.SHA512:
+		return oidSHA512, nil
+	}
+	return nil, errors.Errorf("anchor: unsupported imprint hash %v", hash)
+}
+
+func oidHash(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	switch {
+	case oid.Equal(oidSHA256):
+		return crypto.SHA256, nil
+	case oid.Equal(oidSHA384):
+		return crypto.SHA384, nil
+	case oid.Equal(oidSHA512):
+		return crypto.SHA512, nil
+	}
+	return 0, errors.Wrapf(ErrBadAnchor, "unsupported digest algorithm %v", oid)
+}
+
+// RFC 3161 and CMS structures
+
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional,default:false"`
+}
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type pkiStatusInfo struct {
+	Status       int
+	StatusString []string       `asn1:"optional,utf8"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type encapContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,optional,tag:0"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time     `asn1:"generalized"`
+	Accuracy       accuracy      `asn1:"optional"`
+	Ordering       bool          `asn1:"optional,default:false"`
+	Nonce          *big.Int      `asn1:"optional"`
+	TSA            asn1.RawValue `asn1:"explicit,optional,tag:0"`
+	Extensions     asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type accuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
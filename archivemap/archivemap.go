@@ -20,48 +20,79 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/json"
-	"fmt"
+	"os"
 	"sort"
-	"strings"
 )
 
 // ArchiveMap implements marshalling for a well-ordered ordered json map
 type ArchiveMap map[string][]byte
 
-// MarshalJSON creates a well ordered JSON byte array for an archive map alphabetically by key
-func (am ArchiveMap) MarshalJSON() ([]byte, error) {
-	buffer := bytes.NewBufferString("{")
-	length := len(am)
-	count := 0
+// Entry records the file metadata of an archived file
+type Entry struct {
+	Size    int64       `json:"size"`
+	ModTime int64       `json:"modTime"`
+	Mode    os.FileMode `json:"mode,omitempty"`
+	Owner   *Owner      `json:"owner,omitempty"`
+	Chunks  []Chunk     `json:"chunks,omitempty"`
+	CID     string      `json:"cid,omitempty"`
+	// Hardlink is the archive path of the first link to the same file
+	Hardlink string `json:"hardlink,omitempty"`
+	// Name is the path of the file as found under the root, recorded when
+	// key normalization changed it
+	Name string `json:"name,omitempty"`
+}
 
-	// Sort keys and marshal them to JSON in alphabetical order
-	keys := make([]string, 0)
-	for k := range am {
-		keys = append(keys, k)
-	}
+// Chunk records the hash of a region of an archived file
+type Chunk struct {
+	Offset int64  `json:"offset"`
+	Size   int64  `json:"size"`
+	Hash   []byte `json:"hash"`
+}
 
-	sort.Strings(keys)
+// Owner records the user and group ids owning an archived file
+type Owner struct {
+	UID uint32 `json:"uid"`
+	GID uint32 `json:"gid"`
+}
 
-	for _, key := range keys {
-		jsonValue, err := json.Marshal(am[key])
-		if err != nil {
-			return nil, err
-		}
+// MetadataEqual returns true if the permissions, ownership and hard links of
+// two entries match. Permissions and ownership not recorded in either entry
+// are not compared.
+func (e Entry) MetadataEqual(other Entry) bool {
+	if e.Mode != 0 && other.Mode != 0 && e.Mode != other.Mode {
+		return false
+	}
+	if e.Owner != nil && other.Owner != nil && *e.Owner != *other.Owner {
+		return false
+	}
+	if e.Hardlink != other.Hardlink {
+		return false
+	}
+	return true
+}
 
-		escapedKey := strings.Replace(key, "\\", "/", -1)
-		entry := fmt.Sprintf("\"%s\":%s", escapedKey, jsonValue)
-		if _, err := buffer.WriteString(entry); err != nil {
-			return nil, err
-		}
-		count++
-		if count < length {
-			if _, err := buffer.WriteString(","); err != nil {
-				return nil, err
-			}
-		}
+// EntryMap maps archive keys to their recorded file metadata
+type EntryMap map[string]Entry
+
+// SortedKeys returns the keys of the archive in ascending order of their UTF-8 bytes, which is
+// also ascending code point order. Keys are compared as stored, before any \ is replaced with /.
+// Hashing, diffing and encoding the archive all iterate keys in this order.
+func (am ArchiveMap) SortedKeys() []string {
+	keys := make([]string, 0, len(am))
+	for k := range am {
+		keys = append(keys, k)
 	}
+	sort.Strings(keys)
+	return keys
+}
 
-	if _, err := buffer.WriteString("}"); err != nil {
+// MarshalJSON creates a well ordered JSON byte array for an archive map with entries in
+// SortedKeys order. The output is the archive's Canonical encoding with invalid UTF-8
+// replaced by U+FFFD as encoding/json does, so marshaling the same archive always yields
+// the same bytes.
+func (am ArchiveMap) MarshalJSON() ([]byte, error) {
+	var buffer bytes.Buffer
+	if err := am.write(newJSONWriter(&buffer)); err != nil {
 		return nil, err
 	}
 	return buffer.Bytes(), nil
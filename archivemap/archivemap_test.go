@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"encoding/base64"
 	"os"
+	"reflect"
 	"testing"
 )
 
@@ -61,3 +62,65 @@ func Test_MarshalJSON(t *testing.T) {
 		}
 	}
 }
+
+func TestArchiveMap_SortedKeys(t *testing.T) {
+	hash := []byte{1}
+	am := ArchiveMap{
+		"z":          hash,
+		"\u00e9":     hash,
+		"e\u0301":    hash,
+		"\uff61":     hash,
+		"\U0001f600": hash,
+		"a\\c":       hash,
+		"a/b":        hash,
+		"a0":         hash,
+		"A":          hash,
+		"":           hash,
+	}
+	//UTF-8 byte order, which differs from UTF-16 order for U+FF61 and U+1F600
+	want := []string{"", "A", "a/b", "a0", "a\\c", "e\u0301", "z", "\u00e9", "\uff61", "\U0001f600"}
+	for i := 0; i < 10; i++ {
+		if keys := am.SortedKeys(); !reflect.DeepEqual(keys, want) {
+			t.Fatalf("unexpected order %q", keys)
+		}
+	}
+	if keys := (ArchiveMap{}).SortedKeys(); keys == nil || len(keys) != 0 {
+		t.Errorf("expected empty keys, got %v", keys)
+	}
+}
+
+func TestArchiveMap_MarshalJSONOrder(t *testing.T) {
+	hash := []byte{1}
+	am := ArchiveMap{"a\\c": hash, "a/b": hash, "a0": hash, "\u00e9": hash, "z": hash}
+	//Mixed separators are ordered as stored and normalized when written
+	want := `{"a/b":"AQ==","a0":"AQ==","a/c":"AQ==","z":"AQ==","é":"AQ=="}`
+	for i := 0; i < 10; i++ {
+		got, err := am.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Fatalf("unexpected encoding %s, want %s", got, want)
+		}
+	}
+}
+
+func TestEntry_MetadataEqual(t *testing.T) {
+	a := Entry{Mode: 0644, Owner: &Owner{UID: 1, GID: 1}}
+
+	if !a.MetadataEqual(Entry{Mode: 0644, Owner: &Owner{UID: 1, GID: 1}}) {
+		t.Error("expected equal metadata")
+	}
+	if a.MetadataEqual(Entry{Mode: 0600, Owner: &Owner{UID: 1, GID: 1}}) {
+		t.Error("expected mode change to be detected")
+	}
+	if a.MetadataEqual(Entry{Mode: 0644, Owner: &Owner{UID: 2, GID: 1}}) {
+		t.Error("expected owner change to be detected")
+	}
+	if !a.MetadataEqual(Entry{}) {
+		t.Error("expected unrecorded metadata to be skipped")
+	}
+	if a.MetadataEqual(Entry{Hardlink: "b"}) {
+		t.Error("expected hard link change to be detected")
+	}
+}
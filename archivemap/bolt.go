@@ -0,0 +1,216 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package archivemap
+
+import (
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+var boltArchiveBucket = []byte("archive")
+
+// boltBatchSize is the number of puts buffered before they are committed in
+// a single transaction
+const boltBatchSize = 10000
+
+// BoltStore is a Store persisting the archive in an embedded bbolt database.
+// bbolt orders keys by their bytes, so iteration already follows SortedKeys.
+// Puts are buffered and committed in batches; any read commits them first.
+type BoltStore struct {
+	db      *bolt.DB
+	pending []boltPut
+}
+
+type boltPut struct {
+	key   string
+	value []byte
+}
+
+// OpenBoltStore opens or creates a bbolt backed store at path
+func OpenBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "OpenBoltStore: failed to open database")
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltArchiveBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "OpenBoltStore: failed to create bucket")
+	}
+	return &BoltStore{db: db}, nil
+}
+
+// Put records the hash and entry of key
+func (s *BoltStore) Put(key string, hash []byte, entry Entry) error {
+	value, err := encodeBoltValue(hash, entry)
+	if err != nil {
+		return errors.Wrap(err, "BoltStore: failed to encode entry")
+	}
+	s.pending = append(s.pending, boltPut{key: key, value: value})
+	if len(s.pending) >= boltBatchSize {
+		return s.flush()
+	}
+	return nil
+}
+
+// flush commits the buffered puts
+func (s *BoltStore) flush() error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltArchiveBucket)
+		for _, put := range s.pending {
+			if err := bucket.Put([]byte(put.key), put.value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "BoltStore: failed to commit entries")
+	}
+	s.pending = s.pending[:0]
+	return nil
+}
+
+// Get returns the hash and entry of key
+func (s *BoltStore) Get(key string) ([]byte, Entry, bool, error) {
+	if err := s.flush(); err != nil {
+		return nil, Entry{}, false, err
+	}
+	var value []byte
+	s.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(boltArchiveBucket).Get([]byte(key)); v != nil {
+			value = append([]byte{}, v...)
+		}
+		return nil
+	})
+	if value == nil {
+		return nil, Entry{}, false, nil
+	}
+	hash, entry, err := decodeBoltValue(value)
+	return hash, entry, err == nil, err
+}
+
+// Delete removes key
+func (s *BoltStore) Delete(key string) error {
+	if err := s.flush(); err != nil {
+		return err
+	}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltArchiveBucket).Delete([]byte(key))
+	})
+	return errors.Wrap(err, "BoltStore: failed to delete entry")
+}
+
+// Len returns the number of keys
+func (s *BoltStore) Len() (int, error) {
+	if err := s.flush(); err != nil {
+		return 0, err
+	}
+	var n int
+	err := s.db.View(func(tx *bolt.Tx) error {
+		n = tx.Bucket(boltArchiveBucket).Stats().KeyN
+		return nil
+	})
+	return n, err
+}
+
+// ForEach calls fn with every key in SortedKeys order
+func (s *BoltStore) ForEach(fn func(key string, hash []byte, entry Entry) error) error {
+	if err := s.flush(); err != nil {
+		return err
+	}
+	return s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltArchiveBucket).ForEach(func(k, v []byte) error {
+			hash, entry, err := decodeBoltValue(v)
+			if err != nil {
+				return err
+			}
+			return fn(string(k), hash, entry)
+		})
+	})
+}
+
+// Reset removes every key
+func (s *BoltStore) Reset() error {
+	s.pending = s.pending[:0]
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(boltArchiveBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucket(boltArchiveBucket)
+		return err
+	})
+	return errors.Wrap(err, "BoltStore: failed to reset")
+}
+
+// Close commits buffered puts and closes the database
+func (s *BoltStore) Close() error {
+	err := s.flush()
+	if closeErr := s.db.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// encodeBoltValue encodes a hash and entry as a flag for nil hashes, the
+// varint length of the hash, the hash and the JSON encoded entry
+func encodeBoltValue(hash []byte, entry Entry) ([]byte, error) {
+	encoded, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	value := make([]byte, 1, 1+binary.MaxVarintLen64+len(hash)+len(encoded))
+	if hash != nil {
+		value[0] = 1
+	}
+	value = appendUvarint(value, uint64(len(hash)))
+	value = append(value, hash...)
+	return append(value, encoded...), nil
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+func decodeBoltValue(value []byte) ([]byte, Entry, error) {
+	var entry Entry
+	if len(value) == 0 {
+		return nil, entry, errors.New("BoltStore: empty value")
+	}
+	size, n := binary.Uvarint(value[1:])
+	if n <= 0 || uint64(len(value)-1-n) < size {
+		return nil, entry, errors.New("BoltStore: corrupt value")
+	}
+	var hash []byte
+	if value[0] == 1 {
+		hash = append([]byte{}, value[1+n:1+n+int(size)]...)
+	}
+	if err := json.Unmarshal(value[1+n+int(size):], &entry); err != nil {
+		return nil, entry, errors.Wrap(err, "BoltStore: corrupt entry")
+	}
+	return hash, entry, nil
+}
@@ -0,0 +1,86 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package archivemap
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBoltStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := OpenBoltStore(filepath.Join(dir, "archive.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	am := ArchiveMap{"b": []byte("2"), "a\\<x>": []byte("1"), "dir/": nil, "\xff": []byte("3")}
+	entries := EntryMap{"b": {Size: 2, ModTime: 7}, "a\\<x>": {Size: 1, Mode: 0644}, "dir/": {}, "\xff": {Chunks: []Chunk{{Size: 1, Hash: []byte("c")}}}}
+	for key, hash := range am {
+		if err := store.Put(key, hash, entries[key]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var canonical bytes.Buffer
+	if err := WriteStoreCanonical(&canonical, store); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := am.Canonical()
+	if canonical.String() != string(want) {
+		t.Errorf("canonical = %s, want %s", canonical.String(), want)
+	}
+
+	var encoded bytes.Buffer
+	if err := WriteStoreEntries(&encoded, store); err != nil {
+		t.Fatal(err)
+	}
+	want, _ = json.Marshal(entries)
+	if encoded.String() != string(want) {
+		t.Errorf("entries = %s, want %s", encoded.String(), want)
+	}
+
+	hash, _, ok, err := store.Get("dir/")
+	if err != nil || !ok || hash != nil {
+		t.Errorf("Get(dir/) = %v, %v, %v", hash, ok, err)
+	}
+	if err := store.Delete("b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok, _ := store.Get("b"); ok {
+		t.Error("deleted key still present")
+	}
+	if n, err := store.Len(); err != nil || n != 3 {
+		t.Errorf("Len = %d, %v, want 3", n, err)
+	}
+	if err := store.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := store.Len(); n != 0 {
+		t.Errorf("Len after Reset = %d", n)
+	}
+}
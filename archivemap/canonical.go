@@ -0,0 +1,206 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package archivemap
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+const hexDigits = "0123456789abcdef"
+
+// Canonical returns the canonical encoding of the archive used for hashing.
+//
+// The canonical encoding is a JSON object with no insignificant whitespace:
+//
+//   - Entries are in SortedKeys order, comparing the UTF-8 bytes of each key
+//     as stored. Keys mixing \ and / are ordered before normalization.
+//   - Keys have any \ replaced with / and are written as JSON strings.
+//   - Values are written as JSON strings holding the padded standard base64
+//     encoding of the hash, or null for a nil hash.
+//   - Within strings " and \ are escaped as \" and \\, newline, carriage
+//     return and tab as \n, \r and \t, other characters below U+0020 and the
+//     characters <, >, &, U+2028 and U+2029 as \u followed by four lowercase
+//     hex digits. Each invalid UTF-8 byte is written as \x followed by two
+//     lowercase hex digits, so distinct keys never share an encoding. All
+//     other characters are written as raw UTF-8.
+//
+// The escaping rules match the output of earlier versions of this package for
+// keys of valid UTF-8, so root hashes of archives with such keys are
+// unchanged. Earlier versions wrote invalid UTF-8 bytes raw, so root hashes
+// of archives with keys holding them differ. Since \x escapes aren't valid
+// JSON, the archive is encoded as JSON by MarshalJSON instead.
+func (am ArchiveMap) Canonical() ([]byte, error) {
+	var buffer bytes.Buffer
+	if err := am.WriteCanonical(&buffer); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// WriteCanonical writes the canonical encoding of the archive to w
+func (am ArchiveMap) WriteCanonical(w io.Writer) error {
+	return am.write(newCanonicalWriter(w))
+}
+
+func (am ArchiveMap) write(cw *canonicalWriter) error {
+	for _, key := range am.SortedKeys() {
+		if err := cw.add(key, am[key]); err != nil {
+			return err
+		}
+	}
+	return cw.close()
+}
+
+// canonicalFlushSize is the amount of encoded output buffered before it is
+// written, bounding memory use regardless of the archive size
+const canonicalFlushSize = 32 * 1024
+
+// canonicalWriter streams the canonical encoding of entries added in
+// SortedKeys order. Entries are encoded into a reused buffer so streaming an
+// archive allocates little beyond the sorted keys.
+type canonicalWriter struct {
+	w       io.Writer
+	buffer  bytes.Buffer
+	encoded []byte
+	n       int
+	// json replaces invalid UTF-8 with U+FFFD like encoding/json rather
+	// than escaping it
+	json bool
+}
+
+func newCanonicalWriter(w io.Writer) *canonicalWriter {
+	cw := &canonicalWriter{w: w}
+	cw.buffer.Grow(2 * canonicalFlushSize)
+	cw.buffer.WriteByte('{')
+	return cw
+}
+
+// newJSONWriter returns a canonicalWriter writing valid JSON
+func newJSONWriter(w io.Writer) *canonicalWriter {
+	cw := newCanonicalWriter(w)
+	cw.json = true
+	return cw
+}
+
+// add writes the entry for key
+func (cw *canonicalWriter) add(key string, value []byte) error {
+	cw.key(strings.Replace(key, "\\", "/", -1))
+	cw.value(value)
+	return cw.flush()
+}
+
+// addRaw writes key as is followed by an already encoded JSON value
+func (cw *canonicalWriter) addRaw(key string, value []byte) error {
+	cw.key(key)
+	cw.buffer.Write(value)
+	return cw.flush()
+}
+
+func (cw *canonicalWriter) key(key string) {
+	if cw.n > 0 {
+		cw.buffer.WriteByte(',')
+	}
+	cw.n++
+	writeCanonicalString(&cw.buffer, key, cw.json)
+	cw.buffer.WriteByte(':')
+}
+
+func (cw *canonicalWriter) flush() error {
+	//Flush periodically so large archives aren't held in memory twice
+	if cw.buffer.Len() > canonicalFlushSize {
+		if _, err := cw.w.Write(cw.buffer.Bytes()); err != nil {
+			return err
+		}
+		cw.buffer.Reset()
+	}
+	return nil
+}
+
+// close ends the object and flushes the remaining output
+func (cw *canonicalWriter) close() error {
+	cw.buffer.WriteByte('}')
+	_, err := cw.w.Write(cw.buffer.Bytes())
+	return err
+}
+
+// value writes a hash as a base64 string, reusing the encoding buffer
+func (cw *canonicalWriter) value(value []byte) {
+	if value == nil {
+		cw.buffer.WriteString("null")
+		return
+	}
+	size := base64.StdEncoding.EncodedLen(len(value))
+	if cap(cw.encoded) < size {
+		cw.encoded = make([]byte, size)
+	}
+	cw.encoded = cw.encoded[:size]
+	base64.StdEncoding.Encode(cw.encoded, value)
+	cw.buffer.WriteByte('"')
+	cw.buffer.Write(cw.encoded)
+	cw.buffer.WriteByte('"')
+}
+
+// writeCanonicalString writes s as a string of the canonical encoding, or
+// as a JSON string when json is set
+func writeCanonicalString(buffer *bytes.Buffer, s string, json bool) {
+	buffer.WriteByte('"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				buffer.WriteByte('\\')
+				buffer.WriteByte(c)
+			case c == '\n':
+				buffer.WriteString(`\n`)
+			case c == '\r':
+				buffer.WriteString(`\r`)
+			case c == '\t':
+				buffer.WriteString(`\t`)
+			case c < 0x20 || c == '<' || c == '>' || c == '&':
+				buffer.WriteString(`\u00`)
+				buffer.WriteByte(hexDigits[c>>4])
+				buffer.WriteByte(hexDigits[c&0xf])
+			default:
+				buffer.WriteByte(c)
+			}
+			i++
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1 && json:
+			buffer.WriteRune(utf8.RuneError)
+		case r == utf8.RuneError && size == 1:
+			buffer.WriteString(`\x`)
+			buffer.WriteByte(hexDigits[s[i]>>4])
+			buffer.WriteByte(hexDigits[s[i]&0xf])
+		case r == 0x2028 || r == 0x2029:
+			buffer.WriteString(`\u202`)
+			buffer.WriteByte(hexDigits[r&0xf])
+		default:
+			buffer.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	buffer.WriteByte('"')
+}
@@ -0,0 +1,125 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package archivemap
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"strconv"
+	"testing"
+)
+
+func TestArchiveMap_Canonical(t *testing.T) {
+	hash := []byte("hash")
+	am := ArchiveMap{
+		"b":           hash,
+		"a":           hash,
+		"dir\\file":   hash,
+		"quote\"d":    hash,
+		"<html>&amp;": hash,
+		"tab\tnl\n":   hash,
+		"ctrl\x01":    hash,
+		"unicode é":   hash,
+		"invalid\xff": hash,
+		"sep" + string(rune(0x2028)) + string(rune(0x2029)): hash,
+	}
+
+	canonical, err := am.Canonical()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//The JSON form must match encoding/json escaping
+	expected := make(map[string]string)
+	for key, value := range am {
+		expected[string(bytes.Replace([]byte(key), []byte("\\"), []byte("/"), -1))] = base64.StdEncoding.EncodeToString(value)
+	}
+	expectedJSON, err := json.Marshal(expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	marshaled, err := json.Marshal(am)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(marshaled, expectedJSON) {
+		t.Error("json.Marshal output does not match expected encoding\n" + string(marshaled) + "\n" + string(expectedJSON))
+	}
+
+	//The canonical form only differs by escaping invalid UTF-8
+	if !bytes.Equal(canonical, bytes.Replace(marshaled, []byte("invalid\uFFFD"), []byte(`invalid\xff`), 1)) {
+		t.Error("canonical encoding differs from json.Marshal output\n" + string(canonical) + "\n" + string(marshaled))
+	}
+
+	var streamed bytes.Buffer
+	if err := am.WriteCanonical(&streamed); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(canonical, streamed.Bytes()) {
+		t.Error("WriteCanonical output differs from Canonical")
+	}
+}
+
+func TestArchiveMap_WriteCanonicalStreams(t *testing.T) {
+	am := make(ArchiveMap)
+	for i := 0; i < 20000; i++ {
+		am["dir/file"+strconv.Itoa(i)] = bytes.Repeat([]byte{byte(i)}, sha512.Size)
+	}
+
+	canonical, err := am.Canonical()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := sha512.New()
+	if err := am.WriteCanonical(hash); err != nil {
+		t.Fatal(err)
+	}
+	if expected := sha512.Sum512(canonical); !bytes.Equal(hash.Sum(nil), expected[:]) {
+		t.Error("streamed digest differs from the digest of the canonical encoding")
+	}
+
+	//Allocations don't grow with the number of entries
+	allocs := testing.AllocsPerRun(5, func() {
+		am.WriteCanonical(ioutil.Discard)
+	})
+	if allocs > 20 {
+		t.Errorf("WriteCanonical allocated %v times for %d entries", allocs, len(am))
+	}
+}
+
+func TestArchiveMap_CanonicalGolden(t *testing.T) {
+	am := ArchiveMap{"b": []byte{1}, "a": nil, "c": {}}
+	canonical, err := am.Canonical()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if golden := `{"a":null,"b":"AQ==","c":""}`; string(canonical) != golden {
+		t.Error("unexpected canonical encoding " + string(canonical) + " | " + golden)
+	}
+
+	//Invalid UTF-8 is escaped losslessly
+	invalid := ArchiveMap{"a\xfe": nil, "a\xff": nil, "a\ufffd": nil}
+	if canonical, err = invalid.Canonical(); err != nil {
+		t.Fatal(err)
+	}
+	if golden := "{\"a\ufffd\":null,\"a\\xfe\":null,\"a\\xff\":null}"; string(canonical) != golden {
+		t.Error("unexpected canonical encoding " + string(canonical) + " | " + golden)
+	}
+}
@@ -0,0 +1,90 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package archivemap
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// MergeStrategy selects how Merge resolves keys present in both archives
+// with different hashes
+type MergeStrategy int
+
+const (
+	// MergeError fails the merge on any conflict, leaving the archive
+	// unchanged. This is the default.
+	MergeError MergeStrategy = iota
+	// MergeOurs keeps the receiver's hash on conflicts
+	MergeOurs
+	// MergeTheirs takes the other archive's hash on conflicts
+	MergeTheirs
+)
+
+// ErrMergeConflict is matched by the ConflictError returned by Merge
+var ErrMergeConflict = errors.New("archivemap: merge conflict")
+
+// ErrUnknownMergeStrategy is returned by Merge for undefined strategies
+var ErrUnknownMergeStrategy = errors.New("archivemap: unknown merge strategy")
+
+// ConflictError lists the keys present in both archives with different hashes
+type ConflictError struct {
+	Keys []string
+}
+
+func (e *ConflictError) Error() string {
+	return "archivemap: merge conflict on " + strings.Join(e.Keys, ", ")
+}
+
+// Is matches ErrMergeConflict
+func (e *ConflictError) Is(target error) bool { return target == ErrMergeConflict }
+
+// Merge adds every entry of other to the archive. Keys present in both
+// archives with equal hashes aren't conflicts, other conflicts are resolved
+// by strategy. Keys are compared as stored so both archives should use /
+// separators, as generated archives do.
+func (am ArchiveMap) Merge(other ArchiveMap, strategy MergeStrategy) error {
+	switch strategy {
+	case MergeError, MergeOurs, MergeTheirs:
+	default:
+		return ErrUnknownMergeStrategy
+	}
+
+	if strategy == MergeError {
+		var conflicts []string
+		for key, hash := range other {
+			if existing, ok := am[key]; ok && !bytes.Equal(existing, hash) {
+				conflicts = append(conflicts, key)
+			}
+		}
+		if len(conflicts) > 0 {
+			sort.Strings(conflicts)
+			return &ConflictError{Keys: conflicts}
+		}
+	}
+
+	for key, hash := range other {
+		if _, ok := am[key]; ok && strategy == MergeOurs {
+			continue
+		}
+		am[key] = hash
+	}
+	return nil
+}
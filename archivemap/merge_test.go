@@ -0,0 +1,68 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package archivemap
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestArchiveMap_Merge(t *testing.T) {
+	ours := func() ArchiveMap {
+		return ArchiveMap{"a": []byte{1}, "shared": []byte{2}, "b": []byte{3}}
+	}
+	theirs := ArchiveMap{"c": []byte{4}, "shared": []byte{2}, "b": []byte{5}}
+
+	am := ours()
+	err := am.Merge(theirs, MergeError)
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) || !errors.Is(err, ErrMergeConflict) || !reflect.DeepEqual(conflict.Keys, []string{"b"}) {
+		t.Errorf("expected conflict on b, got %v", err)
+	}
+	if !reflect.DeepEqual(am, ours()) {
+		t.Errorf("failed merge changed the archive %v", am)
+	}
+
+	am = ours()
+	if err := am.Merge(theirs, MergeOurs); err != nil {
+		t.Fatal(err)
+	}
+	want := ArchiveMap{"a": []byte{1}, "shared": []byte{2}, "b": []byte{3}, "c": []byte{4}}
+	if !reflect.DeepEqual(am, want) {
+		t.Errorf("unexpected ours merge %v", am)
+	}
+
+	am = ours()
+	if err := am.Merge(theirs, MergeTheirs); err != nil {
+		t.Fatal(err)
+	}
+	want["b"] = []byte{5}
+	if !reflect.DeepEqual(am, want) {
+		t.Errorf("unexpected theirs merge %v", am)
+	}
+
+	//Disjoint archives never conflict
+	am = ArchiveMap{"x/a": []byte{1}}
+	if err := am.Merge(ArchiveMap{"y/a": []byte{1}}, MergeError); err != nil || len(am) != 2 {
+		t.Errorf("unexpected disjoint merge %v %v", am, err)
+	}
+
+	if err := am.Merge(theirs, MergeStrategy(9)); err != ErrUnknownMergeStrategy {
+		t.Errorf("expected unknown strategy error, got %v", err)
+	}
+}
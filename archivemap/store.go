@@ -0,0 +1,81 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package archivemap
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// Store holds an archive's hashes and entries outside of memory so archives
+// of very large trees don't need to fit in an ArchiveMap
+type Store interface {
+	// Put records the hash and entry of key, replacing any previous value
+	Put(key string, hash []byte, entry Entry) error
+	// Get returns the hash and entry of key and whether it is present
+	Get(key string) ([]byte, Entry, bool, error)
+	// Delete removes key
+	Delete(key string) error
+	// Len returns the number of keys
+	Len() (int, error)
+	// ForEach calls fn with every key in SortedKeys order, stopping at the
+	// first error fn returns
+	ForEach(fn func(key string, hash []byte, entry Entry) error) error
+	// Reset removes every key
+	Reset() error
+	// Close releases resources held by the store
+	Close() error
+}
+
+// WriteStoreCanonical streams the canonical encoding of the archive held in s
+// to w. The output is identical to Canonical of the same archive in memory.
+func WriteStoreCanonical(w io.Writer, s Store) error {
+	return writeStore(newCanonicalWriter(w), s)
+}
+
+// WriteStoreJSON streams the archive held in s to w as JSON. The output is
+// identical to MarshalJSON of the same archive in memory.
+func WriteStoreJSON(w io.Writer, s Store) error {
+	return writeStore(newJSONWriter(w), s)
+}
+
+func writeStore(cw *canonicalWriter, s Store) error {
+	err := s.ForEach(func(key string, hash []byte, entry Entry) error {
+		return cw.add(key, hash)
+	})
+	if err != nil {
+		return err
+	}
+	return cw.close()
+}
+
+// WriteStoreEntries streams the entries held in s to w as a JSON object
+// matching the encoding of an EntryMap
+func WriteStoreEntries(w io.Writer, s Store) error {
+	cw := newJSONWriter(w)
+	err := s.ForEach(func(key string, hash []byte, entry Entry) error {
+		value, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		return cw.addRaw(key, value)
+	})
+	if err != nil {
+		return err
+	}
+	return cw.close()
+}
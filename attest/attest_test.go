@@ -0,0 +1,149 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package attest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/govice/golinks/blockmap"
+	"github.com/pkg/errors"
+)
+
+func TestPAE(t *testing.T) {
+	expected := "DSSEv1 29 http://example.com/HelloWorld 11 hello world"
+	if got := string(pae("http://example.com/HelloWorld", []byte("hello world"))); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestNewStatement(t *testing.T) {
+	root, err := ioutil.TempDir("", "attest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := ioutil.WriteFile(filepath.Join(root, "a"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	b := blockmap.New(root, blockmap.WithHash(blockmap.SHA256))
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+
+	started := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	s, err := NewStatement(b, WithFiles(), WithBuilder("https://ci.example.com"),
+		WithInvocation("job-1"), WithTimes(started, started.Add(time.Minute)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Type != StatementType || s.PredicateType != ProvenanceType || len(s.Subject) != 2 {
+		t.Fatalf("unexpected statement %+v", s)
+	}
+	if s.Subject[0].Name != filepath.Base(root) || s.Subject[0].Digest[RootDigest] != hex.EncodeToString(b.RootHash) {
+		t.Errorf("unexpected root subject %+v", s.Subject[0])
+	}
+	// SHA256 of "a"
+	if digest := s.Subject[1].Digest["sha256"]; s.Subject[1].Name != "a" ||
+		digest != "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb" {
+		t.Errorf("unexpected file subject %+v", s.Subject[1])
+	}
+	run := s.Predicate.RunDetails
+	if run.Builder.ID != "https://ci.example.com" || run.Metadata == nil || run.Metadata.InvocationID != "job-1" ||
+		!run.Metadata.StartedOn.Equal(started) {
+		t.Errorf("unexpected run details %+v", run)
+	}
+	if err := s.Matches(b); err != nil {
+		t.Error(err)
+	}
+
+	b.Keyed = true
+	if _, err := NewStatement(b, WithFiles()); err != ErrKeyed {
+		t.Errorf("expected %v, got %v", ErrKeyed, err)
+	}
+	b.RootHash = []byte("other")
+	if err := s.Matches(b); err != ErrSubjectMismatch {
+		t.Errorf("expected %v, got %v", ErrSubjectMismatch, err)
+	}
+}
+
+func TestSign(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := blockmap.New("/srv/data")
+	b.RootHash = []byte("root")
+	s, err := NewStatement(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := Sign(s, edKey, ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Envelopes survive encoding
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Envelope
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []crypto.PublicKey{edKey.Public(), ecKey.Public()} {
+		opened, err := decoded.Open(key)
+		if err != nil {
+			t.Fatalf("%T: %v", key, err)
+		}
+		if err := opened.Matches(b); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := decoded.Open(otherKey.Public()); err != ErrBadSignature {
+		t.Errorf("expected %v for an untrusted key, got %v", ErrBadSignature, err)
+	}
+
+	decoded.Payload = append(decoded.Payload[:len(decoded.Payload)-1], ' ')
+	if _, err := decoded.Open(edKey.Public()); err != ErrBadSignature {
+		t.Errorf("expected %v for a tampered payload, got %v", ErrBadSignature, err)
+	}
+	decoded.PayloadType = "text/plain"
+	if _, err := decoded.Open(edKey.Public()); errors.Cause(err) != ErrPayloadType {
+		t.Errorf("expected %v, got %v", ErrPayloadType, err)
+	}
+}
@@ -0,0 +1,151 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package attest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// PayloadType is the DSSE payload type of in-toto statements
+const PayloadType = "application/vnd.in-toto+json"
+
+var (
+	// ErrBadSignature is returned when no trusted key signed an envelope
+	ErrBadSignature = errors.New("attest: invalid signature")
+	// ErrPayloadType is returned when opening an envelope that doesn't hold
+	// an in-toto statement
+	ErrPayloadType = errors.New("attest: unexpected payload type")
+)
+
+// Envelope is a DSSE envelope. Payload is base64 encoded by encoding/json.
+type Envelope struct {
+	PayloadType string      `json:"payloadType"`
+	Payload     []byte      `json:"payload"`
+	Signatures  []Signature `json:"signatures"`
+}
+
+// Signature is a DSSE signature. KeyID is the hex SHA256 digest of the
+// signer's PKIX DER encoded public key.
+type Signature struct {
+	KeyID string `json:"keyid"`
+	Sig   []byte `json:"sig"`
+}
+
+// pae returns the DSSE pre-authentication encoding of a payload
+func pae(payloadType string, payload []byte) []byte {
+	encoded := []byte("DSSEv1 " + strconv.Itoa(len(payloadType)) + " " + payloadType + " " + strconv.Itoa(len(payload)) + " ")
+	return append(encoded, payload...)
+}
+
+// KeyID returns the DSSE key ID of a public key
+func KeyID(key crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", errors.Wrap(err, "attest: failed to encode public key")
+	}
+	digest := sha256.Sum256(der)
+	return hex.EncodeToString(digest[:]), nil
+}
+
+// Sign encodes the statement into an envelope signed by every signer, which
+// must hold Ed25519 or ECDSA keys. ECDSA keys sign a SHA256 digest.
+func Sign(s *Statement, signers ...crypto.Signer) (*Envelope, error) {
+	payload, err := json.Marshal(s)
+	if err != nil {
+		return nil, errors.Wrap(err, "attest: failed to encode statement")
+	}
+	e := &Envelope{PayloadType: PayloadType, Payload: payload, Signatures: []Signature{}}
+	message := pae(e.PayloadType, e.Payload)
+	for _, signer := range signers {
+		keyID, err := KeyID(signer.Public())
+		if err != nil {
+			return nil, err
+		}
+		var sig []byte
+		switch signer.Public().(type) {
+		case ed25519.PublicKey:
+			sig, err = signer.Sign(rand.Reader, message, crypto.Hash(0))
+		case *ecdsa.PublicKey:
+			digest := sha256.Sum256(message)
+			sig, err = signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+		default:
+			return nil, errors.Errorf("attest: unsupported signing key %T", signer.Public())
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "attest: failed to sign statement")
+		}
+		e.Signatures = append(e.Signatures, Signature{KeyID: keyID, Sig: sig})
+	}
+	return e, nil
+}
+
+// Open verifies that one of the trusted keys signed the envelope and returns
+// its statement
+func (e *Envelope) Open(trusted ...crypto.PublicKey) (*Statement, error) {
+	if e.PayloadType != PayloadType {
+		return nil, errors.Wrap(ErrPayloadType, e.PayloadType)
+	}
+	if !e.verify(trusted) {
+		return nil, ErrBadSignature
+	}
+	var s Statement
+	if err := json.Unmarshal(e.Payload, &s); err != nil {
+		return nil, errors.Wrap(err, "attest: failed to decode statement")
+	}
+	if s.Type != StatementType {
+		return nil, errors.Wrap(ErrPayloadType, s.Type)
+	}
+	return &s, nil
+}
+
+func (e *Envelope) verify(trusted []crypto.PublicKey) bool {
+	message := pae(e.PayloadType, e.Payload)
+	digest := sha256.Sum256(message)
+	for _, key := range trusted {
+		keyID, err := KeyID(key)
+		if err != nil {
+			continue
+		}
+		for _, sig := range e.Signatures {
+			//Key IDs are hints, so signatures without one are tried too
+			if sig.KeyID != "" && sig.KeyID != keyID {
+				continue
+			}
+			switch key := key.(type) {
+			case ed25519.PublicKey:
+				if ed25519.Verify(key, message, sig.Sig) {
+					return true
+				}
+			case *ecdsa.PublicKey:
+				if ecdsa.VerifyASN1(key, digest[:], sig.Sig) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,224 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+// Package attest exports blockmap root hashes as in-toto statements carrying
+// SLSA provenance, signed in DSSE envelopes, so build systems can publish the
+// integrity of a directory as a standard supply-chain attestation.
+package attest
+
+import (
+	"bytes"
+	"encoding/hex"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/govice/golinks/blockmap"
+	"github.com/pkg/errors"
+)
+
+// In-toto and SLSA type URIs
+const (
+	StatementType  = "https://in-toto.io/Statement/v1"
+	ProvenanceType = "https://slsa.dev/provenance/v1"
+	// BuildType describes builds that produced a directory recorded by a link
+	BuildType = "https://github.com/govice/golinks/attest/directory/v1"
+	// RootDigest is the digest set key of a link's root hash. It is a SHA512
+	// digest over the archive, not over the directory's bytes.
+	RootDigest = "golinksRootSHA512"
+)
+
+var (
+	// ErrKeyed is returned when attesting the files of a keyed blockmap,
+	// whose archived hashes are MACs rather than digests
+	ErrKeyed = errors.New("attest: keyed blockmaps have no file digests")
+	// ErrSubjectMismatch is returned when a statement doesn't attest a blockmap
+	ErrSubjectMismatch = errors.New("attest: statement subject doesn't match the link")
+)
+
+// Statement is an in-toto v1 statement
+type Statement struct {
+	Type          string      `json:"_type"`
+	Subject       []Subject   `json:"subject"`
+	PredicateType string      `json:"predicateType"`
+	Predicate     *Provenance `json:"predicate"`
+}
+
+// Subject is an attested artifact and its digests, keyed by algorithm
+type Subject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// Provenance is a SLSA v1 provenance predicate
+type Provenance struct {
+	BuildDefinition BuildDefinition `json:"buildDefinition"`
+	RunDetails      RunDetails      `json:"runDetails"`
+}
+
+// BuildDefinition describes the inputs of a build
+type BuildDefinition struct {
+	BuildType          string                 `json:"buildType"`
+	ExternalParameters map[string]interface{} `json:"externalParameters"`
+}
+
+// RunDetails describes the builder and the run
+type RunDetails struct {
+	Builder  Builder        `json:"builder"`
+	Metadata *BuildMetadata `json:"metadata,omitempty"`
+}
+
+// Builder identifies the platform that ran the build
+type Builder struct {
+	ID string `json:"id"`
+}
+
+// BuildMetadata identifies a run and its times
+type BuildMetadata struct {
+	InvocationID string     `json:"invocationId,omitempty"`
+	StartedOn    *time.Time `json:"startedOn,omitempty"`
+	FinishedOn   *time.Time `json:"finishedOn,omitempty"`
+}
+
+// Option configures a statement created by NewStatement
+type Option func(*options)
+
+type options struct {
+	files        bool
+	builderID    string
+	invocationID string
+	startedOn    time.Time
+	finishedOn   time.Time
+	parameters   map[string]interface{}
+}
+
+// WithFiles adds a subject for every archived file, named by its path and
+// digested by the link's file hash
+func WithFiles() Option {
+	return func(o *options) { o.files = true }
+}
+
+// WithBuilder sets the ID of the builder, a URI naming the build platform
+func WithBuilder(id string) Option {
+	return func(o *options) { o.builderID = id }
+}
+
+// WithInvocation sets the ID of the build run, such as a CI job URL
+func WithInvocation(id string) Option {
+	return func(o *options) { o.invocationID = id }
+}
+
+// WithTimes sets when the build started and finished
+func WithTimes(started, finished time.Time) Option {
+	return func(o *options) { o.startedOn, o.finishedOn = started, finished }
+}
+
+// WithParameters adds external parameters of the build
+func WithParameters(parameters map[string]interface{}) Option {
+	return func(o *options) {
+		for k, v := range parameters {
+			o.parameters[k] = v
+		}
+	}
+}
+
+// NewStatement returns a statement attesting the root hash of b, named by
+// the base name of its root, with SLSA provenance configured by opts
+func NewStatement(b *blockmap.BlockMap, opts ...Option) (*Statement, error) {
+	if len(b.RootHash) == 0 {
+		return nil, errors.New("attest: blockmap has no root hash")
+	}
+	o := &options{parameters: map[string]interface{}{}}
+	for _, opt := range opts {
+		opt(o)
+	}
+	o.parameters["root"] = b.Root
+	o.parameters["fileHash"] = b.FileHash.String()
+	o.parameters["hashMode"] = b.HashMode
+
+	s := &Statement{
+		Type:          StatementType,
+		Subject:       []Subject{rootSubject(b)},
+		PredicateType: ProvenanceType,
+		Predicate: &Provenance{
+			BuildDefinition: BuildDefinition{BuildType: BuildType, ExternalParameters: o.parameters},
+			RunDetails:      RunDetails{Builder: Builder{ID: o.builderID}},
+		},
+	}
+	if o.invocationID != "" || !o.startedOn.IsZero() || !o.finishedOn.IsZero() {
+		metadata := &BuildMetadata{InvocationID: o.invocationID}
+		if !o.startedOn.IsZero() {
+			started := o.startedOn.UTC()
+			metadata.StartedOn = &started
+		}
+		if !o.finishedOn.IsZero() {
+			finished := o.finishedOn.UTC()
+			metadata.FinishedOn = &finished
+		}
+		s.Predicate.RunDetails.Metadata = metadata
+	}
+
+	if o.files {
+		if b.Keyed {
+			return nil, ErrKeyed
+		}
+		paths := make([]string, 0, len(b.Archive))
+		for path := range b.Archive {
+			if !blockmap.IsDirectory(path) {
+				paths = append(paths, path)
+			}
+		}
+		sort.Strings(paths)
+		algorithm := b.FileHash.String()
+		for _, path := range paths {
+			s.Subject = append(s.Subject, Subject{
+				Name:   path,
+				Digest: map[string]string{algorithm: hex.EncodeToString(b.Digest(b.Archive[path]))},
+			})
+		}
+	}
+	return s, nil
+}
+
+func rootSubject(b *blockmap.BlockMap) Subject {
+	name := filepath.Base(b.Root)
+	if b.Root == "" {
+		name = "."
+	}
+	return Subject{Name: name, Digest: map[string]string{RootDigest: hex.EncodeToString(b.RootHash)}}
+}
+
+// RootHash returns the link root hash the statement attests
+func (s *Statement) RootHash() ([]byte, error) {
+	for _, subject := range s.Subject {
+		if digest, ok := subject.Digest[RootDigest]; ok {
+			return hex.DecodeString(digest)
+		}
+	}
+	return nil, errors.Wrap(ErrSubjectMismatch, "no root hash subject")
+}
+
+// Matches returns nil if the statement attests the root hash of b
+func (s *Statement) Matches(b *blockmap.BlockMap) error {
+	rootHash, err := s.RootHash()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(rootHash, b.RootHash) {
+		return ErrSubjectMismatch
+	}
+	return nil
+}
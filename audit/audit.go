@@ -0,0 +1,278 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+// Package audit keeps an append-only log of mutations to links and chains:
+// who performed which operation when, with the root hashes before and after.
+// Entries are hash chained, so edits to or removals from the middle of a log
+// are detected by Verify.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"os"
+	"os/user"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Operations recorded by the library
+const (
+	// OpSave records a link saved over its previous version
+	OpSave = "save"
+	// OpAppend records a block appended to a chain
+	OpAppend = "append"
+	// OpAdopt records a chain replaced by a peer's fork
+	OpAdopt = "adopt"
+	// OpPrune records the blocks before a checkpoint pruned from a chain
+	OpPrune = "prune"
+)
+
+// ErrTampered is returned when a log's hash chain is broken
+var ErrTampered = errors.New("audit: log has been tampered with")
+
+// maxEntrySize bounds the entries read from a log
+const maxEntrySize = 1 << 20
+
+// Entry records one mutation. PrevRootHash and NewRootHash are the target's
+// root hashes before and after the operation, the link root hash for saves
+// and the head block hash for chains.
+type Entry struct {
+	Seq          uint64    `json:"seq"`
+	Time         time.Time `json:"time"`
+	Actor        string    `json:"actor"`
+	Operation    string    `json:"operation"`
+	Target       string    `json:"target"`
+	PrevRootHash []byte    `json:"prevRootHash,omitempty"`
+	NewRootHash  []byte    `json:"newRootHash,omitempty"`
+	// PrevHash is the Hash of the preceding entry
+	PrevHash []byte `json:"prevHash,omitempty"`
+	// Hash is the SHA256 of the entry's JSON without its Hash
+	Hash []byte `json:"hash"`
+}
+
+// digest returns the hash of e
+func (e Entry) digest() ([]byte, error) {
+	e.Hash = nil
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, errors.Wrap(err, "audit: failed to encode entry")
+	}
+	sum := sha256.Sum256(data)
+	return sum[:], nil
+}
+
+// Log is an audit log appended to a file of JSON lines
+type Log struct {
+	path  string
+	actor string
+	now   func() time.Time
+
+	mu   sync.Mutex
+	file *os.File
+	seq  uint64
+	last []byte
+}
+
+// Open opens the log at path, creating it if needed. The existing entries
+// are verified before new ones are appended.
+func Open(path string) (*Log, error) {
+	entries, err := readEntries(path)
+	if err != nil && !os.IsNotExist(errors.Cause(err)) {
+		return nil, err
+	}
+	if err := verifyEntries(entries); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "audit: failed to open log")
+	}
+	l := &Log{path: path, actor: DefaultActor(), now: time.Now, file: file}
+	if n := len(entries); n > 0 {
+		l.seq, l.last = entries[n-1].Seq, entries[n-1].Hash
+	}
+	return l, nil
+}
+
+// DefaultActor returns user@host for the current process
+func DefaultActor() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		name += "@" + host
+	}
+	return name
+}
+
+// SetActor sets the actor of entries recorded without one in their context,
+// DefaultActor unless set
+func (l *Log) SetActor(actor string) {
+	l.actor = actor
+}
+
+// Path returns the path of the log file
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Record appends an entry for op on target, attributed to the actor in ctx
+// or the log's actor, and returns it. The entry is synced to disk before
+// Record returns.
+func (l *Log) Record(ctx context.Context, op, target string, prevRootHash, newRootHash []byte) (Entry, error) {
+	actor := ActorFromContext(ctx)
+	if actor == "" {
+		actor = l.actor
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return Entry{}, errors.New("audit: log is closed")
+	}
+
+	e := Entry{
+		Seq:          l.seq + 1,
+		Time:         l.now().UTC(),
+		Actor:        actor,
+		Operation:    op,
+		Target:       target,
+		PrevRootHash: prevRootHash,
+		NewRootHash:  newRootHash,
+		PrevHash:     l.last,
+	}
+	hash, err := e.digest()
+	if err != nil {
+		return Entry{}, err
+	}
+	e.Hash = hash
+	line, err := json.Marshal(e)
+	if err != nil {
+		return Entry{}, errors.Wrap(err, "audit: failed to encode entry")
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return Entry{}, errors.Wrap(err, "audit: failed to write entry")
+	}
+	if err := l.file.Sync(); err != nil {
+		return Entry{}, errors.Wrap(err, "audit: failed to sync log")
+	}
+	l.seq, l.last = e.Seq, e.Hash
+	return e, nil
+}
+
+// Close closes the log file
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// Entries returns the logged entries matching filter in log order
+func (l *Log) Entries(filter Filter) ([]Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entries, err := readEntries(l.path)
+	if err != nil {
+		return nil, err
+	}
+	return filter.apply(entries), nil
+}
+
+// Verify checks the log's hash chain
+func (l *Log) Verify() error {
+	return VerifyFile(l.path)
+}
+
+// VerifyFile checks the hash chain of the log at path
+func VerifyFile(path string) error {
+	entries, err := readEntries(path)
+	if err != nil {
+		return err
+	}
+	return verifyEntries(entries)
+}
+
+func readEntries(path string) ([]Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "audit: failed to open log")
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, maxEntrySize)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, errors.Wrapf(ErrTampered, "invalid entry after seq %d", len(entries))
+		}
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "audit: failed to read log")
+	}
+	return entries, nil
+}
+
+func verifyEntries(entries []Entry) error {
+	var last []byte
+	for i, e := range entries {
+		if e.Seq != uint64(i+1) || !bytes.Equal(e.PrevHash, last) {
+			return errors.Wrapf(ErrTampered, "entry %d is out of sequence", i+1)
+		}
+		hash, err := e.digest()
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(hash, e.Hash) {
+			return errors.Wrapf(ErrTampered, "entry %d was modified", e.Seq)
+		}
+		last = e.Hash
+	}
+	return nil
+}
+
+type actorKey struct{}
+
+// NewContext returns a context attributing the mutations made with it to
+// actor, such as an authenticated API client
+func NewContext(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor in ctx or an empty string
+func ActorFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
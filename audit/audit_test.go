@@ -0,0 +1,164 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.SetActor("cli")
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	l.now = func() time.Time { return start }
+	if _, err := l.Record(context.Background(), OpSave, "/data/.link", nil, []byte{1}); err != nil {
+		t.Fatal(err)
+	}
+	l.now = func() time.Time { return start.Add(time.Hour) }
+	if _, err := l.Record(NewContext(context.Background(), "ci@10.0.0.1"), OpAppend, "chain", []byte{2}, []byte{3}); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	//Reopened logs continue the chain
+	if l, err = Open(path); err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	e, err := l.Record(context.Background(), OpSave, "/data/.link", []byte{1}, []byte{4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Seq != 3 || len(e.PrevHash) == 0 {
+		t.Errorf("expected the third chained entry, got %+v", e)
+	}
+	if err := l.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		filter Filter
+		seqs   []uint64
+	}{
+		{Filter{}, []uint64{1, 2, 3}},
+		{Filter{Actor: "ci@10.0.0.1"}, []uint64{2}},
+		{Filter{Operation: OpSave}, []uint64{1, 3}},
+		{Filter{Target: "/data/.link", Limit: 1}, []uint64{3}},
+		{Filter{Since: start.Add(time.Minute), Until: start.Add(2 * time.Hour)}, []uint64{2}},
+	}
+	for _, test := range tests {
+		entries, err := l.Entries(test.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var seqs []uint64
+		for _, e := range entries {
+			seqs = append(seqs, e.Seq)
+		}
+		if !reflect.DeepEqual(seqs, test.seqs) {
+			t.Errorf("%+v: expected entries %v, got %v", test.filter, test.seqs, seqs)
+		}
+	}
+
+	//Edits are detected
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := bytes.Replace(data, []byte(`"actor":"ci@10.0.0.1"`), []byte(`"actor":"someone"`), 1)
+	if err := ioutil.WriteFile(path, tampered, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyFile(path); errors.Cause(err) != ErrTampered {
+		t.Error("expected a modified entry to be detected, got", err)
+	}
+	if _, err := Open(path); errors.Cause(err) != ErrTampered {
+		t.Error("expected a tampered log not to open, got", err)
+	}
+
+	//Removals are detected
+	lines := strings.SplitAfter(string(data), "\n")
+	if err := ioutil.WriteFile(path, []byte(lines[0]+lines[2]), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyFile(path); errors.Cause(err) != ErrTampered {
+		t.Error("expected a removed entry to be detected, got", err)
+	}
+}
+
+func TestExport(t *testing.T) {
+	entries := []Entry{{
+		Seq:         1,
+		Time:        time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		Actor:       "cli",
+		Operation:   OpAppend,
+		Target:      "chain",
+		NewRootHash: []byte{0xab},
+		Hash:        []byte{0xcd},
+	}}
+
+	var csv bytes.Buffer
+	if err := Export(&csv, entries, FormatCSV); err != nil {
+		t.Fatal(err)
+	}
+	expected := "seq,time,actor,operation,target,prevRootHash,newRootHash,hash\n1,2020-01-02T03:04:05Z,cli,append,chain,,ab,cd\n"
+	if csv.String() != expected {
+		t.Errorf("unexpected csv %q", csv.String())
+	}
+
+	var jsonl bytes.Buffer
+	if err := Export(&jsonl, append(entries, entries...), FormatJSONL); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(jsonl.String(), "\n") != 2 {
+		t.Errorf("expected two lines, got %q", jsonl.String())
+	}
+
+	var array bytes.Buffer
+	if err := Export(&array, nil, FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []Entry
+	if err := json.Unmarshal(array.Bytes(), &decoded); err != nil || decoded == nil {
+		t.Errorf("expected an empty array, got %q %v", array.String(), err)
+	}
+
+	if err := Export(&array, entries, "xml"); errors.Cause(err) != ErrFormat {
+		t.Error("expected an unknown format error, got", err)
+	}
+}
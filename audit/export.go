@@ -0,0 +1,111 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package audit
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Export formats
+const (
+	FormatJSON  = "json"
+	FormatJSONL = "jsonl"
+	FormatCSV   = "csv"
+)
+
+// ErrFormat is returned for unknown export formats
+var ErrFormat = errors.New("audit: unknown export format")
+
+// Filter selects entries. Zero fields match every entry.
+type Filter struct {
+	Actor     string
+	Operation string
+	Target    string
+	Since     time.Time
+	Until     time.Time
+	// Limit keeps the last Limit matching entries
+	Limit int
+}
+
+func (f Filter) matches(e Entry) bool {
+	return (f.Actor == "" || e.Actor == f.Actor) &&
+		(f.Operation == "" || e.Operation == f.Operation) &&
+		(f.Target == "" || e.Target == f.Target) &&
+		(f.Since.IsZero() || !e.Time.Before(f.Since)) &&
+		(f.Until.IsZero() || e.Time.Before(f.Until))
+}
+
+func (f Filter) apply(entries []Entry) []Entry {
+	var matched []Entry
+	for _, e := range entries {
+		if f.matches(e) {
+			matched = append(matched, e)
+		}
+	}
+	if f.Limit > 0 && len(matched) > f.Limit {
+		matched = matched[len(matched)-f.Limit:]
+	}
+	return matched
+}
+
+// Export writes entries to w as a JSON array, JSON lines or CSV with hex
+// encoded hashes
+func Export(w io.Writer, entries []Entry, format string) error {
+	switch format {
+	case FormatJSON:
+		if entries == nil {
+			entries = []Entry{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	case FormatJSONL:
+		encoder := json.NewEncoder(w)
+		for _, e := range entries {
+			if err := encoder.Encode(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatCSV:
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"seq", "time", "actor", "operation", "target", "prevRootHash", "newRootHash", "hash"})
+		for _, e := range entries {
+			writer.Write([]string{
+				strconv.FormatUint(e.Seq, 10),
+				e.Time.Format(time.RFC3339Nano),
+				e.Actor,
+				e.Operation,
+				e.Target,
+				hex.EncodeToString(e.PrevRootHash),
+				hex.EncodeToString(e.NewRootHash),
+				hex.EncodeToString(e.Hash),
+			})
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		return errors.Wrap(ErrFormat, format)
+	}
+}
@@ -0,0 +1,190 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+// Package auth authenticates API requests by bearer token or verified TLS
+// client certificate and authorizes them by role. Roles are cumulative: a
+// verifier may also read and a writer may also verify.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"strings"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+var (
+	// ErrUnauthenticated is returned for requests without valid credentials
+	ErrUnauthenticated = errors.New("auth: unauthenticated")
+	// ErrForbidden is returned for requests whose role doesn't allow an operation
+	ErrForbidden = errors.New("auth: forbidden")
+	// ErrUnknownRole is returned when parsing an unknown role name
+	ErrUnknownRole = errors.New("auth: unknown role")
+)
+
+// Role is the set of operations a principal may perform
+type Role int
+
+// Roles, each allowing the operations of the roles before it
+const (
+	// None allows nothing
+	None Role = iota
+	// Read allows looking up blocks, proofs and diffs
+	Read
+	// Verify allows verifying and generating links against served roots
+	Verify
+	// Write allows appending to chains and storing links
+	Write
+)
+
+var roleNames = []string{"none", "read", "verify", "write"}
+
+func (r Role) String() string {
+	if r < None || int(r) >= len(roleNames) {
+		return "unknown"
+	}
+	return roleNames[r]
+}
+
+// ParseRole returns the role named name
+func ParseRole(name string) (Role, error) {
+	for i, roleName := range roleNames {
+		if name == roleName {
+			return Role(i), nil
+		}
+	}
+	return None, errors.Wrap(ErrUnknownRole, name)
+}
+
+// Allows returns true if r allows the operations of required
+func (r Role) Allows(required Role) bool {
+	return r >= required
+}
+
+// Principal is an authenticated client
+type Principal struct {
+	Name string
+	Role Role
+}
+
+// Policy maps credentials to principals. Tokens are held as SHA256 digests
+// and certificates are matched by subject common name, so the server's TLS
+// configuration must verify client certificates against trusted CAs.
+type Policy struct {
+	tokens    map[string]Principal
+	subjects  map[string]Principal
+	anonymous Role
+}
+
+// NewPolicy returns a policy granting nothing
+func NewPolicy() *Policy {
+	return &Policy{
+		tokens:   make(map[string]Principal),
+		subjects: make(map[string]Principal),
+	}
+}
+
+// AddToken grants role to the principal name presenting token
+func (p *Policy) AddToken(name, token string, role Role) {
+	sum := sha256.Sum256([]byte(token))
+	p.AddTokenHash(name, sum[:], role)
+}
+
+// AddTokenHash grants role to the principal name presenting a token with the
+// given SHA256 digest
+func (p *Policy) AddTokenHash(name string, hash []byte, role Role) {
+	p.tokens[hex.EncodeToString(hash)] = Principal{Name: name, Role: role}
+}
+
+// AddSubject grants role to clients presenting a verified certificate with
+// the subject common name commonName
+func (p *Policy) AddSubject(commonName string, role Role) {
+	p.subjects[commonName] = Principal{Name: commonName, Role: role}
+}
+
+// SetAnonymous grants role to requests without credentials
+func (p *Policy) SetAnonymous(role Role) {
+	p.anonymous = role
+}
+
+// Authenticate returns the principal presenting token or the verified client
+// certificate chains, preferring the token. Requests with neither are
+// anonymous.
+func (p *Policy) Authenticate(token string, chains [][]*x509.Certificate) (*Principal, error) {
+	if token != "" {
+		sum := sha256.Sum256([]byte(token))
+		principal, ok := p.tokens[hex.EncodeToString(sum[:])]
+		if !ok {
+			return nil, errors.Wrap(ErrUnauthenticated, "unknown token")
+		}
+		return &principal, nil
+	}
+	if len(chains) > 0 && len(chains[0]) > 0 {
+		principal, ok := p.subjects[chains[0][0].Subject.CommonName]
+		if !ok {
+			return nil, errors.Wrap(ErrUnauthenticated, "unknown certificate subject")
+		}
+		return &principal, nil
+	}
+	return &Principal{Name: "anonymous", Role: p.anonymous}, nil
+}
+
+// Authorize authenticates a request and checks its principal allows required
+func (p *Policy) Authorize(token string, chains [][]*x509.Certificate, required Role) (*Principal, error) {
+	principal, err := p.Authenticate(token, chains)
+	if err != nil {
+		return nil, err
+	}
+	if !principal.Role.Allows(required) {
+		if principal.Role == None {
+			return nil, errors.Wrap(ErrUnauthenticated, "credentials required")
+		}
+		return nil, errors.Wrapf(ErrForbidden, "%s may not %s", principal.Name, required)
+	}
+	return principal, nil
+}
+
+// AuthorizeContext authorizes the gRPC request in ctx by the bearer token in
+// its authorization metadata or its verified client certificate
+func (p *Policy) AuthorizeContext(ctx context.Context, required Role) (*Principal, error) {
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			token = BearerToken(values[0])
+		}
+	}
+	var chains [][]*x509.Certificate
+	if pr, ok := peer.FromContext(ctx); ok {
+		if info, ok := pr.AuthInfo.(credentials.TLSInfo); ok {
+			chains = info.State.VerifiedChains
+		}
+	}
+	return p.Authorize(token, chains, required)
+}
+
+// BearerToken returns the token of a bearer authorization header
+func BearerToken(header string) string {
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return header[7:]
+	}
+	return ""
+}
@@ -0,0 +1,140 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"testing"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func chain(commonName string) [][]*x509.Certificate {
+	return [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: commonName}}}}
+}
+
+func TestPolicy_Authorize(t *testing.T) {
+	p := NewPolicy()
+	p.AddToken("ci", "ci-token", Write)
+	p.AddToken("auditor", "auditor-token", Verify)
+	p.AddSubject("reader", Read)
+
+	tests := []struct {
+		name     string
+		token    string
+		chains   [][]*x509.Certificate
+		required Role
+		err      error
+	}{
+		{"writer appends", "ci-token", nil, Write, nil},
+		{"writer reads", "ci-token", nil, Read, nil},
+		{"verifier verifies", "auditor-token", nil, Verify, nil},
+		{"verifier appends", "auditor-token", nil, Write, ErrForbidden},
+		{"certificate reads", "", chain("reader"), Read, nil},
+		{"certificate verifies", "", chain("reader"), Verify, ErrForbidden},
+		{"unknown certificate", "", chain("other"), Read, ErrUnauthenticated},
+		{"unknown token", "other", chain("reader"), Read, ErrUnauthenticated},
+		{"anonymous", "", nil, Read, ErrUnauthenticated},
+	}
+	for _, test := range tests {
+		if _, err := p.Authorize(test.token, test.chains, test.required); errors.Cause(err) != test.err {
+			t.Errorf("%s: expected %v, got %v", test.name, test.err, err)
+		}
+	}
+
+	p.SetAnonymous(Read)
+	if _, err := p.Authorize("", nil, Read); err != nil {
+		t.Error("expected anonymous reads, got", err)
+	}
+	if _, err := p.Authorize("", nil, Verify); errors.Cause(err) != ErrForbidden {
+		t.Error("expected anonymous verifies to be forbidden, got", err)
+	}
+}
+
+func TestPolicy_AuthorizeContext(t *testing.T) {
+	p := NewPolicy()
+	p.AddToken("ci", "ci-token", Write)
+	p.AddSubject("verifier", Verify)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer ci-token"))
+	if principal, err := p.AuthorizeContext(ctx, Write); err != nil || principal.Name != "ci" {
+		t.Error("expected the token to authorize ci, got", principal, err)
+	}
+
+	info := credentials.TLSInfo{State: tls.ConnectionState{VerifiedChains: chain("verifier")}}
+	ctx = peer.NewContext(context.Background(), &peer.Peer{AuthInfo: info})
+	if _, err := p.AuthorizeContext(ctx, Verify); err != nil {
+		t.Error("expected the certificate to authorize verifies, got", err)
+	}
+	if _, err := p.AuthorizeContext(ctx, Write); errors.Cause(err) != ErrForbidden {
+		t.Error("expected the certificate not to authorize appends, got", err)
+	}
+
+	//Unverified certificates don't authenticate
+	info = credentials.TLSInfo{State: tls.ConnectionState{PeerCertificates: chain("verifier")[0]}}
+	ctx = peer.NewContext(context.Background(), &peer.Peer{AuthInfo: info})
+	if _, err := p.AuthorizeContext(ctx, Read); errors.Cause(err) != ErrUnauthenticated {
+		t.Error("expected an unverified certificate to be rejected, got", err)
+	}
+}
+
+func TestConfig_Policy(t *testing.T) {
+	sum := sha256.Sum256([]byte("ci-token"))
+	c := &Config{
+		Tokens:    []TokenConfig{{Name: "ci", TokenSHA256: hex.EncodeToString(sum[:]), Role: "write"}},
+		Subjects:  []SubjectConfig{{CommonName: "verifier", Role: "verify"}},
+		Anonymous: "read",
+	}
+	p, err := c.Policy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Authorize("ci-token", nil, Write); err != nil {
+		t.Error(err)
+	}
+	if _, err := p.Authorize("", chain("verifier"), Verify); err != nil {
+		t.Error(err)
+	}
+	if _, err := p.Authorize("", nil, Read); err != nil {
+		t.Error(err)
+	}
+
+	c.Tokens[0].Role = "admin"
+	if _, err := c.Policy(); errors.Cause(err) != ErrUnknownRole {
+		t.Error("expected an unknown role error, got", err)
+	}
+	c.Tokens[0].Role, c.Tokens[0].TokenSHA256 = "write", "ci-token"
+	if _, err := c.Policy(); err == nil {
+		t.Error("expected an invalid digest error")
+	}
+}
+
+func TestParseRole(t *testing.T) {
+	for _, role := range []Role{None, Read, Verify, Write} {
+		if parsed, err := ParseRole(role.String()); err != nil || parsed != role {
+			t.Errorf("expected %v, got %v %v", role, parsed, err)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package auth
+
+import (
+	"encoding/hex"
+
+	"github.com/pkg/errors"
+)
+
+// Config is the JSON description of a policy
+type Config struct {
+	Tokens    []TokenConfig   `json:"tokens,omitempty"`
+	Subjects  []SubjectConfig `json:"subjects,omitempty"`
+	Anonymous string          `json:"anonymous,omitempty"`
+}
+
+// TokenConfig grants a role to a token, given as its SHA256 hex digest so
+// configuration files hold no secrets
+type TokenConfig struct {
+	Name        string `json:"name"`
+	TokenSHA256 string `json:"tokenSHA256"`
+	Role        string `json:"role"`
+}
+
+// SubjectConfig grants a role to client certificates with a common name
+type SubjectConfig struct {
+	CommonName string `json:"commonName"`
+	Role       string `json:"role"`
+}
+
+// Policy returns the policy described by c
+func (c *Config) Policy() (*Policy, error) {
+	p := NewPolicy()
+	for _, token := range c.Tokens {
+		role, err := ParseRole(token.Role)
+		if err != nil {
+			return nil, errors.Wrapf(err, "token %s", token.Name)
+		}
+		hash, err := hex.DecodeString(token.TokenSHA256)
+		if err != nil || len(hash) != 32 {
+			return nil, errors.Errorf("auth: token %s has an invalid SHA256 digest", token.Name)
+		}
+		p.AddTokenHash(token.Name, hash, role)
+	}
+	for _, subject := range c.Subjects {
+		role, err := ParseRole(subject.Role)
+		if err != nil {
+			return nil, errors.Wrapf(err, "subject %s", subject.CommonName)
+		}
+		p.AddSubject(subject.CommonName, role)
+	}
+	if c.Anonymous != "" {
+		role, err := ParseRole(c.Anonymous)
+		if err != nil {
+			return nil, errors.Wrap(err, "anonymous")
+		}
+		p.SetAnonymous(role)
+	}
+	return p, nil
+}
@@ -0,0 +1,323 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+// Package bagit writes blockmaps as RFC 8493 BagIt bags and validates
+// existing bags.
+package bagit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/govice/golinks/blockmap"
+	"github.com/govice/golinks/manifest"
+	"github.com/govice/golinks/walker"
+	"github.com/pkg/errors"
+)
+
+// Names of the files making up a bag written by this package. The manifests
+// are named by the blockmap's file hash, see ManifestNames.
+const (
+	DeclarationName = "bagit.txt"
+	InfoName        = "bag-info.txt"
+	PayloadDir      = "data"
+)
+
+// Version is the BagIt version of bags written by this package
+const Version = "1.0"
+
+// bag-info.txt labels written by this package. The root hash label lets a
+// bag be matched back to its blockmap.
+const (
+	baggingDateTag = "Bagging-Date"
+	payloadOxumTag = "Payload-Oxum"
+	rootHashTag    = "Golinks-Root-Hash"
+)
+
+var (
+	// ErrBagExists is returned when writing a bag over an existing one
+	ErrBagExists = errors.New("bagit: bag already exists")
+	// ErrNotBag is returned when validating a directory without a valid bag declaration
+	ErrNotBag = errors.New("bagit: not a bag")
+	// ErrPayloadChanged is returned when a payload file no longer matches
+	// its blockmap hash while being copied into a bag
+	ErrPayloadChanged = errors.New("bagit: payload changed since blockmap generation")
+	// ErrUnsupportedHash is returned when writing a bag of a blockmap whose
+	// file hash has no BagIt algorithm name
+	ErrUnsupportedHash = errors.New("bagit: file hash has no BagIt algorithm")
+)
+
+// algorithms are the BagIt algorithms of the file hashes bags can be written with
+var algorithms = map[blockmap.HashAlgorithm]manifest.Algorithm{
+	blockmap.SHA256: manifest.SHA256,
+	blockmap.SHA384: manifest.SHA384,
+	blockmap.SHA512: manifest.SHA512,
+}
+
+// ManifestNames returns the names of the payload and tag manifests of a bag
+// of a blockmap with the file hash alg
+func ManifestNames(alg blockmap.HashAlgorithm) (payload, tag string, err error) {
+	algorithm, ok := algorithms[alg]
+	if !ok {
+		return "", "", errors.Wrap(ErrUnsupportedHash, alg.String())
+	}
+	return "manifest-" + string(algorithm) + ".txt", "tagmanifest-" + string(algorithm) + ".txt", nil
+}
+
+// Write copies the files archived in b into a new bag at dst and writes its
+// tag files. The payload manifest is built from the blockmap's hashes and
+// every file is checked against its hash as it's copied. The manifests use
+// the blockmap's file hash, which must be SHA-256, SHA-384 or SHA-512.
+func Write(b *blockmap.BlockMap, dst string) error {
+	payloadManifest, tagManifest, err := ManifestNames(b.FileHash)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(dst, DeclarationName)); err == nil {
+		return errors.Wrap(ErrBagExists, dst)
+	}
+	if err := os.MkdirAll(filepath.Join(dst, PayloadDir), 0755); err != nil {
+		return errors.Wrap(err, "bagit: failed to create payload directory")
+	}
+
+	paths := b.FilePaths()
+
+	var payload bytes.Buffer
+	var octets int64
+	for _, path := range paths {
+		n, err := copyPayload(b, path, dst)
+		if err != nil {
+			return err
+		}
+		octets += n
+		fmt.Fprintf(&payload, "%s  %s/%s\n", hex.EncodeToString(b.Digest(b.Archive[path])), PayloadDir, encodePath(path))
+	}
+
+	info := fmt.Sprintf("%s: %s\n%s: %d.%d\n%s: %s\n",
+		baggingDateTag, time.Now().Format("2006-01-02"),
+		payloadOxumTag, octets, len(paths),
+		rootHashTag, base64.StdEncoding.EncodeToString(b.RootHash))
+	tagFiles := []struct {
+		name    string
+		content []byte
+	}{
+		{DeclarationName, []byte("BagIt-Version: " + Version + "\nTag-File-Character-Encoding: UTF-8\n")},
+		{InfoName, []byte(info)},
+		{payloadManifest, payload.Bytes()},
+	}
+
+	newHash, err := b.FileHash.Func()
+	if err != nil {
+		return err
+	}
+
+	var tags bytes.Buffer
+	for _, tag := range tagFiles {
+		if err := ioutil.WriteFile(filepath.Join(dst, tag.name), tag.content, 0644); err != nil {
+			return errors.Wrap(err, "bagit: failed to write "+tag.name)
+		}
+		hash := newHash()
+		hash.Write(tag.content)
+		fmt.Fprintf(&tags, "%x  %s\n", hash.Sum(nil), tag.name)
+	}
+	return errors.Wrap(ioutil.WriteFile(filepath.Join(dst, tagManifest), tags.Bytes(), 0644),
+		"bagit: failed to write "+tagManifest)
+}
+
+// copyPayload copies an archived file into the bag's payload directory,
+// returning the number of bytes copied
+func copyPayload(b *blockmap.BlockMap, path, dst string) (int64, error) {
+	src, err := b.Open(path)
+	if err != nil {
+		return 0, errors.Wrap(err, "bagit: failed to open "+path)
+	}
+	defer src.Close()
+
+	target := filepath.Join(dst, PayloadDir, filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return 0, errors.Wrap(err, "bagit: failed to create payload directory")
+	}
+	mode := os.FileMode(0644)
+	if entry, ok := b.Entries[path]; ok && entry.Mode != 0 {
+		mode = entry.Mode.Perm()
+	}
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return 0, errors.Wrap(err, "bagit: failed to create "+target)
+	}
+
+	newHash, err := b.FileHash.Func()
+	if err != nil {
+		out.Close()
+		return 0, err
+	}
+	hash := newHash()
+	n, err := io.Copy(io.MultiWriter(out, hash), src)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "bagit: failed to copy "+path)
+	}
+	if !bytes.Equal(hash.Sum(nil), b.Digest(b.Archive[path])) {
+		return 0, errors.Wrap(ErrPayloadChanged, path)
+	}
+	return n, nil
+}
+
+// encodePath percent-encodes the characters manifests can't hold literally
+func encodePath(path string) string {
+	return strings.NewReplacer("%", "%25", "\n", "%0A", "\r", "%0D").Replace(path)
+}
+
+// Report describes why a bag is incomplete or invalid. Paths are relative
+// to the bag's base directory.
+type Report struct {
+	// Missing are manifest entries not present in the bag
+	Missing []string `json:"missing"`
+	// Modified are manifest entries whose checksum doesn't match
+	Modified []string `json:"modified"`
+	// Unlisted are payload files absent from a payload manifest
+	Unlisted []string `json:"unlisted"`
+	// OxumMismatch is true if the Payload-Oxum tag doesn't match the payload
+	OxumMismatch bool `json:"oxumMismatch,omitempty"`
+}
+
+// Valid returns true if the bag is complete and every checksum matches
+func (r *Report) Valid() bool {
+	return len(r.Missing) == 0 && len(r.Modified) == 0 && len(r.Unlisted) == 0 && !r.OxumMismatch
+}
+
+// Validate checks the bag at dir against every payload and tag manifest it
+// contains, whichever algorithms they use.
+func Validate(dir string) (*Report, error) {
+	if err := readDeclaration(dir); err != nil {
+		return nil, err
+	}
+	manifests, err := filepath.Glob(filepath.Join(dir, "manifest-*.txt"))
+	if err != nil || len(manifests) == 0 {
+		return nil, errors.Wrap(ErrNotBag, "no payload manifest")
+	}
+	tagManifests, err := filepath.Glob(filepath.Join(dir, "tagmanifest-*.txt"))
+	if err != nil {
+		return nil, errors.Wrap(err, "bagit: failed to find tag manifests")
+	}
+
+	report := &Report{}
+	missing, modified, unlisted := make(map[string]bool), make(map[string]bool), make(map[string]bool)
+	for _, path := range append(manifests, tagManifests...) {
+		m, err := manifest.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		result, err := m.Verify(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range result.Missing {
+			missing[p] = true
+		}
+		for _, p := range result.Modified {
+			modified[p] = true
+		}
+		if strings.HasPrefix(filepath.Base(path), "manifest-") {
+			for _, p := range result.Added {
+				if strings.HasPrefix(p, PayloadDir+"/") {
+					unlisted[p] = true
+				}
+			}
+		}
+	}
+	report.Missing, report.Modified, report.Unlisted = sortedKeys(missing), sortedKeys(modified), sortedKeys(unlisted)
+
+	if oxum, ok, err := readOxum(dir); err != nil {
+		return nil, err
+	} else if ok {
+		actual, err := payloadOxum(dir)
+		if err != nil {
+			return nil, err
+		}
+		report.OxumMismatch = oxum != actual
+	}
+	return report, nil
+}
+
+// readDeclaration checks that dir holds a bag declaration
+func readDeclaration(dir string) error {
+	data, err := ioutil.ReadFile(filepath.Join(dir, DeclarationName))
+	if err != nil {
+		return errors.Wrap(ErrNotBag, err.Error())
+	}
+	if !strings.HasPrefix(string(data), "BagIt-Version: ") {
+		return errors.Wrap(ErrNotBag, "malformed "+DeclarationName)
+	}
+	return nil
+}
+
+// readOxum returns the Payload-Oxum recorded in the bag's info file if any
+func readOxum(dir string) (string, bool, error) {
+	f, err := os.Open(filepath.Join(dir, InfoName))
+	if os.IsNotExist(err) {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, errors.Wrap(err, "bagit: failed to open "+InfoName)
+	}
+	defer f.Close()
+
+	label := payloadOxumTag + ":"
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, label) {
+			return strings.TrimSpace(strings.TrimPrefix(line, label)), true, nil
+		}
+	}
+	return "", false, errors.Wrap(scanner.Err(), "bagit: failed to read "+InfoName)
+}
+
+// payloadOxum returns the "octets.count" summary of the bag's payload
+func payloadOxum(dir string) (string, error) {
+	var octets, count int64
+	w := walker.New(filepath.Join(dir, PayloadDir))
+	err := w.WalkFunc(func(path string, info os.FileInfo) error {
+		octets += info.Size()
+		count++
+		return nil
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "bagit: failed to walk payload")
+	}
+	return strconv.FormatInt(octets, 10) + "." + strconv.FormatInt(count, 10), nil
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,174 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package bagit
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/govice/golinks/blockmap"
+)
+
+func writeSource(t *testing.T) (string, *blockmap.BlockMap) {
+	root, err := ioutil.TempDir("", "bagit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{"a": "alpha", "dir/b": "bravo", "dir/100%": "charlie", "cafe\u0301": "delta"}
+	for name, content := range files {
+		path := filepath.Join(root, "src", filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b := blockmap.New(filepath.Join(root, "src"))
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	return root, b
+}
+
+func TestWrite(t *testing.T) {
+	root, b := writeSource(t)
+	defer os.RemoveAll(root)
+	bag := filepath.Join(root, "bag")
+
+	if err := Write(b, bag); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{DeclarationName, InfoName, "manifest-sha512.txt", "tagmanifest-sha512.txt", "data/dir/100%"} {
+		if _, err := os.Stat(filepath.Join(bag, filepath.FromSlash(name))); err != nil {
+			t.Error("missing bag file", name)
+		}
+	}
+	manifest, err := ioutil.ReadFile(filepath.Join(bag, "manifest-sha512.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(manifest), "  data/dir/100%25\n") {
+		t.Errorf("payload path not percent-encoded:\n%s", manifest)
+	}
+	info, err := ioutil.ReadFile(filepath.Join(bag, InfoName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(info), "Payload-Oxum: 22.4\n") {
+		t.Errorf("unexpected bag info:\n%s", info)
+	}
+
+	report, err := Validate(bag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Valid() {
+		t.Errorf("expected a valid bag, got %+v", report)
+	}
+
+	if err := Write(b, bag); !errors.Is(err, ErrBagExists) {
+		t.Error("expected ErrBagExists, got", err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(root, "src", "a"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(b, filepath.Join(root, "bag2")); !errors.Is(err, ErrPayloadChanged) {
+		t.Error("expected ErrPayloadChanged, got", err)
+	}
+}
+
+func TestWrite_FileHash(t *testing.T) {
+	root, b := writeSource(t)
+	defer os.RemoveAll(root)
+
+	//Bags use the blockmap's file hash
+	b.FileHash = blockmap.SHA256
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	bag := filepath.Join(root, "bag")
+	if err := Write(b, bag); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"manifest-sha256.txt", "tagmanifest-sha256.txt"} {
+		if _, err := os.Stat(filepath.Join(bag, name)); err != nil {
+			t.Error("missing bag file", name)
+		}
+	}
+	report, err := Validate(bag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Valid() {
+		t.Errorf("expected a valid bag, got %+v", report)
+	}
+
+	b.FileHash = blockmap.BLAKE3
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(b, filepath.Join(root, "bag2")); !errors.Is(err, ErrUnsupportedHash) {
+		t.Error("expected ErrUnsupportedHash, got", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	root, b := writeSource(t)
+	defer os.RemoveAll(root)
+	bag := filepath.Join(root, "bag")
+	if err := Write(b, bag); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(bag, "data", "a"), []byte("ALPHA"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(bag, "data", "dir", "b")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(bag, "data", "extra"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(bag, InfoName), []byte("Payload-Oxum: 1.1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Validate(bag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Report{
+		Missing:      []string{"data/dir/b"},
+		Modified:     []string{InfoName, "data/a"},
+		Unlisted:     []string{"data/extra"},
+		OxumMismatch: true,
+	}
+	if report.Valid() || !reflect.DeepEqual(report, expected) {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	if _, err := Validate(root); !errors.Is(err, ErrNotBag) {
+		t.Error("expected ErrNotBag, got", err)
+	}
+}
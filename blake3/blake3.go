@@ -0,0 +1,278 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+// Package blake3 implements the BLAKE3 hash. BLAKE3 hashes its input as a
+// binary tree of 1KiB chunks, so besides the streaming hash.Hash returned by
+// New, large inputs can be hashed by several goroutines at once with
+// HashReaderAt and HashFile.
+package blake3
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+const (
+	// Size is the size of a BLAKE3 digest in bytes
+	Size = 32
+	// BlockSize is the size of the blocks compressed by BLAKE3
+	BlockSize = 64
+	// ChunkSize is the size of the leaves of the BLAKE3 tree
+	ChunkSize = 1024
+)
+
+// Domain separation flags
+const (
+	flagChunkStart = 1 << 0
+	flagChunkEnd   = 1 << 1
+	flagParent     = 1 << 2
+	flagRoot       = 1 << 3
+)
+
+var iv = [8]uint32{0x6A09E667, 0xBB67AE85, 0x3C6EF372, 0xA54FF53A, 0x510E527F, 0x9B05688C, 0x1F83D9AB, 0x5BE0CD19}
+
+var msgPermutation = [16]int{2, 6, 3, 10, 7, 0, 4, 13, 1, 11, 12, 5, 9, 14, 15, 8}
+
+func g(s *[16]uint32, a, b, c, d int, mx, my uint32) {
+	s[a] += s[b] + mx
+	s[d] = bits.RotateLeft32(s[d]^s[a], -16)
+	s[c] += s[d]
+	s[b] = bits.RotateLeft32(s[b]^s[c], -12)
+	s[a] += s[b] + my
+	s[d] = bits.RotateLeft32(s[d]^s[a], -8)
+	s[c] += s[d]
+	s[b] = bits.RotateLeft32(s[b]^s[c], -7)
+}
+
+func round(s, m *[16]uint32) {
+	//Mix the columns
+	g(s, 0, 4, 8, 12, m[0], m[1])
+	g(s, 1, 5, 9, 13, m[2], m[3])
+	g(s, 2, 6, 10, 14, m[4], m[5])
+	g(s, 3, 7, 11, 15, m[6], m[7])
+	//Mix the diagonals
+	g(s, 0, 5, 10, 15, m[8], m[9])
+	g(s, 1, 6, 11, 12, m[10], m[11])
+	g(s, 2, 7, 8, 13, m[12], m[13])
+	g(s, 3, 4, 9, 14, m[14], m[15])
+}
+
+// compress is the BLAKE3 compression function
+func compress(cv [8]uint32, block [16]uint32, counter uint64, blockLen, flags uint32) [16]uint32 {
+	s := [16]uint32{
+		cv[0], cv[1], cv[2], cv[3], cv[4], cv[5], cv[6], cv[7],
+		iv[0], iv[1], iv[2], iv[3],
+		uint32(counter), uint32(counter >> 32), blockLen, flags,
+	}
+	m := block
+	for i := 0; i < 7; i++ {
+		round(&s, &m)
+		if i < 6 {
+			var permuted [16]uint32
+			for j, k := range msgPermutation {
+				permuted[j] = m[k]
+			}
+			m = permuted
+		}
+	}
+	for i := 0; i < 8; i++ {
+		s[i] ^= s[i+8]
+		s[i+8] ^= cv[i]
+	}
+	return s
+}
+
+// blockWords reads up to a block of bytes as little endian words, padding
+// short blocks with zeros
+func blockWords(p []byte) (words [16]uint32) {
+	var block [BlockSize]byte
+	copy(block[:], p)
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint32(block[4*i:])
+	}
+	return words
+}
+
+// output is a node of the tree before its final compression, which differs
+// for the root
+type output struct {
+	cv       [8]uint32
+	block    [16]uint32
+	counter  uint64
+	blockLen uint32
+	flags    uint32
+}
+
+// chainingValue returns the value a non-root node passes to its parent
+func (o output) chainingValue() (cv [8]uint32) {
+	s := compress(o.cv, o.block, o.counter, o.blockLen, o.flags)
+	copy(cv[:], s[:8])
+	return cv
+}
+
+// root appends the digest of o as the root node to dst
+func (o output) root(dst []byte) []byte {
+	s := compress(o.cv, o.block, 0, o.blockLen, o.flags|flagRoot)
+	var digest [Size]byte
+	for i := 0; i < 8; i++ {
+		binary.LittleEndian.PutUint32(digest[4*i:], s[i])
+	}
+	return append(dst, digest[:]...)
+}
+
+func parentOutput(left, right [8]uint32) output {
+	var block [16]uint32
+	copy(block[:8], left[:])
+	copy(block[8:], right[:])
+	return output{cv: iv, block: block, blockLen: BlockSize, flags: flagParent}
+}
+
+// chunkState hashes the blocks of a single chunk
+type chunkState struct {
+	cv               [8]uint32
+	counter          uint64
+	block            [BlockSize]byte
+	blockLen         int
+	blocksCompressed int
+}
+
+func newChunkState(counter uint64) chunkState {
+	return chunkState{cv: iv, counter: counter}
+}
+
+func (c *chunkState) len() int {
+	return BlockSize*c.blocksCompressed + c.blockLen
+}
+
+func (c *chunkState) startFlag() uint32 {
+	if c.blocksCompressed == 0 {
+		return flagChunkStart
+	}
+	return 0
+}
+
+// update adds p to the chunk. The last block is only compressed by output
+// as it is flagged as the end of the chunk.
+func (c *chunkState) update(p []byte) {
+	for len(p) > 0 {
+		if c.blockLen == BlockSize {
+			s := compress(c.cv, blockWords(c.block[:]), c.counter, BlockSize, c.startFlag())
+			copy(c.cv[:], s[:8])
+			c.blocksCompressed++
+			c.blockLen = 0
+		}
+		n := copy(c.block[c.blockLen:], p)
+		c.blockLen += n
+		p = p[n:]
+	}
+}
+
+func (c *chunkState) output() output {
+	return output{
+		cv:       c.cv,
+		block:    blockWords(c.block[:c.blockLen]),
+		counter:  c.counter,
+		blockLen: uint32(c.blockLen),
+		flags:    c.startFlag() | flagChunkEnd,
+	}
+}
+
+// digest is the streaming hash, merging completed subtrees on a stack of
+// chaining values as chunks are completed
+type digest struct {
+	chunk chunkState
+	stack [][8]uint32
+}
+
+// New returns a hash.Hash computing 32 byte BLAKE3 digests
+func New() hash.Hash {
+	d := &digest{}
+	d.Reset()
+	return d
+}
+
+func (d *digest) Size() int      { return Size }
+func (d *digest) BlockSize() int { return BlockSize }
+
+func (d *digest) Reset() {
+	d.chunk = newChunkState(0)
+	d.stack = d.stack[:0]
+}
+
+func (d *digest) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if d.chunk.len() == ChunkSize {
+			total := d.chunk.counter + 1
+			d.addChunk(d.chunk.output().chainingValue(), total)
+			d.chunk = newChunkState(total)
+		}
+		take := ChunkSize - d.chunk.len()
+		if take > len(p) {
+			take = len(p)
+		}
+		d.chunk.update(p[:take])
+		p = p[take:]
+	}
+	return n, nil
+}
+
+// addChunk pushes the chaining value of a completed chunk, first merging
+// every subtree it completes. total is the number of chunks completed.
+func (d *digest) addChunk(cv [8]uint32, total uint64) {
+	for total&1 == 0 {
+		cv = parentOutput(d.stack[len(d.stack)-1], cv).chainingValue()
+		d.stack = d.stack[:len(d.stack)-1]
+		total >>= 1
+	}
+	d.stack = append(d.stack, cv)
+}
+
+func (d *digest) Sum(b []byte) []byte {
+	o := d.chunk.output()
+	for i := len(d.stack) - 1; i >= 0; i-- {
+		o = parentOutput(d.stack[i], o.chainingValue())
+	}
+	return o.root(b)
+}
+
+// Sum256 returns the BLAKE3 digest of data
+func Sum256(data []byte) (sum [Size]byte) {
+	copy(sum[:], subtree(data, 0).root(nil))
+	return sum
+}
+
+// subtree returns the output of the subtree over data, whose first chunk is
+// chunk number counter of the input
+func subtree(data []byte, counter uint64) output {
+	if len(data) <= ChunkSize {
+		c := newChunkState(counter)
+		c.update(data)
+		return c.output()
+	}
+	left := leftLen(int64(len(data)))
+	l := subtree(data[:left], counter)
+	r := subtree(data[left:], counter+uint64(left/ChunkSize))
+	return parentOutput(l.chainingValue(), r.chainingValue())
+}
+
+// leftLen returns the size of the left subtree of n bytes, the largest
+// power of two number of chunks leaving at least one byte for the right
+func leftLen(n int64) int64 {
+	chunks := uint64(n-1) / ChunkSize
+	return ChunkSize << uint(bits.Len64(chunks)-1)
+}
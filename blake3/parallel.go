@@ -0,0 +1,120 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blake3
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// parallelSize is the largest subtree read and hashed by a single goroutine
+const parallelSize = 1 << 20
+
+// HashReaderAt returns the BLAKE3 digest of the first size bytes of r,
+// hashing independent subtrees of the input on up to workers goroutines
+func HashReaderAt(r io.ReaderAt, size int64, workers int) ([]byte, error) {
+	if workers < 1 {
+		workers = 1
+	}
+	p := &parallelHasher{r: r, slots: make(chan struct{}, workers-1)}
+	o, err := p.subtree(0, size, 0)
+	if err != nil {
+		return nil, err
+	}
+	return o.root(nil), nil
+}
+
+// HashFile returns the BLAKE3 digest of the file at path, hashing it on up
+// to workers goroutines
+func HashFile(path string, workers int) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "blake3: failed to open file")
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, errors.Wrap(err, "blake3: failed to stat file")
+	}
+	digest, err := HashReaderAt(file, info.Size(), workers)
+	return digest, errors.Wrap(err, "blake3: failed to read "+path)
+}
+
+// parallelHasher hashes the subtrees of a ReaderAt, handing left subtrees to
+// new goroutines while slots are free
+type parallelHasher struct {
+	r       io.ReaderAt
+	slots   chan struct{}
+	buffers sync.Pool
+}
+
+func (p *parallelHasher) subtree(offset, size int64, counter uint64) (output, error) {
+	if size <= parallelSize {
+		return p.leaf(offset, size, counter)
+	}
+
+	left := leftLen(size)
+	var l, r output
+	var lerr, rerr error
+	select {
+	case p.slots <- struct{}{}:
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-p.slots }()
+			l, lerr = p.subtree(offset, left, counter)
+		}()
+		r, rerr = p.subtree(offset+left, size-left, counter+uint64(left/ChunkSize))
+		wg.Wait()
+	default:
+		l, lerr = p.subtree(offset, left, counter)
+		if lerr == nil {
+			r, rerr = p.subtree(offset+left, size-left, counter+uint64(left/ChunkSize))
+		}
+	}
+	if lerr != nil {
+		return output{}, lerr
+	}
+	if rerr != nil {
+		return output{}, rerr
+	}
+	return parentOutput(l.chainingValue(), r.chainingValue()), nil
+}
+
+// leaf reads a subtree small enough for one goroutine and hashes it
+func (p *parallelHasher) leaf(offset, size int64, counter uint64) (output, error) {
+	buffer, ok := p.buffers.Get().(*[]byte)
+	if !ok {
+		b := make([]byte, parallelSize)
+		buffer = &b
+	}
+	defer p.buffers.Put(buffer)
+
+	data := (*buffer)[:size]
+	n, err := p.r.ReadAt(data, offset)
+	if int64(n) < size {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return output{}, err
+	}
+	return subtree(data, counter), nil
+}
@@ -0,0 +1,36 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package block
+
+// Anchor types
+const (
+	RFC3161        = "rfc3161"
+	OpenTimestamps = "opentimestamps"
+)
+
+// Anchor is a detached proof from an external timestamp authority that the
+// block's hash existed at a point in time. Digest is the value submitted to
+// Authority, derived from the block hash, and Proof is the authority's
+// response: a DER time-stamp token for RFC3161 or a pending calendar
+// timestamp for OpenTimestamps.
+type Anchor struct {
+	Type      string `json:"type"`
+	Authority string `json:"authority"`
+	Digest    []byte `json:"digest"`
+	Time      int64  `json:"time,omitempty"`
+	Proof     []byte `json:"proof"`
+}
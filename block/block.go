@@ -18,7 +18,9 @@ package block
 
 import (
 	"bytes"
+	"crypto/rand"
 	"crypto/sha512"
+	"encoding/binary"
 	"encoding/json"
 	"hash"
 	"time"
@@ -41,7 +43,17 @@ type Block struct {
 	Timestamp  int64  `json:"timestamp"`
 	Data       []byte `json:"data"`
 	ParentHash []byte `json:"parentHash"`
-	BlockHash  []byte `json:"blockHash,omitempty"`
+	RootHash   []byte `json:"rootHash,omitempty"`
+	Nonce      uint64 `json:"nonce,omitempty"`
+	//Writer and Clock identify the writer of a block on multi-writer chains
+	Writer    string `json:"writer,omitempty"`
+	Clock     Clock  `json:"clock,omitempty"`
+	BlockHash []byte `json:"blockHash,omitempty"`
+	//Signatures and Anchors are detached and not included in the block hash
+	Signatures []Signature `json:"signatures,omitempty"`
+	Anchors    []Anchor    `json:"anchors,omitempty"`
+	//Pruned blocks have had their data dropped and can't be rehashed
+	Pruned bool `json:"pruned,omitempty"`
 }
 
 // NewSHA512 creates a new block using SHA512 hashing and generates its hash
@@ -56,6 +68,36 @@ func NewSHA512(index int, data []byte, parentHash []byte) *Block {
 	return blk
 }
 
+// NewSHA512Link creates a new block recording a blockmap root hash with a
+// random nonce and generates its SHA512 hash
+func NewSHA512Link(index int, rootHash []byte, parentHash []byte) (*Block, error) {
+	nonce, err := randomNonce()
+	if err != nil {
+		return nil, err
+	}
+	blk := &Block{
+		Index:      index,
+		Timestamp:  time.Now().UnixNano(),
+		ParentHash: append([]byte{}, parentHash...),
+		RootHash:   append([]byte{}, rootHash...),
+		Nonce:      nonce,
+	}
+	if _, err := blk.Hash(sha512.New()); err != nil {
+		return nil, err
+	}
+	return blk, nil
+}
+
+// randomNonce returns a random block nonce, which keeps blocks recording the
+// same content from sharing a hash
+func randomNonce() (uint64, error) {
+	var nonce [8]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return 0, errors.Wrap(err, "block: failed to generate nonce")
+	}
+	return binary.BigEndian.Uint64(nonce[:]), nil
+}
+
 // NewSHA512Genesis returns a new gensis block hashed with SHA512
 func NewSHA512Genesis() *Block {
 	genesis := &Block{
@@ -91,6 +133,10 @@ func (block *Block) Serialize() ([]byte, error) {
 		Timestamp:  block.Timestamp,
 		ParentHash: append([]byte{}, block.ParentHash...),
 		Data:       append([]byte{}, block.Data...),
+		RootHash:   append([]byte{}, block.RootHash...),
+		Nonce:      block.Nonce,
+		Writer:     block.Writer,
+		Clock:      block.Clock,
 	}
 	jsonBytes, err := json.Marshal(jsonBlock)
 	if err != nil {
@@ -103,6 +149,22 @@ func (block *Block) Serialize() ([]byte, error) {
 // ErrBadParentChild is returned for an invalid block validation
 var ErrBadParentChild = errors.New("block: invalid parent-child relationship")
 
+// ErrBadBlockHash is returned when a block's hash doesn't match its contents
+var ErrBadBlockHash = errors.New("block: block hash does not match contents")
+
+// VerifySHA512 recomputes the block's SHA512 hash and compares it to BlockHash
+func (block *Block) VerifySHA512() error {
+	blockBytes, err := block.Serialize()
+	if err != nil {
+		return err
+	}
+	sum := sha512.Sum512(blockBytes)
+	if !bytes.Equal(sum[:], block.BlockHash) {
+		return ErrBadBlockHash
+	}
+	return nil
+}
+
 //Validate compares two blocks to verify their parent child hash relationship.
 func Validate(prev, current *Block) error {
 	if prev.Index+1 != current.Index {
@@ -140,5 +202,13 @@ func Equal(block, other *Block) bool {
 		return false
 	}
 
+	if !bytes.Equal(block.RootHash, other.RootHash) || block.Nonce != other.Nonce {
+		return false
+	}
+
+	if block.Writer != other.Writer || block.Clock.Compare(other.Clock) != ClockEqual {
+		return false
+	}
+
 	return true
 }
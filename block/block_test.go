@@ -124,3 +124,34 @@ func TestNewGenesis(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestNewSHA512Link(t *testing.T) {
+	parent := NewSHA512Genesis()
+	rootHash := []byte("root hash")
+	blkA, err := NewSHA512Link(1, rootHash, parent.BlockHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blkB, err := NewSHA512Link(1, rootHash, parent.BlockHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Validate(parent, blkA); err != nil {
+		t.Error(err)
+	}
+	if !bytes.Equal(blkA.RootHash, rootHash) {
+		t.Error("block does not record root hash")
+	}
+	if bytes.Equal(blkA.BlockHash, blkB.BlockHash) {
+		t.Error("blocks with equal root hashes share a block hash")
+	}
+
+	if err := blkA.VerifySHA512(); err != nil {
+		t.Error(err)
+	}
+	blkA.Nonce++
+	if err := blkA.VerifySHA512(); err != ErrBadBlockHash {
+		t.Error("expected modified block to fail verification, got", err)
+	}
+}
@@ -0,0 +1,114 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package block
+
+import "sort"
+
+// Clock is a vector clock mapping writer IDs to the number of blocks each
+// writer had appended when a block was written. Clocks order the blocks of
+// chains appended to by several writers, see blockchain.Merge.
+type Clock map[string]uint64
+
+// Order is the causal relationship between two clocks
+type Order int
+
+// Clock orders
+const (
+	// ClockEqual clocks record the same writes
+	ClockEqual Order = iota
+	// ClockBefore clocks record a subset of the other clock's writes
+	ClockBefore
+	// ClockAfter clocks record a superset of the other clock's writes
+	ClockAfter
+	// ClockConcurrent clocks each record writes the other doesn't
+	ClockConcurrent
+)
+
+// Copy returns a copy of c
+func (c Clock) Copy() Clock {
+	clock := make(Clock, len(c))
+	for writer, count := range c {
+		clock[writer] = count
+	}
+	return clock
+}
+
+// Tick returns a copy of c recording another write by writer
+func (c Clock) Tick(writer string) Clock {
+	clock := c.Copy()
+	clock[writer]++
+	return clock
+}
+
+// Merge returns a clock recording the writes of both c and other
+func (c Clock) Merge(other Clock) Clock {
+	clock := c.Copy()
+	for writer, count := range other {
+		if count > clock[writer] {
+			clock[writer] = count
+		}
+	}
+	return clock
+}
+
+// Compare returns the causal order of c relative to other
+func (c Clock) Compare(other Clock) Order {
+	before, after := false, false
+	for _, writer := range c.writers(other) {
+		switch {
+		case c[writer] < other[writer]:
+			before = true
+		case c[writer] > other[writer]:
+			after = true
+		}
+	}
+	switch {
+	case before && after:
+		return ClockConcurrent
+	case before:
+		return ClockBefore
+	case after:
+		return ClockAfter
+	}
+	return ClockEqual
+}
+
+// Sum returns the total number of writes recorded by c. A clock ordered
+// before another always has the smaller sum.
+func (c Clock) Sum() uint64 {
+	var sum uint64
+	for _, count := range c {
+		sum += count
+	}
+	return sum
+}
+
+// writers returns the sorted writer IDs of c and other
+func (c Clock) writers(other Clock) []string {
+	seen := make(map[string]bool, len(c)+len(other))
+	var writers []string
+	for _, clock := range []Clock{c, other} {
+		for writer := range clock {
+			if !seen[writer] {
+				seen[writer] = true
+				writers = append(writers, writer)
+			}
+		}
+	}
+	sort.Strings(writers)
+	return writers
+}
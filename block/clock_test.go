@@ -0,0 +1,46 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package block
+
+import "testing"
+
+func TestClockCompare(t *testing.T) {
+	a := Clock{}.Tick("a")
+	b := Clock{}.Tick("b")
+	both := a.Merge(b)
+	tests := []struct {
+		c, other Clock
+		want     Order
+	}{
+		{a, a.Copy(), ClockEqual},
+		{a, both, ClockBefore},
+		{both.Tick("b"), b, ClockAfter},
+		{a, b, ClockConcurrent},
+		{nil, Clock{}, ClockEqual},
+	}
+	for _, test := range tests {
+		if got := test.c.Compare(test.other); got != test.want {
+			t.Errorf("%v compared to %v = %v, want %v", test.c, test.other, got, test.want)
+		}
+	}
+	if a.Sum() != 1 || both.Sum() != 2 {
+		t.Error("unexpected clock sums", a.Sum(), both.Sum())
+	}
+	if a["b"] != 0 || len(a) != 1 {
+		t.Error("Merge modified its receiver")
+	}
+}
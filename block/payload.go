@@ -0,0 +1,201 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package block
+
+import (
+	"crypto/sha512"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Payload types
+const (
+	LinkPayloadType     = "link"
+	FilePayloadType     = "file"
+	MetadataPayloadType = "metadata"
+)
+
+var (
+	// ErrNoPayload is returned when a block's data isn't a typed payload
+	ErrNoPayload = errors.New("block: block has no typed payload")
+	// ErrUnknownPayload is returned for payload types without a registered codec
+	ErrUnknownPayload = errors.New("block: unknown payload type")
+)
+
+// Payload is typed content notarized by a block, stored in the block's data
+// by the codec registered for its type
+type Payload interface {
+	// PayloadType returns the type the payload's codec is registered under
+	PayloadType() string
+}
+
+// PayloadCodec encodes and decodes payloads of one type
+type PayloadCodec interface {
+	Encode(p Payload) ([]byte, error)
+	Decode(data []byte) (Payload, error)
+}
+
+// LinkPayload records the root hash of a blockmap and optionally the merkle
+// root of its archive, which file inclusion proofs resolve to. The root hash
+// is stored in the block's RootHash. Without a merkle root the payload
+// creates a plain link block, see NewSHA512Link.
+type LinkPayload struct {
+	RootHash   []byte `json:"rootHash"`
+	MerkleRoot []byte `json:"merkleRoot,omitempty"`
+}
+
+// PayloadType returns LinkPayloadType
+func (LinkPayload) PayloadType() string { return LinkPayloadType }
+
+// FilePayload records the hash of a single artifact, such as a release binary
+type FilePayload struct {
+	Name      string `json:"name"`
+	Size      int64  `json:"size"`
+	Algorithm string `json:"algorithm"`
+	Hash      []byte `json:"hash"`
+}
+
+// PayloadType returns FilePayloadType
+func (FilePayload) PayloadType() string { return FilePayloadType }
+
+// MetadataPayload records arbitrary JSON metadata
+type MetadataPayload map[string]interface{}
+
+// PayloadType returns MetadataPayloadType
+func (MetadataPayload) PayloadType() string { return MetadataPayloadType }
+
+var (
+	payloadCodecsMu sync.RWMutex
+	payloadCodecs   = map[string]PayloadCodec{
+		LinkPayloadType:     JSONPayloadCodec(func() Payload { return &LinkPayload{} }),
+		FilePayloadType:     JSONPayloadCodec(func() Payload { return &FilePayload{} }),
+		MetadataPayloadType: JSONPayloadCodec(func() Payload { return &MetadataPayload{} }),
+	}
+)
+
+// RegisterPayload makes codec encode and decode payloads of type typ,
+// replacing any codec registered for the type
+func RegisterPayload(typ string, codec PayloadCodec) {
+	payloadCodecsMu.Lock()
+	defer payloadCodecsMu.Unlock()
+	payloadCodecs[typ] = codec
+}
+
+func lookupPayload(typ string) (PayloadCodec, error) {
+	payloadCodecsMu.RLock()
+	defer payloadCodecsMu.RUnlock()
+	codec, ok := payloadCodecs[typ]
+	if !ok {
+		return nil, errors.Wrap(ErrUnknownPayload, typ)
+	}
+	return codec, nil
+}
+
+// jsonPayloadCodec encodes payloads as JSON, decoding into new values
+type jsonPayloadCodec func() Payload
+
+// JSONPayloadCodec returns a codec encoding payloads as JSON. newPayload
+// returns a pointer to an empty payload to decode into, which Decode returns.
+func JSONPayloadCodec(newPayload func() Payload) PayloadCodec {
+	return jsonPayloadCodec(newPayload)
+}
+
+func (c jsonPayloadCodec) Encode(p Payload) ([]byte, error) {
+	return json.Marshal(p)
+}
+
+func (c jsonPayloadCodec) Decode(data []byte) (Payload, error) {
+	p := c()
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// payloadEnvelope is the block data of a typed payload
+type payloadEnvelope struct {
+	Type    string `json:"payloadType"`
+	Payload []byte `json:"payload"`
+}
+
+// NewSHA512Payload creates a new block notarizing p with a random nonce and
+// generates its SHA512 hash. Link payloads without a merkle root create link
+// blocks, see NewSHA512Link.
+func NewSHA512Payload(index int, p Payload, parentHash []byte) (*Block, error) {
+	link, isLink := p.(*LinkPayload)
+	if value, ok := p.(LinkPayload); ok {
+		link, isLink = &value, true
+	}
+	if isLink && len(link.MerkleRoot) == 0 {
+		return NewSHA512Link(index, link.RootHash, parentHash)
+	}
+	codec, err := lookupPayload(p.PayloadType())
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := codec.Encode(p)
+	if err != nil {
+		return nil, errors.Wrapf(err, "block: failed to encode %s payload", p.PayloadType())
+	}
+	data, err := json.Marshal(payloadEnvelope{Type: p.PayloadType(), Payload: encoded})
+	if err != nil {
+		return nil, errors.Wrap(err, "block: failed to encode payload")
+	}
+	nonce, err := randomNonce()
+	if err != nil {
+		return nil, err
+	}
+	blk := &Block{
+		Index:      index,
+		Timestamp:  time.Now().UnixNano(),
+		Data:       data,
+		ParentHash: append([]byte{}, parentHash...),
+		Nonce:      nonce,
+	}
+	if isLink {
+		blk.RootHash = append([]byte{}, link.RootHash...)
+	}
+	if _, err := blk.Hash(sha512.New()); err != nil {
+		return nil, err
+	}
+	return blk, nil
+}
+
+// Payload decodes the block's typed payload with its registered codec. Link
+// blocks return a *LinkPayload and blocks without a typed payload, such as
+// genesis blocks, return ErrNoPayload.
+func (block *Block) Payload() (Payload, error) {
+	if len(block.Data) == 0 && len(block.RootHash) != 0 {
+		return &LinkPayload{RootHash: append([]byte{}, block.RootHash...)}, nil
+	}
+	var envelope payloadEnvelope
+	if err := json.Unmarshal(block.Data, &envelope); err != nil || envelope.Type == "" {
+		return nil, ErrNoPayload
+	}
+	codec, err := lookupPayload(envelope.Type)
+	if err != nil {
+		return nil, err
+	}
+	p, err := codec.Decode(envelope.Payload)
+	if err != nil {
+		return nil, errors.Wrapf(err, "block: failed to decode %s payload", envelope.Type)
+	}
+	return p, nil
+}
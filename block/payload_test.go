@@ -0,0 +1,95 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package block
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+type releasePayload struct {
+	Version string `json:"version"`
+}
+
+func (releasePayload) PayloadType() string { return "release-test" }
+
+func TestNewSHA512Payload(t *testing.T) {
+	parent := NewSHA512Genesis().BlockHash
+	file := FilePayload{Name: "golinks", Size: 3, Algorithm: "sha512", Hash: []byte("hash")}
+	blk, err := NewSHA512Payload(1, file, parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := blk.VerifySHA512(); err != nil {
+		t.Fatal(err)
+	}
+	payload, err := blk.Payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded, ok := payload.(*FilePayload); !ok || decoded.Name != file.Name || !bytes.Equal(decoded.Hash, file.Hash) {
+		t.Errorf("unexpected payload %#v", payload)
+	}
+
+	//Link payloads are recorded in the root hash as link blocks are
+	link, err := NewSHA512Payload(1, LinkPayload{RootHash: []byte("root")}, parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(link.RootHash, []byte("root")) || len(link.Data) != 0 {
+		t.Error("link payload was not recorded as a link block")
+	}
+	if payload, err := link.Payload(); err != nil || !bytes.Equal(payload.(*LinkPayload).RootHash, []byte("root")) {
+		t.Errorf("unexpected link payload %#v %v", payload, err)
+	}
+
+	merkle, err := NewSHA512Payload(1, LinkPayload{RootHash: []byte("root"), MerkleRoot: []byte("merkle")}, parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(merkle.RootHash, []byte("root")) || merkle.VerifySHA512() != nil {
+		t.Error("link payload with a merkle root did not record the root hash")
+	}
+	if payload, err := merkle.Payload(); err != nil || !bytes.Equal(payload.(*LinkPayload).MerkleRoot, []byte("merkle")) {
+		t.Errorf("unexpected link payload %#v %v", payload, err)
+	}
+
+	meta, err := NewSHA512Payload(1, MetadataPayload{"release": "v1.2.0"}, parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload, err := meta.Payload(); err != nil || (*payload.(*MetadataPayload))["release"] != "v1.2.0" {
+		t.Errorf("unexpected metadata payload %#v %v", payload, err)
+	}
+
+	if _, err := NewSHA512Payload(1, releasePayload{"v1"}, parent); !errors.Is(err, ErrUnknownPayload) {
+		t.Error("expected unknown payload, got", err)
+	}
+	RegisterPayload("release-test", JSONPayloadCodec(func() Payload { return &releasePayload{} }))
+	release, err := NewSHA512Payload(1, releasePayload{"v1"}, parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload, err := release.Payload(); err != nil || payload.(*releasePayload).Version != "v1" {
+		t.Errorf("unexpected registered payload %#v %v", payload, err)
+	}
+
+	if _, err := NewSHA512Genesis().Payload(); err != ErrNoPayload {
+		t.Error("expected no payload, got", err)
+	}
+}
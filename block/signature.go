@@ -0,0 +1,157 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package block
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+
+	"github.com/pkg/errors"
+)
+
+// Signature algorithms
+const (
+	Ed25519 = "ed25519"
+	ECDSA   = "ecdsa"
+)
+
+var (
+	// ErrUnhashedBlock is returned when signing a block without a hash
+	ErrUnhashedBlock = errors.New("block: can't sign unhashed block")
+	// ErrBadSignature is returned when a signature fails verification
+	ErrBadSignature = errors.New("block: invalid signature")
+	// ErrQuorumNotMet is returned when too few trusted parties signed a block
+	ErrQuorumNotMet = errors.New("block: signature quorum not met")
+)
+
+// Signature is a detached signature over a block's hash, which commits to the
+// block header. PublicKey is the signer's PKIX DER encoded public key.
+type Signature struct {
+	Algorithm string `json:"algorithm"`
+	PublicKey []byte `json:"publicKey"`
+	Signature []byte `json:"signature"`
+}
+
+// Sign attests to the block with signer, which must hold an Ed25519 or ECDSA
+// key, and appends the signature to the block
+func (block *Block) Sign(signer crypto.Signer) error {
+	if len(block.BlockHash) == 0 {
+		return ErrUnhashedBlock
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return errors.Wrap(err, "block: failed to encode public key")
+	}
+
+	var sig Signature
+	switch signer.Public().(type) {
+	case ed25519.PublicKey:
+		sig.Signature, err = signer.Sign(rand.Reader, block.BlockHash, crypto.Hash(0))
+		sig.Algorithm = Ed25519
+	case *ecdsa.PublicKey:
+		//BlockHash is already a SHA512 digest of the header
+		sig.Signature, err = signer.Sign(rand.Reader, block.BlockHash, crypto.SHA512)
+		sig.Algorithm = ECDSA
+	default:
+		return errors.Errorf("block: unsupported signing key %T", signer.Public())
+	}
+	if err != nil {
+		return errors.Wrap(err, "block: failed to sign block")
+	}
+	sig.PublicKey = publicKey
+	block.Signatures = append(block.Signatures, sig)
+	return nil
+}
+
+// Signers returns the public keys of all parties that signed the block
+func (block *Block) Signers() ([]crypto.PublicKey, error) {
+	signers := make([]crypto.PublicKey, 0, len(block.Signatures))
+	for _, sig := range block.Signatures {
+		key, err := x509.ParsePKIXPublicKey(sig.PublicKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "block: failed to decode signer")
+		}
+		signers = append(signers, key)
+	}
+	return signers, nil
+}
+
+// Verify checks the signature against hash
+func (sig Signature) Verify(hash []byte) error {
+	key, err := x509.ParsePKIXPublicKey(sig.PublicKey)
+	if err != nil {
+		return errors.Wrap(ErrBadSignature, err.Error())
+	}
+	switch key := key.(type) {
+	case ed25519.PublicKey:
+		if sig.Algorithm == Ed25519 && ed25519.Verify(key, hash, sig.Signature) {
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		if sig.Algorithm == ECDSA && ecdsa.VerifyASN1(key, hash, sig.Signature) {
+			return nil
+		}
+	}
+	return ErrBadSignature
+}
+
+// VerifySignatures verifies every signature attached to the block
+func (block *Block) VerifySignatures() error {
+	for i, sig := range block.Signatures {
+		if err := sig.Verify(block.BlockHash); err != nil {
+			return errors.Wrapf(err, "signature %d", i)
+		}
+	}
+	return nil
+}
+
+// VerifyQuorum returns nil if at least threshold distinct keys from trusted
+// hold valid signatures over the block. Invalid or untrusted signatures are
+// not counted.
+func (block *Block) VerifyQuorum(trusted []crypto.PublicKey, threshold int) error {
+	var trustedDER [][]byte
+	for _, key := range trusted {
+		der, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			return errors.Wrap(err, "block: failed to encode trusted key")
+		}
+		trustedDER = append(trustedDER, der)
+	}
+
+	counted := make([]bool, len(trustedDER))
+	valid := 0
+	for _, sig := range block.Signatures {
+		if sig.Verify(block.BlockHash) != nil {
+			continue
+		}
+		for i, der := range trustedDER {
+			if !counted[i] && bytes.Equal(der, sig.PublicKey) {
+				counted[i] = true
+				valid++
+				break
+			}
+		}
+	}
+	if valid < threshold {
+		return errors.Wrapf(ErrQuorumNotMet, "%d of %d required signatures", valid, threshold)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package block
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestBlock_Sign(t *testing.T) {
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blk := NewSHA512(1, []byte("snapshot"), NewSHA512Genesis().BlockHash)
+	hash := append([]byte{}, blk.BlockHash...)
+	if err := blk.Sign(edKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := blk.Sign(ecKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := blk.VerifySHA512(); err != nil {
+		t.Error("signing changed the block hash:", err)
+	}
+
+	signers, err := blk.Signers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(signers) != 2 || !edPub.Equal(signers[0]) || !ecKey.PublicKey.Equal(signers[1]) {
+		t.Error("unexpected signers", signers)
+	}
+
+	if err := blk.VerifySignatures(); err != nil {
+		t.Error(err)
+	}
+	trusted := []crypto.PublicKey{edPub, &ecKey.PublicKey, otherPub}
+	if err := blk.VerifyQuorum(trusted, 2); err != nil {
+		t.Error(err)
+	}
+	if err := blk.VerifyQuorum(trusted, 3); !errors.Is(err, ErrQuorumNotMet) {
+		t.Error("expected quorum failure, got", err)
+	}
+
+	//Duplicate signatures from one party count once
+	if err := blk.Sign(edKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := blk.VerifyQuorum([]crypto.PublicKey{edPub}, 2); !errors.Is(err, ErrQuorumNotMet) {
+		t.Error("expected duplicate signer to count once, got", err)
+	}
+
+	//Signatures survive a JSON round trip
+	jsonBytes, err := json.Marshal(blk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := &Block{}
+	if err := json.Unmarshal(jsonBytes, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if err := decoded.VerifySignatures(); err != nil {
+		t.Error(err)
+	}
+
+	//Signatures don't transfer to another block
+	decoded.BlockHash = NewSHA512(2, []byte("other"), hash).BlockHash
+	if err := decoded.VerifySignatures(); !errors.Is(err, ErrBadSignature) {
+		t.Error("expected bad signature, got", err)
+	}
+
+	if err := (&Block{}).Sign(edKey); err != ErrUnhashedBlock {
+		t.Error("expected unhashed block error, got", err)
+	}
+}
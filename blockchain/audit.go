@@ -0,0 +1,47 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockchain
+
+import (
+	"context"
+
+	"github.com/govice/golinks/audit"
+)
+
+// SetAuditLog records appends, adoptions and prunes of the chain in l with
+// the chain's head block hash before and after, naming the chain target. A
+// nil log disables auditing.
+func (b *Blockchain) SetAuditLog(l *audit.Log, target string) {
+	b.auditLog, b.auditTarget = l, target
+}
+
+// head returns the hash of the chain's last block
+func (b *Blockchain) head() []byte {
+	if b.Length() == 0 {
+		return nil
+	}
+	return b.At(b.Length() - 1).BlockHash
+}
+
+// record records op in the audit log if one is set
+func (b *Blockchain) record(ctx context.Context, op string, prevHead []byte) error {
+	if b.auditLog == nil {
+		return nil
+	}
+	_, err := b.auditLog.Record(ctx, op, b.auditTarget, prevHead, b.head())
+	return err
+}
@@ -0,0 +1,81 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/govice/golinks/audit"
+	"github.com/govice/golinks/blockmap"
+)
+
+func TestBlockchain_SetAuditLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	l, err := audit.Open(filepath.Join(dir, "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	l.SetActor("daemon")
+
+	chain, err := New(genesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	theirs := Copy(chain)
+	chain.SetAuditLog(l, "main")
+	genesisHash := chain.At(0).BlockHash
+
+	b := blockmap.New("")
+	b.RootHash = []byte("root")
+	ctx := audit.NewContext(context.Background(), "ci@10.0.0.1")
+	blk, err := chain.AddContext(ctx, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	theirs.AddSHA512([]byte("theirs"))
+	theirs.AddSHA512([]byte("theirs2"))
+	if err := chain.Adopt(theirs); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := l.Entries(audit.Filter{Target: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected an append and an adoption, got %+v", entries)
+	}
+	appended, adopted := entries[0], entries[1]
+	if appended.Operation != audit.OpAppend || appended.Actor != "ci@10.0.0.1" ||
+		!bytes.Equal(appended.PrevRootHash, genesisHash) || !bytes.Equal(appended.NewRootHash, blk.BlockHash) {
+		t.Errorf("unexpected append %+v", appended)
+	}
+	if adopted.Operation != audit.OpAdopt || adopted.Actor != "daemon" ||
+		!bytes.Equal(adopted.PrevRootHash, blk.BlockHash) || !bytes.Equal(adopted.NewRootHash, theirs.At(2).BlockHash) {
+		t.Errorf("unexpected adoption %+v", adopted)
+	}
+}
@@ -18,20 +18,33 @@ package blockchain
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"os"
 
+	"github.com/govice/golinks/audit"
 	"github.com/govice/golinks/block"
+	"github.com/govice/golinks/blockmap"
 
 	"fmt"
 
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 //Blockchain type implements an array of blocks.
 // type Blockchain []block.Block
 type Blockchain struct {
-	Blocks []block.Block `json:"blocks"`
+	Blocks     []block.Block `json:"blocks"`
+	Checkpoint *Checkpoint   `json:"checkpoint,omitempty"`
+	store      Store
+	writer     string
+
+	auditLog    *audit.Log
+	auditTarget string
 }
 
 type Blockchainer interface {
@@ -71,6 +84,54 @@ func (b *Blockchain) AddSHA512(data []byte) *block.Block {
 	return blk
 }
 
+//Add appends a new block recording the root hash of a generated blockmap.
+func (b *Blockchain) Add(blkmap *blockmap.BlockMap) (*block.Block, error) {
+	return b.AddContext(context.Background(), blkmap)
+}
+
+//AddContext is Add, tracing the append in a span under any span in ctx
+func (b *Blockchain) AddContext(ctx context.Context, blkmap *blockmap.BlockMap) (blk *block.Block, err error) {
+	_, span := tracer.Start(ctx, "blockchain.Add", trace.WithAttributes(attribute.Int("golinks.index", b.Length())))
+	defer func() { endSpan(span, err) }()
+
+	if blkmap.RootHash == nil {
+		return nil, errors.New("blockchain: can't add unhashed blockmap")
+	}
+	blk, err = block.NewSHA512Link(b.Length(), blkmap.RootHash, b.Blocks[b.Length()-1].BlockHash)
+	if err != nil {
+		return nil, errors.Wrap(err, "Add: failed to create block")
+	}
+	return b.append(ctx, blk)
+}
+
+//AddPayload appends a new block notarizing a typed payload
+func (b *Blockchain) AddPayload(p block.Payload) (*block.Block, error) {
+	blk, err := block.NewSHA512Payload(b.Length(), p, b.Blocks[b.Length()-1].BlockHash)
+	if err != nil {
+		return nil, errors.Wrap(err, "AddPayload: failed to create block")
+	}
+	return b.append(context.Background(), blk)
+}
+
+//append adds blk to the chain and writes it through to any store, auditing
+//the append as the actor in ctx
+func (b *Blockchain) append(ctx context.Context, blk *block.Block) (*block.Block, error) {
+	if b.writer != "" {
+		if err := b.stamp(blk); err != nil {
+			return nil, err
+		}
+	}
+	prevHead := b.head()
+	b.Blocks = append(b.Blocks, *blk)
+	if err := b.Sync(); err != nil {
+		return nil, err
+	}
+	if err := b.record(ctx, audit.OpAppend, prevHead); err != nil {
+		return nil, err
+	}
+	return blk, nil
+}
+
 //Print outputs the blockchain to standard output.
 func (b *Blockchain) Print() {
 	for i := 0; i < len(b.Blocks); i++ {
@@ -80,15 +141,18 @@ func (b *Blockchain) Print() {
 
 //Validate iterates through blocks and calls the block.validate method for the length of the chain.
 func (b *Blockchain) Validate() error {
+	return b.ValidateContext(context.Background())
+}
+
+//ValidateContext is Validate, tracing the validation in a span under any span in ctx
+func (b *Blockchain) ValidateContext(ctx context.Context) (err error) {
+	_, span := tracer.Start(ctx, "blockchain.Validate", trace.WithAttributes(attribute.Int("golinks.blocks", b.Length())))
+	defer func() { endSpan(span, err) }()
+
 	if b.Length() < 2 {
 		return errors.New("Validate: invalid genesis block")
 	}
-	for i := 1; i < b.Length(); i++ {
-		if err := block.Validate(b.At(i-1), b.At(i)); err != nil {
-			return errors.Wrap(err, "Validate: failed to validate blockchain blocks")
-		}
-	}
-	return nil
+	return errors.Wrap(b.validateBlocks(b.Length()-1), "Validate")
 }
 
 //GetCurrentHash Returns the most recent hash in a blockchain
@@ -208,6 +272,16 @@ func (b *Blockchain) FindByParentHash(hash []byte) *block.Block {
 	return nil
 }
 
+//FindByRootHash returns the most recent block recording a blockmap root hash
+func (b *Blockchain) FindByRootHash(hash []byte) *block.Block {
+	for i := b.Length() - 1; i >= 0; i-- {
+		if len(b.Blocks[i].RootHash) != 0 && bytes.Equal(b.Blocks[i].RootHash, hash) {
+			return b.At(i)
+		}
+	}
+	return nil
+}
+
 func (b *Blockchain) FindByTimestamp(timestamp int64) *block.Block {
 	for _, block := range b.Blocks {
 		if block.Timestamp == timestamp {
@@ -219,7 +293,8 @@ func (b *Blockchain) FindByTimestamp(timestamp int64) *block.Block {
 
 func Copy(other *Blockchain) *Blockchain {
 	newChain := &Blockchain{
-		Blocks: make([]block.Block, len(other.Blocks)),
+		Blocks:     make([]block.Block, len(other.Blocks)),
+		Checkpoint: other.Checkpoint,
 	}
 	copy(newChain.Blocks, other.Blocks)
 	return newChain
@@ -246,3 +321,14 @@ func UpdateChain(original, new *Blockchain) (*Blockchain, error) {
 	chainCopy := *new
 	return &chainCopy, nil
 }
+
+//tracer reports chain operations to the global OpenTelemetry tracer provider
+var tracer = otel.Tracer("github.com/govice/golinks/blockchain")
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
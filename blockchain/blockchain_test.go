@@ -17,12 +17,17 @@
 package blockchain
 
 import (
+	"bytes"
+	"errors"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/govice/golinks/block"
+	"github.com/govice/golinks/blockmap"
 )
 
 var genesisBlock = block.NewSHA512Genesis()
@@ -292,3 +297,59 @@ func TestBlockchain_UpdateChain(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestBlockchain_Add(t *testing.T) {
+	root, err := ioutil.TempDir("", "chain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := ioutil.WriteFile(filepath.Join(root, "file"), []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := New(genesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.Add(blockmap.New(root)); err == nil {
+		t.Error("expected error adding unhashed blockmap")
+	}
+
+	first := blockmap.New(root)
+	if err := first.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Add(first); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(root, "file"), []byte("v2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	second := blockmap.New(root)
+	if err := second.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	blk, err := b.Add(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Validate(); err != nil {
+		t.Error(err)
+	}
+	if !bytes.Equal(blk.RootHash, second.RootHash) {
+		t.Error("block does not record blockmap root hash")
+	}
+	if result := b.FindByRootHash(first.RootHash); result == nil || result.Index != 1 {
+		t.Error("failed to find block by root hash")
+	}
+
+	//Rewriting history must invalidate the chain
+	b.At(1).RootHash = second.RootHash
+	if err := b.Validate(); !errors.Is(err, block.ErrBadBlockHash) {
+		t.Error("expected tampered chain to fail validation, got", err)
+	}
+}
@@ -0,0 +1,261 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockchain
+
+import (
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/govice/golinks/block"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	boltBlocksBucket = []byte("blocks")
+	boltHashesBucket = []byte("hashes")
+	boltMetaBucket   = []byte("meta")
+	boltCheckpoint   = []byte("checkpoint")
+)
+
+// BoltStore is the default Store, persisting blocks in an embedded bbolt
+// database. Blocks are keyed by big endian index with a secondary index from
+// block hash to index.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// OpenBoltStore opens or creates a bbolt backed store at path
+func OpenBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "OpenBoltStore: failed to open database")
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{boltBlocksBucket, boltHashesBucket, boltMetaBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "OpenBoltStore: failed to create buckets")
+	}
+	return &BoltStore{db: db}, nil
+}
+
+func boltIndexKey(index int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(index))
+	return key
+}
+
+func decodeBoltBlock(value []byte) (*block.Block, error) {
+	blk := &block.Block{}
+	if err := json.Unmarshal(value, blk); err != nil {
+		return nil, errors.Wrap(err, "blockchain: failed to decode stored block")
+	}
+	return blk, nil
+}
+
+// Append stores blk as the next block in the chain
+func (s *BoltStore) Append(blk *block.Block) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		blocks := tx.Bucket(boltBlocksBucket)
+		var prev *block.Block
+		height := 0
+		if key, value := blocks.Cursor().Last(); key != nil {
+			var err error
+			if prev, err = decodeBoltBlock(value); err != nil {
+				return err
+			}
+			height = int(binary.BigEndian.Uint64(key)) + 1
+		}
+		if err := checkAppend(prev, blk, height); err != nil {
+			return err
+		}
+
+		value, err := json.Marshal(blk)
+		if err != nil {
+			return errors.Wrap(err, "blockchain: failed to encode block")
+		}
+		key := boltIndexKey(blk.Index)
+		if err := blocks.Put(key, value); err != nil {
+			return err
+		}
+		return tx.Bucket(boltHashesBucket).Put(blk.BlockHash, key)
+	})
+}
+
+// Attach replaces the detached signatures and anchors of the stored block
+// with blk's hash with those of blk
+func (s *BoltStore) Attach(blk *block.Block) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		key := tx.Bucket(boltHashesBucket).Get(blk.BlockHash)
+		if key == nil {
+			return ErrBlockNotFound
+		}
+		blocks := tx.Bucket(boltBlocksBucket)
+		stored, err := decodeBoltBlock(blocks.Get(key))
+		if err != nil {
+			return err
+		}
+		attach(stored, blk)
+		value, err := json.Marshal(stored)
+		if err != nil {
+			return errors.Wrap(err, "blockchain: failed to encode block")
+		}
+		return blocks.Put(key, value)
+	})
+}
+
+// Prune drops the data of stored blocks between the genesis block and the
+// checkpointed block and records cp as the latest checkpoint
+func (s *BoltStore) Prune(cp *Checkpoint) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		blocks := tx.Bucket(boltBlocksBucket)
+		if blocks.Get(boltIndexKey(cp.Index)) == nil {
+			return ErrBlockNotFound
+		}
+		for i := 1; i < cp.Index; i++ {
+			key := boltIndexKey(i)
+			blk, err := decodeBoltBlock(blocks.Get(key))
+			if err != nil {
+				return err
+			}
+			if blk.Pruned {
+				continue
+			}
+			prune(blk)
+			value, err := json.Marshal(blk)
+			if err != nil {
+				return errors.Wrap(err, "blockchain: failed to encode block")
+			}
+			if err := blocks.Put(key, value); err != nil {
+				return err
+			}
+		}
+		value, err := json.Marshal(cp)
+		if err != nil {
+			return errors.Wrap(err, "blockchain: failed to encode checkpoint")
+		}
+		return tx.Bucket(boltMetaBucket).Put(boltCheckpoint, value)
+	})
+}
+
+// Checkpoint returns the latest recorded checkpoint, or nil if there is none
+func (s *BoltStore) Checkpoint() (*Checkpoint, error) {
+	var cp *Checkpoint
+	err := s.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(boltMetaBucket).Get(boltCheckpoint)
+		if value == nil {
+			return nil
+		}
+		cp = &Checkpoint{}
+		return errors.Wrap(json.Unmarshal(value, cp), "blockchain: failed to decode checkpoint")
+	})
+	return cp, err
+}
+
+// Truncate removes the stored blocks from index height onward
+func (s *BoltStore) Truncate(height int) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		blocks := tx.Bucket(boltBlocksBucket)
+		hashes := tx.Bucket(boltHashesBucket)
+		cursor := blocks.Cursor()
+		for key, value := cursor.Seek(boltIndexKey(height)); key != nil; key, value = cursor.Next() {
+			blk, err := decodeBoltBlock(value)
+			if err != nil {
+				return err
+			}
+			if err := hashes.Delete(blk.BlockHash); err != nil {
+				return err
+			}
+			if err := cursor.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Height returns the number of stored blocks
+func (s *BoltStore) Height() (int, error) {
+	height := 0
+	err := s.db.View(func(tx *bolt.Tx) error {
+		key, _ := tx.Bucket(boltBlocksBucket).Cursor().Last()
+		if key != nil {
+			height = int(binary.BigEndian.Uint64(key)) + 1
+		}
+		return nil
+	})
+	return height, err
+}
+
+// BlockAt returns the block at index
+func (s *BoltStore) BlockAt(index int) (*block.Block, error) {
+	if index < 0 {
+		return nil, ErrBlockNotFound
+	}
+	var blk *block.Block
+	err := s.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(boltBlocksBucket).Get(boltIndexKey(index))
+		if value == nil {
+			return ErrBlockNotFound
+		}
+		var err error
+		blk, err = decodeBoltBlock(value)
+		return err
+	})
+	return blk, err
+}
+
+// BlockByHash returns the block with the given block hash
+func (s *BoltStore) BlockByHash(hash []byte) (*block.Block, error) {
+	var blk *block.Block
+	err := s.db.View(func(tx *bolt.Tx) error {
+		key := tx.Bucket(boltHashesBucket).Get(hash)
+		if key == nil {
+			return ErrBlockNotFound
+		}
+		value := tx.Bucket(boltBlocksBucket).Get(key)
+		if value == nil {
+			return ErrBlockNotFound
+		}
+		var err error
+		blk, err = decodeBoltBlock(value)
+		return err
+	})
+	return blk, err
+}
+
+// Iterator returns an iterator over the blocks starting at index
+func (s *BoltStore) Iterator(index int) Iterator {
+	return &storeIterator{store: s, next: index}
+}
+
+// Close closes the underlying database
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// Path returns the database file path
+func (s *BoltStore) Path() string {
+	return s.db.Path()
+}
@@ -0,0 +1,220 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockchain
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha512"
+	"encoding/json"
+	"time"
+
+	"github.com/govice/golinks/audit"
+	"github.com/govice/golinks/block"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrBadCheckpoint is returned when a checkpoint doesn't match the chain
+	ErrBadCheckpoint = errors.New("blockchain: checkpoint does not match chain")
+	// ErrUnsignedCheckpoint is returned when pruning with an unsigned checkpoint
+	ErrUnsignedCheckpoint = errors.New("blockchain: checkpoint is unsigned")
+	// ErrPrunedBlock is returned when a pruned block isn't covered by a
+	// verified checkpoint
+	ErrPrunedBlock = errors.New("blockchain: pruned block is not covered by a checkpoint")
+)
+
+// Checkpoint attests to the chain up to the block at Index. It commits to the
+// headers of every block through Index, which are kept when block bodies are
+// pruned, so the pruned history stays verifiable against the checkpoint's
+// signatures.
+type Checkpoint struct {
+	Index       int               `json:"index"`
+	BlockHash   []byte            `json:"blockHash"`
+	HeadersHash []byte            `json:"headersHash"`
+	Timestamp   int64             `json:"timestamp"`
+	Signatures  []block.Signature `json:"signatures,omitempty"`
+}
+
+// blockHeader is the part of a block that remains after pruning
+type blockHeader struct {
+	Index      int    `json:"index"`
+	Timestamp  int64  `json:"timestamp"`
+	ParentHash []byte `json:"parentHash"`
+	RootHash   []byte `json:"rootHash,omitempty"`
+	Nonce      uint64 `json:"nonce,omitempty"`
+	BlockHash  []byte `json:"blockHash"`
+}
+
+// headersHash returns the SHA512 hash of the headers of blocks through index
+func (b *Blockchain) headersHash(index int) ([]byte, error) {
+	hash := sha512.New()
+	encoder := json.NewEncoder(hash)
+	for i := 0; i <= index; i++ {
+		blk := b.At(i)
+		header := blockHeader{blk.Index, blk.Timestamp, blk.ParentHash, blk.RootHash, blk.Nonce, blk.BlockHash}
+		if err := encoder.Encode(header); err != nil {
+			return nil, err
+		}
+	}
+	return hash.Sum(nil), nil
+}
+
+// Digest returns the SHA512 hash checkpoint signatures are made over
+func (cp *Checkpoint) Digest() []byte {
+	data, _ := json.Marshal(struct {
+		Index       int    `json:"index"`
+		BlockHash   []byte `json:"blockHash"`
+		HeadersHash []byte `json:"headersHash"`
+		Timestamp   int64  `json:"timestamp"`
+	}{cp.Index, cp.BlockHash, cp.HeadersHash, cp.Timestamp})
+	digest := sha512.Sum512(data)
+	return digest[:]
+}
+
+// signed returns a block carrying the checkpoint's signatures over its digest
+// so they are checked like block signatures
+func (cp *Checkpoint) signed() *block.Block {
+	return &block.Block{BlockHash: cp.Digest(), Signatures: cp.Signatures}
+}
+
+// Sign attests to the checkpoint with signer, see block.Block.Sign
+func (cp *Checkpoint) Sign(signer crypto.Signer) error {
+	blk := cp.signed()
+	if err := blk.Sign(signer); err != nil {
+		return err
+	}
+	cp.Signatures = blk.Signatures
+	return nil
+}
+
+// VerifyQuorum returns nil if at least threshold distinct keys from trusted
+// signed the checkpoint, see block.Block.VerifyQuorum
+func (cp *Checkpoint) VerifyQuorum(trusted []crypto.PublicKey, threshold int) error {
+	return cp.signed().VerifyQuorum(trusted, threshold)
+}
+
+// NewCheckpoint validates the chain through index and returns a checkpoint of
+// it signed by signers
+func (b *Blockchain) NewCheckpoint(index int, signers ...crypto.Signer) (*Checkpoint, error) {
+	if index <= 0 || index >= b.Length() {
+		return nil, errors.Wrapf(ErrBlockNotFound, "NewCheckpoint: index %d", index)
+	}
+	if err := b.validateBlocks(index); err != nil {
+		return nil, err
+	}
+	headersHash, err := b.headersHash(index)
+	if err != nil {
+		return nil, errors.Wrap(err, "NewCheckpoint: failed to hash headers")
+	}
+	cp := &Checkpoint{
+		Index:       index,
+		BlockHash:   append([]byte{}, b.At(index).BlockHash...),
+		HeadersHash: headersHash,
+		Timestamp:   time.Now().UnixNano(),
+	}
+	for _, signer := range signers {
+		if err := cp.Sign(signer); err != nil {
+			return nil, err
+		}
+	}
+	return cp, nil
+}
+
+// VerifyCheckpoint checks cp commits to the chain's headers and its
+// signatures are valid
+func (b *Blockchain) VerifyCheckpoint(cp *Checkpoint) error {
+	if cp.Index <= 0 || cp.Index >= b.Length() || !bytes.Equal(b.At(cp.Index).BlockHash, cp.BlockHash) {
+		return ErrBadCheckpoint
+	}
+	headersHash, err := b.headersHash(cp.Index)
+	if err != nil {
+		return errors.Wrap(err, "VerifyCheckpoint: failed to hash headers")
+	}
+	if !bytes.Equal(headersHash, cp.HeadersHash) {
+		return ErrBadCheckpoint
+	}
+	return errors.Wrap(cp.signed().VerifySignatures(), "VerifyCheckpoint")
+}
+
+// Prune drops the data of blocks between the genesis block and the block at
+// cp's index, keeping their headers, and records cp as the chain's
+// checkpoint. The checkpoint must be signed and is written through to the
+// chain's store.
+func (b *Blockchain) Prune(cp *Checkpoint) error {
+	if len(cp.Signatures) == 0 {
+		return ErrUnsignedCheckpoint
+	}
+	if err := b.validateBlocks(cp.Index); err != nil {
+		return err
+	}
+	if err := b.VerifyCheckpoint(cp); err != nil {
+		return err
+	}
+	if b.Checkpoint != nil && b.Checkpoint.Index > cp.Index {
+		return errors.Wrap(ErrBadCheckpoint, "Prune: chain has a later checkpoint")
+	}
+
+	if b.store != nil {
+		if err := b.Sync(); err != nil {
+			return err
+		}
+		if err := b.store.Prune(cp); err != nil {
+			return errors.Wrap(err, "Prune: failed to prune store")
+		}
+	}
+	for i := 1; i < cp.Index; i++ {
+		prune(b.At(i))
+	}
+	b.Checkpoint = cp
+	return b.record(context.Background(), audit.OpPrune, b.head())
+}
+
+// prune drops a block's data
+func prune(blk *block.Block) {
+	blk.Data = nil
+	blk.Pruned = true
+}
+
+// validateBlocks verifies the blocks through index. Pruned blocks must be
+// covered by the chain's checkpoint, which must be valid.
+func (b *Blockchain) validateBlocks(index int) error {
+	checkpointed := false
+	for i := 0; i <= index; i++ {
+		blk := b.At(i)
+		if blk.Pruned {
+			if b.Checkpoint == nil || i >= b.Checkpoint.Index {
+				return errors.Wrapf(ErrPrunedBlock, "block %d", i)
+			}
+			if !checkpointed {
+				if err := b.VerifyCheckpoint(b.Checkpoint); err != nil {
+					return err
+				}
+				checkpointed = true
+			}
+		} else if err := blk.VerifySHA512(); err != nil {
+			return errors.Wrapf(err, "failed to verify block %d", i)
+		}
+		if i > 0 {
+			if err := block.Validate(b.At(i-1), blk); err != nil {
+				return errors.Wrapf(err, "failed to validate block %d", i)
+			}
+		}
+	}
+	return nil
+}
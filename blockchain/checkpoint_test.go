@@ -0,0 +1,126 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockchain
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBlockchain_Prune(t *testing.T) {
+	dir, err := ioutil.TempDir("", "prune")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chain, err := Open(NewMemoryStore(), genesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range []string{"first", "second", "third", "fourth"} {
+		chain.AddSHA512([]byte(data))
+	}
+	if err := chain.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	unsigned, err := chain.NewCheckpoint(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.Prune(unsigned); err != ErrUnsignedCheckpoint {
+		t.Error("expected unsigned checkpoint error, got", err)
+	}
+	cp, err := chain.NewCheckpoint(3, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cp.VerifyQuorum([]crypto.PublicKey{pub}, 1); err != nil {
+		t.Error(err)
+	}
+
+	dbPath := filepath.Join(dir, "chain.db")
+	store, err := OpenBoltStore(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bolt, err := Open(store, genesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bolt.Blocks = append(bolt.Blocks[:1], chain.Blocks[1:]...)
+	for _, c := range []*Blockchain{chain, bolt} {
+		if err := c.Prune(cp); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Validate(); err != nil {
+			t.Error(err)
+		}
+	}
+	for i, blk := range chain.Blocks {
+		if pruned := i == 1 || i == 2; blk.Pruned != pruned || (len(blk.Data) == 0) != pruned {
+			t.Errorf("unexpected pruning of block %d", i)
+		}
+	}
+
+	//Pruned blocks and the checkpoint are persisted
+	store.Close()
+	if store, err = OpenBoltStore(dbPath); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	reopened, err := Open(store, genesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.Checkpoint == nil || !reopened.At(1).Pruned || reopened.Length() != 5 {
+		t.Fatal("pruned chain was not persisted")
+	}
+	if err := reopened.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	//Rewriting a pruned header is caught by the checkpoint
+	tampered := Copy(chain)
+	tampered.Blocks[1].Timestamp++
+	if err := tampered.Validate(); !errors.Is(err, ErrBadCheckpoint) {
+		t.Error("expected bad checkpoint, got", err)
+	}
+	tampered = Copy(chain)
+	tampered.Checkpoint = nil
+	if err := tampered.Validate(); !errors.Is(err, ErrPrunedBlock) {
+		t.Error("expected uncovered pruned block, got", err)
+	}
+	forged := *cp
+	forged.Timestamp++
+	tampered = Copy(chain)
+	tampered.Checkpoint = &forged
+	if err := tampered.Validate(); err == nil {
+		t.Error("expected forged checkpoint signature to fail validation")
+	}
+}
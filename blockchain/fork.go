@@ -0,0 +1,147 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockchain
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/govice/golinks/audit"
+	"github.com/govice/golinks/block"
+	"github.com/pkg/errors"
+)
+
+// ErrNoCommonGenesis is returned when comparing chains with different genesis blocks
+var ErrNoCommonGenesis = errors.New("blockchain: chains do not share a genesis block")
+
+// Fork describes how two chains sharing a genesis block relate. Blocks before
+// Index are common to both chains, Ours and Theirs hold each chain's blocks
+// from Index onward.
+type Fork struct {
+	Index  int
+	Ours   []block.Block
+	Theirs []block.Block
+}
+
+// Conflict pairs the blocks two chains hold at the same index
+type Conflict struct {
+	Index  int
+	Ours   *block.Block
+	Theirs *block.Block
+}
+
+// Diverged returns true if both chains hold blocks past the common prefix,
+// false if one chain simply extends the other
+func (f *Fork) Diverged() bool {
+	return len(f.Ours) > 0 && len(f.Theirs) > 0
+}
+
+// Conflicts returns the blocks held at the same index by both chains after
+// the divergence point
+func (f *Fork) Conflicts() []Conflict {
+	var conflicts []Conflict
+	for i := 0; i < len(f.Ours) && i < len(f.Theirs); i++ {
+		conflicts = append(conflicts, Conflict{
+			Index:  f.Index + i,
+			Ours:   &f.Ours[i],
+			Theirs: &f.Theirs[i],
+		})
+	}
+	return conflicts
+}
+
+// FindFork compares ours and theirs and returns the point they diverge
+func FindFork(ours, theirs *Blockchain) (*Fork, error) {
+	if ours.Length() == 0 || theirs.Length() == 0 ||
+		!bytes.Equal(ours.At(0).BlockHash, theirs.At(0).BlockHash) {
+		return nil, ErrNoCommonGenesis
+	}
+
+	index := 1
+	for index < ours.Length() && index < theirs.Length() &&
+		bytes.Equal(ours.At(index).BlockHash, theirs.At(index).BlockHash) {
+		index++
+	}
+
+	fork := &Fork{Index: index}
+	fork.Ours = append(fork.Ours, ours.Blocks[index:]...)
+	fork.Theirs = append(fork.Theirs, theirs.Blocks[index:]...)
+	return fork, nil
+}
+
+// Reconcile resolves a fork between ours and theirs and returns a copy of the
+// winning chain along with the fork. Invalid chains never win, otherwise the
+// longest chain wins and ties are broken by the lowest block hash at the
+// divergence point so every party resolves the same way.
+func Reconcile(ours, theirs *Blockchain) (*Blockchain, *Fork, error) {
+	fork, err := FindFork(ours, theirs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	oursErr := validateFork(ours)
+	theirsErr := validateFork(theirs)
+	switch {
+	case oursErr != nil && theirsErr != nil:
+		return nil, fork, errors.Wrap(theirsErr, "Reconcile: neither chain is valid")
+	case theirsErr != nil:
+		return Copy(ours), fork, nil
+	case oursErr != nil:
+		return Copy(theirs), fork, nil
+	}
+
+	if len(fork.Theirs) > len(fork.Ours) {
+		return Copy(theirs), fork, nil
+	}
+	if len(fork.Theirs) == len(fork.Ours) && fork.Diverged() &&
+		bytes.Compare(fork.Theirs[0].BlockHash, fork.Ours[0].BlockHash) < 0 {
+		return Copy(theirs), fork, nil
+	}
+	return Copy(ours), fork, nil
+}
+
+// Adopt replaces the chain's blocks with winner's, such as the chain returned
+// by Reconcile, truncating the chain's store back to the fork point first.
+// Forks before the chain's checkpoint are refused.
+func (b *Blockchain) Adopt(winner *Blockchain) error {
+	fork, err := FindFork(b, winner)
+	if err != nil {
+		return err
+	}
+	if len(fork.Ours) > 0 && b.Checkpoint != nil && fork.Index <= b.Checkpoint.Index {
+		return errors.Wrap(ErrBadCheckpoint, "Adopt: fork precedes the checkpoint")
+	}
+	if len(fork.Ours) > 0 && b.store != nil {
+		if err := b.store.Truncate(fork.Index); err != nil {
+			return errors.Wrap(err, "Adopt: failed to truncate store")
+		}
+	}
+	prevHead := b.head()
+	b.Blocks = append(b.Blocks[:fork.Index], fork.Theirs...)
+	if err := b.Sync(); err != nil {
+		return err
+	}
+	return b.record(context.Background(), audit.OpAdopt, prevHead)
+}
+
+// validateFork validates chain, allowing a chain holding only its genesis block
+func validateFork(chain *Blockchain) error {
+	if chain.Length() == 1 {
+		return chain.At(0).VerifySHA512()
+	}
+	return chain.Validate()
+}
@@ -0,0 +1,149 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockchain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/govice/golinks/block"
+)
+
+func TestFindFork(t *testing.T) {
+	ours, err := New(genesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ours.AddSHA512([]byte("common"))
+	theirs := Copy(ours)
+	ours.AddSHA512([]byte("ours"))
+	theirs.AddSHA512([]byte("theirs"))
+	theirs.AddSHA512([]byte("theirs2"))
+
+	fork, err := FindFork(ours, theirs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fork.Index != 2 || len(fork.Ours) != 1 || len(fork.Theirs) != 2 {
+		t.Errorf("unexpected fork %+v", fork)
+	}
+	if !fork.Diverged() {
+		t.Error("expected chains to diverge")
+	}
+	conflicts := fork.Conflicts()
+	if len(conflicts) != 1 || conflicts[0].Index != 2 || !block.Equal(conflicts[0].Ours, ours.At(2)) {
+		t.Errorf("unexpected conflicts %+v", conflicts)
+	}
+
+	//A chain extending another doesn't diverge
+	extended := Copy(ours)
+	extended.AddSHA512([]byte("more"))
+	fork, err = FindFork(ours, extended)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fork.Diverged() || fork.Index != ours.Length() || len(fork.Conflicts()) != 0 {
+		t.Errorf("unexpected fork %+v", fork)
+	}
+
+	other, err := New(block.NewSHA512(0, []byte("other genesis"), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FindFork(ours, other); !errors.Is(err, ErrNoCommonGenesis) {
+		t.Error("expected no common genesis, got", err)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	ours, err := New(genesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ours.AddSHA512([]byte("common"))
+	theirs := Copy(ours)
+	ours.AddSHA512([]byte("ours"))
+	theirs.AddSHA512([]byte("theirs"))
+	theirs.AddSHA512([]byte("theirs2"))
+
+	winner, _, err := Reconcile(ours, theirs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Equal(winner, theirs) {
+		t.Error("expected longest chain to win")
+	}
+
+	//Tampered chains lose regardless of length
+	theirs.At(3).Data = []byte("tampered")
+	winner, _, err = Reconcile(ours, theirs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Equal(winner, ours) {
+		t.Error("expected valid chain to win")
+	}
+
+	//Ties resolve identically from both sides
+	tied := Copy(ours)
+	tied.Blocks = tied.Blocks[:2]
+	tied.AddSHA512([]byte("tie"))
+	a, _, err := Reconcile(ours, tied)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _, err := Reconcile(tied, ours)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Equal(a, b) {
+		t.Error("tie break is not deterministic")
+	}
+}
+
+func TestAdopt(t *testing.T) {
+	store := NewMemoryStore()
+	ours, err := Open(store, genesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ours.AddSHA512([]byte("common"))
+	theirs := Copy(ours)
+	ours.AddSHA512([]byte("ours"))
+	theirs.AddSHA512([]byte("theirs"))
+	theirs.AddSHA512([]byte("theirs2"))
+
+	winner, _, err := Reconcile(ours, theirs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ours.Adopt(winner); err != nil {
+		t.Fatal(err)
+	}
+	if !Equal(ours, theirs) {
+		t.Error("expected adopted chain")
+	}
+
+	//The store was rewound to the fork before storing the adopted blocks
+	reopened, err := Open(store, genesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Equal(reopened, theirs) {
+		t.Error("expected store to hold the adopted chain")
+	}
+}
@@ -0,0 +1,141 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockchain
+
+import (
+	"crypto/sha512"
+	"encoding/json"
+	"time"
+
+	"github.com/govice/golinks/block"
+	"github.com/pkg/errors"
+)
+
+// genesisVersion identifies genesis blocks recording GenesisMeta
+const genesisVersion = 1
+
+var (
+	// ErrNoGenesisMeta is returned when a chain's genesis block doesn't
+	// record GenesisMeta, such as one created by block.NewSHA512Genesis
+	ErrNoGenesisMeta = errors.New("blockchain: genesis block has no metadata")
+	// ErrGenesisMismatch is returned when a chain's genesis block doesn't
+	// match the expected metadata
+	ErrGenesisMismatch = errors.New("blockchain: genesis block does not match")
+)
+
+// GenesisMeta describes the chain started by a genesis block: who created it,
+// the root path its blocks record, and policy parameters its users agree on,
+// such as the file hash of recorded links. It is stored as the genesis
+// block's data, so every block's hash commits to it.
+type GenesisMeta struct {
+	Version int               `json:"genesisVersion"`
+	Creator string            `json:"creator"`
+	Root    string            `json:"root"`
+	Policy  map[string]string `json:"policy,omitempty"`
+}
+
+// NewGenesis returns a hashed genesis block recording meta
+func NewGenesis(meta GenesisMeta) (*block.Block, error) {
+	meta.Version = genesisVersion
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return nil, errors.Wrap(err, "NewGenesis: failed to encode metadata")
+	}
+	genesis := &block.Block{
+		Index:     0,
+		Timestamp: time.Now().UnixNano(),
+		Data:      data,
+	}
+	if _, err := genesis.Hash(sha512.New()); err != nil {
+		return nil, errors.Wrap(err, "NewGenesis: failed to hash block")
+	}
+	return genesis, nil
+}
+
+// NewWithGenesis returns a new blockchain started by a genesis block
+// recording meta
+func NewWithGenesis(meta GenesisMeta) (*Blockchain, error) {
+	genesis, err := NewGenesis(meta)
+	if err != nil {
+		return nil, err
+	}
+	return New(genesis)
+}
+
+// OpenWithGenesis is Open, initializing an empty store with a genesis block
+// recording meta and rejecting a stored chain whose genesis doesn't match it
+func OpenWithGenesis(store Store, meta GenesisMeta) (*Blockchain, error) {
+	genesis, err := NewGenesis(meta)
+	if err != nil {
+		return nil, err
+	}
+	chain, err := Open(store, genesis)
+	if err != nil {
+		return nil, err
+	}
+	if err := chain.ValidateGenesis(meta); err != nil {
+		return nil, err
+	}
+	return chain, nil
+}
+
+// Genesis returns the metadata recorded by the chain's genesis block
+func (b *Blockchain) Genesis() (GenesisMeta, error) {
+	var meta GenesisMeta
+	if b.Length() == 0 {
+		return meta, ErrInvalidGenesisBlock
+	}
+	if err := json.Unmarshal(b.At(0).Data, &meta); err != nil || meta.Version == 0 {
+		return GenesisMeta{}, ErrNoGenesisMeta
+	}
+	return meta, nil
+}
+
+// ValidateGenesis verifies the chain's genesis block is well formed and
+// records the creator, root and policy of expected
+func (b *Blockchain) ValidateGenesis(expected GenesisMeta) error {
+	if b.Length() == 0 {
+		return ErrInvalidGenesisBlock
+	}
+	genesis := b.At(0)
+	if genesis.Index != 0 || len(genesis.ParentHash) != 0 {
+		return ErrInvalidGenesisBlock
+	}
+	if err := genesis.VerifySHA512(); err != nil {
+		return errors.Wrap(err, "ValidateGenesis: failed to verify genesis block")
+	}
+	meta, err := b.Genesis()
+	if err != nil {
+		return err
+	}
+
+	if meta.Creator != expected.Creator {
+		return errors.Wrapf(ErrGenesisMismatch, "creator %q, expected %q", meta.Creator, expected.Creator)
+	}
+	if meta.Root != expected.Root {
+		return errors.Wrapf(ErrGenesisMismatch, "root %q, expected %q", meta.Root, expected.Root)
+	}
+	if len(meta.Policy) != len(expected.Policy) {
+		return errors.Wrapf(ErrGenesisMismatch, "%d policy parameters, expected %d", len(meta.Policy), len(expected.Policy))
+	}
+	for key, value := range expected.Policy {
+		if recorded, ok := meta.Policy[key]; !ok || recorded != value {
+			return errors.Wrapf(ErrGenesisMismatch, "policy %s %q, expected %q", key, recorded, value)
+		}
+	}
+	return nil
+}
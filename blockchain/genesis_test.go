@@ -0,0 +1,84 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockchain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNewWithGenesis(t *testing.T) {
+	meta := GenesisMeta{Creator: "archivist", Root: "/srv/data", Policy: map[string]string{"fileHash": "sha512"}}
+	chain, err := NewWithGenesis(meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.ValidateGenesis(meta); err != nil {
+		t.Fatal(err)
+	}
+	recorded, err := chain.Genesis()
+	if err != nil || recorded.Creator != "archivist" || recorded.Root != "/srv/data" || recorded.Policy["fileHash"] != "sha512" {
+		t.Errorf("unexpected genesis metadata %+v %v", recorded, err)
+	}
+	chain.AddSHA512([]byte("first"))
+	if err := chain.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	mismatched := []GenesisMeta{
+		{Creator: "intruder", Root: "/srv/data", Policy: meta.Policy},
+		{Creator: "archivist", Root: "/srv/other", Policy: meta.Policy},
+		{Creator: "archivist", Root: "/srv/data", Policy: map[string]string{"fileHash": "sha256"}},
+		{Creator: "archivist", Root: "/srv/data"},
+	}
+	for _, expected := range mismatched {
+		if err := chain.ValidateGenesis(expected); !errors.Is(err, ErrGenesisMismatch) {
+			t.Errorf("expected genesis mismatch for %+v, got %v", expected, err)
+		}
+	}
+
+	//Tampering with the recorded metadata breaks the genesis hash
+	tampered := Copy(chain)
+	tampered.Blocks[0].Data = []byte(`{"genesisVersion":1,"creator":"intruder","root":"/srv/data"}`)
+	if err := tampered.ValidateGenesis(GenesisMeta{Creator: "intruder", Root: "/srv/data"}); err == nil {
+		t.Error("expected tampered genesis block to fail validation")
+	}
+
+	legacy, err := New(genesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := legacy.ValidateGenesis(meta); err != ErrNoGenesisMeta {
+		t.Error("expected missing genesis metadata, got", err)
+	}
+}
+
+func TestOpenWithGenesis(t *testing.T) {
+	meta := GenesisMeta{Creator: "archivist", Root: "/srv/data"}
+	store := NewMemoryStore()
+	chain, err := OpenWithGenesis(store, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := OpenWithGenesis(store, meta)
+	if err != nil || !Equal(chain, reopened) {
+		t.Error("failed to reopen chain", err)
+	}
+	if _, err := OpenWithGenesis(store, GenesisMeta{Creator: "intruder", Root: "/srv/data"}); !errors.Is(err, ErrGenesisMismatch) {
+		t.Error("expected genesis mismatch, got", err)
+	}
+}
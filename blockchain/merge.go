@@ -0,0 +1,153 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"sort"
+	"strconv"
+
+	"github.com/govice/golinks/block"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrNoClock is returned when merging diverged blocks that weren't
+	// appended in multi-writer mode, see SetWriter
+	ErrNoClock = errors.New("blockchain: diverged block has no writer clock")
+	// ErrClockConflict is returned when two different blocks claim the same
+	// write, usually because two machines share a writer ID
+	ErrClockConflict = errors.New("blockchain: blocks claim the same write")
+)
+
+// SetWriter enables multi-writer mode. Blocks appended by Add, AddPayload and
+// the other appending methods are stamped with writer and a vector clock
+// recording every write the chain has seen, so diverged replicas can be
+// combined with Merge rather than one history replacing the other.
+func (b *Blockchain) SetWriter(writer string) {
+	b.writer = writer
+}
+
+// Clock returns a vector clock recording every write on the chain
+func (b *Blockchain) Clock() block.Clock {
+	clock := block.Clock{}
+	for i := range b.Blocks {
+		clock = clock.Merge(b.Blocks[i].Clock)
+	}
+	return clock
+}
+
+// stamp records the chain's writer and the next write's clock in blk and
+// rehashes it
+func (b *Blockchain) stamp(blk *block.Block) error {
+	blk.Writer = b.writer
+	blk.Clock = b.Clock().Tick(b.writer)
+	blk.BlockHash = nil
+	if _, err := blk.Hash(sha512.New()); err != nil {
+		return errors.Wrap(err, "blockchain: failed to hash stamped block")
+	}
+	return nil
+}
+
+// Merge combines two valid replicas of a multi-writer chain. Blocks after the
+// fork point are ordered by their vector clocks, which keeps every write after
+// the writes it has seen, with concurrent writes ordered by clock sum and then
+// writer ID. Blocks are relinked onto their new parents, dropping detached
+// signatures and anchors of relinked blocks as they no longer match. Any
+// replica merging the same writes arrives at the same chain.
+func Merge(ours, theirs *Blockchain) (*Blockchain, error) {
+	fork, err := FindFork(ours, theirs)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateFork(ours); err != nil {
+		return nil, errors.Wrap(err, "Merge: our chain is invalid")
+	}
+	if err := validateFork(theirs); err != nil {
+		return nil, errors.Wrap(err, "Merge: their chain is invalid")
+	}
+	if !fork.Diverged() {
+		if len(fork.Theirs) > 0 {
+			return Copy(theirs), nil
+		}
+		return Copy(ours), nil
+	}
+
+	writes := make(map[string]*block.Block)
+	var blocks []*block.Block
+	for _, diverged := range [][]block.Block{fork.Ours, fork.Theirs} {
+		for i := range diverged {
+			blk := &diverged[i]
+			if blk.Writer == "" {
+				return nil, errors.Wrapf(ErrNoClock, "block %d", blk.Index)
+			}
+			if blk.Pruned {
+				return nil, errors.Wrapf(ErrPrunedBlock, "block %d", blk.Index)
+			}
+			key := blk.Writer + "/" + strconv.FormatUint(blk.Clock[blk.Writer], 10)
+			if seen, ok := writes[key]; ok {
+				if !sameWrite(seen, blk) {
+					return nil, errors.Wrapf(ErrClockConflict, "write %s", key)
+				}
+				continue
+			}
+			writes[key] = blk
+			blocks = append(blocks, blk)
+		}
+	}
+	sort.Slice(blocks, func(i, j int) bool {
+		a, b := blocks[i], blocks[j]
+		if a.Clock.Sum() != b.Clock.Sum() {
+			return a.Clock.Sum() < b.Clock.Sum()
+		}
+		return a.Writer < b.Writer
+	})
+
+	merged := Copy(ours)
+	merged.Blocks = merged.Blocks[:fork.Index]
+	for _, blk := range blocks {
+		merged.Blocks = append(merged.Blocks, relink(blk, merged.At(merged.Length()-1)))
+	}
+	if err := validateFork(merged); err != nil {
+		return nil, errors.Wrap(err, "Merge: merged chain is invalid")
+	}
+	return merged, nil
+}
+
+// sameWrite returns true if a and b record the same write, regardless of
+// where in the chain they were linked
+func sameWrite(a, b *block.Block) bool {
+	return a.Timestamp == b.Timestamp && a.Nonce == b.Nonce &&
+		bytes.Equal(a.Data, b.Data) && bytes.Equal(a.RootHash, b.RootHash) &&
+		a.Clock.Compare(b.Clock) == block.ClockEqual
+}
+
+// relink returns a copy of blk linked to parent
+func relink(blk, parent *block.Block) block.Block {
+	linked := *blk
+	if linked.Index == parent.Index+1 && bytes.Equal(linked.ParentHash, parent.BlockHash) {
+		return linked
+	}
+	linked.Index = parent.Index + 1
+	linked.ParentHash = append([]byte{}, parent.BlockHash...)
+	linked.BlockHash = nil
+	linked.Signatures = nil
+	linked.Anchors = nil
+	linked.Hash(sha512.New())
+	return linked
+}
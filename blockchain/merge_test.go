@@ -0,0 +1,108 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockchain
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/govice/golinks/block"
+)
+
+func TestMerge(t *testing.T) {
+	alice, err := New(genesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice.SetWriter("alice")
+	if _, err := alice.AddPayload(block.MetadataPayload{"snapshot": "1"}); err != nil {
+		t.Fatal(err)
+	}
+	bob := Copy(alice)
+	bob.SetWriter("bob")
+	if _, err := alice.AddPayload(block.MetadataPayload{"snapshot": "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bob.AddPayload(block.MetadataPayload{"snapshot": "bob"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bob.AddPayload(block.MetadataPayload{"snapshot": "bob2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	//Both replicas arrive at the same chain holding every write
+	ab, err := Merge(alice, bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ba, err := Merge(bob, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Equal(ab, ba) || ab.Length() != 5 {
+		t.Fatal("expected merges to converge on all writes")
+	}
+	if ab.At(2).Writer != "alice" || ab.At(3).Writer != "bob" {
+		t.Error("expected concurrent writes ordered by writer")
+	}
+	clock := ab.Clock()
+	if clock["alice"] != 2 || clock["bob"] != 2 {
+		t.Error("unexpected merged clock", clock)
+	}
+
+	//Merging a merge with a stale replica changes nothing
+	again, err := Merge(bob, ab)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Equal(again, ab) {
+		t.Error("expected merge to be idempotent")
+	}
+
+	//New writes follow the writes the writer has seen
+	ab.SetWriter("alice")
+	blk, err := ab.AddPayload(block.MetadataPayload{"snapshot": "after"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blk.Clock.Compare(clock) != block.ClockAfter {
+		t.Error("expected new write after merged writes, got clock", blk.Clock)
+	}
+}
+
+func TestMergeErrors(t *testing.T) {
+	ours, err := New(genesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	theirs := Copy(ours)
+	ours.AddSHA512([]byte("ours"))
+	theirs.AddSHA512([]byte("theirs"))
+	if _, err := Merge(ours, theirs); !errors.Is(err, ErrNoClock) {
+		t.Error("expected no clock, got", err)
+	}
+
+	//Two machines sharing a writer ID write conflicting blocks
+	ours.Blocks, theirs.Blocks = ours.Blocks[:1], theirs.Blocks[:1]
+	ours.SetWriter("shared")
+	theirs.SetWriter("shared")
+	ours.AddPayload(block.MetadataPayload{"snapshot": "ours"})
+	theirs.AddPayload(block.MetadataPayload{"snapshot": "theirs"})
+	if _, err := Merge(ours, theirs); !errors.Is(err, ErrClockConflict) {
+		t.Error("expected clock conflict, got", err)
+	}
+}
@@ -0,0 +1,78 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/govice/golinks/block"
+	"github.com/govice/golinks/blockmap"
+	"github.com/pkg/errors"
+)
+
+// AddFile appends a new block notarizing the SHA512 hash of a single file,
+// such as a release binary
+func (b *Blockchain) AddFile(path string) (*block.Block, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "AddFile: failed to open file")
+	}
+	defer file.Close()
+	hash := sha512.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return nil, errors.Wrap(err, "AddFile: failed to hash file")
+	}
+	return b.AddPayload(block.FilePayload{
+		Name:      filepath.Base(path),
+		Size:      size,
+		Algorithm: "sha512",
+		Hash:      hash.Sum(nil),
+	})
+}
+
+// AddWithMerkleRoot appends a new block recording the root hash of a
+// generated blockmap along with the merkle root of its archive, so light
+// clients holding only block headers can verify file inclusion proofs
+func (b *Blockchain) AddWithMerkleRoot(blkmap *blockmap.BlockMap) (*block.Block, error) {
+	if blkmap.RootHash == nil {
+		return nil, errors.New("blockchain: can't add unhashed blockmap")
+	}
+	merkleRoot, err := blkmap.MerkleRoot()
+	if err != nil {
+		return nil, errors.Wrap(err, "AddWithMerkleRoot: failed to compute merkle root")
+	}
+	return b.AddPayload(block.LinkPayload{RootHash: blkmap.RootHash, MerkleRoot: merkleRoot})
+}
+
+// FindByFileHash returns the most recent block notarizing a file with hash
+func (b *Blockchain) FindByFileHash(hash []byte) *block.Block {
+	for i := b.Length() - 1; i >= 0; i-- {
+		payload, err := b.At(i).Payload()
+		if err != nil {
+			continue
+		}
+		if file, ok := payload.(*block.FilePayload); ok && bytes.Equal(file.Hash, hash) {
+			return b.At(i)
+		}
+	}
+	return nil
+}
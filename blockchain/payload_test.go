@@ -0,0 +1,61 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockchain
+
+import (
+	"crypto/sha512"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/govice/golinks/block"
+)
+
+func TestBlockchain_AddFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "notarize")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "golinks")
+	if err := ioutil.WriteFile(path, []byte("release"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	chain, err := Open(NewMemoryStore(), genesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blk, err := chain.AddFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chain.AddPayload(block.MetadataPayload{"release": "v1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.Validate(); err != nil {
+		t.Error(err)
+	}
+	hash := sha512.Sum512([]byte("release"))
+	if found := chain.FindByFileHash(hash[:]); found == nil || !block.Equal(found, blk) {
+		t.Error("failed to find notarized file")
+	}
+	if chain.FindByFileHash([]byte("other")) != nil {
+		t.Error("found file that wasn't notarized")
+	}
+}
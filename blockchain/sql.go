@@ -0,0 +1,262 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockchain
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/govice/golinks/block"
+	"github.com/govice/golinks/sqldb"
+	"github.com/pkg/errors"
+)
+
+// sqlMigrations is the schema of a SQLStore. Blocks are stored as JSON with
+// their hashes and timestamps in columns for querying.
+var sqlMigrations = []sqldb.Migration{
+	{Version: 1, Statements: []string{
+		`CREATE TABLE golinks_blocks (
+			idx BIGINT PRIMARY KEY,
+			hash {blob} NOT NULL UNIQUE,
+			parent_hash {blob} NOT NULL,
+			root_hash {blob},
+			block_time BIGINT NOT NULL,
+			block TEXT NOT NULL)`,
+		`CREATE INDEX golinks_blocks_root_hash ON golinks_blocks (root_hash)`,
+		`CREATE TABLE golinks_checkpoint (
+			id INTEGER PRIMARY KEY,
+			checkpoint TEXT NOT NULL)`,
+	}},
+}
+
+// SQLStore is a Store persisting blocks in a PostgreSQL or SQLite database,
+// so chains can be kept and queried alongside other operational data
+type SQLStore struct {
+	db      *sql.DB
+	dialect *sqldb.Dialect
+}
+
+// OpenSQLStore opens the database described by spec, see sqldb.Open, and
+// returns a store in it
+func OpenSQLStore(spec string) (*SQLStore, error) {
+	db, dialect, err := sqldb.Open(spec)
+	if err != nil {
+		return nil, err
+	}
+	store, err := NewSQLStore(db, dialect)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// NewSQLStore returns a store in db, migrating its schema. Closing the store
+// closes db.
+func NewSQLStore(db *sql.DB, dialect *sqldb.Dialect) (*SQLStore, error) {
+	if err := sqldb.Migrate(db, dialect, "blockchain", sqlMigrations); err != nil {
+		return nil, err
+	}
+	return &SQLStore{db: db, dialect: dialect}, nil
+}
+
+func (s *SQLStore) rebind(query string) string {
+	return s.dialect.Rebind(query)
+}
+
+// scanSQLBlock decodes the JSON block in row
+func scanSQLBlock(row *sql.Row) (*block.Block, error) {
+	var value string
+	if err := row.Scan(&value); err == sql.ErrNoRows {
+		return nil, ErrBlockNotFound
+	} else if err != nil {
+		return nil, errors.Wrap(err, "blockchain: failed to read block")
+	}
+	blk := &block.Block{}
+	if err := json.Unmarshal([]byte(value), blk); err != nil {
+		return nil, errors.Wrap(err, "blockchain: failed to decode stored block")
+	}
+	return blk, nil
+}
+
+// update runs fn in a transaction, committing if it succeeds
+func (s *SQLStore) update(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "blockchain: failed to begin transaction")
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return errors.Wrap(tx.Commit(), "blockchain: failed to commit transaction")
+}
+
+// putBlock replaces the stored JSON of blk
+func (s *SQLStore) putBlock(tx *sql.Tx, blk *block.Block) error {
+	value, err := json.Marshal(blk)
+	if err != nil {
+		return errors.Wrap(err, "blockchain: failed to encode block")
+	}
+	_, err = tx.Exec(s.rebind("UPDATE golinks_blocks SET block = ? WHERE idx = ?"), string(value), blk.Index)
+	return errors.Wrap(err, "blockchain: failed to store block")
+}
+
+// Append stores blk as the next block in the chain
+func (s *SQLStore) Append(blk *block.Block) error {
+	return s.update(func(tx *sql.Tx) error {
+		prev, err := scanSQLBlock(tx.QueryRow("SELECT block FROM golinks_blocks ORDER BY idx DESC LIMIT 1"))
+		if err == ErrBlockNotFound {
+			prev, err = nil, nil
+		}
+		if err != nil {
+			return err
+		}
+		height := 0
+		if prev != nil {
+			height = prev.Index + 1
+		}
+		if err := checkAppend(prev, blk, height); err != nil {
+			return err
+		}
+
+		value, err := json.Marshal(blk)
+		if err != nil {
+			return errors.Wrap(err, "blockchain: failed to encode block")
+		}
+		_, err = tx.Exec(s.rebind(`INSERT INTO golinks_blocks (idx, hash, parent_hash, root_hash, block_time, block)
+			VALUES (?, ?, ?, ?, ?, ?)`),
+			blk.Index, blk.BlockHash, append([]byte{}, blk.ParentHash...), blk.RootHash, blk.Timestamp, string(value))
+		return errors.Wrap(err, "blockchain: failed to store block")
+	})
+}
+
+// Attach replaces the detached signatures and anchors of the stored block
+// with blk's hash with those of blk
+func (s *SQLStore) Attach(blk *block.Block) error {
+	return s.update(func(tx *sql.Tx) error {
+		stored, err := scanSQLBlock(tx.QueryRow(s.rebind("SELECT block FROM golinks_blocks WHERE hash = ?"), blk.BlockHash))
+		if err != nil {
+			return err
+		}
+		attach(stored, blk)
+		return s.putBlock(tx, stored)
+	})
+}
+
+// Prune drops the data of stored blocks between the genesis block and the
+// checkpointed block and records cp as the latest checkpoint
+func (s *SQLStore) Prune(cp *Checkpoint) error {
+	return s.update(func(tx *sql.Tx) error {
+		if _, err := scanSQLBlock(tx.QueryRow(s.rebind("SELECT block FROM golinks_blocks WHERE idx = ?"), cp.Index)); err != nil {
+			return err
+		}
+		for i := 1; i < cp.Index; i++ {
+			blk, err := scanSQLBlock(tx.QueryRow(s.rebind("SELECT block FROM golinks_blocks WHERE idx = ?"), i))
+			if err != nil {
+				return err
+			}
+			if blk.Pruned {
+				continue
+			}
+			prune(blk)
+			if err := s.putBlock(tx, blk); err != nil {
+				return err
+			}
+		}
+
+		value, err := json.Marshal(cp)
+		if err != nil {
+			return errors.Wrap(err, "blockchain: failed to encode checkpoint")
+		}
+		if _, err := tx.Exec("DELETE FROM golinks_checkpoint"); err != nil {
+			return errors.Wrap(err, "blockchain: failed to store checkpoint")
+		}
+		_, err = tx.Exec(s.rebind("INSERT INTO golinks_checkpoint (id, checkpoint) VALUES (1, ?)"), string(value))
+		return errors.Wrap(err, "blockchain: failed to store checkpoint")
+	})
+}
+
+// Checkpoint returns the latest recorded checkpoint, or nil if there is none
+func (s *SQLStore) Checkpoint() (*Checkpoint, error) {
+	var value string
+	err := s.db.QueryRow("SELECT checkpoint FROM golinks_checkpoint WHERE id = 1").Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "blockchain: failed to read checkpoint")
+	}
+	cp := &Checkpoint{}
+	return cp, errors.Wrap(json.Unmarshal([]byte(value), cp), "blockchain: failed to decode checkpoint")
+}
+
+// Truncate removes the stored blocks from index height onward
+func (s *SQLStore) Truncate(height int) error {
+	_, err := s.db.Exec(s.rebind("DELETE FROM golinks_blocks WHERE idx >= ?"), height)
+	return errors.Wrap(err, "blockchain: failed to truncate blocks")
+}
+
+// Height returns the number of stored blocks
+func (s *SQLStore) Height() (int, error) {
+	var height int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM golinks_blocks").Scan(&height)
+	return height, errors.Wrap(err, "blockchain: failed to read chain height")
+}
+
+// BlockAt returns the block at index
+func (s *SQLStore) BlockAt(index int) (*block.Block, error) {
+	return scanSQLBlock(s.db.QueryRow(s.rebind("SELECT block FROM golinks_blocks WHERE idx = ?"), index))
+}
+
+// BlockByHash returns the block with the given block hash
+func (s *SQLStore) BlockByHash(hash []byte) (*block.Block, error) {
+	return scanSQLBlock(s.db.QueryRow(s.rebind("SELECT block FROM golinks_blocks WHERE hash = ?"), hash))
+}
+
+// BlocksByRootHash returns the blocks recording a link with the given root
+// hash, oldest first
+func (s *SQLStore) BlocksByRootHash(hash []byte) ([]*block.Block, error) {
+	rows, err := s.db.Query(s.rebind("SELECT block FROM golinks_blocks WHERE root_hash = ? ORDER BY idx"), hash)
+	if err != nil {
+		return nil, errors.Wrap(err, "blockchain: failed to query blocks")
+	}
+	defer rows.Close()
+	var blocks []*block.Block
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, errors.Wrap(err, "blockchain: failed to read block")
+		}
+		blk := &block.Block{}
+		if err := json.Unmarshal([]byte(value), blk); err != nil {
+			return nil, errors.Wrap(err, "blockchain: failed to decode stored block")
+		}
+		blocks = append(blocks, blk)
+	}
+	return blocks, errors.Wrap(rows.Err(), "blockchain: failed to query blocks")
+}
+
+// Iterator returns an iterator over the blocks starting at index
+func (s *SQLStore) Iterator(index int) Iterator {
+	return &storeIterator{store: s, next: index}
+}
+
+// Close closes the underlying database
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
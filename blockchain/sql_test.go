@@ -0,0 +1,94 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockchain
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/govice/golinks/block"
+)
+
+func TestSQLStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqlstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	spec := "sqlite3:" + filepath.Join(dir, "chain.sqlite")
+
+	store, err := OpenSQLStore(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, err := Open(store, genesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := []byte("root hash")
+	for i := 0; i < 3; i++ {
+		blk, err := block.NewSHA512Link(chain.Length(), root, chain.At(chain.Length()-1).BlockHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := chain.append(context.Background(), blk); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	blocks, err := store.BlocksByRootHash(root)
+	if err != nil || len(blocks) != 3 || blocks[0].Index != 1 {
+		t.Error("expected the blocks recording root, got", len(blocks), err)
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp, err := chain.NewCheckpoint(3, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.Prune(cp); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	//Reopening skips applied migrations and restores the pruned chain
+	store, err = OpenSQLStore(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	reopened, err := Open(store, genesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Equal(reopened, chain) || reopened.Checkpoint == nil || !reopened.At(1).Pruned {
+		t.Error("expected reopened chain to match the pruned chain")
+	}
+	if err := reopened.Validate(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,289 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockchain
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/govice/golinks/block"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrBlockNotFound is returned when a store has no block for a lookup
+	ErrBlockNotFound = errors.New("blockchain: block not found")
+	// ErrBlockOutOfOrder is returned when a stored block doesn't extend the chain
+	ErrBlockOutOfOrder = errors.New("blockchain: block does not extend stored chain")
+)
+
+// Store persists the blocks of a chain. Blocks are append only and must be
+// added in index order, each extending the previously stored block.
+type Store interface {
+	// Append stores blk as the next block in the chain
+	Append(blk *block.Block) error
+	// Attach replaces the detached signatures and anchors of the stored block
+	// with blk's hash with those of blk
+	Attach(blk *block.Block) error
+	// Prune drops the data of stored blocks between the genesis block and
+	// the checkpointed block and records cp as the latest checkpoint
+	Prune(cp *Checkpoint) error
+	// Checkpoint returns the latest recorded checkpoint, or nil if there is none
+	Checkpoint() (*Checkpoint, error)
+	// Truncate removes the stored blocks from index height onward
+	Truncate(height int) error
+	// Height returns the number of stored blocks
+	Height() (int, error)
+	// BlockAt returns the block at index
+	BlockAt(index int) (*block.Block, error)
+	// BlockByHash returns the block with the given block hash
+	BlockByHash(hash []byte) (*block.Block, error)
+	// Iterator returns an iterator over the blocks starting at index
+	Iterator(index int) Iterator
+	// Close releases resources held by the store
+	Close() error
+}
+
+// Iterator walks stored blocks in index order
+type Iterator interface {
+	// Next advances to the next block, returning false when done or on error
+	Next() bool
+	// Block returns the current block
+	Block() *block.Block
+	// Err returns the first error encountered while iterating
+	Err() error
+}
+
+// Open loads the chain held in store. An empty store is initialized with
+// genesisBlock. The returned chain writes new blocks through to store.
+func Open(store Store, genesisBlock *block.Block) (*Blockchain, error) {
+	height, err := store.Height()
+	if err != nil {
+		return nil, errors.Wrap(err, "Open: failed to read chain height")
+	}
+	if height == 0 {
+		if len(genesisBlock.ParentHash) != 0 {
+			return nil, ErrInvalidGenesisBlock
+		}
+		if err := store.Append(genesisBlock); err != nil {
+			return nil, errors.Wrap(err, "Open: failed to store genesis block")
+		}
+	}
+
+	checkpoint, err := store.Checkpoint()
+	if err != nil {
+		return nil, errors.Wrap(err, "Open: failed to read checkpoint")
+	}
+	chain := &Blockchain{Checkpoint: checkpoint, store: store}
+	iter := store.Iterator(0)
+	for iter.Next() {
+		chain.Blocks = append(chain.Blocks, *iter.Block())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, errors.Wrap(err, "Open: failed to load chain")
+	}
+	return chain, nil
+}
+
+// Sync appends any blocks not yet persisted to the chain's store
+func (b *Blockchain) Sync() error {
+	if b.store == nil {
+		return nil
+	}
+	height, err := b.store.Height()
+	if err != nil {
+		return errors.Wrap(err, "Sync: failed to read chain height")
+	}
+	for i := height; i < b.Length(); i++ {
+		if err := b.store.Append(b.At(i)); err != nil {
+			return errors.Wrapf(err, "Sync: failed to store block %d", i)
+		}
+	}
+	return nil
+}
+
+// checkAppend verifies blk extends prev, which is nil for an empty store
+func checkAppend(prev, blk *block.Block, height int) error {
+	if blk.Index != height {
+		return ErrBlockOutOfOrder
+	}
+	if prev == nil {
+		if len(blk.ParentHash) != 0 {
+			return ErrInvalidGenesisBlock
+		}
+		return nil
+	}
+	if !bytes.Equal(prev.BlockHash, blk.ParentHash) {
+		return ErrBlockOutOfOrder
+	}
+	return nil
+}
+
+// MemoryStore is a Store held in memory, useful for tests and ephemeral chains
+type MemoryStore struct {
+	mu         sync.RWMutex
+	blocks     []block.Block
+	checkpoint *Checkpoint
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// Append stores blk as the next block in the chain
+func (m *MemoryStore) Append(blk *block.Block) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var prev *block.Block
+	if len(m.blocks) > 0 {
+		prev = &m.blocks[len(m.blocks)-1]
+	}
+	if err := checkAppend(prev, blk, len(m.blocks)); err != nil {
+		return err
+	}
+	m.blocks = append(m.blocks, *blk)
+	return nil
+}
+
+// Attach replaces the detached signatures and anchors of the stored block
+// with blk's hash with those of blk
+func (m *MemoryStore) Attach(blk *block.Block) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.blocks {
+		if bytes.Equal(m.blocks[i].BlockHash, blk.BlockHash) {
+			attach(&m.blocks[i], blk)
+			return nil
+		}
+	}
+	return ErrBlockNotFound
+}
+
+// Prune drops the data of stored blocks between the genesis block and the
+// checkpointed block and records cp as the latest checkpoint
+func (m *MemoryStore) Prune(cp *Checkpoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if cp.Index >= len(m.blocks) {
+		return ErrBlockNotFound
+	}
+	for i := 1; i < cp.Index; i++ {
+		prune(&m.blocks[i])
+	}
+	m.checkpoint = cp
+	return nil
+}
+
+// Checkpoint returns the latest recorded checkpoint, or nil if there is none
+func (m *MemoryStore) Checkpoint() (*Checkpoint, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.checkpoint, nil
+}
+
+// Truncate removes the stored blocks from index height onward
+func (m *MemoryStore) Truncate(height int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if height < len(m.blocks) {
+		m.blocks = m.blocks[:height]
+	}
+	return nil
+}
+
+// attach copies the detached fields of src onto dst
+func attach(dst, src *block.Block) {
+	dst.Signatures = append([]block.Signature(nil), src.Signatures...)
+	dst.Anchors = append([]block.Anchor(nil), src.Anchors...)
+}
+
+// Height returns the number of stored blocks
+func (m *MemoryStore) Height() (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.blocks), nil
+}
+
+// BlockAt returns the block at index
+func (m *MemoryStore) BlockAt(index int) (*block.Block, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if index < 0 || index >= len(m.blocks) {
+		return nil, ErrBlockNotFound
+	}
+	blk := m.blocks[index]
+	return &blk, nil
+}
+
+// BlockByHash returns the block with the given block hash
+func (m *MemoryStore) BlockByHash(hash []byte) (*block.Block, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, blk := range m.blocks {
+		if bytes.Equal(blk.BlockHash, hash) {
+			return &blk, nil
+		}
+	}
+	return nil, ErrBlockNotFound
+}
+
+// Iterator returns an iterator over the blocks starting at index
+func (m *MemoryStore) Iterator(index int) Iterator {
+	return &storeIterator{store: m, next: index}
+}
+
+// Close releases resources held by the store
+func (m *MemoryStore) Close() error {
+	return nil
+}
+
+// storeIterator iterates any Store by looking up successive indexes
+type storeIterator struct {
+	store   Store
+	next    int
+	current *block.Block
+	err     error
+}
+
+func (it *storeIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	height, err := it.store.Height()
+	if err != nil {
+		it.err = err
+		return false
+	}
+	if it.next >= height {
+		return false
+	}
+	it.current, it.err = it.store.BlockAt(it.next)
+	if it.err != nil {
+		return false
+	}
+	it.next++
+	return true
+}
+
+func (it *storeIterator) Block() *block.Block {
+	return it.current
+}
+
+func (it *storeIterator) Err() error {
+	return it.err
+}
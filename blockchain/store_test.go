@@ -0,0 +1,173 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockchain
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/govice/golinks/block"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	stores := map[string]func() (Store, error){
+		"memory": func() (Store, error) { return NewMemoryStore(), nil },
+		"bolt":   func() (Store, error) { return OpenBoltStore(filepath.Join(dir, "chain.db")) },
+		"sql":    func() (Store, error) { return OpenSQLStore("sqlite3:" + filepath.Join(dir, "chain.sqlite")) },
+	}
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			store, err := open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+
+			chain, err := Open(store, genesisBlock)
+			if err != nil {
+				t.Fatal(err)
+			}
+			chain.AddSHA512([]byte("first"))
+			if err := chain.Sync(); err != nil {
+				t.Fatal(err)
+			}
+			chain.AddSHA512([]byte("second"))
+			if err := chain.Sync(); err != nil {
+				t.Fatal(err)
+			}
+
+			if height, err := store.Height(); err != nil || height != 3 {
+				t.Errorf("expected height 3, got %d %v", height, err)
+			}
+
+			blk, err := store.BlockAt(1)
+			if err != nil || !block.Equal(blk, chain.At(1)) {
+				t.Error("failed to look up block by height", err)
+			}
+			blk, err = store.BlockByHash(chain.At(2).BlockHash)
+			if err != nil || !block.Equal(blk, chain.At(2)) {
+				t.Error("failed to look up block by hash", err)
+			}
+			if _, err := store.BlockByHash([]byte("garbage")); !errors.Is(err, ErrBlockNotFound) {
+				t.Error("expected missing block, got", err)
+			}
+			if _, err := store.BlockAt(10); !errors.Is(err, ErrBlockNotFound) {
+				t.Error("expected missing block, got", err)
+			}
+
+			iter := store.Iterator(1)
+			count := 0
+			for iter.Next() {
+				if !block.Equal(iter.Block(), chain.At(count+1)) {
+					t.Error("iterator returned unexpected block at", count+1)
+				}
+				count++
+			}
+			if iter.Err() != nil || count != 2 {
+				t.Errorf("expected 2 iterated blocks, got %d %v", count, iter.Err())
+			}
+
+			//Blocks that don't extend the stored chain are rejected
+			stray := block.NewSHA512(3, []byte("stray"), []byte("garbage"))
+			if err := store.Append(stray); !errors.Is(err, ErrBlockOutOfOrder) {
+				t.Error("expected out of order error, got", err)
+			}
+			skipped := block.NewSHA512(5, []byte("skipped"), chain.At(2).BlockHash)
+			if err := store.Append(skipped); !errors.Is(err, ErrBlockOutOfOrder) {
+				t.Error("expected out of order error, got", err)
+			}
+
+			//Detached anchors can be attached to stored blocks
+			anchored := *chain.At(1)
+			anchored.Anchors = []block.Anchor{{Type: block.RFC3161, Authority: "tsa", Proof: []byte("token")}}
+			if err := store.Attach(&anchored); err != nil {
+				t.Fatal(err)
+			}
+			if blk, err := store.BlockAt(1); err != nil || len(blk.Anchors) != 1 || blk.VerifySHA512() != nil {
+				t.Error("failed to attach anchor", err)
+			}
+			if err := store.Attach(stray); !errors.Is(err, ErrBlockNotFound) {
+				t.Error("expected missing block, got", err)
+			}
+
+			//Truncated blocks can be replaced
+			if err := store.Truncate(2); err != nil {
+				t.Fatal(err)
+			}
+			if height, err := store.Height(); err != nil || height != 2 {
+				t.Errorf("expected height 2, got %d %v", height, err)
+			}
+			if _, err := store.BlockByHash(chain.At(2).BlockHash); !errors.Is(err, ErrBlockNotFound) {
+				t.Error("expected truncated block to be missing, got", err)
+			}
+			if err := store.Append(chain.At(2)); err != nil {
+				t.Error("failed to append after truncating", err)
+			}
+		})
+	}
+}
+
+func TestOpen_Reopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "chain.db")
+
+	store, err := OpenBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, err := Open(store, genesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.AddSHA512([]byte("persisted"))
+	if err := chain.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = OpenBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	reopened, err := Open(store, genesisBlock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Equal(chain, reopened) {
+		t.Error("reopened chain does not match persisted chain")
+	}
+	if err := reopened.Validate(); err != nil {
+		t.Error(err)
+	}
+}
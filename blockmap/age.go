@@ -0,0 +1,95 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+
+	"github.com/govice/golinks/age"
+	"github.com/govice/golinks/codec"
+	"github.com/pkg/errors"
+)
+
+// SaveAge stores the blockmap in the default OutputFile encrypted to one or
+// more age recipients, X25519 age1... keys or SSH keys, so each recipient can
+// load it with their own identity. The file is a standard age file holding
+// the JSON link.
+func (b BlockMap) SaveAge(path string, recipients ...age.Recipient) error {
+	if b.RootHash == nil {
+		return ErrUnhashed
+	}
+
+	plaintext, err := codec.Encode(codec.JSON, b)
+	if err != nil {
+		return errors.Wrap(err, "blockmap: failed to encode link json")
+	}
+
+	var sealed bytes.Buffer
+	w, err := age.Encrypt(&sealed, recipients...)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	linkFilePath := path + string(os.PathSeparator) + OutputName
+	return b.audited(linkFilePath, func() error {
+		return writeLink(linkFilePath, 0600, b.backups, writeBytes(sealed.Bytes()))
+	})
+}
+
+// LoadAge reads a blockmap saved with SaveAge from the default OutputFile
+// with any identity that is one of its recipients. Links no identity can
+// decrypt return age.ErrNoIdentityMatch.
+func (b *BlockMap) LoadAge(path string, identities ...age.Identity) error {
+	linkFilePath := path + string(os.PathSeparator) + OutputName
+	data, err := ioutil.ReadFile(linkFilePath)
+	if err != nil {
+		return &PathError{Op: "read", Path: linkFilePath, Err: err}
+	}
+	if !age.IsEncrypted(data) {
+		return ErrNotEncrypted
+	}
+
+	r, err := age.Decrypt(bytes.NewReader(data), identities...)
+	if err != nil {
+		return err
+	}
+	plaintext, err := ioutil.ReadAll(r)
+	if err != nil {
+		return &PathError{Op: "decrypt", Path: linkFilePath, Err: err}
+	}
+	if err := b.Decode(plaintext); err != nil {
+		return &PathError{Op: "decode", Path: linkFilePath, Err: err}
+	}
+	return nil
+}
+
+// isSealedLink returns true if data is a link encrypted with a passphrase or
+// to age recipients
+func isSealedLink(data []byte) bool {
+	return isEncryptedLink(data) || age.IsEncrypted(data)
+}
+
+// sealedPrefixLen is the number of bytes isSealedLink needs
+const sealedPrefixLen = len(age.Intro)
@@ -0,0 +1,89 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/govice/golinks/age"
+)
+
+func TestBlockMap_SaveAge(t *testing.T) {
+	root, err := ioutil.TempDir(tmpDir, "age")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	if err := ioutil.WriteFile(filepath.Join(root, "secret-name"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b := New(root)
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+
+	alice, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SaveAge(root, alice.Recipient(), bob.Recipient()); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(root, OutputName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("secret-name")) {
+		t.Error("encrypted link leaks archive paths")
+	}
+
+	for _, id := range []*age.X25519Identity{alice, bob} {
+		loaded := New(root)
+		if err := loaded.LoadAge(root, id); err != nil {
+			t.Fatal(err)
+		}
+		if !Equal(b, loaded) {
+			t.Error("failed to reload age encrypted blockmap")
+		}
+	}
+
+	mallory, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := New(root).LoadAge(root, mallory); !errors.Is(err, age.ErrNoIdentityMatch) {
+		t.Error("expected no identity match, got", err)
+	}
+	if err := New(root).Load(root); !errors.Is(err, ErrEncryptedLink) {
+		t.Error("expected encrypted link error loading without identity, got", err)
+	}
+	if err := New(root).LoadEncrypted(root, []byte("passphrase")); !errors.Is(err, ErrNotEncrypted) {
+		t.Error("expected passphrase decryption to reject age links, got", err)
+	}
+}
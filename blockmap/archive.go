@@ -0,0 +1,194 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	pathpkg "path"
+	"strings"
+
+	"github.com/govice/golinks/archivemap"
+	"github.com/pkg/errors"
+)
+
+// gzipMagic starts every gzip stream
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// FromTar returns a blockmap of the regular files in a tar stream, which may
+// be gzip compressed, without extracting it. Member names are cleaned of
+// leading "./" and "/" so a tarball of a directory's contents matches the
+// directory's own blockmap, and are normalized like the keys of a generated
+// blockmap. Hard links share their target's hash and other
+// special members are recorded as skipped.
+func FromTar(r io.Reader) (*BlockMap, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(len(gzipMagic)); bytes.Equal(magic, gzipMagic) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, errors.Wrap(err, "blockmap: failed to decompress tar")
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = br
+	}
+
+	b := New("")
+	keys := make(map[string]string)
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrap(err, "blockmap: failed to read tar")
+		}
+
+		name, ok := archiveMemberName(header.Name)
+		if !ok {
+			continue
+		}
+		switch header.Typeflag {
+		case tar.TypeReg:
+			if err := b.addMember(name, keys, header.FileInfo(), tr); err != nil {
+				return nil, err
+			}
+		case tar.TypeLink:
+			target, _ := archiveMemberName(header.Linkname)
+			if hash, ok := b.Archive[b.normalizeKey(target)]; ok {
+				key, err := b.memberKey(name, keys)
+				if err != nil {
+					return nil, err
+				}
+				b.Archive[key] = hash
+				b.Entries[key] = b.memberEntry(name, key, header.FileInfo())
+			} else {
+				b.skip(name, SkipIrregular, errors.New("hard link to unknown member "+header.Linkname))
+			}
+		case tar.TypeDir:
+		default:
+			b.skip(name, modeSkipReason(header.FileInfo().Mode()), nil)
+		}
+	}
+
+	if err := b.hashBlockMap(); err != nil {
+		return nil, errors.Wrap(err, "blockmap: failed to generate block map")
+	}
+	return b, nil
+}
+
+// FromZip returns a blockmap of the regular files in the zip archive at
+// path without extracting it. Member names are cleaned as in FromTar.
+func FromZip(path string) (*BlockMap, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, &PathError{Op: "open zip", Path: path, Err: err}
+	}
+	defer zr.Close()
+
+	b := New("")
+	keys := make(map[string]string)
+	for _, file := range zr.File {
+		name, ok := archiveMemberName(file.Name)
+		if !ok {
+			continue
+		}
+		info := file.FileInfo()
+		if info.IsDir() {
+			continue
+		}
+		if !info.Mode().IsRegular() {
+			b.skip(name, modeSkipReason(info.Mode()), nil)
+			continue
+		}
+
+		rc, err := file.Open()
+		if err != nil {
+			return nil, &PathError{Op: "open zip member", Path: file.Name, Err: err}
+		}
+		err = b.addMember(name, keys, info, rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := b.hashBlockMap(); err != nil {
+		return nil, errors.Wrap(err, "blockmap: failed to generate block map")
+	}
+	return b, nil
+}
+
+// addMember hashes an archive member's contents into the archive
+func (b *BlockMap) addMember(name string, keys map[string]string, info os.FileInfo, r io.Reader) error {
+	key, err := b.memberKey(name, keys)
+	if err != nil {
+		return err
+	}
+	hasher, err := b.hasher()
+	if err != nil {
+		return err
+	}
+	hash, err := hasher.HashReader(r)
+	if err != nil {
+		return &PathError{Op: "hash member", Path: name, Err: err}
+	}
+	if hash, err = b.encodeHash(hash); err != nil {
+		return err
+	}
+	b.Archive[key] = hash
+	b.Entries[key] = b.memberEntry(name, key, info)
+	return nil
+}
+
+// memberKey normalizes an archive member name into its key, failing if
+// another member normalizes to the same key. keys maps the keys seen so far
+// to their member names; members repeating a name replace the earlier one.
+func (b *BlockMap) memberKey(name string, keys map[string]string) (string, error) {
+	key := b.normalizeKey(name)
+	if other, ok := keys[key]; ok && other != name {
+		return "", &PathError{Op: "normalize", Path: name, Err: errors.Wrap(ErrKeyCollision, other)}
+	}
+	keys[key] = name
+	return key, nil
+}
+
+// memberEntry returns the entry of a member, recording its name when
+// normalization changed it
+func (b *BlockMap) memberEntry(name, key string, info os.FileInfo) archivemap.Entry {
+	entry := b.newEntry(info)
+	if key != name {
+		entry.Name = name
+	}
+	return entry
+}
+
+// archiveMemberName cleans an archive member name into an archive key,
+// returning false for the archive root and files generated by this library
+func archiveMemberName(name string) (string, bool) {
+	name = strings.TrimPrefix(pathpkg.Clean("/"+name), "/")
+	if name == "" || generatedFile(name) {
+		return "", false
+	}
+	return name, true
+}
@@ -0,0 +1,196 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"testing/fstest"
+)
+
+var archiveTestFS = fstest.MapFS{
+	"a":         &fstest.MapFile{Data: []byte("alpha")},
+	"dir/b":     &fstest.MapFile{Data: []byte("bravo")},
+	"dir/sub/c": &fstest.MapFile{Data: []byte("charlie")},
+	"link":      &fstest.MapFile{Data: []byte("alpha")},
+}
+
+func archiveTestExpected(t *testing.T) *BlockMap {
+	expected := NewFS(archiveTestFS)
+	if err := expected.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	return expected
+}
+
+func TestFromTar(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	write := func(header *tar.Header, data string) {
+		header.Size = int64(len(data))
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(&tar.Header{Name: "./", Typeflag: tar.TypeDir, Mode: 0755}, "")
+	write(&tar.Header{Name: "./a", Typeflag: tar.TypeReg, Mode: 0644}, "alpha")
+	write(&tar.Header{Name: "./dir/", Typeflag: tar.TypeDir, Mode: 0755}, "")
+	write(&tar.Header{Name: "./dir/b", Typeflag: tar.TypeReg, Mode: 0644}, "bravo")
+	write(&tar.Header{Name: "dir/sub/c", Typeflag: tar.TypeReg, Mode: 0644}, "charlie")
+	write(&tar.Header{Name: "./link", Typeflag: tar.TypeLink, Linkname: "./a"}, "")
+	write(&tar.Header{Name: "./symlink", Typeflag: tar.TypeSymlink, Linkname: "a"}, "")
+	write(&tar.Header{Name: "./" + OutputName, Typeflag: tar.TypeReg, Mode: 0644}, "{}")
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := FromTar(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := archiveTestExpected(t); !Equal(b, expected) {
+		t.Errorf("tar blockmap %v does not match %v", b.Archive, expected.Archive)
+	}
+	if expected := []SkippedPath{{Path: "symlink", Reason: SkipSymlink}}; !reflect.DeepEqual(b.Skipped(), expected) {
+		t.Errorf("expected skipped %v, got %v", expected, b.Skipped())
+	}
+	if b.Entries["dir/b"].Size != 5 {
+		t.Error("expected member metadata to be recorded")
+	}
+
+	if _, err := FromTar(bytes.NewReader([]byte("not a tar"))); err == nil {
+		t.Error("expected an error reading an invalid tar")
+	}
+}
+
+func TestFromZip(t *testing.T) {
+	path := filepath.Join(tmpDir, "archive.zip")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+	zw := zip.NewWriter(f)
+	names := make([]string, 0, len(archiveTestFS))
+	for name := range archiveTestFS {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range append([]string{"dir/"}, names...) {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if file, ok := archiveTestFS[name]; ok {
+			w.Write(file.Data)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	b, err := FromZip(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := archiveTestExpected(t); !Equal(b, expected) {
+		t.Errorf("zip blockmap %v does not match %v", b.Archive, expected.Archive)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("not a zip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FromZip(path); err == nil {
+		t.Error("expected an error reading an invalid zip")
+	}
+}
+
+func TestFromTar_Normalization(t *testing.T) {
+	const nfc, nfd = "caf\u00e9", "cafe\u0301"
+	tarball := func(members ...*tar.Header) *bytes.Buffer {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, header := range members {
+			if err := tw.WriteHeader(header); err != nil {
+				t.Fatal(err)
+			}
+			if header.Typeflag == tar.TypeReg {
+				tw.Write([]byte("a"))
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return &buf
+	}
+	member := func(name string) *tar.Header {
+		return &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: 1}
+	}
+
+	b, err := FromTar(tarball(member(nfd), &tar.Header{Name: "link", Typeflag: tar.TypeLink, Linkname: nfd}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.Archive[nfc]; !ok || b.Entries[nfc].Name != nfd {
+		t.Fatalf("expected an NFC key recording the member name %v", b.Entries)
+	}
+	if _, ok := b.Archive["link"]; !ok {
+		t.Errorf("expected the hard link to find its normalized target %v", b.Archive)
+	}
+
+	root, err := ioutil.TempDir(tmpDir, "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for _, name := range []string{nfd, "link"} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte("a"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := New(root)
+	if err := expected.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if !Equal(b, expected) {
+		t.Errorf("tar blockmap %v does not match %v", b.Archive, expected.Archive)
+	}
+
+	if _, err := FromTar(tarball(member(nfc), member(nfd))); !errors.Is(err, ErrKeyCollision) {
+		t.Errorf("expected key collision, got %v", err)
+	}
+	if _, err := FromTar(tarball(member(nfd), member(nfd))); err != nil {
+		t.Errorf("expected repeated members to replace each other, got %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/govice/golinks/audit"
+)
+
+// SetAuditLog records every save of the blockmap's link in l, with the root
+// hash of the link it replaced. A nil log disables auditing.
+func (b *BlockMap) SetAuditLog(l *audit.Log) {
+	b.auditLog = l
+}
+
+// audited calls save, which writes the link at linkFilePath, recording the
+// save in the audit log if one is set
+func (b BlockMap) audited(linkFilePath string, save func() error) error {
+	if b.auditLog == nil {
+		return save()
+	}
+	prevRootHash := savedRootHash(linkFilePath)
+	if err := save(); err != nil {
+		return err
+	}
+	if abs, err := filepath.Abs(linkFilePath); err == nil {
+		linkFilePath = abs
+	}
+	_, err := b.auditLog.Record(context.Background(), audit.OpSave, linkFilePath, prevRootHash, b.RootHash)
+	return err
+}
+
+// savedRootHash returns the root hash of the link at linkFilePath, or nil if
+// there is none or it is encrypted
+func savedRootHash(linkFilePath string) []byte {
+	data, err := ioutil.ReadFile(linkFilePath)
+	if err != nil || isSealedLink(data) {
+		return nil
+	}
+	saved := New("")
+	if err := saved.Decode(data); err != nil {
+		return nil
+	}
+	return saved.RootHash
+}
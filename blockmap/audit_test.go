@@ -0,0 +1,68 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/govice/golinks/archivemap"
+	"github.com/govice/golinks/audit"
+)
+
+func TestBlockMap_SetAuditLog(t *testing.T) {
+	dir, err := ioutil.TempDir(tmpDir, "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	l, err := audit.Open(filepath.Join(dir, "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	b := New(dir, WithAuditLog(l))
+	var rootHashes [][]byte
+	for _, content := range []string{"1", "2"} {
+		b.Archive = archivemap.ArchiveMap{"a": []byte(content)}
+		if err := b.hashBlockMap(); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Save(dir); err != nil {
+			t.Fatal(err)
+		}
+		rootHashes = append(rootHashes, b.RootHash)
+	}
+
+	entries, err := l.Entries(audit.Filter{Operation: audit.OpSave})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[1].Target != filepath.Join(dir, OutputName) {
+		t.Fatalf("expected two saves, got %+v", entries)
+	}
+	if entries[0].PrevRootHash != nil || !bytes.Equal(entries[0].NewRootHash, rootHashes[0]) {
+		t.Errorf("unexpected first save %+v", entries[0])
+	}
+	if !bytes.Equal(entries[1].PrevRootHash, rootHashes[0]) || !bytes.Equal(entries[1].NewRootHash, rootHashes[1]) {
+		t.Errorf("unexpected second save %+v", entries[1])
+	}
+}
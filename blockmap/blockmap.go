@@ -17,22 +17,33 @@
 package blockmap
 
 import (
+	"context"
+	"io"
 	"io/ioutil"
-	"log"
 	"path/filepath"
-	"reflect"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/govice/golinks/archivemap"
+	"github.com/govice/golinks/audit"
+	"github.com/govice/golinks/codec"
 
 	"github.com/govice/golinks/fs"
+	"github.com/govice/golinks/ignore"
+	"github.com/govice/golinks/logging"
+	"github.com/govice/golinks/sigstore"
+	"github.com/govice/golinks/tlog"
 	"github.com/govice/golinks/walker"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
-	"bytes"
+	"crypto"
+	"crypto/hmac"
 	"crypto/sha512"
-
-	"encoding/json"
+	iofs "io/fs"
 
 	"fmt"
 
@@ -42,93 +53,383 @@ import (
 //OutputName stores the default file name archive metadata
 const OutputName string = ".link"
 
-//BlockMap is a ad-hoc Merkle tree-map
-type BlockMap struct {
-	Archive     archivemap.ArchiveMap `json:"archive"`
-	RootHash    []byte                `json:"rootHash"`
-	Root        string                `json:"root"`
-	IgnorePaths []string              `json:"ignorePaths"`
-	AutoIgnore  bool                  `json:"autoIgnore"`
-}
+//SignatureName stores the default file name of detached OpenPGP signatures
+const SignatureName string = OutputName + ".asc"
 
-type IgnoredPathErr struct {
-	Paths []string
+// generatedFile returns true for the files this library writes into a root:
+// the default and named links saved by Save and SaveNamed, their signatures
+// and backups, and the temporary files links are written to
+func generatedFile(relPath string) bool {
+	if strings.ContainsAny(relPath, "/"+string(filepath.Separator)) {
+		return false
+	}
+	i := strings.LastIndex(relPath, OutputName)
+	if i < 0 {
+		return false
+	}
+	suffix := relPath[i+len(OutputName):]
+	if suffix == "" || suffix == ".asc" {
+		return true
+	}
+	if !strings.HasPrefix(suffix, ".") {
+		return false
+	}
+	suffix = strings.TrimPrefix(suffix, ".")
+	if strings.HasPrefix(suffix, "tmp") {
+		return true
+	}
+	n, err := strconv.Atoi(suffix)
+	return err == nil && n > 0 && strconv.Itoa(n) == suffix
 }
 
-func (ip *IgnoredPathErr) Error() string { return strings.Join(ip.Paths, " ,") }
+// CurrentSchemaVersion is the version of the .link format written by this package.
+// Version 0 files predate per-entry metadata.
+const CurrentSchemaVersion int = 1
+
+// IgnoreFileName is the file in the archive root holding ignore patterns
+const IgnoreFileName string = ".linkignore"
 
-//New returns a new BlockMap initialized at the provided root
-func New(root string) *BlockMap {
+//BlockMap is a ad-hoc Merkle tree-map
+type BlockMap struct {
+	SchemaVersion     int                   `json:"schemaVersion"`
+	Bloom             *BloomFilter          `json:"bloom,omitempty"`
+	Archive           archivemap.ArchiveMap `json:"archive"`
+	Entries           archivemap.EntryMap   `json:"entries,omitempty"`
+	RootHash          []byte                `json:"rootHash"`
+	Root              string                `json:"root"`
+	Roots             map[string]string     `json:"roots,omitempty"`
+	IgnorePaths       []string              `json:"ignorePaths"`
+	IgnorePatterns    []string              `json:"ignorePatterns,omitempty"`
+	AutoIgnore        bool                  `json:"autoIgnore"`
+	HashMode          HashMode              `json:"hashMode,omitempty"`
+	FileHash          HashAlgorithm         `json:"fileHash,omitempty"`
+	Multihash         bool                  `json:"multihash,omitempty"`
+	LegacyHash        HashAlgorithm         `json:"legacyHash,omitempty"`
+	Legacy            map[string][]byte     `json:"legacy,omitempty"`
+	FollowSymlinks    bool                  `json:"followSymlinks,omitempty"`
+	RecordHardlinks   bool                  `json:"recordHardlinks,omitempty"`
+	SameDevice        bool                  `json:"sameDevice,omitempty"`
+	KeyNormalization  Normalization         `json:"keyNormalization,omitempty"`
+	RecordOwner       bool                  `json:"recordOwner,omitempty"`
+	RecordDirectories bool                  `json:"recordDirectories,omitempty"`
+	Keyed             bool                  `json:"keyed,omitempty"`
+	Chunking          *ChunkConfig          `json:"chunking,omitempty"`
+	IPFS              *IPFSConfig           `json:"ipfs,omitempty"`
+	Transparency      *tlog.Entry           `json:"transparency,omitempty"`
+	Sigstore          *sigstore.Bundle      `json:"sigstore,omitempty"`
+
+	concurrency  int
+	onProgress   func(ProgressEvent)
+	hmacKey      []byte
+	fsys         iofs.FS
+	errorPolicy  ErrorPolicy
+	skipped      []SkippedPath
+	logger       logging.Logger
+	cache        *HashCache
+	limiter      *fs.RateLimiter
+	maxOpenFiles int
+	fileMode     os.FileMode
+	backups      int
+
+	tracerProvider trace.TracerProvider
+	store          archivemap.Store
+	mmapThreshold  int64
+	readahead      int
+	logKey         crypto.PublicKey
+	auditLog       *audit.Log
+	// fileHasher is shared by the workers of a generation so they reuse
+	// pooled buffers and hash states
+	fileHasher *fs.Hasher
+}
+
+//New returns a new BlockMap initialized at the provided root and configured by opts
+func New(root string, opts ...Option) *BlockMap {
 	//Initialize map and assign blockmap root
 	rootMap := make(archivemap.ArchiveMap)
-	return &BlockMap{Archive: rootMap, RootHash: nil, Root: root, AutoIgnore: false}
+	b := &BlockMap{SchemaVersion: CurrentSchemaVersion, Archive: rootMap, Entries: make(archivemap.EntryMap), RootHash: nil, Root: root, AutoIgnore: false, KeyNormalization: NFC, concurrency: 1}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
 }
 
 //Generate creates an archive of the provided archives root filesystem
 func (b *BlockMap) Generate() error {
-	//Create a filesystem walker
-	w := walker.New(b.Root)
-	//Walk the root directory
-	if err := w.Walk(); err != nil {
-		return errors.Wrap(err, "BlockMap: failed to walk "+w.Root())
+	return b.GenerateContext(context.Background())
+}
+
+// GenerateContext is Generate, tracing the walk, hashing and root hash in
+// spans under any span in ctx
+func (b *BlockMap) GenerateContext(ctx context.Context) (err error) {
+	ctx, span := b.startSpan(ctx, "blockmap.Generate", attribute.String("golinks.root", b.Root))
+	defer func() { endSpan(span, err) }()
+
+	b.log().Log(logging.Debug, "generating blockmap", logging.F("root", b.Root))
+	jobs, err := b.walkTraced(ctx)
+	if err != nil {
+		return err
 	}
 
-	ignoredPath := func(ignoredPaths []string, value string) bool {
-		for _, ip := range ignoredPaths {
-			if strings.HasPrefix(value, ip) {
-				return true
-			}
+	b.hashJobs(ctx, jobs)
+	return b.applyTraced(ctx, jobs)
+}
+
+// Update refreshes an existing archive, only re-hashing files whose size or
+// modification time differ from the recorded entry. Files no longer present
+// under the root are removed from the archive.
+func (b *BlockMap) Update() error {
+	return b.UpdateContext(context.Background())
+}
+
+// UpdateContext is Update, traced like GenerateContext
+func (b *BlockMap) UpdateContext(ctx context.Context) (err error) {
+	ctx, span := b.startSpan(ctx, "blockmap.Update", attribute.String("golinks.root", b.Root))
+	defer func() { endSpan(span, err) }()
+
+	b.log().Log(logging.Debug, "updating blockmap", logging.F("root", b.Root))
+	jobs, err := b.walkTraced(ctx)
+	if err != nil {
+		return err
+	}
+
+	previous := b.previousEntry
+	if b.store != nil {
+		previous = b.storedEntry
+	}
+	for i, job := range jobs {
+		hash, entry, ok, err := previous(job.relPath)
+		if err != nil {
+			return err
 		}
-		return false
+		if !ok || entry.Size != job.entry.Size || entry.ModTime != job.entry.ModTime {
+			continue
+		}
+		jobs[i].hash = hash
+		jobs[i].entry.Chunks = entry.Chunks
+		jobs[i].entry.CID = entry.CID
 	}
 
-	var ips *IgnoredPathErr
-	//Iterate through all walked files
-	for _, filePath := range w.Archive() {
+	b.reuseLegacy(jobs)
+	b.hashJobs(ctx, jobs)
+	b.Archive = make(archivemap.ArchiveMap)
+	b.Entries = make(archivemap.EntryMap)
+	return b.applyTraced(ctx, jobs)
+}
+
+// hashJob is a single file queued for hashing during generation
+type hashJob struct {
+	filePath string
+	relPath  string
+	entry    archivemap.Entry
+	hash     []byte
+	err      error
+	// inode identifies files with several hard links
+	inode *fs.FileID
+	// dir is set for directory entries, which aren't read
+	dir bool
+	// legacy is the digest of the legacy file hash during a transition
+	legacy []byte
+}
+
+// collectJobs walks the root and returns every file that should be archived
+// keyed by its normalized archive path
+func (b *BlockMap) collectJobs() ([]hashJob, error) {
+	jobs, err := b.walkJobs()
+	if err != nil {
+		return nil, err
+	}
+	if err := b.normalizeKeys(jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// walkJobs walks the root, or every root, and returns the files to archive
+func (b *BlockMap) walkJobs() ([]hashJob, error) {
+	b.skipped = nil
+	if b.fsys != nil {
+		matcher, err := b.ignoreMatcher(b.Root)
+		if err != nil {
+			return nil, err
+		}
+		return b.collectFSJobs(matcher, ".")
+	}
+	if len(b.Roots) == 0 {
+		return b.collectRootJobs(b.Root, "")
+	}
+
+	var jobs []hashJob
+	for _, namespace := range b.namespaces() {
+		rootJobs, err := b.collectRootJobs(b.Roots[namespace], namespace)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, rootJobs...)
+	}
+	return jobs, nil
+}
+
+// collectRootJobs walks a root directory and returns every file that should
+// be archived, keyed under namespace when it is set
+func (b *BlockMap) collectRootJobs(root, namespace string) ([]hashJob, error) {
+	return b.collectDirJobs(root, root, namespace)
+}
+
+// collectDirJobs walks dir below root and returns every file that should be
+// archived keyed by its path relative to root, under namespace when it is set
+func (b *BlockMap) collectDirJobs(root, dir, namespace string) ([]hashJob, error) {
+	matcher, err := b.ignoreMatcher(root)
+	if err != nil {
+		return nil, err
+	}
+
+	//Create a filesystem walker
+	w := walker.New(dir)
+	w.SetLogger(b.log())
+	w.SetFollowSymlinks(b.FollowSymlinks)
+	w.SetSameDevice(b.SameDevice)
+	w.SetSkipFunc(func(path string, info os.FileInfo, err error) {
+		b.skipWalked(matcher, root, namespace, path, info, err)
+	})
+
+	var jobs []hashJob
+	if b.RecordDirectories {
+		w.SetDirFunc(func(dirPath string, info os.FileInfo) error {
+			relPath, err := filepath.Rel(root, dirPath)
+			if err != nil {
+				return &PathError{Op: "extract relative path of", Path: dirPath, Err: err}
+			}
+			relPath = strings.Replace(relPath, "\\", "/", -1)
+			if relPath == "." || ignoredPath(b.IgnorePaths, dirPath) || matcher.Match(relPath, true) {
+				return nil
+			}
+			jobs = append(jobs, b.directoryJob(dirPath, namespaced(namespace, relPath), info))
+			return nil
+		})
+	}
+
+	//Collect the files to hash while walking so results can be ordered
+	err = w.WalkFunc(func(filePath string, info os.FileInfo) error {
 		if ignoredPath(b.IgnorePaths, filePath) {
-			continue
+			return nil
 		}
 		//Extract the relative path for the archive
-		relPath, err := filepath.Rel(w.Root(), filePath)
+		relPath, err := filepath.Rel(root, filePath)
 		if err != nil {
-			return errors.Wrap(err, "BlockMap: failed to extract relative file path")
+			return &PathError{Op: "extract relative path of", Path: filePath, Err: err}
 		}
 
 		//Ignore the files generated by this library
-		if relPath == OutputName {
-			continue
+		if generatedFile(relPath) {
+			return nil
 		}
 
-		//Get the hash for the file
-		fileHash, err := fs.HashFile(filePath)
-		if err != nil {
-			if err := errors.Unwrap(err); b.AutoIgnore && err != nil {
+		//Use linux path seperator
+		relPath = strings.Replace(relPath, "\\", "/", -1)
+		if matcher.Match(relPath, false) {
+			return nil
+		}
+
+		jobs = append(jobs, hashJob{
+			filePath: filePath,
+			relPath:  namespaced(namespace, relPath),
+			entry:    b.newEntry(info),
+			inode:    linkedInode(info),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, &PathError{Op: "walk", Path: w.Root(), Err: err}
+	}
+
+	return jobs, nil
+}
+
+// ignoredPath returns true if value is prefixed by any of the ignored paths
+func ignoredPath(ignoredPaths []string, value string) bool {
+	for _, ip := range ignoredPaths {
+		if strings.HasPrefix(value, ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// newEntry records the metadata of a file for the archive
+func (b *BlockMap) newEntry(info os.FileInfo) archivemap.Entry {
+	entry := archivemap.Entry{
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixNano(),
+		Mode:    info.Mode(),
+	}
+
+	if b.RecordOwner {
+		if uid, gid, ok := fs.Owner(info); ok {
+			entry.Owner = &archivemap.Owner{UID: uid, GID: gid}
+		}
+	}
+	return entry
+}
+
+// applyJobs adds hashed jobs to the archive and hashes the blockmap
+func (b *BlockMap) applyJobs(jobs []hashJob) error {
+	if b.Entries == nil {
+		b.Entries = make(archivemap.EntryMap)
+	}
+	b.SchemaVersion = CurrentSchemaVersion
+	if b.store != nil {
+		if b.Legacy != nil {
+			return ErrStoreUnsupported
+		}
+		if err := b.store.Reset(); err != nil {
+			return errors.Wrap(err, "blockmap: failed to reset archive store")
+		}
+	}
+
+	var ips *IgnoredPathErr
+	var files int
+	//Results are processed in walk order so generation stays deterministic
+	for _, job := range jobs {
+		if job.err != nil {
+			if err := errors.Unwrap(job.err); b.AutoIgnore && err != nil {
 				if os.IsPermission(err) {
-					b.AddIgnorePath(filePath)
+					b.AddIgnorePath(job.filePath)
 					if ips == nil {
-						ips = &IgnoredPathErr{
-							Paths: []string{filePath},
-						}
-					} else {
-						ips.Paths = append(ips.Paths, filePath)
+						ips = &IgnoredPathErr{}
 					}
+					ips.add(job.filePath, job.err)
+					b.skip(job.relPath, SkipPermission, job.err)
 					continue
 				}
 			}
-			return errors.Wrap(err, "BlockMap: failed to hash "+filePath)
+			if reason := errorSkipReason(job.err); b.errorPolicy.skips(reason) {
+				b.skip(job.relPath, reason, job.err)
+				continue
+			}
+			return &PathError{Op: "hash", Path: job.filePath, Err: job.err}
 		}
 
-		//Use linux path seperator
-		relPath = strings.Replace(relPath, "\\", "/", -1)
-
 		//Add the hash to the archive using the relative path as it's key
-		b.Archive[relPath] = fileHash
+		files++
+		if b.store != nil {
+			if err := b.store.Put(job.relPath, job.hash, job.entry); err != nil {
+				return errors.Wrap(err, "blockmap: failed to store "+job.relPath)
+			}
+			continue
+		}
+		b.Archive[job.relPath] = job.hash
+		b.Entries[job.relPath] = job.entry
+		if b.Legacy != nil && !job.dir {
+			b.Legacy[job.relPath] = job.legacy
+		}
 	}
 
 	//If we're here, the entries are successful so we'll hash the blockmap.
 	if err := b.hashBlockMap(); err != nil {
 		return errors.Wrap(err, "blockmap: failed to generate block map")
 	}
+	b.log().Log(logging.Info, "generated blockmap", logging.F("root", b.Root),
+		logging.F("files", files), logging.F("skipped", len(b.skipped)))
 
 	if ips != nil && len(ips.Paths) > 0 {
 		return ips
@@ -136,11 +437,182 @@ func (b *BlockMap) Generate() error {
 	return nil
 }
 
+// hashJobs hashes every job in place using the configured number of workers.
+// Each worker traces the batch of files it hashed.
+func (b *BlockMap) hashJobs(ctx context.Context, jobs []hashJob) {
+	//Hard linked files are hashed once and the other links copy the result
+	hashed, links := b.linkGroups(jobs)
+	workers := b.workers()
+	if workers > len(hashed) {
+		workers = len(hashed)
+	}
+	ctx, span := b.startSpan(ctx, "blockmap.hash", attribute.Int("golinks.files", len(jobs)), attribute.Int("golinks.workers", workers))
+	defer span.End()
+	if hasher, err := b.hasher(); err == nil {
+		b.fileHasher = hasher
+		defer func() { b.fileHasher = nil }()
+	}
+	progress := newProgressTracker(b.onProgress, len(jobs))
+	defer func() {
+		for _, i := range sortedLinks(links) {
+			b.copyLink(jobs, i, links[i])
+			progress.report(jobs[i])
+		}
+	}()
+	hash := func(index int) {
+		jobs[index].hash, jobs[index].entry.Chunks, jobs[index].err = b.hashJobFile(jobs[index])
+		if jobs[index].err == nil {
+			jobs[index].entry.CID, jobs[index].err = b.jobCID(jobs[index])
+		}
+		if jobs[index].err == nil && b.Legacy != nil && !jobs[index].dir && jobs[index].legacy == nil {
+			jobs[index].legacy, jobs[index].err = b.legacyDigest(jobs[index])
+		}
+		progress.report(jobs[index])
+	}
+	hashBatch := func(indexes <-chan int) {
+		_, span := b.startSpan(ctx, "blockmap.hashBatch")
+		var files int
+		var size int64
+		for index := range indexes {
+			hash(index)
+			files++
+			size += jobs[index].entry.Size
+		}
+		span.SetAttributes(attribute.Int("golinks.files", files), attribute.Int64("golinks.bytes", size))
+		span.End()
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			hashBatch(indexes)
+		}()
+	}
+
+	for k, i := range hashed {
+		b.prefetch(jobs, hashed, k)
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
+
+// hashJobFile hashes a job's file and its chunks when chunking applies unless
+// a cached hash is already present
+func (b *BlockMap) hashJobFile(job hashJob) ([]byte, []archivemap.Chunk, error) {
+	if job.dir {
+		hash, err := b.directoryHash()
+		return hash, nil, err
+	}
+	splitter := b.splitter(job.entry.Size)
+	if job.hash != nil && (splitter == nil || job.entry.Chunks != nil) {
+		return job.hash, job.entry.Chunks, nil
+	}
+	if splitter != nil {
+		hash, chunks, err := b.hashChunks(job, splitter)
+		if err != nil {
+			return nil, nil, err
+		}
+		hash, err = b.encodeHash(hash)
+		return hash, chunks, err
+	}
+
+	hasher, err := b.hasher()
+	if err != nil {
+		return nil, nil, err
+	}
+	var hash []byte
+	if b.fsys != nil {
+		hash, err = hasher.HashFS(b.fsys, job.filePath)
+	} else {
+		hash, err = b.cachedHash(job, b.fileHashFunc(hasher, job.entry.Size))
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	hash, err = b.encodeHash(hash)
+	return hash, nil, err
+}
+
+// ErrMissingHMACKey is returned when hashing a keyed blockmap without its key
+var ErrMissingHMACKey = errors.New("blockmap: keyed blockmap requires an HMAC key")
+
+// SetHMACKey computes the root hash as an HMAC-SHA512 keyed with key so the
+// root hash can't be regenerated without it. The key is never serialized,
+// only the fact that keyed hashing was used. A nil key disables keyed hashing.
+func (b *BlockMap) SetHMACKey(key []byte) {
+	if key == nil {
+		b.hmacKey = nil
+		b.Keyed = false
+		return
+	}
+	b.hmacKey = append([]byte{}, key...)
+	b.Keyed = true
+}
+
+// SetConcurrency sets the number of files hashed in parallel during generation.
+// Values less than 1 use runtime.NumCPU workers.
+func (b *BlockMap) SetConcurrency(n int) {
+	b.concurrency = n
+}
+
+// Concurrency returns the number of workers used to hash files
+func (b *BlockMap) Concurrency() int {
+	if b.concurrency < 1 {
+		return runtime.NumCPU()
+	}
+	return b.concurrency
+}
+
 // SetIgnorePaths sets a list of paths to ignore in blockmap generation
 func (b *BlockMap) SetIgnorePaths(paths []string) {
 	b.IgnorePaths = uniqueStringSlice([]string{}, paths)
 }
 
+// SetIgnorePatterns sets gitignore style patterns matched against archive
+// paths during blockmap generation
+func (b *BlockMap) SetIgnorePatterns(patterns []string) {
+	b.IgnorePatterns = append([]string{}, patterns...)
+}
+
+// ignoreMatcher compiles the ignore patterns along with any patterns found
+// in the IgnoreFileName file at root, or at the root of the blockmap's fsys
+func (b *BlockMap) ignoreMatcher(root string) (*ignore.Matcher, error) {
+	matcher, err := ignore.New(b.IgnorePatterns)
+	if err != nil {
+		return nil, errors.Wrap(err, "blockmap: failed to compile ignore patterns")
+	}
+
+	var fileMatcher *ignore.Matcher
+	if b.fsys != nil {
+		file, err := b.fsys.Open(IgnoreFileName)
+		if os.IsNotExist(err) {
+			return matcher, nil
+		} else if err != nil {
+			return nil, &PathError{Op: "open", Path: IgnoreFileName, Err: err}
+		}
+		defer file.Close()
+		if fileMatcher, err = ignore.Read(file); err != nil {
+			return nil, &PathError{Op: "load", Path: IgnoreFileName, Err: err}
+		}
+	} else {
+		ignoreFile := filepath.Join(root, IgnoreFileName)
+		if _, err := os.Stat(ignoreFile); os.IsNotExist(err) {
+			return matcher, nil
+		}
+
+		if fileMatcher, err = ignore.Load(ignoreFile); err != nil {
+			return nil, &PathError{Op: "load", Path: ignoreFile, Err: err}
+		}
+	}
+
+	//Explicit patterns take precedence over the ignore file
+	return ignore.Merge(fileMatcher, matcher), nil
+}
+
 // AddIgnorePath adds a path to ignore during blockmap generation
 func (b *BlockMap) AddIgnorePath(path string) {
 	b.IgnorePaths = uniqueStringSlice(b.IgnorePaths, []string{path})
@@ -164,35 +636,85 @@ func uniqueStringSlice(original, additions []string) []string {
 	return out
 }
 
+// hashBlockMap computes the root hash, streaming the canonical archive
+// through the hash rather than encoding it in memory first
 func (b *BlockMap) hashBlockMap() error {
 	if b.Archive == nil {
-		return errors.New("blockmap: Attempted to hash null archive")
+		return ErrNilArchive
+	}
+
+	if b.Keyed && b.hmacKey == nil {
+		return ErrMissingHMACKey
+	}
+	if err := b.buildBloomFilter(); err != nil {
+		return err
+	}
+
+	if b.HashMode == TreeHashMode {
+		if b.store != nil {
+			return ErrStoreUnsupported
+		}
+		tree, err := b.Tree()
+		if err != nil {
+			return err
+		}
+		b.RootHash = tree.Hash
+		if b.hmacKey != nil {
+			mac := hmac.New(sha512.New, b.hmacKey)
+			mac.Write(tree.Hash)
+			b.RootHash = mac.Sum(nil)
+		}
+		b.dropStaleLogEntry()
+		return nil
 	}
 
 	hash := sha512.New()
-	archiveJSON, err := json.Marshal(b.Archive)
-	if err != nil {
-		return errors.Wrap(err, "blockmap: hash failed to encode archive map JSON")
+	if b.hmacKey != nil {
+		hash = hmac.New(sha512.New, b.hmacKey)
 	}
-	if _, err := hash.Write(archiveJSON); err != nil {
+	if err := b.writeCanonical(hash); err != nil {
 		return errors.Wrap(err, "blockmap: failed to write to write hash buffer")
 	}
 
 	b.RootHash = hash.Sum(nil)
+	b.dropStaleLogEntry()
 	return nil
 
 }
 
-//PrintBlockMap prints an existing block map and returns an error if not configured
+//PrintBlockMap prints an existing block map to stdout, logging a warning if it is unhashed
 func (b BlockMap) PrintBlockMap() {
+	b.Fprint(os.Stdout)
+}
+
+// Fprint writes the root, root hash and archive of the blockmap to w,
+// logging a warning if it is unhashed
+func (b BlockMap) Fprint(w io.Writer) {
 	if b.RootHash == nil {
-		log.Println("BlockMap is unhashed or unset")
+		b.log().Log(logging.Warn, "blockmap is unhashed or unset", logging.F("root", b.Root))
+	}
+	fmt.Fprintln(w, "Root: "+b.Root)
+	for _, namespace := range b.namespaces() {
+		fmt.Fprintln(w, "Root "+namespace+": "+b.Roots[namespace])
 	}
-	fmt.Println("Root: " + b.Root)
-	fmt.Printf("Hash: %v\n", b.RootHash)
+	fmt.Fprintf(w, "Hash: %v\n", b.RootHash)
 	for key, value := range b.Archive {
-		fmt.Printf("%v: %v\n", key, value)
+		fmt.Fprintf(w, "%v: %v\n", key, value)
+	}
+}
+
+// SetLogger sets the logger receiving generation progress and skipped
+// paths. A nil logger discards messages, which is the default.
+func (b *BlockMap) SetLogger(logger logging.Logger) {
+	b.logger = logger
+}
+
+// log returns the blockmap's logger
+func (b BlockMap) log() logging.Logger {
+	if b.logger == nil {
+		return logging.Discard
 	}
+	return b.logger
 }
 
 //Save will store a byte file of the blockmap in the default OutputFile
@@ -205,53 +727,110 @@ func (b BlockMap) SaveNamed(path, name string) error {
 	return b.saveHelper(path, name)
 }
 
+// SaveCodec will store the blockmap in the named OutputFile encoded with c.
+// Load detects the codec automatically.
+func (b BlockMap) SaveCodec(path, name string, c codec.Codec) error {
+	return b.saveCodecHelper(path, name, c)
+}
+
 func (b BlockMap) saveHelper(path, name string) error {
+	return b.saveCodecHelper(path, name, codec.JSON)
+}
+
+func (b BlockMap) saveCodecHelper(path, name string, c codec.Codec) error {
 	if b.RootHash == nil {
-		return errors.New("BlockMap: can't save nil hashed map")
+		return ErrUnhashed
 	}
 
-	jsonBytes, err := json.Marshal(b)
-	if err != nil {
-		return errors.Wrap(err, "BlockMap: failed to encode link json")
-	}
 	linkFilePath := path + string(os.PathSeparator) + name + OutputName
-	if err := ioutil.WriteFile(linkFilePath, jsonBytes, 0755); err != nil {
-		return errors.Wrap(err, "BlockMap: failed to write to link")
+	return b.audited(linkFilePath, func() error {
+		return writeLink(linkFilePath, b.FileMode(), b.backups, func(w io.Writer) error {
+			_, err := b.WriteCodec(w, c)
+			return err
+		})
+	})
+}
+
+// WriteTo writes the blockmap to w as JSON, the format written by Save
+func (b BlockMap) WriteTo(w io.Writer) (int64, error) {
+	return b.WriteCodec(w, codec.JSON)
+}
+
+// WriteCodec writes the blockmap to w encoded with c, the format written by SaveCodec
+func (b BlockMap) WriteCodec(w io.Writer, c codec.Codec) (int64, error) {
+	return b.WriteCodecContext(context.Background(), w, c)
+}
+
+// WriteCodecContext is WriteCodec, tracing the encoding in a span under any span in ctx
+func (b BlockMap) WriteCodecContext(ctx context.Context, w io.Writer, c codec.Codec) (n int64, err error) {
+	_, span := b.startSpan(ctx, "blockmap.encode", attribute.String("golinks.codec", c.Name()))
+	defer func() {
+		span.SetAttributes(attribute.Int64("golinks.bytes", n))
+		endSpan(span, err)
+	}()
+
+	if b.RootHash == nil {
+		return 0, ErrUnhashed
+	}
+	if b.store != nil {
+		if c != codec.JSON {
+			return 0, errors.Wrap(ErrStoreUnsupported, "blockmap: failed to encode link "+c.Name())
+		}
+		return b.writeStoreJSON(w)
 	}
 
-	return nil
+	linkBytes, err := codec.Encode(c, b)
+	if err != nil {
+		return 0, errors.Wrap(err, "blockmap: failed to encode link "+c.Name())
+	}
+	written, err := w.Write(linkBytes)
+	return int64(written), errors.Wrap(err, "blockmap: failed to write link")
 }
 
 //Load reads the blockmap from the default OutputFile
 func (b *BlockMap) Load(path string) error {
 	linkFilePath := path + string(os.PathSeparator) + OutputName
-	jsonBytes, err := ioutil.ReadFile(linkFilePath)
+	file, err := os.Open(linkFilePath)
 	if err != nil {
-		return errors.Wrap(err, "BlockMap: failed to read link file")
+		return &PathError{Op: "read", Path: linkFilePath, Err: err}
 	}
+	defer file.Close()
 
-	if err := json.Unmarshal(jsonBytes, &b); err != nil {
-		return errors.Wrap(err, "BlockMap failed to unmarshal link json")
+	if _, err := b.ReadFrom(file); err == ErrEncryptedLink {
+		return err
+	} else if err != nil {
+		return &PathError{Op: "decode", Path: linkFilePath, Err: err}
 	}
 
 	return nil
 }
 
-//Equal returns an evaluation of the equality of two blockmaps
-func Equal(a, b *BlockMap) bool {
-	if !bytes.Equal(a.RootHash, b.RootHash) {
-		return false
-	}
-
-	aJSON, err := json.Marshal(a.Archive)
+// ReadFrom reads a link in any format written by WriteTo, WriteCodec or an
+// earlier version of this package from r until EOF, see Decode. Encrypted
+// links return ErrEncryptedLink. When a log key is set with SetLogKey the
+// link must hold a transparency log entry verifying against it, see
+// VerifyLog. Without a log key, entries in the link are not verified.
+func (b *BlockMap) ReadFrom(r io.Reader) (int64, error) {
+	linkBytes, err := ioutil.ReadAll(r)
 	if err != nil {
-		panic(err)
+		return int64(len(linkBytes)), errors.Wrap(err, "blockmap: failed to read link")
 	}
 
-	bJSON, err := json.Marshal(b.Archive)
-	if err != nil {
-		panic(err)
+	if isSealedLink(linkBytes) {
+		return int64(len(linkBytes)), ErrEncryptedLink
+	}
+	if err := b.Decode(linkBytes); err != nil {
+		return int64(len(linkBytes)), err
 	}
+	if b.logKey != nil {
+		return int64(len(linkBytes)), b.VerifyLog()
+	}
+	return int64(len(linkBytes)), nil
+}
 
-	return reflect.DeepEqual(aJSON, bJSON)
+//Equal returns true if two blockmaps have the same archive and root hash. It is Compare
+//with ContentAndRoot.
+func Equal(a, b *BlockMap) bool {
+	c, err := Compare(a, b, ContentAndRoot)
+	return err == nil && c.Equal
 }
@@ -26,19 +26,22 @@ import (
 	"math/rand"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strconv"
 	"testing"
 	"time"
+
+	"github.com/govice/golinks/archivemap"
+	"github.com/govice/golinks/codec"
 )
 
 var tmpDir string
 var tmpDirInfo []os.FileInfo
 
 func TestMain(m *testing.M) {
-	//Generate initial blockmap from the test root
-	tmpDir, _ = ioutil.TempDir(".", "test")
-	cwd, _ := os.Getwd()
-	tmpDir = filepath.Join(cwd, tmpDir)
+	//Generate initial blockmap from the test root, outside the source tree so
+	//an interrupted run can't leave fixtures behind in it
+	tmpDir, _ = ioutil.TempDir("", "blockmap")
 	fmt.Println("tmpdir: " + tmpDir)
 
 	for i := 0; i < 2; i++ {
@@ -213,3 +216,229 @@ func TestBlockMap_JSON(t *testing.T) {
 		t.Error("blockmap: json input and output are not equal")
 	}
 }
+
+func TestBlockMap_SetConcurrency(t *testing.T) {
+	sequential := New(tmpDir)
+	if err := sequential.Generate(); err != nil {
+		t.Error(err)
+	}
+
+	for _, workers := range []int{0, 2, 8} {
+		concurrent := New(tmpDir)
+		concurrent.SetConcurrency(workers)
+		if workers < 1 && concurrent.Concurrency() < 1 {
+			t.Error("expected default concurrency to use available cpus")
+		}
+		if err := concurrent.Generate(); err != nil {
+			t.Error(err)
+		}
+
+		if !Equal(sequential, concurrent) {
+			t.Error("concurrent generation does not match sequential generation with workers:", workers)
+		}
+	}
+}
+
+func TestBlockMap_Update(t *testing.T) {
+	root, err := ioutil.TempDir(tmpDir, "update")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	for _, name := range []string{"a", "b", "c"} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := New(root)
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+
+	//Unchanged files should keep their recorded hash without being re-read
+	cached := []byte("cached")
+	b.Archive["a"] = cached
+
+	//Changed and removed files should be picked up
+	later := time.Now().Add(time.Hour)
+	if err := ioutil.WriteFile(filepath.Join(root, "b"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(root, "b"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(root, "c")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Update(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(b.Archive["a"], cached) {
+		t.Error("expected unchanged file to reuse cached hash")
+	}
+	if _, ok := b.Archive["c"]; ok {
+		t.Error("expected removed file to be dropped from archive")
+	}
+
+	expected := New(root)
+	if err := expected.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b.Archive["b"], expected.Archive["b"]) {
+		t.Error("expected modified file to be re-hashed")
+	}
+}
+
+func TestBlockMap_IgnorePatterns(t *testing.T) {
+	root, err := ioutil.TempDir(tmpDir, "patterns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	if err := os.MkdirAll(filepath.Join(root, "cache", "nested"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"keep.txt":           "keep",
+		"keep2.txt":          "keep",
+		"scratch.tmp":        "tmp",
+		"important.tmp":      "tmp",
+		"nested.log":         "log",
+		"cache/nested/a.bin": "cached",
+		"cache/nested/b.bin": "cached",
+		IgnoreFileName:       "*.tmp\ncache/\n",
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := New(root)
+	b.SetIgnorePatterns([]string{"!important.tmp", "*.log"})
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"keep.txt", "keep2.txt", "important.tmp", IgnoreFileName} {
+		if _, ok := b.Archive[expected]; !ok {
+			t.Error("expected archive to include", expected)
+		}
+	}
+	if len(b.Archive) != 4 {
+		t.Error("unexpected archive entries", b.Archive)
+	}
+}
+
+func TestBlockMap_SetHMACKey(t *testing.T) {
+	plain := New(tmpDir)
+	if err := plain.Generate(); err != nil {
+		t.Fatal(err)
+	}
+
+	keyed := New(tmpDir)
+	keyed.SetHMACKey([]byte("secret"))
+	if err := keyed.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(plain.RootHash, keyed.RootHash) {
+		t.Error("expected keyed root hash to differ from unkeyed root hash")
+	}
+	if !keyed.Keyed {
+		t.Error("expected keyed hashing to be recorded")
+	}
+
+	other := New(tmpDir)
+	other.SetHMACKey([]byte("other"))
+	if err := other.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(keyed.RootHash, other.RootHash) {
+		t.Error("expected root hashes with different keys to differ")
+	}
+
+	keyedJSON, err := json.Marshal(keyed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(keyedJSON, []byte("secret")) {
+		t.Error("hmac key must not be serialized")
+	}
+
+	loaded := New(tmpDir)
+	if err := json.Unmarshal(keyedJSON, loaded); err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.Generate(); !errors.Is(err, ErrMissingHMACKey) {
+		t.Error("expected missing key error regenerating keyed blockmap, got", err)
+	}
+}
+
+func TestBlockMap_SaveCodec(t *testing.T) {
+	b := New(tmpDir)
+	b.RecordOwner = true
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range codec.Codecs() {
+		if err := b.SaveCodec(tmpDir, c.Name(), c); err != nil {
+			t.Fatal(c.Name(), err)
+		}
+		linkPath := filepath.Join(tmpDir, c.Name()+OutputName)
+		if err := os.Rename(linkPath, filepath.Join(tmpDir, OutputName)); err != nil {
+			t.Fatal(err)
+		}
+
+		loaded := New(tmpDir)
+		if err := loaded.Load(tmpDir); err != nil {
+			t.Fatal(c.Name(), err)
+		}
+		if !Equal(b, loaded) || !reflect.DeepEqual(b.Entries, loaded.Entries) {
+			t.Error("failed to reload blockmap saved as", c.Name())
+		}
+	}
+}
+
+func TestBlockMap_WriteToReadFrom(t *testing.T) {
+	b := New("root")
+	b.Archive = archivemap.ArchiveMap{"a": []byte("1"), "b/c": []byte("2")}
+	if _, err := b.WriteTo(&bytes.Buffer{}); !errors.Is(err, ErrUnhashed) {
+		t.Errorf("expected ErrUnhashed, got %v", err)
+	}
+	if err := b.hashBlockMap(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range codec.Codecs() {
+		t.Run(c.Name(), func(t *testing.T) {
+			var buffer bytes.Buffer
+			written, err := b.WriteCodec(&buffer, c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if written != int64(buffer.Len()) {
+				t.Errorf("expected %d bytes written, got %d", buffer.Len(), written)
+			}
+
+			loaded := New("")
+			read, err := loaded.ReadFrom(&buffer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if read != written || !Equal(b, loaded) || loaded.Root != b.Root {
+				t.Errorf("expected %d bytes of the same blockmap, got %d %+v", written, read, loaded)
+			}
+		})
+	}
+
+	sealed := append(append([]byte{}, encryptedMagic...), 1)
+	if _, err := New("").ReadFrom(bytes.NewReader(sealed)); !errors.Is(err, ErrEncryptedLink) {
+		t.Errorf("expected ErrEncryptedLink, got %v", err)
+	}
+}
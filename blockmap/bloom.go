@@ -0,0 +1,203 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+package blockmap
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultBloomFalsePositiveRate is the false positive rate of bloom filters
+// enabled without an explicit rate
+const DefaultBloomFalsePositiveRate = 0.01
+
+// ErrNoBloomFilter is returned when reading the bloom filter of a link
+// generated without one
+var ErrNoBloomFilter = errors.New("blockmap: link has no bloom filter")
+
+// BloomFilter is a compact summary of the archived file hashes. Contains never
+// misses an added hash but reports hashes that weren't added at about Rate.
+type BloomFilter struct {
+	// Rate is the false positive rate the filter was sized for
+	Rate float64 `json:"rate"`
+	// Hashes is the number of bits set per added hash
+	Hashes int    `json:"hashes"`
+	Bits   []byte `json:"bits"`
+}
+
+// NewBloomFilter returns an empty filter sized for n hashes at the false
+// positive rate
+func NewBloomFilter(n int, rate float64) *BloomFilter {
+	if rate <= 0 || rate >= 1 {
+		rate = DefaultBloomFalsePositiveRate
+	}
+	if n < 1 {
+		n = 1
+	}
+	bits := math.Ceil(-float64(n) * math.Log(rate) / (math.Ln2 * math.Ln2))
+	hashes := int(math.Round(bits / float64(n) * math.Ln2))
+	if hashes < 1 {
+		hashes = 1
+	}
+	return &BloomFilter{
+		Rate:   rate,
+		Hashes: hashes,
+		Bits:   make([]byte, (int(bits)+7)/8),
+	}
+}
+
+// Add adds hash to the filter
+func (f *BloomFilter) Add(hash []byte) {
+	f.each(hash, func(bit uint64) bool {
+		f.Bits[bit/8] |= 1 << (bit % 8)
+		return true
+	})
+}
+
+// Contains returns false if hash was never added to the filter. A nil or
+// empty filter can't rule out any hash.
+func (f *BloomFilter) Contains(hash []byte) bool {
+	if f == nil || len(f.Bits) == 0 {
+		return true
+	}
+	return f.each(hash, func(bit uint64) bool {
+		return f.Bits[bit/8]&(1<<(bit%8)) != 0
+	})
+}
+
+// each calls fn with every bit of hash until fn returns false. Bits are
+// derived by enhanced double hashing of the SHA-256 of hash so any input is
+// spread evenly, even over small filters.
+func (f *BloomFilter) each(hash []byte, fn func(bit uint64) bool) bool {
+	sum := sha256.Sum256(hash)
+	x := binary.BigEndian.Uint64(sum[0:8])
+	y := binary.BigEndian.Uint64(sum[8:16])
+	m := uint64(len(f.Bits)) * 8
+	for i := 0; i < f.Hashes; i++ {
+		if !fn(x % m) {
+			return false
+		}
+		x += y
+		y += uint64(i)
+	}
+	return true
+}
+
+// SetBloomFilter embeds a bloom filter of the archived file hashes sized for
+// the false positive rate in the link, rebuilt whenever the root hash is. A
+// rate of zero removes the filter.
+func (b *BlockMap) SetBloomFilter(rate float64) {
+	if rate == 0 {
+		b.Bloom = nil
+		return
+	}
+	b.Bloom = NewBloomFilter(len(b.Archive), rate)
+}
+
+// MayContain returns false if no file archived by b has hash. The bloom
+// filter answers when present, so true may be a false positive.
+func (b *BlockMap) MayContain(hash []byte) bool {
+	if b.Bloom != nil {
+		return b.Bloom.Contains(hash)
+	}
+	for path, archived := range b.Archive {
+		if !IsDirectory(path) && bytes.Equal(b.Digest(archived), hash) {
+			return true
+		}
+	}
+	return false
+}
+
+// buildBloomFilter rebuilds an enabled bloom filter from the archive
+func (b *BlockMap) buildBloomFilter() error {
+	if b.Bloom == nil {
+		return nil
+	}
+	if b.store != nil {
+		return b.buildStoreBloomFilter()
+	}
+	filter := NewBloomFilter(len(b.Archive), b.Bloom.Rate)
+	for path, hash := range b.Archive {
+		if !IsDirectory(path) {
+			filter.Add(b.Digest(hash))
+		}
+	}
+	b.Bloom = filter
+	return nil
+}
+
+// ReadBloomFilter reads the bloom filter of the link in r. JSON links are
+// read only up to the filter, which is encoded ahead of the archive, while
+// other formats are decoded in full.
+func ReadBloomFilter(r io.Reader) (*BloomFilter, error) {
+	br := bufio.NewReader(r)
+	start, err := br.Peek(sealedPrefixLen)
+	if err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "blockmap: failed to read link")
+	}
+	if isSealedLink(start) {
+		return nil, ErrEncryptedLink
+	}
+	if trimmed := bytes.TrimLeft(start, " \t\r\n"); len(trimmed) == 0 || trimmed[0] != '{' {
+		data, err := ioutil.ReadAll(br)
+		if err != nil {
+			return nil, errors.Wrap(err, "blockmap: failed to read link")
+		}
+		b := New("")
+		if err := b.Decode(data); err != nil {
+			return nil, err
+		}
+		if b.Bloom == nil {
+			return nil, ErrNoBloomFilter
+		}
+		return b.Bloom, nil
+	}
+
+	decoder := json.NewDecoder(br)
+	if _, err := decoder.Token(); err != nil {
+		return nil, errors.Wrap(err, "blockmap: failed to decode link")
+	}
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return nil, errors.Wrap(err, "blockmap: failed to decode link")
+		}
+		if key == "bloom" {
+			var filter BloomFilter
+			if err := decoder.Decode(&filter); err != nil {
+				return nil, errors.Wrap(err, "blockmap: failed to decode bloom filter")
+			}
+			return &filter, nil
+		}
+		//Fields after the filter are never reached when it is present
+		if key == "archive" {
+			break
+		}
+		var skipped json.RawMessage
+		if err := decoder.Decode(&skipped); err != nil {
+			return nil, errors.Wrap(err, "blockmap: failed to decode link")
+		}
+	}
+	return nil, ErrNoBloomFilter
+}
@@ -0,0 +1,123 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+package blockmap
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/govice/golinks/codec"
+)
+
+func testHash(i int) []byte {
+	var n [8]byte
+	binary.BigEndian.PutUint64(n[:], uint64(i))
+	sum := sha512.Sum512(n[:])
+	return sum[:]
+}
+
+func TestBloomFilter(t *testing.T) {
+	f := NewBloomFilter(1000, 0.01)
+	for i := 0; i < 1000; i++ {
+		f.Add(testHash(i))
+	}
+	for i := 0; i < 1000; i++ {
+		if !f.Contains(testHash(i)) {
+			t.Fatalf("expected hash %d to be contained", i)
+		}
+	}
+	falsePositives := 0
+	for i := 1000; i < 11000; i++ {
+		if f.Contains(testHash(i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 300 {
+		t.Errorf("expected about 1%% false positives, got %d of 10000", falsePositives)
+	}
+
+	var nilFilter *BloomFilter
+	if !nilFilter.Contains(testHash(0)) {
+		t.Error("expected a nil filter to contain every hash")
+	}
+}
+
+func TestBlockMap_BloomFilter(t *testing.T) {
+	root, err := ioutil.TempDir(tmpDir, "bloom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for _, name := range []string{"a", "b", "c"} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := New(root, WithBloomFilter(0.001))
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []codec.Codec{codec.JSON, codec.CBOR} {
+		var buf bytes.Buffer
+		if _, err := b.WriteCodec(&buf, c); err != nil {
+			t.Fatal(err)
+		}
+		filter, err := ReadBloomFilter(&buf)
+		if err != nil {
+			t.Fatalf("%s: %v", c.Name(), err)
+		}
+		for path, hash := range b.Archive {
+			if !filter.Contains(hash) {
+				t.Errorf("%s: expected filter to contain %s", c.Name(), path)
+			}
+		}
+		if filter.Rate != 0.001 || filter.Contains(testHash(0)) {
+			t.Errorf("%s: unexpected filter %+v", c.Name(), filter)
+		}
+	}
+
+	//The filter follows changes to the archive
+	if err := ioutil.WriteFile(filepath.Join(root, "a"), []byte("modified"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.UpdatePath("a"); err != nil {
+		t.Fatal(err)
+	}
+	if !b.MayContain(b.Archive["a"]) {
+		t.Error("expected the filter to contain the updated hash")
+	}
+
+	plain := New(root)
+	if err := plain.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if !plain.MayContain(plain.Archive["b"]) || plain.MayContain(testHash(0)) {
+		t.Error("expected MayContain to search the archive without a filter")
+	}
+	var buf bytes.Buffer
+	if _, err := plain.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadBloomFilter(&buf); err != ErrNoBloomFilter {
+		t.Errorf("expected ErrNoBloomFilter, got %v", err)
+	}
+}
@@ -0,0 +1,209 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// hashCacheVersion is the version of the hash cache file format
+const hashCacheVersion = 1
+
+// HashCache persists file hashes between runs so generating a blockmap skips
+// hashing files whose size and modification time are unchanged. Entries are
+// keyed by absolute path and hash algorithm. The cache is only consulted for
+// files hashed whole from an OS root, never for chunked files or during
+// Verify. A HashCache is safe for concurrent use.
+type HashCache struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	dirty   bool
+}
+
+// cacheEntry is a cached file hash
+type cacheEntry struct {
+	Size      int64         `json:"size"`
+	ModTime   int64         `json:"modTime"`
+	Algorithm HashAlgorithm `json:"algorithm,omitempty"`
+	Hash      []byte        `json:"hash"`
+}
+
+// cacheFile is the on-disk format of a hash cache
+type cacheFile struct {
+	Version int                   `json:"version"`
+	Entries map[string]cacheEntry `json:"entries"`
+}
+
+// OpenHashCache loads the hash cache stored at path. A missing file, or one
+// written by an incompatible version, opens an empty cache saved to path.
+func OpenHashCache(path string) (*HashCache, error) {
+	c := &HashCache{path: path, entries: make(map[string]cacheEntry)}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, &PathError{Op: "read hash cache", Path: path, Err: err}
+	}
+
+	var file cacheFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, &PathError{Op: "decode hash cache", Path: path, Err: err}
+	}
+	if file.Version == hashCacheVersion && file.Entries != nil {
+		c.entries = file.Entries
+	}
+	return c, nil
+}
+
+// Path returns the file the cache is saved to
+func (c *HashCache) Path() string {
+	return c.path
+}
+
+// Len returns the number of cached hashes
+func (c *HashCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Save writes the cache to its path if it changed since it was opened
+func (c *HashCache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty {
+		return nil
+	}
+	data, err := json.Marshal(cacheFile{Version: hashCacheVersion, Entries: c.entries})
+	if err != nil {
+		return errors.Wrap(err, "blockmap: failed to encode hash cache")
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return &PathError{Op: "create hash cache directory", Path: filepath.Dir(c.path), Err: err}
+	}
+
+	//Write to a temporary file so an interrupted save keeps the old cache
+	tmp := c.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return &PathError{Op: "write hash cache", Path: tmp, Err: err}
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return &PathError{Op: "write hash cache", Path: c.path, Err: err}
+	}
+	c.dirty = false
+	return nil
+}
+
+// Clear removes every cached hash
+func (c *HashCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) > 0 {
+		c.dirty = true
+	}
+	c.entries = make(map[string]cacheEntry)
+}
+
+// Invalidate removes the cached hashes of path and every file below it
+func (c *HashCache) Invalidate(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return &PathError{Op: "resolve", Path: path, Err: err}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.entries {
+		if key == abs || strings.HasPrefix(key, abs+string(filepath.Separator)) {
+			delete(c.entries, key)
+			c.dirty = true
+		}
+	}
+	return nil
+}
+
+// Prune removes cached hashes of files that no longer exist or whose size or
+// modification time changed and returns the number of hashes removed
+func (c *HashCache) Prune() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pruned := 0
+	for key, entry := range c.entries {
+		info, err := os.Stat(key)
+		if err != nil || info.Size() != entry.Size || info.ModTime().UnixNano() != entry.ModTime {
+			delete(c.entries, key)
+			pruned++
+		}
+	}
+	if pruned > 0 {
+		c.dirty = true
+	}
+	return pruned
+}
+
+// lookup returns the cached hash of a file if its size, modification time
+// and hash algorithm match
+func (c *HashCache) lookup(path string, size, modTime int64, alg HashAlgorithm) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[path]
+	if !ok || entry.Size != size || entry.ModTime != modTime || entry.Algorithm != alg {
+		return nil
+	}
+	return entry.Hash
+}
+
+// store caches the hash of a file
+func (c *HashCache) store(path string, size, modTime int64, alg HashAlgorithm, hash []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[path] = cacheEntry{Size: size, ModTime: modTime, Algorithm: alg, Hash: hash}
+	c.dirty = true
+}
+
+// SetHashCache consults c for the hashes of unchanged files during Generate
+// and Update and stores newly computed hashes in it. The cache isn't saved
+// automatically. A nil cache hashes every file.
+func (b *BlockMap) SetHashCache(c *HashCache) {
+	b.cache = c
+}
+
+// cachedHash hashes a job's file through the hash cache
+func (b *BlockMap) cachedHash(job hashJob, hashFile func(string) ([]byte, error)) ([]byte, error) {
+	if b.cache == nil {
+		return hashFile(job.filePath)
+	}
+	abs, err := filepath.Abs(job.filePath)
+	if err != nil {
+		return hashFile(job.filePath)
+	}
+	if hash := b.cache.lookup(abs, job.entry.Size, job.entry.ModTime, b.FileHash); hash != nil {
+		return hash, nil
+	}
+	hash, err := hashFile(job.filePath)
+	if err == nil {
+		b.cache.store(abs, job.entry.Size, job.entry.ModTime, b.FileHash, hash)
+	}
+	return hash, err
+}
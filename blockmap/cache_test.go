@@ -0,0 +1,126 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHashCache(t *testing.T) {
+	root, err := ioutil.TempDir(tmpDir, "cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for _, name := range []string{"a", "b"} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cachePath := filepath.Join(root, "cache", "hashes.json")
+
+	cache, err := OpenHashCache(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := New(root, WithIgnorePatterns("cache/"), WithHashCache(cache))
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if cache.Len() != 2 {
+		t.Fatalf("expected 2 cached hashes, got %d", cache.Len())
+	}
+	if err := cache.Save(); err != nil {
+		t.Fatal(err)
+	}
+	want := b.Archive["a"]
+
+	//Poison the cached hash of a to detect when it's used
+	cache, err = OpenHashCache(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	abs, _ := filepath.Abs(filepath.Join(root, "a"))
+	poisoned := cache.entries[abs]
+	poisoned.Hash = []byte("cached")
+	cache.entries[abs] = poisoned
+
+	b.SetHashCache(cache)
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b.Archive["a"], []byte("cached")) {
+		t.Error("expected unchanged file to use the cached hash")
+	}
+
+	//Verification always rehashes
+	report, err := b.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Valid() {
+		t.Error("expected verification to ignore the cache")
+	}
+
+	//A changed modification time rehashes the file
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(root, "a"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b.Archive["a"], want) {
+		t.Error("expected modified file to be rehashed")
+	}
+
+	//Entries hashed with another algorithm aren't used
+	b.FileHash = SHA256
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(b.Archive["a"], want) {
+		t.Error("expected sha512 cached hash to be ignored")
+	}
+	b.FileHash = SHA512
+
+	if err := ioutil.WriteFile(filepath.Join(root, "b"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(root, "b"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if pruned := cache.Prune(); pruned != 1 || cache.Len() != 1 {
+		t.Errorf("expected stale b to be pruned, pruned %d left %d", pruned, cache.Len())
+	}
+	if err := cache.Invalidate(root); err != nil || cache.Len() != 0 {
+		t.Errorf("expected invalidating the root to empty the cache, %d left %v", cache.Len(), err)
+	}
+	b.SetHashCache(nil)
+	cache.Clear()
+	if err := cache.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if cache, err = OpenHashCache(cachePath); err != nil || cache.Len() != 0 {
+		t.Errorf("expected saved cache to be empty, %v %v", cache, err)
+	}
+}
@@ -0,0 +1,222 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ChecksumFormat selects the line format used to export archive hashes
+type ChecksumFormat int
+
+const (
+	// SHA512SumFormat is the GNU coreutils sha*sum format "<hex>  <path>"
+	SHA512SumFormat ChecksumFormat = iota
+	// BSDFormat is the BSD tagged digest format "SHA512 (<path>) = <hex>"
+	BSDFormat
+)
+
+// ErrChecksumFormat is returned when importing a malformed checksum line
+var ErrChecksumFormat = errors.New("blockmap: malformed checksum line")
+
+// checksumHashes are the file hashes with a sha*sum tool by their BSD tag
+var checksumHashes = map[string]HashAlgorithm{
+	"SHA256": SHA256,
+	"SHA384": SHA384,
+	"SHA512": SHA512,
+}
+
+// checksumTag returns the BSD tag of a file hash, or false if no sha*sum
+// tool computes it
+func checksumTag(alg HashAlgorithm) (string, bool) {
+	for tag, hash := range checksumHashes {
+		if hash == alg {
+			return tag, true
+		}
+	}
+	return "", false
+}
+
+// ExportChecksums writes the hash of every archived file to w sorted by
+// path so the archive can be checked with standard tools such as
+// `sha512sum -c`, or the tool of the blockmap's file hash. Paths containing
+// a backslash or newline are escaped the way coreutils does, with a leading
+// backslash on the line. File hashes without a sha*sum tool, such as
+// BLAKE3, return ErrChecksumHash.
+func (b *BlockMap) ExportChecksums(w io.Writer, format ChecksumFormat) error {
+	tag, ok := checksumTag(b.FileHash)
+	if !ok {
+		return errors.Wrap(ErrChecksumHash, b.FileHash.String())
+	}
+	bw := bufio.NewWriter(w)
+	for _, path := range b.FilePaths() {
+		escaped, prefix := escapeChecksumPath(path)
+		sum := hex.EncodeToString(b.Digest(b.Archive[path]))
+		var err error
+		switch format {
+		case SHA512SumFormat:
+			_, err = fmt.Fprintf(bw, "%s%s  %s\n", prefix, sum, escaped)
+		case BSDFormat:
+			_, err = fmt.Fprintf(bw, "%s%s (%s) = %s\n", prefix, tag, escaped, sum)
+		default:
+			return errors.Wrapf(ErrUnknownChecksumFormat, "%d", format)
+		}
+		if err != nil {
+			return errors.Wrap(err, "blockmap: failed to write checksums")
+		}
+	}
+	return errors.Wrap(bw.Flush(), "blockmap: failed to write checksums")
+}
+
+// ImportChecksums reads SHA-256, SHA-384 or SHA-512 checksums in either
+// supported format and returns a hashed blockmap of them rooted at root,
+// using the checksums' algorithm as its file hash. The algorithm is taken
+// from the tag of BSD lines and the digest length of others, and every line
+// must use the same one. Blank lines are skipped.
+func ImportChecksums(r io.Reader, root string) (*BlockMap, error) {
+	b := New(root)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	found := false
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		path, alg, hash, err := parseChecksumLine(line)
+		if err == nil && found && alg != b.FileHash {
+			err = errors.Wrapf(ErrChecksumFormat, "mixed %s and %s checksums", b.FileHash, alg)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", lineNumber)
+		}
+		b.FileHash, found = alg, true
+		b.Archive[path] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "blockmap: failed to read checksums")
+	}
+
+	if err := b.hashBlockMap(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// parseChecksumLine splits a checksum line into its path, file hash and digest
+func parseChecksumLine(line string) (string, HashAlgorithm, []byte, error) {
+	escaped := strings.HasPrefix(line, "\\")
+	if escaped {
+		line = line[1:]
+	}
+
+	var path, sum, tag string
+	if open := strings.Index(line, " ("); open > 0 && checksumTagged(line[:open]) {
+		end := strings.LastIndex(line, ") = ")
+		if end < open+len(" (") {
+			return "", "", nil, ErrChecksumFormat
+		}
+		path, sum, tag = line[open+len(" ("):end], line[end+len(") = "):], line[:open]
+	} else {
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 || len(fields[1]) < 2 {
+			return "", "", nil, ErrChecksumFormat
+		}
+		//The second separator character is '*' for binary mode
+		sum, path = fields[0], fields[1][1:]
+	}
+
+	hash, err := hex.DecodeString(sum)
+	if err != nil || path == "" {
+		return "", "", nil, ErrChecksumFormat
+	}
+	alg, ok := checksumHashes[tag]
+	if tag == "" {
+		alg, ok = checksumLength(len(hash))
+	}
+	if !ok || !checksumSize(alg, len(hash)) {
+		return "", "", nil, ErrChecksumFormat
+	}
+	if escaped {
+		if path, err = unescapeChecksumPath(path); err != nil {
+			return "", "", nil, err
+		}
+	}
+	return path, alg, hash, nil
+}
+
+// checksumTagged returns true if tag is the BSD tag of a file hash
+func checksumTagged(tag string) bool {
+	_, ok := checksumHashes[tag]
+	return ok
+}
+
+// checksumLength returns the file hash of untagged checksums of size bytes
+func checksumLength(size int) (HashAlgorithm, bool) {
+	for _, alg := range checksumHashes {
+		if checksumSize(alg, size) {
+			return alg, true
+		}
+	}
+	return "", false
+}
+
+// checksumSize returns true if the file hash produces digests of size bytes
+func checksumSize(alg HashAlgorithm, size int) bool {
+	newHash, err := alg.Func()
+	return err == nil && newHash().Size() == size
+}
+
+// escapeChecksumPath escapes backslashes and newlines, returning the prefix
+// marking an escaped line
+func escapeChecksumPath(path string) (string, string) {
+	if !strings.ContainsAny(path, "\\\n\r") {
+		return path, ""
+	}
+	replacer := strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\r", "\\r")
+	return replacer.Replace(path), "\\"
+}
+
+func unescapeChecksumPath(path string) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] != '\\' {
+			sb.WriteByte(path[i])
+			continue
+		}
+		if i++; i == len(path) {
+			return "", ErrChecksumFormat
+		}
+		switch path[i] {
+		case '\\':
+			sb.WriteByte('\\')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		default:
+			return "", ErrChecksumFormat
+		}
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,135 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBlockMap_ExportChecksums(t *testing.T) {
+	root, err := ioutil.TempDir(tmpDir, "checksums")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := os.Mkdir(filepath.Join(root, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	names := []string{"a", "dir/b c", "new\nline"}
+	for _, name := range names {
+		if err := ioutil.WriteFile(filepath.Join(root, filepath.FromSlash(name)), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := New(root)
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+
+	sum := sha512.Sum512([]byte("a"))
+	expected := map[ChecksumFormat]string{
+		SHA512SumFormat: hex.EncodeToString(sum[:]) + "  a\n",
+		BSDFormat:       "SHA512 (a) = " + hex.EncodeToString(sum[:]) + "\n",
+	}
+	for format, line := range expected {
+		var buf bytes.Buffer
+		if err := b.ExportChecksums(&buf, format); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(buf.String(), line) {
+			t.Errorf("unexpected first line %q", strings.SplitN(buf.String(), "\n", 2)[0])
+		}
+		if !strings.Contains(buf.String(), "new\\nline") {
+			t.Error("special characters were not escaped", buf.String())
+		}
+
+		imported, err := ImportChecksums(&buf, root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !Equal(b, imported) {
+			t.Error("imported checksums do not match blockmap")
+		}
+	}
+
+	//Backslashes are escaped
+	escaped := New(root)
+	escaped.Archive["back\\slash"] = sum[:]
+	var buf bytes.Buffer
+	if err := escaped.ExportChecksums(&buf, SHA512SumFormat); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(buf.String(), "  back\\\\slash\n") || !strings.HasPrefix(buf.String(), "\\") {
+		t.Errorf("unexpected escaped line %q", buf.String())
+	}
+	if imported, err := ImportChecksums(&buf, root); err != nil || imported.Archive["back\\slash"] == nil {
+		t.Error("failed to import escaped path", err)
+	}
+
+	//Binary mode and CRLF lines are accepted
+	binary := hex.EncodeToString(sum[:]) + " *a\r\n"
+	if imported, err := ImportChecksums(strings.NewReader(binary), root); err != nil || len(imported.Archive) != 1 {
+		t.Error("failed to import binary mode checksum", err)
+	}
+
+	//Other file hashes are exported and imported with their own tool's checksums
+	sha := New(root, WithHash(SHA256))
+	if err := sha.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	short := sha256.Sum256([]byte("a"))
+	for format, line := range map[ChecksumFormat]string{
+		SHA512SumFormat: hex.EncodeToString(short[:]) + "  a\n",
+		BSDFormat:       "SHA256 (a) = " + hex.EncodeToString(short[:]) + "\n",
+	} {
+		var buf bytes.Buffer
+		if err := sha.ExportChecksums(&buf, format); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(buf.String(), line) {
+			t.Errorf("unexpected first line %q", strings.SplitN(buf.String(), "\n", 2)[0])
+		}
+		imported, err := ImportChecksums(&buf, root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if imported.FileHash != SHA256 || !Equal(sha, imported) {
+			t.Errorf("imported %s checksums do not match blockmap", imported.FileHash)
+		}
+	}
+	if err := New(root, WithHash(BLAKE3)).ExportChecksums(ioutil.Discard, BSDFormat); !errors.Is(err, ErrChecksumHash) {
+		t.Error("expected ErrChecksumHash, got", err)
+	}
+
+	mixed := hex.EncodeToString(sum[:]) + "  a\n" + hex.EncodeToString(short[:]) + "  b\n"
+	mislabelled := "SHA256 (a) = " + hex.EncodeToString(sum[:])
+	for _, line := range []string{"garbage", "abcd  a", "SHA512 (a) = zz", "\\" + hex.EncodeToString(sum[:]) + "  bad\\escape", mixed, mislabelled} {
+		if _, err := ImportChecksums(strings.NewReader(line), root); err == nil {
+			t.Errorf("expected error importing %q", line)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"github.com/govice/golinks/archivemap"
+	"github.com/govice/golinks/fs"
+	"github.com/pkg/errors"
+)
+
+// ChunkMode selects how large files are split into chunks
+type ChunkMode string
+
+const (
+	// FixedChunks splits files into chunks of a fixed size
+	FixedChunks ChunkMode = "fixed"
+	// CDCChunks splits files with FastCDC content defined chunking so
+	// insertions only change the chunks around them
+	CDCChunks ChunkMode = "cdc"
+)
+
+// Default chunking parameters
+const (
+	DefaultChunkSize      = 1024 * 1024
+	DefaultChunkThreshold = 8 * 1024 * 1024
+)
+
+// ChunkConfig records how file chunks were hashed. Size is the chunk size
+// for fixed chunking and the average chunk size for CDC. Files smaller than
+// Threshold aren't chunked.
+type ChunkConfig struct {
+	Mode      ChunkMode `json:"mode"`
+	Size      int       `json:"size"`
+	Threshold int64     `json:"threshold"`
+}
+
+// ErrNoChunks is returned when comparing chunks of entries hashed without chunking
+var ErrNoChunks = errors.New("blockmap: entry has no chunks")
+
+// SetChunking records chunk hashes alongside the whole file hash for files of
+// at least threshold bytes. Sizes less than 1 use the defaults and an empty
+// mode disables chunking. Chunks don't affect the root hash.
+func (b *BlockMap) SetChunking(mode ChunkMode, size int, threshold int64) {
+	if mode == "" {
+		b.Chunking = nil
+		return
+	}
+	if size < 1 {
+		size = DefaultChunkSize
+	}
+	if threshold < 1 {
+		threshold = DefaultChunkThreshold
+	}
+	b.Chunking = &ChunkConfig{Mode: mode, Size: size, Threshold: threshold}
+}
+
+// splitter returns the splitter used for a file of size bytes or nil if the
+// file shouldn't be chunked
+func (b *BlockMap) splitter(size int64) fs.Splitter {
+	if b.Chunking == nil || size < b.Chunking.Threshold {
+		return nil
+	}
+	switch b.Chunking.Mode {
+	case FixedChunks:
+		return fs.NewFixedSplitter(b.Chunking.Size)
+	case CDCChunks:
+		return fs.NewCDCSplitter(b.Chunking.Size)
+	}
+	return nil
+}
+
+// hashChunks hashes a job's file and its chunks
+func (b *BlockMap) hashChunks(job hashJob, splitter fs.Splitter) ([]byte, []archivemap.Chunk, error) {
+	hasher, err := b.hasher()
+	if err != nil {
+		return nil, nil, err
+	}
+	var (
+		fileHash []byte
+		chunks   []fs.Chunk
+	)
+	if b.fsys != nil {
+		fileHash, chunks, err = hasher.HashFSChunks(b.fsys, job.filePath, splitter)
+	} else {
+		fileHash, chunks, err = hasher.HashFileChunks(job.filePath, splitter)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entryChunks := make([]archivemap.Chunk, len(chunks))
+	for i, chunk := range chunks {
+		entryChunks[i] = archivemap.Chunk{Offset: chunk.Offset, Size: chunk.Size, Hash: chunk.Hash}
+	}
+	return fileHash, entryChunks, nil
+}
+
+// ChangedChunks returns the chunks of path in b whose content doesn't appear
+// anywhere in path's chunks in a. Both blockmaps must have been generated with
+// the same chunking configuration and file hash.
+func ChangedChunks(a, b *BlockMap, path string) ([]archivemap.Chunk, error) {
+	aEntry, bEntry := a.Entries[path], b.Entries[path]
+	if len(aEntry.Chunks) == 0 || len(bEntry.Chunks) == 0 {
+		return nil, errors.Wrap(ErrNoChunks, path)
+	}
+	if a.Chunking == nil || b.Chunking == nil || *a.Chunking != *b.Chunking || a.FileHash != b.FileHash {
+		return nil, ErrChunkingMismatch
+	}
+
+	known := make(map[string]bool, len(aEntry.Chunks))
+	for _, chunk := range aEntry.Chunks {
+		known[string(chunk.Hash)] = true
+	}
+	var changed []archivemap.Chunk
+	for _, chunk := range bEntry.Chunks {
+		if !known[string(chunk.Hash)] {
+			changed = append(changed, chunk)
+		}
+	}
+	return changed, nil
+}
@@ -0,0 +1,100 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBlockMap_SetChunking(t *testing.T) {
+	root, err := ioutil.TempDir(tmpDir, "chunking")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	large := make([]byte, 256*1024)
+	rand.New(rand.NewSource(1)).Read(large)
+	if err := ioutil.WriteFile(filepath.Join(root, "large"), large, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "small"), []byte("small"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	plain := New(root)
+	if err := plain.Generate(); err != nil {
+		t.Fatal(err)
+	}
+
+	b := New(root)
+	b.SetChunking(CDCChunks, 4096, 16*1024)
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plain.RootHash, b.RootHash) {
+		t.Error("chunking changed the root hash")
+	}
+	if len(b.Entries["large"].Chunks) < 2 || len(b.Entries["small"].Chunks) != 0 {
+		t.Errorf("unexpected chunks large %d small %d", len(b.Entries["large"].Chunks), len(b.Entries["small"].Chunks))
+	}
+
+	//Chunks and the chunking configuration survive a save and load
+	if err := b.Save(root); err != nil {
+		t.Fatal(err)
+	}
+	loaded := New(root)
+	if err := loaded.Load(root); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Chunking == nil || *loaded.Chunking != *b.Chunking ||
+		len(loaded.Entries["large"].Chunks) != len(b.Entries["large"].Chunks) {
+		t.Fatal("failed to reload chunks")
+	}
+
+	copy(large[100000:], []byte("modified region"))
+	if err := ioutil.WriteFile(filepath.Join(root, "large"), large, 0644); err != nil {
+		t.Fatal(err)
+	}
+	report, err := loaded.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := report.ChangedChunks["large"]
+	if len(changed) == 0 || len(changed) > 2 {
+		t.Fatalf("expected 1-2 changed chunks, got %+v", changed)
+	}
+	if changed[0].Offset > 100000 || changed[len(changed)-1].Offset+changed[len(changed)-1].Size < 100000+15 {
+		t.Errorf("changed chunks %+v don't cover the modified region", changed)
+	}
+
+	//Updating keeps chunks for unchanged files and rechunks modified ones
+	if err := loaded.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if chunks, err := ChangedChunks(b, loaded, "large"); err != nil || len(chunks) != len(changed) {
+		t.Errorf("unexpected changed chunks after update %v %v", chunks, err)
+	}
+	if _, err := ChangedChunks(b, loaded, "small"); err == nil {
+		t.Error("expected error comparing unchunked entries")
+	}
+}
@@ -0,0 +1,124 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+package blockmap
+
+import (
+	"bytes"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// CompareMode selects what Compare checks
+type CompareMode int
+
+const (
+	// ContentOnly compares archive paths and file hashes
+	ContentOnly CompareMode = iota
+	// ContentAndRoot also compares root hashes, which differ for equal
+	// content hashed with another mode or key
+	ContentAndRoot
+	// Strict also compares recorded metadata and the settings the blockmaps
+	// were generated with, including ignore lists
+	Strict
+)
+
+// ErrUnknownCompareMode is returned when comparing with an unsupported mode
+var ErrUnknownCompareMode = errors.New("blockmap: unknown compare mode")
+
+// Comparison is the result of comparing two blockmaps
+type Comparison struct {
+	Mode  CompareMode `json:"mode"`
+	Equal bool        `json:"equal"`
+	// Diff holds the archive paths that differ going from a to b
+	Diff *DiffResult `json:"diff"`
+	// RootHashMatches is only checked by ContentAndRoot and Strict
+	RootHashMatches bool `json:"rootHashMatches"`
+	// Metadata holds paths with equal hashes but differing entries, only checked by Strict
+	Metadata []string `json:"metadata,omitempty"`
+	// Settings holds the JSON names of differing settings, only checked by Strict
+	Settings []string `json:"settings,omitempty"`
+}
+
+// Compare compares a and b with mode
+func Compare(a, b *BlockMap, mode CompareMode) (*Comparison, error) {
+	if mode < ContentOnly || mode > Strict {
+		return nil, errors.Wrapf(ErrUnknownCompareMode, "%d", mode)
+	}
+
+	c := &Comparison{Mode: mode, Diff: Diff(a, b)}
+	c.Equal = c.Diff.Empty()
+	if mode == ContentOnly {
+		return c, nil
+	}
+
+	c.RootHashMatches = bytes.Equal(a.RootHash, b.RootHash)
+	c.Equal = c.Equal && c.RootHashMatches
+	if mode == ContentAndRoot {
+		return c, nil
+	}
+
+	c.Metadata = metadataChanges(a, b)
+	c.Settings = settingChanges(a, b)
+	c.Equal = c.Equal && len(c.Metadata) == 0 && len(c.Settings) == 0
+	return c, nil
+}
+
+// settingChanges returns the JSON names of the settings differing between a and b
+func settingChanges(a, b *BlockMap) []string {
+	settings := []struct {
+		name  string
+		equal bool
+	}{
+		{"root", a.Root == b.Root},
+		{"roots", reflect.DeepEqual(a.Roots, b.Roots) || len(a.Roots)+len(b.Roots) == 0},
+		{"ignorePaths", sameStrings(a.IgnorePaths, b.IgnorePaths)},
+		{"ignorePatterns", sameStrings(a.IgnorePatterns, b.IgnorePatterns)},
+		{"autoIgnore", a.AutoIgnore == b.AutoIgnore},
+		{"hashMode", a.HashMode == b.HashMode},
+		{"fileHash", a.FileHash == b.FileHash},
+		{"followSymlinks", a.FollowSymlinks == b.FollowSymlinks},
+		{"recordHardlinks", a.RecordHardlinks == b.RecordHardlinks},
+		{"sameDevice", a.SameDevice == b.SameDevice},
+		{"keyNormalization", sameNormalization(a.KeyNormalization, b.KeyNormalization)},
+		{"recordOwner", a.RecordOwner == b.RecordOwner},
+		{"recordDirectories", a.RecordDirectories == b.RecordDirectories},
+		{"keyed", a.Keyed == b.Keyed},
+		{"chunking", reflect.DeepEqual(a.Chunking, b.Chunking)},
+		{"ipfs", reflect.DeepEqual(a.IPFS, b.IPFS)},
+	}
+
+	var changed []string
+	for _, setting := range settings {
+		if !setting.equal {
+			changed = append(changed, setting.name)
+		}
+	}
+	return changed
+}
+
+// sameStrings returns true if a and b hold the same strings in order, treating nil as empty
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
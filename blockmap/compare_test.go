@@ -0,0 +1,80 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+package blockmap
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/govice/golinks/archivemap"
+)
+
+func TestCompare(t *testing.T) {
+	hashed := func(archive archivemap.ArchiveMap, opts ...Option) *BlockMap {
+		b := New("root", opts...)
+		b.Archive = archive
+		if err := b.hashBlockMap(); err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	a := hashed(archivemap.ArchiveMap{"a": []byte("1"), "b": []byte("2")})
+	same := hashed(archivemap.ArchiveMap{"a": []byte("1"), "b": []byte("2")})
+	tree := hashed(archivemap.ArchiveMap{"a": []byte("1"), "b": []byte("2")}, WithHashMode(TreeHashMode))
+	ignoring := hashed(archivemap.ArchiveMap{"a": []byte("1"), "b": []byte("2")}, WithIgnorePatterns("*.tmp"))
+	changed := hashed(archivemap.ArchiveMap{"a": []byte("1"), "c": []byte("3")})
+
+	tests := []struct {
+		name     string
+		other    *BlockMap
+		mode     CompareMode
+		equal    bool
+		settings []string
+	}{
+		{"identical strict", same, Strict, true, nil},
+		{"tree content", tree, ContentOnly, true, nil},
+		{"tree root", tree, ContentAndRoot, false, nil},
+		{"ignore lists content", ignoring, ContentAndRoot, true, nil},
+		{"ignore lists strict", ignoring, Strict, false, []string{"ignorePatterns"}},
+		{"changed content", changed, ContentOnly, false, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, err := Compare(a, test.other, test.mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Equal != test.equal || !reflect.DeepEqual(c.Settings, test.settings) {
+				t.Errorf("unexpected comparison %+v", c)
+			}
+		})
+	}
+
+	c, err := Compare(a, changed, ContentOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(c.Diff.Added, []string{"c"}) || !reflect.DeepEqual(c.Diff.Removed, []string{"b"}) {
+		t.Errorf("unexpected diff %+v", c.Diff)
+	}
+	if !Equal(a, same) || Equal(a, tree) {
+		t.Error("expected Equal to compare content and root hashes")
+	}
+	if _, err := Compare(a, same, CompareMode(7)); !errors.Is(err, ErrUnknownCompareMode) {
+		t.Errorf("expected unknown compare mode, got %v", err)
+	}
+}
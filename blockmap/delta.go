@@ -0,0 +1,263 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+package blockmap
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/govice/golinks/archivemap"
+	"github.com/pkg/errors"
+)
+
+// DeltaAction is what a copy engine does with a file to apply a delta
+type DeltaAction string
+
+const (
+	// DeltaCreate writes a file missing from the target
+	DeltaCreate DeltaAction = "create"
+	// DeltaUpdate rewrites a file present in the target with other content
+	DeltaUpdate DeltaAction = "update"
+)
+
+// ByteRange is a region of a file
+type ByteRange struct {
+	Offset int64 `json:"offset"`
+	Size   int64 `json:"size"`
+}
+
+// DeltaReuse is a region of a source file whose content is already present
+// in a file of the target and can be copied locally
+type DeltaReuse struct {
+	// Offset is the position of the region in the source file
+	Offset int64 `json:"offset"`
+	Size   int64 `json:"size"`
+	// Path is the target file holding the content at From
+	Path string `json:"path"`
+	From int64  `json:"from"`
+}
+
+// DeltaFile describes how to build one source file in the target. Transfer
+// and Reuse together cover the file in order of their offsets.
+type DeltaFile struct {
+	Path   string      `json:"path"`
+	Action DeltaAction `json:"action"`
+	// Size and Hash are the size and hash of the finished file
+	Size int64  `json:"size"`
+	Hash []byte `json:"hash"`
+	// Transfer are the ranges of the source file that must be sent
+	Transfer []ByteRange `json:"transfer,omitempty"`
+	// Reuse are the ranges copied from files already in the target
+	Reuse []DeltaReuse `json:"reuse,omitempty"`
+}
+
+// DeltaPlan lists the files to write and remove to bring a target tree up to
+// date with a source blockmap. Files whose content already matches are left
+// out. Reused ranges refer to the target as it was before the plan is
+// applied, so a copy engine must read them before overwriting or deleting
+// their files. Directory entries aren't part of the plan.
+type DeltaPlan struct {
+	Files  []DeltaFile `json:"files"`
+	Delete []string    `json:"delete"`
+	// TransferBytes is the total size of the ranges to send
+	TransferBytes int64 `json:"transferBytes"`
+	// ReuseBytes is the total size of the ranges copied within the target
+	ReuseBytes int64 `json:"reuseBytes"`
+	// Names maps paths of the plan to the names of their files where key
+	// normalization changed them, preferring the name in the target
+	Names map[string]string `json:"names,omitempty"`
+}
+
+// Name returns the name of the file at a path of the plan
+func (p *DeltaPlan) Name(path string) string {
+	if name, ok := p.Names[path]; ok {
+		return name
+	}
+	return path
+}
+
+// addName records the name of the file at path when it differs
+func (p *DeltaPlan) addName(path, name string) {
+	if path == name {
+		return
+	}
+	if p.Names == nil {
+		p.Names = make(map[string]string)
+	}
+	p.Names[path] = name
+}
+
+// PlanDelta computes the byte ranges of the files in source that must be
+// transferred to bring the tree described by target up to date. Chunk
+// hashes let modified files reuse every chunk already present anywhere in
+// the target, and whole files are reused when their content moved. Both
+// blockmaps must use the same file hash and, to reuse parts of files, the
+// same chunking.
+func PlanDelta(source, target *BlockMap) (*DeltaPlan, error) {
+	if source.FileHash != target.FileHash {
+		return nil, ErrChunkingMismatch
+	}
+	chunked := source.Chunking != nil && target.Chunking != nil
+	if chunked && *source.Chunking != *target.Chunking {
+		return nil, ErrChunkingMismatch
+	}
+
+	//Index where every whole file and chunk of the target can be copied from
+	index := newDeltaIndex(target, chunked)
+
+	plan := &DeltaPlan{}
+	for _, path := range source.FilePaths() {
+		hash := source.Archive[path]
+		targetHash, exists := target.Archive[path]
+		if exists && bytes.Equal(hash, targetHash) {
+			continue
+		}
+
+		entry := source.Entries[path]
+		file := DeltaFile{Path: path, Action: DeltaCreate, Size: entry.Size, Hash: hash}
+		if exists {
+			file.Action = DeltaUpdate
+			plan.addName(path, target.FileName(path))
+		} else {
+			plan.addName(path, source.FileName(path))
+		}
+		switch from, ok := index.file(path, hash); {
+		case entry.Size == 0:
+		case ok:
+			file.Reuse = []DeltaReuse{{Size: entry.Size, Path: from, From: 0}}
+		case chunked && len(entry.Chunks) > 0:
+			index.plan(&file, path, entry.Chunks)
+		default:
+			file.Transfer = []ByteRange{{Size: entry.Size}}
+		}
+		for _, r := range file.Transfer {
+			plan.TransferBytes += r.Size
+		}
+		for _, r := range file.Reuse {
+			plan.ReuseBytes += r.Size
+			plan.addName(r.Path, target.FileName(r.Path))
+		}
+		plan.Files = append(plan.Files, file)
+	}
+
+	for _, path := range target.FilePaths() {
+		if _, ok := source.Archive[path]; !ok {
+			plan.Delete = append(plan.Delete, path)
+			plan.addName(path, target.FileName(path))
+		}
+	}
+	return plan, nil
+}
+
+// PlanDeltaTo generates a blockmap of the tree at root with b's settings and
+// plans the delta bringing it up to date with b
+func (b *BlockMap) PlanDeltaTo(root string) (*DeltaPlan, error) {
+	target := b.emptyCopy()
+	target.Root = root
+	target.Roots = nil
+	target.fsys = nil
+	if err := target.Generate(); err != nil {
+		var ips *IgnoredPathErr
+		if !errors.As(err, &ips) {
+			return nil, err
+		}
+	}
+	return PlanDelta(b, target)
+}
+
+// deltaLocation is a region of a target file
+type deltaLocation struct {
+	path   string
+	offset int64
+}
+
+// deltaIndex locates content already present in a target
+type deltaIndex struct {
+	files  map[string][]string
+	chunks map[string]deltaLocation
+	// local holds the chunks of each target file so a file prefers reusing
+	// its own content
+	local map[string]map[string]int64
+}
+
+func newDeltaIndex(target *BlockMap, chunked bool) *deltaIndex {
+	index := &deltaIndex{
+		files:  make(map[string][]string),
+		chunks: make(map[string]deltaLocation),
+		local:  make(map[string]map[string]int64),
+	}
+	for _, path := range target.FilePaths() {
+		key := string(target.Archive[path])
+		index.files[key] = append(index.files[key], path)
+		if !chunked {
+			continue
+		}
+		local := make(map[string]int64)
+		for _, chunk := range target.Entries[path].Chunks {
+			key := string(chunk.Hash)
+			if _, ok := local[key]; !ok {
+				local[key] = chunk.Offset
+			}
+			if _, ok := index.chunks[key]; !ok {
+				index.chunks[key] = deltaLocation{path: path, offset: chunk.Offset}
+			}
+		}
+		index.local[path] = local
+	}
+	return index
+}
+
+// file returns a target file with the content hash, preferring path
+func (index *deltaIndex) file(path string, hash []byte) (string, bool) {
+	paths := index.files[string(hash)]
+	if len(paths) == 0 {
+		return "", false
+	}
+	if i := sort.SearchStrings(paths, path); i < len(paths) && paths[i] == path {
+		return path, true
+	}
+	return paths[0], true
+}
+
+// plan splits a chunked file into the chunks reused from the target and the
+// ranges to transfer, merging adjacent ranges
+func (index *deltaIndex) plan(file *DeltaFile, path string, chunks []archivemap.Chunk) {
+	for _, chunk := range chunks {
+		from, ok := deltaLocation{}, false
+		if offset, local := index.local[path][string(chunk.Hash)]; local {
+			from, ok = deltaLocation{path: path, offset: offset}, true
+		} else {
+			from, ok = index.chunks[string(chunk.Hash)]
+		}
+
+		if !ok {
+			if n := len(file.Transfer); n > 0 && file.Transfer[n-1].Offset+file.Transfer[n-1].Size == chunk.Offset {
+				file.Transfer[n-1].Size += chunk.Size
+			} else {
+				file.Transfer = append(file.Transfer, ByteRange{Offset: chunk.Offset, Size: chunk.Size})
+			}
+			continue
+		}
+		if n := len(file.Reuse); n > 0 {
+			last := &file.Reuse[n-1]
+			if last.Path == from.path && last.Offset+last.Size == chunk.Offset && last.From+last.Size == from.offset {
+				last.Size += chunk.Size
+				continue
+			}
+		}
+		file.Reuse = append(file.Reuse, DeltaReuse{Offset: chunk.Offset, Size: chunk.Size, Path: from.path, From: from.offset})
+	}
+}
@@ -0,0 +1,117 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+package blockmap
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBlockMap_PlanDeltaTo(t *testing.T) {
+	dir, err := ioutil.TempDir(tmpDir, "delta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	source, target := filepath.Join(dir, "source"), filepath.Join(dir, "target")
+	random := rand.New(rand.NewSource(1))
+	content := func(n int) []byte {
+		data := make([]byte, n)
+		random.Read(data)
+		return data
+	}
+	write := func(root, name string, data []byte) {
+		if err := os.MkdirAll(root, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(root, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	large, moved := content(64<<10), content(10<<10)
+	modified := append([]byte{}, large...)
+	copy(modified[12<<10:], content(4<<10))
+	write(source, "large", large)
+	write(source, "moved", moved)
+	write(source, "new", []byte("new"))
+	write(source, "same", []byte("same"))
+	write(target, "large", modified)
+	write(target, "renamed", moved)
+	write(target, "same", []byte("same"))
+	write(target, "stale", []byte("stale"))
+
+	b := New(source)
+	b.SetChunking(FixedChunks, 4096, 8192)
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	plan, err := b.PlanDeltaTo(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(plan.Files) != 3 || !reflect.DeepEqual(plan.Delete, []string{"renamed", "stale"}) {
+		t.Fatalf("unexpected plan %+v", plan)
+	}
+	largeFile := plan.Files[0]
+	if largeFile.Action != DeltaUpdate || !reflect.DeepEqual(largeFile.Transfer, []ByteRange{{Offset: 12 << 10, Size: 4 << 10}}) ||
+		len(largeFile.Reuse) != 2 {
+		t.Errorf("unexpected delta of large %+v", largeFile)
+	}
+	if movedFile := plan.Files[1]; movedFile.Action != DeltaCreate || len(movedFile.Transfer) != 0 ||
+		!reflect.DeepEqual(movedFile.Reuse, []DeltaReuse{{Size: 10 << 10, Path: "renamed"}}) {
+		t.Errorf("unexpected delta of moved %+v", movedFile)
+	}
+	if plan.TransferBytes != 4<<10+3 || plan.ReuseBytes != 60<<10+10<<10 {
+		t.Errorf("unexpected totals %d %d", plan.TransferBytes, plan.ReuseBytes)
+	}
+
+	//Applying the plan rebuilds every source file
+	for _, file := range plan.Files {
+		built := make([]byte, file.Size)
+		src, err := ioutil.ReadFile(filepath.Join(source, file.Path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range file.Transfer {
+			copy(built[r.Offset:], src[r.Offset:r.Offset+r.Size])
+		}
+		for _, r := range file.Reuse {
+			from, err := ioutil.ReadFile(filepath.Join(target, r.Path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			copy(built[r.Offset:], from[r.From:r.From+r.Size])
+		}
+		if !bytes.Equal(built, src) {
+			t.Errorf("applying the delta of %s doesn't rebuild it", file.Path)
+		}
+	}
+
+	other := New(target, WithHash(SHA256))
+	if err := other.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PlanDelta(b, other); err != ErrChunkingMismatch {
+		t.Errorf("expected ErrChunkingMismatch, got %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"bytes"
+	pathpkg "path"
+	"sort"
+)
+
+// DiffResult describes the archive paths that differ between two blockmaps
+type DiffResult struct {
+	Added    []string `json:"added"`
+	Removed  []string `json:"removed"`
+	Modified []string `json:"modified"`
+	// Renamed is only populated by DiffRenames
+	Renamed []Rename `json:"renamed,omitempty"`
+}
+
+// Rename is a file whose content is unchanged but whose path moved
+type Rename struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Empty returns true if the compared blockmaps have no differing paths
+func (d *DiffResult) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Modified) == 0 && len(d.Renamed) == 0
+}
+
+// Diff reports the paths added, removed and modified going from a to b.
+// Paths in each list are sorted alphabetically.
+func Diff(a, b *BlockMap) *DiffResult {
+	result := &DiffResult{}
+	for path, aHash := range a.Archive {
+		bHash, ok := b.Archive[path]
+		if !ok {
+			result.Removed = append(result.Removed, path)
+			continue
+		}
+
+		if !bytes.Equal(aHash, bHash) {
+			result.Modified = append(result.Modified, path)
+		}
+	}
+
+	for path := range b.Archive {
+		if _, ok := a.Archive[path]; !ok {
+			result.Added = append(result.Added, path)
+		}
+	}
+
+	sort.Strings(result.Added)
+	sort.Strings(result.Removed)
+	sort.Strings(result.Modified)
+	return result
+}
+
+// DiffRenames is like Diff but reports removed paths whose content reappears
+// at an added path as renames rather than a removal and an addition. When
+// several paths share content, candidates with the same base name are paired
+// first, then the remaining paths in alphabetical order. Directory entries
+// are never paired.
+func DiffRenames(a, b *BlockMap) *DiffResult {
+	result := Diff(a, b)
+
+	added := make(map[string][]string)
+	for _, path := range result.Added {
+		if IsDirectory(path) {
+			continue
+		}
+		key := string(b.Archive[path])
+		added[key] = append(added[key], path)
+	}
+
+	paired := make(map[string]bool)
+	var removed []string
+	for _, from := range result.Removed {
+		var candidates []string
+		if !IsDirectory(from) {
+			candidates = added[string(a.Archive[from])]
+		}
+		match := -1
+		for i, to := range candidates {
+			if pathpkg.Base(to) == pathpkg.Base(from) {
+				match = i
+				break
+			}
+		}
+		if match < 0 && len(candidates) > 0 {
+			match = 0
+		}
+		if match < 0 {
+			removed = append(removed, from)
+			continue
+		}
+
+		to := candidates[match]
+		added[string(a.Archive[from])] = append(candidates[:match:match], candidates[match+1:]...)
+		paired[to] = true
+		result.Renamed = append(result.Renamed, Rename{From: from, To: to})
+	}
+
+	var remaining []string
+	for _, path := range result.Added {
+		if !paired[path] {
+			remaining = append(remaining, path)
+		}
+	}
+	result.Added = remaining
+	result.Removed = removed
+	return result
+}
@@ -0,0 +1,104 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/govice/golinks/archivemap"
+)
+
+func TestDiff(t *testing.T) {
+	a := New(tmpDir)
+	a.Archive = archivemap.ArchiveMap{
+		"same":     []byte("1"),
+		"modified": []byte("2"),
+		"removed":  []byte("3"),
+	}
+
+	b := New(tmpDir)
+	b.Archive = archivemap.ArchiveMap{
+		"same":     []byte("1"),
+		"modified": []byte("changed"),
+		"added":    []byte("4"),
+	}
+
+	diff := Diff(a, b)
+	if diff.Empty() {
+		t.Error("expected differences between blockmaps")
+	}
+	if !reflect.DeepEqual(diff.Added, []string{"added"}) {
+		t.Error("unexpected added paths", diff.Added)
+	}
+	if !reflect.DeepEqual(diff.Removed, []string{"removed"}) {
+		t.Error("unexpected removed paths", diff.Removed)
+	}
+	if !reflect.DeepEqual(diff.Modified, []string{"modified"}) {
+		t.Error("unexpected modified paths", diff.Modified)
+	}
+
+	if !Diff(a, a).Empty() {
+		t.Error("expected no differences comparing a blockmap to itself")
+	}
+}
+
+func TestDiffRenames(t *testing.T) {
+	a := New(tmpDir)
+	a.Archive = archivemap.ArchiveMap{
+		"same":        []byte("1"),
+		"old/name":    []byte("2"),
+		"removed":     []byte("3"),
+		"dup/one":     []byte("4"),
+		"dup/two":     []byte("4"),
+		"dup/changed": []byte("5"),
+	}
+
+	b := New(tmpDir)
+	b.Archive = archivemap.ArchiveMap{
+		"same":        []byte("1"),
+		"new/name":    []byte("2"),
+		"added":       []byte("6"),
+		"moved/two":   []byte("4"),
+		"moved/one":   []byte("4"),
+		"dup/changed": []byte("7"),
+	}
+
+	diff := DiffRenames(a, b)
+	expected := []Rename{
+		{From: "dup/one", To: "moved/one"},
+		{From: "dup/two", To: "moved/two"},
+		{From: "old/name", To: "new/name"},
+	}
+	if !reflect.DeepEqual(diff.Renamed, expected) {
+		t.Error("unexpected renames", diff.Renamed)
+	}
+	if !reflect.DeepEqual(diff.Added, []string{"added"}) {
+		t.Error("unexpected added paths", diff.Added)
+	}
+	if !reflect.DeepEqual(diff.Removed, []string{"removed"}) {
+		t.Error("unexpected removed paths", diff.Removed)
+	}
+	if !reflect.DeepEqual(diff.Modified, []string{"dup/changed"}) {
+		t.Error("unexpected modified paths", diff.Modified)
+	}
+
+	//Plain Diff still reports renames as removals and additions
+	if plain := Diff(a, b); len(plain.Renamed) != 0 || len(plain.Added) != 4 {
+		t.Error("unexpected plain diff", plain)
+	}
+}
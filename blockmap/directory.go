@@ -0,0 +1,70 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+package blockmap
+
+import (
+	"os"
+	"strings"
+)
+
+// directoryContent is hashed with the file hash algorithm to give every
+// directory entry the same hash
+const directoryContent = "golinks:directory"
+
+// SetRecordDirectories records every directory under the root, including
+// empty ones, as an archive key ending in "/" so the shape of the tree is
+// part of the root hash. Ignored directories are never recorded.
+func (b *BlockMap) SetRecordDirectories(enabled bool) {
+	b.RecordDirectories = enabled
+}
+
+// IsDirectory returns true if key is the archive key of a directory
+func IsDirectory(key string) bool {
+	return strings.HasSuffix(key, "/")
+}
+
+// directoryHash returns the hash recorded for every directory
+func (b *BlockMap) directoryHash() ([]byte, error) {
+	newHash, err := b.FileHash.Func()
+	if err != nil {
+		return nil, err
+	}
+	h := newHash()
+	h.Write([]byte(directoryContent))
+	return h.Sum(nil), nil
+}
+
+// directoryJob returns the job recording the directory at relPath. Sizes and
+// modification times of directories change with their contents so only the
+// mode and owner are recorded.
+func (b *BlockMap) directoryJob(filePath, relPath string, info os.FileInfo) hashJob {
+	entry := b.newEntry(info)
+	entry.Size, entry.ModTime = 0, 0
+	return hashJob{filePath: filePath, relPath: relPath + "/", entry: entry, dir: true}
+}
+
+// FilePaths returns the sorted archive keys of files, leaving out directory
+// entries recorded by SetRecordDirectories
+func (b *BlockMap) FilePaths() []string {
+	keys := b.Archive.SortedKeys()
+	files := keys[:0]
+	for _, key := range keys {
+		if !IsDirectory(key) {
+			files = append(files, key)
+		}
+	}
+	return files
+}
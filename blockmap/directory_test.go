@@ -0,0 +1,114 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+package blockmap
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestBlockMap_RecordDirectories(t *testing.T) {
+	root, err := ioutil.TempDir(tmpDir, "directories")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for _, dir := range []string{"a/b", "ignored"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "a", "file"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	files := New(root)
+	if err := files.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	b := New(root, WithRecordDirectories(), WithIgnorePatterns("ignored/"))
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a/", "a/b/", "a/file"}; !reflect.DeepEqual(b.Archive.SortedKeys(), want) {
+		t.Fatalf("expected keys %v, got %v", want, b.Archive.SortedKeys())
+	}
+	if !reflect.DeepEqual(b.FilePaths(), []string{"a/file"}) {
+		t.Errorf("unexpected file paths %v", b.FilePaths())
+	}
+	if bytes.Equal(b.RootHash, files.RootHash) {
+		t.Error("expected directories to change the root hash")
+	}
+	if len(b.Duplicates()) != 0 {
+		t.Errorf("expected directories not to be duplicates %v", b.Duplicates())
+	}
+	tree, err := b.Tree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node := tree.Find("a/b"); node == nil || !node.IsDir() {
+		t.Errorf("expected empty directory in the tree, got %v", node)
+	}
+
+	//Adding or removing an empty directory fails verification
+	if err := os.Mkdir(filepath.Join(root, "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(root, "a", "b")); err != nil {
+		t.Fatal(err)
+	}
+	report, err := b.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Valid() || !reflect.DeepEqual(report.Added, []string{"empty/"}) || !reflect.DeepEqual(report.Missing, []string{"a/b/"}) {
+		t.Errorf("expected directory changes to be reported %+v", report)
+	}
+
+	changes, err := b.UpdatePath("empty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Path != "empty/" {
+		t.Errorf("expected the added directory, got %+v", changes)
+	}
+	if _, err := b.UpdatePath("a"); err != nil {
+		t.Fatal(err)
+	}
+	if report, err := b.Verify(); err != nil || !report.Valid() {
+		t.Errorf("expected updated blockmap to verify %+v %v", report, err)
+	}
+}
+
+func TestBlockMap_RecordDirectoriesFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/file": {Data: []byte("a")},
+		"empty":  {Mode: os.ModeDir | 0755},
+		"skip/x": {Data: []byte("x")},
+	}
+	b := New("", WithFS(fsys), WithRecordDirectories(), WithIgnorePatterns("skip/"))
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a/", "a/file", "empty/"}; !reflect.DeepEqual(b.Archive.SortedKeys(), want) {
+		t.Errorf("expected keys %v, got %v", want, b.Archive.SortedKeys())
+	}
+}
@@ -0,0 +1,46 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"encoding/hex"
+	"sort"
+)
+
+// Duplicates groups archive paths with identical content. Keys are hex
+// encoded file hashes and each group holds two or more paths sorted
+// alphabetically. Unique files are not included.
+func (b *BlockMap) Duplicates() map[string][]string {
+	index := make(map[string][]string, len(b.Archive))
+	for path, hash := range b.Archive {
+		if IsDirectory(path) {
+			continue
+		}
+		key := string(hash)
+		index[key] = append(index[key], path)
+	}
+
+	duplicates := make(map[string][]string)
+	for key, paths := range index {
+		if len(paths) < 2 {
+			continue
+		}
+		sort.Strings(paths)
+		duplicates[hex.EncodeToString([]byte(key))] = paths
+	}
+	return duplicates
+}
@@ -0,0 +1,49 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"github.com/govice/golinks/archivemap"
+)
+
+func TestBlockMap_Duplicates(t *testing.T) {
+	b := New("")
+	b.Archive = archivemap.ArchiveMap{
+		"a":     []byte{1},
+		"dir/a": []byte{1},
+		"b":     []byte{2},
+		"c":     []byte{3},
+		"dir/c": []byte{3},
+		"z/c":   []byte{3},
+	}
+
+	expected := map[string][]string{
+		hex.EncodeToString([]byte{1}): {"a", "dir/a"},
+		hex.EncodeToString([]byte{3}): {"c", "dir/c", "z/c"},
+	}
+	if duplicates := b.Duplicates(); !reflect.DeepEqual(duplicates, expected) {
+		t.Errorf("expected %v, got %v", expected, duplicates)
+	}
+
+	if duplicates := New("").Duplicates(); len(duplicates) != 0 {
+		t.Errorf("expected no duplicates, got %v", duplicates)
+	}
+}
@@ -0,0 +1,185 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/govice/golinks/codec"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2id parameters used to derive encryption keys from passphrases
+const (
+	encryptionTime    uint32 = 3
+	encryptionMemory  uint32 = 64 * 1024
+	encryptionThreads uint8  = 4
+	encryptionSaltLen int    = 16
+	encryptionKeyLen  uint32 = 32
+
+	//Upper bounds accepted when reading parameters back from a link header
+	maxEncryptionTime   uint32 = 16
+	maxEncryptionMemory uint32 = 1024 * 1024
+)
+
+// encryptedMagic prefixes encrypted link files
+var encryptedMagic = []byte("GLNKENC")
+
+// encryptedVersion is the version of the encrypted link layout
+const encryptedVersion byte = 1
+
+var (
+	// ErrEncryptedLink is returned by Load when the link file is encrypted
+	ErrEncryptedLink = errors.New("blockmap: link file is encrypted")
+	// ErrDecryptLink is returned when an encrypted link can't be decrypted
+	ErrDecryptLink = errors.New("blockmap: failed to decrypt link file, wrong passphrase or corrupt file")
+)
+
+// SaveEncrypted stores the blockmap in the default OutputFile encrypted with
+// AES-256-GCM using a key derived from passphrase with Argon2id. The layout is
+// the magic "GLNKENC", a version byte, the Argon2id time, memory and thread
+// parameters, a random salt and nonce, followed by the sealed JSON link.
+func (b BlockMap) SaveEncrypted(path string, passphrase []byte) error {
+	if b.RootHash == nil {
+		return ErrUnhashed
+	}
+
+	plaintext, err := codec.Encode(codec.JSON, b)
+	if err != nil {
+		return errors.Wrap(err, "blockmap: failed to encode link json")
+	}
+
+	salt := make([]byte, encryptionSaltLen)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return errors.Wrap(err, "blockmap: failed to generate salt")
+	}
+
+	var header bytes.Buffer
+	header.Write(encryptedMagic)
+	header.WriteByte(encryptedVersion)
+	binary.Write(&header, binary.BigEndian, encryptionTime)
+	binary.Write(&header, binary.BigEndian, encryptionMemory)
+	header.WriteByte(encryptionThreads)
+	header.Write(salt)
+
+	aead, err := newLinkCipher(passphrase, salt, encryptionTime, encryptionMemory, encryptionThreads)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return errors.Wrap(err, "blockmap: failed to generate nonce")
+	}
+	header.Write(nonce)
+
+	//The header is authenticated so parameters can't be altered
+	sealed := aead.Seal(header.Bytes(), nonce, plaintext, header.Bytes())
+	linkFilePath := path + string(os.PathSeparator) + OutputName
+	return b.audited(linkFilePath, func() error {
+		return writeLink(linkFilePath, 0600, b.backups, writeBytes(sealed))
+	})
+}
+
+// LoadEncrypted reads a blockmap saved with SaveEncrypted from the default OutputFile
+func (b *BlockMap) LoadEncrypted(path string, passphrase []byte) error {
+	linkFilePath := path + string(os.PathSeparator) + OutputName
+	data, err := ioutil.ReadFile(linkFilePath)
+	if err != nil {
+		return &PathError{Op: "read", Path: linkFilePath, Err: err}
+	}
+
+	plaintext, err := decryptLink(data, passphrase)
+	if err != nil {
+		return err
+	}
+	if err := b.Decode(plaintext); err != nil {
+		return &PathError{Op: "decode", Path: linkFilePath, Err: err}
+	}
+	return nil
+}
+
+// isEncryptedLink returns true if data was written by SaveEncrypted
+func isEncryptedLink(data []byte) bool {
+	return bytes.HasPrefix(data, encryptedMagic)
+}
+
+func decryptLink(data, passphrase []byte) ([]byte, error) {
+	if !isEncryptedLink(data) {
+		return nil, ErrNotEncrypted
+	}
+
+	r := bytes.NewReader(data[len(encryptedMagic):])
+	var (
+		version byte
+		time    uint32
+		memory  uint32
+		threads byte
+	)
+	if err := binary.Read(r, binary.BigEndian, &version); err != nil || version != encryptedVersion {
+		return nil, errors.Wrap(ErrDecryptLink, "unsupported version")
+	}
+	binary.Read(r, binary.BigEndian, &time)
+	binary.Read(r, binary.BigEndian, &memory)
+	if err := binary.Read(r, binary.BigEndian, &threads); err != nil {
+		return nil, ErrDecryptLink
+	}
+	if time == 0 || time > maxEncryptionTime || memory == 0 || memory > maxEncryptionMemory || threads == 0 {
+		return nil, errors.Wrap(ErrDecryptLink, "invalid key derivation parameters")
+	}
+
+	salt := make([]byte, encryptionSaltLen)
+	if _, err := io.ReadFull(r, salt); err != nil {
+		return nil, ErrDecryptLink
+	}
+
+	aead, err := newLinkCipher(passphrase, salt, time, memory, threads)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(r, nonce); err != nil {
+		return nil, ErrDecryptLink
+	}
+
+	headerLen := len(data) - r.Len()
+	plaintext, err := aead.Open(nil, nonce, data[headerLen:], data[:headerLen])
+	if err != nil {
+		return nil, ErrDecryptLink
+	}
+	return plaintext, nil
+}
+
+func newLinkCipher(passphrase, salt []byte, time, memory uint32, threads uint8) (cipher.AEAD, error) {
+	key := argon2.IDKey(passphrase, salt, time, memory, threads, encryptionKeyLen)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "blockmap: failed to create cipher")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "blockmap: failed to create cipher")
+	}
+	return aead, nil
+}
@@ -0,0 +1,80 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBlockMap_SaveEncrypted(t *testing.T) {
+	root, err := ioutil.TempDir(tmpDir, "encrypted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	if err := ioutil.WriteFile(filepath.Join(root, "secret-name"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b := New(root)
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+
+	passphrase := []byte("correct horse battery staple")
+	if err := b.SaveEncrypted(root, passphrase); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(root, OutputName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("secret-name")) {
+		t.Error("encrypted link leaks archive paths")
+	}
+
+	loaded := New(root)
+	if err := loaded.LoadEncrypted(root, passphrase); err != nil {
+		t.Fatal(err)
+	}
+	if !Equal(b, loaded) {
+		t.Error("failed to reload encrypted blockmap")
+	}
+
+	if err := New(root).LoadEncrypted(root, []byte("wrong")); !errors.Is(err, ErrDecryptLink) {
+		t.Error("expected decrypt error with wrong passphrase, got", err)
+	}
+	if err := New(root).Load(root); !errors.Is(err, ErrEncryptedLink) {
+		t.Error("expected encrypted link error loading without passphrase, got", err)
+	}
+
+	//Tampering with the header must be detected
+	data[len(encryptedMagic)+1] ^= 0xff
+	if err := ioutil.WriteFile(filepath.Join(root, OutputName), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := New(root).LoadEncrypted(root, passphrase); err == nil {
+		t.Error("expected tampered link to fail decryption")
+	}
+}
@@ -0,0 +1,202 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+package blockmap
+
+import (
+	"bytes"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/govice/golinks/archivemap"
+	"github.com/pkg/errors"
+)
+
+// FileEntry is the archived hash and metadata of a single path
+type FileEntry struct {
+	Path string `json:"path"`
+	Hash []byte `json:"hash"`
+	archivemap.Entry
+}
+
+// FileVerification describes how a single archived path differs from the
+// filesystem
+type FileVerification struct {
+	Path string `json:"path"`
+	// Expected is the archived hash of the path
+	Expected []byte `json:"expected"`
+	// Actual is the current hash of the path, nil when it is missing
+	Actual []byte `json:"actual,omitempty"`
+	// Missing is true when the path no longer exists as a regular file
+	Missing bool `json:"missing"`
+	// Modified is true when the content hash changed
+	Modified bool `json:"modified"`
+	// Metadata is true when the content is unchanged but permissions or
+	// ownership changed
+	Metadata bool `json:"metadata"`
+}
+
+// Valid returns true if the path matches its archived entry
+func (v *FileVerification) Valid() bool {
+	return !v.Missing && !v.Modified && !v.Metadata
+}
+
+// Entry returns the archived hash and metadata of a path relative to the root.
+// Metadata is empty for links generated before it was recorded.
+func (b *BlockMap) Entry(relPath string) (*FileEntry, error) {
+	key := b.normalizeKey(cleanRelPath(relPath))
+	if strings.HasSuffix(relPath, "/") {
+		key += "/"
+	}
+	hash, ok := b.Archive[key]
+	if !ok && b.RecordDirectories {
+		key += "/"
+		hash, ok = b.Archive[key]
+	}
+	if !ok {
+		return nil, errors.Wrap(ErrPathNotArchived, relPath)
+	}
+	return &FileEntry{
+		Path:  key,
+		Hash:  append([]byte{}, hash...),
+		Entry: b.Entries[key],
+	}, nil
+}
+
+// FileName returns the path below the root of the file archived as key,
+// which differs from key when key normalization changed it. Recorded names
+// that don't normalize to key are ignored.
+func (b *BlockMap) FileName(key string) string {
+	entry, ok := b.Entries[key]
+	if !ok && b.store != nil {
+		_, entry, _, _ = b.store.Get(key)
+	}
+	if entry.Name != "" && b.normalizeKey(entry.Name) == key {
+		return entry.Name
+	}
+	return key
+}
+
+// FilePath returns the path on the filesystem of the file archived as key,
+// or its path within the FS of blockmaps generated from one
+func (b *BlockMap) FilePath(key string) (string, error) {
+	root, _, subPath, err := b.resolvePath(b.FileName(key))
+	if err != nil {
+		return "", err
+	}
+	if b.fsys != nil {
+		return subPath, nil
+	}
+	return filepath.Join(root, filepath.FromSlash(subPath)), nil
+}
+
+// Open opens the file archived as key
+func (b *BlockMap) Open(key string) (io.ReadCloser, error) {
+	path, err := b.FilePath(key)
+	if err != nil {
+		return nil, err
+	}
+	if b.fsys != nil {
+		return b.fsys.Open(path)
+	}
+	return os.Open(path)
+}
+
+// VerifyFile re-hashes a single archived path and compares it against its
+// archived entry without walking the rest of the root. The blockmap itself
+// is not modified.
+func (b *BlockMap) VerifyFile(relPath string) (*FileVerification, error) {
+	entry, err := b.Entry(relPath)
+	if err != nil {
+		return nil, err
+	}
+	result := &FileVerification{Path: entry.Path, Expected: entry.Hash}
+
+	//Hash with a fresh copy so the hash cache can't answer for the file
+	current := b.emptyCopy()
+	job, err := current.fileJob(cleanRelPath(b.FileName(entry.Path)), entry.Path)
+	if os.IsNotExist(errors.Cause(err)) {
+		result.Missing = true
+		return result, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		result.Missing = true
+		return result, nil
+	}
+
+	hash, chunks, err := current.hashJobFile(*job)
+	if os.IsNotExist(errors.Cause(err)) {
+		result.Missing = true
+		return result, nil
+	} else if err != nil {
+		return nil, &PathError{Op: "hash", Path: job.filePath, Err: err}
+	}
+	job.entry.Chunks = chunks
+	result.Actual = hash
+	result.Modified = !bytes.Equal(entry.Hash, hash)
+	if _, ok := b.Entries[entry.Path]; ok && !result.Modified {
+		result.Metadata = !entry.Entry.MetadataEqual(job.entry)
+	}
+	return result, nil
+}
+
+// fileJob returns the hash job of the archive key stored for relPath, or nil
+// when the path on the filesystem is no longer hashed as that key
+func (b *BlockMap) fileJob(relPath, key string) (*hashJob, error) {
+	root, _, subPath, err := b.resolvePath(relPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var filePath string
+	var info os.FileInfo
+	if b.fsys != nil {
+		filePath = subPath
+		info, err = iofs.Stat(b.fsys, filePath)
+	} else {
+		filePath = filepath.Join(root, filepath.FromSlash(subPath))
+		if b.FollowSymlinks {
+			info, err = os.Stat(filePath)
+		} else {
+			info, err = os.Lstat(filePath)
+		}
+	}
+	if err != nil {
+		return nil, &PathError{Op: "stat", Path: filePath, Err: err}
+	}
+
+	if IsDirectory(key) {
+		if !info.IsDir() {
+			return nil, nil
+		}
+		job := b.directoryJob(filePath, strings.TrimSuffix(key, "/"), info)
+		return &job, nil
+	}
+	if !info.Mode().IsRegular() {
+		return nil, nil
+	}
+	return &hashJob{filePath: filePath, relPath: key, entry: b.newEntry(info)}, nil
+}
+
+// cleanRelPath returns a path relative to the root with / separators and no
+// leading or trailing separator
+func cleanRelPath(relPath string) string {
+	return strings.Trim(strings.Replace(filepath.ToSlash(relPath), "\\", "/", -1), "/")
+}
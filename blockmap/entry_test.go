@@ -0,0 +1,89 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+package blockmap
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestBlockMap_EntryVerifyFile(t *testing.T) {
+	root, err := ioutil.TempDir(tmpDir, "entry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	write := func(name, content string) {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a", "a")
+	write("dir/b", "b")
+	write("dir/c", "c")
+
+	b := New(root, WithRecordDirectories())
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err := b.Entry("dir/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Path != "dir/b" || !bytes.Equal(entry.Hash, b.Archive["dir/b"]) || entry.Size != 1 {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+	if entry, err := b.Entry("dir"); err != nil || entry.Path != "dir/" {
+		t.Errorf("expected directory entry, got %+v %v", entry, err)
+	}
+	if _, err := b.Entry("missing"); errors.Cause(err) != ErrPathNotArchived {
+		t.Errorf("expected ErrPathNotArchived, got %v", err)
+	}
+
+	for _, path := range []string{"a", "dir/b", "dir"} {
+		if result, err := b.VerifyFile(path); err != nil || !result.Valid() {
+			t.Errorf("expected %s to verify, got %+v %v", path, result, err)
+		}
+	}
+
+	write("a", "modified")
+	if err := os.Remove(filepath.Join(root, "dir", "b")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(root, "dir", "c"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	result, err := b.VerifyFile("a")
+	if err != nil || !result.Modified || result.Actual == nil || bytes.Equal(result.Actual, result.Expected) {
+		t.Errorf("expected modified a, got %+v %v", result, err)
+	}
+	if result, err := b.VerifyFile("dir/b"); err != nil || !result.Missing {
+		t.Errorf("expected missing dir/b, got %+v %v", result, err)
+	}
+	if result, err := b.VerifyFile("dir/c"); err != nil || result.Modified || !result.Metadata {
+		t.Errorf("expected metadata change to dir/c, got %+v %v", result, err)
+	}
+}
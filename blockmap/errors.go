@@ -0,0 +1,111 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Errors returned by blockmap operations, matched with errors.Is
+var (
+	// ErrNilArchive is returned when hashing or building a tree of a blockmap
+	// without an archive
+	ErrNilArchive = errors.New("blockmap: archive is nil")
+	// ErrEmptyArchive is returned when building a merkle tree of an empty archive
+	ErrEmptyArchive = errors.New("blockmap: archive is empty")
+	// ErrUnhashed is returned when saving a blockmap without a root hash
+	ErrUnhashed = errors.New("blockmap: blockmap is unhashed")
+	// ErrNotOSRoot is returned by operations requiring an OS filesystem root
+	ErrNotOSRoot = errors.New("blockmap: operation requires an OS root")
+	// ErrOutsideRoot is returned for paths that aren't below the root
+	ErrOutsideRoot = errors.New("blockmap: path is not below the root")
+	// ErrNotDirectory is returned when generating a subtree of a path that
+	// isn't a directory
+	ErrNotDirectory = errors.New("blockmap: path is not a directory")
+	// ErrChunkingMismatch is returned when comparing chunks of blockmaps
+	// generated with different chunking or file hashes
+	ErrChunkingMismatch = errors.New("blockmap: blockmaps use different chunking or file hashes")
+	// ErrNotEncrypted is returned when decrypting a link that isn't encrypted
+	ErrNotEncrypted = errors.New("blockmap: link file is not encrypted")
+	// ErrUnknownChecksumFormat is returned when exporting an unknown checksum format
+	ErrUnknownChecksumFormat = errors.New("blockmap: unknown checksum format")
+	// ErrChecksumHash is returned when exporting checksums of a file hash
+	// the sha*sum tools don't compute
+	ErrChecksumHash = errors.New("blockmap: file hash has no checksum tool")
+	// ErrStoreUnsupported is returned by operations that need the archive in
+	// memory when it is held in an archive store
+	ErrStoreUnsupported = errors.New("blockmap: operation is not supported with an archive store")
+	// ErrNoLogEntry is returned when verifying the transparency log entry of
+	// a blockmap that wasn't published
+	ErrNoLogEntry = errors.New("blockmap: blockmap has no transparency log entry")
+	// ErrNoSigstoreBundle is returned when verifying the keyless signature of
+	// a blockmap that wasn't signed
+	ErrNoSigstoreBundle = errors.New("blockmap: blockmap has no sigstore signature")
+)
+
+// PathError records an error along with the operation and path causing it.
+// Use errors.As to inspect it and errors.Is to match the underlying error.
+type PathError struct {
+	Op   string
+	Path string
+	Err  error
+}
+
+func (e *PathError) Error() string {
+	return "blockmap: failed to " + e.Op + " " + e.Path + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *PathError) Unwrap() error { return e.Err }
+
+// Cause returns the underlying error for github.com/pkg/errors
+func (e *PathError) Cause() error { return e.Err }
+
+// IgnoredPathErr is returned by generation when AutoIgnore left unreadable
+// paths out of the archive. The archive is still hashed.
+type IgnoredPathErr struct {
+	// Paths are the ignored file paths
+	Paths []string
+	// Errs are the errors that caused each path to be ignored
+	Errs []error
+}
+
+func (ip *IgnoredPathErr) Error() string { return strings.Join(ip.Paths, " ,") }
+
+// Unwrap returns the errors that caused paths to be ignored so errors.Is can
+// match them, such as os.ErrPermission
+func (ip *IgnoredPathErr) Unwrap() []error { return ip.Errs }
+
+// Ignored returns the ignored paths and why each was ignored
+func (ip *IgnoredPathErr) Ignored() []SkippedPath {
+	ignored := make([]SkippedPath, len(ip.Paths))
+	for i, path := range ip.Paths {
+		ignored[i] = SkippedPath{Path: path, Reason: SkipPermission}
+		if i < len(ip.Errs) && ip.Errs[i] != nil {
+			ignored[i].Err = ip.Errs[i].Error()
+		}
+	}
+	return ignored
+}
+
+// add records an ignored path
+func (ip *IgnoredPathErr) add(path string, err error) {
+	ip.Paths = append(ip.Paths, path)
+	ip.Errs = append(ip.Errs, err)
+}
@@ -0,0 +1,68 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestErrors(t *testing.T) {
+	var pathErr *PathError
+	err := New(filepath.Join(tmpDir, "does-not-exist")).Load(filepath.Join(tmpDir, "does-not-exist"))
+	if !errors.As(err, &pathErr) || pathErr.Op != "read" || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected a read PathError wrapping os.ErrNotExist, got %v", err)
+	}
+
+	unhashed := New(tmpDir)
+	if err := unhashed.Save(tmpDir); !errors.Is(err, ErrUnhashed) {
+		t.Error("expected ErrUnhashed, got", err)
+	}
+	unhashed.Archive = nil
+	if err := unhashed.hashBlockMap(); !errors.Is(err, ErrNilArchive) {
+		t.Error("expected ErrNilArchive, got", err)
+	}
+	if _, err := New(tmpDir).MerkleRoot(); !errors.Is(err, ErrEmptyArchive) {
+		t.Error("expected ErrEmptyArchive, got", err)
+	}
+
+	fsBlockMap := NewFS(fstest.MapFS{"a": &fstest.MapFile{Data: []byte("a")}})
+	if _, err := fsBlockMap.UpdatePath("a"); !errors.Is(err, ErrNotOSRoot) {
+		t.Error("expected ErrNotOSRoot, got", err)
+	}
+	if _, err := New(tmpDir).UpdatePath("."); !errors.Is(err, ErrOutsideRoot) {
+		t.Error("expected ErrOutsideRoot, got", err)
+	}
+}
+
+func TestIgnoredPathErr(t *testing.T) {
+	permission := &os.PathError{Op: "open", Path: "/root/a", Err: os.ErrPermission}
+	var err error = &IgnoredPathErr{Paths: []string{"/root/a"}, Errs: []error{permission}}
+
+	var ips *IgnoredPathErr
+	if !errors.As(err, &ips) || !errors.Is(err, os.ErrPermission) {
+		t.Errorf("expected an IgnoredPathErr wrapping os.ErrPermission, got %v", err)
+	}
+	expected := []SkippedPath{{Path: "/root/a", Reason: SkipPermission, Err: permission.Error()}}
+	if ignored := ips.Ignored(); !reflect.DeepEqual(ignored, expected) {
+		t.Errorf("expected %v, got %v", expected, ignored)
+	}
+}
@@ -0,0 +1,106 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	iofs "io/fs"
+
+	"github.com/govice/golinks/ignore"
+)
+
+// NewFS returns a new BlockMap generated from the files in fsys rather than
+// the OS filesystem. Archive keys are the slash separated paths within fsys.
+func NewFS(fsys iofs.FS) *BlockMap {
+	b := New("")
+	b.fsys = fsys
+	return b
+}
+
+// SetFS sets the filesystem the blockmap is generated from. A nil fsys
+// generates from the OS filesystem at Root.
+func (b *BlockMap) SetFS(fsys iofs.FS) {
+	b.fsys = fsys
+}
+
+// FS returns the filesystem the blockmap is generated from or nil if the OS
+// filesystem at Root is used
+func (b *BlockMap) FS() iofs.FS {
+	return b.fsys
+}
+
+// collectFSJobs walks the blockmap's fsys from the directory start and returns
+// every file that should be archived. Unreadable directories are skipped like
+// the OS walker.
+func (b *BlockMap) collectFSJobs(matcher *ignore.Matcher, start string) ([]hashJob, error) {
+	var jobs []hashJob
+	err := iofs.WalkDir(b.fsys, start, func(name string, d iofs.DirEntry, err error) error {
+		if err != nil {
+			if d != nil && d.IsDir() && name != "." {
+				if !matcher.Match(name, true) {
+					b.skip(name, errorSkipReason(err), err)
+				}
+				return iofs.SkipDir
+			}
+			return err
+		}
+
+		if d.IsDir() {
+			if name == "." {
+				return nil
+			}
+			if matcher.Match(name, true) {
+				return iofs.SkipDir
+			}
+			if b.RecordDirectories && !ignoredPath(b.IgnorePaths, name) {
+				info, err := d.Info()
+				if err != nil {
+					return &PathError{Op: "stat", Path: name, Err: err}
+				}
+				jobs = append(jobs, b.directoryJob(name, name, info))
+			}
+			return nil
+		}
+
+		//Ignore the files generated by this library
+		if ignoredPath(b.IgnorePaths, name) || generatedFile(name) || matcher.Match(name, false) {
+			return nil
+		}
+
+		if !d.Type().IsRegular() {
+			b.skip(name, modeSkipReason(d.Type()), nil)
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return &PathError{Op: "stat", Path: name, Err: err}
+		}
+
+		jobs = append(jobs, hashJob{
+			filePath: name,
+			relPath:  name,
+			entry:    b.newEntry(info),
+			inode:    linkedInode(info),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, &PathError{Op: "walk", Path: start, Err: err}
+	}
+
+	return jobs, nil
+}
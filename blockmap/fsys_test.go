@@ -0,0 +1,82 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestNewFS(t *testing.T) {
+	files := map[string]string{
+		"a.txt":         "a",
+		"dir/b.txt":     "b",
+		"dir/sub/c.txt": "c",
+		"skip.tmp":      "tmp",
+	}
+
+	mapFS := fstest.MapFS{
+		IgnoreFileName: &fstest.MapFile{Data: []byte("*.tmp\n")},
+	}
+	root, err := ioutil.TempDir(tmpDir, "fsys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	for name, data := range files {
+		mapFS[name] = &fstest.MapFile{Data: []byte(data)}
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, IgnoreFileName), []byte("*.tmp\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fromFS := NewFS(mapFS)
+	if err := fromFS.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fromFS.Archive["skip.tmp"]; ok {
+		t.Error("expected .linkignore patterns to apply to fs sources")
+	}
+
+	fromOS := New(root)
+	if err := fromOS.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if !Equal(fromFS, fromOS) {
+		t.Error("expected fs and os sources with the same files to be equal")
+	}
+
+	mapFS["dir/b.txt"] = &fstest.MapFile{Data: []byte("changed")}
+	report, err := fromFS.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Valid() || len(report.Modified) != 1 {
+		t.Error("expected verify to detect changes in fs source", report)
+	}
+}
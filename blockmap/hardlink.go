@@ -0,0 +1,81 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"os"
+	"sort"
+
+	"github.com/govice/golinks/fs"
+)
+
+// SetRecordHardlinks records in each entry the archive path of the first
+// link to the same file, so verification reports links that were broken or
+// added. Hard linked files are hashed once whether or not links are recorded.
+func (b *BlockMap) SetRecordHardlinks(enabled bool) {
+	b.RecordHardlinks = enabled
+}
+
+// linkedInode returns the inode of a file with several hard links
+func linkedInode(info os.FileInfo) *fs.FileID {
+	id, links, ok := fs.Inode(info)
+	if !ok || links < 2 {
+		return nil
+	}
+	return &id
+}
+
+// linkGroups returns the indexes of the jobs to hash and maps the index of
+// every other link to a hard linked file to the index of its first link
+func (b *BlockMap) linkGroups(jobs []hashJob) ([]int, map[int]int) {
+	hashed := make([]int, 0, len(jobs))
+	links := make(map[int]int)
+	first := make(map[fs.FileID]int)
+	for i, job := range jobs {
+		if job.inode != nil {
+			if primary, ok := first[*job.inode]; ok {
+				links[i] = primary
+				continue
+			}
+			first[*job.inode] = i
+		}
+		hashed = append(hashed, i)
+	}
+	return hashed, links
+}
+
+// sortedLinks returns the link indexes in job order
+func sortedLinks(links map[int]int) []int {
+	indexes := make([]int, 0, len(links))
+	for i := range links {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+// copyLink copies the hashing result of a file's first link to another link
+func (b *BlockMap) copyLink(jobs []hashJob, link, primary int) {
+	jobs[link].hash = jobs[primary].hash
+	jobs[link].legacy = jobs[primary].legacy
+	jobs[link].err = jobs[primary].err
+	jobs[link].entry.Chunks = jobs[primary].entry.Chunks
+	jobs[link].entry.CID = jobs[primary].entry.CID
+	if b.RecordHardlinks {
+		jobs[link].entry.Hardlink = jobs[primary].relPath
+	}
+}
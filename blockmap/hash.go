@@ -0,0 +1,91 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"hash"
+	"runtime"
+
+	"github.com/govice/golinks/blake3"
+	"github.com/govice/golinks/fs"
+	"github.com/pkg/errors"
+)
+
+// HashAlgorithm selects the hash of file contents and chunks
+type HashAlgorithm string
+
+const (
+	// SHA512 hashes files with SHA-512. This is the default.
+	SHA512 HashAlgorithm = ""
+	// SHA256 hashes files with SHA-256
+	SHA256 HashAlgorithm = "sha256"
+	// SHA384 hashes files with SHA-384
+	SHA384 HashAlgorithm = "sha384"
+	// BLAKE3 hashes files with 32 byte BLAKE3 digests. Large files are
+	// hashed on every CPU using the parallelism of BLAKE3's tree.
+	BLAKE3 HashAlgorithm = "blake3"
+)
+
+// ErrUnsupportedHash is returned when hashing files with an unknown algorithm
+var ErrUnsupportedHash = errors.New("blockmap: unsupported hash algorithm")
+
+// Func returns the constructor of the algorithm's hash, see RegisterHash
+func (a HashAlgorithm) Func() (func() hash.Hash, error) {
+	h, err := LookupHash(a)
+	if err != nil {
+		return nil, err
+	}
+	return h.New, nil
+}
+
+func (a HashAlgorithm) String() string {
+	if a == SHA512 {
+		return "sha512"
+	}
+	return string(a)
+}
+
+// blake3ParallelSize is the smallest file hashed on several goroutines with BLAKE3
+const blake3ParallelSize = 8 << 20
+
+// fileHashFunc returns the function hashing a file of size bytes. Large
+// BLAKE3 files are hashed on every CPU unless reads are rate limited.
+func (b *BlockMap) fileHashFunc(hasher *fs.Hasher, size int64) func(string) ([]byte, error) {
+	if b.FileHash != BLAKE3 || size < blake3ParallelSize || b.limiter != nil {
+		return hasher.HashFile
+	}
+	return func(path string) ([]byte, error) {
+		return blake3.HashFile(path, runtime.NumCPU())
+	}
+}
+
+// hasher returns the file hasher shared by a running generation, or a new
+// hasher using the blockmap's file hash algorithm
+func (b *BlockMap) hasher() (*fs.Hasher, error) {
+	if b.fileHasher != nil {
+		return b.fileHasher, nil
+	}
+	newHash, err := b.FileHash.Func()
+	if err != nil {
+		return nil, err
+	}
+	hasher := fs.NewHasher(fs.DefaultBufferSize)
+	hasher.New = newHash
+	hasher.Limiter = b.limiter
+	hasher.MmapThreshold = b.mmapThreshold
+	return hasher, nil
+}
@@ -0,0 +1,163 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/govice/golinks/archivemap"
+	"github.com/pkg/errors"
+)
+
+// Change describes how a single archived path changed. OldHash is nil for
+// added paths and NewHash is nil for removed paths.
+type Change struct {
+	Path    string `json:"path"`
+	OldHash []byte `json:"oldHash,omitempty"`
+	NewHash []byte `json:"newHash,omitempty"`
+}
+
+// UpdatePath re-hashes a single path relative to the root and rehashes the
+// blockmap. Files are added, updated or removed from the archive to match the
+// filesystem, directories are updated recursively. Only paths whose hash
+// changed are returned. UpdatePath requires an OS root. Paths of blockmaps
+// spanning several roots start with the namespace of their root.
+func (b *BlockMap) UpdatePath(relPath string) ([]Change, error) {
+	if b.fsys != nil {
+		return nil, ErrNotOSRoot
+	}
+	relPath = cleanRelPath(relPath)
+	if relPath == "" || relPath == "." {
+		return nil, errors.Wrap(ErrOutsideRoot, relPath)
+	}
+	if b.Entries == nil {
+		b.Entries = make(archivemap.EntryMap)
+	}
+
+	root, namespace, subPath, err := b.resolvePath(relPath)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := b.KeyNormalization.form(); err != nil {
+		return nil, err
+	}
+	relPath = b.normalizeKey(relPath)
+	matcher, err := b.ignoreMatcher(root)
+	if err != nil {
+		return nil, err
+	}
+
+	//Collect the files currently under relPath
+	present := make(map[string]os.FileInfo)
+	filePaths := make(map[string]string)
+	names := make(map[string]string)
+	fullPath := filepath.Join(root, filepath.FromSlash(subPath))
+	err = filepath.Walk(fullPath, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			//Files vanishing mid-walk are treated as removed
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(root, filePath)
+		if err != nil {
+			return &PathError{Op: "extract relative path of", Path: filePath, Err: err}
+		}
+		rel = filepath.ToSlash(rel)
+		if ignoredPath(b.IgnorePaths, filePath) || matcher.Match(rel, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() && b.RecordDirectories && rel != "." {
+			name := namespaced(namespace, rel) + "/"
+			key := b.normalizeKey(name)
+			present[key] = info
+			filePaths[key] = filePath
+			names[key] = name
+		} else if info.Mode().IsRegular() && !generatedFile(rel) {
+			name := namespaced(namespace, rel)
+			key := b.normalizeKey(name)
+			present[key] = info
+			filePaths[key] = filePath
+			names[key] = name
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, &PathError{Op: "walk", Path: fullPath, Err: err}
+	}
+
+	var changes []Change
+	for _, path := range b.sortedPaths() {
+		if _, ok := present[path]; ok || (path != relPath && !strings.HasPrefix(path, relPath+"/")) {
+			continue
+		}
+		changes = append(changes, Change{Path: path, OldHash: b.Archive[path]})
+		delete(b.Archive, path)
+		delete(b.Entries, path)
+	}
+
+	paths := make([]string, 0, len(present))
+	for path := range present {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		job := hashJob{
+			filePath: filePaths[path],
+			relPath:  path,
+			entry:    b.newEntry(present[path]),
+		}
+		if IsDirectory(path) {
+			job = b.directoryJob(job.filePath, strings.TrimSuffix(path, "/"), present[path])
+		}
+		if names[path] != path {
+			job.entry.Name = names[path]
+		}
+		hash, chunks, err := b.hashJobFile(job)
+		if os.IsNotExist(errors.Unwrap(err)) {
+			continue
+		} else if err != nil {
+			return nil, &PathError{Op: "hash", Path: job.filePath, Err: err}
+		}
+
+		job.entry.Chunks = chunks
+		if job.entry.CID, err = b.jobCID(job); err != nil {
+			return nil, &PathError{Op: "hash", Path: job.filePath, Err: err}
+		}
+		old, existed := b.Archive[path]
+		b.Archive[path] = hash
+		b.Entries[path] = job.entry
+		if !existed || !bytes.Equal(old, hash) {
+			changes = append(changes, Change{Path: path, OldHash: old, NewHash: hash})
+		}
+	}
+
+	if len(changes) > 0 {
+		if err := b.hashBlockMap(); err != nil {
+			return nil, errors.Wrap(err, "blockmap: failed to generate block map")
+		}
+	}
+	return changes, nil
+}
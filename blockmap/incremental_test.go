@@ -0,0 +1,88 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBlockMap_UpdatePath(t *testing.T) {
+	root, err := ioutil.TempDir(tmpDir, "incremental")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	write := func(name, content string) {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a", "a")
+	write("dir/b", "b")
+
+	b := New(root)
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+
+	//Unchanged files report nothing
+	changes, err := b.UpdatePath("a")
+	if err != nil || len(changes) != 0 {
+		t.Errorf("expected no changes, got %v %v", changes, err)
+	}
+
+	write("a", "modified")
+	write("dir/c", "c")
+	if err := os.Remove(filepath.Join(root, "dir", "b")); err != nil {
+		t.Fatal(err)
+	}
+	if changes, err = b.UpdatePath("a"); err != nil || len(changes) != 1 || changes[0].OldHash == nil || changes[0].NewHash == nil {
+		t.Errorf("expected modified a, got %v %v", changes, err)
+	}
+	changes, err = b.UpdatePath("dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || changes[0].Path != "dir/b" || changes[0].NewHash != nil ||
+		changes[1].Path != "dir/c" || changes[1].OldHash != nil {
+		t.Errorf("unexpected directory changes %v", changes)
+	}
+
+	//The incremental result matches a full generation
+	full := New(root)
+	if err := full.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(full.RootHash, b.RootHash) || !Equal(full, b) {
+		t.Error("incremental update does not match generated blockmap")
+	}
+
+	if err := os.RemoveAll(filepath.Join(root, "dir")); err != nil {
+		t.Fatal(err)
+	}
+	if changes, err = b.UpdatePath("dir"); err != nil || len(changes) != 1 || changes[0].Path != "dir/c" {
+		t.Errorf("expected removed dir/c, got %v %v", changes, err)
+	}
+}
@@ -0,0 +1,104 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+
+	"github.com/govice/golinks/codec"
+	"github.com/govice/golinks/ipfs"
+	"github.com/pkg/errors"
+)
+
+// IPFSConfig records that IPFS CIDs were computed for archived files
+type IPFSConfig struct {
+	CIDVersion ipfs.CIDVersion `json:"cidVersion"`
+}
+
+// ErrCIDMismatch is returned when an IPFS node reports a different CID for
+// pinned data than was computed locally
+var ErrCIDMismatch = errors.New("blockmap: IPFS node returned an unexpected CID")
+
+// SetCIDs records the IPFS CID of every archived file alongside its hash
+// when enabled. CIDs don't affect the root hash. Changing the CID version
+// clears previously recorded CIDs.
+func (b *BlockMap) SetCIDs(enabled bool, version ipfs.CIDVersion) {
+	if b.IPFS != nil && (!enabled || b.IPFS.CIDVersion != version) {
+		for path, entry := range b.Entries {
+			entry.CID = ""
+			b.Entries[path] = entry
+		}
+	}
+	if !enabled {
+		b.IPFS = nil
+		return
+	}
+	b.IPFS = &IPFSConfig{CIDVersion: version}
+}
+
+// jobCID returns the CID of a job's file if CIDs are enabled, reusing a
+// cached CID when present
+func (b *BlockMap) jobCID(job hashJob) (string, error) {
+	if b.IPFS == nil || job.dir || job.entry.CID != "" {
+		return job.entry.CID, nil
+	}
+
+	var (
+		r   io.ReadCloser
+		err error
+	)
+	if b.fsys != nil {
+		r, err = b.fsys.Open(job.filePath)
+	} else {
+		r, err = os.Open(job.filePath)
+	}
+	if err != nil {
+		return "", &PathError{Op: "open", Path: job.filePath, Err: err}
+	}
+	defer r.Close()
+	return ipfs.FileCID(b.limiter.Reader(r), b.IPFS.CIDVersion)
+}
+
+// PinIPFS adds the blockmap serialized with c to an IPFS node, pinning it,
+// and returns its CID. The CID returned by the node is checked against one
+// computed locally, using the blockmap's CID version or CIDv1 by default.
+func (b BlockMap) PinIPFS(ctx context.Context, client *ipfs.Client, c codec.Codec) (string, error) {
+	data, err := codec.Encode(c, b)
+	if err != nil {
+		return "", errors.Wrap(err, "blockmap: failed to encode blockmap")
+	}
+	version := ipfs.CIDv1
+	if b.IPFS != nil {
+		version = b.IPFS.CIDVersion
+	}
+	expected, err := ipfs.FileCID(bytes.NewReader(data), version)
+	if err != nil {
+		return "", err
+	}
+
+	cid, err := client.Add(ctx, OutputName, bytes.NewReader(data), version)
+	if err != nil {
+		return "", err
+	}
+	if cid != expected {
+		return "", errors.Wrapf(ErrCIDMismatch, "expected %s, got %s", expected, cid)
+	}
+	return cid, nil
+}
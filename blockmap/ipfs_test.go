@@ -0,0 +1,123 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/govice/golinks/codec"
+	"github.com/govice/golinks/ipfs"
+)
+
+func TestBlockMap_SetCIDs(t *testing.T) {
+	mapFS := fstest.MapFS{
+		"a":     &fstest.MapFile{Data: []byte("alpha")},
+		"dir/b": &fstest.MapFile{Data: bytes.Repeat([]byte("bravo"), 100000)},
+	}
+	b := NewFS(mapFS)
+	b.SetCIDs(true, ipfs.CIDv1)
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	for path, file := range mapFS {
+		expected, err := ipfs.FileCID(bytes.NewReader(file.Data), ipfs.CIDv1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cid := b.Entries[path].CID; cid != expected {
+			t.Errorf("CID of %s is %s, expected %s", path, cid, expected)
+		}
+	}
+
+	plain := NewFS(mapFS)
+	if err := plain.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plain.RootHash, b.RootHash) || plain.Entries["a"].CID != "" {
+		t.Error("CIDs should only be recorded when enabled and not affect the root hash")
+	}
+
+	b.SetCIDs(true, ipfs.CIDv0)
+	if cid := b.Entries["a"].CID; cid != "" {
+		t.Error("changing the CID version should clear recorded CIDs, got", cid)
+	}
+	if err := b.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if cid := b.Entries["a"].CID; !strings.HasPrefix(cid, "Qm") {
+		t.Error("expected a CIDv0 after updating, got", cid)
+	}
+}
+
+func TestBlockMap_PinIPFS(t *testing.T) {
+	b := NewFS(fstest.MapFS{"a": &fstest.MapFile{Data: []byte("alpha")}})
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+
+	var reply string
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v0/add" || r.URL.Query().Get("pin") != "true" || r.URL.Query().Get("cid-version") != "1" {
+			http.Error(w, `{"Message":"unexpected request"}`, http.StatusInternalServerError)
+			return
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		data, _ := ioutil.ReadAll(file)
+		cid, _ := ipfs.FileCID(bytes.NewReader(data), ipfs.CIDv1)
+		if reply != "" {
+			cid = reply
+		}
+		w.Write([]byte(`{"Name":"` + OutputName + `","Hash":"` + cid + `","Size":"1"}` + "\n"))
+	}))
+	defer node.Close()
+	client, err := ipfs.NewClient(node.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, _ := codec.ByName("json")
+	cid, err := b.PinIPFS(context.Background(), client, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := codec.Encode(c, b)
+	if expected, _ := ipfs.FileCID(bytes.NewReader(data), ipfs.CIDv1); cid != expected {
+		t.Errorf("pinned CID %s, expected %s", cid, expected)
+	}
+
+	reply = "bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku"
+	if _, err := b.PinIPFS(context.Background(), client, c); !errors.Is(err, ErrCIDMismatch) {
+		t.Error("expected ErrCIDMismatch, got", err)
+	}
+
+	b.SetCIDs(true, ipfs.CIDv0)
+	if _, err := b.PinIPFS(context.Background(), client, c); err == nil || !strings.Contains(err.Error(), "unexpected request") {
+		t.Error("expected the node's error message, got", err)
+	}
+}
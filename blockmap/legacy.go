@@ -0,0 +1,118 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/govice/golinks/archivemap"
+	"github.com/govice/golinks/fs"
+)
+
+// SetLegacyHash also hashes every file with alg during Generate and Update,
+// recording the digests in Legacy next to the archive. Carrying both digests
+// lets a blockmap move to a new file hash while tools relying on the old
+// digests keep working. Legacy digests are not part of the root hash.
+func (b *BlockMap) SetLegacyHash(alg HashAlgorithm) {
+	b.LegacyHash = alg
+	if b.Legacy == nil {
+		b.Legacy = make(map[string][]byte)
+	}
+}
+
+// Transition starts migrating the blockmap to the file hash to. The current
+// digests become the legacy digests and every file is hashed again with to,
+// reusing the legacy digests of files unchanged since they were archived.
+// Verify accepts files matching either digest until Rehash ends the
+// transition.
+func (b *BlockMap) Transition(to HashAlgorithm) error {
+	return b.TransitionContext(context.Background(), to)
+}
+
+// TransitionContext is Transition, traced like UpdateContext
+func (b *BlockMap) TransitionContext(ctx context.Context, to HashAlgorithm) error {
+	if _, err := LookupHash(to); err != nil {
+		return err
+	}
+	if b.store != nil {
+		return ErrStoreUnsupported
+	}
+	legacy := make(map[string][]byte, len(b.Archive))
+	for path, hash := range b.Archive {
+		if !IsDirectory(path) {
+			legacy[path] = b.Digest(hash)
+		}
+	}
+	b.LegacyHash, b.FileHash = b.FileHash, to
+	b.Legacy, b.Archive = legacy, make(archivemap.ArchiveMap)
+	return b.UpdateContext(ctx)
+}
+
+// Rehash ends a transition, dropping the legacy digests and updating the
+// archive with the current file hash
+func (b *BlockMap) Rehash() error {
+	b.Legacy, b.LegacyHash = nil, SHA512
+	return b.Update()
+}
+
+// reuseLegacy copies the legacy digests of files unchanged since they were
+// archived to their jobs and starts a new legacy archive
+func (b *BlockMap) reuseLegacy(jobs []hashJob) {
+	if b.Legacy == nil {
+		return
+	}
+	for i, job := range jobs {
+		entry, ok := b.Entries[job.relPath]
+		if ok && entry.Size == job.entry.Size && entry.ModTime == job.entry.ModTime {
+			jobs[i].legacy = b.Legacy[job.relPath]
+		}
+	}
+	b.Legacy = make(map[string][]byte)
+}
+
+// legacyDigest hashes a job's file with the legacy file hash
+func (b *BlockMap) legacyDigest(job hashJob) ([]byte, error) {
+	newHash, err := b.LegacyHash.Func()
+	if err != nil {
+		return nil, err
+	}
+	hasher := fs.NewHasher(fs.DefaultBufferSize)
+	hasher.New = newHash
+	hasher.Limiter = b.limiter
+	hasher.MmapThreshold = b.mmapThreshold
+	if b.fsys != nil {
+		return hasher.HashFS(b.fsys, job.filePath)
+	}
+	return hasher.HashFile(job.filePath)
+}
+
+// legacyModified removes the paths whose legacy digests still match from
+// modified, so files matching either digest verify during a transition
+func legacyModified(stored, current *BlockMap, modified []string) []string {
+	if stored.Legacy == nil || current.Legacy == nil {
+		return modified
+	}
+	var changed []string
+	for _, path := range modified {
+		legacy, ok := stored.Legacy[path]
+		if !ok || legacy == nil || !bytes.Equal(legacy, current.Legacy[path]) {
+			changed = append(changed, path)
+		}
+	}
+	return changed
+}
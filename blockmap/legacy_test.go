@@ -0,0 +1,107 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBlockMap_Transition(t *testing.T) {
+	root, err := ioutil.TempDir(tmpDir, "transition")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for _, name := range []string{"a", "b"} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := New(root)
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	old := b.Archive
+	if err := b.Transition(SHA256); err != nil {
+		t.Fatal(err)
+	}
+	if b.FileHash != SHA256 || b.LegacyHash != SHA512 || !reflect.DeepEqual(b.Legacy, map[string][]byte(old)) {
+		t.Errorf("unexpected transition %s %s %v", b.FileHash, b.LegacyHash, b.Legacy)
+	}
+	if want := sha256.Sum256([]byte("a")); !bytes.Equal(b.Archive["a"], want[:]) {
+		t.Errorf("expected sha256 digests, got %x", b.Archive["a"])
+	}
+
+	//Links carry both digests
+	var buffer bytes.Buffer
+	if _, err := b.WriteTo(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	loaded := New("")
+	if _, err := loaded.ReadFrom(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Legacy, b.Legacy) || loaded.LegacyHash != b.LegacyHash {
+		t.Error("expected legacy digests to be saved")
+	}
+
+	report, err := loaded.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Valid() {
+		t.Errorf("expected transitioning blockmap to verify %+v", report)
+	}
+
+	//Files matching either digest aren't reported modified
+	loaded.Archive["a"] = []byte("stale")
+	if report, err = loaded.Verify(); err != nil || len(report.Modified) != 0 {
+		t.Errorf("expected the legacy digest to be accepted %+v %v", report, err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "b"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if report, err = b.Verify(); err != nil || !reflect.DeepEqual(report.Modified, []string{"b"}) {
+		t.Errorf("expected b to be modified %+v %v", report, err)
+	}
+
+	//Updates keep both digests current
+	if err := b.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if want := sha512.Sum512([]byte("changed")); !bytes.Equal(b.Legacy["b"], want[:]) {
+		t.Errorf("expected the legacy digest to be updated, got %x", b.Legacy["b"])
+	}
+
+	if err := b.Rehash(); err != nil {
+		t.Fatal(err)
+	}
+	if b.Legacy != nil || b.LegacyHash != SHA512 {
+		t.Error("expected Rehash to drop the legacy digests")
+	}
+	if want := sha256.Sum256([]byte("changed")); !bytes.Equal(b.Archive["b"], want[:]) {
+		t.Errorf("unexpected digest after Rehash %x", b.Archive["b"])
+	}
+}
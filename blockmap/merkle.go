@@ -0,0 +1,155 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/binary"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	merkleLeafPrefix byte = 0x00
+	merkleNodePrefix byte = 0x01
+)
+
+// ErrPathNotArchived is returned when a path is not present in the archive
+var ErrPathNotArchived = errors.New("blockmap: path is not in archive")
+
+// ProofNode is a sibling hash along a merkle proof path
+type ProofNode struct {
+	Hash []byte `json:"hash"`
+	// Left is true when the sibling is hashed on the left of the running hash
+	Left bool `json:"left"`
+}
+
+// MerkleProof proves the inclusion of a single archive entry in a merkle root
+type MerkleProof struct {
+	Path     string      `json:"path"`
+	Hash     []byte      `json:"hash"`
+	Siblings []ProofNode `json:"siblings"`
+}
+
+// MerkleRoot returns the root of a binary merkle tree built over the archive
+// entries ordered by path. Leaves are SHA512(0x00 | len(path) | path | hash)
+// and interior nodes are SHA512(0x01 | left | right). An unpaired node is
+// promoted to the next level unchanged.
+func (b *BlockMap) MerkleRoot() ([]byte, error) {
+	if len(b.Archive) == 0 {
+		return nil, ErrEmptyArchive
+	}
+
+	levels := b.merkleLevels(b.sortedPaths())
+	return levels[len(levels)-1][0], nil
+}
+
+// Proof returns a merkle inclusion proof for the archive entry at path
+func (b *BlockMap) Proof(path string) (*MerkleProof, error) {
+	hash, ok := b.Archive[path]
+	if !ok {
+		return nil, errors.Wrap(ErrPathNotArchived, path)
+	}
+
+	paths := b.sortedPaths()
+	index := sort.SearchStrings(paths, path)
+	proof := &MerkleProof{
+		Path: path,
+		Hash: append([]byte{}, hash...),
+	}
+
+	levels := b.merkleLevels(paths)
+	for _, level := range levels[:len(levels)-1] {
+		sibling := index ^ 1
+		if sibling < len(level) {
+			proof.Siblings = append(proof.Siblings, ProofNode{
+				Hash: level[sibling],
+				Left: sibling < index,
+			})
+		}
+		index /= 2
+	}
+
+	return proof, nil
+}
+
+// VerifyProof returns true if proof resolves to the provided merkle root
+func VerifyProof(rootHash []byte, proof *MerkleProof) bool {
+	if proof == nil {
+		return false
+	}
+
+	running := merkleLeaf(proof.Path, proof.Hash)
+	for _, sibling := range proof.Siblings {
+		if sibling.Left {
+			running = merkleNode(sibling.Hash, running)
+		} else {
+			running = merkleNode(running, sibling.Hash)
+		}
+	}
+
+	return bytes.Equal(running, rootHash)
+}
+
+func (b *BlockMap) sortedPaths() []string {
+	return b.Archive.SortedKeys()
+}
+
+// merkleLevels returns every level of the tree from the leaves up to the root
+func (b *BlockMap) merkleLevels(paths []string) [][][]byte {
+	level := make([][]byte, len(paths))
+	for i, path := range paths {
+		level[i] = merkleLeaf(path, b.Archive[path])
+	}
+
+	levels := [][][]byte{level}
+	for len(level) > 1 {
+		var next [][]byte
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			next = append(next, merkleNode(level[i], level[i+1]))
+		}
+		levels = append(levels, next)
+		level = next
+	}
+
+	return levels
+}
+
+func merkleLeaf(path string, hash []byte) []byte {
+	h := sha512.New()
+	length := make([]byte, 8)
+	binary.BigEndian.PutUint64(length, uint64(len(path)))
+	h.Write([]byte{merkleLeafPrefix})
+	h.Write(length)
+	h.Write([]byte(path))
+	h.Write(hash)
+	return h.Sum(nil)
+}
+
+func merkleNode(left, right []byte) []byte {
+	h := sha512.New()
+	h.Write([]byte{merkleNodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
@@ -0,0 +1,59 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/govice/golinks/archivemap"
+)
+
+func TestBlockMap_Proof(t *testing.T) {
+	for size := 1; size <= 9; size++ {
+		b := New(tmpDir)
+		for i := 0; i < size; i++ {
+			b.Archive["file"+strconv.Itoa(i)] = []byte(strconv.Itoa(i))
+		}
+
+		root, err := b.MerkleRoot()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for path := range b.Archive {
+			proof, err := b.Proof(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !VerifyProof(root, proof) {
+				t.Error("failed to verify proof for", path, "in archive of size", size)
+			}
+
+			proof.Hash = []byte("tampered")
+			if VerifyProof(root, proof) {
+				t.Error("verified tampered proof for", path)
+			}
+		}
+	}
+
+	b := New(tmpDir)
+	b.Archive = archivemap.ArchiveMap{"a": []byte("a")}
+	if _, err := b.Proof("missing"); err == nil {
+		t.Error("expected error proving missing path")
+	}
+}
@@ -0,0 +1,126 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+package blockmap
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+
+	"github.com/govice/golinks/archivemap"
+	"github.com/govice/golinks/codec"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrUnsupportedSchema is returned when loading a link written with a newer
+// schema version than this package supports
+var ErrUnsupportedSchema = errors.New("blockmap: unsupported link schema version")
+
+// migration upgrades a decoded link from one schema version to the next
+type migration func(b *BlockMap) error
+
+// migrations holds the upgrade from each schema version to the following one
+var migrations = []migration{
+	0: migrateV0,
+}
+
+// legacyLink is the layout of links written as a bare gob stream, without
+// the codec header, before schema versions were recorded
+type legacyLink struct {
+	Archive     map[string][]byte
+	RootHash    []byte
+	Root        string
+	IgnorePaths []string
+	AutoIgnore  bool
+}
+
+// Decode decodes link data written by this or any earlier version of the
+// package into b and upgrades it to CurrentSchemaVersion. JSON, legacy gob
+// and every codec format are detected automatically.
+func (b *BlockMap) Decode(data []byte) error {
+	return b.DecodeContext(context.Background(), data)
+}
+
+// DecodeContext is Decode, tracing the decoding in a span under any span in ctx
+func (b *BlockMap) DecodeContext(ctx context.Context, data []byte) (err error) {
+	_, span := b.startSpan(ctx, "blockmap.decode", attribute.Int("golinks.bytes", len(data)))
+	defer func() { endSpan(span, err) }()
+
+	//Links without a version predate schema versions, and links without a
+	//normalization predate normalization
+	b.SchemaVersion = 0
+	b.KeyNormalization = ""
+	if isLegacyGob(data) {
+		if err := b.decodeLegacyGob(data); err != nil {
+			return err
+		}
+	} else if _, err := codec.Decode(data, b); err != nil {
+		return err
+	}
+	return b.migrate()
+}
+
+// isLegacyGob returns true for data that is neither JSON nor prefixed with a codec header
+func isLegacyGob(data []byte) bool {
+	data = bytes.TrimLeft(data, " \t\r\n")
+	return len(data) > 0 && data[0] != '{' && !bytes.HasPrefix(data, codec.Magic)
+}
+
+// decodeLegacyGob decodes a bare gob link into b
+func (b *BlockMap) decodeLegacyGob(data []byte) error {
+	var link legacyLink
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&link); err != nil {
+		return errors.Wrap(err, "blockmap: failed to decode legacy gob link")
+	}
+	if b.Archive == nil {
+		b.Archive = make(archivemap.ArchiveMap)
+	}
+	for key, hash := range link.Archive {
+		b.Archive[key] = hash
+	}
+	b.RootHash = link.RootHash
+	b.Root = link.Root
+	b.IgnorePaths = link.IgnorePaths
+	b.AutoIgnore = link.AutoIgnore
+	return nil
+}
+
+// migrate applies every migration from the decoded schema version up to CurrentSchemaVersion
+func (b *BlockMap) migrate() error {
+	if b.SchemaVersion < 0 || b.SchemaVersion > CurrentSchemaVersion {
+		return errors.Wrapf(ErrUnsupportedSchema, "%d", b.SchemaVersion)
+	}
+	for b.SchemaVersion < CurrentSchemaVersion {
+		if err := migrations[b.SchemaVersion](b); err != nil {
+			return errors.Wrapf(err, "blockmap: failed to migrate schema version %d", b.SchemaVersion)
+		}
+		b.SchemaVersion++
+	}
+	return nil
+}
+
+// migrateV0 upgrades links recorded before per-entry metadata. Their entries
+// stay empty until the next Update, which re-hashes every file once.
+func migrateV0(b *BlockMap) error {
+	if b.Archive == nil {
+		b.Archive = make(archivemap.ArchiveMap)
+	}
+	if b.Entries == nil {
+		b.Entries = make(archivemap.EntryMap)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+package blockmap
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBlockMap_LoadMigratesSchema(t *testing.T) {
+	root, err := ioutil.TempDir(tmpDir, "migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := ioutil.WriteFile(filepath.Join(root, "a"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	current := New(root)
+	if err := current.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := current.Archive.Canonical()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Links written before schema versions carry no version or entries
+	v0 := []byte(`{"archive":` + string(archive) + `,"rootHash":"` + base64.StdEncoding.EncodeToString(current.RootHash) + `","root":"` + root + `","ignorePaths":null,"autoIgnore":false}`)
+	if err := ioutil.WriteFile(filepath.Join(root, OutputName), v0, 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaded := New(root)
+	if err := loaded.Load(root); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.SchemaVersion != CurrentSchemaVersion || loaded.Entries == nil || !Equal(loaded, current) {
+		t.Fatalf("expected v0 link to be migrated %+v", loaded)
+	}
+	report, err := loaded.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Valid() {
+		t.Errorf("expected migrated link to verify %+v", report)
+	}
+
+	var legacy bytes.Buffer
+	link := legacyLink{Archive: current.Archive, RootHash: current.RootHash, Root: root}
+	if err := gob.NewEncoder(&legacy).Encode(link); err != nil {
+		t.Fatal(err)
+	}
+	loaded = New("")
+	if err := loaded.Decode(legacy.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.SchemaVersion != CurrentSchemaVersion || loaded.Root != root || !Equal(loaded, current) {
+		t.Errorf("expected legacy gob link to be migrated %+v", loaded)
+	}
+
+	future := []byte(`{"schemaVersion":99,"archive":{},"rootHash":null,"root":""}`)
+	if err := New("").Decode(future); !errors.Is(err, ErrUnsupportedSchema) {
+		t.Errorf("expected unsupported schema, got %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidNamespace is returned for root namespaces that can't be used as
+// the first segment of an archive path, or that are used by several roots
+var ErrInvalidNamespace = errors.New("blockmap: invalid root namespace")
+
+// GenerateMulti generates a single blockmap spanning several root
+// directories, such as mount points snapshotted as one dataset. Files are
+// archived under the base name of their root, so /mnt/a/x is archived as a/x,
+// and roots must have distinct base names. Each root is walked as if it were
+// generated alone, ignore patterns and ignore files match paths relative to it.
+func GenerateMulti(roots []string, opts ...Option) (*BlockMap, error) {
+	namespaces, err := Namespaces(roots)
+	if err != nil {
+		return nil, err
+	}
+
+	b := New("", opts...)
+	if err := b.SetRoots(namespaces); err != nil {
+		return nil, err
+	}
+	if err := b.Generate(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Namespaces maps the base name of each root to the root as used by
+// GenerateMulti. Roots must have distinct base names.
+func Namespaces(roots []string) (map[string]string, error) {
+	namespaces := make(map[string]string, len(roots))
+	for _, root := range roots {
+		namespace := filepath.Base(filepath.Clean(root))
+		if _, ok := namespaces[namespace]; ok {
+			return nil, errors.Wrap(ErrInvalidNamespace, namespace)
+		}
+		namespaces[namespace] = root
+	}
+	return namespaces, nil
+}
+
+// SetRoots makes the blockmap span several root directories, archiving the
+// files of each root under its namespace rather than generating Root.
+// Namespaces must be valid path segments. A nil map generates Root.
+func (b *BlockMap) SetRoots(roots map[string]string) error {
+	if roots == nil {
+		b.Roots = nil
+		return nil
+	}
+	copied := make(map[string]string, len(roots))
+	for namespace, root := range roots {
+		if namespace == "" || namespace == "." || namespace == ".." || strings.ContainsAny(namespace, "/\\") {
+			return errors.Wrap(ErrInvalidNamespace, namespace)
+		}
+		copied[namespace] = root
+	}
+	b.Roots = copied
+	return nil
+}
+
+// namespaces returns the sorted namespaces of the blockmap's roots
+func (b *BlockMap) namespaces() []string {
+	namespaces := make([]string, 0, len(b.Roots))
+	for namespace := range b.Roots {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// namespaced prefixes an archive path with the namespace of its root
+func namespaced(namespace, relPath string) string {
+	if namespace == "" {
+		return relPath
+	}
+	return namespace + "/" + relPath
+}
+
+// resolvePath returns the root directory holding an archive path along with
+// its namespace and the path relative to that root
+func (b *BlockMap) resolvePath(relPath string) (root, namespace, subPath string, err error) {
+	if len(b.Roots) == 0 {
+		return b.Root, "", relPath, nil
+	}
+	namespace = relPath
+	if i := strings.Index(relPath, "/"); i >= 0 {
+		namespace, subPath = relPath[:i], relPath[i+1:]
+	}
+	root, ok := b.Roots[namespace]
+	if !ok {
+		return "", "", "", errors.Wrap(ErrOutsideRoot, relPath)
+	}
+	return root, namespace, subPath, nil
+}
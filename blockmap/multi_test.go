@@ -0,0 +1,98 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGenerateMulti(t *testing.T) {
+	parent, err := ioutil.TempDir(tmpDir, "multi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(parent)
+	files := map[string]string{
+		"disk1/a":        "a",
+		"disk1/sub/b":    "b",
+		"disk1/skip.tmp": "tmp",
+		"disk2/a":        "other a",
+	}
+	for name, content := range files {
+		path := filepath.Join(parent, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	roots := []string{filepath.Join(parent, "disk1"), filepath.Join(parent, "disk2") + "/"}
+
+	b, err := GenerateMulti(roots, WithIgnorePatterns("*.tmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"disk1/a", "disk1/sub/b", "disk2/a"}
+	if keys := b.Archive.SortedKeys(); !reflect.DeepEqual(keys, want) {
+		t.Errorf("unexpected archive keys %v", keys)
+	}
+
+	//Namespaced keys hash the same as each root generated alone
+	single := New(roots[0])
+	if err := single.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(b.Archive["disk1/sub/b"], single.Archive["sub/b"]) {
+		t.Error("namespaced hash differs from single root hash")
+	}
+
+	report, err := b.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Valid() {
+		t.Errorf("expected multi root blockmap to verify %+v", report)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(roots[1], "c"), []byte("c"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := b.UpdatePath("disk2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Path != "disk2/c" {
+		t.Errorf("unexpected changes %v", changes)
+	}
+	if _, err := b.UpdatePath("disk3/a"); !errors.Is(err, ErrOutsideRoot) {
+		t.Errorf("expected unknown namespace to be outside the root, got %v", err)
+	}
+
+	//Roots with the same base name can't share a namespace
+	if _, err := GenerateMulti([]string{roots[0], filepath.Join(parent, "disk1", "..", "disk1")}); !errors.Is(err, ErrInvalidNamespace) {
+		t.Errorf("expected duplicate namespace error, got %v", err)
+	}
+	if err := New("").SetRoots(map[string]string{"a/b": roots[0]}); !errors.Is(err, ErrInvalidNamespace) {
+		t.Errorf("expected invalid namespace error, got %v", err)
+	}
+}
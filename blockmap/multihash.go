@@ -0,0 +1,127 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"sort"
+	"sync"
+
+	"github.com/govice/golinks/blake3"
+	"github.com/govice/golinks/ipfs"
+	"github.com/pkg/errors"
+)
+
+// Hasher is a file hash algorithm. Registering a Hasher makes its algorithm
+// available to WithHash, so new algorithms can be adopted without changing
+// this package.
+type Hasher interface {
+	// Algorithm is the name selecting the hash, as recorded in links
+	Algorithm() HashAlgorithm
+	// New returns a new hash
+	New() hash.Hash
+	// MultihashCode is the code of the hash in the multihash table, used
+	// when archiving multihash encoded digests
+	MultihashCode() uint64
+}
+
+// stdHasher is a Hasher of a standard library hash
+type stdHasher struct {
+	algorithm HashAlgorithm
+	new       func() hash.Hash
+	code      uint64
+}
+
+func (h stdHasher) Algorithm() HashAlgorithm { return h.algorithm }
+func (h stdHasher) New() hash.Hash           { return h.new() }
+func (h stdHasher) MultihashCode() uint64    { return h.code }
+
+var (
+	hashersMu sync.RWMutex
+	hashers   = map[HashAlgorithm]Hasher{
+		SHA512: stdHasher{SHA512, sha512.New, ipfs.MultihashSHA512},
+		SHA256: stdHasher{SHA256, sha256.New, ipfs.MultihashSHA256},
+		SHA384: stdHasher{SHA384, sha512.New384, ipfs.MultihashSHA384},
+		BLAKE3: stdHasher{BLAKE3, blake3.New, ipfs.MultihashBLAKE3},
+	}
+)
+
+// RegisterHash makes h available as the file hash algorithm h.Algorithm(),
+// replacing any hasher registered under the same name
+func RegisterHash(h Hasher) {
+	hashersMu.Lock()
+	defer hashersMu.Unlock()
+	hashers[h.Algorithm()] = h
+}
+
+// LookupHash returns the hasher registered for a
+func LookupHash(a HashAlgorithm) (Hasher, error) {
+	hashersMu.RLock()
+	defer hashersMu.RUnlock()
+	h, ok := hashers[a]
+	if !ok {
+		return nil, errors.Wrap(ErrUnsupportedHash, string(a))
+	}
+	return h, nil
+}
+
+// HashAlgorithms returns the registered file hash algorithms sorted by name
+func HashAlgorithms() []HashAlgorithm {
+	hashersMu.RLock()
+	defer hashersMu.RUnlock()
+	algorithms := make([]HashAlgorithm, 0, len(hashers))
+	for a := range hashers {
+		algorithms = append(algorithms, a)
+	}
+	sort.Slice(algorithms, func(i, j int) bool { return algorithms[i].String() < algorithms[j].String() })
+	return algorithms
+}
+
+// SetMultihash archives file hashes as multihashes, prefixing each digest
+// with the code of its algorithm and its length, so archived hashes
+// describe their own algorithm. This changes the root hash. Use Digest to
+// read the plain digest of an archived hash.
+func (b *BlockMap) SetMultihash(enabled bool) {
+	b.Multihash = enabled
+}
+
+// encodeHash encodes a file digest as it is archived
+func (b *BlockMap) encodeHash(digest []byte) ([]byte, error) {
+	if !b.Multihash || digest == nil {
+		return digest, nil
+	}
+	h, err := LookupHash(b.FileHash)
+	if err != nil {
+		return nil, err
+	}
+	return ipfs.Multihash(h.MultihashCode(), digest), nil
+}
+
+// Digest returns the plain digest of an archived hash, removing the
+// multihash prefix of blockmaps archiving multihashes. Hashes that aren't
+// multihashes, such as the markers of directories, are returned unchanged.
+func (b *BlockMap) Digest(hash []byte) []byte {
+	if !b.Multihash {
+		return hash
+	}
+	if _, digest, err := ipfs.DecodeMultihash(hash); err == nil {
+		return digest
+	}
+	return hash
+}
@@ -0,0 +1,107 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/govice/golinks/ipfs"
+)
+
+type sha1Hasher struct{}
+
+func (sha1Hasher) Algorithm() HashAlgorithm { return "sha1-test" }
+func (sha1Hasher) New() hash.Hash           { return sha1.New() }
+func (sha1Hasher) MultihashCode() uint64    { return 0x11 }
+
+func TestRegisterHash(t *testing.T) {
+	root, err := ioutil.TempDir(tmpDir, "register")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := ioutil.WriteFile(filepath.Join(root, "a"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	RegisterHash(sha1Hasher{})
+	b := New(root, WithHash("sha1-test"), WithMultihash())
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	code, digest, err := ipfs.DecodeMultihash(b.Archive["a"])
+	if want := sha1.Sum([]byte("a")); err != nil || code != 0x11 || !bytes.Equal(digest, want[:]) {
+		t.Errorf("unexpected multihash %x", b.Archive["a"])
+	}
+}
+
+func TestWithMultihash(t *testing.T) {
+	root, err := ioutil.TempDir(tmpDir, "multihash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := ioutil.WriteFile(filepath.Join(root, "a"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	plain := New(root)
+	b := New(root, WithMultihash(), WithBloomFilter(0.01))
+	for _, bm := range []*BlockMap{plain, b} {
+		if err := bm.Generate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := sha512.Sum512([]byte("a"))
+	if !bytes.Equal(b.Archive["a"], ipfs.Multihash(ipfs.MultihashSHA512, want[:])) {
+		t.Errorf("unexpected multihash %x", b.Archive["a"])
+	}
+	if !bytes.Equal(b.Digest(b.Archive["a"]), want[:]) || !bytes.Equal(plain.Digest(plain.Archive["a"]), want[:]) {
+		t.Error("expected Digest to return the plain digest")
+	}
+	if bytes.Equal(b.RootHash, plain.RootHash) {
+		t.Error("expected multihashes to change the root hash")
+	}
+	if !b.MayContain(want[:]) {
+		t.Error("expected the bloom filter to hold plain digests")
+	}
+
+	report, err := b.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Valid() {
+		t.Errorf("expected multihash blockmap to verify %+v", report)
+	}
+
+	var checksums strings.Builder
+	if err := b.ExportChecksums(&checksums, SHA512SumFormat); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(checksums.String(), hex.EncodeToString(want[:])) {
+		t.Errorf("expected plain digests in checksums %q", checksums.String())
+	}
+}
@@ -0,0 +1,119 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalization selects the Unicode normalization form applied to archive
+// keys. Filesystems disagree on the form of file names, macOS writes NFD
+// while Linux keeps names as created, usually NFC, so normalizing keys makes
+// root hashes comparable across platforms. New blockmaps normalize keys to
+// NFC unless configured otherwise.
+type Normalization string
+
+const (
+	// NoNormalization keeps keys as the filesystem returns them. Links
+	// without a recorded normalization predate normalization and are treated
+	// the same way.
+	NoNormalization Normalization = "none"
+	// NFC normalizes keys to canonical composition. This is the default.
+	NFC Normalization = "nfc"
+	// NFD normalizes keys to canonical decomposition as used by macOS
+	NFD Normalization = "nfd"
+	// NFKC normalizes keys to compatibility composition
+	NFKC Normalization = "nfkc"
+	// NFKD normalizes keys to compatibility decomposition
+	NFKD Normalization = "nfkd"
+)
+
+// ErrUnsupportedNormalization is returned when generating with an unknown
+// normalization form
+var ErrUnsupportedNormalization = errors.New("blockmap: unsupported key normalization")
+
+// ErrKeyCollision is returned when several files normalize to the same key
+var ErrKeyCollision = errors.New("blockmap: files normalize to the same key")
+
+// form returns the normalization form, or false to keep keys unchanged
+func (n Normalization) form() (norm.Form, bool, error) {
+	switch strings.ToLower(string(n)) {
+	case "", "none":
+		return 0, false, nil
+	case "nfc":
+		return norm.NFC, true, nil
+	case "nfd":
+		return norm.NFD, true, nil
+	case "nfkc":
+		return norm.NFKC, true, nil
+	case "nfkd":
+		return norm.NFKD, true, nil
+	}
+	return 0, false, errors.Wrap(ErrUnsupportedNormalization, string(n))
+}
+
+// SetKeyNormalization normalizes archive keys to n during generation. The
+// normalization is recorded in the link so verification applies it too.
+// Entries whose key was changed record the name found on disk, see FileName.
+func (b *BlockMap) SetKeyNormalization(n Normalization) {
+	b.KeyNormalization = n
+}
+
+// sameNormalization returns true if a and b apply the same normalization,
+// treating an unrecorded normalization as none
+func sameNormalization(a, b Normalization) bool {
+	fa, oka, erra := a.form()
+	fb, okb, errb := b.form()
+	if erra != nil || errb != nil {
+		return a == b
+	}
+	return oka == okb && (!oka || fa == fb)
+}
+
+// normalizeKeys normalizes the archive keys of jobs, failing if two files
+// normalize to the same key. Changed keys record the name found on disk.
+func (b *BlockMap) normalizeKeys(jobs []hashJob) error {
+	form, ok, err := b.KeyNormalization.form()
+	if err != nil || !ok {
+		return err
+	}
+	seen := make(map[string]string, len(jobs))
+	for i := range jobs {
+		key := form.String(jobs[i].relPath)
+		if other, ok := seen[key]; ok {
+			return &PathError{Op: "normalize", Path: jobs[i].filePath, Err: errors.Wrap(ErrKeyCollision, other)}
+		}
+		seen[key] = jobs[i].filePath
+		if key != jobs[i].relPath {
+			jobs[i].entry.Name = jobs[i].relPath
+		}
+		jobs[i].relPath = key
+	}
+	return nil
+}
+
+// normalizeKey normalizes a single archive key, used for skipped paths and
+// paths passed to UpdatePath
+func (b *BlockMap) normalizeKey(key string) string {
+	if form, ok, err := b.KeyNormalization.form(); err == nil && ok {
+		return form.String(key)
+	}
+	return key
+}
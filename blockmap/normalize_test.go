@@ -0,0 +1,159 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBlockMap_KeyNormalization(t *testing.T) {
+	root, err := ioutil.TempDir(tmpDir, "normalize")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	const nfc, nfd = "caf\u00e9", "cafe\u0301"
+	if err := ioutil.WriteFile(filepath.Join(root, nfd), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b := New(root, WithKeyNormalization(NoNormalization))
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.Archive[nfd]; !ok {
+		t.Fatalf("expected keys to be unchanged without normalization %v", b.Archive)
+	}
+	unnormalized := b.RootHash
+
+	b = New(root)
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.Archive[nfc]; !ok || len(b.Archive) != 1 {
+		t.Fatalf("expected NFC key by default %v", b.Archive)
+	}
+	if b.FileName(nfc) != nfd {
+		t.Errorf("expected the name on disk to be recorded %+v", b.Entries[nfc])
+	}
+	if result, err := b.VerifyFile(nfc); err != nil || !result.Valid() {
+		t.Errorf("expected the file to verify by its key %+v %v", result, err)
+	}
+	if _, err := b.UpdatePath(nfd); err != nil || b.FileName(nfc) != nfd {
+		t.Errorf("expected updates to keep the name on disk %+v %v", b.Entries[nfc], err)
+	}
+	forged := b.Entries[nfc]
+	forged.Name = "../elsewhere"
+	b.Entries[nfc] = forged
+	if b.FileName(nfc) != nfc {
+		t.Error("expected names that don't normalize to their key to be ignored")
+	}
+	forged.Name = nfd
+	b.Entries[nfc] = forged
+	if string(b.RootHash) == string(unnormalized) {
+		t.Error("expected normalization to change the root hash")
+	}
+	report, err := b.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Valid() {
+		t.Errorf("expected normalized blockmap to verify %+v", report)
+	}
+
+	b.SetKeyNormalization(NFD)
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.Archive[nfd]; !ok {
+		t.Errorf("expected NFD key %v", b.Archive)
+	}
+
+	//Names differing only by form can't share a key
+	if err := ioutil.WriteFile(filepath.Join(root, nfc), []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, nfd)); err != nil {
+		t.Skip("filesystem normalizes names")
+	}
+	if err := New(root, WithKeyNormalization(NFC)).Generate(); !errors.Is(err, ErrKeyCollision) {
+		t.Errorf("expected key collision, got %v", err)
+	}
+	if err := New(root, WithKeyNormalization("nfx")).Generate(); !errors.Is(err, ErrUnsupportedNormalization) {
+		t.Errorf("expected unsupported normalization, got %v", err)
+	}
+}
+
+func TestBlockMap_KeyNormalizationLegacy(t *testing.T) {
+	root, err := ioutil.TempDir(tmpDir, "normalize")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	const nfd = "cafe\u0301"
+	if err := ioutil.WriteFile(filepath.Join(root, nfd), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	//Links written before normalization record no form
+	legacy := New(root)
+	legacy.KeyNormalization = ""
+	if err := legacy.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := New(root)
+	if err := b.Decode(data); err != nil {
+		t.Fatal(err)
+	}
+	if b.KeyNormalization != "" {
+		t.Errorf("expected no normalization for a legacy link, got %q", b.KeyNormalization)
+	}
+	if _, ok := b.Archive[nfd]; !ok {
+		t.Errorf("expected legacy keys to be unchanged %v", b.Archive)
+	}
+	report, err := b.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Valid() {
+		t.Errorf("expected legacy blockmap to verify %+v", report)
+	}
+
+	none := New(root, WithKeyNormalization(NoNormalization))
+	if err := none.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	c, err := Compare(b, none, Strict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, setting := range c.Settings {
+		if setting == "keyNormalization" {
+			t.Errorf("expected legacy and none normalization to compare equal")
+		}
+	}
+}
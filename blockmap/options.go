@@ -0,0 +1,193 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"crypto"
+	iofs "io/fs"
+	"os"
+
+	"github.com/govice/golinks/archivemap"
+	"github.com/govice/golinks/audit"
+	"github.com/govice/golinks/logging"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Option configures a BlockMap created by New
+type Option func(*BlockMap)
+
+// WithIgnorePaths ignores files prefixed by any of paths
+func WithIgnorePaths(paths ...string) Option {
+	return func(b *BlockMap) { b.SetIgnorePaths(paths) }
+}
+
+// WithIgnorePatterns ignores archive paths matching gitignore style patterns
+func WithIgnorePatterns(patterns ...string) Option {
+	return func(b *BlockMap) { b.SetIgnorePatterns(patterns) }
+}
+
+// WithAutoIgnore leaves unreadable files out of the archive rather than
+// failing generation
+func WithAutoIgnore() Option {
+	return func(b *BlockMap) { b.AutoIgnore = true }
+}
+
+// WithHash hashes files and chunks with alg
+func WithHash(alg HashAlgorithm) Option {
+	return func(b *BlockMap) { b.FileHash = alg }
+}
+
+// WithKeyNormalization normalizes archive keys to n, see SetKeyNormalization
+func WithKeyNormalization(n Normalization) Option {
+	return func(b *BlockMap) { b.SetKeyNormalization(n) }
+}
+
+// WithHashMode derives the root hash with mode
+func WithHashMode(mode HashMode) Option {
+	return func(b *BlockMap) { b.HashMode = mode }
+}
+
+// WithConcurrency hashes n files in parallel. Values less than 1 use
+// runtime.NumCPU workers.
+func WithConcurrency(n int) Option {
+	return func(b *BlockMap) { b.SetConcurrency(n) }
+}
+
+// WithRateLimit caps the bytes read per second while hashing, see SetRateLimit
+func WithRateLimit(bytesPerSecond int64) Option {
+	return func(b *BlockMap) { b.SetRateLimit(bytesPerSecond) }
+}
+
+// WithMaxOpenFiles caps the number of files open at once while hashing
+func WithMaxOpenFiles(n int) Option {
+	return func(b *BlockMap) { b.SetMaxOpenFiles(n) }
+}
+
+// WithMmapThreshold memory maps files of at least n bytes, see SetMmapThreshold
+func WithMmapThreshold(n int64) Option {
+	return func(b *BlockMap) { b.SetMmapThreshold(n) }
+}
+
+// WithReadahead hints the next n files ahead of the workers, see SetReadahead
+func WithReadahead(n int) Option {
+	return func(b *BlockMap) { b.SetReadahead(n) }
+}
+
+// WithFollowSymlinks archives the targets of symbolic links under the path
+// of the link rather than skipping them. Links to directories containing
+// them are skipped. It has no effect on blockmaps of an fs.FS.
+func WithFollowSymlinks() Option {
+	return func(b *BlockMap) { b.FollowSymlinks = true }
+}
+
+// WithSameDevice keeps generation on the device holding the root, skipping
+// directories on other devices such as mount points. It has no effect on
+// blockmaps of an fs.FS.
+func WithSameDevice() Option {
+	return func(b *BlockMap) { b.SameDevice = true }
+}
+
+// WithRecordHardlinks records which files are hard links to the same file,
+// see SetRecordHardlinks
+func WithRecordHardlinks() Option {
+	return func(b *BlockMap) { b.SetRecordHardlinks(true) }
+}
+
+// WithRecordOwner records the owner of every file
+func WithRecordOwner() Option {
+	return func(b *BlockMap) { b.RecordOwner = true }
+}
+
+// WithRecordDirectories records every directory, see SetRecordDirectories
+func WithRecordDirectories() Option {
+	return func(b *BlockMap) { b.SetRecordDirectories(true) }
+}
+
+// WithFileMode saves link files with mode, see SetFileMode
+func WithFileMode(mode os.FileMode) Option {
+	return func(b *BlockMap) { b.SetFileMode(mode) }
+}
+
+// WithBackups keeps the previous n links when saving, see SetBackups
+func WithBackups(n int) Option {
+	return func(b *BlockMap) { b.SetBackups(n) }
+}
+
+// WithAuditLog records saves of the link in l, see SetAuditLog
+func WithAuditLog(l *audit.Log) Option {
+	return func(b *BlockMap) { b.SetAuditLog(l) }
+}
+
+// WithErrorPolicy sets which hashing errors are skipped during generation
+func WithErrorPolicy(policy ErrorPolicy) Option {
+	return func(b *BlockMap) { b.SetErrorPolicy(policy) }
+}
+
+// WithChunking records chunk hashes of large files, see SetChunking
+func WithChunking(mode ChunkMode, size int, threshold int64) Option {
+	return func(b *BlockMap) { b.SetChunking(mode, size, threshold) }
+}
+
+// WithHMACKey keys the root hash with key, see SetHMACKey
+func WithHMACKey(key []byte) Option {
+	return func(b *BlockMap) { b.SetHMACKey(key) }
+}
+
+// WithHashCache reuses hashes of unchanged files stored in c, see SetHashCache
+func WithHashCache(c *HashCache) Option {
+	return func(b *BlockMap) { b.SetHashCache(c) }
+}
+
+// WithLogger sets the logger receiving generation messages
+func WithLogger(logger logging.Logger) Option {
+	return func(b *BlockMap) { b.SetLogger(logger) }
+}
+
+// WithFS generates the blockmap from fsys rather than the OS filesystem
+func WithFS(fsys iofs.FS) Option {
+	return func(b *BlockMap) { b.SetFS(fsys) }
+}
+
+// WithBloomFilter embeds a bloom filter of the archived hashes, see SetBloomFilter
+func WithBloomFilter(rate float64) Option {
+	return func(b *BlockMap) { b.SetBloomFilter(rate) }
+}
+
+// WithMultihash archives multihash encoded file hashes, see SetMultihash
+func WithMultihash() Option {
+	return func(b *BlockMap) { b.SetMultihash(true) }
+}
+
+// WithArchiveStore holds the archive in s, see SetArchiveStore
+func WithArchiveStore(s archivemap.Store) Option {
+	return func(b *BlockMap) { b.SetArchiveStore(s) }
+}
+
+// WithLogKey checks transparency log entries against the log's key, see SetLogKey
+func WithLogKey(key crypto.PublicKey) Option {
+	return func(b *BlockMap) { b.SetLogKey(key) }
+}
+
+// WithTracerProvider traces with tp, see SetTracerProvider
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(b *BlockMap) { b.SetTracerProvider(tp) }
+}
+
+// WithProgress calls fn as files are hashed, see OnProgress
+func WithProgress(fn func(ProgressEvent)) Option {
+	return func(b *BlockMap) { b.OnProgress(fn) }
+}
@@ -0,0 +1,237 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/govice/golinks/blake3"
+)
+
+func TestNew_Options(t *testing.T) {
+	b := New("root",
+		WithIgnorePatterns("*.tmp", "build/"),
+		WithIgnorePaths("root/a", "root/a"),
+		WithAutoIgnore(),
+		WithHash(SHA256),
+		WithHashMode(TreeHashMode),
+		WithConcurrency(8),
+		WithFollowSymlinks(),
+	)
+	if !reflect.DeepEqual(b.IgnorePatterns, []string{"*.tmp", "build/"}) || !reflect.DeepEqual(b.IgnorePaths, []string{"root/a"}) {
+		t.Errorf("unexpected ignores %v %v", b.IgnorePatterns, b.IgnorePaths)
+	}
+	if !b.AutoIgnore || b.FileHash != SHA256 || b.HashMode != TreeHashMode || b.Concurrency() != 8 || !b.FollowSymlinks {
+		t.Errorf("options not applied %+v", b)
+	}
+	if b.SchemaVersion != CurrentSchemaVersion || b.Archive == nil || b.Entries == nil {
+		t.Errorf("defaults not initialized %+v", b)
+	}
+}
+
+func TestWithHash(t *testing.T) {
+	root, err := ioutil.TempDir(tmpDir, "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := ioutil.WriteFile(filepath.Join(root, "a"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b := New(root, WithHash(SHA256))
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if want := sha256.Sum256([]byte("a")); !reflect.DeepEqual(b.Archive["a"], want[:]) {
+		t.Errorf("unexpected hash %x", b.Archive["a"])
+	}
+	report, err := b.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Valid() {
+		t.Errorf("expected sha256 blockmap to verify %+v", report)
+	}
+
+	if err := New(root, WithHash("md4")).Generate(); !errors.Is(err, ErrUnsupportedHash) {
+		t.Errorf("expected unsupported hash error, got %v", err)
+	}
+}
+
+func TestWithHash_BLAKE3(t *testing.T) {
+	root, err := ioutil.TempDir(tmpDir, "blake3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	small := []byte("a")
+	large := make([]byte, blake3ParallelSize+1)
+	for i := range large {
+		large[i] = byte(i % 251)
+	}
+	for name, data := range map[string][]byte{"small": small, "large": large} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := New(root, WithHash(BLAKE3))
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string][]byte{"small": small, "large": large} {
+		if want := blake3.Sum256(data); !reflect.DeepEqual(b.Archive[name], want[:]) {
+			t.Errorf("unexpected %s hash %x", name, b.Archive[name])
+		}
+	}
+}
+
+func TestWithFollowSymlinks(t *testing.T) {
+	root, err := ioutil.TempDir(tmpDir, "follow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := os.Mkdir(filepath.Join(root, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "dir", "a"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "dir"), filepath.Join(root, "linked")); err != nil {
+		t.Skip("symlinks unsupported:", err)
+	}
+	if err := os.Symlink(root, filepath.Join(root, "dir", "loop")); err != nil {
+		t.Fatal(err)
+	}
+
+	b := New(root, WithFollowSymlinks())
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Archive) != 2 || !reflect.DeepEqual(b.Archive["dir/a"], b.Archive["linked/a"]) {
+		t.Errorf("unexpected archive %v", b.Archive)
+	}
+	for _, skipped := range b.Skipped() {
+		if skipped.Reason != SkipSymlink {
+			t.Errorf("unexpected skipped path %v", skipped)
+		}
+	}
+	if len(b.Skipped()) != 2 {
+		t.Errorf("expected both loops to be skipped %v", b.Skipped())
+	}
+}
+
+func TestWithMaxOpenFiles(t *testing.T) {
+	b := New("root", WithConcurrency(8), WithMaxOpenFiles(2), WithRateLimit(1024))
+	if b.workers() != 2 || b.RateLimit() != 1024 {
+		t.Errorf("unexpected workers %d rate %d", b.workers(), b.RateLimit())
+	}
+	if copied := b.emptyCopy(); copied.workers() != 2 || copied.RateLimit() != 1024 {
+		t.Error("expected verification to keep throttling")
+	}
+	b.SetMaxOpenFiles(0)
+	b.SetRateLimit(0)
+	if b.workers() != 8 || b.RateLimit() != 0 {
+		t.Errorf("unexpected workers %d rate %d", b.workers(), b.RateLimit())
+	}
+}
+
+func TestWithReadahead(t *testing.T) {
+	root, err := ioutil.TempDir(tmpDir, "readahead")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	plain := New(root)
+	hinted := New(root, WithReadahead(2), WithConcurrency(2))
+	for _, b := range []*BlockMap{plain, hinted} {
+		if err := b.Generate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(plain.RootHash, hinted.RootHash) {
+		t.Error("expected readahead to leave the root hash unchanged")
+	}
+	if copied := hinted.emptyCopy(); copied.readahead != 2 {
+		t.Error("expected verification to keep readahead")
+	}
+}
+
+func TestWithRecordHardlinks(t *testing.T) {
+	root, err := ioutil.TempDir(tmpDir, "hardlinks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := ioutil.WriteFile(filepath.Join(root, "a"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"b", "c"} {
+		if err := os.Link(filepath.Join(root, "a"), filepath.Join(root, name)); err != nil {
+			t.Skip("hard links unsupported:", err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "d"), []byte("d"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var hashed []string
+	b := New(root, WithRecordHardlinks(), WithConcurrency(4), WithProgress(func(event ProgressEvent) {
+		hashed = append(hashed, event.Path)
+	}))
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if len(hashed) != 4 || len(b.Archive) != 4 {
+		t.Fatalf("expected every link to be archived, progress %v", hashed)
+	}
+	if !reflect.DeepEqual(b.Archive["a"], b.Archive["c"]) {
+		t.Error("expected links to share a hash")
+	}
+	if b.Entries["a"].Hardlink != "" || b.Entries["b"].Hardlink != "a" || b.Entries["c"].Hardlink != "a" || b.Entries["d"].Hardlink != "" {
+		t.Errorf("unexpected hard links %+v", b.Entries)
+	}
+
+	//Breaking a link keeps the content but changes the metadata
+	if err := os.Remove(filepath.Join(root, "c")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "c"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	report, err := b.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Modified) != 0 || !reflect.DeepEqual(report.Metadata, []string{"c"}) {
+		t.Errorf("expected broken link to be reported %+v", report)
+	}
+}
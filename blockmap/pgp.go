@@ -0,0 +1,84 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/openpgp"
+)
+
+// WriteCanonical writes the canonical encoding of the archive, the bytes the
+// flat root hash and OpenPGP signatures are computed over, to w
+func (b *BlockMap) WriteCanonical(w io.Writer) error {
+	if b.Archive == nil && b.store == nil {
+		return ErrNilArchive
+	}
+	return b.writeCanonical(w)
+}
+
+// canonicalReader streams the canonical encoding of the archive. Closing it
+// waits for the archive to no longer be read.
+func (b *BlockMap) canonicalReader() io.ReadCloser {
+	r, w := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.CloseWithError(b.WriteCanonical(w))
+	}()
+	return &canonicalPipe{r, done}
+}
+
+// canonicalPipe is the reading end of a canonical encoding being written
+type canonicalPipe struct {
+	*io.PipeReader
+	done chan struct{}
+}
+
+// Close stops the writer and waits for it to return
+func (p *canonicalPipe) Close() error {
+	err := p.PipeReader.Close()
+	<-p.done
+	return err
+}
+
+// SignPGP writes a detached ASCII-armored OpenPGP signature over the
+// canonical archive to w. The signer's private key must be decrypted.
+func (b *BlockMap) SignPGP(w io.Writer, signer *openpgp.Entity) error {
+	if b.RootHash == nil {
+		return ErrUnhashed
+	}
+	r := b.canonicalReader()
+	defer r.Close()
+	return errors.Wrap(openpgp.ArmoredDetachSign(w, signer, r, nil), "blockmap: failed to sign archive")
+}
+
+// VerifyPGP checks a detached ASCII-armored OpenPGP signature over the
+// canonical archive against the keys in keyring and returns the signer
+func (b *BlockMap) VerifyPGP(signature io.Reader, keyring openpgp.KeyRing) (*openpgp.Entity, error) {
+	if b.RootHash == nil {
+		return nil, ErrUnhashed
+	}
+	r := b.canonicalReader()
+	defer r.Close()
+	signer, err := openpgp.CheckArmoredDetachedSignature(keyring, r, signature)
+	if err != nil {
+		return nil, errors.Wrap(err, "blockmap: invalid OpenPGP signature")
+	}
+	return signer, nil
+}
@@ -0,0 +1,98 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+func TestBlockMap_SignPGP(t *testing.T) {
+	root, err := ioutil.TempDir(tmpDir, "pgp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := ioutil.WriteFile(filepath.Join(root, "a"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	entity, err := openpgp.NewEntity("golinks", "", "golinks@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := openpgp.NewEntity("other", "", "other@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := New(root)
+	if err := b.SignPGP(ioutil.Discard, entity); err != ErrUnhashed {
+		t.Error("expected unhashed error, got", err)
+	}
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	var signature bytes.Buffer
+	if err := b.SignPGP(&signature, entity); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(signature.String(), "-----BEGIN PGP SIGNATURE-----") {
+		t.Fatalf("expected an armored signature, got %q", signature.String())
+	}
+
+	//Signatures cover the canonical archive, which gpg can check too
+	var canonical bytes.Buffer
+	if err := b.WriteCanonical(&canonical); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openpgp.CheckArmoredDetachedSignature(openpgp.EntityList{entity}, &canonical, bytes.NewReader(signature.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := b.VerifyPGP(bytes.NewReader(signature.Bytes()), openpgp.EntityList{other, entity})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer.PrimaryKey.KeyId != entity.PrimaryKey.KeyId {
+		t.Error("expected the signing entity to be returned")
+	}
+	if _, err := b.VerifyPGP(bytes.NewReader(signature.Bytes()), openpgp.EntityList{other}); err == nil {
+		t.Error("expected a signature by an unknown key to be rejected")
+	}
+
+	//Saved signatures aren't archived, and changed archives don't verify
+	if err := ioutil.WriteFile(filepath.Join(root, SignatureName), signature.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "b"), []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.Archive[SignatureName]; ok || len(b.Archive) != 2 {
+		t.Errorf("unexpected archive %v", b.Archive)
+	}
+	if _, err := b.VerifyPGP(bytes.NewReader(signature.Bytes()), openpgp.EntityList{entity}); err == nil {
+		t.Error("expected the signature of a changed archive to be rejected")
+	}
+}
@@ -0,0 +1,92 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"path/filepath"
+	"time"
+)
+
+// DefaultThroughput is the hashing throughput in bytes per second assumed by
+// Plan when no rate limit is set
+var DefaultThroughput int64 = 200 * 1024 * 1024
+
+// PlannedFile is a file Generate would hash
+type PlannedFile struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	// Cached is set when the hash cache holds the file's hash so it won't be read
+	Cached bool `json:"cached,omitempty"`
+}
+
+// Plan describes the work Generate would do without hashing anything
+type Plan struct {
+	// Files are the files that would be archived in walk order
+	Files []PlannedFile `json:"files"`
+	// TotalSize is the size of every planned file
+	TotalSize int64 `json:"totalSize"`
+	// HashSize is the size of the planned files that would be read
+	HashSize int64 `json:"hashSize"`
+	// Skipped are the paths that would be left out of the archive
+	Skipped []SkippedPath `json:"skipped,omitempty"`
+	// ETA estimates how long hashing would take
+	ETA time.Duration `json:"eta"`
+}
+
+// Estimate returns how long reading the plan's uncached files takes at
+// bytesPerSecond
+func (p *Plan) Estimate(bytesPerSecond int64) time.Duration {
+	if bytesPerSecond < 1 {
+		return 0
+	}
+	return time.Duration(float64(p.HashSize) / float64(bytesPerSecond) * float64(time.Second))
+}
+
+// Plan walks and filters the root like Generate but hashes nothing,
+// returning the files that would be archived so ignore patterns can be
+// checked before a long scan. The ETA assumes the rate limit, or
+// DefaultThroughput when unlimited. The blockmap is left unchanged.
+func (b *BlockMap) Plan() (*Plan, error) {
+	previous := b.skipped
+	defer func() { b.skipped = previous }()
+	jobs, err := b.collectJobs()
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{Files: make([]PlannedFile, len(jobs)), Skipped: b.Skipped()}
+	for i, job := range jobs {
+		file := PlannedFile{Path: job.relPath, Size: job.entry.Size}
+		if b.cache != nil && b.fsys == nil && b.splitter(job.entry.Size) == nil {
+			if abs, err := filepath.Abs(job.filePath); err == nil {
+				file.Cached = b.cache.lookup(abs, job.entry.Size, job.entry.ModTime, b.FileHash) != nil
+			}
+		}
+		plan.Files[i] = file
+		plan.TotalSize += file.Size
+		if !file.Cached {
+			plan.HashSize += file.Size
+		}
+	}
+
+	throughput := b.RateLimit()
+	if throughput == 0 {
+		throughput = DefaultThroughput
+	}
+	plan.ETA = plan.Estimate(throughput)
+	return plan, nil
+}
@@ -0,0 +1,75 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBlockMap_Plan(t *testing.T) {
+	root, err := ioutil.TempDir(tmpDir, "plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for name, size := range map[string]int{"a": 100, "b": 300, "c.tmp": 50} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cache, err := OpenHashCache(filepath.Join(tmpDir, "plan-cache.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := New(root, WithIgnorePatterns("*.tmp"), WithRateLimit(100), WithHashCache(cache))
+	plan, err := b.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Files) != 2 || plan.Files[0].Path != "a" || plan.Files[1].Path != "b" || plan.TotalSize != 400 {
+		t.Errorf("unexpected plan %+v", plan)
+	}
+	if plan.HashSize != 400 || plan.ETA != 4*time.Second {
+		t.Errorf("unexpected estimate of %d bytes in %v", plan.HashSize, plan.ETA)
+	}
+	if len(b.Archive) != 0 || b.RootHash != nil || cache.Len() != 0 {
+		t.Error("planning changed the blockmap")
+	}
+
+	//Cached files aren't read
+	b.SetRateLimit(0)
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "d"), make([]byte, 10), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if plan, err = b.Plan(); err != nil {
+		t.Fatal(err)
+	}
+	if !plan.Files[0].Cached || plan.Files[2].Cached || plan.HashSize != 10 || plan.TotalSize != 410 {
+		t.Errorf("unexpected cached plan %+v", plan)
+	}
+	if plan.Estimate(5) != 2*time.Second {
+		t.Errorf("unexpected estimate %v", plan.Estimate(5))
+	}
+}
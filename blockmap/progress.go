@@ -0,0 +1,69 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import "sync"
+
+// ProgressEvent describes the state of a running generation after a file is processed
+type ProgressEvent struct {
+	// FilesProcessed is the number of files processed so far
+	FilesProcessed int
+	// FilesTotal is the number of files that will be processed
+	FilesTotal int
+	// BytesHashed is the total size of the files processed so far
+	BytesHashed int64
+	// Path is the archive path of the file that was just processed
+	Path string
+	// Err is set if the file failed to hash
+	Err error
+}
+
+// OnProgress registers a callback invoked after each file is processed by
+// Generate or Update. Callbacks are never invoked concurrently.
+func (b *BlockMap) OnProgress(fn func(ProgressEvent)) {
+	b.onProgress = fn
+}
+
+// progressTracker serializes progress reporting across hashing workers
+type progressTracker struct {
+	mu    sync.Mutex
+	fn    func(ProgressEvent)
+	event ProgressEvent
+}
+
+func newProgressTracker(fn func(ProgressEvent), total int) *progressTracker {
+	return &progressTracker{
+		fn:    fn,
+		event: ProgressEvent{FilesTotal: total},
+	}
+}
+
+func (p *progressTracker) report(job hashJob) {
+	if p.fn == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.event.FilesProcessed++
+	if job.err == nil {
+		p.event.BytesHashed += job.entry.Size
+	}
+	p.event.Path = job.relPath
+	p.event.Err = job.err
+	p.fn(p.event)
+}
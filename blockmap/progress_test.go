@@ -0,0 +1,50 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import "testing"
+
+func TestBlockMap_OnProgress(t *testing.T) {
+	b := New(tmpDir)
+	b.SetConcurrency(4)
+
+	var events []ProgressEvent
+	b.OnProgress(func(event ProgressEvent) {
+		events = append(events, event)
+	})
+
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != len(b.Archive) {
+		t.Fatal("expected one progress event per archived file", len(events), len(b.Archive))
+	}
+
+	var size int64
+	for _, entry := range b.Entries {
+		size += entry.Size
+	}
+
+	last := events[len(events)-1]
+	if last.FilesProcessed != last.FilesTotal || last.FilesTotal != len(b.Archive) {
+		t.Error("unexpected final progress counts", last.FilesProcessed, last.FilesTotal)
+	}
+	if last.BytesHashed != size {
+		t.Error("unexpected bytes hashed", last.BytesHashed, size)
+	}
+}
@@ -0,0 +1,162 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+package blockmap
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultFileMode is the permission of saved link files
+const DefaultFileMode os.FileMode = 0644
+
+// SetFileMode sets the permission of saved link files. Encrypted links are
+// always saved readable by their owner only. Zero uses DefaultFileMode.
+func (b *BlockMap) SetFileMode(mode os.FileMode) {
+	b.fileMode = mode.Perm()
+}
+
+// FileMode returns the permission of saved link files
+func (b BlockMap) FileMode() os.FileMode {
+	if b.fileMode == 0 {
+		return DefaultFileMode
+	}
+	return b.fileMode
+}
+
+// SetBackups keeps the previous n saved links when saving over a link,
+// named after the link with a numeric suffix where .1 is the most recent.
+// Zero, the default, keeps no backups.
+func (b *BlockMap) SetBackups(n int) {
+	if n < 0 {
+		n = 0
+	}
+	b.backups = n
+}
+
+// Backups returns the number of previous links kept when saving
+func (b BlockMap) Backups() int {
+	return b.backups
+}
+
+// writeLink atomically replaces the file at linkFilePath with the output of
+// write. The data is written to a temporary file in the same directory which
+// is synced and renamed over the link, so a crash leaves either the old or
+// the new link. Previous links are rotated into backups first.
+func writeLink(linkFilePath string, mode os.FileMode, backups int, write func(w io.Writer) error) error {
+	dir := filepath.Dir(linkFilePath)
+	tmp, err := ioutil.TempFile(dir, filepath.Base(linkFilePath)+".tmp*")
+	if err != nil {
+		return &PathError{Op: "write", Path: linkFilePath, Err: err}
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if err := write(tmp); err != nil {
+		return &PathError{Op: "write", Path: linkFilePath, Err: err}
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		return &PathError{Op: "write", Path: linkFilePath, Err: err}
+	}
+	if err := tmp.Sync(); err != nil {
+		return &PathError{Op: "sync", Path: linkFilePath, Err: err}
+	}
+	if err := tmp.Close(); err != nil {
+		return &PathError{Op: "write", Path: linkFilePath, Err: err}
+	}
+
+	if err := rotateBackups(linkFilePath, backups); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), linkFilePath); err != nil {
+		return &PathError{Op: "write", Path: linkFilePath, Err: err}
+	}
+	committed = true
+	return syncDir(dir)
+}
+
+// rotateBackups shifts the backups of the link at linkFilePath up by one,
+// dropping the oldest, and keeps the current link as backup 1. The current
+// link stays in place until it is replaced.
+func rotateBackups(linkFilePath string, backups int) error {
+	if backups == 0 {
+		return nil
+	}
+	if _, err := os.Stat(linkFilePath); os.IsNotExist(err) {
+		return nil
+	}
+
+	backup := func(i int) string { return linkFilePath + "." + strconv.Itoa(i) }
+	for i := backups - 1; i > 0; i-- {
+		if err := os.Rename(backup(i), backup(i+1)); err != nil && !os.IsNotExist(err) {
+			return &PathError{Op: "rotate", Path: backup(i), Err: err}
+		}
+	}
+
+	//Hard link the current link so it's never missing, copying where links aren't supported
+	os.Remove(backup(1))
+	if err := os.Link(linkFilePath, backup(1)); err == nil {
+		return nil
+	}
+	data, err := ioutil.ReadFile(linkFilePath)
+	if err != nil {
+		return &PathError{Op: "rotate", Path: linkFilePath, Err: err}
+	}
+	info, err := os.Stat(linkFilePath)
+	if err != nil {
+		return &PathError{Op: "rotate", Path: linkFilePath, Err: err}
+	}
+	if err := ioutil.WriteFile(backup(1), data, info.Mode().Perm()); err != nil {
+		return &PathError{Op: "rotate", Path: backup(1), Err: err}
+	}
+	return nil
+}
+
+// syncDir flushes the directory entry of a renamed file. Directories can't
+// be synced on Windows, where renames are already durable.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return &PathError{Op: "sync", Path: dir, Err: err}
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return &PathError{Op: "sync", Path: dir, Err: err}
+	}
+	return nil
+}
+
+// writeBytes returns a write function writing data
+func writeBytes(data []byte) func(w io.Writer) error {
+	return func(w io.Writer) error {
+		_, err := w.Write(data)
+		return errors.Wrap(err, "blockmap: failed to write link")
+	}
+}
@@ -0,0 +1,160 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+package blockmap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/govice/golinks/archivemap"
+)
+
+func TestBlockMap_SaveAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir(tmpDir, "save")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b := New(dir, WithBackups(2), WithFileMode(0600))
+	linkFile := filepath.Join(dir, OutputName)
+	var saved [][]byte
+	for _, content := range []string{"1", "2", "3", "4"} {
+		b.Archive = archivemap.ArchiveMap{"a": []byte(content)}
+		if err := b.hashBlockMap(); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Save(dir); err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(linkFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		saved = append(saved, data)
+	}
+
+	info, err := os.Stat(linkFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected mode 0600, got %v", info.Mode().Perm())
+	}
+	for i, want := range []string{OutputName + ".1", OutputName + ".2"} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, want))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != string(saved[len(saved)-2-i]) {
+			t.Errorf("expected %s to hold save %d", want, len(saved)-1-i)
+		}
+	}
+
+	//Only the link and its backups remain, without temporary files
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("expected the link and two backups, got %d files", len(entries))
+	}
+
+	loaded := New(dir)
+	if err := loaded.Load(dir); err != nil {
+		t.Fatal(err)
+	}
+	if !Equal(b, loaded) {
+		t.Error("expected the latest save to load")
+	}
+
+	//Backups and leftover temporary links aren't archived when regenerating
+	if err := ioutil.WriteFile(filepath.Join(dir, OutputName+".tmp123"), []byte("partial"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "a"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Save(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Archive) != 1 || b.Archive["a"] == nil {
+		t.Errorf("expected only a to be archived, got %v", b.Archive)
+	}
+
+	//So are named links and their signatures, backups and temporary files
+	for i := 0; i < 2; i++ {
+		if err := b.SaveNamed(dir, "site"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"site" + OutputName + ".asc", "site" + OutputName + ".tmp123"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("generated"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "site"+OutputName+".1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Archive) != 1 || b.Archive["a"] == nil {
+		t.Errorf("expected only a to be archived, got %v", b.Archive)
+	}
+}
+
+func TestGeneratedFile(t *testing.T) {
+	tests := map[string]bool{
+		OutputName:                    true,
+		SignatureName:                 true,
+		OutputName + ".2":             true,
+		OutputName + ".tmp123":        true,
+		"site" + OutputName:           true,
+		"site" + OutputName + ".asc":  true,
+		"site" + OutputName + ".1":    true,
+		"site" + OutputName + ".tmp9": true,
+		"site" + OutputName + ".01":   false,
+		"site" + OutputName + "s":     false,
+		"sub/site" + OutputName:       false,
+		"a":                           false,
+	}
+	for path, want := range tests {
+		if got := generatedFile(path); got != want {
+			t.Errorf("%s: expected %v, got %v", path, want, got)
+		}
+	}
+}
+
+func TestBlockMap_FileMode(t *testing.T) {
+	b := New("")
+	if b.FileMode() != DefaultFileMode || b.Backups() != 0 {
+		t.Errorf("unexpected defaults %v %d", b.FileMode(), b.Backups())
+	}
+	b.SetFileMode(os.ModeDir | 0640)
+	b.SetBackups(-1)
+	if b.FileMode() != 0640 || b.Backups() != 0 {
+		t.Errorf("unexpected settings %v %d", b.FileMode(), b.Backups())
+	}
+}
@@ -0,0 +1,52 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"context"
+	"crypto/x509"
+
+	"github.com/govice/golinks/sigstore"
+	"github.com/govice/golinks/tlog"
+	"github.com/pkg/errors"
+)
+
+// SignKeyless signs the root hash with an ephemeral key certified by fulcio
+// for the OIDC identity token, records the signature in rekor and stores the
+// certificate and log entry in the blockmap. They aren't part of the root
+// hash.
+func (b *BlockMap) SignKeyless(ctx context.Context, identityToken string, fulcio *sigstore.Fulcio, rekor *tlog.Client) error {
+	if b.RootHash == nil {
+		return ErrUnhashed
+	}
+	bundle, err := sigstore.Sign(ctx, b.RootHash, identityToken, fulcio, rekor)
+	if err != nil {
+		return err
+	}
+	b.Sigstore = bundle
+	return nil
+}
+
+// VerifySigstore checks the blockmap's keyless signature over its root hash
+// with v and returns the signing certificate
+func (b *BlockMap) VerifySigstore(v *sigstore.Verifier) (*x509.Certificate, error) {
+	if b.Sigstore == nil {
+		return nil, ErrNoSigstoreBundle
+	}
+	certificate, err := v.Verify(b.RootHash, b.Sigstore)
+	return certificate, errors.Wrap(err, "blockmap: keyless signature verification failed")
+}
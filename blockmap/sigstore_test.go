@@ -0,0 +1,105 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/govice/golinks/sigstore"
+	"github.com/govice/golinks/tlog"
+)
+
+func TestBlockMap_Sigstore(t *testing.T) {
+	root, err := ioutil.TempDir(tmpDir, "sigstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := ioutil.WriteFile(filepath.Join(root, "a"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(singleEntryLog(key))
+	defer server.Close()
+	rekor, err := tlog.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fulcio, err := sigstore.NewFulcio(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := New(root)
+	if err := b.SignKeyless(context.Background(), "token", fulcio, rekor); err != ErrUnhashed {
+		t.Error("expected unhashed error, got", err)
+	}
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.VerifySigstore(&sigstore.Verifier{}); err != ErrNoSigstoreBundle {
+		t.Error("expected missing signature, got", err)
+	}
+
+	//Bundles are kept in the link but not in the root hash
+	entry, err := rekor.Append(context.Background(), b.RootHash, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootHash := b.RootHash
+	b.Sigstore = &sigstore.Bundle{Signature: []byte("signature"), Entry: entry}
+	var link bytes.Buffer
+	if _, err := b.WriteTo(&link); err != nil {
+		t.Fatal(err)
+	}
+	loaded := New("")
+	if _, err := loaded.ReadFrom(&link); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Sigstore == nil || !loaded.Sigstore.Records(rootHash) {
+		t.Error("keyless signature was not loaded")
+	}
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if b.Sigstore == nil || !bytes.Equal(b.RootHash, rootHash) {
+		t.Error("expected the signature of an unchanged root hash to be kept")
+	}
+
+	//Regenerating with a changed root hash drops the stale signature
+	if err := ioutil.WriteFile(filepath.Join(root, "b"), []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if b.Sigstore != nil {
+		t.Error("stale keyless signature was kept")
+	}
+}
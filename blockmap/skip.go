@@ -0,0 +1,169 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/govice/golinks/ignore"
+	"github.com/govice/golinks/logging"
+	"github.com/govice/golinks/walker"
+	"github.com/pkg/errors"
+)
+
+// SkipReason describes why a path was left out of the archive
+type SkipReason string
+
+// Reasons a path is skipped
+const (
+	SkipPermission  SkipReason = "permission"
+	SkipVanished    SkipReason = "vanished"
+	SkipDevice      SkipReason = "device"
+	SkipSocket      SkipReason = "socket"
+	SkipNamedPipe   SkipReason = "named-pipe"
+	SkipSymlink     SkipReason = "symlink"
+	SkipIrregular   SkipReason = "irregular"
+	SkipReadError   SkipReason = "read-error"
+	SkipOtherDevice SkipReason = "other-device"
+)
+
+// SkippedPath records a path left out of the archive and why
+type SkippedPath struct {
+	Path   string     `json:"path"`
+	Reason SkipReason `json:"reason"`
+	Err    string     `json:"error,omitempty"`
+}
+
+// ErrorPolicy selects which errors encountered while hashing files are
+// skipped and recorded rather than aborting generation
+type ErrorPolicy uint
+
+// Error policies, combined with bitwise or
+const (
+	// AbortOnError aborts generation on any hashing error. This is the default.
+	AbortOnError ErrorPolicy = 0
+	// SkipPermissionErrors skips files that can't be read due to permissions
+	SkipPermissionErrors ErrorPolicy = 1 << iota
+	// SkipVanishedFiles skips files removed between walking and hashing
+	SkipVanishedFiles
+	// SkipReadErrors skips files failing to hash for any other reason
+	SkipReadErrors
+	// SkipAllErrors skips every hashing error
+	SkipAllErrors = SkipPermissionErrors | SkipVanishedFiles | SkipReadErrors
+)
+
+// SetErrorPolicy sets which hashing errors are skipped during generation.
+// Skipped files are reported by Skipped.
+func (b *BlockMap) SetErrorPolicy(policy ErrorPolicy) {
+	b.errorPolicy = policy
+}
+
+// ErrorPolicy returns the policy applied to hashing errors
+func (b *BlockMap) ErrorPolicy() ErrorPolicy {
+	return b.errorPolicy
+}
+
+// Skipped returns every path left out of the archive by the last generation
+// and why. Special files, unreadable directories and files skipped by the
+// error policy or AutoIgnore are included, ignored paths are not.
+func (b *BlockMap) Skipped() []SkippedPath {
+	return append([]SkippedPath{}, b.skipped...)
+}
+
+// skip records a path left out of the archive
+func (b *BlockMap) skip(path string, reason SkipReason, err error) {
+	path = b.normalizeKey(path)
+	skipped := SkippedPath{Path: path, Reason: reason}
+	if err != nil {
+		skipped.Err = err.Error()
+	}
+	b.skipped = append(b.skipped, skipped)
+
+	fields := []logging.Field{logging.F("path", path), logging.F("reason", reason)}
+	if err != nil {
+		fields = append(fields, logging.F("error", err))
+	}
+	b.log().Log(logging.Warn, "skipped path", fields...)
+}
+
+// skipWalked records a path skipped by the walker below root unless it is ignored
+func (b *BlockMap) skipWalked(matcher *ignore.Matcher, root, namespace, path string, info os.FileInfo, err error) {
+	relPath, relErr := filepath.Rel(root, path)
+	if relErr != nil {
+		relPath = path
+	}
+	relPath = strings.Replace(relPath, "\\", "/", -1)
+	if ignoredPath(b.IgnorePaths, path) || matcher.Match(relPath, info != nil && info.IsDir()) {
+		return
+	}
+
+	relPath = namespaced(namespace, relPath)
+	switch {
+	case errors.Is(err, walker.ErrOtherDevice):
+		b.skip(relPath, SkipOtherDevice, nil)
+	case err != nil && info != nil && info.Mode()&os.ModeSymlink != 0:
+		//Followed links that are dangling or loop
+		b.skip(relPath, SkipSymlink, err)
+	case err != nil:
+		b.skip(relPath, errorSkipReason(err), err)
+	case info != nil:
+		b.skip(relPath, modeSkipReason(info.Mode()), nil)
+	}
+}
+
+// errorSkipReason classifies an error that caused a path to be skipped
+func errorSkipReason(err error) SkipReason {
+	cause := errors.Cause(err)
+	if unwrapped := errors.Unwrap(cause); unwrapped != nil {
+		cause = unwrapped
+	}
+	switch {
+	case os.IsPermission(cause):
+		return SkipPermission
+	case os.IsNotExist(cause):
+		return SkipVanished
+	}
+	return SkipReadError
+}
+
+// modeSkipReason classifies a file that isn't a regular file
+func modeSkipReason(mode os.FileMode) SkipReason {
+	switch {
+	case mode&os.ModeSymlink != 0:
+		return SkipSymlink
+	case mode&os.ModeDevice != 0:
+		return SkipDevice
+	case mode&os.ModeSocket != 0:
+		return SkipSocket
+	case mode&os.ModeNamedPipe != 0:
+		return SkipNamedPipe
+	}
+	return SkipIrregular
+}
+
+// skips returns true if the policy skips a hashing error with reason
+func (p ErrorPolicy) skips(reason SkipReason) bool {
+	switch reason {
+	case SkipPermission:
+		return p&SkipPermissionErrors != 0
+	case SkipVanished:
+		return p&SkipVanishedFiles != 0
+	}
+	return p&SkipReadErrors != 0
+}
@@ -0,0 +1,134 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/govice/golinks/logging"
+)
+
+func TestBlockMap_Skipped(t *testing.T) {
+	root, err := ioutil.TempDir(tmpDir, "skipped")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for _, name := range []string{"a", "b"} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(root, "a"), filepath.Join(root, "link")); err != nil {
+		t.Skip("symlinks unsupported:", err)
+	}
+	listener, err := net.Listen("unix", filepath.Join(root, "sock"))
+	if err != nil {
+		t.Skip("unix sockets unsupported:", err)
+	}
+	defer listener.Close()
+
+	b := New(root)
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	reasons := make(map[string]SkipReason)
+	for _, skipped := range b.Skipped() {
+		reasons[skipped.Path] = skipped.Reason
+	}
+	if reasons["link"] != SkipSymlink || reasons["sock"] != SkipSocket || len(reasons) != 2 {
+		t.Errorf("unexpected skipped paths %v", b.Skipped())
+	}
+
+	//Skipped paths are logged to the configured logger
+	var warned []string
+	b.SetLogger(logging.Func(func(level logging.Level, msg string, fields ...logging.Field) {
+		if level == logging.Warn {
+			warned = append(warned, fields[0].Value.(string))
+		}
+	}))
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if len(warned) != 2 {
+		t.Errorf("unexpected warnings %v", warned)
+	}
+	b.SetLogger(nil)
+
+	//Ignored special files aren't reported
+	b.SetIgnorePatterns([]string{"sock"})
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Skipped()) != 1 {
+		t.Errorf("unexpected skipped paths %v", b.Skipped())
+	}
+}
+
+func TestBlockMap_SetErrorPolicy(t *testing.T) {
+	root, err := ioutil.TempDir(tmpDir, "policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	//Simulate a file removed between walking and hashing
+	generate := func(b *BlockMap) error {
+		for _, name := range []string{"a", "b"} {
+			if err := ioutil.WriteFile(filepath.Join(root, name), []byte(name), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		jobs, err := b.collectJobs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Remove(filepath.Join(root, "b")); err != nil {
+			t.Fatal(err)
+		}
+		b.hashJobs(context.Background(), jobs)
+		return b.applyJobs(jobs)
+	}
+
+	if err := generate(New(root)); err == nil {
+		t.Error("expected vanished file to abort generation")
+	}
+
+	b := New(root)
+	b.SetErrorPolicy(SkipVanishedFiles)
+	if err := generate(b); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := b.Archive["a"]; !ok || len(b.Archive) != 1 {
+		t.Errorf("unexpected archive %v", b.Archive)
+	}
+	skipped := b.Skipped()
+	if len(skipped) != 1 || skipped[0].Path != "b" || skipped[0].Reason != SkipVanished || skipped[0].Err == "" {
+		t.Errorf("unexpected skipped paths %v", skipped)
+	}
+
+	b = New(root)
+	b.SetErrorPolicy(SkipPermissionErrors | SkipReadErrors)
+	if err := generate(b); err == nil {
+		t.Error("expected vanished file to abort generation")
+	}
+}
@@ -0,0 +1,148 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"github.com/govice/golinks/archivemap"
+	"github.com/pkg/errors"
+)
+
+// SetArchiveStore holds the archive in s rather than in the Archive and
+// Entries maps, for trees too large to archive in memory. Generate and Update
+// write each hash to the store, the root hash is computed by streaming the
+// store's canonical encoding and JSON links are written by streaming the
+// store, so the archive is never held in memory as a whole.
+//
+// Only flat hashing is supported and links can only be written as JSON.
+// Operations reading the archive maps, such as Verify, Diff and Tree, don't
+// see the archive in the store; use the store directly instead. A nil store
+// holds the archive in memory again. The store isn't closed by the blockmap.
+func (b *BlockMap) SetArchiveStore(s archivemap.Store) {
+	b.store = s
+}
+
+// ArchiveStore returns the store holding the archive, or nil when the
+// archive is held in memory
+func (b *BlockMap) ArchiveStore() archivemap.Store {
+	return b.store
+}
+
+// previousEntry looks up the hash and entry of key in the archive maps
+func (b *BlockMap) previousEntry(key string) ([]byte, archivemap.Entry, bool, error) {
+	entry, ok := b.Entries[key]
+	if !ok {
+		return nil, entry, false, nil
+	}
+	hash, ok := b.Archive[key]
+	return hash, entry, ok, nil
+}
+
+// storedEntry looks up the hash and entry of key in the archive store
+func (b *BlockMap) storedEntry(key string) ([]byte, archivemap.Entry, bool, error) {
+	hash, entry, ok, err := b.store.Get(key)
+	return hash, entry, ok, errors.Wrap(err, "blockmap: failed to read archive store")
+}
+
+// writeCanonical writes the canonical encoding of the archive to w
+func (b *BlockMap) writeCanonical(w io.Writer) error {
+	if b.store != nil {
+		return archivemap.WriteStoreCanonical(w, b.store)
+	}
+	return b.Archive.WriteCanonical(w)
+}
+
+// buildStoreBloomFilter rebuilds an enabled bloom filter from the store
+func (b *BlockMap) buildStoreBloomFilter() error {
+	n, err := b.store.Len()
+	if err != nil {
+		return errors.Wrap(err, "blockmap: failed to read archive store")
+	}
+	filter := NewBloomFilter(n, b.Bloom.Rate)
+	err = b.store.ForEach(func(path string, hash []byte, entry archivemap.Entry) error {
+		if !IsDirectory(path) {
+			filter.Add(b.Digest(hash))
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "blockmap: failed to read archive store")
+	}
+	b.Bloom = filter
+	return nil
+}
+
+// storeArchiveField is the archive as encoded by a blockmap with no archive,
+// which is replaced by the archive in the store when writing
+var storeArchiveField = []byte(`"archive":{}`)
+
+// writeStoreJSON writes the link as JSON, streaming the archive and entries
+// from the store. The output is identical to encoding the same archive held
+// in memory.
+func (b BlockMap) writeStoreJSON(w io.Writer) (int64, error) {
+	b.Archive, b.Entries = nil, nil
+	linkBytes, err := json.Marshal(b)
+	if err != nil {
+		return 0, errors.Wrap(err, "blockmap: failed to encode link json")
+	}
+	split := bytes.Index(linkBytes, storeArchiveField)
+	if split < 0 {
+		return 0, errors.New("blockmap: failed to encode link json")
+	}
+	n, err := b.store.Len()
+	if err != nil {
+		return 0, errors.Wrap(err, "blockmap: failed to read archive store")
+	}
+
+	cw := &countingWriter{w: w}
+	cw.Write(linkBytes[:split])
+	cw.Write([]byte(`"archive":`))
+	if cw.err == nil {
+		err = archivemap.WriteStoreJSON(cw, b.store)
+	}
+	if err == nil && n > 0 {
+		cw.Write([]byte(`,"entries":`))
+		if cw.err == nil {
+			err = archivemap.WriteStoreEntries(cw, b.store)
+		}
+	}
+	if err == nil {
+		cw.Write(linkBytes[split+len(storeArchiveField):])
+		err = cw.err
+	}
+	return cw.n, errors.Wrap(err, "blockmap: failed to write link")
+}
+
+// countingWriter counts the bytes written to w, keeping the first error
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
@@ -0,0 +1,103 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/govice/golinks/archivemap"
+	"github.com/pkg/errors"
+)
+
+func TestBlockMap_ArchiveStore(t *testing.T) {
+	root, err := ioutil.TempDir(tmpDir, "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for name, content := range map[string]string{"a": "a", "b<&>": "b", "dir/c": "c", "dir/sub/d": "d"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dbDir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dbDir)
+	store, err := archivemap.OpenBoltStore(filepath.Join(dbDir, "archive.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	memory := New(root, WithRecordDirectories(), WithBloomFilter(0.01))
+	stored := New(root, WithRecordDirectories(), WithBloomFilter(0.01), WithArchiveStore(store))
+	for _, b := range []*BlockMap{memory, stored} {
+		if err := b.Generate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(stored.Archive) != 0 {
+		t.Errorf("expected the archive to stay out of memory, got %d keys", len(stored.Archive))
+	}
+	if !bytes.Equal(memory.RootHash, stored.RootHash) {
+		t.Error("expected the stored archive to have the in-memory root hash")
+	}
+
+	var want, got bytes.Buffer
+	if _, err := memory.WriteTo(&want); err != nil {
+		t.Fatal(err)
+	}
+	n, err := stored.WriteTo(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != want.String() || n != int64(got.Len()) {
+		t.Errorf("stored link = %s\nwant %s", got.String(), want.String())
+	}
+
+	//Update reuses stored hashes and picks up changes
+	if err := ioutil.WriteFile(filepath.Join(root, "a"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range []*BlockMap{memory, stored} {
+		if err := b.Update(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(memory.RootHash, stored.RootHash) {
+		t.Error("expected updated root hashes to match")
+	}
+
+	if _, err := stored.Verify(); !errors.Is(err, ErrStoreUnsupported) {
+		t.Errorf("Verify error = %v, want ErrStoreUnsupported", err)
+	}
+	tree := New(root, WithHashMode(TreeHashMode), WithArchiveStore(store))
+	if err := tree.Generate(); !errors.Is(err, ErrStoreUnsupported) {
+		t.Errorf("tree hash error = %v, want ErrStoreUnsupported", err)
+	}
+}
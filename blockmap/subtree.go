@@ -0,0 +1,110 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+package blockmap
+
+import (
+	"context"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/govice/golinks/logging"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// GenerateSubtree re-hashes only the files under the directory relPath and
+// patches them into the existing archive, replacing every entry previously
+// recorded below it, then recomputes the root hash. A subtree that no longer
+// exists is removed from the archive. An empty path or "." generates the
+// whole root. Paths of blockmaps spanning several roots start with the
+// namespace of their root.
+func (b *BlockMap) GenerateSubtree(relPath string) error {
+	return b.GenerateSubtreeContext(context.Background(), relPath)
+}
+
+// GenerateSubtreeContext is GenerateSubtree, traced like GenerateContext
+func (b *BlockMap) GenerateSubtreeContext(ctx context.Context, relPath string) (err error) {
+	relPath = cleanRelPath(relPath)
+	if relPath == "" || relPath == "." {
+		return b.GenerateContext(ctx)
+	}
+	ctx, span := b.startSpan(ctx, "blockmap.GenerateSubtree", attribute.String("golinks.root", b.Root), attribute.String("golinks.path", relPath))
+	defer func() { endSpan(span, err) }()
+
+	if _, _, err := b.KeyNormalization.form(); err != nil {
+		return err
+	}
+	b.log().Log(logging.Debug, "generating blockmap subtree", logging.F("root", b.Root), logging.F("path", relPath))
+	_, walkSpan := b.startSpan(ctx, "blockmap.walk")
+	jobs, err := b.collectSubtreeJobs(relPath)
+	if err == nil {
+		err = b.normalizeKeys(jobs)
+	}
+	walkSpan.SetAttributes(attribute.Int("golinks.files", len(jobs)))
+	endSpan(walkSpan, err)
+	if err != nil {
+		return err
+	}
+
+	b.hashJobs(ctx, jobs)
+	prefix := b.normalizeKey(relPath)
+	for path := range b.Archive {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			delete(b.Archive, path)
+			delete(b.Entries, path)
+		}
+	}
+	return b.applyTraced(ctx, jobs)
+}
+
+// collectSubtreeJobs walks the directory relPath and returns every file below
+// it that should be archived
+func (b *BlockMap) collectSubtreeJobs(relPath string) ([]hashJob, error) {
+	root, namespace, subPath, err := b.resolvePath(relPath)
+	if err != nil {
+		return nil, err
+	}
+	b.skipped = nil
+
+	if b.fsys != nil {
+		info, err := iofs.Stat(b.fsys, subPath)
+		if os.IsNotExist(err) {
+			return nil, nil
+		} else if err != nil {
+			return nil, &PathError{Op: "stat", Path: subPath, Err: err}
+		} else if !info.IsDir() {
+			return nil, errors.Wrap(ErrNotDirectory, relPath)
+		}
+		matcher, err := b.ignoreMatcher(b.Root)
+		if err != nil {
+			return nil, err
+		}
+		return b.collectFSJobs(matcher, subPath)
+	}
+
+	dir := filepath.Join(root, filepath.FromSlash(subPath))
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, &PathError{Op: "stat", Path: dir, Err: err}
+	} else if !info.IsDir() {
+		return nil, errors.Wrap(ErrNotDirectory, relPath)
+	}
+	return b.collectDirJobs(root, dir, namespace)
+}
@@ -0,0 +1,125 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+package blockmap
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/pkg/errors"
+)
+
+func TestBlockMap_GenerateSubtree(t *testing.T) {
+	root, err := ioutil.TempDir(tmpDir, "subtree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	write := func(name, content string) {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a", "a")
+	write("project/b", "b")
+	write("project/sub/c", "c")
+	write("other/d", "d")
+
+	b := New(root, WithRecordDirectories())
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+
+	write("a", "changed outside")
+	write("project/b", "modified")
+	write("project/e", "e")
+	if err := os.RemoveAll(filepath.Join(root, "project", "sub")); err != nil {
+		t.Fatal(err)
+	}
+	oldA := b.Archive["a"]
+	if err := b.GenerateSubtree("project/"); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b.Archive["a"], oldA) {
+		t.Error("expected files outside the subtree to keep their hash")
+	}
+	for _, path := range []string{"project/sub/", "project/sub/c"} {
+		if _, ok := b.Archive[path]; ok {
+			t.Errorf("expected %s to be removed", path)
+		}
+	}
+
+	//Patching the rest of the tree matches a full generation
+	if err := os.Remove(filepath.Join(root, "a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(filepath.Join(root, "other")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.GenerateSubtree("other"); err != nil {
+		t.Fatal(err)
+	}
+	delete(b.Archive, "a")
+	delete(b.Entries, "a")
+	if err := b.hashBlockMap(); err != nil {
+		t.Fatal(err)
+	}
+	full := New(root, WithRecordDirectories())
+	if err := full.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(full.RootHash, b.RootHash) || !Equal(full, b) {
+		t.Errorf("subtree generation does not match generated blockmap: %v", Diff(full, b))
+	}
+
+	if err := b.GenerateSubtree("project/b"); errors.Cause(err) != ErrNotDirectory {
+		t.Errorf("expected ErrNotDirectory, got %v", err)
+	}
+}
+
+func TestBlockMap_GenerateSubtreeFS(t *testing.T) {
+	mapFS := fstest.MapFS{
+		"a":         &fstest.MapFile{Data: []byte("a")},
+		"dir/b":     &fstest.MapFile{Data: []byte("b")},
+		"dir/sub/c": &fstest.MapFile{Data: []byte("c")},
+	}
+	b := NewFS(mapFS)
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+
+	mapFS["a"] = &fstest.MapFile{Data: []byte("changed outside")}
+	mapFS["dir/sub/c"] = &fstest.MapFile{Data: []byte("modified")}
+	if err := b.GenerateSubtree("dir/sub"); err != nil {
+		t.Fatal(err)
+	}
+	mapFS["a"] = &fstest.MapFile{Data: []byte("a")}
+	full := NewFS(mapFS)
+	if err := full.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(full.RootHash, b.RootHash) {
+		t.Error("subtree generation does not match generated blockmap")
+	}
+}
@@ -0,0 +1,80 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import "github.com/govice/golinks/fs"
+
+// SetRateLimit caps the bytes read per second while hashing files during
+// Generate, Update and Verify, shared by every worker. Values less than 1
+// remove the limit.
+func (b *BlockMap) SetRateLimit(bytesPerSecond int64) {
+	b.limiter = fs.NewRateLimiter(bytesPerSecond)
+}
+
+// RateLimit returns the bytes read per second while hashing, 0 if unlimited
+func (b *BlockMap) RateLimit() int64 {
+	return b.limiter.Rate()
+}
+
+// SetMaxOpenFiles caps the number of files open at once while hashing,
+// limiting the workers set by SetConcurrency. Values less than 1 remove the
+// cap.
+func (b *BlockMap) SetMaxOpenFiles(n int) {
+	b.maxOpenFiles = n
+}
+
+// SetMmapThreshold memory maps files of at least n bytes while hashing rather
+// than reading them, which is faster for large files on some platforms.
+// Files are read when mapping isn't supported. Values less than 1 always
+// read files.
+func (b *BlockMap) SetMmapThreshold(n int64) {
+	b.mmapThreshold = n
+}
+
+// SetReadahead hints the kernel to read the next n files into memory ahead
+// of the workers hashing them, hiding disk latency when hashing many small
+// files. Hints are only given for the OS filesystem on platforms supporting
+// them. Values less than 1 disable readahead.
+func (b *BlockMap) SetReadahead(n int) {
+	b.readahead = n
+}
+
+// prefetch hints the files readahead places after position k of the hashed
+// jobs, and the first files when k is 0
+func (b *BlockMap) prefetch(jobs []hashJob, hashed []int, k int) {
+	if b.readahead < 1 || b.fsys != nil {
+		return
+	}
+	start := k + b.readahead
+	if k == 0 {
+		start = 0
+	}
+	for i := start; i <= k+b.readahead && i < len(hashed); i++ {
+		if job := jobs[hashed[i]]; !job.dir && job.hash == nil {
+			fs.Readahead(job.filePath)
+		}
+	}
+}
+
+// workers returns the number of workers hashing files
+func (b *BlockMap) workers() int {
+	workers := b.Concurrency()
+	if b.maxOpenFiles > 0 && workers > b.maxOpenFiles {
+		workers = b.maxOpenFiles
+	}
+	return workers
+}
@@ -0,0 +1,75 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+package blockmap
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName names the tracer of this package
+const instrumentationName = "github.com/govice/golinks/blockmap"
+
+// SetTracerProvider traces generation, verification and serialization with
+// tp. Without a provider the global OpenTelemetry provider is used, which
+// records nothing unless an application installs one.
+func (b *BlockMap) SetTracerProvider(tp trace.TracerProvider) {
+	b.tracerProvider = tp
+}
+
+// tracer returns the blockmap's tracer
+func (b BlockMap) tracer() trace.Tracer {
+	tp := b.tracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(instrumentationName)
+}
+
+// startSpan starts a span named name as a child of any span in ctx
+func (b BlockMap) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return b.tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// walkTraced collects the jobs to hash in a span
+func (b *BlockMap) walkTraced(ctx context.Context) ([]hashJob, error) {
+	_, span := b.startSpan(ctx, "blockmap.walk")
+	jobs, err := b.collectJobs()
+	span.SetAttributes(attribute.Int("golinks.files", len(jobs)))
+	endSpan(span, err)
+	return jobs, err
+}
+
+// applyTraced adds hashed jobs to the archive and hashes the root in a span
+func (b *BlockMap) applyTraced(ctx context.Context, jobs []hashJob) error {
+	_, span := b.startSpan(ctx, "blockmap.hashRoot")
+	err := b.applyJobs(jobs)
+	endSpan(span, err)
+	return err
+}
+
+// endSpan records err on span and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
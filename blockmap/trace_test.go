@@ -0,0 +1,97 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+package blockmap
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/govice/golinks/codec"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordingProvider records the names of started spans
+type recordingProvider struct {
+	mu    sync.Mutex
+	names []string
+}
+
+func (p *recordingProvider) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return p
+}
+
+func (p *recordingProvider) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	p.mu.Lock()
+	p.names = append(p.names, name)
+	p.mu.Unlock()
+	return trace.NewNoopTracerProvider().Tracer("").Start(ctx, name, opts...)
+}
+
+func (p *recordingProvider) count(name string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := 0
+	for _, started := range p.names {
+		if started == name {
+			n++
+		}
+	}
+	return n
+}
+
+func TestBlockMap_Tracing(t *testing.T) {
+	dir, err := ioutil.TempDir(tmpDir, "trace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a", "b", "c"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tp := &recordingProvider{}
+	b := New(dir, WithTracerProvider(tp), WithConcurrency(2))
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if n := tp.count("blockmap.hashBatch"); n == 0 || n > 2 {
+		t.Errorf("expected a hashBatch span per worker, got %d", n)
+	}
+	var buf bytes.Buffer
+	if _, err := b.WriteCodec(&buf, codec.JSON); err != nil {
+		t.Fatal(err)
+	}
+	decoded := New(dir, WithTracerProvider(tp))
+	if err := decoded.Decode(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decoded.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"blockmap.Generate", "blockmap.walk", "blockmap.hash", "blockmap.hashRoot", "blockmap.encode", "blockmap.decode", "blockmap.Verify"} {
+		if tp.count(name) == 0 {
+			t.Errorf("expected a %s span, got %v", name, tp.names)
+		}
+	}
+}
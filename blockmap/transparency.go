@@ -0,0 +1,72 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"context"
+	"crypto"
+
+	"github.com/govice/golinks/tlog"
+	"github.com/pkg/errors"
+)
+
+// PublishLog records the root hash in a transparency log as an artifact
+// signed by signer and stores the log entry with its inclusion proof in the
+// blockmap. The entry isn't part of the root hash.
+func (b *BlockMap) PublishLog(ctx context.Context, client *tlog.Client, signer crypto.Signer) error {
+	if b.RootHash == nil {
+		return ErrUnhashed
+	}
+	entry, err := client.Append(ctx, b.RootHash, signer)
+	if err != nil {
+		return err
+	}
+	b.Transparency = entry
+	return nil
+}
+
+// SetLogKey sets the public key of the transparency log entries are checked
+// against. When set, ReadFrom and Load reject links without a log entry
+// signed by the log for their root hash. Entries of links loaded without a
+// log key aren't checked.
+func (b *BlockMap) SetLogKey(key crypto.PublicKey) {
+	b.logKey = key
+}
+
+// VerifyLog checks the blockmap's transparency log entry records its root
+// hash, is signed by the log and its inclusion proof is valid. A log key must
+// be set, the entry alone proves nothing about the log.
+func (b *BlockMap) VerifyLog() error {
+	if b.logKey == nil {
+		return tlog.ErrNoLogKey
+	}
+	if b.Transparency == nil {
+		return ErrNoLogEntry
+	}
+	return errors.Wrap(b.Transparency.Verify(b.RootHash, b.logKey), "blockmap: transparency log verification failed")
+}
+
+// dropStaleLogEntry removes a log entry or keyless signature recording a
+// previous root hash
+func (b *BlockMap) dropStaleLogEntry() {
+	if b.Transparency != nil && !b.Transparency.Records(b.RootHash) {
+		b.Transparency = nil
+	}
+	if b.Sigstore != nil && !b.Sigstore.Records(b.RootHash) {
+		b.Sigstore = nil
+	}
+}
@@ -0,0 +1,143 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/govice/golinks/tlog"
+)
+
+// singleEntryLog answers every append with a log holding only that entry
+func singleEntryLog(key *ecdsa.PrivateKey) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		encoded := base64.StdEncoding.EncodeToString(body)
+		set, _ := json.Marshal(map[string]interface{}{"body": encoded, "integratedTime": 1, "logID": "log", "logIndex": 0})
+		digest := sha256.Sum256(set)
+		signature, _ := ecdsa.SignASN1(rand.Reader, key, digest[:])
+		json.NewEncoder(w).Encode(map[string]interface{}{"entry": map[string]interface{}{
+			"body": encoded, "integratedTime": 1, "logID": "log", "logIndex": 0,
+			"verification": map[string]interface{}{
+				"inclusionProof":       map[string]interface{}{"logIndex": 0, "treeSize": 1, "rootHash": hex.EncodeToString(tlog.LeafHash(body)), "hashes": []string{}},
+				"signedEntryTimestamp": signature,
+			},
+		}})
+	})
+}
+
+func TestBlockMap_PublishLog(t *testing.T) {
+	root, err := ioutil.TempDir(tmpDir, "tlog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := ioutil.WriteFile(filepath.Join(root, "a"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	logKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(singleEntryLog(logKey))
+	defer server.Close()
+	client, err := tlog.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := New(root)
+	if err := b.PublishLog(context.Background(), client, signer); err != ErrUnhashed {
+		t.Error("expected unhashed error, got", err)
+	}
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.PublishLog(context.Background(), client, signer); err != nil {
+		t.Fatal(err)
+	}
+	var link bytes.Buffer
+	if _, err := b.WriteTo(&link); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := New("", WithLogKey(&logKey.PublicKey))
+	if _, err := loaded.ReadFrom(bytes.NewReader(link.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Transparency == nil || loaded.Transparency.UUID != "entry" {
+		t.Error("log entry was not loaded")
+	}
+
+	//A link whose root hash was rewritten no longer matches its entry
+	tampered := bytes.Replace(link.Bytes(), []byte(base64.StdEncoding.EncodeToString(b.RootHash)), []byte(base64.StdEncoding.EncodeToString(make([]byte, 64))), 1)
+	if _, err := New("", WithLogKey(&logKey.PublicKey)).ReadFrom(bytes.NewReader(tampered)); !errors.Is(err, tlog.ErrEntryMismatch) {
+		t.Error("expected entry mismatch, got", err)
+	}
+
+	//Entries can't be verified without the log's key
+	unchecked := New("")
+	if _, err := unchecked.ReadFrom(bytes.NewReader(tampered)); err != nil {
+		t.Fatal(err)
+	}
+	if err := unchecked.VerifyLog(); err != tlog.ErrNoLogKey {
+		t.Error("expected a missing log key error, got", err)
+	}
+
+	//Links without an entry are rejected when a log key is set
+	unpublished := New(root)
+	if err := unpublished.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	link.Reset()
+	if _, err := unpublished.WriteTo(&link); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New("", WithLogKey(&logKey.PublicKey)).ReadFrom(&link); err != ErrNoLogEntry {
+		t.Error("expected missing log entry, got", err)
+	}
+
+	//Regenerating with a changed root hash drops the stale entry
+	if err := ioutil.WriteFile(filepath.Join(root, "b"), []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if b.Transparency != nil {
+		t.Error("stale log entry was kept")
+	}
+}
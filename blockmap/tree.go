@@ -0,0 +1,190 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/binary"
+	"path"
+	"sort"
+	"strings"
+)
+
+// HashMode selects how the root hash of a blockmap is derived
+type HashMode string
+
+const (
+	// FlatHashMode hashes the JSON encoded archive as a whole. This is the default.
+	FlatHashMode HashMode = ""
+	// TreeHashMode hashes each directory from its children so the root hash
+	// is the hash of the top level directory
+	TreeHashMode HashMode = "tree"
+)
+
+const (
+	treeFileType byte = 'f'
+	treeDirType  byte = 'd'
+)
+
+// TreeNode is a file or directory in a hierarchical blockmap tree
+type TreeNode struct {
+	// Name is the base name of the node, empty for the root
+	Name string
+	// Path is the archive path of the node, empty for the root
+	Path string
+	// Hash is the file hash, or for directories the hash of its children
+	Hash []byte
+	// Children are the sorted entries of a directory, nil for files
+	Children []*TreeNode
+	dir      bool
+}
+
+// IsDir returns true if the node is a directory
+func (n *TreeNode) IsDir() bool {
+	return n.dir
+}
+
+// Find returns the node at the archive path p or nil if it does not exist
+func (n *TreeNode) Find(p string) *TreeNode {
+	if p == "" || p == "." {
+		return n
+	}
+
+	node := n
+	for _, name := range strings.Split(p, "/") {
+		var next *TreeNode
+		for _, child := range node.Children {
+			if child.Name == name {
+				next = child
+				break
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		node = next
+	}
+	return node
+}
+
+// Changed returns the paths of all files and directories whose hashes differ
+// between n and other. Subtrees with equal hashes are not descended into.
+func (n *TreeNode) Changed(other *TreeNode) []string {
+	var changed []string
+	var compare func(a, b *TreeNode)
+	compare = func(a, b *TreeNode) {
+		if bytes.Equal(a.Hash, b.Hash) && a.dir == b.dir {
+			return
+		}
+		changed = append(changed, a.Path)
+		if !a.dir || !b.dir {
+			return
+		}
+
+		bChildren := make(map[string]*TreeNode, len(b.Children))
+		for _, child := range b.Children {
+			bChildren[child.Name] = child
+		}
+		for _, child := range a.Children {
+			if other, ok := bChildren[child.Name]; ok {
+				compare(child, other)
+				delete(bChildren, child.Name)
+			} else {
+				changed = append(changed, child.Path)
+			}
+		}
+		for _, child := range bChildren {
+			changed = append(changed, child.Path)
+		}
+	}
+
+	compare(n, other)
+	sort.Strings(changed)
+	return changed
+}
+
+// Tree builds a hierarchical hash tree from the archive. Each directory hash
+// is SHA512 over its children ordered by name, where each child contributes
+// its type ('f' or 'd'), the length prefixed name and its hash.
+func (b *BlockMap) Tree() (*TreeNode, error) {
+	if b.Archive == nil {
+		return nil, ErrNilArchive
+	}
+
+	root := &TreeNode{dir: true}
+	dirs := map[string]*TreeNode{"": root}
+	var dirFor func(p string) *TreeNode
+	dirFor = func(p string) *TreeNode {
+		if dir, ok := dirs[p]; ok {
+			return dir
+		}
+		parentPath := path.Dir(p)
+		if parentPath == "." {
+			parentPath = ""
+		}
+		parent := dirFor(parentPath)
+		dir := &TreeNode{Name: path.Base(p), Path: p, dir: true}
+		parent.Children = append(parent.Children, dir)
+		dirs[p] = dir
+		return dir
+	}
+
+	for _, p := range b.sortedPaths() {
+		//Recorded directories appear in the tree even when empty
+		if IsDirectory(p) {
+			dirFor(strings.TrimSuffix(p, "/"))
+			continue
+		}
+		parentPath := path.Dir(p)
+		if parentPath == "." {
+			parentPath = ""
+		}
+		parent := dirFor(parentPath)
+		parent.Children = append(parent.Children, &TreeNode{
+			Name: path.Base(p),
+			Path: p,
+			Hash: append([]byte{}, b.Archive[p]...),
+		})
+	}
+
+	hashTreeNode(root)
+	return root, nil
+}
+
+// hashTreeNode sorts and hashes a directory node after hashing its children
+func hashTreeNode(node *TreeNode) {
+	sort.Slice(node.Children, func(i, j int) bool {
+		return node.Children[i].Name < node.Children[j].Name
+	})
+
+	h := sha512.New()
+	length := make([]byte, 8)
+	for _, child := range node.Children {
+		nodeType := treeFileType
+		if child.dir {
+			hashTreeNode(child)
+			nodeType = treeDirType
+		}
+		binary.BigEndian.PutUint64(length, uint64(len(child.Name)))
+		h.Write([]byte{nodeType})
+		h.Write(length)
+		h.Write([]byte(child.Name))
+		h.Write(child.Hash)
+	}
+	node.Hash = h.Sum(nil)
+}
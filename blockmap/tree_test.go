@@ -0,0 +1,78 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/govice/golinks/archivemap"
+)
+
+func TestBlockMap_Tree(t *testing.T) {
+	a := New(tmpDir)
+	a.HashMode = TreeHashMode
+	a.Archive = archivemap.ArchiveMap{
+		"root":         []byte("1"),
+		"docs/a":       []byte("2"),
+		"docs/b":       []byte("3"),
+		"src/lib/main": []byte("4"),
+	}
+	if err := a.hashBlockMap(); err != nil {
+		t.Fatal(err)
+	}
+
+	aTree, err := a.Tree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a.RootHash, aTree.Hash) {
+		t.Error("expected tree mode root hash to match the tree root")
+	}
+	if node := aTree.Find("src/lib"); node == nil || !node.IsDir() {
+		t.Error("expected to find directory src/lib")
+	}
+
+	b := New(tmpDir)
+	b.HashMode = TreeHashMode
+	b.Archive = archivemap.ArchiveMap{
+		"root":         []byte("1"),
+		"docs/a":       []byte("2"),
+		"docs/b":       []byte("3"),
+		"src/lib/main": []byte("changed"),
+	}
+	if err := b.hashBlockMap(); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(a.RootHash, b.RootHash) {
+		t.Error("expected root hashes to differ")
+	}
+
+	bTree, err := b.Tree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(aTree.Find("docs").Hash, bTree.Find("docs").Hash) {
+		t.Error("expected unchanged subtree hashes to match")
+	}
+
+	expected := []string{"", "src", "src/lib", "src/lib/main"}
+	if changed := aTree.Changed(bTree); !reflect.DeepEqual(changed, expected) {
+		t.Error("unexpected changed paths", changed)
+	}
+}
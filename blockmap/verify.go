@@ -0,0 +1,183 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"bytes"
+	"context"
+	"sort"
+
+	"github.com/govice/golinks/archivemap"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// VerificationReport describes how the filesystem under a blockmap's root
+// differs from its stored archive
+type VerificationReport struct {
+	// Missing are archived paths no longer present on the filesystem
+	Missing []string `json:"missing"`
+	// Modified are archived paths whose content hash changed
+	Modified []string `json:"modified"`
+	// Added are paths present on the filesystem but not in the archive
+	Added []string `json:"added"`
+	// Metadata are archived paths with unchanged content whose permissions
+	// or ownership changed
+	Metadata []string `json:"metadata,omitempty"`
+	// Ignored are paths skipped by AutoIgnore during verification
+	Ignored []string `json:"ignored,omitempty"`
+	// Skipped are paths left out of the verification and why
+	Skipped []SkippedPath `json:"skipped,omitempty"`
+	// ChangedChunks are the changed regions of modified chunked files
+	ChangedChunks map[string][]archivemap.Chunk `json:"changedChunks,omitempty"`
+	// RootHash is the root hash of the filesystem at verification time
+	RootHash []byte `json:"rootHash"`
+	// RootHashMatches is true if RootHash equals the stored root hash
+	RootHashMatches bool `json:"rootHashMatches"`
+}
+
+// ErrRootHashMismatch is returned when a blockmap's root hash doesn't match
+// its archive
+var ErrRootHashMismatch = errors.New("blockmap: root hash does not match archive")
+
+// CheckRootHash recomputes the root hash from the archive without touching
+// the filesystem and returns ErrRootHashMismatch if it differs from RootHash.
+// Keyed blockmaps need their HMAC key. The blockmap itself is not modified.
+func (b *BlockMap) CheckRootHash() error {
+	c := *b
+	if err := c.hashBlockMap(); err != nil {
+		return err
+	}
+	if !bytes.Equal(c.RootHash, b.RootHash) {
+		return ErrRootHashMismatch
+	}
+	return nil
+}
+
+// Valid returns true if the filesystem matches the stored archive
+func (r *VerificationReport) Valid() bool {
+	return r.RootHashMatches && len(r.Missing) == 0 && len(r.Modified) == 0 &&
+		len(r.Added) == 0 && len(r.Metadata) == 0
+}
+
+// Verify re-walks the root and reports which files are missing, modified or
+// newly added compared to the stored archive. The blockmap itself is not modified.
+func (b *BlockMap) Verify() (*VerificationReport, error) {
+	return b.VerifyContext(context.Background())
+}
+
+// VerifyContext is Verify, tracing the generation of the current archive in
+// spans under any span in ctx
+func (b *BlockMap) VerifyContext(ctx context.Context) (report *VerificationReport, err error) {
+	ctx, span := b.startSpan(ctx, "blockmap.Verify", attribute.String("golinks.root", b.Root))
+	defer func() {
+		if report != nil {
+			span.SetAttributes(attribute.Bool("golinks.valid", report.Valid()))
+		}
+		endSpan(span, err)
+	}()
+
+	if b.store != nil {
+		return nil, ErrStoreUnsupported
+	}
+
+	current := b.emptyCopy()
+	if b.Legacy != nil {
+		current.Legacy = make(map[string][]byte)
+	}
+	report = &VerificationReport{}
+	if err := current.GenerateContext(ctx); err != nil {
+		var ips *IgnoredPathErr
+		if !errors.As(err, &ips) {
+			return nil, err
+		}
+		report.Ignored = ips.Paths
+	}
+	report.Skipped = current.Skipped()
+
+	diff := Diff(b, current)
+	report.Missing = diff.Removed
+	report.Modified = legacyModified(b, current, diff.Modified)
+	for _, path := range report.Modified {
+		if chunks, err := ChangedChunks(b, current, path); err == nil {
+			if report.ChangedChunks == nil {
+				report.ChangedChunks = make(map[string][]archivemap.Chunk)
+			}
+			report.ChangedChunks[path] = chunks
+		}
+	}
+	report.Added = diff.Added
+	report.Metadata = metadataChanges(b, current)
+	report.RootHash = current.RootHash
+	report.RootHashMatches = bytes.Equal(b.RootHash, current.RootHash)
+	return report, nil
+}
+
+// metadataChanges returns the sorted paths present in both blockmaps with equal
+// hashes but differing recorded metadata
+func metadataChanges(a, b *BlockMap) []string {
+	var changed []string
+	for path, aEntry := range a.Entries {
+		bEntry, ok := b.Entries[path]
+		if !ok || !bytes.Equal(a.Archive[path], b.Archive[path]) {
+			continue
+		}
+		if !aEntry.MetadataEqual(bEntry) {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// emptyCopy returns a blockmap sharing b's configuration with an empty archive
+func (b *BlockMap) emptyCopy() *BlockMap {
+	return &BlockMap{
+		Archive:           make(archivemap.ArchiveMap),
+		Entries:           make(archivemap.EntryMap),
+		Root:              b.Root,
+		Roots:             b.Roots,
+		IgnorePaths:       append([]string{}, b.IgnorePaths...),
+		IgnorePatterns:    append([]string{}, b.IgnorePatterns...),
+		AutoIgnore:        b.AutoIgnore,
+		HashMode:          b.HashMode,
+		FileHash:          b.FileHash,
+		Multihash:         b.Multihash,
+		LegacyHash:        b.LegacyHash,
+		FollowSymlinks:    b.FollowSymlinks,
+		RecordHardlinks:   b.RecordHardlinks,
+		SameDevice:        b.SameDevice,
+		KeyNormalization:  b.KeyNormalization,
+		RecordOwner:       b.RecordOwner,
+		RecordDirectories: b.RecordDirectories,
+		Keyed:             b.Keyed,
+		concurrency:       b.concurrency,
+		onProgress:        b.onProgress,
+		hmacKey:           b.hmacKey,
+		fsys:              b.fsys,
+		errorPolicy:       b.errorPolicy,
+		Chunking:          b.Chunking,
+		logger:            b.logger,
+		tracerProvider:    b.tracerProvider,
+		limiter:           b.limiter,
+		mmapThreshold:     b.mmapThreshold,
+		readahead:         b.readahead,
+		logKey:            b.logKey,
+		maxOpenFiles:      b.maxOpenFiles,
+		IPFS:              b.IPFS,
+	}
+}
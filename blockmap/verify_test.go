@@ -0,0 +1,115 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package blockmap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBlockMap_Verify(t *testing.T) {
+	root, err := ioutil.TempDir(tmpDir, "verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	for _, name := range []string{"missing", "modified", "same"} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := New(root)
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := b.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Valid() {
+		t.Error("expected unchanged filesystem to verify", report)
+	}
+
+	if err := os.Remove(filepath.Join(root, "missing")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "modified"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "added"), []byte("added"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err = b.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Valid() || report.RootHashMatches {
+		t.Error("expected changed filesystem to fail verification")
+	}
+	if !reflect.DeepEqual(report.Missing, []string{"missing"}) ||
+		!reflect.DeepEqual(report.Modified, []string{"modified"}) ||
+		!reflect.DeepEqual(report.Added, []string{"added"}) {
+		t.Error("unexpected verification report", report)
+	}
+	if _, ok := b.Archive["added"]; ok {
+		t.Error("verify should not modify the stored archive")
+	}
+}
+
+func TestBlockMap_VerifyMetadata(t *testing.T) {
+	root, err := ioutil.TempDir(tmpDir, "metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	path := filepath.Join(root, "file")
+	if err := ioutil.WriteFile(path, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b := New(root)
+	b.RecordOwner = true
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if b.Entries["file"].Mode.Perm() != 0644 {
+		t.Error("expected entry to record file permissions", b.Entries["file"].Mode)
+	}
+
+	if err := os.Chmod(path, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := b.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Valid() || !reflect.DeepEqual(report.Metadata, []string{"file"}) {
+		t.Error("expected permission change to be reported", report.Metadata)
+	}
+	if len(report.Modified) != 0 {
+		t.Error("permission change should not be reported as a content change")
+	}
+}
@@ -0,0 +1,96 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package bucket
+
+import (
+	"context"
+	iofs "io/fs"
+	pathpkg "path"
+	"sort"
+	"time"
+)
+
+// bucketFS is a read-only filesystem over a listing of objects
+type bucketFS struct {
+	ctx    context.Context
+	walker *Walker
+	files  map[string]objectInfo
+	dirs   map[string][]iofs.DirEntry
+}
+
+// addEntry adds a file or directory entry to its parent directories
+func (f *bucketFS) addEntry(path string, info iofs.FileInfo) {
+	dir := pathpkg.Dir(path)
+	if _, exists := f.dirs[dir]; !exists {
+		f.dirs[dir] = nil
+		f.addEntry(dir, dirInfo(pathpkg.Base(dir)))
+	}
+	f.dirs[dir] = append(f.dirs[dir], iofs.FileInfoToDirEntry(info))
+}
+
+func (f *bucketFS) Open(name string) (iofs.File, error) {
+	if !iofs.ValidPath(name) {
+		return nil, &iofs.PathError{Op: "open", Path: name, Err: iofs.ErrInvalid}
+	}
+	if info, ok := f.files[name]; ok {
+		return &objectFile{objectReader: f.walker.newReader(f.ctx, f.walker.prefix+name, info.Size()), info: info}, nil
+	}
+	if _, ok := f.dirs[name]; ok {
+		return &dirFile{info: dirInfo(pathpkg.Base(name))}, nil
+	}
+	return nil, &iofs.PathError{Op: "open", Path: name, Err: iofs.ErrNotExist}
+}
+
+// ReadDir returns the sorted entries of the named directory
+func (f *bucketFS) ReadDir(name string) ([]iofs.DirEntry, error) {
+	entries, ok := f.dirs[name]
+	if !ok {
+		return nil, &iofs.PathError{Op: "readdir", Path: name, Err: iofs.ErrNotExist}
+	}
+	sorted := append([]iofs.DirEntry{}, entries...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name() < sorted[j].Name() })
+	return sorted, nil
+}
+
+// objectFile is an open object read with ranged requests
+type objectFile struct {
+	*objectReader
+	info objectInfo
+}
+
+func (o *objectFile) Stat() (iofs.FileInfo, error) { return o.info, nil }
+
+// dirFile is an open directory implied by object keys
+type dirFile struct {
+	info dirInfo
+}
+
+func (d *dirFile) Stat() (iofs.FileInfo, error) { return d.info, nil }
+func (d *dirFile) Close() error                 { return nil }
+func (d *dirFile) Read([]byte) (int, error) {
+	return 0, &iofs.PathError{Op: "read", Path: string(d.info), Err: iofs.ErrInvalid}
+}
+
+// dirInfo describes a directory implied by object keys
+type dirInfo string
+
+func (d dirInfo) Name() string        { return string(d) }
+func (d dirInfo) Size() int64         { return 0 }
+func (d dirInfo) Mode() iofs.FileMode { return iofs.ModeDir | 0555 }
+func (d dirInfo) ModTime() time.Time  { return time.Time{} }
+func (d dirInfo) IsDir() bool         { return true }
+func (d dirInfo) Sys() interface{}    { return nil }
@@ -0,0 +1,199 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package bucket
+
+import (
+	"context"
+	"crypto/sha512"
+	"io"
+	iofs "io/fs"
+	"os"
+	pathpkg "path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultRangeSize is the number of bytes fetched by each ranged read
+const DefaultRangeSize int64 = 8 * 1024 * 1024
+
+// Walker enumerates the objects under a key prefix as if the prefix were a
+// directory root
+type Walker struct {
+	client    *Client
+	bucket    string
+	prefix    string
+	rangeSize int64
+}
+
+// NewWalker returns a walker over the objects in bucket under prefix. An
+// empty prefix walks the whole bucket.
+func NewWalker(client *Client, bucket, prefix string) *Walker {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return &Walker{client: client, bucket: bucket, prefix: prefix, rangeSize: DefaultRangeSize}
+}
+
+// Root returns the walked location as bucket/prefix
+func (w *Walker) Root() string {
+	return w.bucket + "/" + w.prefix
+}
+
+// SetRangeSize sets the number of bytes fetched by each ranged read. Sizes
+// less than 1 use DefaultRangeSize.
+func (w *Walker) SetRangeSize(size int64) {
+	if size < 1 {
+		size = DefaultRangeSize
+	}
+	w.rangeSize = size
+}
+
+// WalkFunc calls fn for every object under the prefix in key order with its
+// key relative to the prefix. Zero length keys ending in a slash are folder
+// markers and are skipped.
+func (w *Walker) WalkFunc(ctx context.Context, fn func(path string, info os.FileInfo) error) error {
+	objects, err := w.objects(ctx)
+	if err != nil {
+		return err
+	}
+	for _, object := range objects {
+		if err := fn(object.path, object); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HashObject returns the sha512 hash of the object at path relative to the
+// prefix, reading it with ranged requests
+func (w *Walker) HashObject(ctx context.Context, path string, size int64) ([]byte, error) {
+	r := w.newReader(ctx, w.prefix+path, size)
+	hash := sha512.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return nil, errors.Wrap(err, "bucket: failed to hash "+path)
+	}
+	return hash.Sum(nil), nil
+}
+
+// FS lists the objects under the prefix and returns them as a read-only
+// filesystem, so a blockmap.NewFS blockmap can snapshot the bucket. Files
+// are read with ranged requests made with ctx.
+func (w *Walker) FS(ctx context.Context) (iofs.FS, error) {
+	objects, err := w.objects(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fsys := &bucketFS{ctx: ctx, walker: w, files: make(map[string]objectInfo), dirs: map[string][]iofs.DirEntry{".": nil}}
+	for _, object := range objects {
+		fsys.files[object.path] = object
+		fsys.addEntry(object.path, object)
+	}
+	return fsys, nil
+}
+
+// objects lists the objects under the prefix sorted by relative path
+func (w *Walker) objects(ctx context.Context) ([]objectInfo, error) {
+	listed, err := w.client.ListObjects(ctx, w.bucket, w.prefix)
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]objectInfo, 0, len(listed))
+	for _, object := range listed {
+		path := strings.TrimPrefix(object.Key, w.prefix)
+		if path == "" || strings.HasSuffix(path, "/") {
+			continue
+		}
+		objects = append(objects, objectInfo{Object: object, path: path})
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].path < objects[j].path })
+	return objects, nil
+}
+
+// objectInfo describes an object as a read-only file
+type objectInfo struct {
+	Object
+	path string
+}
+
+func (o objectInfo) Name() string       { return pathpkg.Base(o.path) }
+func (o objectInfo) Size() int64        { return o.Object.Size }
+func (o objectInfo) Mode() os.FileMode  { return 0444 }
+func (o objectInfo) ModTime() time.Time { return o.LastModified }
+func (o objectInfo) IsDir() bool        { return false }
+func (o objectInfo) Sys() interface{}   { return o.Object }
+
+// objectReader streams an object through consecutive ranged reads
+type objectReader struct {
+	ctx    context.Context
+	walker *Walker
+	key    string
+	offset int64
+	start  int64
+	size   int64
+	body   io.ReadCloser
+}
+
+func (w *Walker) newReader(ctx context.Context, key string, size int64) *objectReader {
+	return &objectReader{ctx: ctx, walker: w, key: key, size: size}
+}
+
+func (r *objectReader) Read(p []byte) (int, error) {
+	for {
+		if r.body == nil {
+			if r.offset >= r.size {
+				return 0, io.EOF
+			}
+			length := r.walker.rangeSize
+			if remaining := r.size - r.offset; remaining < length {
+				length = remaining
+			}
+			body, err := r.walker.client.GetRange(r.ctx, r.walker.bucket, r.key, r.offset, length)
+			if err != nil {
+				return 0, err
+			}
+			r.body, r.start = body, r.offset
+		}
+
+		n, err := r.body.Read(p)
+		r.offset += int64(n)
+		if err == io.EOF {
+			r.body.Close()
+			r.body = nil
+			if n > 0 {
+				return n, nil
+			}
+			//Stop rather than re-requesting a range that returned nothing
+			if r.offset == r.start && r.offset < r.size {
+				return 0, io.ErrUnexpectedEOF
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (r *objectReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
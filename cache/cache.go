@@ -0,0 +1,99 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+// Package cache stores computed results for reuse across requests, either in
+// process with a least recently used cache or shared between daemons in
+// Redis, so servers answering many lookups of the same links don't repeat the
+// work of decoding them.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+// Cache stores values by key. Caches may evict values at any time.
+type Cache interface {
+	// Get returns the value of key and whether it is present
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores value under key
+	Set(ctx context.Context, key string, value []byte) error
+}
+
+// LRU is an in-process Cache holding a fixed number of values, evicting the
+// least recently used value first. An LRU is safe for concurrent use.
+type LRU struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	items map[string]*list.Element
+}
+
+type lruEntry struct {
+	key   string
+	value []byte
+}
+
+// NewLRU returns an LRU holding up to size values
+func NewLRU(size int) *LRU {
+	return &LRU{
+		size:  size,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// Get returns the value of key and whether it is present
+func (c *LRU) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	item, ok := c.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	c.order.MoveToFront(item)
+	return item.Value.(*lruEntry).value, true, nil
+}
+
+// Set stores value under key, evicting the least recently used value if the
+// cache is full
+func (c *LRU) Set(ctx context.Context, key string, value []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if item, ok := c.items[key]; ok {
+		item.Value.(*lruEntry).value = value
+		c.order.MoveToFront(item)
+		return nil
+	}
+	if c.size <= 0 {
+		return nil
+	}
+	c.items[key] = c.order.PushFront(&lruEntry{key: key, value: value})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry).key)
+	}
+	return nil
+}
+
+// Len returns the number of cached values
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
@@ -0,0 +1,50 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package cache
+
+import (
+	"context"
+	"testing"
+)
+
+func TestLRU(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(2)
+	c.Set(ctx, "a", []byte("1"))
+	c.Set(ctx, "b", []byte("2"))
+	//Reading a makes b the least recently used value
+	if value, ok, err := c.Get(ctx, "a"); err != nil || !ok || string(value) != "1" {
+		t.Error("expected cached a, got", string(value), ok, err)
+	}
+	c.Set(ctx, "c", []byte("3"))
+	if _, ok, _ := c.Get(ctx, "b"); ok {
+		t.Error("expected b to be evicted")
+	}
+	if _, ok, _ := c.Get(ctx, "a"); !ok {
+		t.Error("expected a to be kept")
+	}
+	c.Set(ctx, "a", []byte("4"))
+	if value, _, _ := c.Get(ctx, "a"); string(value) != "4" || c.Len() != 2 {
+		t.Error("expected a to be replaced, got", string(value), c.Len())
+	}
+
+	empty := NewLRU(0)
+	empty.Set(ctx, "a", []byte("1"))
+	if empty.Len() != 0 {
+		t.Error("expected an empty cache to hold nothing")
+	}
+}
@@ -0,0 +1,269 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package cache
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrRedis is returned when Redis answers a command with an error
+var ErrRedis = errors.New("cache: redis error")
+
+// DefaultPrefix is prepended to the keys stored in Redis
+const DefaultPrefix = "golinks:"
+
+// maxIdle is the number of idle connections a Redis cache keeps open
+const maxIdle = 8
+
+// Redis is a Cache shared between processes through a Redis server. It speaks
+// the Redis protocol directly and keeps a small pool of connections.
+type Redis struct {
+	addr     string
+	password string
+	db       int
+	ttl      time.Duration
+	prefix   string
+	timeout  time.Duration
+
+	mu   sync.Mutex
+	idle []*redisConn
+}
+
+// NewRedis returns a cache in the Redis server at addr
+func NewRedis(addr string) *Redis {
+	return &Redis{addr: addr, prefix: DefaultPrefix, timeout: 5 * time.Second}
+}
+
+// NewRedisURL returns a cache in the Redis server described by a URL such as
+// redis://:password@host:6379/0, where the path selects the database
+func NewRedisURL(rawurl string) (*Redis, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, errors.Wrap(err, "cache: invalid redis URL")
+	}
+	if u.Scheme != "redis" {
+		return nil, errors.Errorf("cache: unsupported redis URL scheme %q", u.Scheme)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	r := NewRedis(addr)
+	if password, ok := u.User.Password(); ok {
+		r.SetPassword(password)
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		n, err := strconv.Atoi(db)
+		if err != nil {
+			return nil, errors.Errorf("cache: invalid redis database %q", db)
+		}
+		r.SetDB(n)
+	}
+	return r, nil
+}
+
+// SetPassword sets the password connections authenticate with
+func (r *Redis) SetPassword(password string) {
+	r.password = password
+}
+
+// SetDB sets the database connections select
+func (r *Redis) SetDB(db int) {
+	r.db = db
+}
+
+// SetTTL expires values ttl after they're set. Zero keeps values until Redis
+// evicts them.
+func (r *Redis) SetTTL(ttl time.Duration) {
+	r.ttl = ttl
+}
+
+// SetPrefix sets the prefix prepended to keys, DefaultPrefix by default
+func (r *Redis) SetPrefix(prefix string) {
+	r.prefix = prefix
+}
+
+// SetTimeout sets the time allowed for each command when the context has no
+// deadline
+func (r *Redis) SetTimeout(timeout time.Duration) {
+	r.timeout = timeout
+}
+
+// Get returns the value of key and whether it is present
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	reply, err := r.do(ctx, "GET", r.prefix+key)
+	if err != nil {
+		return nil, false, err
+	}
+	value, ok := reply.([]byte)
+	return value, ok, nil
+}
+
+// Set stores value under key
+func (r *Redis) Set(ctx context.Context, key string, value []byte) error {
+	args := []string{"SET", r.prefix + key, string(value)}
+	if r.ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(int64(r.ttl/time.Millisecond), 10))
+	}
+	_, err := r.do(ctx, args...)
+	return err
+}
+
+// Close closes the idle connections
+func (r *Redis) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range r.idle {
+		c.Close()
+	}
+	r.idle = nil
+	return nil
+}
+
+// do runs a command on a pooled connection
+func (r *Redis) do(ctx context.Context, args ...string) (interface{}, error) {
+	c, err := r.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(r.timeout)
+	}
+	if err := c.SetDeadline(deadline); err != nil {
+		c.Close()
+		return nil, errors.Wrap(err, "cache: failed to set redis deadline")
+	}
+	reply, err := c.do(args...)
+	if err != nil && errors.Cause(err) != ErrRedis {
+		c.Close()
+		return nil, err
+	}
+	r.release(c)
+	return reply, err
+}
+
+// conn returns an idle connection or dials a new one
+func (r *Redis) conn(ctx context.Context) (*redisConn, error) {
+	r.mu.Lock()
+	if n := len(r.idle); n > 0 {
+		c := r.idle[n-1]
+		r.idle = r.idle[:n-1]
+		r.mu.Unlock()
+		return c, nil
+	}
+	r.mu.Unlock()
+
+	d := net.Dialer{Timeout: r.timeout}
+	nc, err := d.DialContext(ctx, "tcp", r.addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "cache: failed to dial redis")
+	}
+	c := &redisConn{Conn: nc, r: bufio.NewReader(nc)}
+	if err := c.SetDeadline(time.Now().Add(r.timeout)); err != nil {
+		c.Close()
+		return nil, errors.Wrap(err, "cache: failed to set redis deadline")
+	}
+	if r.password != "" {
+		if _, err := c.do("AUTH", r.password); err != nil {
+			c.Close()
+			return nil, errors.Wrap(err, "cache: redis authentication failed")
+		}
+	}
+	if r.db != 0 {
+		if _, err := c.do("SELECT", strconv.Itoa(r.db)); err != nil {
+			c.Close()
+			return nil, errors.Wrap(err, "cache: failed to select redis database")
+		}
+	}
+	return c, nil
+}
+
+func (r *Redis) release(c *redisConn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.idle) >= maxIdle {
+		c.Close()
+		return
+	}
+	r.idle = append(r.idle, c)
+}
+
+// redisConn is a connection speaking the Redis serialization protocol
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// do sends a command and reads its reply. Bulk strings are returned as
+// []byte, nil bulk strings as nil, simple strings as string and integers as
+// int64.
+func (c *redisConn) do(args ...string) (interface{}, error) {
+	var b strings.Builder
+	b.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		b.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n")
+	}
+	if _, err := io.WriteString(c.Conn, b.String()); err != nil {
+		return nil, errors.Wrap(err, "cache: failed to send redis command")
+	}
+	return c.reply()
+}
+
+func (c *redisConn) reply() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, errors.Wrap(err, "cache: failed to read redis reply")
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("cache: empty redis reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, errors.Wrap(ErrRedis, line[1:])
+	case ':':
+		n, err := strconv.ParseInt(line[1:], 10, 64)
+		return n, errors.Wrap(err, "cache: invalid redis integer")
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, errors.Wrap(err, "cache: invalid redis bulk string")
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		value := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, value); err != nil {
+			return nil, errors.Wrap(err, "cache: failed to read redis reply")
+		}
+		return value[:n], nil
+	}
+	return nil, errors.Errorf("cache: unsupported redis reply %q", line)
+}
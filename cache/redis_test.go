@@ -0,0 +1,154 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis answers AUTH, SELECT, GET and SET over the Redis protocol
+type fakeRedis struct {
+	mu       sync.Mutex
+	values   map[string]string
+	expiries map[string]string
+	password string
+	db       string
+}
+
+func (f *fakeRedis) serve(l net.Listener) {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(c)
+	}
+}
+
+func (f *fakeRedis) handle(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	authed := f.password == ""
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		args := make([]string, n)
+		for i := range args {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+			arg := make([]byte, size+2)
+			if _, err := io.ReadFull(r, arg); err != nil {
+				return
+			}
+			args[i] = string(arg[:size])
+		}
+
+		f.mu.Lock()
+		var reply string
+		switch {
+		case args[0] == "AUTH":
+			authed = args[1] == f.password
+			reply = "+OK\r\n"
+			if !authed {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case !authed:
+			reply = "-NOAUTH Authentication required.\r\n"
+		case args[0] == "SELECT":
+			f.db = args[1]
+			reply = "+OK\r\n"
+		case args[0] == "GET":
+			value, ok := f.values[args[1]]
+			reply = "$-1\r\n"
+			if ok {
+				reply = "$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n"
+			}
+		case args[0] == "SET":
+			f.values[args[1]] = args[2]
+			if len(args) == 5 {
+				f.expiries[args[1]] = args[4]
+			}
+			reply = "+OK\r\n"
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		f.mu.Unlock()
+		if _, err := io.WriteString(c, reply); err != nil {
+			return
+		}
+	}
+}
+
+func TestRedis(t *testing.T) {
+	fake := &fakeRedis{values: map[string]string{}, expiries: map[string]string{}, password: "secret"}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go fake.serve(l)
+
+	r, err := NewRedisURL("redis://:secret@" + l.Addr().String() + "/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.SetTTL(time.Minute)
+
+	ctx := context.Background()
+	if _, ok, err := r.Get(ctx, "missing"); err != nil || ok {
+		t.Error("expected a miss, got", ok, err)
+	}
+	value := "binary\r\n\x00value"
+	if err := r.Set(ctx, "key", []byte(value)); err != nil {
+		t.Fatal(err)
+	}
+	got, ok, err := r.Get(ctx, "key")
+	if err != nil || !ok || string(got) != value {
+		t.Errorf("expected cached value, got %q %v %v", got, ok, err)
+	}
+	fake.mu.Lock()
+	if fake.expiries[DefaultPrefix+"key"] != "60000" || fake.db != "2" {
+		t.Error("expected prefixed key with TTL in database 2, got", fake.expiries, fake.db)
+	}
+	fake.mu.Unlock()
+
+	bad := NewRedis(l.Addr().String())
+	bad.SetPassword("wrong")
+	if _, _, err := bad.Get(ctx, "key"); !errors.Is(err, ErrRedis) {
+		t.Error("expected authentication error, got", err)
+	}
+
+	if _, err := NewRedisURL("http://localhost"); err == nil {
+		t.Error("expected unsupported scheme error")
+	}
+}
@@ -0,0 +1,67 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+// Package ci turns verification results into the reports and exit codes CI
+// systems understand: JUnit XML for test summaries and SARIF for code
+// scanning annotations.
+package ci
+
+import (
+	"github.com/govice/golinks/blockmap"
+	"github.com/govice/golinks/policy"
+)
+
+// Exit codes of a CI check
+const (
+	// ExitPass is returned when there is no drift or all of it was accepted
+	ExitPass = 0
+	// ExitFail is returned when the policy rejected drift
+	ExitFail = 1
+	// ExitError is returned when the check couldn't run
+	ExitError = 2
+	// ExitWarn is returned in strict mode when the policy warned on drift
+	ExitWarn = 3
+)
+
+// Evaluate judges a verification report with p. Without a policy every
+// change fails. A root hash mismatch without changed paths also fails.
+func Evaluate(report *blockmap.VerificationReport, p *policy.Policy) *policy.Result {
+	if p == nil {
+		p = policy.NewPolicy()
+	}
+	result := p.EvaluateReport(report)
+	if len(result.Findings) == 0 && !report.RootHashMatches {
+		result.Findings = append(result.Findings, policy.Finding{
+			Path:    ".",
+			Change:  policy.Modified,
+			Outcome: policy.Fail,
+			Reason:  "root hash differs from the link",
+		})
+		result.Outcome = policy.Fail
+	}
+	return result
+}
+
+// ExitCode returns the exit code of a result. Warnings pass unless strict.
+func ExitCode(result *policy.Result, strict bool) int {
+	switch {
+	case result.Outcome == policy.Fail:
+		return ExitFail
+	case result.Outcome == policy.Warn && strict:
+		return ExitWarn
+	}
+	return ExitPass
+}
@@ -0,0 +1,134 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package ci
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/govice/golinks/blockmap"
+	"github.com/govice/golinks/policy"
+)
+
+func TestEvaluate(t *testing.T) {
+	result := Evaluate(&blockmap.VerificationReport{Added: []string{"a"}, Modified: []string{"b"}}, nil)
+	if result.Outcome != policy.Fail || len(result.Failures()) != 2 {
+		t.Errorf("expected every change to fail without a policy, got %+v", result)
+	}
+
+	result = Evaluate(&blockmap.VerificationReport{}, nil)
+	if result.Outcome != policy.Fail || len(result.Findings) != 1 || result.Findings[0].Path != "." {
+		t.Errorf("expected a root hash mismatch to fail, got %+v", result)
+	}
+	if result := Evaluate(&blockmap.VerificationReport{RootHashMatches: true}, nil); result.Outcome != policy.Pass {
+		t.Errorf("expected a matching root to pass, got %+v", result)
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		outcome policy.Outcome
+		strict  bool
+		code    int
+	}{
+		{policy.Pass, false, ExitPass},
+		{policy.Pass, true, ExitPass},
+		{policy.Warn, false, ExitPass},
+		{policy.Warn, true, ExitWarn},
+		{policy.Fail, false, ExitFail},
+		{policy.Fail, true, ExitFail},
+	}
+	for _, test := range tests {
+		if code := ExitCode(&policy.Result{Outcome: test.outcome}, test.strict); code != test.code {
+			t.Errorf("%v strict %v: expected %d, got %d", test.outcome, test.strict, test.code, code)
+		}
+	}
+}
+
+func testResult() *policy.Result {
+	return &policy.Result{
+		Outcome: policy.Fail,
+		Findings: []policy.Finding{
+			{Path: "logs/x", Change: policy.Added, Outcome: policy.Pass, Reason: "allowed"},
+			{Path: "new file", Change: policy.Added, Outcome: policy.Warn, Reason: "added paths only warn"},
+			{Path: "bin/tool", Change: policy.Modified, Outcome: policy.Fail, Reason: "unexpected change"},
+		},
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteJUnit(&buf, "golinks", testResult(), time.Now(), 1500*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	var suites junitSuites
+	if err := xml.Unmarshal(buf.Bytes(), &suites); err != nil {
+		t.Fatal(err)
+	}
+	if suites.Tests != 3 || suites.Failures != 1 || suites.Time != "1.500" || len(suites.Suites) != 1 {
+		t.Fatalf("unexpected suites %+v", suites)
+	}
+	cases := suites.Suites[0].Cases
+	if cases[0].Failure != nil || cases[1].SystemOut != "warning: added paths only warn" ||
+		cases[2].Failure == nil || cases[2].ClassName != "golinks.modified" {
+		t.Errorf("unexpected cases %+v", cases)
+	}
+
+	buf.Reset()
+	if err := WriteJUnit(&buf, "golinks", &policy.Result{}, time.Now(), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &suites); err != nil {
+		t.Fatal(err)
+	}
+	if suites.Tests != 1 || suites.Failures != 0 {
+		t.Errorf("expected a single passing case without drift, got %+v", suites)
+	}
+}
+
+func TestWriteSARIF(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteSARIF(&buf, "/srv/data", testResult()); err != nil {
+		t.Fatal(err)
+	}
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("unexpected log %+v", log)
+	}
+	run := log.Runs[0]
+	if base := run.OriginalURIBases["ROOT"].URI; !strings.HasPrefix(base, "file:///") || !strings.HasSuffix(base, "/srv/data/") {
+		t.Errorf("unexpected root %q", base)
+	}
+	if len(run.Results) != 2 {
+		t.Fatalf("expected passing findings to be left out, got %+v", run.Results)
+	}
+	warning, failure := run.Results[0], run.Results[1]
+	if warning.Level != "warning" || warning.RuleID != "golinks/added" ||
+		warning.Locations[0].PhysicalLocation.ArtifactLocation.URI != "new%20file" {
+		t.Errorf("unexpected warning %+v", warning)
+	}
+	if failure.Level != "error" || failure.RuleID != "golinks/modified" {
+		t.Errorf("unexpected failure %+v", failure)
+	}
+}
@@ -0,0 +1,96 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package ci
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/govice/golinks/policy"
+)
+
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Time     string       `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Time      string      `xml:"time,attr"`
+	Timestamp string      `xml:"timestamp,attr"`
+	Cases     []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes result as a JUnit XML suite named name, started at
+// start and taking duration. Every changed path is a test case, failing
+// when the policy failed it, and warnings are kept in the case's output. A
+// root without drift is a single passing case.
+func WriteJUnit(w io.Writer, name string, result *policy.Result, start time.Time, duration time.Duration) error {
+	seconds := strconv.FormatFloat(duration.Seconds(), 'f', 3, 64)
+	suite := junitSuite{Name: name, Time: seconds, Timestamp: start.UTC().Format("2006-01-02T15:04:05")}
+	for _, f := range result.Findings {
+		c := junitCase{Name: f.Path, ClassName: name + "." + string(f.Change)}
+		switch f.Outcome {
+		case policy.Fail:
+			c.Failure = &junitFailure{Message: f.Reason, Type: string(f.Change), Text: string(f.Change) + " " + f.Path + ": " + f.Reason}
+			suite.Failures++
+		case policy.Warn:
+			c.SystemOut = "warning: " + f.Reason
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+	if len(suite.Cases) == 0 {
+		suite.Cases = append(suite.Cases, junitCase{Name: "no drift", ClassName: name})
+	}
+	suite.Tests = len(suite.Cases)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(junitSuites{
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Time:     seconds,
+		Suites:   []junitSuite{suite},
+	}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
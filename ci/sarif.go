@@ -0,0 +1,137 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package ci
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/govice/golinks/policy"
+)
+
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+	// ruleIDPrefix namespaces the SARIF rule of each kind of change
+	ruleIDPrefix = "golinks/"
+)
+
+// ruleDescriptions describe the SARIF rule of each kind of change
+var ruleDescriptions = []struct {
+	change      policy.Change
+	description string
+}{
+	{policy.Modified, "File content differs from the link"},
+	{policy.Removed, "File recorded in the link is missing"},
+	{policy.Added, "File is not recorded in the link"},
+	{policy.Renamed, "File recorded in the link moved"},
+	{policy.Metadata, "File permissions or ownership changed"},
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool             sarifTool                `json:"tool"`
+	OriginalURIBases map[string]sarifLocation `json:"originalUriBaseIds,omitempty"`
+	Results          []sarifResult            `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifPhysical `json:"locations"`
+}
+
+type sarifPhysical struct {
+	PhysicalLocation struct {
+		ArtifactLocation sarifLocation `json:"artifactLocation"`
+	} `json:"physicalLocation"`
+}
+
+type sarifLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+// WriteSARIF writes the warned and failed findings of result as a SARIF
+// 2.1.0 log, with warnings at level warning and failures at level error.
+// Paths are relative to the ROOT base, the file URI of the root directory
+// when root is given.
+func WriteSARIF(w io.Writer, root string, result *policy.Result) error {
+	driver := sarifDriver{Name: "golinks", InformationURI: "https://github.com/govice/golinks"}
+	for _, rd := range ruleDescriptions {
+		driver.Rules = append(driver.Rules, sarifRule{ID: ruleIDPrefix + string(rd.change), ShortDescription: sarifMessage{Text: rd.description}})
+	}
+	run := sarifRun{Tool: sarifTool{Driver: driver}, Results: []sarifResult{}}
+	if root != "" {
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			return err
+		}
+		base := &url.URL{Scheme: "file", Path: strings.TrimSuffix(filepath.ToSlash(abs), "/") + "/"}
+		run.OriginalURIBases = map[string]sarifLocation{"ROOT": {URI: base.String()}}
+	}
+	for _, f := range result.Findings {
+		level := "error"
+		switch f.Outcome {
+		case policy.Pass:
+			continue
+		case policy.Warn:
+			level = "warning"
+		}
+		r := sarifResult{
+			RuleID:  ruleIDPrefix + string(f.Change),
+			Level:   level,
+			Message: sarifMessage{Text: string(f.Change) + " " + f.Path + ": " + f.Reason},
+		}
+		var location sarifPhysical
+		location.PhysicalLocation.ArtifactLocation = sarifLocation{URI: (&url.URL{Path: f.Path}).String(), URIBaseID: "ROOT"}
+		r.Locations = []sarifPhysical{location}
+		run.Results = append(run.Results, r)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(sarifLog{Schema: sarifSchema, Version: sarifVersion, Runs: []sarifRun{run}})
+}
@@ -0,0 +1,325 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+// Package client is a Go client for the golinks JSON API served by
+// golinkshttp, retrying failed requests and reporting server errors as
+// typed errors.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/govice/golinks/blockmap"
+	"github.com/govice/golinks/codec"
+	"github.com/govice/golinks/golinkshttp"
+	"github.com/pkg/errors"
+)
+
+// Defaults for clients created without options
+const (
+	DefaultTimeout = 30 * time.Second
+	DefaultRetries = 3
+	DefaultBackoff = 500 * time.Millisecond
+)
+
+// Client calls a golinks API mounted at a base URL
+type Client struct {
+	base    string
+	http    *http.Client
+	token   string
+	timeout time.Duration
+	retries int
+	backoff time.Duration
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithToken authenticates requests with a bearer token
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithHTTPClient sends requests with hc, for example to present a TLS client
+// certificate
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.http = hc }
+}
+
+// WithTimeout bounds each attempt of a request. Zero disables the timeout.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) { c.timeout = d }
+}
+
+// WithRetries sets how many times failed requests are retried
+func WithRetries(n int) Option {
+	return func(c *Client) { c.retries = n }
+}
+
+// WithBackoff sets the wait before the first retry, doubling for each retry
+// after it
+func WithBackoff(d time.Duration) Option {
+	return func(c *Client) { c.backoff = d }
+}
+
+// New returns a client for the API mounted at baseURL, such as
+// https://golinks.example.com/api
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "client: invalid base URL")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.New("client: base URL must be http or https")
+	}
+	c := &Client{
+		base:    strings.TrimSuffix(u.String(), "/"),
+		http:    http.DefaultClient,
+		timeout: DefaultTimeout,
+		retries: DefaultRetries,
+		backoff: DefaultBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Submit stores a link file in any codec format, returning its summary
+func (c *Client) Submit(ctx context.Context, link []byte) (*golinkshttp.Summary, error) {
+	summary := &golinkshttp.Summary{}
+	if err := c.do(ctx, http.MethodPost, "/blockmaps", link, summary); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// SubmitBlockMap stores a generated blockmap, returning its summary
+func (c *Client) SubmitBlockMap(ctx context.Context, b *blockmap.BlockMap) (*golinkshttp.Summary, error) {
+	link, err := codec.Encode(codec.CBOR, b)
+	if err != nil {
+		return nil, errors.Wrap(err, "client: failed to encode blockmap")
+	}
+	return c.Submit(ctx, link)
+}
+
+// Summary returns the summary of the stored blockmap with rootHash
+func (c *Client) Summary(ctx context.Context, rootHash []byte) (*golinkshttp.Summary, error) {
+	summary := &golinkshttp.Summary{}
+	if err := c.do(ctx, http.MethodGet, "/blockmaps/"+hex.EncodeToString(rootHash), nil, summary); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// RootHashes returns the root hashes of every stored blockmap
+func (c *Client) RootHashes(ctx context.Context) ([][]byte, error) {
+	var hashes [][]byte
+	offset := 0
+	for {
+		var page struct {
+			Items      []string `json:"items"`
+			NextOffset *int     `json:"nextOffset"`
+		}
+		path := "/blockmaps?limit=" + strconv.Itoa(golinkshttp.MaxLimit) + "&offset=" + strconv.Itoa(offset)
+		if err := c.do(ctx, http.MethodGet, path, nil, &page); err != nil {
+			return nil, err
+		}
+		for _, item := range page.Items {
+			hash, err := hex.DecodeString(item)
+			if err != nil {
+				return nil, errors.Wrap(err, "client: invalid root hash")
+			}
+			hashes = append(hashes, hash)
+		}
+		if page.NextOffset == nil {
+			return hashes, nil
+		}
+		offset = *page.NextOffset
+	}
+}
+
+// Diff compares the stored blockmaps with root hashes a and b
+func (c *Client) Diff(ctx context.Context, a, b []byte) (*blockmap.DiffResult, error) {
+	body, err := json.Marshal(&golinkshttp.DiffRequest{A: hex.EncodeToString(a), B: hex.EncodeToString(b)})
+	if err != nil {
+		return nil, err
+	}
+	diff := &blockmap.DiffResult{}
+	if err := c.do(ctx, http.MethodPost, "/diff", body, diff); err != nil {
+		return nil, err
+	}
+	return diff, nil
+}
+
+// Proof returns a merkle proof for path in the stored blockmap with rootHash
+func (c *Client) Proof(ctx context.Context, rootHash []byte, path string) (*golinkshttp.ProofResponse, error) {
+	proof := &golinkshttp.ProofResponse{}
+	target := "/blockmaps/" + hex.EncodeToString(rootHash) + "/proof?path=" + url.QueryEscape(path)
+	if err := c.do(ctx, http.MethodGet, target, nil, proof); err != nil {
+		return nil, err
+	}
+	return proof, nil
+}
+
+// VerifyProof asks the server whether proof proves against merkleRoot
+func (c *Client) VerifyProof(ctx context.Context, merkleRoot []byte, proof *blockmap.MerkleProof) (bool, error) {
+	body, err := json.Marshal(&golinkshttp.VerifyProofRequest{MerkleRoot: merkleRoot, Proof: *proof})
+	if err != nil {
+		return false, err
+	}
+	var reply struct {
+		Valid bool `json:"valid"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/proofs/verify", body, &reply); err != nil {
+		return false, err
+	}
+	return reply.Valid, nil
+}
+
+// Events calls fn with each event the server publishes until ctx is done or
+// fn returns an error. Dropped streams are reopened, giving up after the
+// client's retries fail in a row. Events published while reconnecting are
+// missed.
+func (c *Client) Events(ctx context.Context, fn func(golinkshttp.Event) error) error {
+	failures := 0
+	for {
+		received, err := c.streamEvents(ctx, fn)
+		if received {
+			failures = 0
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil && !retryable(err) {
+			return unwrapPermanent(err)
+		}
+		if failures >= c.retries {
+			if err == nil {
+				err = errors.New("client: event stream closed")
+			}
+			return err
+		}
+		if err := c.wait(ctx, failures); err != nil {
+			return err
+		}
+		failures++
+	}
+}
+
+// streamEvents reads one event stream, reporting whether it was opened
+func (c *Client) streamEvents(ctx context.Context, fn func(golinkshttp.Event) error) (bool, error) {
+	req, err := c.request(ctx, http.MethodGet, "/events", nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, responseError(resp)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var event golinkshttp.Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return true, &permanent{errors.Wrap(err, "client: invalid event")}
+		}
+		if err := fn(event); err != nil {
+			return true, &permanent{err}
+		}
+	}
+	return true, scanner.Err()
+}
+
+// do sends a request, retrying transport failures and server errors, and
+// decodes the JSON reply into out
+func (c *Client) do(ctx context.Context, method, path string, body []byte, out interface{}) error {
+	for attempt := 0; ; attempt++ {
+		err := c.attempt(ctx, method, path, body, out)
+		if err == nil || !retryable(err) || attempt >= c.retries || ctx.Err() != nil {
+			return unwrapPermanent(err)
+		}
+		if err := c.wait(ctx, attempt); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Client) attempt(ctx context.Context, method, path string, body []byte, out interface{}) error {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	req, err := c.request(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return &permanent{errors.Wrap(err, "client: invalid reply")}
+	}
+	return nil
+}
+
+func (c *Client) request(ctx context.Context, method, path string, body []byte) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, c.base+path, reader)
+	if err != nil {
+		return nil, &permanent{errors.Wrap(err, "client: invalid request")}
+	}
+	req = req.WithContext(ctx)
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return req, nil
+}
+
+// wait sleeps before the retry following attempt
+func (c *Client) wait(ctx context.Context, attempt int) error {
+	timer := time.NewTimer(c.backoff << uint(attempt))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,180 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/govice/golinks/auth"
+	"github.com/govice/golinks/blockmap"
+	"github.com/govice/golinks/golinkshttp"
+	"github.com/pkg/errors"
+)
+
+func generate(t *testing.T, root string, files map[string]string) *blockmap.BlockMap {
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b := blockmap.New(root)
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestClient(t *testing.T) {
+	root, err := ioutil.TempDir("", "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	first := generate(t, root, map[string]string{"a": "a", "b": "b"})
+	second := generate(t, root, map[string]string{"a": "changed"})
+
+	policy := auth.NewPolicy()
+	policy.AddToken("ci", "ci-token", auth.Write)
+	handler := golinkshttp.NewHandler(golinkshttp.NewMemoryStore())
+	handler.SetPolicy(policy)
+	srv := httptest.NewServer(http.StripPrefix("/api", handler))
+	defer srv.Close()
+
+	ctx := context.Background()
+	c, err := New(srv.URL+"/api/", WithToken("ci-token"), WithBackoff(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//Stream events while submitting
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	submitted := make(chan golinkshttp.Event, 2)
+	streamErr := make(chan error, 1)
+	go func() {
+		streamErr <- c.Events(streamCtx, func(event golinkshttp.Event) error {
+			submitted <- event
+			return nil
+		})
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	for _, b := range []*blockmap.BlockMap{first, second} {
+		summary, err := c.SubmitBlockMap(ctx, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if summary.Entries != 2 {
+			t.Errorf("unexpected summary %+v", summary)
+		}
+	}
+	for range []*blockmap.BlockMap{first, second} {
+		select {
+		case event := <-submitted:
+			if event.Type != golinkshttp.EventSubmitted {
+				t.Error("unexpected event", event)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected submission events")
+		}
+	}
+	cancel()
+	if err := <-streamErr; err != context.Canceled {
+		t.Error("expected the stream to end with the context, got", err)
+	}
+
+	hashes, err := c.RootHashes(ctx)
+	if err != nil || len(hashes) != 2 {
+		t.Error("expected 2 root hashes, got", hashes, err)
+	}
+	diff, err := c.Diff(ctx, first.RootHash, second.RootHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Modified) != 1 || diff.Modified[0] != "a" {
+		t.Errorf("unexpected diff %+v", diff)
+	}
+	proof, err := c.Proof(ctx, first.RootHash, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if valid, err := c.VerifyProof(ctx, proof.MerkleRoot, proof.Proof); err != nil || !valid {
+		t.Error("expected the proof to verify, got", err)
+	}
+
+	if _, err := c.Summary(ctx, []byte("missing")); errors.Cause(err) != ErrNotFound {
+		t.Error("expected not found, got", err)
+	}
+	anonymous, err := New(srv.URL + "/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := anonymous.RootHashes(ctx); errors.Cause(err) != ErrUnauthorized {
+		t.Error("expected unauthorized, got", err)
+	}
+	if err := anonymous.Events(ctx, func(golinkshttp.Event) error { return nil }); errors.Cause(err) != ErrUnauthorized {
+		t.Error("expected unauthorized events, got", err)
+	}
+}
+
+func TestClient_Retries(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error":"busy"}`))
+			return
+		}
+		w.Write([]byte(`{"valid":true}`))
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.URL, WithBackoff(time.Millisecond), WithRetries(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if valid, err := c.VerifyProof(context.Background(), nil, &blockmap.MerkleProof{}); err != nil || !valid {
+		t.Error("expected the third attempt to succeed, got", err)
+	}
+
+	atomic.StoreInt32(&requests, 0)
+	c, err = New(srv.URL, WithBackoff(time.Millisecond), WithRetries(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.VerifyProof(context.Background(), nil, &blockmap.MerkleProof{})
+	if serverErr, ok := err.(*Error); !ok || serverErr.StatusCode != http.StatusServiceUnavailable || serverErr.Message != "busy" {
+		t.Error("expected the server error after retrying, got", err)
+	}
+	if errors.Cause(err) != ErrServer {
+		t.Error("expected a server error cause, got", errors.Cause(err))
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New("ftp://example.com"); err == nil {
+		t.Error("expected non-HTTP URLs to be rejected")
+	}
+}
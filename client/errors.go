@@ -0,0 +1,110 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package client
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// Causes of Errors, for comparison with errors.Cause
+var (
+	ErrBadRequest   = errors.New("client: bad request")
+	ErrUnauthorized = errors.New("client: unauthorized")
+	ErrForbidden    = errors.New("client: forbidden")
+	ErrNotFound     = errors.New("client: not found")
+	ErrServer       = errors.New("client: server error")
+	ErrRequest      = errors.New("client: request failed")
+)
+
+// maxErrorSize bounds the error replies read from the server
+const maxErrorSize = 64 << 10
+
+// Error is an error reply from the server
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return "golinks server: " + http.StatusText(e.StatusCode) + ": " + e.Message
+}
+
+// Cause returns the error's class, such as ErrNotFound
+func (e *Error) Cause() error {
+	switch {
+	case e.StatusCode == http.StatusBadRequest || e.StatusCode == http.StatusRequestEntityTooLarge:
+		return ErrBadRequest
+	case e.StatusCode == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case e.StatusCode == http.StatusForbidden:
+		return ErrForbidden
+	case e.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500:
+		return ErrServer
+	default:
+		return ErrRequest
+	}
+}
+
+// responseError returns the Error replied in resp
+func responseError(resp *http.Response) error {
+	data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorSize))
+	var reply struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(data, &reply) != nil || reply.Error == "" {
+		reply.Error = string(data)
+	}
+	return &Error{StatusCode: resp.StatusCode, Message: reply.Error}
+}
+
+// permanent wraps errors that retrying can't fix
+type permanent struct {
+	error
+}
+
+// Cause returns the wrapped error
+func (p *permanent) Cause() error {
+	return p.error
+}
+
+// retryable returns true if err may succeed when retried: transport failures
+// and server errors
+func retryable(err error) bool {
+	switch err := err.(type) {
+	case *permanent:
+		return false
+	case *Error:
+		return err.Cause() == ErrServer
+	default:
+		return true
+	}
+}
+
+// unwrapPermanent returns the error wrapped by a permanent error
+func unwrapPermanent(err error) error {
+	if p, ok := err.(*permanent); ok {
+		return p.error
+	}
+	return err
+}
@@ -0,0 +1,193 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package cmd
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/govice/golinks/age"
+	"github.com/govice/golinks/blockmap"
+	"github.com/govice/golinks/keys"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	ageRecipients     []string
+	ageRecipientFiles []string
+	ageIdentityFiles  []string
+	ageKeyOut         string
+)
+
+// readRecipients parses --recipient keys and the keys of --recipients-file files
+func readRecipients() ([]age.Recipient, error) {
+	var recipients []age.Recipient
+	for _, s := range ageRecipients {
+		r, err := age.ParseRecipient(s)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, r)
+	}
+	for _, path := range ageRecipientFiles {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to open recipients file")
+		}
+		rs, err := age.ParseRecipients(f)
+		f.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, path)
+		}
+		recipients = append(recipients, rs...)
+	}
+	if len(recipients) == 0 {
+		return nil, errors.New("no recipients given, use --recipient or --recipients-file")
+	}
+	return recipients, nil
+}
+
+// readIdentities parses the identities of --identity files. RSA keys held by
+// a keys provider are identities of their SSH public keys.
+func readIdentities() ([]age.Identity, error) {
+	var identities []age.Identity
+	for _, path := range ageIdentityFiles {
+		if keys.IsReference(path) {
+			decrypter, err := keys.OpenDecrypter(context.Background(), path)
+			if err != nil {
+				return nil, err
+			}
+			identity, err := age.NewSSHRSAIdentity(decrypter)
+			if err != nil {
+				return nil, err
+			}
+			identities = append(identities, identity)
+			continue
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to open identity file")
+		}
+		ids, err := age.ParseIdentities(f)
+		f.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, path)
+		}
+		identities = append(identities, ids...)
+	}
+	if len(identities) == 0 {
+		return nil, errors.New("no identities given, use --identity")
+	}
+	return identities, nil
+}
+
+var ageCmd = &cobra.Command{
+	Use:   "age",
+	Short: "Encrypt links to age recipients",
+	Long:  "Encrypt links to one or more age recipients, age1... X25519 keys or ssh-ed25519 and ssh-rsa public keys, so each recipient decrypts them with their own identity. Encrypted links are standard age files.",
+}
+
+var ageKeygenCmd = &cobra.Command{
+	Use:           "keygen",
+	Short:         "Generate an age identity",
+	Long:          "Generate an age X25519 identity in the age-keygen file format, written to stdout or --out. The public key is printed as the recipient to share.",
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := age.GenerateX25519Identity()
+		if err != nil {
+			return err
+		}
+		recipient := id.Recipient().String()
+		key := fmt.Sprintf("# created: %s\n# public key: %s\n%s\n", time.Now().Format(time.RFC3339), recipient, id)
+		if ageKeyOut == "" {
+			fmt.Print(key)
+			return nil
+		}
+		if err := ioutil.WriteFile(ageKeyOut, []byte(key), 0600); err != nil {
+			return errors.Wrap(err, "failed to save identity")
+		}
+		return printResult(map[string]string{"identity": ageKeyOut, "recipient": recipient}, func() {
+			fmt.Println("public key:", recipient)
+		})
+	},
+}
+
+var ageEncryptCmd = &cobra.Command{
+	Use:           "encrypt <dir>",
+	Short:         "Encrypt a directory's link to age recipients",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		recipients, err := readRecipients()
+		if err != nil {
+			return err
+		}
+		b := blockmap.New(args[0])
+		if err := b.Load(args[0]); err != nil {
+			return err
+		}
+		l, err := openAuditLog()
+		if err != nil {
+			return err
+		}
+		b.SetAuditLog(l)
+		if err := b.SaveAge(args[0], recipients...); err != nil {
+			return err
+		}
+		return printResult(map[string]int{"recipients": len(recipients)}, func() {
+			fmt.Println("encrypted link to", len(recipients), "recipients")
+		})
+	},
+}
+
+var ageDecryptCmd = &cobra.Command{
+	Use:           "decrypt <dir>",
+	Short:         "Decrypt a directory's age encrypted link",
+	Long:          "Decrypt a directory's age encrypted link with an identity, age-keygen identity files or SSH private keys, and save it unencrypted.",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		identities, err := readIdentities()
+		if err != nil {
+			return err
+		}
+		b := blockmap.New(args[0])
+		if err := b.LoadAge(args[0], identities...); err != nil {
+			return err
+		}
+		l, err := openAuditLog()
+		if err != nil {
+			return err
+		}
+		b.SetAuditLog(l)
+		if err := b.Save(args[0]); err != nil {
+			return err
+		}
+		return printResult(map[string][]byte{"rootHash": b.RootHash}, func() {
+			fmt.Println("root hash:", base64.StdEncoding.EncodeToString(b.RootHash))
+		})
+	},
+}
@@ -0,0 +1,112 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package cmd
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"time"
+
+	"github.com/govice/golinks/anchor"
+	"github.com/govice/golinks/blockchain"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	anchorTSAs      []string
+	anchorCalendars []string
+	anchorTSARoots  string
+)
+
+var chainAnchorCmd = &cobra.Command{
+	Use:           "anchor [index]",
+	Short:         "Timestamp a block with external timestamp authorities",
+	Long:          "Submit a block's hash, the chain head by default, to RFC 3161 time-stamp authorities and OpenTimestamps calendars and store the proofs with the block.",
+	Args:          cobra.MaximumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var anchorers []anchor.Anchorer
+		for _, url := range anchorTSAs {
+			anchorers = append(anchorers, anchor.NewTSA(url))
+		}
+		for _, url := range anchorCalendars {
+			anchorers = append(anchorers, anchor.NewCalendar(url))
+		}
+		if len(anchorers) == 0 {
+			return errors.New("no timestamp authorities given, use --tsa or --ots")
+		}
+
+		store, chain, err := openChain()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		index := chain.Length() - 1
+		if len(args) == 1 {
+			if index, err = strconv.Atoi(args[0]); err != nil || index < 0 || index >= chain.Length() {
+				return errors.Wrapf(blockchain.ErrBlockNotFound, "index %s", args[0])
+			}
+		}
+
+		blk := chain.At(index)
+		anchored := len(blk.Anchors)
+		anchorErr := anchor.Block(context.Background(), blk, anchorers...)
+		if len(blk.Anchors) > anchored {
+			if err := store.Attach(blk); err != nil {
+				return err
+			}
+		}
+		if anchorErr != nil {
+			return anchorErr
+		}
+		return printResult(blk.Anchors[anchored:], func() {
+			fmt.Println("index:", blk.Index)
+			fmt.Println("hash:", base64.StdEncoding.EncodeToString(blk.BlockHash))
+			for _, a := range blk.Anchors[anchored:] {
+				fmt.Printf("%s %s %s\n", a.Type, a.Authority, time.Unix(0, a.Time).UTC().Format(time.RFC3339))
+			}
+		})
+	},
+}
+
+// verifyAnchors verifies the anchors of every block in the chain against the
+// roots selected by the --tsa-ca flag
+func verifyAnchors(chain *blockchain.Blockchain) error {
+	var roots *x509.CertPool
+	if anchorTSARoots != "" {
+		pem, err := ioutil.ReadFile(anchorTSARoots)
+		if err != nil {
+			return errors.Wrap(err, "failed to read time-stamp authority certificates")
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return errors.New("no certificates found in " + anchorTSARoots)
+		}
+	}
+	for i := 0; i < chain.Length(); i++ {
+		if err := anchor.VerifyBlock(chain.At(i), roots); err != nil {
+			return errors.Wrapf(err, "block %d", i)
+		}
+	}
+	return nil
+}
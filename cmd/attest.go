@@ -0,0 +1,156 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package cmd
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/govice/golinks/attest"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	attestKey        string
+	attestPublicKeys []string
+	attestBuilder    string
+	attestInvocation string
+	attestFiles      bool
+	attestOut        string
+)
+
+var attestCmd = &cobra.Command{
+	Use:   "attest",
+	Short: "Publish link root hashes as signed in-toto attestations with SLSA provenance",
+}
+
+var attestCreateCmd = &cobra.Command{
+	Use:           "create <link>",
+	Short:         "Sign an in-toto statement of a link's root hash in a DSSE envelope",
+	Long:          "Sign an in-toto statement of a link's root hash, with a SLSA provenance predicate, in a DSSE envelope. The argument is a link file, a directory containing one or a tar or zip archive.",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		signer, err := readSigner(attestKey)
+		if err != nil {
+			return err
+		}
+		b, err := loadLink(args[0])
+		if err != nil {
+			return err
+		}
+		opts := []attest.Option{attest.WithBuilder(attestBuilder), attest.WithInvocation(attestInvocation)}
+		if attestFiles {
+			opts = append(opts, attest.WithFiles())
+		}
+		s, err := attest.NewStatement(b, opts...)
+		if err != nil {
+			return err
+		}
+		e, err := attest.Sign(s, signer)
+		if err != nil {
+			return err
+		}
+
+		out := os.Stdout
+		if attestOut != "" {
+			if out, err = os.Create(attestOut); err != nil {
+				return errors.Wrap(err, "failed to create attestation")
+			}
+			defer out.Close()
+			verb("writing attestation to " + attestOut)
+		}
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(e); err != nil {
+			return err
+		}
+		if out != os.Stdout {
+			return out.Close()
+		}
+		return nil
+	},
+}
+
+var attestVerifyCmd = &cobra.Command{
+	Use:           "verify <attestation> <link>",
+	Short:         "Verify a signed attestation and check that it attests a link",
+	Args:          cobra.ExactArgs(2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(attestPublicKeys) == 0 {
+			return errors.New("no trusted key given, use --pub")
+		}
+		var trusted []crypto.PublicKey
+		for _, path := range attestPublicKeys {
+			key, err := readPublicKey(path)
+			if err != nil {
+				return err
+			}
+			trusted = append(trusted, key)
+		}
+		data, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			return errors.Wrap(err, "failed to read attestation")
+		}
+		var e attest.Envelope
+		if err := json.Unmarshal(data, &e); err != nil {
+			return errors.Wrap(err, "failed to decode attestation")
+		}
+		s, err := e.Open(trusted...)
+		if err != nil {
+			return err
+		}
+		b, err := loadLink(args[1])
+		if err != nil {
+			return err
+		}
+		if err := s.Matches(b); err != nil {
+			return err
+		}
+		return printResult(s, func() {
+			fmt.Println("subject:", s.Subject[0].Name)
+			fmt.Println("builder:", s.Predicate.RunDetails.Builder.ID)
+			fmt.Println("attestation is valid")
+		})
+	},
+}
+
+// readPublicKey reads a PKIX PEM encoded public key
+func readPublicKey(path string) (crypto.PublicKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read public key")
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found in " + path)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse public key")
+	}
+	return key, nil
+}
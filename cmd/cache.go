@@ -0,0 +1,108 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"os/user"
+	"path/filepath"
+
+	"github.com/govice/golinks/blockmap"
+	"github.com/spf13/cobra"
+)
+
+var (
+	cacheFile string
+	noCache   bool
+)
+
+// defaultCacheFile returns the hash cache path in the golinks home folder
+func defaultCacheFile() (string, error) {
+	u, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(u.HomeDir, ".golinks", "hashcache.json"), nil
+}
+
+// openHashCache opens the hash cache selected by the --cache-file flag
+func openHashCache() (*blockmap.HashCache, error) {
+	path := cacheFile
+	if path == "" {
+		var err error
+		if path, err = defaultCacheFile(); err != nil {
+			return nil, err
+		}
+	}
+	verb("using hash cache " + path)
+	return blockmap.OpenHashCache(path)
+}
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the hash cache used by generate",
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:           "clear [path]",
+	Short:         "Remove cached hashes, or only those below path",
+	Args:          cobra.MaximumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := openHashCache()
+		if err != nil {
+			return err
+		}
+		before := c.Len()
+		if len(args) == 0 {
+			c.Clear()
+		} else if err := c.Invalidate(args[0]); err != nil {
+			return err
+		}
+		if err := c.Save(); err != nil {
+			return err
+		}
+		removed := before - c.Len()
+		return printResult(map[string]interface{}{"removed": removed, "cached": c.Len()}, func() {
+			fmt.Println("removed:", removed)
+			fmt.Println("cached:", c.Len())
+		})
+	},
+}
+
+var cachePruneCmd = &cobra.Command{
+	Use:           "prune",
+	Short:         "Remove cached hashes of changed or deleted files",
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := openHashCache()
+		if err != nil {
+			return err
+		}
+		removed := c.Prune()
+		if err := c.Save(); err != nil {
+			return err
+		}
+		return printResult(map[string]interface{}{"removed": removed, "cached": c.Len()}, func() {
+			fmt.Println("removed:", removed)
+			fmt.Println("cached:", c.Len())
+		})
+	},
+}
@@ -0,0 +1,125 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/govice/golinks/blockmap"
+	"github.com/govice/golinks/ci"
+	"github.com/govice/golinks/policy"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	ciJUnit  string
+	ciSARIF  string
+	ciStrict bool
+)
+
+// exitError ends the process with code rather than the default 1
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	return e.err.Error()
+}
+
+var ciCmd = &cobra.Command{
+	Use:   "ci <dir>",
+	Short: "Verify a directory in a CI pipeline, writing JUnit XML and SARIF reports",
+	Long: fmt.Sprintf(`Verify a directory against its link file in a CI pipeline. Drift is judged by --policy, or fails when there is none, and written as JUnit XML and SARIF reports.
+
+Exit codes: %d when the check passed, %d when the policy failed drift, %d when the check couldn't run and %d when the policy warned on drift with --strict.`,
+		ci.ExitPass, ci.ExitFail, ci.ExitError, ci.ExitWarn),
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		result, err := ciCheck(args[0])
+		if err != nil {
+			return &exitError{code: ci.ExitError, err: err}
+		}
+		switch code := ci.ExitCode(result, ciStrict); code {
+		case ci.ExitFail:
+			return &exitError{code: code, err: policyError(result)}
+		case ci.ExitWarn:
+			return &exitError{code: code, err: errors.Errorf("policy warned on %d changes", len(result.Warnings()))}
+		}
+		return nil
+	},
+}
+
+// ciCheck verifies root, writes the requested reports and prints the result
+func ciCheck(root string) (*policy.Result, error) {
+	p, err := loadDriftPolicy()
+	if err != nil {
+		return nil, err
+	}
+	b := blockmap.New(root)
+	if err := b.Load(root); err != nil {
+		return nil, err
+	}
+	b.SetLogger(libraryLogger())
+	b.Root = root
+	start := time.Now()
+	report, err := b.Verify()
+	if err != nil {
+		return nil, err
+	}
+	duration := time.Since(start)
+	result := ci.Evaluate(report, p)
+
+	if ciJUnit != "" {
+		if err := writeReport(ciJUnit, func(f *os.File) error {
+			return ci.WriteJUnit(f, "golinks", result, start, duration)
+		}); err != nil {
+			return nil, errors.Wrap(err, "failed to write JUnit report")
+		}
+	}
+	if ciSARIF != "" {
+		if err := writeReport(ciSARIF, func(f *os.File) error {
+			return ci.WriteSARIF(f, root, result)
+		}); err != nil {
+			return nil, errors.Wrap(err, "failed to write SARIF report")
+		}
+	}
+	return result, printResult(struct {
+		*blockmap.VerificationReport
+		Policy *policy.Result `json:"policy"`
+	}{report, result}, func() {
+		printPolicyResult(result)
+	})
+}
+
+// writeReport creates the file at path and writes a report to it with write
+func writeReport(path string, write func(*os.File) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,961 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package cmd
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/govice/golinks/archivemap"
+	"github.com/govice/golinks/bagit"
+	"github.com/govice/golinks/block"
+	"github.com/govice/golinks/blockchain"
+	"github.com/govice/golinks/blockmap"
+	"github.com/govice/golinks/codec"
+	"github.com/govice/golinks/ipfs"
+	"github.com/govice/golinks/manifest"
+	"github.com/govice/golinks/policy"
+	"github.com/govice/golinks/remote"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	outputFormat       string
+	generateSave       bool
+	generateFormat     string
+	generateHashMode   string
+	generateIgnore     []string
+	chainPath          string
+	diffRenames        bool
+	verifyManifest     string
+	generateCIDs       string
+	ipfsAPI            string
+	pinFormat          string
+	remoteRanges       bool
+	remoteWorkers      int
+	generateHash       string
+	generateFollow     bool
+	generateWorkers    int
+	rateLimit          string
+	maxOpenFiles       int
+	mmapThreshold      string
+	readahead          int
+	generateDryRun     bool
+	generateNormalize  string
+	generateHardlinks  bool
+	generateSameDevice bool
+	generateDirs       bool
+	generateBackups    int
+	verifyFiles        []string
+	generateBloom      float64
+	generateChunking   string
+	generateArchiveDB  string
+	generateMultihash  bool
+	genesisCreator     string
+	genesisRoot        string
+	genesisPolicy      map[string]string
+	checkpointKey      string
+	checkpointPrune    bool
+	chainMerkle        bool
+	chainWriter        string
+	chainDB            string
+)
+
+var generateCmd = &cobra.Command{
+	Use:           "generate <dir>...",
+	Short:         "Generate a blockmap for a directory",
+	Long:          "Generate a blockmap for a directory. Several directories are archived as one blockmap with each directory's files under its base name, saved to the working directory with --save.",
+	Args:          cobra.MinimumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts := []blockmap.Option{
+			blockmap.WithLogger(libraryLogger()),
+			blockmap.WithIgnorePatterns(generateIgnore...),
+			blockmap.WithConcurrency(generateWorkers),
+		}
+		if generateHashMode != "flat" {
+			opts = append(opts, blockmap.WithHashMode(blockmap.HashMode(generateHashMode)))
+		}
+		if generateHash != "sha512" {
+			opts = append(opts, blockmap.WithHash(blockmap.HashAlgorithm(generateHash)))
+		}
+		if generateNormalize != "" {
+			opts = append(opts, blockmap.WithKeyNormalization(blockmap.Normalization(generateNormalize)))
+		}
+		if generateSameDevice {
+			opts = append(opts, blockmap.WithSameDevice())
+		}
+		if generateHardlinks {
+			opts = append(opts, blockmap.WithRecordHardlinks())
+		}
+		if generateDirs {
+			opts = append(opts, blockmap.WithRecordDirectories())
+		}
+		if generateBackups > 0 {
+			opts = append(opts, blockmap.WithBackups(generateBackups))
+		}
+		switch blockmap.ChunkMode(generateChunking) {
+		case "", blockmap.FixedChunks, blockmap.CDCChunks:
+		default:
+			return errors.Errorf("unknown chunking %q", generateChunking)
+		}
+		if generateChunking != "" {
+			opts = append(opts, blockmap.WithChunking(blockmap.ChunkMode(generateChunking), 0, 0))
+		}
+		if generateBloom > 0 {
+			opts = append(opts, blockmap.WithBloomFilter(generateBloom))
+		}
+		if generateFollow {
+			opts = append(opts, blockmap.WithFollowSymlinks())
+		}
+		if generateMultihash {
+			opts = append(opts, blockmap.WithMultihash())
+		}
+		if generateArchiveDB != "" {
+			store, err := archivemap.OpenBoltStore(generateArchiveDB)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+			opts = append(opts, blockmap.WithArchiveStore(store))
+		}
+		if !noCache {
+			c, err := openHashCache()
+			if err != nil {
+				return err
+			}
+			opts = append(opts, blockmap.WithHashCache(c))
+			defer func() {
+				if err := c.Save(); err != nil {
+					fmt.Fprintln(os.Stderr, "failed to save hash cache:", err)
+				}
+			}()
+		}
+		b := blockmap.New(args[0], opts...)
+		if err := throttle(b); err != nil {
+			return err
+		}
+		linkDir := args[0]
+		if len(args) > 1 {
+			roots, err := blockmap.Namespaces(args)
+			if err != nil {
+				return err
+			}
+			if err := b.SetRoots(roots); err != nil {
+				return err
+			}
+			b.Root, linkDir = "", "."
+		}
+		switch generateCIDs {
+		case "":
+		case "v0":
+			b.SetCIDs(true, ipfs.CIDv0)
+		case "v1":
+			b.SetCIDs(true, ipfs.CIDv1)
+		default:
+			return errors.Errorf("unknown CID version %q", generateCIDs)
+		}
+		if generateDryRun {
+			plan, err := b.Plan()
+			if err != nil {
+				return err
+			}
+			return printResult(plan, func() {
+				for _, file := range plan.Files {
+					fmt.Println(file.Path, file.Size)
+				}
+				for _, skipped := range plan.Skipped {
+					fmt.Println("skipped:", skipped.Path, skipped.Reason)
+				}
+				fmt.Println("files:", len(plan.Files))
+				fmt.Println("total size:", plan.TotalSize)
+				fmt.Println("to hash:", plan.HashSize)
+				fmt.Println("eta:", plan.ETA.Round(time.Second))
+			})
+		}
+		verb("generating blockmap for " + strings.Join(args, ", "))
+		if err := b.Generate(); err != nil {
+			return err
+		}
+		if generateSave {
+			c, err := codec.ByName(generateFormat)
+			if err != nil {
+				return err
+			}
+			l, err := openAuditLog()
+			if err != nil {
+				return err
+			}
+			b.SetAuditLog(l)
+			if err := b.SaveCodec(linkDir, "", c); err != nil {
+				return err
+			}
+		}
+		entries := len(b.Archive)
+		if store := b.ArchiveStore(); store != nil {
+			n, err := store.Len()
+			if err != nil {
+				return err
+			}
+			entries = n
+		}
+		result := map[string]interface{}{
+			"root":     b.Root,
+			"rootHash": b.RootHash,
+			"entries":  entries,
+		}
+		if b.Roots != nil {
+			result["roots"] = b.Roots
+		}
+		return printResult(result, func() {
+			if b.Roots == nil {
+				fmt.Println("root:", b.Root)
+			} else {
+				for _, arg := range args {
+					fmt.Println("root:", arg)
+				}
+			}
+			fmt.Println("entries:", entries)
+			fmt.Println("root hash:", base64.StdEncoding.EncodeToString(b.RootHash))
+		})
+	},
+}
+
+var verifyCmd = &cobra.Command{
+	Use:           "verify <dir>",
+	Short:         "Verify a directory against its link file",
+	Long:          "Verify a directory against its link file, or against a md5sum/sha256sum, BagIt or hashdeep manifest with --manifest.",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if verifyManifest != "" {
+			return verifyAgainstManifest(args[0])
+		}
+		b := blockmap.New(args[0])
+		if err := b.Load(args[0]); err != nil {
+			return err
+		}
+		b.SetLogger(libraryLogger())
+		if err := throttle(b); err != nil {
+			return err
+		}
+		b.Root = args[0]
+		if len(verifyFiles) > 0 {
+			return verifyFilePaths(b, verifyFiles)
+		}
+		p, err := loadDriftPolicy()
+		if err != nil {
+			return err
+		}
+		report, err := b.Verify()
+		if err != nil {
+			return err
+		}
+		if p != nil {
+			result := p.EvaluateReport(report)
+			if err := printResult(struct {
+				*blockmap.VerificationReport
+				Policy *policy.Result `json:"policy"`
+			}{report, result}, func() {
+				printPolicyResult(result)
+			}); err != nil {
+				return err
+			}
+			return policyError(result)
+		}
+		if err := printResult(report, func() {
+			printPaths("missing", report.Missing)
+			printPaths("modified", report.Modified)
+			printPaths("added", report.Added)
+			printPaths("metadata", report.Metadata)
+			if report.Valid() {
+				fmt.Println("link is valid")
+			}
+		}); err != nil {
+			return err
+		}
+		if !report.Valid() {
+			return errors.New("invalid link")
+		}
+		return nil
+	},
+}
+
+// verifyFilePaths spot-checks paths of a link without verifying the whole directory
+func verifyFilePaths(b *blockmap.BlockMap, paths []string) error {
+	var results []*blockmap.FileVerification
+	valid := true
+	for _, path := range paths {
+		result, err := b.VerifyFile(path)
+		if err != nil {
+			return err
+		}
+		results = append(results, result)
+		valid = valid && result.Valid()
+	}
+
+	if err := printResult(results, func() {
+		for _, result := range results {
+			switch {
+			case result.Missing:
+				fmt.Println("missing:", result.Path)
+			case result.Modified:
+				fmt.Println("modified:", result.Path)
+			case result.Metadata:
+				fmt.Println("metadata:", result.Path)
+			default:
+				fmt.Println("ok:", result.Path)
+			}
+		}
+	}); err != nil {
+		return err
+	}
+	if !valid {
+		return errors.New("invalid link")
+	}
+	return nil
+}
+
+// verifyAgainstManifest verifies dir against the external manifest at verifyManifest
+func verifyAgainstManifest(dir string) error {
+	m, err := manifest.Open(verifyManifest)
+	if err != nil {
+		return err
+	}
+	verb("verifying " + dir + " against " + string(m.Algorithm) + " manifest " + verifyManifest)
+	report, err := m.Verify(dir)
+	if err != nil {
+		return err
+	}
+	if err := printResult(report, func() {
+		printPaths("missing", report.Missing)
+		printPaths("modified", report.Modified)
+		printPaths("unlisted", report.Added)
+		if report.Valid() {
+			fmt.Println("manifest is valid")
+		}
+	}); err != nil {
+		return err
+	}
+	if !report.Valid() {
+		return errors.New("manifest does not match")
+	}
+	return nil
+}
+
+var diffCmd = &cobra.Command{
+	Use:           "diff <link> <link>",
+	Short:         "Show differences between two links",
+	Long:          "Show differences between two links. Each argument is a link file, a directory containing one or a tar or zip archive.",
+	Args:          cobra.ExactArgs(2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		a, err := loadLink(args[0])
+		if err != nil {
+			return err
+		}
+		b, err := loadLink(args[1])
+		if err != nil {
+			return err
+		}
+		p, err := loadDriftPolicy()
+		if err != nil {
+			return err
+		}
+		diff := blockmap.Diff(a, b)
+		if diffRenames {
+			diff = blockmap.DiffRenames(a, b)
+		}
+		if p == nil {
+			return printResult(diff, func() { printDiff(diff) })
+		}
+		result := p.Evaluate(diff)
+		if err := printResult(struct {
+			*blockmap.DiffResult
+			Policy *policy.Result `json:"policy"`
+		}{diff, result}, func() {
+			printDiff(diff)
+			printPolicyResult(result)
+		}); err != nil {
+			return err
+		}
+		return policyError(result)
+	},
+}
+
+func printDiff(diff *blockmap.DiffResult) {
+	printPaths("added", diff.Added)
+	printPaths("removed", diff.Removed)
+	printPaths("modified", diff.Modified)
+	for _, rename := range diff.Renamed {
+		fmt.Println("renamed:", rename.From, "->", rename.To)
+	}
+}
+
+var deltaCmd = &cobra.Command{
+	Use:           "delta <link> <dir>",
+	Short:         "Plan the byte ranges to transfer to bring a directory up to date with a link",
+	Long:          "Plan the byte ranges to transfer to bring a directory up to date with a link. Links generated with chunking let modified files reuse the chunks already in the directory.",
+	Args:          cobra.ExactArgs(2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		b, err := loadLink(args[0])
+		if err != nil {
+			return err
+		}
+		b.SetLogger(libraryLogger())
+		plan, err := b.PlanDeltaTo(args[1])
+		if err != nil {
+			return err
+		}
+		return printResult(plan, func() {
+			for _, file := range plan.Files {
+				var transfer int64
+				for _, r := range file.Transfer {
+					transfer += r.Size
+				}
+				fmt.Printf("%s: %s (%d of %d bytes to transfer)\n", file.Action, file.Path, transfer, file.Size)
+			}
+			printPaths("delete", plan.Delete)
+			fmt.Println("transfer bytes:", plan.TransferBytes)
+			fmt.Println("reused bytes:", plan.ReuseBytes)
+		})
+	},
+}
+
+var proofCmd = &cobra.Command{
+	Use:           "proof <link> <path>",
+	Short:         "Print a merkle inclusion proof for an archived path",
+	Args:          cobra.ExactArgs(2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		b, err := loadLink(args[0])
+		if err != nil {
+			return err
+		}
+		root, err := b.MerkleRoot()
+		if err != nil {
+			return err
+		}
+		proof, err := b.Proof(args[1])
+		if err != nil {
+			return err
+		}
+		return printResult(map[string]interface{}{
+			"merkleRoot": root,
+			"proof":      proof,
+		}, func() {
+			fmt.Println("merkle root:", base64.StdEncoding.EncodeToString(root))
+			fmt.Println("path:", proof.Path)
+			fmt.Println("hash:", base64.StdEncoding.EncodeToString(proof.Hash))
+			for _, sibling := range proof.Siblings {
+				side := "right"
+				if sibling.Left {
+					side = "left"
+				}
+				fmt.Println(side+":", base64.StdEncoding.EncodeToString(sibling.Hash))
+			}
+		})
+	},
+}
+
+var verifyRemoteCmd = &cobra.Command{
+	Use:           "verify-remote <link> <url>",
+	Short:         "Verify files served over HTTP against a link",
+	Long:          "Verify files served over HTTP against a link by fetching each archived path relative to url.",
+	Args:          cobra.ExactArgs(2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		b, err := loadLink(args[0])
+		if err != nil {
+			return err
+		}
+		v, err := remote.NewVerifier(args[1])
+		if err != nil {
+			return err
+		}
+		v.SetRangeRequests(remoteRanges)
+		v.SetConcurrency(remoteWorkers)
+		verb("verifying " + args[1] + " against " + args[0])
+		report := v.Verify(context.Background(), b)
+		if err := printResult(report, func() {
+			for _, result := range report.Failed() {
+				if result.Err != "" {
+					fmt.Println(string(result.Status)+":", result.Path, "("+result.Err+")")
+				} else {
+					fmt.Println(string(result.Status)+":", result.Path)
+				}
+			}
+			if report.Valid() {
+				fmt.Println("all", len(report.Results), "files verified")
+			}
+		}); err != nil {
+			return err
+		}
+		if !report.Valid() {
+			return errors.Errorf("%d of %d files failed verification", len(report.Failed()), len(report.Results))
+		}
+		return nil
+	},
+}
+
+var pinCmd = &cobra.Command{
+	Use:           "pin <link>",
+	Short:         "Add and pin a link to an IPFS node",
+	Long:          "Add and pin a link to an IPFS node. Each argument is a link file or a directory containing one.",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		b, err := loadLink(args[0])
+		if err != nil {
+			return err
+		}
+		c, err := codec.ByName(pinFormat)
+		if err != nil {
+			return err
+		}
+		client, err := ipfs.NewClient(ipfsAPI)
+		if err != nil {
+			return err
+		}
+		verb("pinning " + args[0] + " to " + ipfsAPI)
+		cid, err := b.PinIPFS(context.Background(), client, c)
+		if err != nil {
+			return err
+		}
+		return printResult(map[string]interface{}{"cid": cid}, func() {
+			fmt.Println("cid:", cid)
+		})
+	},
+}
+
+var bagCmd = &cobra.Command{
+	Use:   "bag",
+	Short: "Create and validate BagIt bags",
+}
+
+var bagCreateCmd = &cobra.Command{
+	Use:           "create <dir> <bag>",
+	Short:         "Copy a directory into a new BagIt bag",
+	Args:          cobra.ExactArgs(2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		b := blockmap.New(args[0])
+		verb("generating blockmap for " + args[0])
+		if err := b.Generate(); err != nil {
+			return err
+		}
+		verb("writing bag " + args[1])
+		if err := bagit.Write(b, args[1]); err != nil {
+			return err
+		}
+		return printResult(map[string]interface{}{
+			"bag":      args[1],
+			"rootHash": b.RootHash,
+			"entries":  len(b.Archive),
+		}, func() {
+			fmt.Println("bag:", args[1])
+			fmt.Println("entries:", len(b.Archive))
+			fmt.Println("root hash:", base64.StdEncoding.EncodeToString(b.RootHash))
+		})
+	},
+}
+
+var bagValidateCmd = &cobra.Command{
+	Use:           "validate <bag>",
+	Short:         "Validate a BagIt bag",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		report, err := bagit.Validate(args[0])
+		if err != nil {
+			return err
+		}
+		if err := printResult(report, func() {
+			printPaths("missing", report.Missing)
+			printPaths("modified", report.Modified)
+			printPaths("unlisted", report.Unlisted)
+			if report.OxumMismatch {
+				fmt.Println("payload oxum does not match")
+			}
+			if report.Valid() {
+				fmt.Println("bag is valid")
+			}
+		}); err != nil {
+			return err
+		}
+		if !report.Valid() {
+			return errors.New("invalid bag")
+		}
+		return nil
+	},
+}
+
+var chainCmd = &cobra.Command{
+	Use:   "chain",
+	Short: "Record and verify link history in a chain",
+}
+
+var chainInitCmd = &cobra.Command{
+	Use:           "init",
+	Short:         "Create a chain with a genesis block recording its creator, root and policy",
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := blockchain.OpenBoltStore(chainPath)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		if height, err := store.Height(); err != nil {
+			return err
+		} else if height != 0 {
+			return errors.Errorf("chain %s already exists", chainPath)
+		}
+		chain, err := blockchain.OpenWithGenesis(store, genesisMeta())
+		if err != nil {
+			return err
+		}
+		genesis := chain.At(0)
+		return printResult(genesis, func() {
+			fmt.Println("hash:", base64.StdEncoding.EncodeToString(genesis.BlockHash))
+		})
+	},
+}
+
+// genesisMeta returns the genesis metadata selected by the chain flags
+func genesisMeta() blockchain.GenesisMeta {
+	return blockchain.GenesisMeta{Creator: genesisCreator, Root: genesisRoot, Policy: genesisPolicy}
+}
+
+var chainAddCmd = &cobra.Command{
+	Use:           "add <link>",
+	Short:         "Record a link's root hash in the chain",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		b, err := loadLink(args[0])
+		if err != nil {
+			return err
+		}
+		store, chain, err := openChain()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		add := chain.Add
+		if chainMerkle {
+			add = chain.AddWithMerkleRoot
+		}
+		blk, err := add(b)
+		if err != nil {
+			return err
+		}
+		return printResult(blk, func() {
+			fmt.Println("index:", blk.Index)
+			fmt.Println("hash:", base64.StdEncoding.EncodeToString(blk.BlockHash))
+			fmt.Println("root hash:", base64.StdEncoding.EncodeToString(blk.RootHash))
+		})
+	},
+}
+
+var chainNotarizeCmd = &cobra.Command{
+	Use:           "notarize <file>",
+	Short:         "Record a single file's hash in the chain",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, chain, err := openChain()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		blk, err := chain.AddFile(args[0])
+		if err != nil {
+			return err
+		}
+		return printResult(blk, func() {
+			fmt.Println("index:", blk.Index)
+			fmt.Println("hash:", base64.StdEncoding.EncodeToString(blk.BlockHash))
+		})
+	},
+}
+
+var chainCheckpointCmd = &cobra.Command{
+	Use:           "checkpoint [index]",
+	Short:         "Sign a checkpoint of the chain and optionally prune the blocks before it",
+	Long:          "Sign a checkpoint of the chain through the block at index, the chain head by default. With --prune the data of blocks before the checkpoint is dropped, keeping their headers.",
+	Args:          cobra.MaximumNArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		signer, err := readSigner(checkpointKey)
+		if err != nil {
+			return err
+		}
+		store, chain, err := openChain()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		index := chain.Length() - 1
+		if len(args) == 1 {
+			if index, err = strconv.Atoi(args[0]); err != nil {
+				return errors.Wrapf(blockchain.ErrBlockNotFound, "index %s", args[0])
+			}
+		}
+
+		cp, err := chain.NewCheckpoint(index, signer)
+		if err != nil {
+			return err
+		}
+		if checkpointPrune {
+			if err := chain.Prune(cp); err != nil {
+				return err
+			}
+		}
+		return printResult(cp, func() {
+			fmt.Println("index:", cp.Index)
+			fmt.Println("headers hash:", base64.StdEncoding.EncodeToString(cp.HeadersHash))
+			if checkpointPrune {
+				fmt.Println("pruned blocks:", cp.Index-1)
+			}
+		})
+	},
+}
+
+var chainMergeCmd = &cobra.Command{
+	Use:           "merge <chain>",
+	Short:         "Merge the writes of another replica of a multi-writer chain",
+	Long:          "Merge the chain database at <chain> into the chain. Blocks written since the replicas diverged are ordered by their writers' vector clocks, so every replica merging the same writes holds the same chain.",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, chain, err := openChain()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		otherStore, err := blockchain.OpenBoltStore(args[0])
+		if err != nil {
+			return err
+		}
+		defer otherStore.Close()
+		other, err := blockchain.Open(otherStore, block.NewSHA512Genesis())
+		if err != nil {
+			return err
+		}
+
+		merged, err := blockchain.Merge(chain, other)
+		if err != nil {
+			return err
+		}
+		added := merged.Length() - chain.Length()
+		if err := chain.Adopt(merged); err != nil {
+			return err
+		}
+		result := map[string]interface{}{"length": chain.Length(), "added": added}
+		return printResult(result, func() {
+			fmt.Println("blocks:", chain.Length())
+			fmt.Println("added:", added)
+		})
+	},
+}
+
+var chainVerifyCmd = &cobra.Command{
+	Use:           "verify",
+	Short:         "Verify the integrity of the chain",
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, chain, err := openChain()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		verifyErr := chain.At(0).VerifySHA512()
+		if chain.Length() > 1 {
+			verifyErr = chain.Validate()
+		}
+		if verifyErr == nil && (cmd.Flags().Changed("creator") || cmd.Flags().Changed("root") || cmd.Flags().Changed("policy")) {
+			verifyErr = chain.ValidateGenesis(genesisMeta())
+		}
+		if verifyErr == nil {
+			verifyErr = verifyAnchors(chain)
+		}
+		result := map[string]interface{}{"length": chain.Length(), "valid": verifyErr == nil}
+		if verifyErr != nil {
+			result["error"] = verifyErr.Error()
+		}
+		if err := printResult(result, func() {
+			fmt.Println("blocks:", chain.Length())
+			if verifyErr == nil {
+				fmt.Println("chain is valid")
+			}
+		}); err != nil {
+			return err
+		}
+		return verifyErr
+	},
+}
+
+// openChain opens the chain database at chainPath, or the SQL database
+// given by --db
+func openChain() (blockchain.Store, *blockchain.Blockchain, error) {
+	store, err := openStore(chainPath, chainDB)
+	if err != nil {
+		return nil, nil, err
+	}
+	chain, err := blockchain.Open(store, block.NewSHA512Genesis())
+	if err != nil {
+		store.Close()
+		return nil, nil, err
+	}
+	chain.SetWriter(chainWriter)
+	l, err := openAuditLog()
+	if err != nil {
+		store.Close()
+		return nil, nil, err
+	}
+	if l != nil {
+		target := chainDB
+		if target == "" {
+			target = chainPath
+		}
+		chain.SetAuditLog(l, target)
+	}
+	return store, chain, nil
+}
+
+// loadLink loads a link file, or the link file inside a directory. Tar and
+// zip archives are hashed into a blockmap of their members.
+func loadLink(path string) (*blockmap.BlockMap, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find link")
+	}
+	switch {
+	case strings.HasSuffix(path, ".zip"):
+		return blockmap.FromZip(path)
+	case strings.HasSuffix(path, ".tar"), strings.HasSuffix(path, ".tar.gz"), strings.HasSuffix(path, ".tgz"):
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to open archive")
+		}
+		defer f.Close()
+		return blockmap.FromTar(f)
+	}
+	b := blockmap.New(path)
+	if info.IsDir() {
+		return b, b.Load(path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read link")
+	}
+	defer f.Close()
+	if _, err := b.ReadFrom(f); err != nil {
+		return nil, errors.Wrap(err, "failed to decode link")
+	}
+	return b, nil
+}
+
+// printResult writes v as JSON when JSON output is selected, otherwise calls human
+func printResult(v interface{}, human func()) error {
+	switch outputFormat {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	case "text", "":
+		human()
+		return nil
+	default:
+		return errors.Errorf("unknown output format %q", outputFormat)
+	}
+}
+
+func printPaths(label string, paths []string) {
+	for _, path := range paths {
+		fmt.Println(label+":", path)
+	}
+}
+
+// parseByteSize parses a byte count with an optional K, M or G binary suffix
+func parseByteSize(s string) (int64, error) {
+	multiplier := int64(1)
+	switch suffix := strings.ToUpper(s[len(s)-1:]); suffix {
+	case "K":
+		multiplier = 1 << 10
+	case "M":
+		multiplier = 1 << 20
+	case "G":
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, errors.Errorf("invalid byte size %q", s)
+	}
+	return n * multiplier, nil
+}
+
+// throttle applies the --rate-limit, --max-open-files, --mmap-threshold and
+// --readahead flags to b
+func throttle(b *blockmap.BlockMap) error {
+	if rateLimit != "" {
+		rate, err := parseByteSize(rateLimit)
+		if err != nil {
+			return err
+		}
+		b.SetRateLimit(rate)
+	}
+	b.SetMaxOpenFiles(maxOpenFiles)
+	b.SetReadahead(readahead)
+	if mmapThreshold != "" {
+		n, err := parseByteSize(mmapThreshold)
+		if err != nil {
+			return err
+		}
+		b.SetMmapThreshold(n)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package cmd
+
+import (
+	"crypto/tls"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/govice/golinks/auth"
+	"github.com/govice/golinks/events"
+	"github.com/pkg/errors"
+)
+
+var (
+	eventsAddress string
+	eventsOrigins []string
+)
+
+// serveEvents serves a new broker's events on /events at the --events-listen
+// address in the background, as Server-Sent Events or over WebSocket. It
+// returns nil when no address is set.
+func serveEvents(policy *auth.Policy, config *tls.Config) (*events.Broker, error) {
+	if eventsAddress == "" {
+		return nil, nil
+	}
+	b := events.NewBroker(events.DefaultHistory)
+	b.SetPolicy(policy)
+	b.SetAllowedOrigins(eventsOrigins...)
+
+	listener, err := net.Listen("tcp", eventsAddress)
+	if err != nil {
+		return nil, errors.Wrap(err, "events: failed to listen")
+	}
+	if config != nil {
+		listener = tls.NewListener(listener, config)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/events", b)
+	verb("serving events on " + listener.Addr().String())
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			log.Println("events:", err)
+		}
+	}()
+	return b, nil
+}
@@ -0,0 +1,70 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package cmd
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/govice/golinks/keys"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Inspect signing and decryption keys",
+	Long:  "Inspect the keys commands sign and decrypt with. Keys are PEM files or references to a provider: keychain://service/account, awskms://[endpoint]/key or gcpkms://<key version resource name>.",
+}
+
+var keysPublicCmd = &cobra.Command{
+	Use:           "public <key>",
+	Short:         "Print the PKIX PEM public key of a key",
+	Long:          "Print the PKIX PEM public key of a key, to verify its signatures with --pub.",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := context.Background()
+		signer, err := keys.OpenSigner(ctx, args[0])
+		if err == nil {
+			return printPublicKey(signer.Public())
+		}
+		//Keys only for decryption, such as KMS decryption keys, aren't signers
+		if errors.Cause(err) != keys.ErrUnsupported {
+			return err
+		}
+		decrypter, err := keys.OpenDecrypter(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		return printPublicKey(decrypter.Public())
+	},
+}
+
+func printPublicKey(public interface{}) error {
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode public key")
+	}
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	return printResult(map[string]string{"publicKey": string(pemKey)}, func() {
+		fmt.Print(string(pemKey))
+	})
+}
@@ -0,0 +1,167 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/govice/golinks/blockmap"
+	"github.com/govice/golinks/fs"
+	"github.com/govice/golinks/light"
+	"github.com/govice/golinks/server"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+var (
+	lightHeaders   string
+	lightServer    string
+	lightFile      string
+	lightNamespace string
+	lightCA        string
+	lightTLSCert   string
+	lightTLSKey    string
+)
+
+var lightCmd = &cobra.Command{
+	Use:   "light",
+	Short: "Follow a chain holding only block headers",
+}
+
+var lightSyncCmd = &cobra.Command{
+	Use:           "sync",
+	Short:         "Verify and store the headers of new blocks from a golinks server",
+	Long:          "Verify and store the headers of new blocks from a golinks server. The first sync trusts the server's genesis block.",
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		creds := server.Credentials{Namespace: lightNamespace, Token: os.Getenv("GOLINKS_TOKEN"), Insecure: true}
+		transport := grpc.WithInsecure()
+		if lightCA != "" || lightTLSCert != "" {
+			config, err := clientTLS(lightCA, lightTLSCert, lightTLSKey)
+			if err != nil {
+				return err
+			}
+			creds.Insecure = false
+			transport = grpc.WithTransportCredentials(credentials.NewTLS(config))
+		}
+		conn, err := grpc.Dial(lightServer, transport, grpc.WithPerRPCCredentials(creds))
+		if err != nil {
+			return errors.Wrap(err, "failed to connect to server")
+		}
+		defer conn.Close()
+		source := server.NewBlockSource(context.Background(), server.NewGolinksClient(conn))
+
+		client, err := readHeaders()
+		if os.IsNotExist(errors.Cause(err)) {
+			verb("no headers stored, trusting the server's genesis block")
+			genesis, fetchErr := source.BlockAt(0)
+			if fetchErr != nil {
+				return fetchErr
+			}
+			client, err = light.New(genesis)
+		}
+		if err != nil {
+			return err
+		}
+		synced, syncErr := client.Sync(source)
+		if err := writeHeaders(client); err != nil {
+			return err
+		}
+		if syncErr != nil {
+			return syncErr
+		}
+		head := client.Head()
+		return printResult(map[string]interface{}{"synced": synced, "head": head}, func() {
+			fmt.Println("synced blocks:", synced)
+			fmt.Println("head:", head.Index)
+		})
+	},
+}
+
+var lightVerifyCmd = &cobra.Command{
+	Use:           "verify <index> <proof>",
+	Short:         "Verify a file proof against a stored block header",
+	Long:          "Verify a file proof, as written by golinks proof -o json, against the merkle root recorded by the block at index.",
+	Args:          cobra.ExactArgs(2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var index int
+		if _, err := fmt.Sscan(args[0], &index); err != nil {
+			return errors.Wrap(err, "invalid block index")
+		}
+		client, err := readHeaders()
+		if err != nil {
+			return err
+		}
+		data, err := ioutil.ReadFile(args[1])
+		if err != nil {
+			return errors.Wrap(err, "failed to read proof")
+		}
+		var proofFile struct {
+			Proof *blockmap.MerkleProof `json:"proof"`
+		}
+		if err := json.Unmarshal(data, &proofFile); err != nil || proofFile.Proof == nil {
+			return errors.New("failed to decode proof")
+		}
+		proof := proofFile.Proof
+
+		hash := proof.Hash
+		if lightFile != "" {
+			if hash, err = fs.HashFile(lightFile); err != nil {
+				return err
+			}
+			if !bytes.Equal(hash, proof.Hash) {
+				return errors.Errorf("%s does not match the proven hash of %s", lightFile, proof.Path)
+			}
+		}
+		if err := client.VerifyFile(index, proof.Path, hash, proof); err != nil {
+			return err
+		}
+		return printResult(map[string]interface{}{"path": proof.Path, "valid": true}, func() {
+			fmt.Println(proof.Path, "is recorded by block", index)
+		})
+	},
+}
+
+// readHeaders loads the light client headers at lightHeaders
+func readHeaders() (*light.Client, error) {
+	f, err := os.Open(lightHeaders)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open headers")
+	}
+	defer f.Close()
+	return light.Read(f)
+}
+
+// writeHeaders saves the light client headers to lightHeaders
+func writeHeaders(client *light.Client) error {
+	var buf bytes.Buffer
+	if _, err := client.WriteTo(&buf); err != nil {
+		return err
+	}
+	return errors.Wrap(ioutil.WriteFile(lightHeaders, buf.Bytes(), 0644), "failed to save headers")
+}
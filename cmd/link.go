@@ -24,6 +24,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/govice/golinks/blockmap"
+	"github.com/govice/golinks/codec"
 	"github.com/pierrre/archivefile/zip"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
@@ -31,7 +32,10 @@ import (
 	"github.com/urfave/cli"
 )
 
-var zipArchive bool
+var (
+	zipArchive bool
+	linkFormat string
+)
 
 var linkCmd = &cobra.Command{
 	Use:   "link",
@@ -84,7 +88,11 @@ func link(path string, cmd *cobra.Command) error {
 	if err != nil {
 		return err
 	}
-	if err := blkmap.SaveNamed(tmpLinkPath, uuid.String()); err != nil {
+	linkCodec, err := codec.ByName(linkFormat)
+	if err != nil {
+		return err
+	}
+	if err := blkmap.SaveCodec(tmpLinkPath, uuid.String(), linkCodec); err != nil {
 		return err
 	}
 	return nil
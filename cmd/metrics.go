@@ -0,0 +1,56 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+package cmd
+
+import (
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/govice/golinks/metrics"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var metricsAddress string
+
+// serveMetrics serves a new collector's metrics on /metrics at the --metrics-listen
+// address in the background. It returns nil when no address is set.
+func serveMetrics() (*metrics.Collector, error) {
+	if metricsAddress == "" {
+		return nil, nil
+	}
+	c := metrics.New()
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(c); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", metricsAddress)
+	if err != nil {
+		return nil, errors.Wrap(err, "metrics: failed to listen")
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	verb("serving metrics on " + listener.Addr().String())
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			log.Println("metrics:", err)
+		}
+	}()
+	return c, nil
+}
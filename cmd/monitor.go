@@ -0,0 +1,159 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"net/smtp"
+	"net/url"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/govice/golinks/monitor"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	monitorInterval time.Duration
+	monitorWebhooks []string
+	monitorSlack    string
+	monitorSMTP     string
+	monitorMailFrom string
+	monitorMailTo   []string
+	monitorSMTPUser string
+	monitorSyslog   string
+	monitorSyslogFm string
+)
+
+// monitorNotifiers returns the notifiers selected by the monitor flags. The
+// webhook secret and SMTP password are read from the environment so they
+// don't appear in process listings.
+func monitorNotifiers() ([]monitor.Notifier, error) {
+	var notifiers []monitor.Notifier
+	for _, url := range monitorWebhooks {
+		webhook := &monitor.Webhook{URL: url}
+		if secret := os.Getenv("GOLINKS_WEBHOOK_SECRET"); secret != "" {
+			webhook.Secret = []byte(secret)
+		}
+		notifiers = append(notifiers, webhook)
+	}
+	if monitorSlack != "" {
+		notifiers = append(notifiers, &monitor.Slack{WebhookURL: monitorSlack})
+	}
+	if monitorSMTP != "" {
+		email := &monitor.Email{Addr: monitorSMTP, From: monitorMailFrom, To: monitorMailTo}
+		if monitorSMTPUser != "" {
+			host, _, _ := net.SplitHostPort(monitorSMTP)
+			email.Auth = smtp.PlainAuth("", monitorSMTPUser, os.Getenv("GOLINKS_SMTP_PASSWORD"), host)
+		}
+		notifiers = append(notifiers, email)
+	}
+	if monitorSyslog != "" {
+		s, err := syslogNotifier(monitorSyslog, monitor.SyslogFormat(monitorSyslogFm))
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, s)
+	}
+	return notifiers, nil
+}
+
+// syslogNotifier returns a notifier sending alerts to the syslog server at
+// a udp://, tcp:// or tls:// URL
+func syslogNotifier(rawurl string, format monitor.SyslogFormat) (*monitor.Syslog, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid syslog URL")
+	}
+	s := &monitor.Syslog{Network: u.Scheme, Addr: u.Host, Format: format}
+	switch u.Scheme {
+	case "udp", "tcp":
+	case "tls":
+		s.Network, s.TLSConfig = "tcp", &tls.Config{MinVersion: tls.VersionTLS12}
+	default:
+		return nil, errors.New("syslog URLs must be udp://, tcp:// or tls://")
+	}
+	if u.Port() == "" {
+		port := "514"
+		if u.Scheme == "tls" {
+			port = "6514"
+		}
+		s.Addr = net.JoinHostPort(u.Hostname(), port)
+	}
+	switch format {
+	case monitor.SyslogText, monitor.SyslogCEF, monitor.SyslogLEEF:
+	default:
+		return nil, errors.Wrap(monitor.ErrSyslogFormat, string(format))
+	}
+	return s, nil
+}
+
+var monitorCmd = &cobra.Command{
+	Use:           "monitor <dir>",
+	Short:         "Verify a directory periodically and alert on drift",
+	Long:          "Verify a directory against its saved link every interval until interrupted. A baseline is generated when the directory has no link. Drift is printed as JSON and sent to every configured notifier. Webhooks are signed with $GOLINKS_WEBHOOK_SECRET when set and SMTP authentication uses $GOLINKS_SMTP_PASSWORD.",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts := []monitor.Option{
+			monitor.WithLogger(libraryLogger()),
+			monitor.WithCallback(func(alert monitor.Alert) {
+				json.NewEncoder(os.Stdout).Encode(alert)
+			}),
+		}
+		p, err := loadDriftPolicy()
+		if err != nil {
+			return err
+		}
+		if p != nil {
+			opts = append(opts, monitor.WithPolicy(p))
+		}
+		notifiers, err := monitorNotifiers()
+		if err != nil {
+			return err
+		}
+		for _, n := range notifiers {
+			opts = append(opts, monitor.WithNotifier(n))
+		}
+		c, err := serveMetrics()
+		if err != nil {
+			return err
+		}
+		if c != nil {
+			opts = append(opts, monitor.WithMetrics(c))
+		}
+		b, err := serveEvents(nil, nil)
+		if err != nil {
+			return err
+		}
+		if b != nil {
+			opts = append(opts, monitor.WithEvents(b))
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		if err := monitor.New(args[0], monitorInterval, opts...).Run(ctx); err != context.Canceled {
+			return err
+		}
+		return nil
+	},
+}
@@ -0,0 +1,100 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package cmd
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/govice/golinks/auth"
+	"github.com/govice/golinks/block"
+	"github.com/govice/golinks/blockchain"
+	"github.com/govice/golinks/server"
+	"github.com/pkg/errors"
+)
+
+// namespaceConfig describes a server namespace in the file given to
+// serve --namespaces. Tokens are given as SHA256 hex digests so the file
+// holds no secrets. TokenSHA256 grants the write role; Auth grants others.
+type namespaceConfig struct {
+	Name        string       `json:"name"`
+	TokenSHA256 string       `json:"tokenSHA256,omitempty"`
+	Chain       string       `json:"chain,omitempty"`
+	DB          string       `json:"db,omitempty"`
+	Roots       []string     `json:"roots,omitempty"`
+	Quota       server.Quota `json:"quota,omitempty"`
+	Auth        *auth.Config `json:"auth,omitempty"`
+}
+
+// addNamespaces hosts the namespaces configured in the JSON file at path on
+// golinks, returning the namespaces' chain stores
+func addNamespaces(golinks *server.Server, path string) ([]blockchain.Store, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read namespaces")
+	}
+	var configs []namespaceConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, errors.Wrap(err, "failed to decode namespaces")
+	}
+
+	var stores []blockchain.Store
+	for _, config := range configs {
+		if config.Name == "" || (config.Chain == "" && config.DB == "") {
+			return stores, errors.New("namespaces need a name and a chain or db")
+		}
+		store, err := openStore(config.Chain, config.DB)
+		if err != nil {
+			return stores, errors.Wrap(err, "namespace "+config.Name)
+		}
+		stores = append(stores, store)
+		chain, err := blockchain.Open(store, block.NewSHA512Genesis())
+		if err != nil {
+			return stores, errors.Wrap(err, "namespace "+config.Name)
+		}
+
+		l, err := openAuditLog()
+		if err != nil {
+			return stores, err
+		}
+		if l != nil {
+			chain.SetAuditLog(l, config.Name)
+		}
+
+		ns := server.NewNamespace(config.Name, chain)
+		if config.Auth != nil {
+			policy, err := config.Auth.Policy()
+			if err != nil {
+				return stores, errors.Wrap(err, "namespace "+config.Name)
+			}
+			ns.SetPolicy(policy)
+		}
+		if config.TokenSHA256 != "" {
+			hash, err := hex.DecodeString(config.TokenSHA256)
+			if err != nil {
+				return stores, errors.Wrap(err, "namespace "+config.Name+" has an invalid token digest")
+			}
+			ns.SetTokenHash(hash)
+		}
+		ns.SetRoots(config.Roots...)
+		ns.SetQuota(config.Quota)
+		golinks.AddNamespace(ns)
+		verb("hosting namespace " + config.Name)
+	}
+	return stores, nil
+}
@@ -0,0 +1,187 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/govice/golinks/blockmap"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/openpgp"
+)
+
+var (
+	pgpKey       string
+	pgpKeyring   string
+	pgpSignature string
+)
+
+// readKeyring reads an ASCII-armored OpenPGP keyring
+func readKeyring(path string) (openpgp.EntityList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open keyring")
+	}
+	defer f.Close()
+	keyring, err := openpgp.ReadArmoredKeyRing(f)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read keyring")
+	}
+	return keyring, nil
+}
+
+// readPGPSigner reads an ASCII-armored OpenPGP secret key, decrypting it with
+// $GOLINKS_PGP_PASSPHRASE when it is protected
+func readPGPSigner(path string) (*openpgp.Entity, error) {
+	if path == "" {
+		return nil, errors.New("no signing key given, use --key")
+	}
+	keyring, err := readKeyring(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, entity := range keyring {
+		if entity.PrivateKey == nil {
+			continue
+		}
+		if entity.PrivateKey.Encrypted {
+			passphrase := []byte(os.Getenv("GOLINKS_PGP_PASSPHRASE"))
+			if len(passphrase) == 0 {
+				return nil, errors.New("signing key is encrypted, set $GOLINKS_PGP_PASSPHRASE")
+			}
+			if err := entity.PrivateKey.Decrypt(passphrase); err != nil {
+				return nil, errors.Wrap(err, "failed to decrypt signing key")
+			}
+			for _, subkey := range entity.Subkeys {
+				if subkey.PrivateKey != nil && subkey.PrivateKey.Encrypted {
+					if err := subkey.PrivateKey.Decrypt(passphrase); err != nil {
+						return nil, errors.Wrap(err, "failed to decrypt signing subkey")
+					}
+				}
+			}
+		}
+		return entity, nil
+	}
+	return nil, errors.New("no secret key found in " + path)
+}
+
+// pgpSignaturePath returns the --signature path or the signature saved in dir
+func pgpSignaturePath(dir string) string {
+	if pgpSignature != "" {
+		return pgpSignature
+	}
+	return filepath.Join(dir, blockmap.SignatureName)
+}
+
+var pgpCmd = &cobra.Command{
+	Use:   "pgp",
+	Short: "Sign and verify links with detached OpenPGP signatures",
+}
+
+var pgpSignCmd = &cobra.Command{
+	Use:           "sign <dir>",
+	Short:         "Sign a directory's link with a detached OpenPGP signature",
+	Long:          "Sign the canonical archive of a directory's link with an ASCII-armored OpenPGP secret key, saving the detached signature as " + blockmap.SignatureName + " in the directory or at --signature. Protected keys are decrypted with $GOLINKS_PGP_PASSPHRASE.",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		signer, err := readPGPSigner(pgpKey)
+		if err != nil {
+			return err
+		}
+		b := blockmap.New(args[0])
+		if err := b.Load(args[0]); err != nil {
+			return err
+		}
+		var signature bytes.Buffer
+		if err := b.SignPGP(&signature, signer); err != nil {
+			return err
+		}
+		path := pgpSignaturePath(args[0])
+		if err := ioutil.WriteFile(path, signature.Bytes(), 0644); err != nil {
+			return errors.Wrap(err, "failed to save signature")
+		}
+		keyID := signer.PrimaryKey.KeyIdString()
+		return printResult(map[string]interface{}{"signature": path, "keyID": keyID}, func() {
+			fmt.Println("signature:", path)
+			fmt.Println("key id:", keyID)
+		})
+	},
+}
+
+var pgpVerifyCmd = &cobra.Command{
+	Use:           "verify <dir>",
+	Short:         "Verify the detached OpenPGP signature of a directory's link",
+	Long:          "Verify the detached OpenPGP signature of a directory's link against an ASCII-armored public keyring. The link isn't compared to the directory, use verify for that.",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if pgpKeyring == "" {
+			return errors.New("no keyring given, use --keyring")
+		}
+		keyring, err := readKeyring(pgpKeyring)
+		if err != nil {
+			return err
+		}
+		b := blockmap.New(args[0])
+		if err := b.Load(args[0]); err != nil {
+			return err
+		}
+		signature, err := os.Open(pgpSignaturePath(args[0]))
+		if err != nil {
+			return errors.Wrap(err, "failed to open signature")
+		}
+		defer signature.Close()
+		signer, err := b.VerifyPGP(signature, keyring)
+		if err != nil {
+			return err
+		}
+		var identities []string
+		for name := range signer.Identities {
+			identities = append(identities, name)
+		}
+		keyID := signer.PrimaryKey.KeyIdString()
+		return printResult(map[string]interface{}{"keyID": keyID, "identities": identities}, func() {
+			fmt.Println("key id:", keyID)
+			printPaths("identity", identities)
+			fmt.Println("signature is valid")
+		})
+	},
+}
+
+var pgpCanonicalCmd = &cobra.Command{
+	Use:           "canonical <dir>",
+	Short:         "Write the canonical archive of a directory's link, the bytes OpenPGP signatures cover",
+	Long:          "Write the canonical archive of a directory's link to stdout, so signatures can be checked with gpg: golinks pgp canonical <dir> | gpg --verify <dir>/" + blockmap.SignatureName + " -",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		b := blockmap.New(args[0])
+		if err := b.Load(args[0]); err != nil {
+			return err
+		}
+		return b.WriteCanonical(os.Stdout)
+	},
+}
@@ -0,0 +1,51 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/govice/golinks/policy"
+	"github.com/pkg/errors"
+)
+
+var policyPath string
+
+// loadDriftPolicy loads the policy selected by --policy, or nil without one
+func loadDriftPolicy() (*policy.Policy, error) {
+	if policyPath == "" {
+		return nil, nil
+	}
+	verb("judging drift with " + policyPath)
+	return policy.Load(policyPath)
+}
+
+// printPolicyResult prints the verdict on each changed path and the outcome
+func printPolicyResult(result *policy.Result) {
+	for _, f := range result.Findings {
+		fmt.Printf("%s: %s %s (%s)\n", f.Outcome, f.Change, f.Path, f.Reason)
+	}
+	fmt.Println("policy:", result.Outcome)
+}
+
+// policyError fails commands whose drift the policy rejected
+func policyError(result *policy.Result) error {
+	if result.Outcome == policy.Fail {
+		return errors.Errorf("policy failed on %d changes", len(result.Failures()))
+	}
+	return nil
+}
@@ -21,7 +21,15 @@ import (
 	"log"
 	"os"
 	"os/user"
-
+	"time"
+
+	"github.com/govice/golinks/anchor"
+	"github.com/govice/golinks/audit"
+	"github.com/govice/golinks/blockmap"
+	"github.com/govice/golinks/ipfs"
+	"github.com/govice/golinks/logging"
+	"github.com/govice/golinks/sigstore"
+	"github.com/govice/golinks/tlog"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -70,11 +78,226 @@ func init() {
 	rootCmd.AddCommand(statusCmd)
 
 	linkCmd.Flags().BoolVarP(&zipArchive, "zip", "z", false, "zip archive after linking")
+	linkCmd.Flags().StringVarP(&linkFormat, "format", "f", "json", "link file format [json, gob, cbor, msgpack]")
 	rootCmd.AddCommand(linkCmd)
 
 	rootCmd.AddCommand(validateCmd)
 
+	serveCmd.Flags().StringVarP(&serveAddress, "listen", "l", "localhost:7070", "address to serve the gRPC API on")
+	serveCmd.Flags().StringVarP(&serveChainPath, "chain", "c", "golinks.chain", "path to the chain database")
+	serveCmd.Flags().StringVarP(&serveP2P, "p2p-listen", "", "", "address to serve the chain to peers on")
+	serveCmd.Flags().StringSliceVarP(&servePeers, "peer", "", nil, "address of a peer to sync the chain from")
+	serveCmd.Flags().StringVarP(&serveWriter, "writer", "", "", "writer ID stamped on appended blocks, merging diverged peer chains")
+	serveCmd.Flags().IntVarP(&serveCacheSize, "cache-size", "", 0, "number of proof and diff replies cached in memory, 0 disables the cache")
+	serveCmd.Flags().StringVarP(&serveRedis, "redis", "", "", "cache replies in Redis instead, as redis://[:password@]host:port[/db]")
+	serveCmd.Flags().DurationVarP(&serveCacheTTL, "cache-ttl", "", time.Hour, "expiry of replies cached in Redis")
+	serveCmd.Flags().StringVarP(&serveNamespaces, "namespaces", "", "", "JSON file of namespaces hosted with their own chains, tokens, roots and quotas")
+	serveCmd.Flags().StringVarP(&serveAuth, "auth", "", "", "JSON file of the tokens and certificate subjects allowed to read, verify or write")
+	serveCmd.Flags().StringVarP(&serveTLSCert, "tls-cert", "", "", "PEM certificate to serve the gRPC API over TLS with")
+	serveCmd.Flags().StringVarP(&serveTLSKey, "tls-key", "", "", "PEM private key of --tls-cert")
+	serveCmd.Flags().StringVarP(&serveClientCA, "client-ca", "", "", "PEM CA certificates verifying client certificates for --auth subjects")
+	serveCmd.Flags().DurationVarP(&serveSyncEvery, "sync-interval", "", time.Minute, "interval between peer syncs")
+	serveCmd.Flags().StringVarP(&servePeerCert, "peer-cert", "", "", "PEM certificate authenticating the node to peers over TLS")
+	serveCmd.Flags().StringVarP(&servePeerKey, "peer-key", "", "", "PEM private key of --peer-cert")
+	serveCmd.Flags().StringVarP(&servePeerCA, "peer-ca", "", "", "PEM CA certificates peers must present certificates from")
+	serveCmd.Flags().StringSliceVarP(&servePeerSigner, "peer-signer", "", nil, "PKIX PEM public key whose signatures blocks adopted from peers need")
+	serveCmd.Flags().IntVarP(&servePeerQuorum, "peer-quorum", "", 1, "number of --peer-signer keys that must sign each adopted block")
+	rootCmd.AddCommand(serveCmd)
+	for _, c := range []*cobra.Command{serveCmd, monitorCmd} {
+		c.Flags().StringVarP(&metricsAddress, "metrics-listen", "", "", "address to serve Prometheus metrics on")
+		c.Flags().StringVarP(&eventsAddress, "events-listen", "", "", "address to stream verification and drift events on, at /events")
+		c.Flags().StringSliceVarP(&eventsOrigins, "events-origin", "", nil, "origin of web pages allowed to subscribe to events over WebSocket, besides the events address")
+	}
+
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "enable verbose output")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", "text", "output format [text, json]")
+	rootCmd.PersistentFlags().StringVarP(&auditLogPath, "audit-log", "", "", "append-only log recording link saves and chain mutations")
+	auditCmd.PersistentFlags().StringVarP(&auditActor, "actor", "", "", "only entries by this actor")
+	auditCmd.PersistentFlags().StringVarP(&auditOp, "op", "", "", "only entries of this operation [save, append, adopt, prune]")
+	auditCmd.PersistentFlags().StringVarP(&auditTarget, "target", "", "", "only entries for this link file or chain")
+	auditCmd.PersistentFlags().DurationVarP(&auditSince, "since", "", 0, "only entries newer than this duration")
+	auditCmd.PersistentFlags().IntVarP(&auditLimit, "limit", "", 0, "only the last this many entries")
+	auditExportCmd.Flags().StringVarP(&auditFormat, "format", "f", audit.FormatJSON, "export format [json, jsonl, csv]")
+	auditCmd.AddCommand(auditListCmd)
+	auditCmd.AddCommand(auditExportCmd)
+	auditCmd.AddCommand(auditVerifyCmd)
+	rootCmd.AddCommand(auditCmd)
+
+	generateCmd.Flags().BoolVarP(&generateSave, "save", "s", false, "save the link file to the directory")
+	generateCmd.Flags().IntVarP(&generateBackups, "backups", "", 0, "keep this many previous link files when saving")
+	generateCmd.Flags().StringVarP(&generateFormat, "format", "f", "json", "link file format [json, gob, cbor, msgpack]")
+	generateCmd.Flags().StringVarP(&generateHashMode, "hash-mode", "", "", "root hash mode [flat, tree]")
+	generateCmd.Flags().StringSliceVarP(&generateIgnore, "ignore", "i", nil, "gitignore style patterns to ignore")
+	generateCmd.Flags().StringVarP(&generateCIDs, "cids", "", "", "record IPFS CIDs of each file [v0, v1]")
+	generateCmd.Flags().StringVarP(&generateHash, "hash", "", "sha512", "file hash algorithm [sha256, sha384, sha512, blake3]")
+	generateCmd.Flags().BoolVarP(&generateSameDevice, "one-file-system", "x", false, "skip directories on other filesystems than the root")
+	generateCmd.Flags().BoolVarP(&generateHardlinks, "hardlinks", "", false, "record which files are hard links to the same file")
+	generateCmd.Flags().BoolVarP(&generateDirs, "dirs", "", false, "record directories, including empty ones, in the archive")
+	generateCmd.Flags().StringVarP(&generateChunking, "chunking", "", "", "record chunk hashes of large files for delta transfers [fixed, cdc]")
+	generateCmd.Flags().Float64VarP(&generateBloom, "bloom", "", 0, "embed a bloom filter of the file hashes with this false positive rate, such as 0.01")
+	generateCmd.Flags().BoolVarP(&generateMultihash, "multihash", "", false, "archive file hashes as multihashes naming their algorithm")
+	generateCmd.Flags().StringVarP(&generateArchiveDB, "archive-db", "", "", "hold the archive in a database at this path rather than in memory, for very large trees")
+	generateCmd.Flags().BoolVarP(&generateFollow, "follow-symlinks", "L", false, "archive the targets of symbolic links")
+	generateCmd.Flags().StringVarP(&generateNormalize, "normalize", "", "", "normalize archive keys [nfc, nfd, nfkc, nfkd, none] (default nfc)")
+	generateCmd.Flags().Lookup("normalize").NoOptDefVal = string(blockmap.NFC)
+	generateCmd.Flags().BoolVarP(&generateDryRun, "dry-run", "n", false, "list the files that would be hashed without hashing them")
+	generateCmd.Flags().BoolVarP(&noCache, "no-cache", "", false, "hash every file rather than reusing cached hashes")
+	generateCmd.Flags().StringVarP(&cacheFile, "cache-file", "", "", "hash cache path (default $HOME/.golinks/hashcache.json)")
+	generateCmd.Flags().IntVarP(&generateWorkers, "concurrency", "j", 0, "number of files hashed at once (default number of CPUs)")
+	rootCmd.AddCommand(generateCmd)
+	for _, c := range []*cobra.Command{generateCmd, verifyCmd} {
+		c.Flags().StringVarP(&rateLimit, "rate-limit", "", "", "maximum bytes read per second, with an optional K, M or G suffix")
+		c.Flags().IntVarP(&maxOpenFiles, "max-open-files", "", 0, "maximum number of files open at once")
+		c.Flags().IntVarP(&readahead, "readahead", "", 0, "hint this many files to the kernel ahead of hashing them, on Linux")
+		c.Flags().StringVarP(&mmapThreshold, "mmap-threshold", "", "", "memory map files of at least this size rather than reading them, with an optional K, M or G suffix")
+	}
+	verifyCmd.Flags().StringVarP(&verifyManifest, "manifest", "m", "", "verify against a checksum, BagIt or hashdeep manifest")
+	verifyCmd.Flags().StringSliceVarP(&verifyFiles, "file", "", nil, "verify only these paths relative to the directory")
+	rootCmd.AddCommand(verifyCmd)
+	ciCmd.Flags().StringVarP(&ciJUnit, "junit", "", "", "write a JUnit XML report to this path")
+	ciCmd.Flags().StringVarP(&ciSARIF, "sarif", "", "", "write a SARIF report to this path")
+	ciCmd.Flags().BoolVarP(&ciStrict, "strict", "", false, "exit with a distinct code when the policy warns")
+	rootCmd.AddCommand(ciCmd)
+	for _, c := range []*cobra.Command{diffCmd, verifyCmd, monitorCmd, ciCmd} {
+		c.Flags().StringVarP(&policyPath, "policy", "", "", "JSON policy of allowed changes and path rules, failing only on drift it rejects")
+	}
+	diffCmd.Flags().BoolVarP(&diffRenames, "renames", "r", false, "report moved files as renames")
+	rootCmd.AddCommand(diffCmd)
+	rootCmd.AddCommand(deltaCmd)
+	rootCmd.AddCommand(proofCmd)
+	verifyRemoteCmd.Flags().BoolVarP(&remoteRanges, "ranges", "", false, "verify chunked files with range requests")
+	verifyRemoteCmd.Flags().IntVarP(&remoteWorkers, "concurrency", "j", 4, "number of files fetched at once")
+	rootCmd.AddCommand(verifyRemoteCmd)
+	pinCmd.Flags().StringVarP(&ipfsAPI, "api", "", ipfs.DefaultAPI, "IPFS node HTTP API address")
+	pinCmd.Flags().StringVarP(&pinFormat, "format", "f", "json", "format the link is pinned in [json, gob, cbor, msgpack]")
+	rootCmd.AddCommand(pinCmd)
+	publishCmd.Flags().StringVarP(&tlogAddress, "log", "", tlog.DefaultLog, "transparency log address")
+	publishCmd.Flags().StringVarP(&tlogKey, "key", "", "", "private key the root hash is signed with, a PEM file or a keychain://, awskms:// or gcpkms:// key")
+	rootCmd.AddCommand(publishCmd)
+	sigstoreCmd.PersistentFlags().StringVarP(&sigstoreFulcio, "fulcio", "", sigstore.DefaultFulcio, "Fulcio certificate authority address")
+	sigstoreSignCmd.Flags().StringVarP(&sigstoreRekor, "rekor", "", tlog.DefaultLog, "Rekor transparency log address")
+	sigstoreSignCmd.Flags().StringVarP(&sigstoreToken, "identity-token", "", "", "OIDC identity token exchanged for the signing certificate")
+	sigstoreVerifyCmd.Flags().StringVarP(&sigstoreIdentity, "identity", "", "", "email or URI the signing certificate must be issued to")
+	sigstoreVerifyCmd.Flags().StringVarP(&sigstoreIssuer, "issuer", "", "", "OIDC issuer that must have asserted the identity")
+	sigstoreVerifyCmd.Flags().StringVarP(&sigstoreRoots, "fulcio-roots", "", "", "PEM certificates trusted instead of fetching Fulcio's trust bundle")
+	sigstoreVerifyCmd.Flags().StringVarP(&sigstoreRekorKey, "rekor-key", "", "", "PKIX PEM public key of Rekor checking the signed entry timestamp (required)")
+	if err := sigstoreVerifyCmd.MarkFlagRequired("rekor-key"); err != nil {
+		panic(err)
+	}
+	sigstoreCmd.AddCommand(sigstoreSignCmd)
+	sigstoreCmd.AddCommand(sigstoreVerifyCmd)
+	rootCmd.AddCommand(sigstoreCmd)
+	pgpSignCmd.Flags().StringVarP(&pgpKey, "key", "", "", "ASCII-armored OpenPGP secret key the link is signed with")
+	pgpSignCmd.Flags().StringVarP(&pgpSignature, "signature", "", "", "path the signature is saved to (default <dir>/"+blockmap.SignatureName+")")
+	pgpVerifyCmd.Flags().StringVarP(&pgpKeyring, "keyring", "", "", "ASCII-armored OpenPGP public keys trusted to sign the link")
+	pgpVerifyCmd.Flags().StringVarP(&pgpSignature, "signature", "", "", "path of the signature (default <dir>/"+blockmap.SignatureName+")")
+	pgpCmd.AddCommand(pgpSignCmd)
+	pgpCmd.AddCommand(pgpVerifyCmd)
+	pgpCmd.AddCommand(pgpCanonicalCmd)
+	rootCmd.AddCommand(pgpCmd)
+	ageKeygenCmd.Flags().StringVarP(&ageKeyOut, "out", "", "", "file the identity is saved to")
+	ageEncryptCmd.Flags().StringArrayVarP(&ageRecipients, "recipient", "r", nil, "age1... or SSH public key the link is encrypted to")
+	ageEncryptCmd.Flags().StringArrayVarP(&ageRecipientFiles, "recipients-file", "R", nil, "file of recipients, one per line")
+	ageDecryptCmd.Flags().StringArrayVarP(&ageIdentityFiles, "identity", "i", nil, "age identity file, SSH private key or keychain://, awskms:// or gcpkms:// RSA key")
+	ageCmd.AddCommand(ageKeygenCmd)
+	ageCmd.AddCommand(ageEncryptCmd)
+	ageCmd.AddCommand(ageDecryptCmd)
+	rootCmd.AddCommand(ageCmd)
+	keysCmd.AddCommand(keysPublicCmd)
+	rootCmd.AddCommand(keysCmd)
+	wormExportCmd.Flags().StringVarP(&wormSnapshots, "snapshots", "", "", "snapshot store directory to export")
+	wormExportCmd.Flags().StringVarP(&wormChain, "chain", "c", "", "path to the chain database to export")
+	wormExportCmd.Flags().StringVarP(&wormDB, "db", "", "", "SQL database holding the chain to export, as postgres://... or sqlite3:<path>")
+	wormCmd.AddCommand(wormExportCmd)
+	wormCmd.AddCommand(wormVerifyCmd)
+	wormCmd.AddCommand(wormExtractCmd)
+	rootCmd.AddCommand(wormCmd)
+	attestCreateCmd.Flags().StringVarP(&attestKey, "key", "", "", "private key the attestation is signed with, a PEM file or a keychain://, awskms:// or gcpkms:// key")
+	attestCreateCmd.Flags().StringVarP(&attestBuilder, "builder", "", "", "URI identifying the build platform in the provenance")
+	attestCreateCmd.Flags().StringVarP(&attestInvocation, "invocation", "", "", "ID of the build run, such as a CI job URL")
+	attestCreateCmd.Flags().BoolVarP(&attestFiles, "files", "", false, "also attest every archived file as a subject")
+	attestCreateCmd.Flags().StringVarP(&attestOut, "out", "", "", "write the attestation to this path instead of stdout")
+	attestVerifyCmd.Flags().StringSliceVarP(&attestPublicKeys, "pub", "", nil, "PKIX PEM public key trusted to sign attestations")
+	attestCmd.AddCommand(attestCreateCmd)
+	attestCmd.AddCommand(attestVerifyCmd)
+	rootCmd.AddCommand(attestCmd)
+	bagCmd.AddCommand(bagCreateCmd)
+	bagCmd.AddCommand(bagValidateCmd)
+	rootCmd.AddCommand(bagCmd)
+
+	chainCmd.PersistentFlags().StringVarP(&chainPath, "chain", "c", "golinks.chain", "path to the chain database")
+	lightCmd.PersistentFlags().StringVarP(&lightHeaders, "headers", "", "golinks.headers", "path to the stored block headers")
+	lightSyncCmd.Flags().StringVarP(&lightServer, "server", "", "localhost:7070", "address of the golinks server")
+	lightSyncCmd.Flags().StringVarP(&lightCA, "tls-ca", "", "", "PEM CA certificates verifying the server, connecting over TLS")
+	lightSyncCmd.Flags().StringVarP(&lightTLSCert, "tls-cert", "", "", "PEM client certificate presented to the server, connecting over TLS")
+	lightSyncCmd.Flags().StringVarP(&lightTLSKey, "tls-key", "", "", "PEM private key of --tls-cert")
+	lightSyncCmd.Flags().StringVarP(&lightNamespace, "namespace", "", "", "server namespace to follow, authenticated with $GOLINKS_TOKEN")
+	lightVerifyCmd.Flags().StringVarP(&lightFile, "file", "", "", "local file that must match the proven hash")
+	lightCmd.AddCommand(lightSyncCmd)
+	lightCmd.AddCommand(lightVerifyCmd)
+	rootCmd.AddCommand(lightCmd)
+	chainCmd.PersistentFlags().StringVarP(&genesisCreator, "creator", "", "", "creator recorded in the genesis block")
+	chainCmd.PersistentFlags().StringVarP(&genesisRoot, "root", "", "", "root path recorded in the genesis block")
+	chainCmd.PersistentFlags().StringToStringVarP(&genesisPolicy, "policy", "", nil, "policy parameters recorded in the genesis block, as key=value")
+	chainCmd.AddCommand(chainInitCmd)
+	chainAddCmd.Flags().BoolVarP(&chainMerkle, "merkle", "", false, "also record the link's merkle root for light clients")
+	chainCmd.AddCommand(chainAddCmd)
+	chainCmd.AddCommand(chainNotarizeCmd)
+	chainCheckpointCmd.Flags().StringVarP(&checkpointKey, "key", "", "", "private key the checkpoint is signed with, a PEM file or a keychain://, awskms:// or gcpkms:// key")
+	chainCheckpointCmd.Flags().BoolVarP(&checkpointPrune, "prune", "", false, "drop the data of blocks before the checkpoint")
+	chainCmd.AddCommand(chainCheckpointCmd)
+	chainCmd.PersistentFlags().StringVarP(&chainWriter, "writer", "", "", "writer ID stamped on appended blocks, enabling multi-writer mode")
+	chainCmd.AddCommand(chainMergeCmd)
+	chainCmd.PersistentFlags().StringVarP(&chainDB, "db", "", "", "SQL database holding the chain instead of --chain, as postgres://... or sqlite3:<path>")
+	serveCmd.Flags().StringVarP(&chainDB, "db", "", "", "SQL database holding the chain instead of --chain, as postgres://... or sqlite3:<path>")
+	chainCmd.AddCommand(chainVerifyCmd)
+	chainAnchorCmd.Flags().StringSliceVarP(&anchorTSAs, "tsa", "", nil, "URL of an RFC 3161 time-stamp authority")
+	chainAnchorCmd.Flags().StringSliceVarP(&anchorCalendars, "ots", "", nil, "URL of an OpenTimestamps calendar, such as "+anchor.DefaultCalendar)
+	chainCmd.AddCommand(chainAnchorCmd)
+	chainVerifyCmd.Flags().StringVarP(&anchorTSARoots, "tsa-ca", "", "", "PEM file of trusted time-stamp authority certificates")
+	rootCmd.AddCommand(chainCmd)
+	cacheCmd.AddCommand(cacheClearCmd)
+	cacheCmd.AddCommand(cachePruneCmd)
+	cacheCmd.PersistentFlags().StringVarP(&cacheFile, "cache-file", "", "", "hash cache path (default $HOME/.golinks/hashcache.json)")
+	rootCmd.AddCommand(cacheCmd)
+	snapshotCmd.AddCommand(snapshotSaveCmd)
+	snapshotCmd.AddCommand(snapshotListCmd)
+	snapshotCmd.AddCommand(snapshotDiffCmd)
+	snapshotCmd.AddCommand(snapshotPruneCmd)
+	snapshotReportCmd.Flags().StringVarP(&reportFormat, "format", "f", "", "write the full report as json, csv or html")
+	snapshotReportCmd.Flags().StringVarP(&reportOut, "out", "", "", "write the full report to this path instead of stdout")
+	snapshotReportCmd.Flags().DurationVarP(&reportSince, "since", "", 0, "report only on snapshots taken within this duration")
+	snapshotReportCmd.Flags().DurationVarP(&reportInterval, "interval", "", 0, "expected time between snapshots, measuring interval coverage")
+	snapshotReportCmd.Flags().DurationVarP(&reportMaxAge, "max-age", "", 0, "mark paths not verified within this duration as stale")
+	snapshotReportCmd.Flags().StringVarP(&reportBaseline, "baseline", "", "", "directory whose saved link is the approved state")
+	snapshotReportCmd.Flags().StringVarP(&policyPath, "policy", "", "", "JSON policy of allowed changes and path rules, resolving the drift it passes")
+	snapshotCmd.AddCommand(snapshotReportCmd)
+	snapshotPruneCmd.Flags().IntVarP(&snapshotKeep, "keep", "", 0, "keep only this many of the newest snapshots")
+	snapshotPruneCmd.Flags().DurationVarP(&snapshotMaxAge, "max-age", "", 0, "remove snapshots older than this duration")
+	snapshotCmd.PersistentFlags().StringVarP(&snapshotStore, "store", "", "", "snapshot directory (default $HOME/.golinks/snapshots/<root hash>)")
+	rootCmd.AddCommand(snapshotCmd)
+	monitorCmd.Flags().DurationVarP(&monitorInterval, "interval", "", time.Hour, "time between verifications")
+	monitorCmd.Flags().StringSliceVarP(&monitorWebhooks, "webhook", "", nil, "URL alerts are posted to as JSON")
+	monitorCmd.Flags().StringVarP(&monitorSlack, "slack", "", "", "Slack incoming webhook URL alerts are posted to")
+	monitorCmd.Flags().StringVarP(&monitorSMTP, "smtp", "", "", "host:port of the SMTP server alerts are mailed through")
+	monitorCmd.Flags().StringVarP(&monitorSMTPUser, "smtp-user", "", "", "SMTP user name")
+	monitorCmd.Flags().StringVarP(&monitorMailFrom, "mail-from", "", "", "sender address of alert mails")
+	monitorCmd.Flags().StringSliceVarP(&monitorMailTo, "mail-to", "", nil, "recipient addresses of alert mails")
+	monitorCmd.Flags().StringVarP(&monitorSyslog, "syslog", "", "", "syslog server alerts are sent to, as udp://, tcp:// or tls://host[:port]")
+	monitorCmd.Flags().StringVarP(&monitorSyslogFm, "syslog-format", "", "cef", "format of syslog alerts: text, cef or leef")
+	rootCmd.AddCommand(monitorCmd)
+	searchCmd.Flags().StringVarP(&searchFile, "file", "", "", "search for the hashes of a local file instead of a given hash")
+	searchCmd.Flags().StringVarP(&searchDB, "db", "", "", "SQL database holding a persistent index, as postgres://... or sqlite3:<path>")
+	rootCmd.AddCommand(searchCmd)
+	torrentCmd.Flags().StringVarP(&torrentPieceLength, "piece-length", "", "256K", "piece length, a power of two of at least 16K")
+	torrentCmd.Flags().StringSliceVarP(&torrentAnnounce, "announce", "", nil, "tracker URLs")
+	torrentCmd.Flags().StringVarP(&torrentComment, "comment", "", "", "torrent comment")
+	torrentCmd.Flags().BoolVarP(&torrentV2, "v2", "", false, "write a BEP 52 torrent with per-file merkle trees")
+	rootCmd.AddCommand(torrentCmd)
+	syncCmd.Flags().BoolVarP(&syncDryRun, "dry-run", "n", false, "list the changes without making them")
+	syncCmd.Flags().BoolVarP(&syncDelete, "delete", "", false, "delete destination files that aren't in the source")
+	syncCmd.Flags().StringVarP(&syncChunking, "chunking", "", "", "reuse unchanged regions of large files [fixed, cdc]")
+	rootCmd.AddCommand(syncCmd)
 
 	authCmd.Flags().StringVarP(&setAuthEmail, "email", "e", "", "Set authentication email")
 	authCmd.Flags().StringVarP(&setAuthToken, "token", "t", "", "Set API token")
@@ -126,6 +349,9 @@ func initConfig() {
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
+		if exit, ok := err.(*exitError); ok {
+			os.Exit(exit.code)
+		}
 		os.Exit(1)
 	}
 }
@@ -137,6 +363,15 @@ func verb(msg ...interface{}) {
 	}
 }
 
+// libraryLogger returns the logger passed to library packages, logging
+// warnings to stderr and everything in verbose mode
+func libraryLogger() logging.Logger {
+	if verbose {
+		return logging.New(os.Stderr, logging.Debug)
+	}
+	return logging.New(os.Stderr, logging.Warn)
+}
+
 // var userLicense = `Copyright 2018-2019 Kevin Gentile
 
 //  Licensed under the Apache License, Version 2.0 (the "License");
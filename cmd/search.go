@@ -0,0 +1,186 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+
+	"github.com/govice/golinks/blockmap"
+	"github.com/govice/golinks/fs"
+	"github.com/govice/golinks/index"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	searchFile string
+	searchDB   string
+)
+
+var searchCmd = &cobra.Command{
+	Use:   "search <hash> [path]...",
+	Short: "Find the links and paths holding a file hash",
+	Long: "Find the links and paths holding a hex or base64 file hash, or the hashes of a local file with --file. " +
+		"Each path is a link file or a directory searched for link files, by default every snapshot store. " +
+		"With --db the paths are added to a SQL index kept in the database and the whole index is searched.",
+	Args:          cobra.ArbitraryArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var hashes [][]byte
+		if searchFile != "" {
+			fileHashes, err := hashFileAllAlgorithms(searchFile)
+			if err != nil {
+				return err
+			}
+			hashes = fileHashes
+		} else {
+			if len(args) == 0 {
+				return errors.New("a hash or --file is required")
+			}
+			hash, err := parseHash(args[0])
+			if err != nil {
+				return err
+			}
+			hashes = [][]byte{hash}
+			args = args[1:]
+		}
+
+		if searchDB != "" {
+			return searchSQL(hashes, args)
+		}
+		if len(args) == 0 {
+			u, err := user.Current()
+			if err != nil {
+				return err
+			}
+			args = []string{filepath.Join(u.HomeDir, ".golinks", "snapshots")}
+		}
+		ix := index.New()
+		ix.SetScreen(hashes...)
+		for _, path := range args {
+			info, err := os.Stat(path)
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				if err := ix.AddFile(path); err != nil {
+					return err
+				}
+				continue
+			}
+			skipped, err := ix.AddDir(path)
+			if err != nil {
+				return err
+			}
+			for _, link := range skipped {
+				verb("skipped encrypted link " + link)
+			}
+		}
+		verb(fmt.Sprintf("searched %d links, %d ruled out by bloom filters", len(ix.Links()), ix.Screened()))
+
+		var locations []index.Location
+		for _, hash := range hashes {
+			locations = append(locations, ix.Lookup(hash)...)
+		}
+		return printLocations(locations)
+	},
+}
+
+// searchSQL adds the links at paths to the SQL index in searchDB and looks up
+// hashes in the index
+func searchSQL(hashes [][]byte, paths []string) error {
+	ix, err := index.OpenSQL(searchDB)
+	if err != nil {
+		return err
+	}
+	defer ix.Close()
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			if err := ix.AddFile(path); err != nil {
+				return err
+			}
+			continue
+		}
+		skipped, err := ix.AddDir(path)
+		if err != nil {
+			return err
+		}
+		for _, link := range skipped {
+			verb("skipped encrypted link " + link)
+		}
+	}
+
+	var locations []index.Location
+	for _, hash := range hashes {
+		found, err := ix.Lookup(hash)
+		if err != nil {
+			return err
+		}
+		locations = append(locations, found...)
+	}
+	return printLocations(locations)
+}
+
+func printLocations(locations []index.Location) error {
+	return printResult(locations, func() {
+		for _, location := range locations {
+			fmt.Println(location.Time.Local().Format(time.RFC3339), location.Link, location.Path)
+		}
+	})
+}
+
+// parseHash decodes a hash given in hex or standard base64
+func parseHash(s string) ([]byte, error) {
+	if hash, err := hex.DecodeString(s); err == nil {
+		return hash, nil
+	}
+	hash, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.Errorf("hash %q is neither hex nor base64", s)
+	}
+	return hash, nil
+}
+
+// hashFileAllAlgorithms hashes the file at path with every registered file
+// hash algorithm links may be generated with
+func hashFileAllAlgorithms(path string) ([][]byte, error) {
+	var hashes [][]byte
+	for _, alg := range blockmap.HashAlgorithms() {
+		newHash, err := alg.Func()
+		if err != nil {
+			return nil, err
+		}
+		hasher := fs.NewHasher(fs.DefaultBufferSize)
+		hasher.New = newHash
+		hash, err := hasher.HashFile(path)
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, nil
+}
@@ -0,0 +1,227 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package cmd
+
+import (
+	"context"
+	"crypto"
+	"crypto/tls"
+	"log"
+	"net"
+	"time"
+
+	"github.com/govice/golinks/auth"
+	"github.com/govice/golinks/block"
+	"github.com/govice/golinks/blockchain"
+	"github.com/govice/golinks/cache"
+	"github.com/govice/golinks/p2p"
+	"github.com/govice/golinks/server"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+var (
+	serveAddress    string
+	serveChainPath  string
+	serveP2P        string
+	servePeers      []string
+	serveSyncEvery  time.Duration
+	serveWriter     string
+	serveCacheSize  int
+	serveRedis      string
+	serveCacheTTL   time.Duration
+	serveNamespaces string
+	serveAuth       string
+	serveTLSCert    string
+	serveTLSKey     string
+	serveClientCA   string
+	servePeerCert   string
+	servePeerKey    string
+	servePeerCA     string
+	servePeerSigner []string
+	servePeerQuorum int
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run the golinks gRPC integrity service",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := serve(); err != nil {
+			log.Println(err)
+			cmd.Help()
+		}
+	},
+}
+
+func serve() error {
+	store, err := openStore(serveChainPath, chainDB)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	chain, err := blockchain.Open(store, block.NewSHA512Genesis())
+	if err != nil {
+		return err
+	}
+	chain.SetWriter(serveWriter)
+	l, err := openAuditLog()
+	if err != nil {
+		return err
+	}
+	if l != nil {
+		target := chainDB
+		if target == "" {
+			target = serveChainPath
+		}
+		chain.SetAuditLog(l, target)
+	}
+
+	listener, err := net.Listen("tcp", serveAddress)
+	if err != nil {
+		return errors.Wrap(err, "serve: failed to listen")
+	}
+	c, err := serveMetrics()
+	if err != nil {
+		return err
+	}
+	var (
+		opts   []grpc.ServerOption
+		config *tls.Config
+		policy *auth.Policy
+	)
+	if serveTLSCert != "" {
+		if config, err = serverTLS(serveTLSCert, serveTLSKey, serveClientCA); err != nil {
+			return err
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(config)))
+	}
+	if serveAuth != "" {
+		if policy, err = loadPolicy(serveAuth); err != nil {
+			return err
+		}
+	}
+	srv := grpc.NewServer(opts...)
+	golinks := server.New(chain)
+	golinks.SetMetrics(c)
+	golinks.SetPolicy(policy)
+	b, err := serveEvents(policy, config)
+	if err != nil {
+		return err
+	}
+	golinks.SetEvents(b)
+	if err := setServeCache(golinks); err != nil {
+		return err
+	}
+	if serveNamespaces != "" {
+		stores, err := addNamespaces(golinks, serveNamespaces)
+		for _, store := range stores {
+			defer store.Close()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	golinks.Register(srv)
+	if err := serveNode(chain, golinks); err != nil {
+		return err
+	}
+	log.Println("serving golinks on " + listener.Addr().String())
+	return srv.Serve(listener)
+}
+
+// setServeCache sets the cache selected by --redis or --cache-size
+func setServeCache(golinks *server.Server) error {
+	switch {
+	case serveRedis != "":
+		r, err := cache.NewRedisURL(serveRedis)
+		if err != nil {
+			return err
+		}
+		r.SetTTL(serveCacheTTL)
+		golinks.SetCache(r)
+	case serveCacheSize > 0:
+		golinks.SetCache(cache.NewLRU(serveCacheSize))
+	}
+	return nil
+}
+
+// setNodeTrust authenticates peers with the certificates of --peer-cert and
+// --peer-ca and requires --peer-signer signatures on their blocks
+func setNodeTrust(node *p2p.Node) error {
+	if servePeerCert != "" {
+		pair, err := tls.LoadX509KeyPair(servePeerCert, servePeerKey)
+		if err != nil {
+			return errors.Wrap(err, "failed to load peer certificate")
+		}
+		if servePeerCA == "" {
+			return errors.New("serve: --peer-ca is required to authenticate peers")
+		}
+		pool, err := loadCertPool(servePeerCA)
+		if err != nil {
+			return err
+		}
+		node.SetTLS(&tls.Config{
+			Certificates: []tls.Certificate{pair},
+			RootCAs:      pool,
+			ClientCAs:    pool,
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			MinVersion:   tls.VersionTLS12,
+		})
+	}
+	if len(servePeerSigner) > 0 {
+		var trusted []crypto.PublicKey
+		for _, path := range servePeerSigner {
+			key, err := readPublicKey(path)
+			if err != nil {
+				return err
+			}
+			trusted = append(trusted, key)
+		}
+		node.SetTrustedSigners(trusted, servePeerQuorum)
+	}
+	return nil
+}
+
+// serveNode starts a p2p node sharing the served chain when --p2p-listen or
+// --peer is set
+func serveNode(chain *blockchain.Blockchain, golinks *server.Server) error {
+	if serveP2P == "" && len(servePeers) == 0 {
+		return nil
+	}
+	node := p2p.NewNode(chain)
+	node.SetLocker(golinks.Locker())
+	node.SetLogger(libraryLogger())
+	node.SetMerge(serveWriter != "")
+	if err := setNodeTrust(node); err != nil {
+		return err
+	}
+	if serveP2P != "" {
+		listener, err := net.Listen("tcp", serveP2P)
+		if err != nil {
+			return errors.Wrap(err, "serve: failed to listen for peers")
+		}
+		log.Println("serving peers on " + listener.Addr().String())
+		go node.Serve(listener)
+	}
+	for _, peer := range servePeers {
+		node.AddPeer(peer)
+	}
+	go node.Run(context.Background(), serveSyncEvery)
+	return nil
+}
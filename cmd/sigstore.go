@@ -0,0 +1,173 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/govice/golinks/blockmap"
+	"github.com/govice/golinks/sigstore"
+	"github.com/govice/golinks/tlog"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	sigstoreFulcio   string
+	sigstoreRekor    string
+	sigstoreToken    string
+	sigstoreIdentity string
+	sigstoreIssuer   string
+	sigstoreRoots    string
+	sigstoreRekorKey string
+)
+
+var sigstoreCmd = &cobra.Command{
+	Use:   "sigstore",
+	Short: "Sign links without long-lived keys using Sigstore",
+}
+
+var sigstoreSignCmd = &cobra.Command{
+	Use:           "sign <dir>",
+	Short:         "Sign a directory's root hash with a Fulcio certificate and record it in Rekor",
+	Long:          "Sign the root hash of a directory's link with an ephemeral key certified by Fulcio for an OIDC identity, record the signature in Rekor and save the certificate and log entry in the link. The identity token is read from --identity-token, $SIGSTORE_ID_TOKEN or requested from GitHub Actions.",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := context.Background()
+		token := sigstoreToken
+		if token == "" {
+			var err error
+			if token, err = sigstore.IdentityToken(ctx); err != nil {
+				return err
+			}
+		}
+		fulcio, err := sigstore.NewFulcio(sigstoreFulcio)
+		if err != nil {
+			return err
+		}
+		rekor, err := tlog.NewClient(sigstoreRekor)
+		if err != nil {
+			return err
+		}
+		b := blockmap.New(args[0])
+		if err := b.Load(args[0]); err != nil {
+			return err
+		}
+		verb("signing " + args[0] + " with " + sigstoreFulcio + " and " + sigstoreRekor)
+		if err := b.SignKeyless(ctx, token, fulcio, rekor); err != nil {
+			return err
+		}
+		l, err := openAuditLog()
+		if err != nil {
+			return err
+		}
+		b.SetAuditLog(l)
+		if err := b.Save(args[0]); err != nil {
+			return err
+		}
+		certificates, err := sigstore.ParseCertificates(b.Sigstore.Certificate)
+		if err != nil {
+			return err
+		}
+		return printResult(b.Sigstore.Entry, func() {
+			fmt.Println("identity:", strings.Join(sigstore.Identities(certificates[0]), ", "))
+			fmt.Println("uuid:", b.Sigstore.Entry.UUID)
+			fmt.Println("log index:", b.Sigstore.Entry.LogIndex)
+		})
+	},
+}
+
+var sigstoreVerifyCmd = &cobra.Command{
+	Use:           "verify <dir>",
+	Short:         "Verify the keyless signature of a directory's link",
+	Long:          "Verify that the keyless signature saved in a directory's link signs its root hash with a certificate from Fulcio, valid when Rekor logged the signature, and that the log entry is signed by Rekor's --rekor-key and included in Rekor. The link isn't compared to the directory, use verify for that.",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logKey, err := readPublicKey(sigstoreRekorKey)
+		if err != nil {
+			return err
+		}
+		v := &sigstore.Verifier{LogKey: logKey, Identity: sigstoreIdentity, Issuer: sigstoreIssuer}
+		if sigstoreRoots != "" {
+			roots, intermediates, err := readCertificateChains(sigstoreRoots)
+			if err != nil {
+				return err
+			}
+			v.Roots, v.Intermediates = roots, intermediates
+		} else {
+			fulcio, err := sigstore.NewFulcio(sigstoreFulcio)
+			if err != nil {
+				return err
+			}
+			verb("fetching the trust bundle of " + sigstoreFulcio)
+			if v.Roots, v.Intermediates, err = fulcio.TrustBundle(context.Background()); err != nil {
+				return err
+			}
+		}
+
+		b := blockmap.New(args[0])
+		if err := b.Load(args[0]); err != nil {
+			return err
+		}
+		certificate, err := b.VerifySigstore(v)
+		if err != nil {
+			return err
+		}
+		identities := sigstore.Identities(certificate)
+		return printResult(map[string]interface{}{
+			"identities": identities,
+			"issuer":     sigstore.Issuer(certificate),
+			"logIndex":   b.Sigstore.Entry.LogIndex,
+		}, func() {
+			fmt.Println("identity:", strings.Join(identities, ", "))
+			fmt.Println("issuer:", sigstore.Issuer(certificate))
+			fmt.Println("log index:", b.Sigstore.Entry.LogIndex)
+			fmt.Println("signature is valid")
+		})
+	},
+}
+
+// readCertificateChains reads PEM certificates, taking self-signed ones as
+// roots and the others as intermediates
+func readCertificateChains(path string) (roots, intermediates *x509.CertPool, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to read certificates")
+	}
+	certificates, err := sigstore.ParseCertificates(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	roots, intermediates = x509.NewCertPool(), x509.NewCertPool()
+	for _, c := range certificates {
+		if bytes.Equal(c.RawIssuer, c.RawSubject) {
+			roots.AddCert(c)
+		} else {
+			intermediates.AddCert(c)
+		}
+	}
+	return roots, intermediates, nil
+}
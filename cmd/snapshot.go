@@ -0,0 +1,227 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+
+	"github.com/govice/golinks/blockmap"
+	"github.com/govice/golinks/compliance"
+	"github.com/govice/golinks/snapshot"
+	"github.com/spf13/cobra"
+)
+
+var (
+	snapshotStore  string
+	snapshotKeep   int
+	snapshotMaxAge time.Duration
+
+	reportFormat   string
+	reportOut      string
+	reportSince    time.Duration
+	reportInterval time.Duration
+	reportMaxAge   time.Duration
+	reportBaseline string
+)
+
+// openSnapshots opens the snapshot store of root selected by the --store flag.
+// By default each root has a store in the golinks home folder named by a hash
+// of its absolute path.
+func openSnapshots(root string) (*snapshot.Store, error) {
+	dir := snapshotStore
+	if dir == "" {
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			return nil, err
+		}
+		u, err := user.Current()
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256([]byte(abs))
+		dir = filepath.Join(u.HomeDir, ".golinks", "snapshots", hex.EncodeToString(sum[:8]))
+	}
+	verb("using snapshot store " + dir)
+	return snapshot.Open(dir)
+}
+
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Keep a history of blockmaps for a directory",
+}
+
+var snapshotSaveCmd = &cobra.Command{
+	Use:           "save <dir>",
+	Short:         "Generate a blockmap for a directory and store it as a new snapshot",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s, err := openSnapshots(args[0])
+		if err != nil {
+			return err
+		}
+		b := blockmap.New(args[0], blockmap.WithLogger(libraryLogger()))
+		if err := b.Generate(); err != nil {
+			return err
+		}
+		saved, err := s.Save(b)
+		if err != nil {
+			return err
+		}
+		return printResult(saved, func() {
+			fmt.Println("snapshot:", saved.ID)
+			fmt.Println("root hash:", hex.EncodeToString(b.RootHash))
+		})
+	},
+}
+
+var snapshotListCmd = &cobra.Command{
+	Use:           "list <dir>",
+	Short:         "List the snapshots of a directory, oldest first",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s, err := openSnapshots(args[0])
+		if err != nil {
+			return err
+		}
+		snapshots, err := s.List()
+		if err != nil {
+			return err
+		}
+		return printResult(snapshots, func() {
+			for _, snapshot := range snapshots {
+				fmt.Println(snapshot.ID, snapshot.Time.Local().Format(time.RFC3339))
+			}
+		})
+	},
+}
+
+var snapshotDiffCmd = &cobra.Command{
+	Use:           "diff <dir> <snapshot> <snapshot>",
+	Short:         "Show differences between two snapshots of a directory",
+	Args:          cobra.ExactArgs(3),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s, err := openSnapshots(args[0])
+		if err != nil {
+			return err
+		}
+		diff, err := s.Diff(args[1], args[2])
+		if err != nil {
+			return err
+		}
+		return printResult(diff, func() {
+			printPaths("added", diff.Added)
+			printPaths("removed", diff.Removed)
+			printPaths("modified", diff.Modified)
+		})
+	},
+}
+
+var snapshotReportCmd = &cobra.Command{
+	Use:           "report <dir>",
+	Short:         "Report snapshot coverage, per path verification times and unresolved drift",
+	Long:          "Report how completely the snapshots of a directory cover a period, when each path was last verified in its approved state and which drift from that state is unresolved. The approved state is the link saved in --baseline or the oldest snapshot of the period. A summary is printed unless --format writes the full report as json, csv or html.",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s, err := openSnapshots(args[0])
+		if err != nil {
+			return err
+		}
+		opts := []compliance.Option{
+			compliance.WithInterval(reportInterval),
+			compliance.WithMaxAge(reportMaxAge),
+		}
+		if reportSince > 0 {
+			opts = append(opts, compliance.WithSince(time.Now().Add(-reportSince)))
+		}
+		if reportBaseline != "" {
+			baseline := blockmap.New(reportBaseline)
+			if err := baseline.Load(reportBaseline); err != nil {
+				return err
+			}
+			opts = append(opts, compliance.WithBaseline(baseline))
+		}
+		p, err := loadDriftPolicy()
+		if err != nil {
+			return err
+		}
+		if p != nil {
+			opts = append(opts, compliance.WithPolicy(p))
+		}
+		report, err := compliance.Generate(s, opts...)
+		if err != nil {
+			return err
+		}
+
+		if reportFormat != "" {
+			if reportOut == "" {
+				return compliance.Write(os.Stdout, report, reportFormat)
+			}
+			return writeReport(reportOut, func(f *os.File) error {
+				return compliance.Write(f, report, reportFormat)
+			})
+		}
+		return printResult(report, func() {
+			c := report.Coverage
+			fmt.Println("snapshots:", c.Snapshots)
+			fmt.Println("largest gap:", time.Duration(c.LargestGap))
+			if c.Interval > 0 {
+				fmt.Printf("intervals covered: %.1f%% (%d of %d missed)\n", c.Percent, c.MissedIntervals, c.Intervals)
+			}
+			fmt.Printf("paths verified: %.1f%% (%d of %d)\n", c.PathPercent, c.VerifiedPaths, c.Paths)
+			for _, f := range report.Unresolved {
+				fmt.Printf("%s: %s %s (%s)\n", f.Outcome, f.Change, f.Path, f.Reason)
+			}
+			fmt.Println("drift:", report.Outcome)
+		})
+	},
+}
+
+var snapshotPruneCmd = &cobra.Command{
+	Use:           "prune <dir>",
+	Short:         "Remove old snapshots of a directory, always keeping the newest",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s, err := openSnapshots(args[0])
+		if err != nil {
+			return err
+		}
+		removed, err := s.Prune(snapshot.Policy{KeepLast: snapshotKeep, MaxAge: snapshotMaxAge})
+		if err != nil {
+			return err
+		}
+		return printResult(removed, func() {
+			for _, snapshot := range removed {
+				fmt.Println("removed:", snapshot.ID)
+			}
+		})
+	},
+}
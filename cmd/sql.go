@@ -0,0 +1,34 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package cmd
+
+import (
+	"github.com/govice/golinks/blockchain"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// openStore opens the chain store in the SQL database db when given, or the
+// bbolt database at path
+func openStore(path, db string) (blockchain.Store, error) {
+	if db != "" {
+		verb("opening SQL chain database")
+		return blockchain.OpenSQLStore(db)
+	}
+	verb("opening chain " + path)
+	return blockchain.OpenBoltStore(path)
+}
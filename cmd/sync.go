@@ -0,0 +1,73 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/govice/golinks/blockmap"
+	golinksync "github.com/govice/golinks/sync"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	syncDryRun   bool
+	syncDelete   bool
+	syncChunking string
+)
+
+var syncCmd = &cobra.Command{
+	Use:           "sync <src> <dst>",
+	Short:         "Mirror a directory, copying only changed and renamed files",
+	Long:          "Mirror a directory by comparing blockmaps of the source and destination, copying only the files that differ and moving renamed files within the destination. Chunking lets modified files reuse their unchanged regions.",
+	Args:          cobra.ExactArgs(2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		opts := []golinksync.Option{golinksync.WithLogger(libraryLogger())}
+		switch blockmap.ChunkMode(syncChunking) {
+		case "":
+		case blockmap.FixedChunks, blockmap.CDCChunks:
+			opts = append(opts, golinksync.WithBlockMapOptions(
+				blockmap.WithChunking(blockmap.ChunkMode(syncChunking), 0, 0)))
+		default:
+			return errors.Errorf("unknown chunking %q", syncChunking)
+		}
+		if syncDryRun {
+			opts = append(opts, golinksync.WithDryRun())
+		}
+		if syncDelete {
+			opts = append(opts, golinksync.WithDelete())
+		}
+
+		result, err := golinksync.Mirror(args[0], args[1], opts...)
+		if err != nil {
+			return err
+		}
+		return printResult(result, func() {
+			for _, op := range result.Ops {
+				if op.Action == golinksync.Rename {
+					fmt.Printf("%s: %s -> %s\n", op.Action, op.From, op.Path)
+					continue
+				}
+				fmt.Printf("%s: %s\n", op.Action, op.Path)
+			}
+			fmt.Println("transferred bytes:", result.Transferred)
+			fmt.Println("reused bytes:", result.Reused)
+		})
+	},
+}
@@ -0,0 +1,82 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package cmd
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+
+	"github.com/govice/golinks/blockmap"
+	"github.com/govice/golinks/keys"
+	"github.com/govice/golinks/tlog"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	tlogAddress string
+	tlogKey     string
+)
+
+var publishCmd = &cobra.Command{
+	Use:           "publish <dir>",
+	Short:         "Publish a directory's root hash to a transparency log",
+	Long:          "Record the root hash of a directory's link in a Rekor-style transparency log, signed with a PKCS8 PEM private key, and save the log entry and its inclusion proof in the link.",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		signer, err := readSigner(tlogKey)
+		if err != nil {
+			return err
+		}
+		client, err := tlog.NewClient(tlogAddress)
+		if err != nil {
+			return err
+		}
+		b := blockmap.New(args[0])
+		if err := b.Load(args[0]); err != nil {
+			return err
+		}
+		verb("publishing " + args[0] + " to " + tlogAddress)
+		if err := b.PublishLog(context.Background(), client, signer); err != nil {
+			return err
+		}
+		l, err := openAuditLog()
+		if err != nil {
+			return err
+		}
+		b.SetAuditLog(l)
+		if err := b.Save(args[0]); err != nil {
+			return err
+		}
+		return printResult(b.Transparency, func() {
+			fmt.Println("uuid:", b.Transparency.UUID)
+			fmt.Println("log index:", b.Transparency.LogIndex)
+		})
+	},
+}
+
+// readSigner opens a signing key reference, a PEM file or a key held by one
+// of the keys providers
+func readSigner(ref string) (crypto.Signer, error) {
+	if ref == "" {
+		return nil, errors.New("no signing key given, use --key")
+	}
+	return keys.OpenSigner(context.Background(), ref)
+}
@@ -0,0 +1,90 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+package cmd
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+
+	"github.com/govice/golinks/blockmap"
+	"github.com/govice/golinks/torrent"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	torrentPieceLength string
+	torrentAnnounce    []string
+	torrentComment     string
+	torrentV2          bool
+)
+
+var torrentCmd = &cobra.Command{
+	Use:           "torrent <dir> <file>",
+	Short:         "Export a directory's blockmap as a .torrent file",
+	Long:          "Export the files of a directory's link as a .torrent file, generating a blockmap when the directory has no link. Files are checked against the link while their pieces are hashed.",
+	Args:          cobra.ExactArgs(2),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		pieceLength, err := parseByteSize(torrentPieceLength)
+		if err != nil {
+			return err
+		}
+		opts := []torrent.Option{
+			torrent.WithPieceLength(pieceLength),
+			torrent.WithAnnounce(torrentAnnounce...),
+			torrent.WithComment(torrentComment),
+		}
+		if torrentV2 {
+			opts = append(opts, torrent.WithVersion(torrent.V2))
+		}
+
+		b := blockmap.New(args[0], blockmap.WithLogger(libraryLogger()))
+		if err := b.Load(args[0]); os.IsNotExist(errors.Cause(err)) {
+			verb("generating blockmap for " + args[0])
+			if err := b.Generate(); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+		b.Root = args[0]
+
+		out, err := os.Create(args[1])
+		if err != nil {
+			return err
+		}
+		if err := torrent.Write(b, out, opts...); err != nil {
+			out.Close()
+			os.Remove(args[1])
+			return err
+		}
+		if err := out.Close(); err != nil {
+			return err
+		}
+		return printResult(map[string]interface{}{
+			"torrent":  args[1],
+			"rootHash": b.RootHash,
+			"files":    len(b.FilePaths()),
+		}, func() {
+			fmt.Println("torrent:", args[1])
+			fmt.Println("files:", len(b.FilePaths()))
+			fmt.Println("root hash:", base64.StdEncoding.EncodeToString(b.RootHash))
+		})
+	},
+}
@@ -54,16 +54,26 @@ func validate(path string, cmd *cobra.Command) error {
 	if err := fileBlockmap.Load(path); err != nil {
 		return err
 	}
+	fileBlockmap.Root = path
 
 	//Validate the existing directory
 	verb("validating link file with current archive")
-	temp := blockmap.New(path)
-	if err := temp.Generate(); err != nil {
+	report, err := fileBlockmap.Verify()
+	if err != nil {
 		return err
 	}
 
-	//Compare file with existing directory
-	if !blockmap.Equal(fileBlockmap, temp) {
+	//Report differences between the file and the existing directory
+	if !report.Valid() {
+		for _, path := range report.Missing {
+			fmt.Println("missing: " + path)
+		}
+		for _, path := range report.Modified {
+			fmt.Println("modified: " + path)
+		}
+		for _, path := range report.Added {
+			fmt.Println("added: " + path)
+		}
 		return errors.New("invalid link")
 	}
 
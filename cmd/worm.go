@@ -0,0 +1,165 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package cmd
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/govice/golinks/block"
+	"github.com/govice/golinks/blockchain"
+	"github.com/govice/golinks/snapshot"
+	"github.com/govice/golinks/worm"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	wormSnapshots string
+	wormChain     string
+	wormDB        string
+)
+
+var wormCmd = &cobra.Command{
+	Use:   "worm",
+	Short: "Export snapshots and chain blocks to append-only containers",
+	Long:  "Export snapshots and chain blocks to self-verifying append-only container files for write-once-read-many storage. Records are hash chained, so any change to a container is detected by verify.",
+}
+
+var wormExportCmd = &cobra.Command{
+	Use:           "export <container>",
+	Short:         "Append new snapshots and chain blocks to a container",
+	Long:          "Append the snapshots of a --snapshots store and the blocks of a --chain or --db chain that the container doesn't hold yet. The container is created if needed and only ever appended to.",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if wormSnapshots == "" && wormChain == "" && wormDB == "" {
+			return errors.New("nothing to export, use --snapshots, --chain or --db")
+		}
+		w, err := worm.OpenFile(args[0])
+		if err != nil {
+			return err
+		}
+		defer w.Close()
+
+		result := map[string]int{}
+		if wormSnapshots != "" {
+			store, err := snapshot.Open(wormSnapshots)
+			if err != nil {
+				return err
+			}
+			if result["snapshots"], err = worm.ExportSnapshots(w, store); err != nil {
+				return err
+			}
+		}
+		if wormChain != "" || wormDB != "" {
+			store, err := openStore(wormChain, wormDB)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+			chain, err := blockchain.Open(store, block.NewSHA512Genesis())
+			if err != nil {
+				return err
+			}
+			if result["blocks"], err = worm.ExportChain(w, chain); err != nil {
+				return err
+			}
+		}
+		return printResult(result, func() {
+			fmt.Println("snapshots exported:", result["snapshots"])
+			fmt.Println("blocks exported:", result["blocks"])
+		})
+	},
+}
+
+var wormVerifyCmd = &cobra.Command{
+	Use:           "verify <container>",
+	Short:         "Verify a container's hash chain and list its records",
+	Args:          cobra.ExactArgs(1),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		records, err := worm.VerifyFile(args[0])
+		if err != nil {
+			return err
+		}
+		return printResult(records, func() {
+			for _, r := range records {
+				fmt.Println(r.Time.Format("2006-01-02T15:04:05Z"), r.Kind, r.Name)
+			}
+			if n := len(records); n > 0 {
+				fmt.Println("head:", hex.EncodeToString(records[n-1].Hash))
+			}
+			fmt.Println("container is valid,", len(records), "records")
+		})
+	},
+}
+
+var wormExtractCmd = &cobra.Command{
+	Use:           "extract <container> <snapshot|block> <name>",
+	Short:         "Write the data of a container record to stdout",
+	Long:          "Write the data of the last record of a kind and name in a container to stdout, a snapshot's link file or a block's JSON. The container is verified up to the record.",
+	Args:          cobra.ExactArgs(3),
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var kind worm.Kind
+		switch args[1] {
+		case worm.KindSnapshot.String():
+			kind = worm.KindSnapshot
+		case worm.KindBlock.String():
+			kind = worm.KindBlock
+			if _, err := strconv.Atoi(args[2]); err != nil {
+				return errors.Errorf("block name %q is not an index", args[2])
+			}
+		default:
+			return errors.Errorf("unknown record kind %q", args[1])
+		}
+
+		f, err := os.Open(args[0])
+		if err != nil {
+			return errors.Wrap(err, "failed to open container")
+		}
+		defer f.Close()
+		r, err := worm.NewReader(f)
+		if err != nil {
+			return err
+		}
+		var found *worm.Record
+		for {
+			rec, err := r.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return err
+			}
+			if rec.Kind == kind && rec.Name == args[2] {
+				found = rec
+			}
+		}
+		if found == nil {
+			return errors.Errorf("no %s record named %s", args[1], args[2])
+		}
+		_, err = os.Stdout.Write(found.Data)
+		return err
+	},
+}
@@ -0,0 +1,271 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// CBOR major types
+const (
+	cborUint   byte = 0
+	cborNegInt byte = 1
+	cborBytes  byte = 2
+	cborText   byte = 3
+	cborArray  byte = 4
+	cborMap    byte = 5
+	cborSimple byte = 7
+)
+
+type cborCodec struct{}
+
+func (cborCodec) Name() string { return "cbor" }
+func (cborCodec) ID() byte     { return 'c' }
+
+func (cborCodec) Marshal(v interface{}) ([]byte, error) {
+	value, err := toValue(reflect.ValueOf(v))
+	if err != nil {
+		return nil, err
+	}
+	var buffer bytes.Buffer
+	if err := writeCBOR(&buffer, value); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (cborCodec) Unmarshal(data []byte, v interface{}) error {
+	r := &reader{data: data}
+	value, err := readCBOR(r)
+	if err != nil {
+		return err
+	}
+	if r.remaining() != 0 {
+		return errors.New("codec: trailing cbor data")
+	}
+	return decodeInto(value, v)
+}
+
+func writeCBORHead(buffer *bytes.Buffer, major byte, n uint64) {
+	major <<= 5
+	switch {
+	case n < 24:
+		buffer.WriteByte(major | byte(n))
+	case n <= math.MaxUint8:
+		buffer.WriteByte(major | 24)
+		buffer.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buffer.WriteByte(major | 25)
+		binary.Write(buffer, binary.BigEndian, uint16(n))
+	case n <= math.MaxUint32:
+		buffer.WriteByte(major | 26)
+		binary.Write(buffer, binary.BigEndian, uint32(n))
+	default:
+		buffer.WriteByte(major | 27)
+		binary.Write(buffer, binary.BigEndian, n)
+	}
+}
+
+func writeCBOR(buffer *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		buffer.WriteByte(cborSimple<<5 | 22)
+	case bool:
+		if v {
+			buffer.WriteByte(cborSimple<<5 | 21)
+		} else {
+			buffer.WriteByte(cborSimple<<5 | 20)
+		}
+	case int64:
+		if v < 0 {
+			writeCBORHead(buffer, cborNegInt, uint64(-1-v))
+		} else {
+			writeCBORHead(buffer, cborUint, uint64(v))
+		}
+	case uint64:
+		writeCBORHead(buffer, cborUint, v)
+	case float64:
+		buffer.WriteByte(cborSimple<<5 | 27)
+		binary.Write(buffer, binary.BigEndian, math.Float64bits(v))
+	case string:
+		writeCBORHead(buffer, cborText, uint64(len(v)))
+		buffer.WriteString(v)
+	case []byte:
+		writeCBORHead(buffer, cborBytes, uint64(len(v)))
+		buffer.Write(v)
+	case []interface{}:
+		writeCBORHead(buffer, cborArray, uint64(len(v)))
+		for _, elem := range v {
+			if err := writeCBOR(buffer, elem); err != nil {
+				return err
+			}
+		}
+	case *object:
+		writeCBORHead(buffer, cborMap, uint64(len(v.keys)))
+		for i, key := range v.keys {
+			writeCBOR(buffer, key)
+			if err := writeCBOR(buffer, v.values[i]); err != nil {
+				return err
+			}
+		}
+	default:
+		return errors.Errorf("codec: can't encode %T as cbor", value)
+	}
+	return nil
+}
+
+func readCBOR(r *reader) (interface{}, error) {
+	initial, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	major, info := initial>>5, initial&0x1f
+
+	if major == cborSimple {
+		switch info {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22, 23:
+			return nil, nil
+		case 27:
+			bits, err := r.uint(8)
+			if err != nil {
+				return nil, err
+			}
+			return math.Float64frombits(bits), nil
+		}
+		return nil, errors.New("codec: unsupported cbor simple value")
+	}
+
+	var n uint64
+	switch {
+	case info < 24:
+		n = uint64(info)
+	case info <= 27:
+		if n, err = r.uint(1 << (info - 24)); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("codec: unsupported cbor length encoding")
+	}
+
+	switch major {
+	case cborUint:
+		if n > math.MaxInt64 {
+			return n, nil
+		}
+		return int64(n), nil
+	case cborNegInt:
+		if n > math.MaxInt64 {
+			return nil, errors.New("codec: cbor negative integer overflow")
+		}
+		return -1 - int64(n), nil
+	case cborBytes:
+		data, err := r.bytes(n)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{}, data...), nil
+	case cborText:
+		data, err := r.bytes(n)
+		if err != nil {
+			return nil, err
+		}
+		return string(data), nil
+	case cborArray:
+		if n > uint64(r.remaining()) {
+			return nil, errUnexpectedEnd
+		}
+		values := make([]interface{}, n)
+		for i := range values {
+			if values[i], err = readCBOR(r); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	case cborMap:
+		if n > uint64(r.remaining()) {
+			return nil, errUnexpectedEnd
+		}
+		obj := make(map[string]interface{}, n)
+		for i := uint64(0); i < n; i++ {
+			key, err := readCBOR(r)
+			if err != nil {
+				return nil, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, errors.New("codec: cbor map keys must be text")
+			}
+			if obj[name], err = readCBOR(r); err != nil {
+				return nil, err
+			}
+		}
+		return obj, nil
+	}
+	return nil, errors.New("codec: unsupported cbor major type")
+}
+
+var errUnexpectedEnd = errors.New("codec: unexpected end of data")
+
+// reader reads binary encoded values from a byte slice
+type reader struct {
+	data []byte
+	pos  int
+}
+
+func (r *reader) remaining() int {
+	return len(r.data) - r.pos
+}
+
+func (r *reader) byte() (byte, error) {
+	if r.remaining() < 1 {
+		return 0, errUnexpectedEnd
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *reader) bytes(n uint64) ([]byte, error) {
+	if n > uint64(r.remaining()) {
+		return nil, errUnexpectedEnd
+	}
+	data := r.data[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return data, nil
+}
+
+// uint reads a big endian unsigned integer of size bytes
+func (r *reader) uint(size int) (uint64, error) {
+	data, err := r.bytes(uint64(size))
+	if err != nil {
+		return 0, err
+	}
+	var n uint64
+	for _, b := range data {
+		n = n<<8 | uint64(b)
+	}
+	return n, nil
+}
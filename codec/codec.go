@@ -0,0 +1,151 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+// Package codec implements the serialization formats supported for .link files.
+// Binary formats are written with a short header identifying the format so
+// files can be decoded without knowing how they were written.
+package codec
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// Codec marshals values to and from a serialization format
+type Codec interface {
+	// Name returns the name of the format
+	Name() string
+	// ID returns the format identifier written to the file header
+	ID() byte
+	// Marshal encodes v without a header
+	Marshal(v interface{}) ([]byte, error)
+	// Unmarshal decodes data without a header into v
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// HeaderVersion is the version of the file header written by Encode
+const HeaderVersion byte = 1
+
+// Magic prefixes every file written with a binary codec
+var Magic = []byte("GLNK")
+
+var (
+	// JSON encodes values with encoding/json. JSON output is written without a
+	// header so existing .link files remain readable by other tools.
+	JSON Codec = jsonCodec{}
+	// Gob encodes values with encoding/gob
+	Gob Codec = gobCodec{}
+	// CBOR encodes values as RFC 8949 concise binary object representation
+	CBOR Codec = cborCodec{}
+	// MessagePack encodes values with the MessagePack specification
+	MessagePack Codec = msgpackCodec{}
+)
+
+// ErrUnknownFormat is returned when decoding data with an unrecognized header
+var ErrUnknownFormat = errors.New("codec: unknown format")
+
+// Codecs returns every supported codec
+func Codecs() []Codec {
+	return []Codec{JSON, Gob, CBOR, MessagePack}
+}
+
+// ByName returns the codec with the provided name
+func ByName(name string) (Codec, error) {
+	for _, c := range Codecs() {
+		if c.Name() == name {
+			return c, nil
+		}
+	}
+	return nil, errors.Wrap(ErrUnknownFormat, name)
+}
+
+// Encode marshals v with c, prefixing binary formats with a header made of
+// Magic, HeaderVersion and the codec ID
+func Encode(c Codec, v interface{}) ([]byte, error) {
+	body, err := c.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "codec: failed to encode "+c.Name())
+	}
+	if c.ID() == JSON.ID() {
+		return body, nil
+	}
+
+	header := append(append([]byte{}, Magic...), HeaderVersion, c.ID())
+	return append(header, body...), nil
+}
+
+// Decode detects the format of data from its header, unmarshals it into v
+// and returns the codec used. Data without a header is decoded as JSON.
+func Decode(data []byte, v interface{}) (Codec, error) {
+	c, body, err := Detect(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Unmarshal(body, v); err != nil {
+		return nil, errors.Wrap(err, "codec: failed to decode "+c.Name())
+	}
+	return c, nil
+}
+
+// Detect returns the codec data was written with and the data following the header
+func Detect(data []byte) (Codec, []byte, error) {
+	if !bytes.HasPrefix(data, Magic) {
+		return JSON, data, nil
+	}
+
+	header := len(Magic) + 2
+	if len(data) < header {
+		return nil, nil, errors.Wrap(ErrUnknownFormat, "truncated header")
+	}
+	if data[len(Magic)] != HeaderVersion {
+		return nil, nil, errors.Wrap(ErrUnknownFormat, "unsupported header version")
+	}
+	for _, c := range Codecs() {
+		if c.ID() == data[len(Magic)+1] {
+			return c, data[header:], nil
+		}
+	}
+	return nil, nil, ErrUnknownFormat
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string { return "json" }
+func (jsonCodec) ID() byte     { return 'j' }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+type gobCodec struct{}
+
+func (gobCodec) Name() string { return "gob" }
+func (gobCodec) ID() byte     { return 'g' }
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(v); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
@@ -0,0 +1,111 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package codec
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+type testEntry struct {
+	Size  int64   `json:"size"`
+	Owner *uint32 `json:"owner,omitempty"`
+}
+
+type testValue struct {
+	Name    string               `json:"name"`
+	Hash    []byte               `json:"hash"`
+	Count   int                  `json:"count"`
+	Offset  int64                `json:"offset"`
+	Enabled bool                 `json:"enabled"`
+	Paths   []string             `json:"paths"`
+	Archive map[string][]byte    `json:"archive"`
+	Entries map[string]testEntry `json:"entries,omitempty"`
+	hidden  string
+}
+
+func TestCodecs_RoundTrip(t *testing.T) {
+	owner := uint32(1000)
+	long := bytes.Repeat([]byte("x"), 70000)
+	original := testValue{
+		Name:    "archive",
+		Hash:    []byte{0, 1, 2, 255},
+		Count:   -40000,
+		Offset:  1 << 40,
+		Enabled: true,
+		Paths:   []string{"a", "b/c", string(long[:300])},
+		Archive: map[string][]byte{"a": []byte("1"), "b": long},
+		Entries: map[string]testEntry{"a": {Size: 5, Owner: &owner}, "b": {Size: -3}},
+		hidden:  "hidden",
+	}
+
+	for _, c := range Codecs() {
+		data, err := Encode(c, original)
+		if err != nil {
+			t.Fatal(c.Name(), err)
+		}
+
+		decoded := testValue{}
+		detected, err := Decode(data, &decoded)
+		if err != nil {
+			t.Fatal(c.Name(), err)
+		}
+		if detected != c {
+			t.Error("detected", detected.Name(), "expected", c.Name())
+		}
+
+		expected := original
+		expected.hidden = ""
+		if !reflect.DeepEqual(decoded, expected) {
+			t.Error(c.Name(), "round trip mismatch")
+		}
+	}
+}
+
+func TestCodecs_Vectors(t *testing.T) {
+	value := map[string]interface{}{"a": 1, "b": []interface{}{-1000, "x", []byte{1}, true, nil}}
+
+	cbor, err := CBOR.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedCBOR := []byte{0xa2, 0x61, 'a', 0x01, 0x61, 'b', 0x85, 0x39, 0x03, 0xe7, 0x61, 'x', 0x41, 0x01, 0xf5, 0xf6}
+	if !bytes.Equal(cbor, expectedCBOR) {
+		t.Errorf("unexpected cbor encoding % x", cbor)
+	}
+
+	msgpack, err := MessagePack.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedMsgpack := []byte{0x82, 0xa1, 'a', 0x01, 0xa1, 'b', 0x95, 0xd1, 0xfc, 0x18, 0xa1, 'x', 0xc4, 0x01, 0x01, 0xc3, 0xc0}
+	if !bytes.Equal(msgpack, expectedMsgpack) {
+		t.Errorf("unexpected msgpack encoding % x", msgpack)
+	}
+}
+
+func TestDecode_UnknownFormat(t *testing.T) {
+	data := append(append([]byte{}, Magic...), HeaderVersion, 'z')
+	if _, err := Decode(data, &testValue{}); err == nil {
+		t.Error("expected unknown format error")
+	}
+
+	if _, err := ByName("yaml"); err == nil {
+		t.Error("expected unknown codec name error")
+	}
+}
@@ -0,0 +1,277 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string { return "msgpack" }
+func (msgpackCodec) ID() byte     { return 'm' }
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	value, err := toValue(reflect.ValueOf(v))
+	if err != nil {
+		return nil, err
+	}
+	var buffer bytes.Buffer
+	if err := writeMsgpack(&buffer, value); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	r := &reader{data: data}
+	value, err := readMsgpack(r)
+	if err != nil {
+		return err
+	}
+	if r.remaining() != 0 {
+		return errors.New("codec: trailing msgpack data")
+	}
+	return decodeInto(value, v)
+}
+
+// writeMsgpackLength writes the smallest header for a str, bin, array or map of
+// length n. fixed is the fix format prefix or 0 if the type has none.
+func writeMsgpackLength(buffer *bytes.Buffer, n int, fixed byte, fixedMax int, formats [3]byte) {
+	switch {
+	case fixed != 0 && n <= fixedMax:
+		buffer.WriteByte(fixed | byte(n))
+	case formats[0] != 0 && n <= math.MaxUint8:
+		buffer.WriteByte(formats[0])
+		buffer.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		buffer.WriteByte(formats[1])
+		binary.Write(buffer, binary.BigEndian, uint16(n))
+	default:
+		buffer.WriteByte(formats[2])
+		binary.Write(buffer, binary.BigEndian, uint32(n))
+	}
+}
+
+func writeMsgpack(buffer *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		buffer.WriteByte(0xc0)
+	case bool:
+		if v {
+			buffer.WriteByte(0xc3)
+		} else {
+			buffer.WriteByte(0xc2)
+		}
+	case int64:
+		switch {
+		case v >= 0:
+			return writeMsgpack(buffer, uint64(v))
+		case v >= -32:
+			buffer.WriteByte(byte(v))
+		case v >= math.MinInt8:
+			buffer.WriteByte(0xd0)
+			buffer.WriteByte(byte(v))
+		case v >= math.MinInt16:
+			buffer.WriteByte(0xd1)
+			binary.Write(buffer, binary.BigEndian, int16(v))
+		case v >= math.MinInt32:
+			buffer.WriteByte(0xd2)
+			binary.Write(buffer, binary.BigEndian, int32(v))
+		default:
+			buffer.WriteByte(0xd3)
+			binary.Write(buffer, binary.BigEndian, v)
+		}
+	case uint64:
+		switch {
+		case v <= 0x7f:
+			buffer.WriteByte(byte(v))
+		case v <= math.MaxUint8:
+			buffer.WriteByte(0xcc)
+			buffer.WriteByte(byte(v))
+		case v <= math.MaxUint16:
+			buffer.WriteByte(0xcd)
+			binary.Write(buffer, binary.BigEndian, uint16(v))
+		case v <= math.MaxUint32:
+			buffer.WriteByte(0xce)
+			binary.Write(buffer, binary.BigEndian, uint32(v))
+		default:
+			buffer.WriteByte(0xcf)
+			binary.Write(buffer, binary.BigEndian, v)
+		}
+	case float64:
+		buffer.WriteByte(0xcb)
+		binary.Write(buffer, binary.BigEndian, math.Float64bits(v))
+	case string:
+		writeMsgpackLength(buffer, len(v), 0xa0, 31, [3]byte{0xd9, 0xda, 0xdb})
+		buffer.WriteString(v)
+	case []byte:
+		writeMsgpackLength(buffer, len(v), 0, 0, [3]byte{0xc4, 0xc5, 0xc6})
+		buffer.Write(v)
+	case []interface{}:
+		writeMsgpackLength(buffer, len(v), 0x90, 15, [3]byte{0, 0xdc, 0xdd})
+		for _, elem := range v {
+			if err := writeMsgpack(buffer, elem); err != nil {
+				return err
+			}
+		}
+	case *object:
+		writeMsgpackLength(buffer, len(v.keys), 0x80, 15, [3]byte{0, 0xde, 0xdf})
+		for i, key := range v.keys {
+			writeMsgpack(buffer, key)
+			if err := writeMsgpack(buffer, v.values[i]); err != nil {
+				return err
+			}
+		}
+	default:
+		return errors.Errorf("codec: can't encode %T as msgpack", value)
+	}
+	return nil
+}
+
+func readMsgpack(r *reader) (interface{}, error) {
+	format, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case format <= 0x7f:
+		return int64(format), nil
+	case format >= 0xe0:
+		return int64(int8(format)), nil
+	case format&0xe0 == 0xa0:
+		return readMsgpackString(r, uint64(format&0x1f))
+	case format&0xf0 == 0x90:
+		return readMsgpackArray(r, uint64(format&0x0f))
+	case format&0xf0 == 0x80:
+		return readMsgpackMap(r, uint64(format&0x0f))
+	}
+
+	switch format {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, err := r.uint(1 << (format - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		if n > math.MaxInt64 {
+			return n, nil
+		}
+		return int64(n), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (format - 0xd0)
+		n, err := r.uint(size)
+		if err != nil {
+			return nil, err
+		}
+		// sign extend the big endian value
+		shift := uint(64 - size*8)
+		return int64(n<<shift) >> shift, nil
+	case 0xcb:
+		bits, err := r.uint(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(bits), nil
+	case 0xd9, 0xda, 0xdb:
+		n, err := r.uint(1 << (format - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackString(r, n)
+	case 0xc4, 0xc5, 0xc6:
+		n, err := r.uint(1 << (format - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		data, err := r.bytes(n)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{}, data...), nil
+	case 0xdc, 0xdd:
+		n, err := r.uint(2 << (format - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackArray(r, n)
+	case 0xde, 0xdf:
+		n, err := r.uint(2 << (format - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackMap(r, n)
+	}
+	return nil, errors.Errorf("codec: unsupported msgpack format 0x%x", format)
+}
+
+func readMsgpackString(r *reader, n uint64) (interface{}, error) {
+	data, err := r.bytes(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func readMsgpackArray(r *reader, n uint64) (interface{}, error) {
+	if n > uint64(r.remaining()) {
+		return nil, errUnexpectedEnd
+	}
+	values := make([]interface{}, n)
+	for i := range values {
+		value, err := readMsgpack(r)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+func readMsgpackMap(r *reader, n uint64) (interface{}, error) {
+	if n > uint64(r.remaining()) {
+		return nil, errUnexpectedEnd
+	}
+	obj := make(map[string]interface{}, n)
+	for i := uint64(0); i < n; i++ {
+		key, err := readMsgpack(r)
+		if err != nil {
+			return nil, err
+		}
+		name, ok := key.(string)
+		if !ok {
+			return nil, errors.New("codec: msgpack map keys must be strings")
+		}
+		value, err := readMsgpack(r)
+		if err != nil {
+			return nil, err
+		}
+		obj[name] = value
+	}
+	return obj, nil
+}
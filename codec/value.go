@@ -0,0 +1,294 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package codec
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// object is an ordered map produced when encoding structs and maps so binary
+// formats are written deterministically
+type object struct {
+	keys   []string
+	values []interface{}
+}
+
+// toValue converts v into the generic data model shared by the binary codecs:
+// nil, bool, int64, uint64, float64, string, []byte, []interface{} and *object.
+// Structs are encoded using their json field tags.
+func toValue(v reflect.Value) (interface{}, error) {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return nil, nil
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return toValue(v.Elem())
+	case reflect.Bool:
+		return v.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return append([]byte{}, v.Bytes()...), nil
+		}
+		fallthrough
+	case reflect.Array:
+		values := make([]interface{}, v.Len())
+		for i := range values {
+			value, err := toValue(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return values, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, errors.New("codec: map keys must be strings")
+		}
+		obj := &object{}
+		for _, key := range v.MapKeys() {
+			obj.keys = append(obj.keys, key.String())
+		}
+		sort.Strings(obj.keys)
+		for _, key := range obj.keys {
+			value, err := toValue(v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key())))
+			if err != nil {
+				return nil, err
+			}
+			obj.values = append(obj.values, value)
+		}
+		return obj, nil
+	case reflect.Struct:
+		obj := &object{}
+		for _, field := range structFields(v.Type()) {
+			fieldValue := v.Field(field.index)
+			if field.omitEmpty && isEmptyValue(fieldValue) {
+				continue
+			}
+			value, err := toValue(fieldValue)
+			if err != nil {
+				return nil, err
+			}
+			obj.keys = append(obj.keys, field.name)
+			obj.values = append(obj.values, value)
+		}
+		return obj, nil
+	}
+	return nil, errors.New("codec: unsupported type " + v.Type().String())
+}
+
+// fromValue stores the generic value into v
+func fromValue(value interface{}, v reflect.Value) error {
+	if value == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		elem := reflect.New(v.Type().Elem())
+		if err := fromValue(value, elem.Elem()); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	case reflect.Interface:
+		v.Set(reflect.ValueOf(value))
+		return nil
+	case reflect.Bool:
+		b, ok := value.(bool)
+		if !ok {
+			return typeError(value, v)
+		}
+		v.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch n := value.(type) {
+		case int64:
+			v.SetInt(n)
+		case uint64:
+			v.SetInt(int64(n))
+		default:
+			return typeError(value, v)
+		}
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		switch n := value.(type) {
+		case int64:
+			v.SetUint(uint64(n))
+		case uint64:
+			v.SetUint(n)
+		default:
+			return typeError(value, v)
+		}
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, ok := value.(float64)
+		if !ok {
+			return typeError(value, v)
+		}
+		v.SetFloat(f)
+		return nil
+	case reflect.String:
+		s, ok := value.(string)
+		if !ok {
+			return typeError(value, v)
+		}
+		v.SetString(s)
+		return nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b, ok := value.([]byte)
+			if !ok {
+				return typeError(value, v)
+			}
+			v.SetBytes(append([]byte{}, b...))
+			return nil
+		}
+		values, ok := value.([]interface{})
+		if !ok {
+			return typeError(value, v)
+		}
+		slice := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := fromValue(value, slice.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	case reflect.Map:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return typeError(value, v)
+		}
+		if v.Type().Key().Kind() != reflect.String {
+			return errors.New("codec: map keys must be strings")
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		for key, value := range obj {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := fromValue(value, elem); err != nil {
+				return err
+			}
+			v.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), elem)
+		}
+		return nil
+	case reflect.Struct:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return typeError(value, v)
+		}
+		for _, field := range structFields(v.Type()) {
+			value, ok := obj[field.name]
+			if !ok {
+				continue
+			}
+			if err := fromValue(value, v.Field(field.index)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return errors.New("codec: unsupported type " + v.Type().String())
+}
+
+func typeError(value interface{}, v reflect.Value) error {
+	return errors.Errorf("codec: can't decode %T into %s", value, v.Type())
+}
+
+type field struct {
+	name      string
+	index     int
+	omitEmpty bool
+}
+
+// structFields returns the exported fields of t named by their json tags
+func structFields(t reflect.Type) []field {
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		structField := t.Field(i)
+		if structField.PkgPath != "" {
+			continue
+		}
+		tag := structField.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		options := strings.Split(tag, ",")
+		name := options[0]
+		if name == "" {
+			name = structField.Name
+		}
+		f := field{name: name, index: i}
+		for _, option := range options[1:] {
+			if option == "omitempty" {
+				f.omitEmpty = true
+			}
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+// decodeInto stores a decoded generic value into the value pointed to by v
+func decodeInto(value interface{}, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("codec: decode target must be a non-nil pointer")
+	}
+	return fromValue(value, rv.Elem())
+}
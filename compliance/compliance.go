@@ -0,0 +1,314 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+// Package compliance reports on the history a snapshot store keeps of a root
+// for audits: how completely snapshots cover the reporting period, when each
+// path was last verified in its approved state, and which drift from that
+// state is unresolved.
+package compliance
+
+import (
+	"bytes"
+	"sort"
+	"time"
+
+	"github.com/govice/golinks/blockmap"
+	"github.com/govice/golinks/policy"
+	"github.com/govice/golinks/snapshot"
+	"github.com/pkg/errors"
+)
+
+// ErrNoSnapshots is returned when the store has no snapshots in the period
+var ErrNoSnapshots = errors.New("compliance: no snapshots in the reporting period")
+
+// Status is the state of a path in the newest snapshot relative to the baseline
+type Status string
+
+// Path statuses
+const (
+	// Verified paths match the baseline
+	Verified Status = "verified"
+	// Modified paths differ from the baseline
+	Modified Status = "modified"
+	// Added paths aren't in the baseline
+	Added Status = "added"
+	// Removed paths are in the baseline but not the newest snapshot
+	Removed Status = "removed"
+)
+
+// Duration is a time.Duration encoded as text, such as "36h0m0s"
+type Duration time.Duration
+
+// MarshalText encodes the duration as its string
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText decodes a duration string
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	*d = Duration(parsed)
+	return err
+}
+
+// Coverage describes how completely snapshots cover the reporting period
+type Coverage struct {
+	Snapshots int       `json:"snapshots"`
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+	First     time.Time `json:"first"`
+	Last      time.Time `json:"last"`
+	// LargestGap is the longest time without a snapshot, including the time
+	// since the newest one
+	LargestGap Duration `json:"largestGap"`
+	// Interval is the expected time between snapshots. The period is split
+	// into intervals from From, and Percent of them hold a snapshot.
+	Interval        Duration `json:"interval,omitempty"`
+	Intervals       int      `json:"intervals,omitempty"`
+	MissedIntervals int      `json:"missedIntervals,omitempty"`
+	Percent         float64  `json:"percent"`
+	// Paths is the number of paths in the baseline or newest snapshot and
+	// VerifiedPaths the number verified within the maximum age
+	Paths         int     `json:"paths"`
+	VerifiedPaths int     `json:"verifiedPaths"`
+	PathPercent   float64 `json:"pathPercent"`
+}
+
+// Path is the history of one path over the reporting period. Times are zero
+// when the path never qualified.
+type Path struct {
+	Path   string `json:"path"`
+	Status Status `json:"status"`
+	// FirstSeen and LastSeen are the oldest and newest snapshots holding the path
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	// LastVerified is the newest snapshot in which the path matched the baseline
+	LastVerified time.Time `json:"lastVerified"`
+	// LastChanged is the snapshot in which the path's hash last changed
+	LastChanged time.Time `json:"lastChanged"`
+	// Stale is true if the path wasn't verified within the maximum age
+	Stale bool `json:"stale"`
+}
+
+// Report is a compliance report of a snapshot store
+type Report struct {
+	Generated time.Time `json:"generated"`
+	Store     string    `json:"store"`
+	// Baseline is the approved state, "snapshot <id>" or "link"
+	Baseline string   `json:"baseline"`
+	Coverage Coverage `json:"coverage"`
+	Paths    []Path   `json:"paths"`
+	// Outcome is the policy outcome of the drift from the baseline, and
+	// Unresolved the findings that didn't pass
+	Outcome    policy.Outcome   `json:"outcome"`
+	Unresolved []policy.Finding `json:"unresolved"`
+}
+
+type generator struct {
+	since    time.Time
+	interval time.Duration
+	maxAge   time.Duration
+	baseline *blockmap.BlockMap
+	policy   *policy.Policy
+	now      func() time.Time
+}
+
+// Option configures a report
+type Option func(*generator)
+
+// WithSince limits the reporting period to snapshots taken at or after t.
+// The period starts at the first snapshot by default.
+func WithSince(t time.Time) Option {
+	return func(g *generator) { g.since = t }
+}
+
+// WithInterval sets the expected time between snapshots, measuring coverage
+// as the share of intervals holding a snapshot
+func WithInterval(d time.Duration) Option {
+	return func(g *generator) { g.interval = d }
+}
+
+// WithMaxAge marks paths not verified for longer than d as stale. Any past
+// verification counts by default.
+func WithMaxAge(d time.Duration) Option {
+	return func(g *generator) { g.maxAge = d }
+}
+
+// WithBaseline sets the approved state paths are verified against. The
+// oldest snapshot of the period is the baseline by default.
+func WithBaseline(b *blockmap.BlockMap) Option {
+	return func(g *generator) { g.baseline = b }
+}
+
+// WithPolicy judges the drift of the newest snapshot from the baseline. Any
+// drift is unresolved by default.
+func WithPolicy(p *policy.Policy) Option {
+	return func(g *generator) { g.policy = p }
+}
+
+// Generate builds the compliance report of the snapshots in store
+func Generate(store *snapshot.Store, opts ...Option) (*Report, error) {
+	g := &generator{now: time.Now}
+	for _, opt := range opts {
+		opt(g)
+	}
+	if g.policy == nil {
+		g.policy = policy.NewPolicy()
+	}
+
+	all, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+	var snapshots []snapshot.Snapshot
+	for _, s := range all {
+		if !s.Time.Before(g.since) {
+			snapshots = append(snapshots, s)
+		}
+	}
+	if len(snapshots) == 0 {
+		return nil, ErrNoSnapshots
+	}
+
+	now := g.now().UTC()
+	r := &Report{Generated: now, Store: store.Dir(), Baseline: "link"}
+	baseline := g.baseline
+	if baseline == nil {
+		if baseline, err = store.Load(snapshots[0].ID); err != nil {
+			return nil, err
+		}
+		r.Baseline = "snapshot " + snapshots[0].ID
+	}
+
+	history := map[string]*Path{}
+	lastHash := map[string][]byte{}
+	var newest *blockmap.BlockMap
+	for _, s := range snapshots {
+		b, err := store.Load(s.ID)
+		if err != nil {
+			return nil, err
+		}
+		for path, hash := range b.Archive {
+			p := history[path]
+			if p == nil {
+				p = &Path{Path: path, FirstSeen: s.Time}
+				history[path] = p
+			}
+			p.LastSeen = s.Time
+			if baselineHash, ok := baseline.Archive[path]; ok && bytes.Equal(hash, baselineHash) {
+				p.LastVerified = s.Time
+			}
+			if prev, ok := lastHash[path]; !ok || !bytes.Equal(prev, hash) {
+				p.LastChanged = s.Time
+			}
+			lastHash[path] = hash
+		}
+		newest = b
+	}
+
+	//The report covers the paths of the baseline and the newest snapshot
+	for path := range baseline.Archive {
+		if history[path] == nil {
+			history[path] = &Path{Path: path}
+		}
+	}
+	for path, p := range history {
+		_, inBaseline := baseline.Archive[path]
+		hash, inNewest := newest.Archive[path]
+		switch {
+		case !inBaseline && !inNewest:
+			delete(history, path)
+			continue
+		case !inNewest:
+			p.Status = Removed
+		case !inBaseline:
+			p.Status = Added
+		case bytes.Equal(hash, baseline.Archive[path]):
+			p.Status = Verified
+		default:
+			p.Status = Modified
+		}
+		p.Stale = p.LastVerified.IsZero() || g.maxAge > 0 && now.Sub(p.LastVerified) > g.maxAge
+		r.Paths = append(r.Paths, *p)
+	}
+	sort.Slice(r.Paths, func(i, j int) bool { return r.Paths[i].Path < r.Paths[j].Path })
+
+	r.Coverage = g.coverage(snapshots, r.Paths, now)
+
+	result := g.policy.Evaluate(blockmap.Diff(baseline, newest))
+	r.Outcome = result.Outcome
+	r.Unresolved = []policy.Finding{}
+	for _, f := range result.Findings {
+		if f.Outcome != policy.Pass {
+			r.Unresolved = append(r.Unresolved, f)
+		}
+	}
+	return r, nil
+}
+
+func (g *generator) coverage(snapshots []snapshot.Snapshot, paths []Path, now time.Time) Coverage {
+	c := Coverage{
+		Snapshots: len(snapshots),
+		From:      g.since,
+		To:        now,
+		First:     snapshots[0].Time,
+		Last:      snapshots[len(snapshots)-1].Time,
+		Interval:  Duration(g.interval),
+		Percent:   100,
+	}
+	if c.From.IsZero() {
+		c.From = c.First
+	}
+
+	prev := c.From
+	for _, s := range append(snapshots, snapshot.Snapshot{Time: now}) {
+		if gap := Duration(s.Time.Sub(prev)); gap > c.LargestGap {
+			c.LargestGap = gap
+		}
+		prev = s.Time
+	}
+
+	if g.interval > 0 {
+		c.Intervals = int((now.Sub(c.From) + g.interval - 1) / g.interval)
+		if c.Intervals == 0 {
+			c.Intervals = 1
+		}
+		covered := map[int]bool{}
+		for _, s := range snapshots {
+			if i := int(s.Time.Sub(c.From) / g.interval); i < c.Intervals {
+				covered[i] = true
+			}
+		}
+		c.MissedIntervals = c.Intervals - len(covered)
+		c.Percent = percent(len(covered), c.Intervals)
+	}
+
+	c.Paths = len(paths)
+	for _, p := range paths {
+		if !p.Stale {
+			c.VerifiedPaths++
+		}
+	}
+	c.PathPercent = percent(c.VerifiedPaths, c.Paths)
+	return c
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return float64(n) * 100 / float64(total)
+}
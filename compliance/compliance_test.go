@@ -0,0 +1,135 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package compliance
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/govice/golinks/blockmap"
+	"github.com/govice/golinks/codec"
+	"github.com/govice/golinks/policy"
+	"github.com/govice/golinks/snapshot"
+)
+
+func TestGenerate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compliance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := snapshot.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	for _, s := range []struct {
+		at    time.Duration
+		files map[string]string
+	}{
+		{0, map[string]string{"a": "1", "b": "1"}},
+		{day, map[string]string{"a": "2", "b": "1", "c": "1"}},
+		{3 * day, map[string]string{"a": "2", "c": "1"}},
+	} {
+		b := blockmap.New("")
+		for name, content := range s.files {
+			b.Archive[name] = []byte(content)
+		}
+		b.RootHash = []byte("root")
+		//Snapshots are named by the time they were taken
+		if err := b.SaveCodec(dir, start.Add(s.at).Format("20060102T150405.000000000Z"), codec.JSON); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := policy.NewPolicy()
+	if err := p.Allow("c"); err != nil {
+		t.Fatal(err)
+	}
+	r, err := Generate(store, WithInterval(day), WithMaxAge(80*time.Hour), WithPolicy(p), func(g *generator) {
+		g.now = func() time.Time { return start.Add(4 * day) }
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := r.Coverage
+	if c.Snapshots != 3 || c.Intervals != 4 || c.MissedIntervals != 1 || c.Percent != 75 {
+		t.Errorf("unexpected interval coverage %+v", c)
+	}
+	if time.Duration(c.LargestGap) != 2*day {
+		t.Error("unexpected largest gap", time.Duration(c.LargestGap))
+	}
+	if c.Paths != 3 || c.VerifiedPaths != 1 {
+		t.Errorf("unexpected path coverage %+v", c)
+	}
+
+	expected := map[string]Path{
+		"a": {Status: Modified, LastVerified: start, LastChanged: start.Add(day), Stale: true},
+		"b": {Status: Removed, LastVerified: start.Add(day), LastChanged: start, LastSeen: start.Add(day)},
+		"c": {Status: Added, LastChanged: start.Add(day), Stale: true},
+	}
+	if len(r.Paths) != len(expected) {
+		t.Fatalf("unexpected paths %+v", r.Paths)
+	}
+	for _, p := range r.Paths {
+		e := expected[p.Path]
+		if p.Status != e.Status || !p.LastVerified.Equal(e.LastVerified) || !p.LastChanged.Equal(e.LastChanged) || p.Stale != e.Stale {
+			t.Errorf("unexpected history of %s: %+v", p.Path, p)
+		}
+		if !e.LastSeen.IsZero() && !p.LastSeen.Equal(e.LastSeen) {
+			t.Errorf("unexpected last seen time of %s: %v", p.Path, p.LastSeen)
+		}
+	}
+
+	if r.Outcome != policy.Fail || len(r.Unresolved) != 2 {
+		t.Errorf("expected a and b to be unresolved, got %v %+v", r.Outcome, r.Unresolved)
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, r, FormatCSV); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 || rows[1][0] != "a" || rows[1][7] != "fail" || rows[3][7] != "" {
+		t.Errorf("unexpected csv %v", rows)
+	}
+	buf.Reset()
+	if err := Write(&buf, r, FormatHTML); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "<td>modified</td>") {
+		t.Error("html report misses path status")
+	}
+	if err := Write(&buf, r, "pdf"); err == nil {
+		t.Error("expected unknown format error")
+	}
+
+	if _, err := Generate(store, WithSince(start.Add(5*day))); err != ErrNoSnapshots {
+		t.Error("expected no snapshots error, got", err)
+	}
+}
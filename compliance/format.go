@@ -0,0 +1,153 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package compliance
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"html/template"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/govice/golinks/policy"
+	"github.com/pkg/errors"
+)
+
+// Report formats
+const (
+	FormatJSON = "json"
+	FormatCSV  = "csv"
+	FormatHTML = "html"
+)
+
+// ErrFormat is returned for unknown report formats
+var ErrFormat = errors.New("compliance: unknown report format")
+
+// Write writes the report to w as JSON, as CSV with one row per path, or as a
+// standalone HTML page
+func Write(w io.Writer, r *Report, format string) error {
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r)
+	case FormatCSV:
+		return writeCSV(w, r)
+	case FormatHTML:
+		return errors.Wrap(htmlReport.Execute(w, r), "compliance: failed to write report")
+	default:
+		return errors.Wrap(ErrFormat, format)
+	}
+}
+
+// findings returns the unresolved finding of each path
+func (r *Report) findings() map[string]policy.Finding {
+	findings := make(map[string]policy.Finding, len(r.Unresolved))
+	for _, f := range r.Unresolved {
+		findings[f.Path] = f
+	}
+	return findings
+}
+
+func writeCSV(w io.Writer, r *Report) error {
+	findings := r.findings()
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"path", "status", "firstSeen", "lastSeen", "lastVerified", "lastChanged", "stale", "outcome", "reason"})
+	for _, p := range r.Paths {
+		outcome, reason := "", ""
+		if f, ok := findings[p.Path]; ok {
+			outcome, reason = f.Outcome.String(), f.Reason
+		}
+		writer.Write([]string{
+			p.Path,
+			string(p.Status),
+			formatTime(p.FirstSeen),
+			formatTime(p.LastSeen),
+			formatTime(p.LastVerified),
+			formatTime(p.LastChanged),
+			strconv.FormatBool(p.Stale),
+			outcome,
+			reason,
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// formatTime formats t as RFC 3339, or empty if zero
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+var htmlReport = template.Must(template.New("report").Funcs(template.FuncMap{
+	"time": formatTime,
+	"percent": func(f float64) string {
+		return strconv.FormatFloat(f, 'f', 1, 64) + "%"
+	},
+	"duration": func(d Duration) string {
+		return time.Duration(d).String()
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>golinks compliance report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+.fail { color: #b00; } .warn { color: #a60; } .stale { background: #fee; }
+</style>
+</head>
+<body>
+<h1>Compliance report</h1>
+<p>Generated {{time .Generated}} for {{.Store}} against the {{.Baseline}} baseline.</p>
+<h2>Coverage</h2>
+<table>
+<tr><th>Period</th><td>{{time .Coverage.From}} to {{time .Coverage.To}}</td></tr>
+<tr><th>Snapshots</th><td>{{.Coverage.Snapshots}}, {{time .Coverage.First}} to {{time .Coverage.Last}}</td></tr>
+<tr><th>Largest gap</th><td>{{duration .Coverage.LargestGap}}</td></tr>
+{{- if .Coverage.Interval}}
+<tr><th>Intervals covered</th><td>{{percent .Coverage.Percent}}, {{.Coverage.MissedIntervals}} of {{.Coverage.Intervals}} {{duration .Coverage.Interval}} intervals missed</td></tr>
+{{- end}}
+<tr><th>Paths verified</th><td>{{percent .Coverage.PathPercent}}, {{.Coverage.VerifiedPaths}} of {{.Coverage.Paths}}</td></tr>
+</table>
+<h2>Unresolved drift: <span class="{{.Outcome}}">{{.Outcome}}</span></h2>
+{{- if .Unresolved}}
+<table>
+<tr><th>Path</th><th>Change</th><th>Outcome</th><th>Reason</th></tr>
+{{- range .Unresolved}}
+<tr><td>{{.Path}}</td><td>{{.Change}}</td><td class="{{.Outcome}}">{{.Outcome}}</td><td>{{.Reason}}</td></tr>
+{{- end}}
+</table>
+{{- else}}
+<p>None.</p>
+{{- end}}
+<h2>Paths</h2>
+<table>
+<tr><th>Path</th><th>Status</th><th>First seen</th><th>Last seen</th><th>Last verified</th><th>Last changed</th></tr>
+{{- range .Paths}}
+<tr{{if .Stale}} class="stale"{{end}}><td>{{.Path}}</td><td>{{.Status}}</td><td>{{time .FirstSeen}}</td><td>{{time .LastSeen}}</td><td>{{time .LastVerified}}</td><td>{{time .LastChanged}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
@@ -0,0 +1,169 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+// Package events publishes integrity events, verification results and
+// detected drift, to dashboards and SIEMs subscribed over Server-Sent Events
+// or WebSocket.
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/govice/golinks/auth"
+	"github.com/govice/golinks/blockmap"
+)
+
+// Event types
+const (
+	// TypeVerification is published for every verification with its result
+	TypeVerification = "verification"
+	// TypeDrift is published when a monitored root drifts from its baseline
+	TypeDrift = "drift"
+)
+
+// Defaults for brokers
+const (
+	DefaultHistory = 256
+	// subscriberBuffer bounds the events queued for a subscriber. Subscribers
+	// falling further behind are disconnected so they can resume from the
+	// history with Last-Event-ID rather than silently missing events.
+	subscriberBuffer = 64
+)
+
+// Event is an integrity change. IDs increase by one for each event published
+// by a broker, so subscribers can detect gaps and resume after reconnecting.
+type Event struct {
+	ID        uint64                       `json:"id"`
+	Type      string                       `json:"type"`
+	Time      time.Time                    `json:"time"`
+	Namespace string                       `json:"namespace,omitempty"`
+	Root      string                       `json:"root"`
+	Valid     bool                         `json:"valid"`
+	Error     string                       `json:"error,omitempty"`
+	Report    *blockmap.VerificationReport `json:"report,omitempty"`
+}
+
+// Broker fans published events out to subscribers and keeps recent events
+// for subscribers resuming after a disconnect
+type Broker struct {
+	mu          sync.Mutex
+	lastID      uint64
+	history     []Event
+	size        int
+	subscribers map[*subscription]struct{}
+	now         func() time.Time
+	policy      *auth.Policy
+	origins     []string
+}
+
+type subscription struct {
+	ch    chan Event
+	types map[string]bool
+}
+
+// NewBroker returns a broker keeping the last history events
+func NewBroker(history int) *Broker {
+	return &Broker{
+		size:        history,
+		subscribers: make(map[*subscription]struct{}),
+		now:         time.Now,
+	}
+}
+
+// Publish assigns event the next ID, and the current time when it has none,
+// and delivers it to subscribers
+func (b *Broker) Publish(event Event) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastID++
+	event.ID = b.lastID
+	if event.Time.IsZero() {
+		event.Time = b.now().UTC()
+	}
+	if b.size > 0 {
+		if len(b.history) == b.size {
+			b.history = append(b.history[:0], b.history[1:]...)
+		}
+		b.history = append(b.history, event)
+	}
+	for sub := range b.subscribers {
+		if !sub.wants(event) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			delete(b.subscribers, sub)
+			close(sub.ch)
+		}
+	}
+	return event
+}
+
+// Since returns the kept events published after the event with ID id
+func (b *Broker) Since(id uint64) []Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var since []Event
+	for _, event := range b.history {
+		if event.ID > id {
+			since = append(since, event)
+		}
+	}
+	return since
+}
+
+// subscribe returns a subscription receiving events of types, or every
+// event without types, starting with the kept events after lastID. The
+// subscription's channel is closed when it falls behind.
+func (b *Broker) subscribe(lastID uint64, types []string) *subscription {
+	sub := &subscription{}
+	if len(types) > 0 {
+		sub.types = make(map[string]bool)
+		for _, t := range types {
+			sub.types[t] = true
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var replay []Event
+	for _, event := range b.history {
+		if event.ID > lastID && sub.wants(event) {
+			replay = append(replay, event)
+		}
+	}
+	sub.ch = make(chan Event, len(replay)+subscriberBuffer)
+	for _, event := range replay {
+		sub.ch <- event
+	}
+	b.subscribers[sub] = struct{}{}
+	return sub
+}
+
+func (b *Broker) unsubscribe(sub *subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subscribers[sub]; ok {
+		delete(b.subscribers, sub)
+		close(sub.ch)
+	}
+}
+
+func (s *subscription) wants(event Event) bool {
+	return s.types == nil || s.types[event.Type]
+}
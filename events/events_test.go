@@ -0,0 +1,212 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/govice/golinks/auth"
+)
+
+func TestBroker(t *testing.T) {
+	b := NewBroker(2)
+	for _, t := range []string{TypeVerification, TypeDrift, TypeVerification} {
+		b.Publish(Event{Type: t})
+	}
+	since := b.Since(0)
+	if len(since) != 2 || since[0].ID != 2 || since[1].ID != 3 || since[0].Time.IsZero() {
+		t.Fatalf("expected the last 2 events, got %+v", since)
+	}
+
+	//Subscribers resume from the history, filtered by type
+	sub := b.subscribe(1, []string{TypeDrift})
+	if event := <-sub.ch; event.ID != 2 {
+		t.Error("expected the kept drift event, got", event)
+	}
+	b.Publish(Event{Type: TypeVerification})
+	b.Publish(Event{Type: TypeDrift})
+	if event := <-sub.ch; event.ID != 5 {
+		t.Error("expected the new drift event, got", event)
+	}
+
+	//Subscribers falling behind are disconnected
+	for i := 0; i < 2*subscriberBuffer; i++ {
+		b.Publish(Event{Type: TypeDrift})
+	}
+	for range sub.ch {
+	}
+	b.unsubscribe(sub)
+	if len(b.subscribers) != 0 {
+		t.Error("expected the slow subscriber to be removed")
+	}
+}
+
+func TestBroker_SSE(t *testing.T) {
+	b := NewBroker(DefaultHistory)
+	b.Publish(Event{Type: TypeVerification, Root: "/old"})
+	srv := httptest.NewServer(b)
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"?type=drift", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Last-Event-ID", "0")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatal("unexpected content type", resp.Header.Get("Content-Type"))
+	}
+	b.Publish(Event{Type: TypeVerification, Root: "/data"})
+	b.Publish(Event{Type: TypeDrift, Root: "/data"})
+
+	reader := bufio.NewReader(resp.Body)
+	var lines []string
+	for len(lines) < 3 {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+	if lines[0] != "id: 3" || lines[1] != "event: drift" {
+		t.Fatalf("unexpected event %q", lines)
+	}
+	event := &Event{}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(lines[2], "data: ")), event); err != nil {
+		t.Fatal(err)
+	}
+	if event.ID != 3 || event.Root != "/data" {
+		t.Errorf("unexpected event %+v", event)
+	}
+}
+
+func TestBroker_WebSocket(t *testing.T) {
+	b := NewBroker(DefaultHistory)
+	b.Publish(Event{Type: TypeDrift, Root: "/data"})
+	srv := httptest.NewServer(b)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	key := "dGhlIHNhbXBsZSBub25jZQ=="
+	conn.Write([]byte("GET /?lastEventId=0 HTTP/1.1\r\nHost: golinks\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n" +
+		"Sec-WebSocket-Key: " + key + "\r\nSec-WebSocket-Version: 13\r\n\r\n"))
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("unexpected handshake %v %v", resp.Status, resp.Header)
+	}
+
+	opcode, payload, err := readFrame(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := &Event{}
+	if err := json.Unmarshal(payload, event); opcode != opText || err != nil || event.Root != "/data" {
+		t.Fatalf("unexpected frame %x %s %v", opcode, payload, err)
+	}
+
+	//Masked pings are answered
+	mask := []byte{1, 2, 3, 4}
+	ping := []byte("hi")
+	frame := []byte{0x80 | opPing, 0x80 | byte(len(ping))}
+	frame = append(frame, mask...)
+	for i, c := range ping {
+		frame = append(frame, c^mask[i%4])
+	}
+	conn.Write(frame)
+	if opcode, payload, err := readFrame(reader); err != nil || opcode != opPong || string(payload) != "hi" {
+		t.Errorf("expected a pong, got %x %q %v", opcode, payload, err)
+	}
+
+	//Browsers on other sites can't subscribe
+	b.SetAllowedOrigins("https://dashboard.example.com")
+	host := strings.TrimPrefix(srv.URL, "http://")
+	for origin, code := range map[string]int{
+		"https://evil.example.com":      http.StatusForbidden,
+		"https://dashboard.example.com": http.StatusSwitchingProtocols,
+		"http://" + host:                http.StatusSwitchingProtocols,
+	} {
+		req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Upgrade", "websocket")
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Sec-WebSocket-Key", key)
+		req.Header.Set("Sec-WebSocket-Version", "13")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != code {
+			t.Errorf("%s: expected %d, got %d", origin, code, resp.StatusCode)
+		}
+	}
+}
+
+func TestBroker_Policy(t *testing.T) {
+	b := NewBroker(DefaultHistory)
+	policy := auth.NewPolicy()
+	policy.AddToken("dashboard", "dashboard-token", auth.Read)
+	b.SetPolicy(policy)
+	srv := httptest.NewServer(b)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Error("expected unauthorized, got", resp.Status)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer dashboard-token")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Error("expected the subscription to be accepted, got", resp.Status)
+	}
+}
@@ -0,0 +1,163 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package events
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/govice/golinks/auth"
+	"github.com/pkg/errors"
+)
+
+// KeepAlive is the interval between comments sent to idle Server-Sent Events
+// subscribers so proxies keep their connections open
+const KeepAlive = 30 * time.Second
+
+// SetPolicy requires subscribers to hold the read role in p. A nil policy
+// accepts every subscriber.
+func (b *Broker) SetPolicy(p *auth.Policy) {
+	b.policy = p
+}
+
+// SetAllowedOrigins sets the origins, such as https://dashboard.example.com,
+// allowed to open WebSocket subscriptions besides the origin of the events
+// endpoint itself. Browsers send credentials like client certificates and
+// cookies with WebSocket handshakes from any page, so handshakes from other
+// origins are refused to stop other sites reading the stream.
+func (b *Broker) SetAllowedOrigins(origins ...string) {
+	b.origins = origins
+}
+
+// allowedOrigin reports whether a WebSocket handshake may come from the
+// request's Origin. Requests without one aren't made by browsers.
+func (b *Broker) allowedOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range b.origins {
+		if strings.EqualFold(origin, allowed) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// ServeHTTP streams events to a subscriber over WebSocket when the request
+// asks to upgrade, and as Server-Sent Events otherwise. The type query
+// parameter, repeated or comma separated, selects the event types sent.
+// Subscribers resume after the event in the Last-Event-ID header, or the
+// lastEventId query parameter for clients that can't set headers.
+func (b *Broker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if b.policy != nil {
+		var chains [][]*x509.Certificate
+		if r.TLS != nil {
+			chains = r.TLS.VerifiedChains
+		}
+		_, err := b.policy.Authorize(auth.BearerToken(r.Header.Get("Authorization")), chains, auth.Read)
+		if errors.Cause(err) == auth.ErrForbidden {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("lastEventId")
+	}
+	var after uint64
+	if lastID != "" {
+		var err error
+		if after, err = strconv.ParseUint(lastID, 10, 64); err != nil {
+			http.Error(w, "invalid last event ID", http.StatusBadRequest)
+			return
+		}
+	}
+	var types []string
+	for _, value := range r.URL.Query()["type"] {
+		for _, t := range strings.Split(value, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				types = append(types, t)
+			}
+		}
+	}
+
+	if isWebSocket(r) {
+		if !b.allowedOrigin(r) {
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+		b.serveWebSocket(w, r, after, types)
+		return
+	}
+	b.serveSSE(w, r, after, types)
+}
+
+// serveSSE streams events as Server-Sent Events until the subscriber
+// disconnects or falls behind
+func (b *Broker) serveSSE(w http.ResponseWriter, r *http.Request, after uint64, types []string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	sub := b.subscribe(after, types)
+	defer b.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	keepAlive := time.NewTicker(KeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := w.Write([]byte(": keep-alive\n\n")); err != nil {
+				return
+			}
+		case event, ok := <-sub.ch:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				return
+			}
+			if _, err := w.Write([]byte("id: " + strconv.FormatUint(event.ID, 10) + "\nevent: " + event.Type + "\ndata: " + string(data) + "\n\n")); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
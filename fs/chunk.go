@@ -0,0 +1,219 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package fs
+
+import (
+	"hash"
+	"io"
+	iofs "io/fs"
+	"math/bits"
+	"os"
+)
+
+// Chunk is a hashed region of a file
+type Chunk struct {
+	Offset int64
+	Size   int64
+	Hash   []byte
+}
+
+// Splitter finds chunk boundaries in a stream
+type Splitter interface {
+	// MaxSize is the largest chunk the splitter returns
+	MaxSize() int
+	// Split returns the length of the first chunk in data. data holds at
+	// least MaxSize bytes unless the end of the stream has been reached.
+	Split(data []byte) int
+}
+
+// fixedSplitter cuts chunks of a fixed size
+type fixedSplitter int
+
+// NewFixedSplitter returns a Splitter cutting chunks of size bytes
+func NewFixedSplitter(size int) Splitter {
+	if size < 1 {
+		size = DefaultBufferSize
+	}
+	return fixedSplitter(size)
+}
+
+func (s fixedSplitter) MaxSize() int { return int(s) }
+
+func (s fixedSplitter) Split(data []byte) int {
+	if len(data) < int(s) {
+		return len(data)
+	}
+	return int(s)
+}
+
+// cdcSplitter implements FastCDC content defined chunking with normalized
+// chunk sizes. Boundaries depend only on content so an insertion only
+// changes the chunks around it.
+type cdcSplitter struct {
+	min, avg, max int
+	maskS, maskL  uint64
+}
+
+// NewCDCSplitter returns a FastCDC Splitter with chunks averaging roughly
+// avgSize bytes, rounded to a power of two, between avgSize/4 and avgSize*8
+func NewCDCSplitter(avgSize int) Splitter {
+	if avgSize < 64 {
+		avgSize = 64
+	}
+	avgBits := bits.Len(uint(avgSize)) - 1
+	avg := 1 << uint(avgBits)
+	return &cdcSplitter{
+		min: avg / 4,
+		avg: avg,
+		max: avg * 8,
+		//Stricter mask below the average size, looser above it
+		maskS: ^uint64(0) << uint(64-(avgBits+1)),
+		maskL: ^uint64(0) << uint(64-(avgBits-1)),
+	}
+}
+
+func (s *cdcSplitter) MaxSize() int { return s.max }
+
+func (s *cdcSplitter) Split(data []byte) int {
+	n := len(data)
+	if n <= s.min {
+		return n
+	}
+	if n > s.max {
+		n = s.max
+	}
+	normal := s.avg
+	if normal > n {
+		normal = n
+	}
+
+	var fp uint64
+	i := s.min
+	for ; i < normal; i++ {
+		fp = (fp << 1) + gear[data[i]]
+		if fp&s.maskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		fp = (fp << 1) + gear[data[i]]
+		if fp&s.maskL == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
+
+// gear holds the random values of the FastCDC rolling hash. The table is
+// derived from a fixed seed and must never change or recorded chunk
+// boundaries would no longer reproduce.
+var gear = func() (table [256]uint64) {
+	//splitmix64
+	state := uint64(0x676f6c696e6b7321)
+	for i := range table {
+		state += 0x9e3779b97f4a7c15
+		z := state
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+// HashChunks streams r returning the digest of the whole stream along with
+// the digest of every chunk cut by s
+func (h *Hasher) HashChunks(r io.Reader, s Splitter) ([]byte, []Chunk, error) {
+	r = h.Limiter.Reader(r)
+	whole, chunk := h.getHash(), h.getHash()
+	defer h.putHash(whole)
+	defer h.putHash(chunk)
+	buffer := make([]byte, s.MaxSize())
+	var (
+		chunks []Chunk
+		offset int64
+		filled int
+		eof    bool
+	)
+	for {
+		if !eof && filled < len(buffer) {
+			n, err := io.ReadFull(r, buffer[filled:])
+			filled += n
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				eof = true
+			} else if err != nil {
+				return nil, nil, err
+			}
+		}
+		if filled == 0 {
+			break
+		}
+
+		size := s.Split(buffer[:filled])
+		whole.Write(buffer[:size])
+		chunks = append(chunks, Chunk{
+			Offset: offset,
+			Size:   int64(size),
+			Hash:   sumChunk(chunk, buffer[:size]),
+		})
+		offset += int64(size)
+		filled = copy(buffer, buffer[size:filled])
+	}
+	return whole.Sum(nil), chunks, nil
+}
+
+func sumChunk(h hash.Hash, data []byte) []byte {
+	h.Reset()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// HashFileChunks hashes the file at path and its chunks cut by s
+func (h *Hasher) HashFileChunks(path string, s Splitter) ([]byte, []Chunk, error) {
+	if path == "" {
+		return nil, nil, ErrNullPath
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, &FsErr{Path: path, Err: err}
+	}
+	defer file.Close()
+
+	adviseSequential(file)
+	fileHash, chunks, err := h.HashChunks(openContent(file), s)
+	if err != nil {
+		return nil, nil, &FsErr{Path: path, Err: err}
+	}
+	return fileHash, chunks, nil
+}
+
+// HashFSChunks hashes the named file in fsys and its chunks cut by s
+func (h *Hasher) HashFSChunks(fsys iofs.FS, name string, s Splitter) ([]byte, []Chunk, error) {
+	if name == "" {
+		return nil, nil, ErrNullPath
+	}
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, nil, &FsErr{Path: name, Err: err}
+	}
+	defer file.Close()
+
+	fileHash, chunks, err := h.HashChunks(file, s)
+	if err != nil {
+		return nil, nil, &FsErr{Path: name, Err: err}
+	}
+	return fileHash, chunks, nil
+}
@@ -0,0 +1,90 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package fs
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"math/rand"
+	"testing"
+)
+
+func TestHasher_HashChunks(t *testing.T) {
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+	expected := sha512.Sum512(data)
+	h := NewHasher(0)
+
+	whole, chunks, err := h.HashChunks(bytes.NewReader(data), NewFixedSplitter(300000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(whole, expected[:]) {
+		t.Error("chunked hash does not match whole file hash")
+	}
+	if len(chunks) != 4 || chunks[3].Offset != 900000 || chunks[3].Size != int64(len(data))-900000 {
+		t.Errorf("unexpected fixed chunks %+v", chunks)
+	}
+	last := sha512.Sum512(data[900000:])
+	if !bytes.Equal(chunks[3].Hash, last[:]) {
+		t.Error("unexpected chunk hash")
+	}
+
+	splitter := NewCDCSplitter(8 * 1024)
+	whole, chunks, err = h.HashChunks(bytes.NewReader(data), splitter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(whole, expected[:]) {
+		t.Error("chunked hash does not match whole file hash")
+	}
+	var offset int64
+	for i, chunk := range chunks {
+		if chunk.Offset != offset || chunk.Size > int64(splitter.MaxSize()) ||
+			(i < len(chunks)-1 && chunk.Size < 2*1024) {
+			t.Fatalf("unexpected chunk %d %+v", i, chunk)
+		}
+		offset += chunk.Size
+	}
+	if offset != int64(len(data)) {
+		t.Error("chunks do not cover the stream")
+	}
+
+	//Content defined boundaries resynchronise after an insertion
+	modified := append(append(append([]byte{}, data[:500000]...), []byte("inserted")...), data[500000:]...)
+	_, modifiedChunks, err := h.HashChunks(bytes.NewReader(modified), splitter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	known := make(map[string]bool)
+	for _, chunk := range chunks {
+		known[string(chunk.Hash)] = true
+	}
+	changed := 0
+	for _, chunk := range modifiedChunks {
+		if !known[string(chunk.Hash)] {
+			changed++
+		}
+	}
+	if changed == 0 || changed > 2 {
+		t.Errorf("expected an insertion to change 1-2 chunks, changed %d of %d", changed, len(modifiedChunks))
+	}
+
+	if _, chunks, err = h.HashChunks(bytes.NewReader(nil), splitter); err != nil || len(chunks) != 0 {
+		t.Errorf("expected no chunks for empty stream, got %v %v", chunks, err)
+	}
+}
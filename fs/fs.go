@@ -18,8 +18,10 @@ package fs
 
 import (
 	"crypto/sha512"
-	"io/ioutil"
+	"hash"
+	iofs "io/fs"
 	"os"
+	"sync"
 
 	"github.com/govice/golinks/walker"
 
@@ -49,29 +51,185 @@ func (fe *FsErr) Error() string {
 //ErrNullPath is returned when fs is given an empty path string
 var ErrNullPath = errors.New("fs: failed to hash null path")
 
+// DefaultBufferSize is the size of the buffer used to stream files through a hash
+const DefaultBufferSize int = 32 * 1024
+
 //HashFile returns a sha512 hash of the file at the provided path
 func HashFile(path string) ([]byte, error) {
+	return NewHasher(DefaultBufferSize).HashFile(path)
+}
+
+// HashReader streams r through h and returns the resulting digest
+func HashReader(r io.Reader, h hash.Hash) ([]byte, error) {
+	return (&Hasher{BufferSize: DefaultBufferSize, New: func() hash.Hash { return h }}).HashReader(r)
+}
+
+// chunkReader hides any io.WriterTo implementation so reads use the hasher's buffer
+type chunkReader struct {
+	io.Reader
+}
+
+// HashFS returns a sha512 hash of the named file in fsys
+func HashFS(fsys iofs.FS, name string) ([]byte, error) {
+	return NewHasher(DefaultBufferSize).HashFS(fsys, name)
+}
+
+// Hasher streams content through a hash in chunks of BufferSize bytes so
+// large files and streams are hashed without being read into memory.
+//
+// A Hasher is safe for concurrent use. Read buffers and hash states are
+// pooled and reused across digests, so hashing many files with one Hasher
+// allocates little more than each digest. New must not be changed once the
+// Hasher is in use.
+type Hasher struct {
+	// BufferSize is the number of bytes read per chunk
+	BufferSize int
+	// New returns the hash used for each digest, sha512 by default
+	New func() hash.Hash
+	// Limiter caps the rate content is read when set
+	Limiter *RateLimiter
+	// MmapThreshold memory maps files of at least this many bytes rather
+	// than reading them, avoiding a copy through the read buffer. Files are
+	// read when mapping isn't supported or fails. Zero always reads files.
+	MmapThreshold int64
+
+	hashes  sync.Pool
+	buffers sync.Pool
+}
+
+// defaultBuffers holds DefaultBufferSize read buffers shared by every Hasher
+var defaultBuffers = sync.Pool{New: func() interface{} {
+	buffer := make([]byte, DefaultBufferSize)
+	return &buffer
+}}
+
+// NewHasher returns a sha512 Hasher reading chunks of bufferSize bytes.
+// A bufferSize less than 1 uses DefaultBufferSize.
+func NewHasher(bufferSize int) *Hasher {
+	if bufferSize < 1 {
+		bufferSize = DefaultBufferSize
+	}
+	return &Hasher{
+		BufferSize: bufferSize,
+		New:        sha512.New,
+	}
+}
+
+// HashReader streams r through a new hash and returns the resulting digest
+func (h *Hasher) HashReader(r io.Reader) ([]byte, error) {
+	return h.HashReaderBuffer(r, nil)
+}
+
+// HashReaderBuffer is HashReader reading through buffer, for callers keeping
+// their own buffer per worker. A nil buffer uses a pooled buffer of BufferSize.
+func (h *Hasher) HashReaderBuffer(r io.Reader, buffer []byte) ([]byte, error) {
+	if buffer == nil {
+		pooled := h.getBuffer()
+		defer h.putBuffer(pooled)
+		buffer = *pooled
+	}
+
+	digest := h.getHash()
+	defer h.putHash(digest)
+	if _, err := io.CopyBuffer(digest, chunkReader{h.Limiter.Reader(r)}, buffer); err != nil {
+		return nil, err
+	}
+	return digest.Sum(nil), nil
+}
+
+// getHash returns a reset hash from the pool
+func (h *Hasher) getHash() hash.Hash {
+	if digest, ok := h.hashes.Get().(hash.Hash); ok {
+		digest.Reset()
+		return digest
+	}
+	if h.New == nil {
+		return sha512.New()
+	}
+	return h.New()
+}
+
+func (h *Hasher) putHash(digest hash.Hash) {
+	h.hashes.Put(digest)
+}
+
+// getBuffer returns a read buffer of BufferSize bytes from the pool
+func (h *Hasher) getBuffer() *[]byte {
+	if h.BufferSize < 1 || h.BufferSize == DefaultBufferSize {
+		return defaultBuffers.Get().(*[]byte)
+	}
+	if buffer, ok := h.buffers.Get().(*[]byte); ok && len(*buffer) == h.BufferSize {
+		return buffer
+	}
+	buffer := make([]byte, h.BufferSize)
+	return &buffer
+}
+
+func (h *Hasher) putBuffer(buffer *[]byte) {
+	if len(*buffer) == DefaultBufferSize {
+		defaultBuffers.Put(buffer)
+		return
+	}
+	h.buffers.Put(buffer)
+}
+
+// HashFile streams the file at path through a new hash and returns the digest
+func (h *Hasher) HashFile(path string) ([]byte, error) {
+	return h.HashFileBuffer(path, nil)
+}
+
+// HashFileBuffer is HashFile reading through buffer, see HashReaderBuffer
+func (h *Hasher) HashFileBuffer(path string, buffer []byte) ([]byte, error) {
 	//If path is null return
 	if path == "" {
 		return nil, ErrNullPath
 	}
 	//Open open and verify file in path
-	fileBytes, err := ioutil.ReadFile(path)
+	file, err := os.Open(path)
 	if err != nil {
 		return nil, &FsErr{
 			Path: path,
 			Err:  err,
 		}
 	}
+	defer file.Close()
 
-	fileHash := sha512.New()
-	if _, err := fileHash.Write(fileBytes); err != nil {
+	fileHash, mapped, err := h.hashMapped(file)
+	if !mapped {
+		adviseSequential(file)
+		fileHash, err = h.HashReaderBuffer(openContent(file), buffer)
+	}
+	if err != nil {
 		return nil, &FsErr{
 			Path: path,
 			Err:  err,
 		}
 	}
-	return fileHash.Sum(nil), nil
+	return fileHash, nil
+}
+
+// HashFS streams the named file in fsys through a new hash and returns the digest
+func (h *Hasher) HashFS(fsys iofs.FS, name string) ([]byte, error) {
+	if name == "" {
+		return nil, ErrNullPath
+	}
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, &FsErr{
+			Path: name,
+			Err:  err,
+		}
+	}
+	defer file.Close()
+
+	fileHash, err := h.HashReader(file)
+	if err != nil {
+		return nil, &FsErr{
+			Path: name,
+			Err:  err,
+		}
+	}
+	return fileHash, nil
 }
 
 // ErrExpectedDirectory expects a directory path
@@ -17,10 +17,14 @@
 package fs
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
 	"io/ioutil"
 	"math/rand"
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
 	"time"
 
@@ -80,6 +84,134 @@ func TestHashFile(t *testing.T) {
 
 }
 
+func TestHashReader(t *testing.T) {
+	data := make([]byte, 100000)
+	rand.New(rand.NewSource(time.Now().UnixNano())).Read(data)
+	expected := sha512.Sum512(data)
+
+	hash, err := HashReader(bytes.NewReader(data), sha512.New())
+	if err != nil {
+		t.Error(err)
+	}
+	if !bytes.Equal(hash, expected[:]) {
+		t.Error("fs: HashReader returned unexpected hash")
+	}
+
+	for _, size := range []int{0, 1, 7, 4096} {
+		hash, err := NewHasher(size).HashReader(bytes.NewReader(data))
+		if err != nil {
+			t.Error(err)
+		}
+		if !bytes.Equal(hash, expected[:]) {
+			t.Error("fs: Hasher returned unexpected hash for buffer size", size)
+		}
+	}
+
+	hasher := NewHasher(0)
+	hasher.New = sha256.New
+	hash, err = hasher.HashReader(bytes.NewReader(data))
+	if err != nil {
+		t.Error(err)
+	}
+	if expected := sha256.Sum256(data); !bytes.Equal(hash, expected[:]) {
+		t.Error("fs: Hasher ignored configured hash")
+	}
+}
+
+func TestHasher_Pooled(t *testing.T) {
+	hasher := NewHasher(0)
+	for i, size := range []int{0, 10, 100000} {
+		data := bytes.Repeat([]byte{byte(i)}, size)
+		expected := sha512.Sum512(data)
+		//Pooled hashes are reset before reuse
+		for j := 0; j < 3; j++ {
+			hash, err := hasher.HashReader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(hash, expected[:]) {
+				t.Error("fs: pooled Hasher returned unexpected hash for size", size)
+			}
+		}
+		hash, err := hasher.HashReaderBuffer(bytes.NewReader(data), make([]byte, 512))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(hash, expected[:]) {
+			t.Error("fs: HashReaderBuffer returned unexpected hash for size", size)
+		}
+	}
+
+	data := make([]byte, 100000)
+	reader := bytes.NewReader(data)
+	allocs := testing.AllocsPerRun(10, func() {
+		reader.Reset(data)
+		hasher.HashReader(reader)
+	})
+	if allocs > 3 {
+		t.Errorf("fs: HashReader allocated %v times", allocs)
+	}
+}
+
+func TestHasher_MmapThreshold(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	data := make([]byte, 100000)
+	rand.New(rand.NewSource(time.Now().UnixNano())).Read(data)
+	path := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	expected := sha512.Sum512(data)
+
+	for _, threshold := range []int64{0, 1, int64(len(data)), int64(len(data)) + 1} {
+		hasher := NewHasher(0)
+		hasher.MmapThreshold = threshold
+		hash, err := hasher.HashFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(hash, expected[:]) {
+			t.Error("fs: unexpected hash with mmap threshold", threshold)
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	probe, err := mmapFile(file, int64(len(data)))
+	if err != nil {
+		t.Skip("memory mapping unsupported:", err)
+	}
+	munmapFile(probe)
+	hasher := NewHasher(0)
+	hasher.MmapThreshold = 1
+	hash, mapped, err := hasher.hashMapped(file)
+	if err != nil || !mapped || !bytes.Equal(hash, expected[:]) {
+		t.Errorf("fs: hashMapped = %v, %v", mapped, err)
+	}
+}
+
+func TestReadahead(t *testing.T) {
+	file, err := ioutil.TempFile("", "readahead")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.Close()
+	if err := Readahead(file.Name()); err != nil {
+		t.Error(err)
+	}
+	if err := Readahead(file.Name() + ".missing"); runtime.GOOS == "linux" && err == nil {
+		t.Error("fs: expected an error hinting a missing file")
+	}
+}
+
 func TestZip(t *testing.T) {
 	t.SkipNow()
 	if err := Compress(os.Getenv("TEST_FOLDER"), os.Getenv("ZIP_DEST")); err != nil {
@@ -0,0 +1,34 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package fs
+
+import "os"
+
+// Inode returns the identity of the file described by info and its number of
+// hard links. Inodes are not available on this platform.
+func Inode(info os.FileInfo) (id FileID, links uint64, ok bool) {
+	return FileID{}, 0, false
+}
+
+// allocated returns the bytes of storage allocated to the file described by
+// info. Allocation is not available on this platform.
+func allocated(info os.FileInfo) (int64, bool) {
+	return 0, false
+}
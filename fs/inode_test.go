@@ -0,0 +1,108 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package fs
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHashFile_Sparse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sparse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sparse")
+
+	//Data surrounded by holes, ending in a hole
+	const size = 8 << 20
+	content := make([]byte, size)
+	copy(content[3<<20:], bytes.Repeat([]byte("data"), 1024))
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteAt(content[3<<20:3<<20+4096], 3<<20); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	want := sha512.Sum512(content)
+	hash, err := HashFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(hash, want[:]) {
+		t.Error("sparse file hash differs from its content hash")
+	}
+
+	file, err = os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	read, err := ioutil.ReadAll(newSparseReader(file, size))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(read, content) {
+		t.Error("sparse reader content differs from the file")
+	}
+
+	fileHash, chunks, err := NewHasher(0).HashFileChunks(path, NewFixedSplitter(1<<20))
+	if err != nil || !bytes.Equal(fileHash, want[:]) || len(chunks) != 8 {
+		t.Errorf("unexpected chunked hash of sparse file, %d chunks: %v", len(chunks), err)
+	}
+}
+
+func TestInode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inode")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "a"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(filepath.Join(dir, "a"), filepath.Join(dir, "b")); err != nil {
+		t.Skip("hard links unsupported:", err)
+	}
+
+	a, err := os.Stat(filepath.Join(dir, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.Stat(filepath.Join(dir, "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	aID, links, ok := Inode(a)
+	if !ok {
+		t.Skip("inodes unavailable")
+	}
+	if bID, _, _ := Inode(b); aID != bID || links != 2 {
+		t.Errorf("expected hard links to share an inode, %v %v links %d", aID, bID, links)
+	}
+}
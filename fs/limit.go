@@ -0,0 +1,108 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package fs
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// RateLimiter caps the rate bytes are read across every reader it wraps
+// using a token bucket holding up to one second of reads. It is safe for
+// concurrent use so a single limiter can throttle several workers.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+	sleep  func(time.Duration)
+}
+
+// NewRateLimiter returns a RateLimiter allowing bytesPerSecond bytes to be
+// read each second. A rate less than 1 returns nil, which doesn't limit.
+func NewRateLimiter(bytesPerSecond int64) *RateLimiter {
+	if bytesPerSecond < 1 {
+		return nil
+	}
+	return &RateLimiter{
+		rate:   float64(bytesPerSecond),
+		tokens: float64(bytesPerSecond),
+		now:    time.Now,
+		sleep:  time.Sleep,
+	}
+}
+
+// Rate returns the number of bytes allowed each second, or 0 if unlimited
+func (l *RateLimiter) Rate() int64 {
+	if l == nil {
+		return 0
+	}
+	return int64(l.rate)
+}
+
+// Wait blocks until n more bytes may be read
+func (l *RateLimiter) Wait(n int) {
+	if l == nil || n <= 0 {
+		return
+	}
+	l.mu.Lock()
+	now := l.now()
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.rate {
+			l.tokens = l.rate
+		}
+	}
+	l.last = now
+	//Reads are taken immediately, later readers wait out the debt
+	l.tokens -= float64(n)
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if wait > 0 {
+		l.sleep(wait)
+	}
+}
+
+// Reader returns a reader limited by l. A nil limiter returns r unchanged.
+func (l *RateLimiter) Reader(r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &limitedReader{r: r, limiter: l}
+}
+
+// limitedReader waits on its limiter for the bytes read
+type limitedReader struct {
+	r       io.Reader
+	limiter *RateLimiter
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	//Keep single reads within the bucket so waits stay short
+	if max := int(lr.limiter.rate); len(p) > max {
+		p = p[:max]
+	}
+	n, err := lr.r.Read(p)
+	lr.limiter.Wait(n)
+	return n, err
+}
@@ -0,0 +1,70 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package fs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := NewRateLimiter(1000)
+	now := time.Unix(0, 0)
+	var slept time.Duration
+	l.now = func() time.Time { return now }
+	l.sleep = func(d time.Duration) {
+		slept += d
+		now = now.Add(d)
+	}
+
+	//The first second of reads is available immediately
+	data, err := ioutil.ReadAll(l.Reader(bytes.NewReader(make([]byte, 1000))))
+	if err != nil || len(data) != 1000 || slept != 0 {
+		t.Fatalf("unexpected read of %d bytes, slept %v: %v", len(data), slept, err)
+	}
+
+	//Further reads wait for the bucket to refill
+	data, err = ioutil.ReadAll(l.Reader(bytes.NewReader(make([]byte, 2500))))
+	if err != nil || len(data) != 2500 {
+		t.Fatal(err)
+	}
+	if slept != 2500*time.Millisecond {
+		t.Errorf("expected to wait 2.5s, waited %v", slept)
+	}
+
+	//Idle time refills the bucket up to one second of reads
+	now = now.Add(time.Hour)
+	slept = 0
+	l.Wait(1000)
+	if slept != 0 {
+		t.Errorf("expected refilled bucket, waited %v", slept)
+	}
+}
+
+func TestRateLimiter_Nil(t *testing.T) {
+	var l *RateLimiter
+	if NewRateLimiter(0) != nil || l.Rate() != 0 {
+		t.Error("expected unlimited limiter to be nil")
+	}
+	r := bytes.NewReader(nil)
+	if l.Reader(r) != r {
+		t.Error("expected nil limiter to return the reader")
+	}
+	l.Wait(10)
+}
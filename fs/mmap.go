@@ -0,0 +1,72 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package fs
+
+import (
+	"os"
+	"runtime/debug"
+
+	"github.com/pkg/errors"
+)
+
+// errMappedFault is returned when a mapped file faults while being hashed,
+// typically because it was truncated
+var errMappedFault = errors.New("fs: mapped file changed while hashing")
+
+// hashMapped hashes file through a memory mapping when MmapThreshold is set
+// and the file is at least that large. ok is false when the file wasn't
+// mapped, either because it is too small or mapping failed, and should be
+// read instead.
+func (h *Hasher) hashMapped(file *os.File) (hash []byte, ok bool, err error) {
+	if h.MmapThreshold <= 0 {
+		return nil, false, nil
+	}
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() || info.Size() < h.MmapThreshold {
+		return nil, false, nil
+	}
+	data, err := mmapFile(file, info.Size())
+	if err != nil {
+		return nil, false, nil
+	}
+	defer munmapFile(data)
+
+	//Faults on the mapping, such as a truncated file, panic rather than crash
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		if recover() != nil {
+			hash, ok, err = nil, true, errMappedFault
+		}
+	}()
+
+	chunk := h.BufferSize
+	if chunk < 1 {
+		chunk = DefaultBufferSize
+	}
+	digest := h.getHash()
+	defer h.putHash(digest)
+	for len(data) > 0 {
+		n := chunk
+		if n > len(data) {
+			n = len(data)
+		}
+		h.Limiter.Wait(n)
+		digest.Write(data[:n])
+		data = data[n:]
+	}
+	return digest.Sum(nil), true, nil
+}
@@ -0,0 +1,48 @@
+//go:build linux
+// +build linux
+
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package fs
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Readahead hints the kernel to read the file at path into the page cache in
+// the background, so a later HashFile finds it in memory rather than waiting
+// on the disk. Hashing many small files is dominated by that wait, which
+// hinting files ahead of the workers overlaps with hashing.
+func Readahead(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return &FsErr{Path: path, Err: err}
+	}
+	defer file.Close()
+	if err := unix.Fadvise(int(file.Fd()), 0, 0, unix.FADV_WILLNEED); err != nil {
+		return &FsErr{Path: path, Err: err}
+	}
+	return nil
+}
+
+// adviseSequential hints that file is read from start to end, which widens
+// the kernel's readahead window
+func adviseSequential(file *os.File) {
+	unix.Fadvise(int(file.Fd()), 0, 0, unix.FADV_SEQUENTIAL)
+}
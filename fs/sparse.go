@@ -0,0 +1,42 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package fs
+
+import (
+	"io"
+	"os"
+)
+
+// FileID identifies a file by device and inode number
+type FileID struct {
+	Dev uint64
+	Ino uint64
+}
+
+// openContent returns a reader over the content of file. Sparse files are
+// read with their holes filled in from memory where the platform reports
+// them, which hashes identically without reading the holes from disk.
+func openContent(file *os.File) io.Reader {
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return file
+	}
+	if size, ok := allocated(info); !ok || size >= info.Size() {
+		return file
+	}
+	return newSparseReader(file, info.Size())
+}
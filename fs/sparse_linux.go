@@ -0,0 +1,100 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package fs
+
+import (
+	"io"
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// lseek whence values locating data and holes
+const (
+	seekData = 3
+	seekHole = 4
+)
+
+// sparseReader reads a file region by region, reading data regions from the
+// file and returning zeros for holes without reading them
+type sparseReader struct {
+	file    *os.File
+	size    int64
+	offset  int64
+	dataEnd int64
+	holeEnd int64
+}
+
+func newSparseReader(file *os.File, size int64) io.Reader {
+	return &sparseReader{file: file, size: size}
+}
+
+func (r *sparseReader) Read(p []byte) (int, error) {
+	for {
+		if r.offset >= r.size {
+			return 0, io.EOF
+		}
+		if r.offset < r.holeEnd {
+			n := len(p)
+			if remaining := r.holeEnd - r.offset; int64(n) > remaining {
+				n = int(remaining)
+			}
+			for i := range p[:n] {
+				p[i] = 0
+			}
+			r.offset += int64(n)
+			return n, nil
+		}
+		if r.offset < r.dataEnd {
+			if remaining := r.dataEnd - r.offset; int64(len(p)) > remaining {
+				p = p[:remaining]
+			}
+			n, err := r.file.ReadAt(p, r.offset)
+			r.offset += int64(n)
+			if err == io.EOF && n > 0 {
+				err = nil
+			}
+			return n, err
+		}
+		r.locate()
+	}
+}
+
+// locate finds the region starting at the current offset
+func (r *sparseReader) locate() {
+	data, err := r.file.Seek(r.offset, seekData)
+	switch {
+	case errors.Is(err, syscall.ENXIO):
+		//Only a hole remains
+		r.holeEnd = r.size
+		return
+	case err != nil:
+		//Fall back to reading the remainder
+		r.dataEnd = r.size
+		return
+	case data > r.offset:
+		r.holeEnd = data
+		return
+	}
+
+	hole, err := r.file.Seek(r.offset, seekHole)
+	if err != nil || hole <= r.offset {
+		hole = r.size
+	}
+	r.dataEnd = hole
+}
@@ -0,0 +1,106 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package golinkshttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/govice/golinks/auth"
+)
+
+// EventSubmitted is the type of events published when a blockmap is submitted
+const EventSubmitted = "submitted"
+
+// eventBuffer bounds the events queued for a slow subscriber, past which its
+// events are dropped rather than blocking submissions
+const eventBuffer = 64
+
+// Event describes a change to the handler's store
+type Event struct {
+	Type     string    `json:"type"`
+	RootHash string    `json:"rootHash"`
+	Time     time.Time `json:"time"`
+}
+
+// events fans published events out to subscribers
+type events struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+func (e *events) subscribe() chan Event {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.subscribers == nil {
+		e.subscribers = make(map[chan Event]struct{})
+	}
+	ch := make(chan Event, eventBuffer)
+	e.subscribers[ch] = struct{}{}
+	return ch
+}
+
+func (e *events) unsubscribe(ch chan Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.subscribers, ch)
+}
+
+func (e *events) publish(event Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for ch := range e.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// streamEvents writes events to the client as newline delimited JSON until
+// it disconnects
+func (h *Handler) streamEvents(w http.ResponseWriter, r *http.Request) {
+	if err := h.authorize(r, auth.Read); err != nil {
+		writeResult(w, nil, err)
+		return
+	}
+	ch := h.events.subscribe()
+	defer h.events.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	encoder := json.NewEncoder(w)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-ch:
+			if err := encoder.Encode(event); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
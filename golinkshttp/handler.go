@@ -0,0 +1,366 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+// Package golinkshttp provides an HTTP handler exposing blockmap operations as
+// JSON endpoints. Root hashes in paths and bodies are hex encoded.
+//
+//	POST /blockmaps                          submit a link file in any codec format
+//	GET  /blockmaps?offset=&limit=           list stored root hashes
+//	GET  /blockmaps/{hash}                   fetch a blockmap summary
+//	GET  /blockmaps/{hash}/entries?offset=&limit=  list archive entries
+//	GET  /blockmaps/{hash}/proof?path=       fetch a merkle proof for a path
+//	POST /diff                               diff two stored blockmaps
+//	POST /proofs/verify                      verify a merkle proof
+//	GET  /events                             stream submissions as newline delimited JSON
+//
+// With a policy set, submitting requires the write role, verifying proofs the
+// verify role and every other endpoint the read role. Clients authenticate
+// with a bearer token in the Authorization header or a verified TLS client
+// certificate.
+package golinkshttp
+
+import (
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/govice/golinks/auth"
+	"github.com/govice/golinks/blockmap"
+	"github.com/pkg/errors"
+)
+
+// Pagination limits for list endpoints
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// maxLinkSize bounds the size of submitted link files
+const maxLinkSize = 64 << 20
+
+// Handler serves the golinks JSON API from a Store
+type Handler struct {
+	store  Store
+	policy *auth.Policy
+	events events
+}
+
+// NewHandler returns a Handler backed by store. Mount it under a prefix with
+// http.StripPrefix.
+func NewHandler(store Store) *Handler {
+	return &Handler{store: store}
+}
+
+// SetPolicy authorizes requests with p. A nil policy accepts every request.
+func (h *Handler) SetPolicy(p *auth.Policy) {
+	h.policy = p
+}
+
+// Summary describes a stored blockmap
+type Summary struct {
+	RootHash      string `json:"rootHash"`
+	Root          string `json:"root"`
+	SchemaVersion int    `json:"schemaVersion"`
+	HashMode      string `json:"hashMode,omitempty"`
+	Entries       int    `json:"entries"`
+}
+
+// Entry is a single archive entry
+type Entry struct {
+	Path string `json:"path"`
+	Hash []byte `json:"hash"`
+}
+
+// Page is a paginated list response. NextOffset is omitted on the last page.
+type Page struct {
+	Items      interface{} `json:"items"`
+	Total      int         `json:"total"`
+	Offset     int         `json:"offset"`
+	NextOffset *int        `json:"nextOffset,omitempty"`
+}
+
+// DiffRequest names two stored blockmaps to compare
+type DiffRequest struct {
+	A string `json:"a"`
+	B string `json:"b"`
+}
+
+// VerifyProofRequest holds a merkle proof and the merkle root it proves against
+type VerifyProofRequest struct {
+	MerkleRoot []byte               `json:"merkleRoot"`
+	Proof      blockmap.MerkleProof `json:"proof"`
+}
+
+// ProofResponse holds a merkle proof with the merkle root it proves against
+type ProofResponse struct {
+	MerkleRoot []byte                `json:"merkleRoot"`
+	Proof      *blockmap.MerkleProof `json:"proof"`
+}
+
+type httpError struct {
+	status int
+	err    error
+}
+
+func (e *httpError) Error() string { return e.err.Error() }
+
+func newHTTPError(status int, err error) error {
+	return &httpError{status: status, err: err}
+}
+
+// ServeHTTP routes requests to the API endpoints
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) == 1 && parts[0] == "events" && r.Method == http.MethodGet {
+		h.streamEvents(w, r)
+		return
+	}
+	var (
+		result interface{}
+		err    error
+		role   = auth.Read
+		handle func() (interface{}, error)
+	)
+	switch {
+	case len(parts) == 1 && parts[0] == "blockmaps" && r.Method == http.MethodPost:
+		role, handle = auth.Write, func() (interface{}, error) { return h.submit(w, r) }
+	case len(parts) == 1 && parts[0] == "blockmaps" && r.Method == http.MethodGet:
+		handle = func() (interface{}, error) { return h.list(r) }
+	case len(parts) == 2 && parts[0] == "blockmaps" && r.Method == http.MethodGet:
+		handle = func() (interface{}, error) { return h.summary(parts[1]) }
+	case len(parts) == 3 && parts[0] == "blockmaps" && parts[2] == "entries" && r.Method == http.MethodGet:
+		handle = func() (interface{}, error) { return h.entries(parts[1], r) }
+	case len(parts) == 3 && parts[0] == "blockmaps" && parts[2] == "proof" && r.Method == http.MethodGet:
+		handle = func() (interface{}, error) { return h.proof(parts[1], r.URL.Query().Get("path")) }
+	case len(parts) == 1 && parts[0] == "diff" && r.Method == http.MethodPost:
+		handle = func() (interface{}, error) { return h.diff(r) }
+	case len(parts) == 2 && parts[0] == "proofs" && parts[1] == "verify" && r.Method == http.MethodPost:
+		role, handle = auth.Verify, func() (interface{}, error) { return h.verifyProof(r) }
+	default:
+		err = newHTTPError(http.StatusNotFound, errors.New("not found"))
+	}
+	if handle != nil {
+		if err = h.authorize(r, role); err == nil {
+			result, err = handle()
+		}
+	}
+	writeResult(w, result, err)
+}
+
+// writeResult writes result, or err with its HTTP status, as JSON
+func writeResult(w http.ResponseWriter, result interface{}, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		status := http.StatusInternalServerError
+		if httpErr, ok := err.(*httpError); ok {
+			status = httpErr.status
+		}
+		w.WriteHeader(status)
+		result = map[string]string{"error": err.Error()}
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+// authorize checks the request may perform operations of the required role
+func (h *Handler) authorize(r *http.Request, required auth.Role) error {
+	if h.policy == nil {
+		return nil
+	}
+	var chains [][]*x509.Certificate
+	if r.TLS != nil {
+		chains = r.TLS.VerifiedChains
+	}
+	_, err := h.policy.Authorize(auth.BearerToken(r.Header.Get("Authorization")), chains, required)
+	switch errors.Cause(err) {
+	case nil:
+		return nil
+	case auth.ErrForbidden:
+		return newHTTPError(http.StatusForbidden, err)
+	default:
+		return newHTTPError(http.StatusUnauthorized, err)
+	}
+}
+
+func (h *Handler) submit(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	link, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxLinkSize))
+	if err != nil {
+		return nil, newHTTPError(http.StatusRequestEntityTooLarge, err)
+	}
+	b := blockmap.New("")
+	if err := b.Decode(link); err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, errors.Wrap(err, "failed to decode link"))
+	}
+	if b.RootHash == nil {
+		return nil, newHTTPError(http.StatusBadRequest, errors.New("link has no root hash"))
+	}
+	if err := b.CheckRootHash(); err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, errors.Wrap(err, "failed to check root hash"))
+	}
+	if err := h.store.Put(b); err == ErrConflict {
+		return nil, newHTTPError(http.StatusConflict, err)
+	} else if err != nil {
+		return nil, err
+	}
+	h.events.publish(Event{Type: EventSubmitted, RootHash: hex.EncodeToString(b.RootHash), Time: time.Now().UTC()})
+	return summarize(b), nil
+}
+
+func (h *Handler) list(r *http.Request) (interface{}, error) {
+	hashes, err := h.store.RootHashes()
+	if err != nil {
+		return nil, err
+	}
+	items := make([]string, len(hashes))
+	for i, hash := range hashes {
+		items[i] = hex.EncodeToString(hash)
+	}
+	return paginate(r, len(items), func(start, end int) interface{} { return items[start:end] })
+}
+
+func (h *Handler) summary(hash string) (interface{}, error) {
+	b, err := h.get(hash)
+	if err != nil {
+		return nil, err
+	}
+	return summarize(b), nil
+}
+
+func (h *Handler) entries(hash string, r *http.Request) (interface{}, error) {
+	b, err := h.get(hash)
+	if err != nil {
+		return nil, err
+	}
+	paths := b.Archive.SortedKeys()
+	return paginate(r, len(paths), func(start, end int) interface{} {
+		entries := make([]Entry, 0, end-start)
+		for _, path := range paths[start:end] {
+			entries = append(entries, Entry{Path: path, Hash: b.Archive[path]})
+		}
+		return entries
+	})
+}
+
+func (h *Handler) proof(hash, path string) (interface{}, error) {
+	b, err := h.get(hash)
+	if err != nil {
+		return nil, err
+	}
+	proof, err := b.Proof(path)
+	if errors.Cause(err) == blockmap.ErrPathNotArchived {
+		return nil, newHTTPError(http.StatusNotFound, err)
+	} else if err != nil {
+		return nil, err
+	}
+	root, err := b.MerkleRoot()
+	if err != nil {
+		return nil, err
+	}
+	return &ProofResponse{MerkleRoot: root, Proof: proof}, nil
+}
+
+func (h *Handler) diff(r *http.Request) (interface{}, error) {
+	req := &DiffRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, err)
+	}
+	a, err := h.get(req.A)
+	if err != nil {
+		return nil, err
+	}
+	b, err := h.get(req.B)
+	if err != nil {
+		return nil, err
+	}
+	return blockmap.Diff(a, b), nil
+}
+
+func (h *Handler) verifyProof(r *http.Request) (interface{}, error) {
+	req := &VerifyProofRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, err)
+	}
+	return map[string]bool{"valid": blockmap.VerifyProof(req.MerkleRoot, &req.Proof)}, nil
+}
+
+func (h *Handler) get(hash string) (*blockmap.BlockMap, error) {
+	rootHash, err := hex.DecodeString(hash)
+	if err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, errors.Wrap(err, "invalid root hash"))
+	}
+	b, err := h.store.Get(rootHash)
+	if err == ErrNotFound {
+		return nil, newHTTPError(http.StatusNotFound, err)
+	}
+	return b, err
+}
+
+func summarize(b *blockmap.BlockMap) *Summary {
+	return &Summary{
+		RootHash:      hex.EncodeToString(b.RootHash),
+		Root:          b.Root,
+		SchemaVersion: b.SchemaVersion,
+		HashMode:      string(b.HashMode),
+		Entries:       len(b.Archive),
+	}
+}
+
+// paginate reads offset and limit query parameters and returns the page of
+// items produced by slice
+func paginate(r *http.Request, total int, slice func(start, end int) interface{}) (*Page, error) {
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := queryInt(r, "limit", DefaultLimit)
+	if err != nil {
+		return nil, err
+	}
+	if limit == 0 {
+		limit = DefaultLimit
+	} else if limit > MaxLimit {
+		limit = MaxLimit
+	}
+	if offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+
+	page := &Page{Items: slice(offset, end), Total: total, Offset: offset}
+	if end < total {
+		page.NextOffset = &end
+	}
+	return page, nil
+}
+
+func queryInt(r *http.Request, name string, def int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, newHTTPError(http.StatusBadRequest, errors.Errorf("invalid %s %q", name, value))
+	}
+	return n, nil
+}
@@ -0,0 +1,270 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package golinkshttp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/govice/golinks/auth"
+	"github.com/govice/golinks/blockmap"
+	"github.com/govice/golinks/codec"
+)
+
+func generate(t *testing.T, root string, files map[string]string) *blockmap.BlockMap {
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b := blockmap.New(root)
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func do(t *testing.T, h http.Handler, method, target string, body []byte, out interface{}) int {
+	req := httptest.NewRequest(method, target, bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rec.Code
+}
+
+func TestHandler(t *testing.T) {
+	root, err := ioutil.TempDir("", "golinkshttp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	first := generate(t, root, map[string]string{"a": "a", "b": "b", "c": "c"})
+	second := generate(t, root, map[string]string{"a": "changed"})
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/", http.StripPrefix("/api", NewHandler(NewMemoryStore())))
+
+	for _, b := range []*blockmap.BlockMap{first, second} {
+		link, err := codec.Encode(codec.CBOR, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		summary := &Summary{}
+		if code := do(t, mux, http.MethodPost, "/api/blockmaps", link, summary); code != http.StatusOK {
+			t.Fatal("failed to submit blockmap", code)
+		}
+		if summary.RootHash != hex.EncodeToString(b.RootHash) || summary.Entries != 3 {
+			t.Errorf("unexpected summary %+v", summary)
+		}
+	}
+	firstHash := hex.EncodeToString(first.RootHash)
+	secondHash := hex.EncodeToString(second.RootHash)
+
+	var hashes struct {
+		Items []string `json:"items"`
+		Total int      `json:"total"`
+	}
+	do(t, mux, http.MethodGet, "/api/blockmaps", nil, &hashes)
+	if hashes.Total != 2 || len(hashes.Items) != 2 {
+		t.Errorf("unexpected root hashes %+v", hashes)
+	}
+
+	//Page through entries one at a time
+	var paths []string
+	offset := 0
+	for {
+		var page struct {
+			Items      []Entry `json:"items"`
+			NextOffset *int    `json:"nextOffset"`
+		}
+		code := do(t, mux, http.MethodGet, "/api/blockmaps/"+firstHash+"/entries?limit=2&offset="+strconv.Itoa(offset), nil, &page)
+		if code != http.StatusOK {
+			t.Fatal("failed to list entries", code)
+		}
+		for _, entry := range page.Items {
+			paths = append(paths, entry.Path)
+		}
+		if page.NextOffset == nil {
+			break
+		}
+		offset = *page.NextOffset
+	}
+	if len(paths) != 3 || paths[0] != "a" || paths[2] != "c" {
+		t.Errorf("unexpected paged entries %v", paths)
+	}
+
+	diffBody, _ := json.Marshal(&DiffRequest{A: firstHash, B: secondHash})
+	diff := &blockmap.DiffResult{}
+	do(t, mux, http.MethodPost, "/api/diff", diffBody, diff)
+	if len(diff.Modified) != 1 || diff.Modified[0] != "a" {
+		t.Errorf("unexpected diff %+v", diff)
+	}
+
+	proof := &ProofResponse{}
+	if code := do(t, mux, http.MethodGet, "/api/blockmaps/"+firstHash+"/proof?path=b", nil, proof); code != http.StatusOK {
+		t.Fatal("failed to get proof", code)
+	}
+	verifyBody, _ := json.Marshal(&VerifyProofRequest{MerkleRoot: proof.MerkleRoot, Proof: *proof.Proof})
+	var verified map[string]bool
+	do(t, mux, http.MethodPost, "/api/proofs/verify", verifyBody, &verified)
+	if !verified["valid"] {
+		t.Error("failed to verify proof")
+	}
+
+	if code := do(t, mux, http.MethodGet, "/api/blockmaps/"+hex.EncodeToString([]byte("missing")), nil, nil); code != http.StatusNotFound {
+		t.Error("expected not found, got", code)
+	}
+	if code := do(t, mux, http.MethodGet, "/api/blockmaps/zz", nil, nil); code != http.StatusBadRequest {
+		t.Error("expected bad request, got", code)
+	}
+	if code := do(t, mux, http.MethodPost, "/api/blockmaps", []byte("garbage"), nil); code != http.StatusBadRequest {
+		t.Error("expected bad request, got", code)
+	}
+
+	//Resubmitting is accepted, replacing the stored blockmap isn't
+	submit := func(b *blockmap.BlockMap) int {
+		link, err := codec.Encode(codec.CBOR, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return do(t, mux, http.MethodPost, "/api/blockmaps", link, nil)
+	}
+	clone := func(b *blockmap.BlockMap) *blockmap.BlockMap {
+		link, err := codec.Encode(codec.CBOR, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := blockmap.New("")
+		if err := c.Decode(link); err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	if code := submit(first); code != http.StatusOK {
+		t.Error("expected resubmission to succeed, got", code)
+	}
+	forged := clone(first)
+	forged.Archive["b"] = second.Archive["a"]
+	if code := submit(forged); code != http.StatusBadRequest {
+		t.Error("expected bad request for a forged archive, got", code)
+	}
+	moved := clone(first)
+	moved.Root = "/elsewhere"
+	if code := submit(moved); code != http.StatusConflict {
+		t.Error("expected conflict replacing a stored blockmap, got", code)
+	}
+	stored := &Summary{}
+	do(t, mux, http.MethodGet, "/api/blockmaps/"+firstHash, nil, stored)
+	if stored.Root != root {
+		t.Errorf("stored blockmap was replaced %+v", stored)
+	}
+}
+
+func TestHandler_Policy(t *testing.T) {
+	root, err := ioutil.TempDir("", "golinkshttp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	link, err := codec.Encode(codec.CBOR, generate(t, root, map[string]string{"a": "a"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := auth.NewPolicy()
+	policy.AddToken("ci", "ci-token", auth.Write)
+	policy.AddToken("auditor", "auditor-token", auth.Verify)
+	handler := NewHandler(NewMemoryStore())
+	handler.SetPolicy(policy)
+
+	request := func(method, target, token string, body []byte) int {
+		req := httptest.NewRequest(method, target, bytes.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	verifyBody, _ := json.Marshal(&VerifyProofRequest{})
+	tests := []struct {
+		name         string
+		method, path string
+		token        string
+		body         []byte
+		code         int
+	}{
+		{"anonymous list", http.MethodGet, "/blockmaps", "", nil, http.StatusUnauthorized},
+		{"unknown token", http.MethodGet, "/blockmaps", "other", nil, http.StatusUnauthorized},
+		{"verifier submit", http.MethodPost, "/blockmaps", "auditor-token", link, http.StatusForbidden},
+		{"writer submit", http.MethodPost, "/blockmaps", "ci-token", link, http.StatusOK},
+		{"verifier list", http.MethodGet, "/blockmaps", "auditor-token", nil, http.StatusOK},
+		{"verifier verify", http.MethodPost, "/proofs/verify", "auditor-token", verifyBody, http.StatusOK},
+		{"unknown route", http.MethodGet, "/other", "", nil, http.StatusNotFound},
+	}
+	for _, test := range tests {
+		if code := request(test.method, test.path, test.token, test.body); code != test.code {
+			t.Errorf("%s: expected %d, got %d", test.name, test.code, code)
+		}
+	}
+}
+
+func TestHandler_Events(t *testing.T) {
+	root, err := ioutil.TempDir("", "golinkshttp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	b := generate(t, root, map[string]string{"a": "a"})
+	link, err := codec.Encode(codec.CBOR, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := NewHandler(NewMemoryStore())
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if code := do(t, handler, http.MethodPost, "/blockmaps", link, nil); code != http.StatusOK {
+		t.Fatal("failed to submit blockmap", code)
+	}
+	event := &Event{}
+	if err := json.NewDecoder(resp.Body).Decode(event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != EventSubmitted || event.RootHash != hex.EncodeToString(b.RootHash) {
+		t.Errorf("unexpected event %+v", event)
+	}
+}
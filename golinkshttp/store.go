@@ -0,0 +1,106 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package golinkshttp
+
+import (
+	"encoding/hex"
+	"sort"
+	"sync"
+
+	"github.com/govice/golinks/blockmap"
+	"github.com/pkg/errors"
+)
+
+// ErrNotFound is returned when a store holds no blockmap for a root hash
+var ErrNotFound = errors.New("golinkshttp: blockmap not found")
+
+// ErrConflict is returned when a store already holds a different blockmap
+// for a root hash
+var ErrConflict = errors.New("golinkshttp: a different blockmap is stored for the root hash")
+
+// Store holds submitted blockmaps keyed by root hash
+type Store interface {
+	// Put stores a hashed blockmap, returning ErrConflict if a different
+	// blockmap is stored for its root hash
+	Put(b *blockmap.BlockMap) error
+	// Get returns the blockmap with rootHash
+	Get(rootHash []byte) (*blockmap.BlockMap, error)
+	// RootHashes returns the root hashes of all stored blockmaps in a stable order
+	RootHashes() ([][]byte, error)
+}
+
+// MemoryStore is a Store held in memory
+type MemoryStore struct {
+	mu        sync.RWMutex
+	blockmaps map[string]*blockmap.BlockMap
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{blockmaps: make(map[string]*blockmap.BlockMap)}
+}
+
+// Put stores a hashed blockmap, returning ErrConflict if a different
+// blockmap is stored for its root hash
+func (m *MemoryStore) Put(b *blockmap.BlockMap) error {
+	if b.RootHash == nil {
+		return errors.New("golinkshttp: can't store unhashed blockmap")
+	}
+	key := hex.EncodeToString(b.RootHash)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if stored, ok := m.blockmaps[key]; ok {
+		c, err := blockmap.Compare(stored, b, blockmap.Strict)
+		if err != nil {
+			return err
+		}
+		if !c.Equal {
+			return ErrConflict
+		}
+		return nil
+	}
+	m.blockmaps[key] = b
+	return nil
+}
+
+// Get returns the blockmap with rootHash
+func (m *MemoryStore) Get(rootHash []byte) (*blockmap.BlockMap, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	b, ok := m.blockmaps[hex.EncodeToString(rootHash)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return b, nil
+}
+
+// RootHashes returns the root hashes of all stored blockmaps in hex order
+func (m *MemoryStore) RootHashes() ([][]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	keys := make([]string, 0, len(m.blockmaps))
+	for key := range m.blockmaps {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	hashes := make([][]byte, 0, len(keys))
+	for _, key := range keys {
+		hashes = append(hashes, m.blockmaps[key].RootHash)
+	}
+	return hashes, nil
+}
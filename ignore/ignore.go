@@ -0,0 +1,213 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package ignore
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// pattern is a single compiled ignore rule
+type pattern struct {
+	expr    *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// Matcher evaluates slash separated relative paths against gitignore style
+// patterns. Later patterns take precedence over earlier ones.
+type Matcher struct {
+	patterns []pattern
+}
+
+// New compiles a list of gitignore style patterns. Blank lines and lines
+// starting with # are skipped, a leading ! negates a pattern, a trailing /
+// only matches directories, and patterns containing a / are anchored to the
+// root. * and ? match within a path segment while ** matches across segments.
+func New(patterns []string) (*Matcher, error) {
+	m := &Matcher{}
+	for _, line := range patterns {
+		if err := m.Add(line); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Load compiles the patterns stored one per line in the file at path
+func Load(path string) (*Matcher, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "ignore: failed to open "+path)
+	}
+	defer file.Close()
+
+	m, err := Read(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "ignore: failed to read "+path)
+	}
+	return m, nil
+}
+
+// Read compiles the patterns read one per line from r
+func Read(r io.Reader) (*Matcher, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return New(lines)
+}
+
+// Merge returns a matcher evaluating the patterns of each matcher in order
+func Merge(matchers ...*Matcher) *Matcher {
+	merged := &Matcher{}
+	for _, m := range matchers {
+		if m != nil {
+			merged.patterns = append(merged.patterns, m.patterns...)
+		}
+	}
+	return merged
+}
+
+// Add compiles and appends a single pattern to the matcher
+func (m *Matcher) Add(line string) error {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+
+	p := pattern{}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\") {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if line == "" {
+		return nil
+	}
+
+	expr := "^" + translate(line) + "$"
+	if !anchored && !strings.HasPrefix(line, "**") {
+		expr = "^(?:.*/)?" + translate(line) + "$"
+	}
+
+	compiled, err := regexp.Compile(expr)
+	if err != nil {
+		return errors.Wrap(err, "ignore: invalid pattern "+line)
+	}
+	p.expr = compiled
+	m.patterns = append(m.patterns, p)
+	return nil
+}
+
+// Match returns true if the relative path is ignored. A path is also ignored
+// when any of its parent directories are ignored.
+func (m *Matcher) Match(relPath string, isDir bool) bool {
+	if m == nil || len(m.patterns) == 0 {
+		return false
+	}
+
+	relPath = strings.Trim(strings.Replace(relPath, "\\", "/", -1), "/")
+	segments := strings.Split(relPath, "/")
+	for i := 1; i < len(segments); i++ {
+		if m.match(strings.Join(segments[:i], "/"), true) {
+			return true
+		}
+	}
+	return m.match(relPath, isDir)
+}
+
+// Len returns the number of compiled patterns
+func (m *Matcher) Len() int {
+	if m == nil {
+		return 0
+	}
+	return len(m.patterns)
+}
+
+func (m *Matcher) match(relPath string, isDir bool) bool {
+	ignored := false
+	for _, p := range m.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		if p.expr.MatchString(relPath) {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
+
+// translate converts a glob pattern into a regular expression
+func translate(glob string) string {
+	var expr strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+				switch {
+				case i+1 < len(glob) && glob[i+1] == '/':
+					// "**/" matches zero or more directories
+					i++
+					expr.WriteString("(?:.*/)?")
+				default:
+					expr.WriteString(".*")
+				}
+				continue
+			}
+			expr.WriteString("[^/]*")
+		case '?':
+			expr.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				expr.WriteString(regexp.QuoteMeta(string(c)))
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return expr.String()
+}
@@ -0,0 +1,93 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package ignore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatcher_Match(t *testing.T) {
+	m, err := New([]string{
+		"# comment",
+		"",
+		"**/*.tmp",
+		"node_modules/",
+		"/build",
+		"docs/**/draft-?.md",
+		"*.log",
+		"!keep.log",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{"a.tmp", false, true},
+		{"deep/nested/a.tmp", false, true},
+		{"a.tmpl", false, false},
+		{"node_modules", true, true},
+		{"node_modules", false, false},
+		{"web/node_modules/pkg/index.js", false, true},
+		{"build", true, true},
+		{"build/out.bin", false, true},
+		{"src/build", true, false},
+		{"docs/draft-1.md", false, true},
+		{"docs/a/b/draft-2.md", false, true},
+		{"docs/draft-10.md", false, false},
+		{"error.log", false, true},
+		{"logs/error.log", false, true},
+		{"keep.log", false, false},
+		{"src/main.go", false, false},
+	}
+
+	for _, c := range cases {
+		if ignored := m.Match(c.path, c.isDir); ignored != c.ignored {
+			t.Error("unexpected match for", c.path, "got", ignored, "expected", c.ignored)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ignore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, ".linkignore")
+	if err := ioutil.WriteFile(path, []byte("*.tmp\n!important.tmp\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Len() != 2 {
+		t.Error("expected 2 patterns, got", m.Len())
+	}
+	if !m.Match("scratch.tmp", false) || m.Match("important.tmp", false) {
+		t.Error("loaded patterns did not match as expected")
+	}
+}
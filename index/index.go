@@ -0,0 +1,220 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+// Package index searches many link files for archived content by hash, so
+// every snapshot a known file appeared in can be found. Hashes are matched
+// as recorded in the archive: a file is only found in links generated with
+// the same file hash algorithm, and chunked files are recorded by the hash
+// of their chunks.
+package index
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/govice/golinks/blockmap"
+	"github.com/pkg/errors"
+)
+
+// Location is an archived path holding a searched hash
+type Location struct {
+	// Link is the link file the path is archived in
+	Link string `json:"link"`
+	// Time is the modification time of the link file
+	Time time.Time `json:"time"`
+	// Root is the root the link was generated from
+	Root string `json:"root"`
+	Path string `json:"path"`
+	// Algorithm is the file hash algorithm of the link
+	Algorithm string `json:"algorithm"`
+}
+
+// Index maps archived hashes to the links and paths holding them. An Index
+// is safe for concurrent use.
+type Index struct {
+	mu       sync.RWMutex
+	hashes   map[string][]Location
+	links    map[string]bool
+	screened int
+	screen   [][]byte
+}
+
+// New returns an empty index
+func New() *Index {
+	return &Index{
+		hashes: make(map[string][]Location),
+		links:  make(map[string]bool),
+	}
+}
+
+// SetScreen only loads link files whose bloom filter may hold one of hashes
+// when they are added. Links without a filter are always loaded. Lookups of
+// other hashes may miss locations in the skipped links.
+func (ix *Index) SetScreen(hashes ...[]byte) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.screen = hashes
+}
+
+// Screened returns the number of link files skipped by their bloom filter
+func (ix *Index) Screened() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return ix.screened
+}
+
+// Add indexes every file archived by b under the link name. Adding a link
+// already in the index does nothing.
+func (ix *Index) Add(link string, modTime time.Time, b *blockmap.BlockMap) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if ix.links[link] {
+		return
+	}
+	ix.links[link] = true
+
+	for path, hash := range b.Archive {
+		if blockmap.IsDirectory(path) {
+			continue
+		}
+		key := string(b.Digest(hash))
+		ix.hashes[key] = append(ix.hashes[key], Location{
+			Link:      link,
+			Time:      modTime,
+			Root:      b.Root,
+			Path:      path,
+			Algorithm: b.FileHash.String(),
+		})
+	}
+}
+
+// AddFile loads and indexes the link file at path unless its bloom filter
+// rules out every screened hash
+func (ix *Index) AddFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return errors.Wrap(err, "index: failed to stat link")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "index: failed to open link")
+	}
+	defer file.Close()
+
+	if ix.screenedOut(file) {
+		ix.mu.Lock()
+		ix.screened++
+		ix.mu.Unlock()
+		return nil
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrap(err, "index: failed to read link")
+	}
+
+	b := blockmap.New("")
+	if _, err := b.ReadFrom(file); err != nil {
+		return errors.Wrap(err, "index: failed to load "+path)
+	}
+	ix.Add(path, info.ModTime(), b)
+	return nil
+}
+
+// screenedOut returns true if the bloom filter of the link in r holds none of
+// the screened hashes
+func (ix *Index) screenedOut(r io.Reader) bool {
+	ix.mu.RLock()
+	screen := ix.screen
+	ix.mu.RUnlock()
+	if len(screen) == 0 {
+		return false
+	}
+
+	filter, err := blockmap.ReadBloomFilter(r)
+	if err != nil {
+		return false
+	}
+	for _, hash := range screen {
+		if filter.Contains(hash) {
+			return false
+		}
+	}
+	return true
+}
+
+// AddDir indexes every link file below dir, such as the link files of
+// generated roots and snapshot stores. Encrypted links can't be read and are
+// returned as skipped.
+func (ix *Index) AddDir(dir string) (skipped []string, err error) {
+	return walkLinks(dir, ix.AddFile)
+}
+
+// walkLinks calls addFile with every link file below dir, returning the
+// encrypted links addFile couldn't read as skipped
+func walkLinks(dir string, addFile func(path string) error) (skipped []string, err error) {
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(info.Name(), blockmap.OutputName) {
+			return nil
+		}
+		if err := addFile(path); errors.Cause(err) == blockmap.ErrEncryptedLink {
+			skipped = append(skipped, path)
+		} else if err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return skipped, errors.Wrap(err, "index: failed to index "+dir)
+	}
+	return skipped, nil
+}
+
+// Lookup returns every location of hash, oldest link first
+func (ix *Index) Lookup(hash []byte) []Location {
+	ix.mu.RLock()
+	locations := append([]Location{}, ix.hashes[string(hash)]...)
+	ix.mu.RUnlock()
+
+	sort.Slice(locations, func(i, j int) bool {
+		a, b := locations[i], locations[j]
+		if !a.Time.Equal(b.Time) {
+			return a.Time.Before(b.Time)
+		}
+		if a.Link != b.Link {
+			return a.Link < b.Link
+		}
+		return a.Path < b.Path
+	})
+	return locations
+}
+
+// Links returns the sorted names of the indexed links
+func (ix *Index) Links() []string {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	links := make([]string, 0, len(ix.links))
+	for link := range ix.links {
+		links = append(links, link)
+	}
+	sort.Strings(links)
+	return links
+}
@@ -0,0 +1,146 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/govice/golinks/blockmap"
+)
+
+func TestIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "root")
+	links := filepath.Join(dir, "links")
+	for _, d := range []string{root, links} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write := func(name, content string) {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	save := func(name string) *blockmap.BlockMap {
+		b := blockmap.New(root)
+		if err := b.Generate(); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.SaveNamed(links, name); err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	write("bad", "malware")
+	first := save("1")
+	write("bad", "cleaned")
+	write("copy", "malware")
+	second := save("2")
+	if err := os.Mkdir(filepath.Join(links, "encrypted"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.SaveEncrypted(filepath.Join(links, "encrypted"), []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+
+	ix := New()
+	skipped, err := ix.AddDir(links)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(skipped) != 1 {
+		t.Errorf("expected the encrypted link to be skipped, got %v", skipped)
+	}
+	if len(ix.Links()) != 2 {
+		t.Errorf("expected 2 indexed links, got %v", ix.Links())
+	}
+
+	locations := ix.Lookup(first.Archive["bad"])
+	if len(locations) != 2 {
+		t.Fatalf("expected 2 locations, got %v", locations)
+	}
+	if locations[0].Path != "bad" || locations[0].Link != filepath.Join(links, "1"+blockmap.OutputName) ||
+		locations[1].Path != "copy" || locations[1].Link != filepath.Join(links, "2"+blockmap.OutputName) {
+		t.Errorf("unexpected locations %v", locations)
+	}
+	if locations[0].Root != root || locations[0].Algorithm != "sha512" {
+		t.Errorf("unexpected location details %+v", locations[0])
+	}
+	if locations := ix.Lookup([]byte("unknown")); len(locations) != 0 {
+		t.Errorf("expected no locations, got %v", locations)
+	}
+
+	//Adding a link twice doesn't duplicate its locations
+	if err := ix.AddFile(filepath.Join(links, "1"+blockmap.OutputName)); err != nil {
+		t.Fatal(err)
+	}
+	if locations := ix.Lookup(first.Archive["bad"]); len(locations) != 2 {
+		t.Errorf("expected 2 locations, got %v", locations)
+	}
+}
+
+func TestIndex_Screen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var hashes [][]byte
+	for i, content := range []string{"a", "b", "c"} {
+		root := filepath.Join(dir, content)
+		if err := os.Mkdir(root, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(root, "file"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		b := blockmap.New(root)
+		if i < 2 {
+			b.SetBloomFilter(0.001)
+		}
+		if err := b.Generate(); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Save(root); err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, b.Archive["file"])
+	}
+
+	//Only the link of b is ruled out, c has no filter and is always loaded
+	ix := New()
+	ix.SetScreen(hashes[0])
+	if _, err := ix.AddDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if ix.Screened() != 1 || len(ix.Links()) != 2 {
+		t.Errorf("expected 1 screened and 2 loaded links, got %d %v", ix.Screened(), ix.Links())
+	}
+	if locations := ix.Lookup(hashes[0]); len(locations) != 1 || locations[0].Root != filepath.Join(dir, "a") {
+		t.Errorf("unexpected locations %v", locations)
+	}
+}
@@ -0,0 +1,212 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package index
+
+import (
+	"bytes"
+	"database/sql"
+	"os"
+	"time"
+
+	"github.com/govice/golinks/blockmap"
+	"github.com/govice/golinks/sqldb"
+	"github.com/pkg/errors"
+)
+
+// sqlMigrations is the schema of a SQL index. Links keep their manifests so
+// indexed snapshots can be restored from the database.
+var sqlMigrations = []sqldb.Migration{
+	{Version: 1, Statements: []string{
+		`CREATE TABLE golinks_links (
+			link TEXT PRIMARY KEY,
+			mod_time BIGINT NOT NULL,
+			root TEXT NOT NULL,
+			algorithm TEXT NOT NULL,
+			root_hash {blob},
+			manifest {blob} NOT NULL)`,
+		`CREATE TABLE golinks_files (
+			link TEXT NOT NULL,
+			path TEXT NOT NULL,
+			hash {blob} NOT NULL,
+			PRIMARY KEY (link, path))`,
+		`CREATE INDEX golinks_files_hash ON golinks_files (hash)`,
+	}},
+}
+
+// SQL is an index persisted in a PostgreSQL or SQLite database. Unlike an
+// Index it outlives the process, so links are loaded once and looked up by
+// any later search or by other tools querying the database.
+type SQL struct {
+	db      *sql.DB
+	dialect *sqldb.Dialect
+}
+
+// OpenSQL opens the database described by spec, see sqldb.Open, and returns
+// the index in it
+func OpenSQL(spec string) (*SQL, error) {
+	db, dialect, err := sqldb.Open(spec)
+	if err != nil {
+		return nil, err
+	}
+	ix, err := NewSQL(db, dialect)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return ix, nil
+}
+
+// NewSQL returns the index in db, migrating its schema. Closing the index
+// closes db.
+func NewSQL(db *sql.DB, dialect *sqldb.Dialect) (*SQL, error) {
+	if err := sqldb.Migrate(db, dialect, "index", sqlMigrations); err != nil {
+		return nil, err
+	}
+	return &SQL{db: db, dialect: dialect}, nil
+}
+
+// Add indexes every file archived by b under the link name and stores b's
+// manifest. Adding a link already in the index does nothing.
+func (ix *SQL) Add(link string, modTime time.Time, b *blockmap.BlockMap) error {
+	var manifest bytes.Buffer
+	if _, err := b.WriteTo(&manifest); err != nil {
+		return errors.Wrap(err, "index: failed to encode manifest")
+	}
+
+	tx, err := ix.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, "index: failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	var count int
+	if err := tx.QueryRow(ix.dialect.Rebind("SELECT COUNT(*) FROM golinks_links WHERE link = ?"), link).Scan(&count); err != nil {
+		return errors.Wrap(err, "index: failed to query links")
+	}
+	if count > 0 {
+		return nil
+	}
+	_, err = tx.Exec(ix.dialect.Rebind(`INSERT INTO golinks_links (link, mod_time, root, algorithm, root_hash, manifest)
+		VALUES (?, ?, ?, ?, ?, ?)`),
+		link, modTime.UnixNano(), b.Root, b.FileHash.String(), b.RootHash, manifest.Bytes())
+	if err != nil {
+		return errors.Wrap(err, "index: failed to store link")
+	}
+
+	insert, err := tx.Prepare(ix.dialect.Rebind("INSERT INTO golinks_files (link, path, hash) VALUES (?, ?, ?)"))
+	if err != nil {
+		return errors.Wrap(err, "index: failed to store files")
+	}
+	defer insert.Close()
+	for path, hash := range b.Archive {
+		if blockmap.IsDirectory(path) {
+			continue
+		}
+		if _, err := insert.Exec(link, path, b.Digest(hash)); err != nil {
+			return errors.Wrap(err, "index: failed to store "+path)
+		}
+	}
+	return errors.Wrap(tx.Commit(), "index: failed to commit link")
+}
+
+// AddFile loads and indexes the link file at path
+func (ix *SQL) AddFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return errors.Wrap(err, "index: failed to stat link")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "index: failed to open link")
+	}
+	defer file.Close()
+
+	b := blockmap.New("")
+	if _, err := b.ReadFrom(file); err != nil {
+		return errors.Wrap(err, "index: failed to load "+path)
+	}
+	return ix.Add(path, info.ModTime(), b)
+}
+
+// AddDir indexes every link file below dir. Encrypted links can't be read
+// and are returned as skipped.
+func (ix *SQL) AddDir(dir string) (skipped []string, err error) {
+	return walkLinks(dir, ix.AddFile)
+}
+
+// Lookup returns every location of hash, oldest link first
+func (ix *SQL) Lookup(hash []byte) ([]Location, error) {
+	rows, err := ix.db.Query(ix.dialect.Rebind(`SELECT l.link, l.mod_time, l.root, f.path, l.algorithm
+		FROM golinks_files f JOIN golinks_links l ON l.link = f.link
+		WHERE f.hash = ?
+		ORDER BY l.mod_time, l.link, f.path`), hash)
+	if err != nil {
+		return nil, errors.Wrap(err, "index: failed to query files")
+	}
+	defer rows.Close()
+	var locations []Location
+	for rows.Next() {
+		var location Location
+		var modTime int64
+		if err := rows.Scan(&location.Link, &modTime, &location.Root, &location.Path, &location.Algorithm); err != nil {
+			return nil, errors.Wrap(err, "index: failed to read files")
+		}
+		location.Time = time.Unix(0, modTime)
+		locations = append(locations, location)
+	}
+	return locations, errors.Wrap(rows.Err(), "index: failed to query files")
+}
+
+// Links returns the sorted names of the indexed links
+func (ix *SQL) Links() ([]string, error) {
+	rows, err := ix.db.Query("SELECT link FROM golinks_links ORDER BY link")
+	if err != nil {
+		return nil, errors.Wrap(err, "index: failed to query links")
+	}
+	defer rows.Close()
+	var links []string
+	for rows.Next() {
+		var link string
+		if err := rows.Scan(&link); err != nil {
+			return nil, errors.Wrap(err, "index: failed to read links")
+		}
+		links = append(links, link)
+	}
+	return links, errors.Wrap(rows.Err(), "index: failed to query links")
+}
+
+// Manifest returns the blockmap stored for link
+func (ix *SQL) Manifest(link string) (*blockmap.BlockMap, error) {
+	var manifest []byte
+	err := ix.db.QueryRow(ix.dialect.Rebind("SELECT manifest FROM golinks_links WHERE link = ?"), link).Scan(&manifest)
+	if err == sql.ErrNoRows {
+		return nil, errors.Errorf("index: link %s is not indexed", link)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "index: failed to read manifest")
+	}
+	b := blockmap.New("")
+	if _, err := b.ReadFrom(bytes.NewReader(manifest)); err != nil {
+		return nil, errors.Wrap(err, "index: failed to decode manifest")
+	}
+	return b, nil
+}
+
+// Close closes the underlying database
+func (ix *SQL) Close() error {
+	return ix.db.Close()
+}
@@ -0,0 +1,103 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package index
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/govice/golinks/blockmap"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestSQL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "root")
+	links := filepath.Join(dir, "links")
+	for _, d := range []string{root, links} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "bad"), []byte("malware"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	b := blockmap.New(root)
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SaveNamed(links, "1"); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(links, "1"+blockmap.OutputName)
+
+	spec := "sqlite3:" + filepath.Join(dir, "index.sqlite")
+	ix, err := OpenSQL(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ix.AddDir(links); err != nil {
+		t.Fatal(err)
+	}
+	//Adding a link twice doesn't duplicate its locations
+	if err := ix.AddFile(link); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	//The index outlives the process that built it
+	ix, err = OpenSQL(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ix.Close()
+	if names, err := ix.Links(); err != nil || len(names) != 1 || names[0] != link {
+		t.Errorf("unexpected links %v %v", names, err)
+	}
+	locations, err := ix.Lookup(b.Archive["bad"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locations) != 1 || locations[0].Path != "bad" || locations[0].Link != link ||
+		locations[0].Root != root || locations[0].Algorithm != "sha512" {
+		t.Errorf("unexpected locations %+v", locations)
+	}
+	if locations, err := ix.Lookup([]byte("unknown")); err != nil || len(locations) != 0 {
+		t.Errorf("expected no locations, got %v %v", locations, err)
+	}
+
+	manifest, err := ix.Manifest(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(manifest.RootHash, b.RootHash) {
+		t.Error("expected stored manifest to match the link")
+	}
+	if _, err := ix.Manifest("missing"); err == nil {
+		t.Error("expected missing manifest")
+	}
+}
@@ -0,0 +1,233 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+// Package ipfs computes IPFS content identifiers for files and pins data to
+// an IPFS node through its HTTP API.
+package ipfs
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"io"
+	"math/big"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// CIDVersion selects the CID format
+type CIDVersion int
+
+const (
+	// CIDv0 matches `ipfs add`: base58 dag-pb CIDs with UnixFS leaves
+	CIDv0 CIDVersion = 0
+	// CIDv1 matches `ipfs add --cid-version=1`: base32 CIDs with raw leaves
+	CIDv1 CIDVersion = 1
+)
+
+// Layout parameters matching the IPFS defaults of fixed 256KiB chunks in a
+// balanced DAG
+const (
+	ChunkSize = 256 * 1024
+	MaxLinks  = 174
+)
+
+// Multicodec codes used in CIDs
+const (
+	codecRaw   = 0x55
+	codecDagPB = 0x70
+	unixfsFile = 2
+)
+
+// ErrCIDVersion is returned for unknown CID versions
+var ErrCIDVersion = errors.New("ipfs: unsupported CID version")
+
+// Builder computes the CID a stream would be added to IPFS under. Data is
+// written to the builder and CID returns the identifier of everything
+// written so far.
+type Builder struct {
+	version CIDVersion
+	buf     []byte
+	leaves  []dagLink
+}
+
+// dagLink is a node in the DAG referenced by its parent
+type dagLink struct {
+	cid      []byte
+	fileSize uint64
+	tsize    uint64
+}
+
+// NewBuilder returns a builder producing CIDs of version
+func NewBuilder(version CIDVersion) (*Builder, error) {
+	if version != CIDv0 && version != CIDv1 {
+		return nil, errors.Wrapf(ErrCIDVersion, "%d", version)
+	}
+	return &Builder{version: version, buf: make([]byte, 0, ChunkSize)}, nil
+}
+
+// FileCID returns the CID of the data read from r
+func FileCID(r io.Reader, version CIDVersion) (string, error) {
+	b, err := NewBuilder(version)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(b, r); err != nil {
+		return "", errors.Wrap(err, "ipfs: failed to read data")
+	}
+	return b.CID(), nil
+}
+
+// Write adds p to the data being identified
+func (b *Builder) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		n := copy(b.buf[len(b.buf):ChunkSize], p)
+		b.buf, p = b.buf[:len(b.buf)+n], p[n:]
+		if len(b.buf) == ChunkSize {
+			b.leaves = append(b.leaves, b.leaf(b.buf))
+			b.buf = b.buf[:0]
+		}
+	}
+	return written, nil
+}
+
+// CID returns the string form of the CID of the data written so far
+func (b *Builder) CID() string {
+	level := b.leaves
+	if len(b.buf) > 0 || len(level) == 0 {
+		level = append(append([]dagLink{}, level...), b.leaf(b.buf))
+	}
+
+	//Group each level into parents of at most MaxLinks children until a
+	//single root remains, like the balanced layout of `ipfs add`
+	for len(level) > 1 {
+		var parents []dagLink
+		for start := 0; start < len(level); start += MaxLinks {
+			end := start + MaxLinks
+			if end > len(level) {
+				end = len(level)
+			}
+			parents = append(parents, b.node(level[start:end]))
+		}
+		level = parents
+	}
+
+	if b.version == CIDv0 {
+		return base58(level[0].cid)
+	}
+	return "b" + strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(level[0].cid))
+}
+
+// leaf returns the link to a chunk of file data
+func (b *Builder) leaf(chunk []byte) dagLink {
+	size := uint64(len(chunk))
+	if b.version == CIDv1 {
+		return dagLink{cid: b.cid(codecRaw, chunk), fileSize: size, tsize: size}
+	}
+	block := encodeNode(nil, encodeUnixFS(chunk, size, nil))
+	return dagLink{cid: b.cid(codecDagPB, block), fileSize: size, tsize: uint64(len(block))}
+}
+
+// node returns the link to an internal node over children
+func (b *Builder) node(children []dagLink) dagLink {
+	var fileSize, tsize uint64
+	blockSizes := make([]uint64, len(children))
+	for i, child := range children {
+		fileSize += child.fileSize
+		tsize += child.tsize
+		blockSizes[i] = child.fileSize
+	}
+	block := encodeNode(children, encodeUnixFS(nil, fileSize, blockSizes))
+	return dagLink{cid: b.cid(codecDagPB, block), fileSize: fileSize, tsize: tsize + uint64(len(block))}
+}
+
+// cid returns the binary CID of a block
+func (b *Builder) cid(codec uint64, block []byte) []byte {
+	digest := sha256.Sum256(block)
+	multihash := Multihash(MultihashSHA256, digest[:])
+	if b.version == CIDv0 {
+		return multihash
+	}
+	cid := appendVarint(appendVarint(nil, uint64(CIDv1)), codec)
+	return append(cid, multihash...)
+}
+
+// encodeNode encodes a dag-pb node, links first as required by the format
+func encodeNode(links []dagLink, data []byte) []byte {
+	var node []byte
+	for _, link := range links {
+		var encoded []byte
+		encoded = appendBytesField(encoded, 1, link.cid)
+		encoded = appendBytesField(encoded, 2, nil)
+		encoded = appendVarintField(encoded, 3, link.tsize)
+		node = appendBytesField(node, 2, encoded)
+	}
+	return appendBytesField(node, 1, data)
+}
+
+// encodeUnixFS encodes the UnixFS metadata of a file node
+func encodeUnixFS(data []byte, fileSize uint64, blockSizes []uint64) []byte {
+	encoded := appendVarintField(nil, 1, unixfsFile)
+	if len(data) > 0 {
+		encoded = appendBytesField(encoded, 2, data)
+	}
+	encoded = appendVarintField(encoded, 3, fileSize)
+	for _, size := range blockSizes {
+		encoded = appendVarintField(encoded, 4, size)
+	}
+	return encoded
+}
+
+func appendVarint(buf []byte, v uint64) []byte {
+	for v >= 0x80 {
+		buf = append(buf, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(buf, byte(v))
+}
+
+func appendVarintField(buf []byte, field int, v uint64) []byte {
+	return appendVarint(appendVarint(buf, uint64(field)<<3), v)
+}
+
+func appendBytesField(buf []byte, field int, data []byte) []byte {
+	buf = appendVarint(appendVarint(buf, uint64(field)<<3|2), uint64(len(data)))
+	return append(buf, data...)
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// base58 encodes data with the bitcoin alphabet used by CIDv0
+func base58(data []byte) string {
+	n := new(big.Int).SetBytes(data)
+	radix, mod := big.NewInt(58), new(big.Int)
+	var encoded []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		encoded = append(encoded, base58Alphabet[mod.Int64()])
+	}
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		encoded = append(encoded, base58Alphabet[0])
+	}
+	for i, j := 0, len(encoded)-1; i < j; i, j = i+1, j-1 {
+		encoded[i], encoded[j] = encoded[j], encoded[i]
+	}
+	return string(encoded)
+}
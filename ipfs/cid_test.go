@@ -0,0 +1,103 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package ipfs
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func testData(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	return data
+}
+
+func TestFileCID(t *testing.T) {
+	//Expected CIDs were produced by the go-unixfs balanced importer used by `ipfs add`
+	tests := []struct {
+		size int
+		v0   string
+		v1   string
+	}{
+		{0, "QmbFMke1KXqnYyBBWxB74N4c5SBnJMVAiMNRcGu6x1AwQH", "bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku"},
+		{5, "Qma4sWyoTiJKYx1wTjkxWY71dYg1oWgE7SE9oiTGqGnyoR", "bafkreiaixnpf23vkyecj5xqispjq5ubcwgsntnnurw2bjby7khe4wnjihu"},
+		{ChunkSize, "QmeqfRyS3vkku7n6krqC3DgGMex3x2sCpSeKMDmrG13QQq", "bafkreibruh455iawsviqslif5c7uurdcfdemh22mtnytyzvnzn75kpejxy"},
+		{ChunkSize + 1, "QmUSjGawaz4ptvREcMKSMJneWCa5j8dAz2wSAAvHtW2rnB", "bafybeiexg2oqkfnj56l7fcmawswqbijt5shq4b5rg6a546uwpkqqzwjioi"},
+		{1000000, "QmVUbzigHKQR2y8wSt2KwZp92AC9Utfms5nEUHwttK4Yq9", "bafybeibx62obrkybp46hx3ivh53q4rnptgkunpgtwiib5lfelfgt2ekihm"},
+		{MaxLinks*ChunkSize + 1, "QmTedsTekQQkgACJXb1sPZSW8bLdS9LPMrT7L4YdjNRd4n", "bafybeib4y7ghw2rq7bracc4xwtxrbzo7cfvagdpte2tmrkgwl6dyard3cm"},
+	}
+	for _, tt := range tests {
+		data := testData(tt.size)
+		for version, expected := range []string{tt.v0, tt.v1} {
+			cid, err := FileCID(bytes.NewReader(data), CIDVersion(version))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cid != expected {
+				t.Errorf("CIDv%d of %d bytes is %s, expected %s", version, tt.size, cid, expected)
+			}
+		}
+	}
+
+	if _, err := FileCID(bytes.NewReader(nil), 2); !errors.Is(err, ErrCIDVersion) {
+		t.Error("expected ErrCIDVersion, got", err)
+	}
+}
+
+func TestBuilder_Write(t *testing.T) {
+	data := testData(3*ChunkSize + 17)
+	b, err := NewBuilder(CIDv1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//CIDs don't depend on how the data is split between writes
+	for offset := 0; offset < len(data); offset += 100000 {
+		end := offset + 100000
+		if end > len(data) {
+			end = len(data)
+		}
+		b.Write(data[offset:end])
+	}
+	expected, err := FileCID(bytes.NewReader(data), CIDv1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cid := b.CID(); cid != expected || b.CID() != expected {
+		t.Errorf("builder CID %s does not match %s", cid, expected)
+	}
+}
+
+func TestMultihash(t *testing.T) {
+	digest := testData(64)
+	mh := Multihash(MultihashSHA512, digest)
+	if !bytes.Equal(mh[:2], []byte{MultihashSHA512, 64}) {
+		t.Errorf("unexpected multihash prefix %x", mh[:2])
+	}
+	code, decoded, err := DecodeMultihash(mh)
+	if err != nil || code != MultihashSHA512 || !bytes.Equal(decoded, digest) {
+		t.Errorf("DecodeMultihash = %x, %x, %v", code, decoded, err)
+	}
+	for _, malformed := range [][]byte{nil, {0x13}, {0x13, 64, 1}, append(mh, 0)} {
+		if _, _, err := DecodeMultihash(malformed); !errors.Is(err, ErrMultihash) {
+			t.Errorf("expected ErrMultihash decoding %x, got %v", malformed, err)
+		}
+	}
+}
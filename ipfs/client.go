@@ -0,0 +1,159 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package ipfs
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultAPI is the address of a local IPFS node's HTTP API
+const DefaultAPI = "http://127.0.0.1:5001"
+
+// Client adds and pins data through an IPFS node's HTTP API
+type Client struct {
+	api        *url.URL
+	httpClient *http.Client
+}
+
+// NewClient returns a client for the node API at api, such as DefaultAPI
+func NewClient(api string) (*Client, error) {
+	u, err := url.Parse(api)
+	if err != nil {
+		return nil, errors.Wrap(err, "ipfs: invalid API address")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, errors.New("ipfs: API address must be an http or https URL")
+	}
+	return &Client{api: u, httpClient: http.DefaultClient}, nil
+}
+
+// SetHTTPClient sets the HTTP client used for requests
+func (c *Client) SetHTTPClient(client *http.Client) {
+	c.httpClient = client
+}
+
+// Add adds the data read from r to the node as a file named name, pins it
+// and returns its CID
+func (c *Client) Add(ctx context.Context, name string, r io.Reader, version CIDVersion) (string, error) {
+	if version != CIDv0 && version != CIDv1 {
+		return "", errors.Wrapf(ErrCIDVersion, "%d", version)
+	}
+	body, contentType := multipartFile(name, r)
+	query := url.Values{
+		"pin":         {"true"},
+		"cid-version": {strconv.Itoa(int(version))},
+		"raw-leaves":  {strconv.FormatBool(version == CIDv1)},
+		"chunker":     {"size-" + strconv.Itoa(ChunkSize)},
+	}
+	resp, err := c.post(ctx, "add", query, body, contentType)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	//The response is a stream of JSON objects ending with the added file
+	var added addedObject
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var object addedObject
+		if err := decoder.Decode(&object); err == io.EOF {
+			break
+		} else if err != nil {
+			return "", errors.Wrap(err, "ipfs: failed to decode add response")
+		}
+		if object.Hash != "" {
+			added = object
+		}
+	}
+	if added.Hash == "" {
+		return "", errors.New("ipfs: add response did not include a CID")
+	}
+	return added.Hash, nil
+}
+
+// addedObject is an entry of an add response
+type addedObject struct {
+	Name string
+	Hash string
+}
+
+// Pin pins the content identified by cid on the node
+func (c *Client) Pin(ctx context.Context, cid string) error {
+	resp, err := c.post(ctx, "pin/add", url.Values{"arg": {cid}}, nil, "")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// post calls an API command, converting error responses to errors
+func (c *Client) post(ctx context.Context, command string, query url.Values, body io.Reader, contentType string) (*http.Response, error) {
+	u := *c.api
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/api/v0/" + command
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequest(http.MethodPost, u.String(), body)
+	if err != nil {
+		return nil, errors.Wrap(err, "ipfs: failed to create request")
+	}
+	req = req.WithContext(ctx)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "ipfs: request failed")
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	var apiErr struct{ Message string }
+	if json.Unmarshal(data, &apiErr) != nil || apiErr.Message == "" {
+		apiErr.Message = strings.TrimSpace(string(data))
+	}
+	return nil, errors.Errorf("ipfs: %s failed with status %d: %s", command, resp.StatusCode, apiErr.Message)
+}
+
+// multipartFile streams r as a single file part of a multipart body
+func multipartFile(name string, r io.Reader) (io.Reader, string) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		part, err := mw.CreateFormFile("file", name)
+		if err == nil {
+			_, err = io.Copy(part, r)
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr, mw.FormDataContentType()
+}
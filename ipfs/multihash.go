@@ -0,0 +1,55 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package ipfs
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+// Multihash codes of common hashes
+const (
+	MultihashSHA256 = 0x12
+	MultihashSHA512 = 0x13
+	MultihashSHA384 = 0x20
+	MultihashBLAKE3 = 0x1e
+)
+
+// ErrMultihash is returned when decoding a malformed multihash
+var ErrMultihash = errors.New("ipfs: malformed multihash")
+
+// Multihash encodes digest as a multihash, the varint code of the hash and
+// length of the digest followed by the digest, so it names its algorithm
+func Multihash(code uint64, digest []byte) []byte {
+	encoded := appendVarint(nil, code)
+	encoded = appendVarint(encoded, uint64(len(digest)))
+	return append(encoded, digest...)
+}
+
+// DecodeMultihash returns the hash code and digest of a multihash
+func DecodeMultihash(mh []byte) (uint64, []byte, error) {
+	code, n := binary.Uvarint(mh)
+	if n <= 0 {
+		return 0, nil, ErrMultihash
+	}
+	size, m := binary.Uvarint(mh[n:])
+	if m <= 0 || uint64(len(mh)-n-m) != size {
+		return 0, nil, ErrMultihash
+	}
+	return code, mh[n+m:], nil
+}
@@ -0,0 +1,354 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package keys
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// AWSCredentials are the access keys requests to AWS are signed with
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// AWSKMS is the provider of asymmetric AWS KMS keys, named
+// [endpoint]/<key id, alias or ARN> as in awskms:///alias/golinks. Requests
+// are signed with Signature Version 4 using the credentials from
+// $AWS_ACCESS_KEY_ID, $AWS_SECRET_ACCESS_KEY and $AWS_SESSION_TOKEN unless
+// set. The region is taken from the key ARN, $AWS_REGION or
+// $AWS_DEFAULT_REGION.
+type AWSKMS struct {
+	endpoint    string
+	region      string
+	credentials *AWSCredentials
+	httpClient  *http.Client
+}
+
+// NewAWSKMS returns a provider configured from the environment
+func NewAWSKMS() *AWSKMS {
+	return &AWSKMS{httpClient: http.DefaultClient}
+}
+
+// SetEndpoint sets the KMS endpoint URL, overriding the regional endpoint
+// and endpoints named in references
+func (k *AWSKMS) SetEndpoint(endpoint string) {
+	k.endpoint = endpoint
+}
+
+// SetRegion sets the region of keys named without an ARN
+func (k *AWSKMS) SetRegion(region string) {
+	k.region = region
+}
+
+// SetCredentials sets the credentials requests are signed with
+func (k *AWSKMS) SetCredentials(credentials AWSCredentials) {
+	k.credentials = &credentials
+}
+
+// SetHTTPClient sets the HTTP client used for requests
+func (k *AWSKMS) SetHTTPClient(client *http.Client) {
+	k.httpClient = client
+}
+
+// Signer returns the SIGN_VERIFY key named name
+func (k *AWSKMS) Signer(ctx context.Context, name string) (Signer, error) {
+	key, err := k.open(ctx, name, "SIGN_VERIFY")
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Decrypter returns the ENCRYPT_DECRYPT key named name
+func (k *AWSKMS) Decrypter(ctx context.Context, name string) (Decrypter, error) {
+	key, err := k.open(ctx, name, "ENCRYPT_DECRYPT")
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (k *AWSKMS) open(ctx context.Context, name, usage string) (*awsKey, error) {
+	i := strings.Index(name, "/")
+	if i < 0 || i == len(name)-1 {
+		return nil, errors.Errorf("keys: AWS KMS key %q is not of the form [endpoint]/key", name)
+	}
+	host, keyID := name[:i], name[i+1:]
+
+	region := k.region
+	if parts := strings.Split(keyID, ":"); strings.HasPrefix(keyID, "arn:") && len(parts) > 3 {
+		region = parts[3]
+	}
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		return nil, errors.New("keys: no AWS region, set $AWS_REGION or use a key ARN")
+	}
+
+	endpoint := k.endpoint
+	switch {
+	case endpoint != "":
+	case host != "":
+		endpoint = "https://" + host
+	default:
+		endpoint = "https://kms." + region + ".amazonaws.com"
+	}
+	key := &awsKey{kms: k, keyID: keyID, region: region, endpoint: endpoint}
+
+	var out struct {
+		PublicKey []byte
+		KeyUsage  string
+	}
+	if err := key.call(ctx, "GetPublicKey", map[string]interface{}{"KeyId": keyID}, &out); err != nil {
+		return nil, err
+	}
+	if out.KeyUsage != usage {
+		return nil, errors.Wrapf(ErrUnsupported, "AWS KMS key %s is for %s", keyID, out.KeyUsage)
+	}
+	public, err := x509.ParsePKIXPublicKey(out.PublicKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "keys: failed to parse AWS KMS public key")
+	}
+	key.public = public
+	return key, nil
+}
+
+func (k *AWSKMS) getCredentials() (AWSCredentials, error) {
+	if k.credentials != nil {
+		return *k.credentials, nil
+	}
+	credentials := AWSCredentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if credentials.AccessKeyID == "" || credentials.SecretAccessKey == "" {
+		return credentials, errors.New("keys: no AWS credentials, set $AWS_ACCESS_KEY_ID and $AWS_SECRET_ACCESS_KEY")
+	}
+	return credentials, nil
+}
+
+// awsKey is an AWS KMS key, used through the KMS API
+type awsKey struct {
+	kms      *AWSKMS
+	keyID    string
+	region   string
+	endpoint string
+	public   crypto.PublicKey
+}
+
+func (k *awsKey) Public() crypto.PublicKey {
+	return k.public
+}
+
+// Sign signs a digest with the key. ECDSA keys sign SHA256, SHA384 and SHA512
+// digests, RSA keys sign with PKCS #1 v1.5 or with PSS for *rsa.PSSOptions.
+func (k *awsKey) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	suffix := map[crypto.Hash]string{crypto.SHA256: "SHA_256", crypto.SHA384: "SHA_384", crypto.SHA512: "SHA_512"}[opts.HashFunc()]
+	if suffix == "" {
+		return nil, errors.Wrapf(ErrUnsupported, "AWS KMS can't sign %v digests", opts.HashFunc())
+	}
+	var algorithm string
+	switch k.public.(type) {
+	case *ecdsa.PublicKey:
+		algorithm = "ECDSA_" + suffix
+	case *rsa.PublicKey:
+		algorithm = "RSASSA_PKCS1_V1_5_" + suffix
+		if _, ok := opts.(*rsa.PSSOptions); ok {
+			algorithm = "RSASSA_PSS_" + suffix
+		}
+	default:
+		return nil, errors.Wrapf(ErrUnsupported, "AWS KMS can't sign with %T", k.public)
+	}
+
+	var out struct{ Signature []byte }
+	err := k.call(context.Background(), "Sign", map[string]interface{}{
+		"KeyId":            k.keyID,
+		"Message":          digest,
+		"MessageType":      "DIGEST",
+		"SigningAlgorithm": algorithm,
+	}, &out)
+	return out.Signature, err
+}
+
+// Decrypt decrypts msg encrypted to the key with RSA-OAEP using SHA1 or
+// SHA256. KMS doesn't support OAEP labels.
+func (k *awsKey) Decrypt(rand io.Reader, msg []byte, opts crypto.DecrypterOpts) ([]byte, error) {
+	oaep, ok := opts.(*rsa.OAEPOptions)
+	if !ok {
+		return nil, errors.Wrap(ErrUnsupported, "AWS KMS only decrypts RSA-OAEP")
+	}
+	if len(oaep.Label) > 0 {
+		return nil, errors.Wrap(ErrUnsupported, "AWS KMS doesn't support OAEP labels")
+	}
+	algorithm := map[crypto.Hash]string{crypto.SHA1: "RSAES_OAEP_SHA_1", crypto.SHA256: "RSAES_OAEP_SHA_256"}[oaep.Hash]
+	if algorithm == "" {
+		return nil, errors.Wrapf(ErrUnsupported, "AWS KMS can't decrypt OAEP with %v", oaep.Hash)
+	}
+
+	var out struct{ Plaintext []byte }
+	err := k.call(context.Background(), "Decrypt", map[string]interface{}{
+		"KeyId":               k.keyID,
+		"CiphertextBlob":      msg,
+		"EncryptionAlgorithm": algorithm,
+	}, &out)
+	return out.Plaintext, err
+}
+
+// call calls a KMS JSON API action
+func (k *awsKey) call(ctx context.Context, action string, in, out interface{}) error {
+	credentials, err := k.kms.getCredentials()
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(in)
+	if err != nil {
+		return errors.Wrap(err, "keys: failed to encode AWS KMS request")
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(k.endpoint, "/")+"/", bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "keys: invalid AWS KMS endpoint")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+action)
+	signV4(req, body, credentials, k.region, "kms", time.Now())
+
+	resp, err := k.kms.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "keys: AWS KMS request failed")
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "keys: failed to read AWS KMS response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &apiErr) != nil || apiErr.Type == "" {
+			apiErr.Message = strings.TrimSpace(string(data))
+		}
+		return errors.Errorf("keys: AWS KMS %s returned status %d: %s %s", action, resp.StatusCode, apiErr.Type, apiErr.Message)
+	}
+	return errors.Wrap(json.Unmarshal(data, out), "keys: failed to decode AWS KMS response")
+}
+
+// signV4 signs req with AWS Signature Version 4, covering every header set on
+// the request
+func signV4(req *http.Request, body []byte, credentials AWSCredentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if credentials.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", credentials.SessionToken)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.Join(values, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	payloadHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + credentials.SecretAccessKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+credentials.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func canonicalQuery(query url.Values) string {
+	var params []string
+	for name, values := range query {
+		for _, value := range values {
+			params = append(params, awsEscape(name)+"="+awsEscape(value))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// awsEscape percent encodes everything but unreserved characters
+func awsEscape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,93 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package keys
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+// File is the provider of PEM encoded private keys in files, named by path
+type File struct{}
+
+// Signer reads the private key at path
+func (File) Signer(ctx context.Context, path string) (Signer, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "keys: failed to read key")
+	}
+	return ParseSigner(data)
+}
+
+// Decrypter reads the private key at path
+func (File) Decrypter(ctx context.Context, path string) (Decrypter, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "keys: failed to read key")
+	}
+	return ParseDecrypter(data)
+}
+
+// ParsePrivateKey parses the first PEM block of data as a PKCS8, PKCS1 RSA or
+// SEC1 EC private key
+func ParsePrivateKey(data []byte) (crypto.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("keys: no PEM block found")
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		return key, errors.Wrap(err, "keys: failed to parse RSA key")
+	case "EC PRIVATE KEY":
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		return key, errors.Wrap(err, "keys: failed to parse EC key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	return key, errors.Wrap(err, "keys: failed to parse private key")
+}
+
+// ParseSigner parses a PEM encoded private key that can sign
+func ParseSigner(data []byte) (Signer, error) {
+	key, err := ParsePrivateKey(data)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.Wrapf(ErrUnsupported, "%T can't sign", key)
+	}
+	return signer, nil
+}
+
+// ParseDecrypter parses a PEM encoded private key that can decrypt, an RSA key
+func ParseDecrypter(data []byte) (Decrypter, error) {
+	key, err := ParsePrivateKey(data)
+	if err != nil {
+		return nil, err
+	}
+	decrypter, ok := key.(crypto.Decrypter)
+	if !ok {
+		return nil, errors.Wrapf(ErrUnsupported, "%T can't decrypt", key)
+	}
+	return decrypter, nil
+}
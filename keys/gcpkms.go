@@ -0,0 +1,255 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package keys
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultGCPKMS is the address of the Google Cloud KMS API
+const DefaultGCPKMS = "https://cloudkms.googleapis.com"
+
+// gcpMetadataToken is the metadata server endpoint issuing access tokens for
+// the default service account of Google Cloud machines
+const gcpMetadataToken = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// GCPKMS is the provider of asymmetric Google Cloud KMS key versions, named by
+// resource name as in
+// gcpkms://projects/p/locations/l/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1.
+// Requests are authorized with $GOOGLE_OAUTH_ACCESS_TOKEN, or a token of the
+// machine's service account from the metadata server.
+type GCPKMS struct {
+	endpoint   string
+	token      func(ctx context.Context) (string, error)
+	httpClient *http.Client
+}
+
+// NewGCPKMS returns a provider configured from the environment
+func NewGCPKMS() *GCPKMS {
+	k := &GCPKMS{endpoint: DefaultGCPKMS, httpClient: http.DefaultClient}
+	k.token = k.defaultToken
+	return k
+}
+
+// SetEndpoint sets the KMS API address
+func (k *GCPKMS) SetEndpoint(endpoint string) {
+	k.endpoint = endpoint
+}
+
+// SetTokenSource sets the function returning OAuth access tokens for requests
+func (k *GCPKMS) SetTokenSource(token func(ctx context.Context) (string, error)) {
+	k.token = token
+}
+
+// SetHTTPClient sets the HTTP client used for requests
+func (k *GCPKMS) SetHTTPClient(client *http.Client) {
+	k.httpClient = client
+}
+
+// Signer returns the ASYMMETRIC_SIGN key version named name
+func (k *GCPKMS) Signer(ctx context.Context, name string) (Signer, error) {
+	key, err := k.open(ctx, name, "_SIGN_")
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Decrypter returns the ASYMMETRIC_DECRYPT key version named name
+func (k *GCPKMS) Decrypter(ctx context.Context, name string) (Decrypter, error) {
+	key, err := k.open(ctx, name, "_DECRYPT_")
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (k *GCPKMS) open(ctx context.Context, name, purpose string) (*gcpKey, error) {
+	if !strings.HasPrefix(name, "projects/") || !strings.Contains(name, "/cryptoKeyVersions/") {
+		return nil, errors.Errorf("keys: GCP KMS key %q is not a key version resource name", name)
+	}
+	key := &gcpKey{kms: k, name: name}
+	var out struct {
+		Pem       string `json:"pem"`
+		Algorithm string `json:"algorithm"`
+	}
+	if err := key.call(ctx, "getPublicKey", nil, &out); err != nil {
+		return nil, err
+	}
+	//Algorithms are named like EC_SIGN_P256_SHA256 and RSA_DECRYPT_OAEP_2048_SHA256
+	if !strings.Contains(out.Algorithm, purpose) {
+		return nil, errors.Wrapf(ErrUnsupported, "GCP KMS key %s uses %s", name, out.Algorithm)
+	}
+	block, _ := pem.Decode([]byte(out.Pem))
+	if block == nil {
+		return nil, errors.New("keys: GCP KMS returned no public key")
+	}
+	public, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "keys: failed to parse GCP KMS public key")
+	}
+	key.public = public
+	key.algorithm = out.Algorithm
+	return key, nil
+}
+
+func (k *GCPKMS) defaultToken(ctx context.Context) (string, error) {
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+	req, err := http.NewRequest(http.MethodGet, gcpMetadataToken, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "keys: failed to create token request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := k.httpClient.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "keys: no GCP access token, set $GOOGLE_OAUTH_ACCESS_TOKEN")
+	}
+	defer resp.Body.Close()
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("keys: metadata server returned status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil || token.AccessToken == "" {
+		return "", errors.New("keys: metadata server returned no access token")
+	}
+	return token.AccessToken, nil
+}
+
+// gcpKey is a Google Cloud KMS key version, used through the KMS API
+type gcpKey struct {
+	kms       *GCPKMS
+	name      string
+	algorithm string
+	public    crypto.PublicKey
+}
+
+func (k *gcpKey) Public() crypto.PublicKey {
+	return k.public
+}
+
+// Sign signs a digest with the key version. The digest must be of the hash
+// its algorithm names.
+func (k *gcpKey) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	field := map[crypto.Hash]string{crypto.SHA256: "sha256", crypto.SHA384: "sha384", crypto.SHA512: "sha512"}[opts.HashFunc()]
+	if field == "" || !strings.HasSuffix(k.algorithm, strings.ToUpper(field)) {
+		return nil, errors.Wrapf(ErrUnsupported, "GCP KMS key %s can't sign %v digests", k.algorithm, opts.HashFunc())
+	}
+	_, pss := opts.(*rsa.PSSOptions)
+	if strings.HasPrefix(k.algorithm, "RSA_") && pss != strings.Contains(k.algorithm, "_PSS_") {
+		return nil, errors.Wrapf(ErrUnsupported, "GCP KMS key %s can't sign with the requested padding", k.algorithm)
+	}
+
+	var out struct {
+		Signature []byte `json:"signature"`
+	}
+	err := k.call(context.Background(), "asymmetricSign", map[string]interface{}{
+		"digest": map[string][]byte{field: digest},
+	}, &out)
+	return out.Signature, err
+}
+
+// Decrypt decrypts msg encrypted to the key version with RSA-OAEP using the
+// hash its algorithm names. KMS doesn't support OAEP labels.
+func (k *gcpKey) Decrypt(rand io.Reader, msg []byte, opts crypto.DecrypterOpts) ([]byte, error) {
+	oaep, ok := opts.(*rsa.OAEPOptions)
+	if !ok {
+		return nil, errors.Wrap(ErrUnsupported, "GCP KMS only decrypts RSA-OAEP")
+	}
+	if len(oaep.Label) > 0 {
+		return nil, errors.Wrap(ErrUnsupported, "GCP KMS doesn't support OAEP labels")
+	}
+	hash := map[crypto.Hash]string{crypto.SHA1: "SHA1", crypto.SHA256: "SHA256", crypto.SHA512: "SHA512"}[oaep.Hash]
+	if hash == "" || !strings.HasSuffix(k.algorithm, "_"+hash) {
+		return nil, errors.Wrapf(ErrUnsupported, "GCP KMS key %s can't decrypt OAEP with %v", k.algorithm, oaep.Hash)
+	}
+
+	var out struct {
+		Plaintext []byte `json:"plaintext"`
+	}
+	err := k.call(context.Background(), "asymmetricDecrypt", map[string]interface{}{"ciphertext": msg}, &out)
+	return out.Plaintext, err
+}
+
+// call calls a method of the key version, POSTing in or GETting without it
+func (k *gcpKey) call(ctx context.Context, method string, in, out interface{}) error {
+	token, err := k.kms.token(ctx)
+	if err != nil {
+		return err
+	}
+	httpMethod, body := http.MethodGet, []byte(nil)
+	if in != nil {
+		httpMethod = http.MethodPost
+		if body, err = json.Marshal(in); err != nil {
+			return errors.Wrap(err, "keys: failed to encode GCP KMS request")
+		}
+	}
+	u := strings.TrimSuffix(k.kms.endpoint, "/") + "/v1/" + k.name
+	if method == "getPublicKey" {
+		u += "/publicKey"
+	} else {
+		u += ":" + method
+	}
+	req, err := http.NewRequest(httpMethod, u, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "keys: invalid GCP KMS endpoint")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := k.kms.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "keys: GCP KMS request failed")
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "keys: failed to read GCP KMS response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if json.Unmarshal(data, &apiErr) != nil || apiErr.Error.Message == "" {
+			apiErr.Error.Message = strings.TrimSpace(string(data))
+		}
+		return errors.Errorf("keys: GCP KMS %s returned status %d: %s", method, resp.StatusCode, apiErr.Error.Message)
+	}
+	return errors.Wrap(json.Unmarshal(data, out), "keys: failed to decode GCP KMS response")
+}
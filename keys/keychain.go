@@ -0,0 +1,101 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package keys
+
+import (
+	"context"
+	"encoding/hex"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Keychain is the provider of PEM encoded private keys stored as passwords in
+// the OS keychain, named service/account. It uses the security tool on macOS
+// and secret-tool (libsecret) elsewhere.
+type Keychain struct {
+	run func(ctx context.Context, name string, args ...string) ([]byte, error)
+}
+
+// NewKeychain returns a provider running the keychain tools
+func NewKeychain() *Keychain {
+	return &Keychain{run: runCommand}
+}
+
+// SetCommandRunner sets the function running the keychain tools and returning
+// their output
+func (k *Keychain) SetCommandRunner(run func(ctx context.Context, name string, args ...string) ([]byte, error)) {
+	k.run = run
+}
+
+// Signer reads the private key stored for service/account
+func (k *Keychain) Signer(ctx context.Context, name string) (Signer, error) {
+	data, err := k.lookup(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSigner(data)
+}
+
+// Decrypter reads the private key stored for service/account
+func (k *Keychain) Decrypter(ctx context.Context, name string) (Decrypter, error) {
+	data, err := k.lookup(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return ParseDecrypter(data)
+}
+
+func (k *Keychain) lookup(ctx context.Context, name string) ([]byte, error) {
+	i := strings.Index(name, "/")
+	if i <= 0 || i == len(name)-1 {
+		return nil, errors.Errorf("keys: keychain key %q is not of the form service/account", name)
+	}
+	service, account := name[:i], name[i+1:]
+
+	var (
+		data []byte
+		err  error
+	)
+	switch runtime.GOOS {
+	case "darwin":
+		data, err = k.run(ctx, "security", "find-generic-password", "-s", service, "-a", account, "-w")
+	case "windows":
+		return nil, errors.New("keys: the keychain provider isn't supported on windows")
+	default:
+		data, err = k.run(ctx, "secret-tool", "lookup", "service", service, "account", account)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "keys: failed to read key from keychain")
+	}
+	value := strings.TrimSpace(string(data))
+	//security prints passwords with newlines, such as PEM keys, hex encoded
+	if decoded, err := hex.DecodeString(value); err == nil && strings.HasPrefix(string(decoded), "-----BEGIN") {
+		value = string(decoded)
+	}
+	return []byte(value + "\n"), nil
+}
+
+func runCommand(ctx context.Context, name string, args ...string) ([]byte, error) {
+	out, err := exec.CommandContext(ctx, name, args...).Output()
+	if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+		return nil, errors.Errorf("%s: %s", name, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return out, err
+}
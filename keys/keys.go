@@ -0,0 +1,133 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+// Package keys resolves the private keys golinks signs and decrypts with from
+// pluggable providers, so every signing and encryption feature accepts the
+// same key references. A reference is either a PEM file path or a URI naming
+// a provider: keychain://service/account for the OS keychain,
+// awskms:///<key id or ARN> for AWS KMS and gcpkms://projects/.../cryptoKeyVersions/N
+// for Google Cloud KMS. Keys held by KMS never leave it.
+package keys
+
+import (
+	"context"
+	"crypto"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrUnknownProvider is returned for references to unregistered providers
+	ErrUnknownProvider = errors.New("keys: unknown key provider")
+	// ErrUnsupported is returned when a key can't be used for an operation,
+	// such as decrypting with an ECDSA key
+	ErrUnsupported = errors.New("keys: operation not supported by key")
+)
+
+// Signer signs digests with a private key that may never leave its provider.
+// It is satisfied by crypto.Signer.
+type Signer interface {
+	Public() crypto.PublicKey
+	Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error)
+}
+
+// Decrypter decrypts with a private key that may never leave its provider.
+// It is satisfied by crypto.Decrypter.
+type Decrypter interface {
+	Public() crypto.PublicKey
+	Decrypt(rand io.Reader, msg []byte, opts crypto.DecrypterOpts) ([]byte, error)
+}
+
+// Provider resolves the names of keys it holds, the part of a reference after
+// "scheme://"
+type Provider interface {
+	Signer(ctx context.Context, name string) (Signer, error)
+	Decrypter(ctx context.Context, name string) (Decrypter, error)
+}
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]Provider{
+		"file":     File{},
+		"keychain": NewKeychain(),
+		"awskms":   NewAWSKMS(),
+		"gcpkms":   NewGCPKMS(),
+	}
+)
+
+// Register makes a provider available to references with scheme, replacing
+// any provider registered for it
+func Register(scheme string, p Provider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[scheme] = p
+}
+
+// Schemes returns the sorted schemes of the registered providers
+func Schemes() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	schemes := make([]string, 0, len(providers))
+	for scheme := range providers {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// OpenSigner returns the signer of a key reference
+func OpenSigner(ctx context.Context, ref string) (Signer, error) {
+	p, name, err := resolve(ref)
+	if err != nil {
+		return nil, err
+	}
+	return p.Signer(ctx, name)
+}
+
+// OpenDecrypter returns the decrypter of a key reference
+func OpenDecrypter(ctx context.Context, ref string) (Decrypter, error) {
+	p, name, err := resolve(ref)
+	if err != nil {
+		return nil, err
+	}
+	return p.Decrypter(ctx, name)
+}
+
+// IsReference returns true if ref names a provider rather than a file path
+func IsReference(ref string) bool {
+	return strings.Contains(ref, "://")
+}
+
+func resolve(ref string) (Provider, string, error) {
+	scheme, name := "file", ref
+	if i := strings.Index(ref, "://"); i >= 0 {
+		scheme, name = ref[:i], ref[i+len("://"):]
+	}
+	if name == "" {
+		return nil, "", errors.Errorf("keys: reference %q names no key", ref)
+	}
+	providersMu.RLock()
+	p, ok := providers[scheme]
+	providersMu.RUnlock()
+	if !ok {
+		return nil, "", errors.Wrap(ErrUnknownProvider, scheme)
+	}
+	return p, name, nil
+}
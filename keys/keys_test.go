@@ -0,0 +1,312 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package keys
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func pemKey(t *testing.T, key crypto.PrivateKey) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func TestOpenSigner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec1, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"ec.pem":    pemKey(t, ecKey),
+		"sec1.pem":  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1}),
+		"pkcs1.pem": pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}),
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	digest := sha256.Sum256([]byte("root hash"))
+	for _, ref := range []string{filepath.Join(dir, "ec.pem"), "file://" + filepath.Join(dir, "sec1.pem")} {
+		signer, err := OpenSigner(context.Background(), ref)
+		if err != nil {
+			t.Fatal(ref, err)
+		}
+		signature, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ecdsa.VerifyASN1(&ecKey.PublicKey, digest[:], signature) {
+			t.Error("invalid signature from", ref)
+		}
+	}
+	if _, err := OpenDecrypter(context.Background(), filepath.Join(dir, "ec.pem")); !errors.Is(err, ErrUnsupported) {
+		t.Error("expected EC keys not to decrypt, got", err)
+	}
+
+	decrypter, err := OpenDecrypter(context.Background(), filepath.Join(dir, "pkcs1.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, &rsaKey.PublicKey, []byte("file key"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := decrypter.Decrypt(rand.Reader, ciphertext, &rsa.OAEPOptions{Hash: crypto.SHA256})
+	if err != nil || string(plaintext) != "file key" {
+		t.Error("failed to decrypt with file key", err)
+	}
+
+	if _, err := OpenSigner(context.Background(), "vault://golinks"); !errors.Is(err, ErrUnknownProvider) {
+		t.Error("expected unknown provider error, got", err)
+	}
+}
+
+func TestKeychain(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keychain := NewKeychain()
+	keychain.SetCommandRunner(func(ctx context.Context, name string, args ...string) ([]byte, error) {
+		if !strings.Contains(strings.Join(args, " "), "golinks") || !strings.Contains(strings.Join(args, " "), "release") {
+			t.Errorf("unexpected lookup %s %v", name, args)
+		}
+		//macOS prints multi-line passwords hex encoded
+		return []byte(hex.EncodeToString(pemKey(t, key)) + "\n"), nil
+	})
+	Register("keychain-test", keychain)
+
+	signer, err := OpenSigner(context.Background(), "keychain-test://golinks/release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !signer.Public().(*ecdsa.PublicKey).Equal(&key.PublicKey) {
+		t.Error("keychain returned the wrong key")
+	}
+	if _, err := OpenSigner(context.Background(), "keychain-test://golinks"); err == nil {
+		t.Error("expected error without an account")
+	}
+}
+
+func TestSignV4(t *testing.T) {
+	//The example request of the AWS Signature Version 4 documentation
+	req, err := http.NewRequest(http.MethodGet, "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	credentials := AWSCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signV4(req, nil, credentials, "us-east-1", "iam", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, " +
+		"SignedHeaders=content-type;host;x-amz-date, " +
+		"Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7"
+	if got := req.Header.Get("Authorization"); got != expected {
+		t.Errorf("unexpected authorization\n got %s\nwant %s", got, expected)
+	}
+}
+
+func TestAWSKMS(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+			t.Error("request isn't signed")
+		}
+		var in struct {
+			KeyId                                 string
+			Message, CiphertextBlob               []byte
+			SigningAlgorithm, EncryptionAlgorithm string
+		}
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			t.Error(err)
+		}
+		var out interface{}
+		switch r.Header.Get("X-Amz-Target") {
+		case "TrentService.GetPublicKey":
+			var public crypto.PublicKey = &ecKey.PublicKey
+			usage := "SIGN_VERIFY"
+			if in.KeyId == "alias/decrypt" {
+				public, usage = &rsaKey.PublicKey, "ENCRYPT_DECRYPT"
+			}
+			der, _ := x509.MarshalPKIXPublicKey(public)
+			out = map[string]interface{}{"PublicKey": der, "KeyUsage": usage}
+		case "TrentService.Sign":
+			if in.SigningAlgorithm != "ECDSA_SHA_256" {
+				t.Error("unexpected signing algorithm", in.SigningAlgorithm)
+			}
+			signature, _ := ecdsa.SignASN1(rand.Reader, ecKey, in.Message)
+			out = map[string]interface{}{"Signature": signature}
+		case "TrentService.Decrypt":
+			plaintext, err := rsa.DecryptOAEP(sha256.New(), nil, rsaKey, in.CiphertextBlob, nil)
+			if err != nil || in.EncryptionAlgorithm != "RSAES_OAEP_SHA_256" {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"__type": "InvalidCiphertextException"})
+				return
+			}
+			out = map[string]interface{}{"Plaintext": plaintext}
+		}
+		json.NewEncoder(w).Encode(out)
+	}))
+	defer server.Close()
+
+	k := NewAWSKMS()
+	k.SetEndpoint(server.URL)
+	k.SetRegion("eu-west-1")
+	k.SetCredentials(AWSCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret"})
+	Register("awskms-test", k)
+
+	signer, err := OpenSigner(context.Background(), "awskms-test:///alias/sign")
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte("root hash"))
+	signature, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ecdsa.VerifyASN1(&ecKey.PublicKey, digest[:], signature) {
+		t.Error("invalid KMS signature")
+	}
+	if _, err := OpenDecrypter(context.Background(), "awskms-test:///alias/sign"); !errors.Is(err, ErrUnsupported) {
+		t.Error("expected signing key not to decrypt, got", err)
+	}
+
+	decrypter, err := OpenDecrypter(context.Background(), "awskms-test:///alias/decrypt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, _ := rsa.EncryptOAEP(sha256.New(), rand.Reader, &rsaKey.PublicKey, []byte("file key"), nil)
+	plaintext, err := decrypter.Decrypt(rand.Reader, ciphertext, &rsa.OAEPOptions{Hash: crypto.SHA256})
+	if err != nil || string(plaintext) != "file key" {
+		t.Error("failed to decrypt with KMS", err)
+	}
+	if _, err := decrypter.Decrypt(rand.Reader, ciphertext, &rsa.OAEPOptions{Hash: crypto.SHA256, Label: []byte("label")}); !errors.Is(err, ErrUnsupported) {
+		t.Error("expected OAEP labels to be unsupported, got", err)
+	}
+	if _, err := decrypter.Decrypt(rand.Reader, []byte("garbage"), &rsa.OAEPOptions{Hash: crypto.SHA256}); err == nil || !strings.Contains(err.Error(), "InvalidCiphertextException") {
+		t.Error("expected KMS error, got", err)
+	}
+}
+
+func TestGCPKMS(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const name = "projects/p/locations/global/keyRings/golinks/cryptoKeys/release/cryptoKeyVersions/1"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]string{"message": "unauthenticated"}})
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/" + name + "/publicKey":
+			der, _ := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+			json.NewEncoder(w).Encode(map[string]string{
+				"pem":       string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+				"algorithm": "EC_SIGN_P256_SHA256",
+			})
+		case "/v1/" + name + ":asymmetricSign":
+			var in struct {
+				Digest struct{ Sha256 []byte } `json:"digest"`
+			}
+			json.NewDecoder(r.Body).Decode(&in)
+			signature, _ := ecdsa.SignASN1(rand.Reader, ecKey, in.Digest.Sha256)
+			json.NewEncoder(w).Encode(map[string][]byte{"signature": signature})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	k := NewGCPKMS()
+	k.SetEndpoint(server.URL)
+	k.SetTokenSource(func(ctx context.Context) (string, error) { return "token", nil })
+	Register("gcpkms-test", k)
+
+	signer, err := OpenSigner(context.Background(), "gcpkms-test://"+name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte("root hash"))
+	signature, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ecdsa.VerifyASN1(&ecKey.PublicKey, digest[:], signature) {
+		t.Error("invalid KMS signature")
+	}
+	if _, err := signer.Sign(rand.Reader, digest[:], crypto.SHA384); !errors.Is(err, ErrUnsupported) {
+		t.Error("expected mismatched digest to be unsupported, got", err)
+	}
+	if _, err := OpenDecrypter(context.Background(), "gcpkms-test://"+name); !errors.Is(err, ErrUnsupported) {
+		t.Error("expected signing key not to decrypt, got", err)
+	}
+
+	k.SetTokenSource(func(ctx context.Context) (string, error) { return "expired", nil })
+	if _, err := OpenSigner(context.Background(), "gcpkms-test://"+name); err == nil || !strings.Contains(err.Error(), "unauthenticated") {
+		t.Error("expected authorization error, got", err)
+	}
+}
@@ -0,0 +1,186 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+// Package light is a chain client that keeps only block headers. It verifies
+// each new block against the previous header and then drops the block's data,
+// and verifies merkle inclusion proofs of individual files against the
+// merkle roots recorded in its headers, so verification agents on small
+// devices can follow a chain without storing it.
+package light
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"github.com/govice/golinks/block"
+	"github.com/govice/golinks/blockchain"
+	"github.com/govice/golinks/blockmap"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrBadBlock is returned when a block doesn't extend the client's headers
+	ErrBadBlock = errors.New("light: block does not extend the chain")
+	// ErrNoMerkleRoot is returned when verifying a file against a block that
+	// didn't record a merkle root, see blockchain.Blockchain.AddWithMerkleRoot
+	ErrNoMerkleRoot = errors.New("light: block has no merkle root")
+	// ErrBadProof is returned when a file proof doesn't resolve to a block's
+	// merkle root or doesn't prove the expected file
+	ErrBadProof = errors.New("light: invalid file proof")
+)
+
+// Header is the part of a block kept by the client. MerkleRoot is the merkle
+// root recorded by the block's link payload, if any.
+type Header struct {
+	Index      int    `json:"index"`
+	Timestamp  int64  `json:"timestamp"`
+	ParentHash []byte `json:"parentHash"`
+	RootHash   []byte `json:"rootHash,omitempty"`
+	MerkleRoot []byte `json:"merkleRoot,omitempty"`
+	BlockHash  []byte `json:"blockHash"`
+}
+
+// Source provides chain blocks by index, returning blockchain.ErrBlockNotFound
+// past the chain head. A blockchain.Store is a Source.
+type Source interface {
+	BlockAt(index int) (*block.Block, error)
+}
+
+// Client follows a chain from a trusted block, holding only headers
+type Client struct {
+	headers []Header
+}
+
+// New returns a client trusting blk, such as the chain's genesis block or a
+// checkpointed block, as the first header
+func New(trusted *block.Block) (*Client, error) {
+	header, err := verifiedHeader(trusted)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{headers: []Header{header}}, nil
+}
+
+// verifiedHeader rehashes blk and returns its header
+func verifiedHeader(blk *block.Block) (Header, error) {
+	if err := blk.VerifySHA512(); err != nil {
+		return Header{}, errors.Wrapf(ErrBadBlock, "block %d: %v", blk.Index, err)
+	}
+	header := Header{
+		Index:      blk.Index,
+		Timestamp:  blk.Timestamp,
+		ParentHash: append([]byte{}, blk.ParentHash...),
+		RootHash:   append([]byte(nil), blk.RootHash...),
+		BlockHash:  append([]byte{}, blk.BlockHash...),
+	}
+	if payload, err := blk.Payload(); err == nil {
+		if link, ok := payload.(*block.LinkPayload); ok {
+			header.MerkleRoot = link.MerkleRoot
+		}
+	}
+	return header, nil
+}
+
+// Head returns the latest verified header
+func (c *Client) Head() Header {
+	return c.headers[len(c.headers)-1]
+}
+
+// Header returns the verified header of the block at index
+func (c *Client) Header(index int) (Header, error) {
+	i := index - c.headers[0].Index
+	if i < 0 || i >= len(c.headers) {
+		return Header{}, blockchain.ErrBlockNotFound
+	}
+	return c.headers[i], nil
+}
+
+// Append verifies blk extends the head and adds its header
+func (c *Client) Append(blk *block.Block) error {
+	head := c.Head()
+	if blk.Index != head.Index+1 || !bytes.Equal(blk.ParentHash, head.BlockHash) {
+		return errors.Wrapf(ErrBadBlock, "block %d", blk.Index)
+	}
+	header, err := verifiedHeader(blk)
+	if err != nil {
+		return err
+	}
+	c.headers = append(c.headers, header)
+	return nil
+}
+
+// Sync appends every block source holds past the head, returning the number
+// of blocks appended
+func (c *Client) Sync(source Source) (int, error) {
+	appended := 0
+	for {
+		blk, err := source.BlockAt(c.Head().Index + 1)
+		if errors.Cause(err) == blockchain.ErrBlockNotFound {
+			return appended, nil
+		} else if err != nil {
+			return appended, errors.Wrap(err, "light: failed to fetch block")
+		}
+		if err := c.Append(blk); err != nil {
+			return appended, err
+		}
+		appended++
+	}
+}
+
+// VerifyFile checks proof shows the file at path with the archived hash is
+// part of the blockmap recorded by the block at index
+func (c *Client) VerifyFile(index int, path string, hash []byte, proof *blockmap.MerkleProof) error {
+	header, err := c.Header(index)
+	if err != nil {
+		return err
+	}
+	if len(header.MerkleRoot) == 0 {
+		return errors.Wrapf(ErrNoMerkleRoot, "block %d", index)
+	}
+	if proof == nil || proof.Path != path || !bytes.Equal(proof.Hash, hash) || !blockmap.VerifyProof(header.MerkleRoot, proof) {
+		return errors.Wrap(ErrBadProof, path)
+	}
+	return nil
+}
+
+// WriteTo writes the client's headers to w as JSON
+func (c *Client) WriteTo(w io.Writer) (int64, error) {
+	data, err := json.Marshal(c.headers)
+	if err != nil {
+		return 0, errors.Wrap(err, "light: failed to encode headers")
+	}
+	n, err := w.Write(data)
+	return int64(n), errors.Wrap(err, "light: failed to write headers")
+}
+
+// Read loads a client from headers written by WriteTo. Stored headers are
+// trusted, only their linkage is checked.
+func Read(r io.Reader) (*Client, error) {
+	var headers []Header
+	if err := json.NewDecoder(r).Decode(&headers); err != nil {
+		return nil, errors.Wrap(err, "light: failed to decode headers")
+	}
+	if len(headers) == 0 {
+		return nil, errors.New("light: no headers stored")
+	}
+	for i := 1; i < len(headers); i++ {
+		if headers[i].Index != headers[i-1].Index+1 || !bytes.Equal(headers[i].ParentHash, headers[i-1].BlockHash) {
+			return nil, errors.Wrapf(ErrBadBlock, "stored header %d", headers[i].Index)
+		}
+	}
+	return &Client{headers: headers}, nil
+}
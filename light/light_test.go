@@ -0,0 +1,110 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package light
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/govice/golinks/block"
+	"github.com/govice/golinks/blockchain"
+	"github.com/govice/golinks/blockmap"
+)
+
+func TestClient_Sync(t *testing.T) {
+	root, err := ioutil.TempDir("", "light")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for _, name := range []string{"a", "b", "c"} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b := blockmap.New(root)
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+
+	genesis := block.NewSHA512Genesis()
+	store := blockchain.NewMemoryStore()
+	chain, err := blockchain.Open(store, genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chain.AddWithMerkleRoot(b); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chain.Add(b); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := New(genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := client.Sync(store); err != nil || n != 2 {
+		t.Fatalf("expected 2 synced blocks, got %d %v", n, err)
+	}
+	if head := client.Head(); head.Index != 2 || !bytes.Equal(head.BlockHash, chain.At(2).BlockHash) {
+		t.Error("unexpected head", head)
+	}
+
+	proof, err := b.Proof("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.VerifyFile(1, "b", b.Archive["b"], proof); err != nil {
+		t.Error(err)
+	}
+	if err := client.VerifyFile(1, "b", []byte("tampered"), proof); !errors.Is(err, ErrBadProof) {
+		t.Error("expected bad proof, got", err)
+	}
+	if err := client.VerifyFile(1, "a", b.Archive["b"], proof); !errors.Is(err, ErrBadProof) {
+		t.Error("expected bad proof, got", err)
+	}
+	if err := client.VerifyFile(2, "b", b.Archive["b"], proof); !errors.Is(err, ErrNoMerkleRoot) {
+		t.Error("expected missing merkle root, got", err)
+	}
+
+	//Headers survive a round trip and blocks that don't extend them are rejected
+	var saved bytes.Buffer
+	if _, err := client.WriteTo(&saved); err != nil {
+		t.Fatal(err)
+	}
+	client, err = Read(&saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.VerifyFile(1, "b", b.Archive["b"], proof); err != nil {
+		t.Error(err)
+	}
+	forged := *block.NewSHA512(3, []byte("forged"), []byte("garbage"))
+	if err := client.Append(&forged); !errors.Is(err, ErrBadBlock) {
+		t.Error("expected bad block, got", err)
+	}
+	tampered := *block.NewSHA512(3, []byte("tampered"), chain.At(2).BlockHash)
+	tampered.Data = []byte("changed")
+	if err := client.Append(&tampered); !errors.Is(err, ErrBadBlock) {
+		t.Error("expected bad block, got", err)
+	}
+}
@@ -0,0 +1,123 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+// Package logging defines the leveled, structured logger used by golinks
+// packages so library consumers control where their output goes.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log message
+type Level int
+
+// Log levels in increasing severity
+const (
+	Debug Level = iota
+	Info
+	Warn
+	Error
+)
+
+func (l Level) String() string {
+	switch l {
+	case Debug:
+		return "DEBUG"
+	case Info:
+		return "INFO"
+	case Warn:
+		return "WARN"
+	case Error:
+		return "ERROR"
+	}
+	return "LEVEL(" + strconv.Itoa(int(l)) + ")"
+}
+
+// Field is a key value pair attached to a log message
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F returns a field for key and value
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Logger receives log messages. Implementations must be safe for
+// concurrent use.
+type Logger interface {
+	Log(level Level, msg string, fields ...Field)
+}
+
+// Func adapts a function to a Logger
+type Func func(level Level, msg string, fields ...Field)
+
+// Log calls f
+func (f Func) Log(level Level, msg string, fields ...Field) {
+	f(level, msg, fields...)
+}
+
+// Discard is a Logger dropping every message. It's the default logger of
+// every golinks package.
+var Discard Logger = Func(func(Level, string, ...Field) {})
+
+// textLogger writes messages at or above a minimum level as lines of text
+type textLogger struct {
+	mu  sync.Mutex
+	w   io.Writer
+	min Level
+	now func() time.Time
+}
+
+// New returns a Logger writing messages at or above min to w, one line per
+// message formatted as "time LEVEL message key=value ...". Values containing
+// spaces or quotes are quoted.
+func New(w io.Writer, min Level) Logger {
+	return &textLogger{w: w, min: min, now: time.Now}
+}
+
+func (l *textLogger) Log(level Level, msg string, fields ...Field) {
+	if level < l.min {
+		return
+	}
+	var sb strings.Builder
+	sb.WriteString(l.now().UTC().Format(time.RFC3339))
+	sb.WriteString(" " + level.String() + " " + msg)
+	for _, field := range fields {
+		sb.WriteString(" " + field.Key + "=" + formatValue(field.Value))
+	}
+	sb.WriteByte('\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	io.WriteString(l.w, sb.String())
+}
+
+// formatValue formats a field value, quoting it when needed
+func formatValue(value interface{}) string {
+	s := fmt.Sprint(value)
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
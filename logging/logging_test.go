@@ -0,0 +1,58 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package logging
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, Info).(*textLogger)
+	logger.now = func() time.Time { return time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	logger.Log(Debug, "dropped")
+	logger.Log(Info, "hashed", F("path", "a b"), F("size", 12), F("empty", ""))
+	logger.Log(Error, "failed")
+
+	want := "2019-01-02T03:04:05Z INFO hashed path=\"a b\" size=12 empty=\"\"\n" +
+		"2019-01-02T03:04:05Z ERROR failed\n"
+	if buf.String() != want {
+		t.Errorf("unexpected output %q, want %q", buf.String(), want)
+	}
+}
+
+func TestFunc(t *testing.T) {
+	var got []string
+	logger := Func(func(level Level, msg string, fields ...Field) {
+		got = append(got, level.String()+" "+msg)
+	})
+	logger.Log(Warn, "skipped", F("path", "a"))
+	Discard.Log(Error, "dropped")
+	if strings.Join(got, ",") != "WARN skipped" {
+		t.Errorf("unexpected messages %v", got)
+	}
+}
+
+func TestLevel_String(t *testing.T) {
+	if Level(7).String() != "LEVEL(7)" {
+		t.Errorf("unexpected level %s", Level(7))
+	}
+}
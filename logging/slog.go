@@ -0,0 +1,48 @@
+//go:build go1.21
+// +build go1.21
+
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+// FromSlog returns a Logger writing to a log/slog logger
+func FromSlog(logger *slog.Logger) Logger {
+	return Func(func(level Level, msg string, fields ...Field) {
+		attrs := make([]slog.Attr, len(fields))
+		for i, field := range fields {
+			attrs[i] = slog.Any(field.Key, field.Value)
+		}
+		logger.LogAttrs(context.Background(), slogLevel(level), msg, attrs...)
+	})
+}
+
+func slogLevel(level Level) slog.Level {
+	switch level {
+	case Debug:
+		return slog.LevelDebug
+	case Info:
+		return slog.LevelInfo
+	case Warn:
+		return slog.LevelWarn
+	}
+	return slog.LevelError
+}
@@ -0,0 +1,40 @@
+//go:build go1.21
+// +build go1.21
+
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestFromSlog(t *testing.T) {
+	var buf bytes.Buffer
+	handler := slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo})
+	logger := FromSlog(slog.New(handler))
+
+	logger.Log(Debug, "dropped")
+	logger.Log(Warn, "skipped", F("path", "a"))
+	out := buf.String()
+	if strings.Contains(out, "dropped") || !strings.Contains(out, "level=WARN msg=skipped path=a") {
+		t.Errorf("unexpected output %q", out)
+	}
+}
@@ -0,0 +1,219 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package manifest
+
+import (
+	"encoding/hex"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// hashdeepHeader starts every hashdeep audit file
+const hashdeepHeader = "%%%% HASHDEEP-1.0"
+
+// bsdTags maps BSD tagged digest names to algorithms
+var bsdTags = map[string]Algorithm{
+	"MD5":    MD5,
+	"SHA1":   SHA1,
+	"SHA256": SHA256,
+	"SHA384": SHA384,
+	"SHA512": SHA512,
+}
+
+// ParseSums reads a checksum file written by md5sum, sha1sum, sha256sum,
+// sha384sum or sha512sum, in either the default or the BSD tagged format. The algorithm
+// is inferred from the first line and every line must use the same one.
+func ParseSums(r io.Reader) (*Manifest, error) {
+	m := &Manifest{}
+	err := readLines(r, func(line string) error {
+		path, algorithm, sum, err := parseSumLine(line)
+		if err != nil {
+			return err
+		}
+		if m.Algorithm == "" {
+			m.Algorithm = algorithm
+		} else if algorithm != m.Algorithm {
+			return errors.Wrapf(ErrFormat, "mixed %s and %s digests", m.Algorithm, algorithm)
+		}
+		hash, err := hex.DecodeString(sum)
+		if err != nil {
+			return ErrFormat
+		}
+		return m.add(path, hash)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// parseSumLine splits a checksum line into its path, algorithm and hex digest
+func parseSumLine(line string) (string, Algorithm, string, error) {
+	escaped := strings.HasPrefix(line, "\\")
+	if escaped {
+		line = line[1:]
+	}
+
+	var (
+		path, sum string
+		algorithm Algorithm
+	)
+	if open := strings.Index(line, " ("); open > 0 && bsdTags[line[:open]] != "" {
+		end := strings.LastIndex(line, ") = ")
+		if end < open+2 {
+			return "", "", "", ErrFormat
+		}
+		path, sum, algorithm = line[open+2:end], line[end+len(") = "):], bsdTags[line[:open]]
+	} else {
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 || len(fields[1]) < 2 {
+			return "", "", "", ErrFormat
+		}
+		//The second separator character is '*' for binary mode
+		sum, path = fields[0], fields[1][1:]
+		algorithm = algorithmForLength(len(sum) / 2)
+		if algorithm == "" || len(sum)%2 != 0 {
+			return "", "", "", ErrFormat
+		}
+	}
+
+	if escaped {
+		var err error
+		if path, err = unescapeSumPath(path); err != nil {
+			return "", "", "", err
+		}
+	}
+	return path, algorithm, sum, nil
+}
+
+// algorithmForLength returns the supported algorithm producing digests of
+// size bytes
+func algorithmForLength(size int) Algorithm {
+	for _, algorithm := range []Algorithm{MD5, SHA1, SHA256, SHA384, SHA512} {
+		if algorithm.Size() == size {
+			return algorithm
+		}
+	}
+	return ""
+}
+
+// unescapeSumPath reverses the coreutils escaping of backslashes and newlines
+func unescapeSumPath(path string) (string, error) {
+	var sb strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] != '\\' {
+			sb.WriteByte(path[i])
+			continue
+		}
+		if i++; i == len(path) {
+			return "", ErrFormat
+		}
+		switch path[i] {
+		case '\\':
+			sb.WriteByte('\\')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		default:
+			return "", ErrFormat
+		}
+	}
+	return sb.String(), nil
+}
+
+// ParseBagIt reads a BagIt payload or tag manifest using algorithm. Paths
+// are relative to the bag's base directory, so payload files keep their
+// data/ prefix.
+func ParseBagIt(r io.Reader, algorithm Algorithm) (*Manifest, error) {
+	m := &Manifest{Algorithm: Algorithm(strings.ToLower(string(algorithm)))}
+	if _, err := m.Algorithm.New(); err != nil {
+		return nil, err
+	}
+	decoder := strings.NewReplacer("%0A", "\n", "%0a", "\n", "%0D", "\r", "%0d", "\r", "%25", "%")
+	err := readLines(r, func(line string) error {
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 {
+			return ErrFormat
+		}
+		hash, err := hex.DecodeString(fields[0])
+		if err != nil {
+			return ErrFormat
+		}
+		path := strings.TrimLeft(fields[1], " \t")
+		return m.add(decoder.Replace(path), hash)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ParseHashdeep reads a hashdeep audit file. When the audit records several
+// digests the strongest supported one is used.
+func ParseHashdeep(r io.Reader) (*Manifest, error) {
+	m := &Manifest{}
+	column := -1
+	var columns int
+	err := readLines(r, func(line string) error {
+		switch {
+		case strings.HasPrefix(line, "##"):
+			return nil
+		case line == hashdeepHeader:
+			return nil
+		case strings.HasPrefix(line, "%%%% "):
+			names := strings.Split(strings.TrimPrefix(line, "%%%% "), ",")
+			if len(names) < 3 || names[0] != "size" || names[len(names)-1] != "filename" {
+				return ErrFormat
+			}
+			columns = len(names)
+			for i, name := range names[1 : len(names)-1] {
+				algorithm := Algorithm(name)
+				if algorithm.Size() > m.Algorithm.Size() {
+					m.Algorithm, column = algorithm, i+1
+				}
+			}
+			if column < 0 {
+				return errors.Wrap(ErrUnsupportedAlgorithm, strings.Join(names[1:len(names)-1], ","))
+			}
+			return nil
+		}
+
+		if column < 0 {
+			return errors.Wrap(ErrFormat, "missing hashdeep header")
+		}
+		//File names may contain commas so only split off the leading columns
+		fields := strings.SplitN(line, ",", columns)
+		if len(fields) != columns {
+			return ErrFormat
+		}
+		hash, err := hex.DecodeString(fields[column])
+		if err != nil {
+			return ErrFormat
+		}
+		return m.add(fields[columns-1], hash)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if column < 0 {
+		return nil, errors.Wrap(ErrFormat, "missing hashdeep header")
+	}
+	return m, nil
+}
@@ -0,0 +1,242 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+// Package manifest reads checksum manifests written by other tools and
+// verifies directory trees against them.
+package manifest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/govice/golinks/archivemap"
+	"github.com/govice/golinks/fs"
+	"github.com/govice/golinks/walker"
+	"github.com/pkg/errors"
+)
+
+// Algorithm names the digest used by a manifest
+type Algorithm string
+
+// Supported manifest digest algorithms
+const (
+	MD5    Algorithm = "md5"
+	SHA1   Algorithm = "sha1"
+	SHA256 Algorithm = "sha256"
+	SHA384 Algorithm = "sha384"
+	SHA512 Algorithm = "sha512"
+)
+
+var (
+	// ErrUnsupportedAlgorithm is returned for manifests using a digest
+	// this package can't compute
+	ErrUnsupportedAlgorithm = errors.New("manifest: unsupported algorithm")
+	// ErrFormat is returned when a manifest line can't be parsed
+	ErrFormat = errors.New("manifest: malformed line")
+)
+
+// New returns a constructor for the algorithm's hash
+func (a Algorithm) New() (func() hash.Hash, error) {
+	switch a {
+	case MD5:
+		return md5.New, nil
+	case SHA1:
+		return sha1.New, nil
+	case SHA256:
+		return sha256.New, nil
+	case SHA384:
+		return sha512.New384, nil
+	case SHA512:
+		return sha512.New, nil
+	}
+	return nil, errors.Wrap(ErrUnsupportedAlgorithm, string(a))
+}
+
+// Size returns the digest length in bytes, or 0 for unsupported algorithms
+func (a Algorithm) Size() int {
+	newHash, err := a.New()
+	if err != nil {
+		return 0
+	}
+	return newHash().Size()
+}
+
+// Manifest is a set of file digests produced by an external tool. Archive
+// keys use forward slashes and are relative to the manifest's base
+// directory unless the manifest recorded absolute paths.
+type Manifest struct {
+	Algorithm Algorithm
+	Archive   archivemap.ArchiveMap
+}
+
+// Report describes how a directory differs from a manifest
+type Report struct {
+	// Missing are manifest paths not present under the root
+	Missing []string `json:"missing"`
+	// Modified are manifest paths whose digest changed
+	Modified []string `json:"modified"`
+	// Added are files under the root not listed in the manifest
+	Added []string `json:"added"`
+}
+
+// Valid returns true if every file listed in the manifest is present and
+// unchanged. Files missing from the manifest don't invalidate it since
+// manifests such as BagIt payload manifests only cover part of a tree.
+func (r *Report) Valid() bool {
+	return len(r.Missing) == 0 && len(r.Modified) == 0
+}
+
+// Open reads the manifest at path, choosing the parser from its name and
+// contents. BagIt manifests are recognized by their manifest-<algorithm>.txt
+// name, hashdeep audit files by their header and anything else is read as
+// md5sum style checksums.
+func Open(path string) (*Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "manifest: failed to open "+path)
+	}
+	defer f.Close()
+
+	name := filepath.Base(path)
+	for _, prefix := range []string{"manifest-", "tagmanifest-"} {
+		if strings.HasPrefix(name, prefix) && strings.HasSuffix(name, ".txt") {
+			algorithm := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".txt")
+			return ParseBagIt(f, Algorithm(algorithm))
+		}
+	}
+
+	r := bufio.NewReader(f)
+	if header, _ := r.Peek(len(hashdeepHeader)); bytes.Equal(header, []byte(hashdeepHeader)) {
+		return ParseHashdeep(r)
+	}
+	return ParseSums(r)
+}
+
+// Verify hashes the files under root listed in the manifest with the
+// manifest's algorithm and reports any differences. Absolute manifest
+// paths are resolved against root.
+func (m *Manifest) Verify(root string) (*Report, error) {
+	newHash, err := m.Algorithm.New()
+	if err != nil {
+		return nil, err
+	}
+	hasher := fs.NewHasher(fs.DefaultBufferSize)
+	hasher.New = newHash
+
+	expected, err := m.relativeTo(root)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{}
+	seen := make(map[string]bool)
+	w := walker.New(root)
+	err = w.WalkFunc(func(filePath string, info os.FileInfo) error {
+		relPath, err := filepath.Rel(w.Root(), filePath)
+		if err != nil {
+			return errors.Wrap(err, "manifest: failed to extract relative file path")
+		}
+		relPath = filepath.ToSlash(relPath)
+
+		want, ok := expected[relPath]
+		if !ok {
+			report.Added = append(report.Added, relPath)
+			return nil
+		}
+		seen[relPath] = true
+		got, err := hasher.HashFile(filePath)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(got, want) {
+			report.Modified = append(report.Modified, relPath)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "manifest: failed to walk "+root)
+	}
+
+	for path := range expected {
+		if !seen[path] {
+			report.Missing = append(report.Missing, path)
+		}
+	}
+	sort.Strings(report.Missing)
+	sort.Strings(report.Modified)
+	sort.Strings(report.Added)
+	return report, nil
+}
+
+// relativeTo returns the manifest's archive keyed relative to root
+func (m *Manifest) relativeTo(root string) (archivemap.ArchiveMap, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, errors.Wrap(err, "manifest: failed to resolve "+root)
+	}
+	archive := make(archivemap.ArchiveMap, len(m.Archive))
+	for path, hash := range m.Archive {
+		if filepath.IsAbs(filepath.FromSlash(path)) {
+			rel, err := filepath.Rel(absRoot, filepath.FromSlash(path))
+			if err != nil {
+				return nil, errors.Wrap(err, "manifest: failed to resolve "+path)
+			}
+			path = filepath.ToSlash(rel)
+		}
+		archive[path] = hash
+	}
+	return archive, nil
+}
+
+// add records a parsed digest, validating its length against the algorithm
+func (m *Manifest) add(path string, hash []byte) error {
+	if path == "" || len(hash) != m.Algorithm.Size() {
+		return ErrFormat
+	}
+	path = strings.TrimPrefix(path, "./")
+	if m.Archive == nil {
+		m.Archive = make(archivemap.ArchiveMap)
+	}
+	m.Archive[path] = hash
+	return nil
+}
+
+// readLines calls fn with every non-blank line of r, wrapping errors with
+// the line number
+func readLines(r io.Reader, fn func(line string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return errors.Wrapf(err, "line %d", lineNumber)
+		}
+	}
+	return errors.Wrap(scanner.Err(), "manifest: failed to read manifest")
+}
@@ -0,0 +1,222 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package manifest
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testFiles = map[string]string{
+	"a":           "alpha",
+	"dir/b":       "bravo",
+	"dir/c, d":    "charlie",
+	"data/e%file": "echo",
+}
+
+func writeTree(t *testing.T) string {
+	root, err := ioutil.TempDir("", "manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range testFiles {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestParseSums(t *testing.T) {
+	var gnu, bsd strings.Builder
+	for name, content := range testFiles {
+		fmt.Fprintf(&gnu, "%s *./%s\r\n", sha256Hex(content), name)
+		sum := sha1.Sum([]byte(content))
+		fmt.Fprintf(&bsd, "SHA1 (%s) = %x\n", name, sum)
+	}
+
+	m, err := ParseSums(strings.NewReader(gnu.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Algorithm != SHA256 || len(m.Archive) != len(testFiles) || hex.EncodeToString(m.Archive["a"]) != sha256Hex("alpha") {
+		t.Errorf("unexpected manifest %s %v", m.Algorithm, m.Archive)
+	}
+
+	m, err = ParseSums(strings.NewReader(bsd.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Algorithm != SHA1 || len(m.Archive) != len(testFiles) {
+		t.Errorf("unexpected manifest %s %v", m.Algorithm, m.Archive)
+	}
+
+	sum := sha512.Sum512([]byte("x"))
+	m, err = ParseSums(strings.NewReader(fmt.Sprintf("\\%x  new\\nline\n", sum)))
+	if err != nil || m.Algorithm != SHA512 || m.Archive["new\nline"] == nil {
+		t.Error("failed to parse escaped sha512sum line", err)
+	}
+
+	for _, bad := range []string{
+		"garbage",
+		"abc  a",
+		"MD5 (a) = zz",
+		md5Hex("a") + "  a\n" + sha256Hex("b") + "  b",
+		"\\" + md5Hex("a") + "  bad\\escape",
+	} {
+		if _, err := ParseSums(strings.NewReader(bad)); !errors.Is(err, ErrFormat) {
+			t.Errorf("expected ErrFormat parsing %q, got %v", bad, err)
+		}
+	}
+}
+
+func TestParseBagIt(t *testing.T) {
+	manifest := md5Hex("echo") + "  data/e%25file\n" + md5Hex("x") + " data/new%0Aline\n"
+	m, err := ParseBagIt(strings.NewReader(manifest), "MD5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Algorithm != MD5 || m.Archive["data/e%file"] == nil || m.Archive["data/new\nline"] == nil {
+		t.Errorf("unexpected manifest %s %v", m.Algorithm, m.Archive)
+	}
+
+	if _, err := ParseBagIt(strings.NewReader(manifest), "sha3"); !errors.Is(err, ErrUnsupportedAlgorithm) {
+		t.Error("expected ErrUnsupportedAlgorithm, got", err)
+	}
+	if _, err := ParseBagIt(strings.NewReader(sha256Hex("x")+" a"), MD5); !errors.Is(err, ErrFormat) {
+		t.Error("expected ErrFormat for a digest of the wrong length, got", err)
+	}
+}
+
+func TestParseHashdeep(t *testing.T) {
+	audit := strings.Join([]string{
+		"%%%% HASHDEEP-1.0",
+		"%%%% size,md5,sha256,filename",
+		"## Invoked from: /home/user",
+		"## $ hashdeep -r dir",
+		"##",
+		fmt.Sprintf("7,%s,%s,/home/user/dir/c, d", md5Hex("charlie"), sha256Hex("charlie")),
+	}, "\n")
+	m, err := ParseHashdeep(strings.NewReader(audit))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Algorithm != SHA256 || hex.EncodeToString(m.Archive["/home/user/dir/c, d"]) != sha256Hex("charlie") {
+		t.Errorf("unexpected manifest %s %v", m.Algorithm, m.Archive)
+	}
+
+	if _, err := ParseHashdeep(strings.NewReader("5,abc,a")); !errors.Is(err, ErrFormat) {
+		t.Error("expected ErrFormat without a header, got", err)
+	}
+	if _, err := ParseHashdeep(strings.NewReader("%%%% HASHDEEP-1.0\n%%%% size,tiger,filename")); !errors.Is(err, ErrUnsupportedAlgorithm) {
+		t.Error("expected ErrUnsupportedAlgorithm, got", err)
+	}
+}
+
+func TestManifest_Verify(t *testing.T) {
+	root := writeTree(t)
+	defer os.RemoveAll(root)
+
+	var audit strings.Builder
+	audit.WriteString("%%%% HASHDEEP-1.0\n%%%% size,md5,filename\n")
+	for name, content := range testFiles {
+		fmt.Fprintf(&audit, "%d,%s,%s\n", len(content), md5Hex(content), filepath.Join(root, filepath.FromSlash(name)))
+	}
+	manifestPath := filepath.Join(root, "audit.txt")
+	if err := ioutil.WriteFile(manifestPath, []byte(audit.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := Open(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := m.Verify(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Valid() || !reflect.DeepEqual(report.Added, []string{"audit.txt"}) {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(root, "a"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(root, "dir", "b")); err != nil {
+		t.Fatal(err)
+	}
+	report, err = m.Verify(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Valid() || !reflect.DeepEqual(report.Modified, []string{"a"}) || !reflect.DeepEqual(report.Missing, []string{"dir/b"}) {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	root := writeTree(t)
+	defer os.RemoveAll(root)
+
+	bagManifest := filepath.Join(root, "manifest-sha256.txt")
+	if err := ioutil.WriteFile(bagManifest, []byte(sha256Hex("echo")+"  data/e%25file\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sums := filepath.Join(root, "SHA256SUMS")
+	if err := ioutil.WriteFile(sums, []byte(sha256Hex("alpha")+"  a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, key := range map[string]string{bagManifest: "data/e%file", sums: "a"} {
+		m, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		report, err := m.Verify(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Algorithm != SHA256 || m.Archive[key] == nil || !report.Valid() {
+			t.Errorf("unexpected result opening %s: %v %+v", path, m.Archive, report)
+		}
+	}
+}
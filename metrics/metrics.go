@@ -0,0 +1,169 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+// Package metrics exposes Prometheus metrics for blockmap generation and
+// verification. A Collector is registered with a prometheus.Registerer and
+// fed by the server and monitor packages or by callers hashing blockmaps.
+package metrics
+
+import (
+	"time"
+
+	"github.com/govice/golinks/blockmap"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Namespace prefixes the name of every metric
+const Namespace = "golinks"
+
+// Operations labelling scan durations
+const (
+	GenerateOperation = "generate"
+	VerifyOperation   = "verify"
+)
+
+// Collector implements prometheus.Collector for golinks scans
+type Collector struct {
+	filesHashed    prometheus.Counter
+	bytesHashed    prometheus.Counter
+	hashErrors     prometheus.Counter
+	scanDuration   *prometheus.HistogramVec
+	verifications  prometheus.Counter
+	verifyFailures prometheus.Counter
+	lastSuccess    prometheus.Gauge
+	cacheLookups   *prometheus.CounterVec
+}
+
+// New returns a Collector with every metric at zero
+func New() *Collector {
+	return &Collector{
+		filesHashed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "files_hashed_total",
+			Help:      "Files hashed while generating or verifying blockmaps.",
+		}),
+		bytesHashed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "bytes_hashed_total",
+			Help:      "Bytes of file content hashed while generating or verifying blockmaps.",
+		}),
+		hashErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "hash_errors_total",
+			Help:      "Files that failed to hash.",
+		}),
+		scanDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "scan_duration_seconds",
+			Help:      "Time taken to generate or verify a blockmap.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 4, 10),
+		}, []string{"operation"}),
+		verifications: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "verifications_total",
+			Help:      "Blockmap verifications run.",
+		}),
+		verifyFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "verify_failures_total",
+			Help:      "Verifications that failed or found drift.",
+		}),
+		lastSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: Namespace,
+			Name:      "last_successful_scan_timestamp_seconds",
+			Help:      "Unix time of the last scan that completed without error.",
+		}),
+		cacheLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "cache_lookups_total",
+			Help:      "Server cache lookups by result, hit or miss.",
+		}, []string{"result"}),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, collector := range c.collectors() {
+		collector.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, collector := range c.collectors() {
+		collector.Collect(ch)
+	}
+}
+
+func (c *Collector) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		c.filesHashed, c.bytesHashed, c.hashErrors, c.scanDuration,
+		c.verifications, c.verifyFailures, c.lastSuccess, c.cacheLookups,
+	}
+}
+
+// Progress returns a callback for BlockMap.OnProgress counting the files
+// and bytes hashed. The callback may be reused across generations of the
+// same blockmap, including by Verify, but not shared between blockmaps.
+func (c *Collector) Progress() func(blockmap.ProgressEvent) {
+	var files int
+	var bytes int64
+	return func(event blockmap.ProgressEvent) {
+		//A new generation restarts the running totals
+		if event.FilesProcessed <= files {
+			files, bytes = 0, 0
+		}
+		files = event.FilesProcessed
+		if event.Err != nil {
+			c.hashErrors.Inc()
+			return
+		}
+		c.filesHashed.Inc()
+		c.bytesHashed.Add(float64(event.BytesHashed - bytes))
+		bytes = event.BytesHashed
+	}
+}
+
+// ObserveGenerate records a generation started at start which returned err
+func (c *Collector) ObserveGenerate(start time.Time, err error) {
+	c.observeScan(GenerateOperation, start, err)
+}
+
+// ObserveVerify records a verification started at start. Verifications
+// returning an error or an invalid report count as failures.
+func (c *Collector) ObserveVerify(start time.Time, report *blockmap.VerificationReport, err error) {
+	c.observeScan(VerifyOperation, start, err)
+	c.verifications.Inc()
+	if err != nil || !report.Valid() {
+		c.verifyFailures.Inc()
+	}
+}
+
+// ObserveCache records a cache lookup that hit or missed
+func (c *Collector) ObserveCache(hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	c.cacheLookups.WithLabelValues(result).Inc()
+}
+
+func (c *Collector) observeScan(operation string, start time.Time, err error) {
+	end := time.Now()
+	c.scanDuration.WithLabelValues(operation).Observe(end.Sub(start).Seconds())
+	if err == nil {
+		c.lastSuccess.Set(float64(end.UnixNano()) / 1e9)
+	}
+}
@@ -0,0 +1,82 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+package metrics
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/govice/golinks/blockmap"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	root, err := ioutil.TempDir("", "metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for name, content := range map[string]string{"a": "abc", "b": "de"} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := New()
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(c); err != nil {
+		t.Fatal(err)
+	}
+
+	b := blockmap.New(root)
+	b.OnProgress(c.Progress())
+	start := time.Now()
+	err = b.Generate()
+	c.ObserveGenerate(start, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := b.Verify()
+	c.ObserveVerify(start, report, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.ObserveVerify(start, nil, errors.New("failed"))
+
+	//Verify hashes every file again
+	for metric, want := range map[prometheus.Collector]float64{
+		c.filesHashed:    4,
+		c.bytesHashed:    10,
+		c.hashErrors:     0,
+		c.verifications:  2,
+		c.verifyFailures: 1,
+	} {
+		if got := testutil.ToFloat64(metric); got != want {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+	}
+	if last := testutil.ToFloat64(c.lastSuccess); last < float64(start.Unix()) {
+		t.Errorf("expected the last successful scan to be recorded, got %v", last)
+	}
+	if n := testutil.CollectAndCount(c); n != 8 {
+		t.Errorf("expected 8 metrics, got %d", n)
+	}
+}
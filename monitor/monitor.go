@@ -0,0 +1,273 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+// Package monitor periodically verifies a directory against its blockmap
+// and raises alerts when the files drift from it. A Monitor is the
+// long-running service shape of blockmap.Verify.
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/govice/golinks/blockmap"
+	"github.com/govice/golinks/events"
+	"github.com/govice/golinks/logging"
+	"github.com/govice/golinks/metrics"
+	"github.com/govice/golinks/policy"
+	"github.com/pkg/errors"
+)
+
+// WebhookTimeout bounds the delivery of each notification
+const WebhookTimeout = 10 * time.Second
+
+// ErrWebhookStatus is returned when a webhook responds with a non 2xx status
+var ErrWebhookStatus = errors.New("monitor: webhook request failed")
+
+// Alert describes drift found by a check
+type Alert struct {
+	Root   string                       `json:"root"`
+	Time   time.Time                    `json:"time"`
+	Report *blockmap.VerificationReport `json:"report"`
+	// Policy is the verdict on the drift when the monitor has a policy
+	Policy *policy.Result `json:"policy,omitempty"`
+}
+
+// Result is the outcome of a check
+type Result struct {
+	Time   time.Time
+	Report *blockmap.VerificationReport
+	Policy *policy.Result
+	Err    error
+}
+
+// Option configures a Monitor created by New
+type Option func(*Monitor)
+
+// WithBaseline verifies against b rather than the link saved in the root
+func WithBaseline(b *blockmap.BlockMap) Option {
+	return func(m *Monitor) { m.baseline = b }
+}
+
+// WithBlockMapOptions configures the baseline generated when the root has no saved link
+func WithBlockMapOptions(opts ...blockmap.Option) Option {
+	return func(m *Monitor) { m.blockmapOpts = append(m.blockmapOpts, opts...) }
+}
+
+// WithCallback calls fn with every alert
+func WithCallback(fn func(Alert)) Option {
+	return func(m *Monitor) { m.hooks = append(m.hooks, fn) }
+}
+
+// WithChannel sends every alert on ch. Alerts are dropped rather than
+// blocking checks when ch isn't ready.
+func WithChannel(ch chan<- Alert) Option {
+	return func(m *Monitor) {
+		m.hooks = append(m.hooks, func(alert Alert) {
+			select {
+			case ch <- alert:
+			default:
+				m.logger.Log(logging.Warn, "dropped alert, channel not ready", logging.F("root", alert.Root))
+			}
+		})
+	}
+}
+
+// WithWebhook posts every alert as JSON to url, see Webhook
+func WithWebhook(url string) Option {
+	return func(m *Monitor) {
+		m.hooks = append(m.hooks, func(alert Alert) {
+			m.notify(&Webhook{URL: url, Client: m.client}, alert)
+		})
+	}
+}
+
+// WithHTTPClient sets the client used for webhooks
+func WithHTTPClient(client *http.Client) Option {
+	return func(m *Monitor) { m.client = client }
+}
+
+// WithMetrics records every check in c. The baseline's progress callback
+// is replaced to count hashed files.
+func WithMetrics(c *metrics.Collector) Option {
+	return func(m *Monitor) { m.metrics = c }
+}
+
+// WithEvents publishes the result of every check and detected drift to b
+func WithEvents(b *events.Broker) Option {
+	return func(m *Monitor) { m.events = b }
+}
+
+// WithPolicy judges drift with p, only alerting on drift it warns or fails on
+func WithPolicy(p *policy.Policy) Option {
+	return func(m *Monitor) { m.policy = p }
+}
+
+// WithLogger sets the logger receiving check results and hook failures
+func WithLogger(logger logging.Logger) Option {
+	return func(m *Monitor) { m.logger = logger }
+}
+
+// Monitor verifies a root every interval
+type Monitor struct {
+	root         string
+	interval     time.Duration
+	baseline     *blockmap.BlockMap
+	blockmapOpts []blockmap.Option
+	hooks        []func(Alert)
+	client       *http.Client
+	logger       logging.Logger
+	metrics      *metrics.Collector
+	events       *events.Broker
+	policy       *policy.Policy
+	now          func() time.Time
+
+	mu          sync.Mutex
+	latest      *Result
+	lastAlerted []byte
+}
+
+// New returns a Monitor verifying root every interval configured by opts.
+// Without a baseline the link saved in root is loaded on the first check,
+// or generated when there is none.
+func New(root string, interval time.Duration, opts ...Option) *Monitor {
+	m := &Monitor{
+		root:     root,
+		interval: interval,
+		client:   http.DefaultClient,
+		logger:   logging.Discard,
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.metrics != nil && m.baseline != nil {
+		m.baseline.OnProgress(m.metrics.Progress())
+	}
+	return m
+}
+
+// Run checks the root immediately and then every interval until ctx is done,
+// returning ctx's error. Failed checks are logged and kept as the latest
+// result without stopping the monitor.
+func (m *Monitor) Run(ctx context.Context) error {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		if _, err := m.Check(); err != nil {
+			m.logger.Log(logging.Error, "check failed", logging.F("root", m.root), logging.F("error", err))
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check verifies the root once, keeps the result as the latest and raises
+// an alert when the root drifted. An alert is raised once for each drifted
+// state, so unchanged drift isn't reported on every check.
+func (m *Monitor) Check() (*blockmap.VerificationReport, error) {
+	report, err := m.verify()
+	result := &Result{Time: m.now(), Report: report, Err: err}
+	drifted := err == nil && !report.Valid()
+	if err == nil && m.policy != nil {
+		result.Policy = m.policy.EvaluateReport(report)
+		drifted = result.Policy.Outcome != policy.Pass
+	}
+
+	m.mu.Lock()
+	m.latest = result
+	var alert bool
+	if err == nil {
+		alert = drifted && !bytes.Equal(report.RootHash, m.lastAlerted)
+		if !drifted {
+			m.lastAlerted = nil
+		} else {
+			m.lastAlerted = report.RootHash
+		}
+	}
+	m.mu.Unlock()
+
+	m.publish(events.TypeVerification, result)
+	if err != nil {
+		return nil, err
+	}
+	m.logger.Log(logging.Info, "checked root", logging.F("root", m.root), logging.F("valid", report.Valid()))
+	if alert {
+		m.publish(events.TypeDrift, result)
+		a := Alert{Root: m.root, Time: result.Time, Report: report, Policy: result.Policy}
+		for _, hook := range m.hooks {
+			hook(a)
+		}
+	}
+	return report, nil
+}
+
+// publish publishes a check result as an event of type t
+func (m *Monitor) publish(t string, result *Result) {
+	if m.events == nil {
+		return
+	}
+	event := events.Event{Type: t, Time: result.Time.UTC(), Root: m.root, Report: result.Report}
+	if result.Err != nil {
+		event.Error = result.Err.Error()
+	} else {
+		event.Valid = result.Report.Valid()
+	}
+	m.events.Publish(event)
+}
+
+// Latest returns the result of the most recent check or nil before the first
+func (m *Monitor) Latest() *Result {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.latest
+}
+
+// verify resolves the baseline and verifies the root against it
+func (m *Monitor) verify() (*blockmap.VerificationReport, error) {
+	if m.baseline == nil {
+		b := blockmap.New(m.root, m.blockmapOpts...)
+		if m.metrics != nil {
+			b.OnProgress(m.metrics.Progress())
+		}
+		err := b.Load(m.root)
+		if errors.Is(err, os.ErrNotExist) {
+			m.logger.Log(logging.Info, "no saved link, generating baseline", logging.F("root", m.root))
+			start := time.Now()
+			err = b.Generate()
+			if m.metrics != nil {
+				m.metrics.ObserveGenerate(start, err)
+			}
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "monitor: failed to load baseline")
+		}
+		m.baseline = b
+	}
+
+	start := time.Now()
+	report, err := m.baseline.Verify()
+	if m.metrics != nil {
+		m.metrics.ObserveVerify(start, report, err)
+	}
+	return report, err
+}
@@ -0,0 +1,216 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/govice/golinks/events"
+	"github.com/govice/golinks/policy"
+)
+
+func TestMonitor_Check(t *testing.T) {
+	root, err := ioutil.TempDir("", "monitor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	file := filepath.Join(root, "a")
+	if err := ioutil.WriteFile(file, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var posted []Alert
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert Alert
+		if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		posted = append(posted, alert)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	var called int
+	alerts := make(chan Alert, 1)
+	m := New(root, time.Hour, WithCallback(func(Alert) { called++ }), WithChannel(alerts), WithWebhook(server.URL))
+	if m.Latest() != nil {
+		t.Error("expected no result before the first check")
+	}
+	report, err := m.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Valid() || called != 0 {
+		t.Fatalf("expected the generated baseline to verify without alerts %+v", report)
+	}
+
+	if err := ioutil.WriteFile(file, []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := m.Check(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if called != 1 {
+		t.Errorf("expected one alert for unchanged drift, got %d", called)
+	}
+	select {
+	case alert := <-alerts:
+		if !reflect.DeepEqual(alert.Report.Modified, []string{"a"}) {
+			t.Errorf("unexpected alert %+v", alert.Report)
+		}
+	default:
+		t.Error("expected an alert on the channel")
+	}
+	mu.Lock()
+	if len(posted) != 1 || posted[0].Root != root {
+		t.Errorf("expected one webhook alert, got %+v", posted)
+	}
+	mu.Unlock()
+
+	//Drift is reported again after the root was restored
+	if err := ioutil.WriteFile(file, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if report, err := m.Check(); err != nil || !report.Valid() {
+		t.Fatalf("expected restored root to verify %+v %v", report, err)
+	}
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Check(); err != nil {
+		t.Fatal(err)
+	}
+	if latest := m.Latest(); called != 2 || latest == nil || latest.Report.Valid() {
+		t.Errorf("expected a second alert, got %d %+v", called, latest)
+	}
+}
+
+func TestMonitor_Policy(t *testing.T) {
+	root, err := ioutil.TempDir("", "monitor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := ioutil.WriteFile(filepath.Join(root, "a"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := policy.NewPolicy()
+	if err := p.Allow("logs/"); err != nil {
+		t.Fatal(err)
+	}
+	var alerts []Alert
+	m := New(root, time.Hour, WithPolicy(p), WithCallback(func(a Alert) { alerts = append(alerts, a) }))
+	if _, err := m.Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	//Allowed drift passes without an alert
+	if err := os.Mkdir(filepath.Join(root, "logs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "logs", "today"), []byte("log"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Check(); err != nil {
+		t.Fatal(err)
+	}
+	if latest := m.Latest(); len(alerts) != 0 || latest.Policy == nil || latest.Policy.Outcome != policy.Pass {
+		t.Fatalf("expected allowed drift to pass, got %d alerts %+v", len(alerts), latest.Policy)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(root, "a"), []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Check(); err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 1 || alerts[0].Policy.Outcome != policy.Fail || len(alerts[0].Policy.Failures()) != 1 {
+		t.Errorf("expected an alert failing the modification, got %+v", alerts)
+	}
+}
+
+func TestMonitor_Run(t *testing.T) {
+	root, err := ioutil.TempDir("", "monitor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := ioutil.WriteFile(filepath.Join(root, ".link"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := New(root, time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := m.Run(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected the deadline error, got %v", err)
+	}
+	if latest := m.Latest(); latest == nil || latest.Err == nil {
+		t.Errorf("expected failed checks to be kept, got %+v", latest)
+	}
+}
+
+func TestMonitor_Events(t *testing.T) {
+	root, err := ioutil.TempDir("", "monitor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	file := filepath.Join(root, "a")
+	if err := ioutil.WriteFile(file, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	broker := events.NewBroker(events.DefaultHistory)
+	m := New(root, time.Hour, WithEvents(broker))
+	if _, err := m.Check(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(file, []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	published := broker.Since(0)
+	var types []string
+	for _, event := range published {
+		types = append(types, event.Type)
+	}
+	if !reflect.DeepEqual(types, []string{events.TypeVerification, events.TypeVerification, events.TypeDrift}) {
+		t.Fatal("unexpected events", types)
+	}
+	if !published[0].Valid || published[1].Valid || published[2].Root != root {
+		t.Errorf("unexpected events %+v", published)
+	}
+}
@@ -0,0 +1,184 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/govice/golinks/logging"
+	"github.com/pkg/errors"
+)
+
+// SignatureHeader holds the HMAC-SHA256 of a signed webhook body as
+// "sha256=" followed by the hex encoded MAC
+const SignatureHeader = "X-Golinks-Signature"
+
+// Notifier delivers alerts to people or other systems
+type Notifier interface {
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// WithNotifier delivers every alert with n. Delivery failures are logged.
+func WithNotifier(n Notifier) Option {
+	return func(m *Monitor) {
+		m.hooks = append(m.hooks, func(alert Alert) { m.notify(n, alert) })
+	}
+}
+
+// notify delivers alert with n within WebhookTimeout
+func (m *Monitor) notify(n Notifier, alert Alert) {
+	ctx, cancel := context.WithTimeout(context.Background(), WebhookTimeout)
+	defer cancel()
+	if err := n.Notify(ctx, alert); err != nil {
+		m.logger.Log(logging.Error, "notification failed", logging.F("root", alert.Root), logging.F("error", err))
+	}
+}
+
+// Summary returns a plain text description of an alert for people
+func Summary(alert Alert) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Drift detected in %s at %s\n", alert.Root, alert.Time.Format(time.RFC3339))
+	for _, group := range []struct {
+		label string
+		paths []string
+	}{
+		{"modified", alert.Report.Modified},
+		{"missing", alert.Report.Missing},
+		{"added", alert.Report.Added},
+		{"metadata", alert.Report.Metadata},
+	} {
+		for _, path := range group.paths {
+			fmt.Fprintf(&b, "%s: %s\n", group.label, path)
+		}
+	}
+	fmt.Fprintf(&b, "root hash: %s\n", hex.EncodeToString(alert.Report.RootHash))
+	return b.String()
+}
+
+// Webhook posts alerts as JSON to a URL. When Secret is set the body is
+// signed with HMAC-SHA256 in the SignatureHeader so receivers can check
+// alerts came from the monitor.
+type Webhook struct {
+	URL    string
+	Secret []byte
+	// Client sends the requests, nil uses http.DefaultClient
+	Client *http.Client
+}
+
+// Notify posts alert to the webhook
+func (w *Webhook) Notify(ctx context.Context, alert Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return errors.Wrap(err, "monitor: failed to encode alert")
+	}
+	header := make(http.Header)
+	if w.Secret != nil {
+		mac := hmac.New(sha256.New, w.Secret)
+		mac.Write(body)
+		header.Set(SignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	return postJSON(ctx, w.Client, w.URL, body, header)
+}
+
+// Slack posts a summary of each alert to a Slack incoming webhook URL
+type Slack struct {
+	WebhookURL string
+	// Client sends the requests, nil uses http.DefaultClient
+	Client *http.Client
+}
+
+// Notify posts a summary of alert to Slack
+func (s *Slack) Notify(ctx context.Context, alert Alert) error {
+	body, err := json.Marshal(map[string]string{"text": Summary(alert)})
+	if err != nil {
+		return errors.Wrap(err, "monitor: failed to encode slack message")
+	}
+	return postJSON(ctx, s.Client, s.WebhookURL, body, nil)
+}
+
+// Email mails a summary of each alert through an SMTP server
+type Email struct {
+	// Addr is the host:port of the SMTP server
+	Addr string
+	// Auth authenticates with the server, nil sends without authentication
+	Auth smtp.Auth
+	From string
+	To   []string
+
+	// send replaces smtp.SendMail in tests
+	send func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// Notify mails a summary of alert. SMTP delivery can't be cancelled so ctx
+// is only checked before sending.
+func (e *Email) Notify(ctx context.Context, alert Alert) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", headerLine(e.From))
+	fmt.Fprintf(&msg, "To: %s\r\n", headerLine(strings.Join(e.To, ", ")))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", headerLine("golinks: drift detected in "+alert.Root)))
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.Replace(Summary(alert), "\n", "\r\n", -1))
+
+	send := e.send
+	if send == nil {
+		send = smtp.SendMail
+	}
+	return errors.Wrap(send(e.Addr, e.Auth, e.From, e.To, msg.Bytes()), "monitor: failed to send email")
+}
+
+// headerLine replaces line breaks in a mail header value, which would
+// otherwise start headers of their own
+func headerLine(value string) string {
+	return strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ").Replace(value)
+}
+
+// postJSON posts a JSON body to url with the extra header
+func postJSON(ctx context.Context, client *http.Client, url string, body []byte, header http.Header) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "monitor: failed to create webhook request")
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "monitor: webhook request failed")
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return errors.Wrap(ErrWebhookStatus, res.Status)
+	}
+	return nil
+}
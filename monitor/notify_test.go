@@ -0,0 +1,157 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+package monitor
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/govice/golinks/blockmap"
+)
+
+var testAlert = Alert{
+	Root: "/data",
+	Time: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+	Report: &blockmap.VerificationReport{
+		Modified: []string{"a"},
+		Missing:  []string{"b"},
+		RootHash: []byte{0xab},
+	},
+}
+
+func TestSummary(t *testing.T) {
+	want := "Drift detected in /data at 2020-01-02T03:04:05Z\nmodified: a\nmissing: b\nroot hash: ab\n"
+	if got := Summary(testAlert); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestWebhook_Notify(t *testing.T) {
+	secret := []byte("secret")
+	var signature string
+	var body []byte
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature = r.Header.Get(SignatureHeader)
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	webhook := &Webhook{URL: server.URL, Secret: secret}
+	if err := webhook.Notify(context.Background(), testAlert); err != nil {
+		t.Fatal(err)
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); signature != want {
+		t.Errorf("expected signature %s, got %s", want, signature)
+	}
+	var alert Alert
+	if err := json.Unmarshal(body, &alert); err != nil || alert.Root != testAlert.Root {
+		t.Errorf("unexpected body %s", body)
+	}
+
+	status = http.StatusInternalServerError
+	if err := (&Webhook{URL: server.URL}).Notify(context.Background(), testAlert); !errors.Is(err, ErrWebhookStatus) {
+		t.Errorf("expected ErrWebhookStatus, got %v", err)
+	}
+	if signature != "" {
+		t.Error("expected unsigned webhook without a secret")
+	}
+}
+
+func TestSlack_Notify(t *testing.T) {
+	var message map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&message)
+	}))
+	defer server.Close()
+
+	if err := (&Slack{WebhookURL: server.URL}).Notify(context.Background(), testAlert); err != nil {
+		t.Fatal(err)
+	}
+	if message["text"] != Summary(testAlert) {
+		t.Errorf("unexpected message %v", message)
+	}
+}
+
+func TestEmail_Notify(t *testing.T) {
+	var sent string
+	e := &Email{Addr: "mail:25", From: "golinks@example.com", To: []string{"ops@example.com"}}
+	e.send = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		sent = string(msg)
+		return nil
+	}
+	if err := e.Notify(context.Background(), testAlert); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(sent, "Subject: golinks: drift detected in /data\r\n") || !strings.Contains(sent, "\r\nmodified: a\r\n") {
+		t.Errorf("unexpected message %q", sent)
+	}
+
+	//Roots can't inject headers and are encoded when they aren't ASCII
+	injected := testAlert
+	injected.Root = "/données\r\nBcc: someone@example.com"
+	if err := e.Notify(context.Background(), injected); err != nil {
+		t.Fatal(err)
+	}
+	header := sent[:strings.Index(sent, "\r\n\r\n")]
+	subject := header[strings.Index(header, "Subject: ")+len("Subject: "):]
+	subject, err := new(mime.WordDecoder).DecodeHeader(subject[:strings.Index(subject, "\r\n")])
+	if strings.Contains(header, "\r\nBcc:") || err != nil || subject != "golinks: drift detected in /données Bcc: someone@example.com" {
+		t.Errorf("unexpected header %q", header)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := e.Notify(ctx, testAlert); err != context.Canceled {
+		t.Errorf("expected cancelled notification, got %v", err)
+	}
+}
+
+type notifierFunc func(ctx context.Context, alert Alert) error
+
+func (f notifierFunc) Notify(ctx context.Context, alert Alert) error { return f(ctx, alert) }
+
+func TestWithNotifier(t *testing.T) {
+	var notified []Alert
+	m := New("", time.Hour, WithNotifier(notifierFunc(func(ctx context.Context, alert Alert) error {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("expected notifications to be bounded")
+		}
+		notified = append(notified, alert)
+		return errors.New("failed")
+	})))
+	for _, hook := range m.hooks {
+		hook(testAlert)
+	}
+	if len(notified) != 1 {
+		t.Errorf("expected one notification, got %d", len(notified))
+	}
+}
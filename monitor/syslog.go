@@ -0,0 +1,242 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package monitor
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// SyslogFormat is the format of the alerts sent by Syslog
+type SyslogFormat string
+
+// Syslog formats
+const (
+	// SyslogText sends a one line description of each alert
+	SyslogText SyslogFormat = "text"
+	// SyslogCEF sends alerts in ArcSight Common Event Format
+	SyslogCEF SyslogFormat = "cef"
+	// SyslogLEEF sends alerts in QRadar Log Event Extended Format 1.0
+	SyslogLEEF SyslogFormat = "leef"
+)
+
+// SyslogLocal0 is the facility of alerts when Syslog.Facility is zero
+const SyslogLocal0 = 16
+
+const (
+	//Alerts are sent with warning severity
+	syslogWarning = 4
+	syslogVendor  = "govice"
+	syslogProduct = "golinks"
+	syslogVersion = "1"
+	syslogEventID = "drift"
+	//maxSyslogField is the size of CEF custom string fields
+	maxSyslogField = 1023
+)
+
+// ErrSyslogFormat is returned for unknown syslog formats
+var ErrSyslogFormat = errors.New("monitor: unknown syslog format")
+
+// Syslog sends alerts to a syslog server as RFC 5424 messages, so SIEMs can
+// ingest drift without custom glue. Messages are sent as datagrams over udp
+// and octet counted over tcp, with TLS when TLSConfig is set as in RFC 5425.
+type Syslog struct {
+	// Network is "udp" or "tcp"
+	Network string
+	Addr    string
+	Format  SyslogFormat
+	// Facility of the messages, zero uses SyslogLocal0
+	Facility int
+	// Hostname of the messages, empty uses the machine's hostname
+	Hostname string
+	// TLSConfig secures tcp connections when set
+	TLSConfig *tls.Config
+}
+
+// Notify sends alert to the syslog server
+func (s *Syslog) Notify(ctx context.Context, alert Alert) error {
+	msg, err := s.Message(alert)
+	if err != nil {
+		return err
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, s.Network, s.Addr)
+	if err != nil {
+		return errors.Wrap(err, "monitor: failed to connect to syslog")
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if s.Network != "udp" {
+		if s.TLSConfig != nil {
+			config := s.TLSConfig.Clone()
+			if config.ServerName == "" {
+				config.ServerName, _, _ = net.SplitHostPort(s.Addr)
+			}
+			tlsConn := tls.Client(conn, config)
+			if err := tlsConn.Handshake(); err != nil {
+				return errors.Wrap(err, "monitor: syslog TLS handshake failed")
+			}
+			conn = tlsConn
+		}
+		msg = strconv.Itoa(len(msg)) + " " + msg
+	}
+	_, err = conn.Write([]byte(msg))
+	return errors.Wrap(err, "monitor: failed to send syslog message")
+}
+
+// Message returns alert as an RFC 5424 syslog message in the Syslog's format
+func (s *Syslog) Message(alert Alert) (string, error) {
+	var body string
+	switch s.Format {
+	case SyslogText, "":
+		body = TextEvent(alert)
+	case SyslogCEF:
+		body = CEFEvent(alert)
+	case SyslogLEEF:
+		body = LEEFEvent(alert)
+	default:
+		return "", errors.Wrap(ErrSyslogFormat, string(s.Format))
+	}
+	facility := s.Facility
+	if facility == 0 {
+		facility = SyslogLocal0
+	}
+	hostname := s.Hostname
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+	if hostname == "" {
+		hostname = "-"
+	}
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s - %s", facility*8+syslogWarning,
+		alert.Time.UTC().Format(time.RFC3339Nano), hostname, syslogProduct, os.Getpid(), syslogEventID, body), nil
+}
+
+// TextEvent returns a one line description of alert
+func TextEvent(alert Alert) string {
+	r := alert.Report
+	return fmt.Sprintf("drift detected in %s: %d modified, %d missing, %d added, %d metadata changed, root hash %s",
+		alert.Root, len(r.Modified), len(r.Missing), len(r.Added), len(r.Metadata), hex.EncodeToString(r.RootHash))
+}
+
+// CEFEvent returns alert in ArcSight Common Event Format. Changed paths are
+// listed in custom string fields, truncated to the format's field size.
+func CEFEvent(alert Alert) string {
+	r := alert.Report
+	header := []string{"CEF:0", syslogVendor, syslogProduct, syslogVersion, syslogEventID, "Drift detected", strconv.Itoa(alertSeverity(alert))}
+	for i := 1; i < len(header); i++ {
+		header[i] = strings.NewReplacer(`\`, `\\`, `|`, `\|`).Replace(header[i])
+	}
+	fields := []string{
+		"rt=" + strconv.FormatInt(alert.Time.UnixNano()/int64(time.Millisecond), 10),
+		"filePath=" + cefValue(alert.Root),
+		"cnt=" + strconv.Itoa(changes(alert)),
+		"cs1Label=rootHash", "cs1=" + hex.EncodeToString(r.RootHash),
+	}
+	for i, group := range alertGroups(alert) {
+		n := strconv.Itoa(i + 2)
+		fields = append(fields, "cs"+n+"Label="+group.label, "cs"+n+"="+cefValue(joinPaths(group.paths)))
+	}
+	return strings.Join(header, "|") + "|" + strings.Join(fields, " ")
+}
+
+// LEEFEvent returns alert in QRadar Log Event Extended Format 1.0 with tab
+// delimited attributes
+func LEEFEvent(alert Alert) string {
+	r := alert.Report
+	fields := []string{
+		"cat=" + syslogEventID,
+		"sev=" + strconv.Itoa(alertSeverity(alert)),
+		"devTime=" + alert.Time.UTC().Format("Jan 02 2006 15:04:05"),
+		"resource=" + leefValue(alert.Root),
+		"changes=" + strconv.Itoa(changes(alert)),
+		"rootHash=" + hex.EncodeToString(r.RootHash),
+	}
+	for _, group := range alertGroups(alert) {
+		fields = append(fields, group.label+"="+leefValue(joinPaths(group.paths)))
+	}
+	return strings.Join([]string{"LEEF:1.0", syslogVendor, syslogProduct, syslogVersion, syslogEventID, ""}, "|") + strings.Join(fields, "\t")
+}
+
+type pathGroup struct {
+	label string
+	paths []string
+}
+
+// alertGroups returns the alert's non-empty groups of changed paths
+func alertGroups(alert Alert) []pathGroup {
+	var groups []pathGroup
+	for _, group := range []pathGroup{
+		{"modified", alert.Report.Modified},
+		{"missing", alert.Report.Missing},
+		{"added", alert.Report.Added},
+		{"metadata", alert.Report.Metadata},
+	} {
+		if len(group.paths) > 0 {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// changes returns the number of changed paths in alert
+func changes(alert Alert) int {
+	r := alert.Report
+	return len(r.Modified) + len(r.Missing) + len(r.Added) + len(r.Metadata)
+}
+
+// alertSeverity rates alerts on the 0 to 10 scale of CEF and LEEF: changed or
+// removed content is more severe than added files or changed metadata
+func alertSeverity(alert Alert) int {
+	if len(alert.Report.Modified) > 0 || len(alert.Report.Missing) > 0 {
+		return 8
+	}
+	return 5
+}
+
+// joinPaths joins paths with commas, truncated to maxSyslogField
+func joinPaths(paths []string) string {
+	joined := strings.Join(paths, ",")
+	if len(joined) > maxSyslogField {
+		end := maxSyslogField - 3
+		for end > 0 && !utf8.RuneStart(joined[end]) {
+			end--
+		}
+		joined = joined[:end] + "..."
+	}
+	return joined
+}
+
+func cefValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`).Replace(value)
+}
+
+func leefValue(value string) string {
+	return strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(value)
+}
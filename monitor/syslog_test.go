@@ -0,0 +1,129 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package monitor
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/govice/golinks/blockmap"
+	"github.com/pkg/errors"
+)
+
+func TestCEFEvent(t *testing.T) {
+	alert := testAlert
+	alert.Root = `/data=a|b\c`
+	event := CEFEvent(alert)
+	expected := `CEF:0|govice|golinks|1|drift|Drift detected|8|rt=1577934245000 filePath=/data\=a|b\\c cnt=2 ` +
+		`cs1Label=rootHash cs1=ab cs2Label=modified cs2=a cs3Label=missing cs3=b`
+	if event != expected {
+		t.Errorf("unexpected event\n%s\n%s", event, expected)
+	}
+
+	added := Alert{Root: "/data", Time: testAlert.Time, Report: &blockmap.VerificationReport{Added: []string{strings.Repeat("é", 600)}}}
+	event = CEFEvent(added)
+	if !strings.Contains(event, "|5|") || !strings.HasSuffix(event, "...") || len(event) > 1200 {
+		t.Errorf("expected a truncated low severity event, got %d bytes", len(event))
+	}
+}
+
+func TestLEEFEvent(t *testing.T) {
+	event := LEEFEvent(testAlert)
+	expected := "LEEF:1.0|govice|golinks|1|drift|cat=drift\tsev=8\tdevTime=Jan 02 2020 03:04:05\tresource=/data\t" +
+		"changes=2\trootHash=ab\tmodified=a\tmissing=b"
+	if event != expected {
+		t.Errorf("unexpected event\n%q\n%q", event, expected)
+	}
+}
+
+func TestSyslog_Message(t *testing.T) {
+	s := &Syslog{Format: SyslogText, Hostname: "host"}
+	msg, err := s.Message(testAlert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix := "<132>1 2020-01-02T03:04:05Z host golinks "
+	suffix := " drift - drift detected in /data: 1 modified, 1 missing, 0 added, 0 metadata changed, root hash ab"
+	if !strings.HasPrefix(msg, prefix) || !strings.HasSuffix(msg, suffix) {
+		t.Errorf("unexpected message %q", msg)
+	}
+
+	s.Format = "xml"
+	if _, err := s.Message(testAlert); errors.Cause(err) != ErrSyslogFormat {
+		t.Error("expected an unknown format error, got", err)
+	}
+}
+
+func TestSyslog_Notify(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	//Datagrams over udp
+	packets, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer packets.Close()
+	s := &Syslog{Network: "udp", Addr: packets.LocalAddr().String(), Format: SyslogCEF, Facility: 4, Hostname: "host"}
+	if err := s.Notify(ctx, testAlert); err != nil {
+		t.Fatal(err)
+	}
+	packets.SetDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 4096)
+	n, _, err := packets.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := string(buf[:n]); !strings.HasPrefix(msg, "<36>1 ") || !strings.HasSuffix(msg, CEFEvent(testAlert)) {
+		t.Errorf("unexpected datagram %q", msg)
+	}
+
+	//Octet counted over tcp
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			received <- err.Error()
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		length, _ := reader.ReadString(' ')
+		n, _ := strconv.Atoi(strings.TrimSpace(length))
+		msg := make([]byte, n)
+		io.ReadFull(reader, msg)
+		received <- string(msg)
+	}()
+	s = &Syslog{Network: "tcp", Addr: listener.Addr().String(), Format: SyslogLEEF, Hostname: "host"}
+	if err := s.Notify(ctx, testAlert); err != nil {
+		t.Fatal(err)
+	}
+	if msg := <-received; !strings.HasSuffix(msg, LEEFEvent(testAlert)) {
+		t.Errorf("unexpected message %q", msg)
+	}
+}
@@ -0,0 +1,348 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+// Package p2p synchronizes replicas of a chain between golinks daemons over
+// TCP or TLS. Nodes exchange chain heads, locate the point their chains fork,
+// fetch the blocks they're missing and keep the longest valid chain, so
+// daemons monitoring replicas of the same dataset converge on one history.
+// Blocks are only adopted from peers authenticated by TLS or signed by
+// trusted signers.
+package p2p
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/govice/golinks/block"
+	"github.com/govice/golinks/blockchain"
+	"github.com/govice/golinks/logging"
+	"github.com/pkg/errors"
+)
+
+// ErrPeer is returned when a peer answers a request with an error or an
+// invalid response
+var ErrPeer = errors.New("p2p: peer error")
+
+// ErrUnauthenticated is returned when syncing without a way to trust the
+// peer's blocks, either a TLS configuration authenticating peers or trusted
+// signers whose signatures the blocks must carry
+var ErrUnauthenticated = errors.New("p2p: peers must be authenticated with TLS or their blocks signed by trusted signers")
+
+// DefaultTimeout bounds each request made to or served for a peer
+const DefaultTimeout = 30 * time.Second
+
+// DefaultMaxFetch caps the number of blocks a peer's chain may be ahead of
+// the node's chain
+const DefaultMaxFetch = 1 << 16
+
+// Node serves its chain to peers and syncs it from them
+type Node struct {
+	mu      sync.Locker
+	chain   *blockchain.Blockchain
+	peers   []string
+	logger  logging.Logger
+	timeout time.Duration
+	merge   bool
+	tls     *tls.Config
+	trusted []crypto.PublicKey
+	quorum  int
+	fetch   int
+}
+
+// NewNode returns a Node serving and syncing chain
+func NewNode(chain *blockchain.Blockchain) *Node {
+	return &Node{
+		mu:      &sync.Mutex{},
+		chain:   chain,
+		logger:  logging.Discard,
+		timeout: DefaultTimeout,
+		fetch:   DefaultMaxFetch,
+	}
+}
+
+// SetTLS serves and syncs peers over TLS with config. Peers synced from are
+// authenticated by their certificates, config should also require client
+// certificates so only authenticated peers are served.
+func (n *Node) SetTLS(config *tls.Config) {
+	n.tls = config
+}
+
+// SetTrustedSigners requires every block adopted from a peer to carry valid
+// signatures by at least quorum of the trusted keys. Merged chains relink
+// blocks without their signatures, merging nodes should use TLS instead.
+func (n *Node) SetTrustedSigners(trusted []crypto.PublicKey, quorum int) {
+	if quorum < 1 {
+		quorum = 1
+	}
+	n.trusted, n.quorum = trusted, quorum
+}
+
+// SetMaxFetch sets how many blocks a peer's chain may be ahead of the node's
+// chain, DefaultMaxFetch by default. Longer chains are rejected.
+func (n *Node) SetMaxFetch(blocks int) {
+	n.fetch = blocks
+}
+
+// SetLocker sets the lock guarding the node's chain, for chains shared with
+// other services such as server.Server
+func (n *Node) SetLocker(l sync.Locker) {
+	n.mu = l
+}
+
+// SetMerge makes the node combine diverged chains with blockchain.Merge
+// rather than keeping one of them, for multi-writer chains
+func (n *Node) SetMerge(merge bool) {
+	n.merge = merge
+}
+
+// SetLogger sets the logger syncs run by Run are reported to
+func (n *Node) SetLogger(logger logging.Logger) {
+	n.logger = logger
+}
+
+// SetTimeout sets the time allowed for each request
+func (n *Node) SetTimeout(timeout time.Duration) {
+	n.timeout = timeout
+}
+
+// AddPeer adds the address of a peer synced by Run
+func (n *Node) AddPeer(addr string) {
+	n.peers = append(n.peers, addr)
+}
+
+// Serve answers peers connecting to l until l is closed
+func (n *Node) Serve(l net.Listener) error {
+	if n.tls != nil {
+		l = tls.NewListener(l, n.tls)
+	}
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return errors.Wrap(err, "p2p: failed to accept peer")
+		}
+		go n.handle(c)
+	}
+}
+
+// handle answers requests on c until the peer hangs up or idles past the
+// node's timeout
+func (n *Node) handle(c net.Conn) {
+	defer c.Close()
+	dec := json.NewDecoder(c)
+	enc := json.NewEncoder(c)
+	for {
+		if err := c.SetDeadline(time.Now().Add(n.timeout)); err != nil {
+			return
+		}
+		req := &request{}
+		if err := dec.Decode(req); err != nil {
+			if err != io.EOF {
+				n.logger.Log(logging.Warn, "bad peer request", logging.F("peer", c.RemoteAddr()), logging.F("error", err))
+			}
+			return
+		}
+		if err := enc.Encode(n.answer(req)); err != nil {
+			return
+		}
+	}
+}
+
+// answer returns the response to req
+func (n *Node) answer(req *request) *response {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	length := n.chain.Length()
+	switch req.Op {
+	case opHead:
+		return &response{Length: length, Hash: n.chain.At(length - 1).BlockHash}
+	case opHash:
+		if req.Index < 0 || req.Index >= length {
+			return &response{Error: blockchain.ErrBlockNotFound.Error()}
+		}
+		return &response{Hash: n.chain.At(req.Index).BlockHash}
+	case opBlocks:
+		if req.Index < 0 || req.Index >= length || req.Count < 1 {
+			return &response{Error: blockchain.ErrBlockNotFound.Error()}
+		}
+		end := req.Index + req.Count
+		if req.Count > maxBatch {
+			end = req.Index + maxBatch
+		}
+		if end > length {
+			end = length
+		}
+		blocks := make([]block.Block, end-req.Index)
+		copy(blocks, n.chain.Blocks[req.Index:end])
+		return &response{Blocks: blocks}
+	}
+	return &response{Error: "unknown request " + req.Op}
+}
+
+// Sync fetches the chain of the peer at addr and adopts it if it wins
+// blockchain.Reconcile against the node's chain, or adopts the chains' merge
+// if merging is enabled. It returns true if the node's chain changed.
+func (n *Node) Sync(ctx context.Context, addr string) (bool, error) {
+	if n.tls == nil && len(n.trusted) == 0 {
+		return false, ErrUnauthenticated
+	}
+	c, err := n.dial(ctx, addr)
+	if err != nil {
+		return false, errors.Wrap(err, "p2p: failed to dial peer")
+	}
+	defer c.Close()
+	peer := newConn(c, n.timeout)
+
+	n.mu.Lock()
+	ours := blockchain.Copy(n.chain)
+	n.mu.Unlock()
+
+	length, head, err := peer.head()
+	if err != nil {
+		return false, err
+	}
+	if length > ours.Length()+n.fetch {
+		return false, errors.Wrapf(ErrPeer, "peer advertised a chain of %d blocks", length)
+	}
+	if length == ours.Length() && bytes.Equal(head, ours.At(length-1).BlockHash) {
+		return false, nil
+	}
+	genesis, err := peer.hash(0)
+	if err != nil {
+		return false, err
+	}
+	if !bytes.Equal(genesis, ours.At(0).BlockHash) {
+		return false, blockchain.ErrNoCommonGenesis
+	}
+	fork, err := findFork(peer, ours, length)
+	if err != nil {
+		return false, err
+	}
+	if fork == length {
+		//The peer's chain is a prefix of ours
+		return false, nil
+	}
+	missing, err := peer.blocks(fork, length)
+	if err != nil {
+		return false, err
+	}
+	if len(n.trusted) > 0 {
+		for i := range missing {
+			if err := missing[i].VerifyQuorum(n.trusted, n.quorum); err != nil {
+				return false, errors.Wrapf(err, "p2p: untrusted peer block %d", missing[i].Index)
+			}
+		}
+	}
+
+	theirs := blockchain.Copy(ours)
+	theirs.Blocks = append(theirs.Blocks[:fork], missing...)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var winner *blockchain.Blockchain
+	if n.merge {
+		winner, err = blockchain.Merge(n.chain, theirs)
+	} else {
+		winner, _, err = blockchain.Reconcile(n.chain, theirs)
+	}
+	if err != nil {
+		return false, err
+	}
+	if blockchain.Equal(winner, n.chain) {
+		return false, nil
+	}
+	if err := n.chain.Adopt(winner); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// dial connects to the peer at addr, over TLS when it is configured
+func (n *Node) dial(ctx context.Context, addr string) (net.Conn, error) {
+	d := &net.Dialer{Timeout: n.timeout}
+	if n.tls == nil {
+		return d.DialContext(ctx, "tcp", addr)
+	}
+	config := n.tls.Clone()
+	if config.ServerName == "" {
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			config.ServerName = host
+		}
+	}
+	c, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	tc := tls.Client(c, config)
+	if err := tc.HandshakeContext(ctx); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return tc, nil
+}
+
+// findFork returns the first index at which ours differs from the peer's
+// chain of the given length. Chains agreeing on a block hash agree on every
+// block before it, so the fork is found by bisection.
+func findFork(peer *conn, ours *blockchain.Blockchain, length int) (int, error) {
+	lo, hi := 1, ours.Length()
+	if length < hi {
+		hi = length
+	}
+	for lo < hi {
+		mid := (lo + hi) / 2
+		hash, err := peer.hash(mid)
+		if err != nil {
+			return 0, err
+		}
+		if bytes.Equal(hash, ours.At(mid).BlockHash) {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo, nil
+}
+
+// Run syncs the node's chain from each of its peers every interval until ctx
+// is done
+func (n *Node) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for _, peer := range n.peers {
+			changed, err := n.Sync(ctx, peer)
+			if err != nil {
+				n.logger.Log(logging.Warn, "peer sync failed", logging.F("peer", peer), logging.F("error", err))
+				continue
+			}
+			if changed {
+				n.logger.Log(logging.Info, "adopted peer chain", logging.F("peer", peer))
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
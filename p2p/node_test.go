@@ -0,0 +1,249 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package p2p
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/govice/golinks/block"
+	"github.com/govice/golinks/blockchain"
+	"github.com/pkg/errors"
+)
+
+var (
+	testTLSOnce   sync.Once
+	testTLSConfig *tls.Config
+)
+
+// peerTLS returns a TLS configuration shared by test peers, presenting and
+// requiring a self-signed certificate for 127.0.0.1
+func peerTLS(t *testing.T) *tls.Config {
+	testTLSOnce.Do(func() {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: "peer"},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(time.Hour),
+			IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+			KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+			ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pool := x509.NewCertPool()
+		pool.AddCert(cert)
+		testTLSConfig = &tls.Config{
+			Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+			RootCAs:      pool,
+			ClientCAs:    pool,
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+		}
+	})
+	return testTLSConfig
+}
+
+func newTestNode(t *testing.T, chain *blockchain.Blockchain) (*Node, net.Listener) {
+	node := NewNode(chain)
+	node.SetTLS(peerTLS(t))
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go node.Serve(l)
+	return node, l
+}
+
+func TestSync(t *testing.T) {
+	ours, err := blockchain.Open(blockchain.NewMemoryStore(), block.NewSHA512Genesis())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ours.AddSHA512([]byte("common"))
+	theirs := blockchain.Copy(ours)
+	ours.AddSHA512([]byte("ours"))
+	for i := 0; i < maxBatch+2; i++ {
+		theirs.AddSHA512([]byte{byte(i)})
+	}
+
+	node, l := newTestNode(t, ours)
+	defer l.Close()
+	_, peer := newTestNode(t, theirs)
+	defer peer.Close()
+	addr, peerAddr := l.Addr().String(), peer.Addr().String()
+
+	//The longer peer chain replaces our diverged block
+	changed, err := node.Sync(context.Background(), peerAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed || !blockchain.Equal(ours, theirs) {
+		t.Error("expected to adopt the peer's chain")
+	}
+
+	//Synced chains are left alone
+	changed, err = node.Sync(context.Background(), peerAddr)
+	if err != nil || changed {
+		t.Error("expected no change, got", changed, err)
+	}
+
+	//A shorter peer chain doesn't replace ours
+	short, err := blockchain.New(block.NewSHA512Genesis())
+	if err != nil {
+		t.Fatal(err)
+	}
+	shortNode, shortListener := newTestNode(t, short)
+	defer shortListener.Close()
+	changed, err = shortNode.Sync(context.Background(), addr)
+	if err != nil || !changed || !blockchain.Equal(short, theirs) {
+		t.Error("expected the short chain to catch up, got", changed, err)
+	}
+	changed, err = node.Sync(context.Background(), addr)
+	if err != nil || changed {
+		t.Error("expected no change syncing from ourselves, got", changed, err)
+	}
+}
+
+func TestSyncGenesis(t *testing.T) {
+	ours, err := blockchain.New(block.NewSHA512Genesis())
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := blockchain.New(block.NewSHA512(0, []byte("other genesis"), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	node, l := newTestNode(t, ours)
+	defer l.Close()
+	_, peer := newTestNode(t, other)
+	defer peer.Close()
+	if _, err := node.Sync(context.Background(), peer.Addr().String()); err != blockchain.ErrNoCommonGenesis {
+		t.Error("expected no common genesis, got", err)
+	}
+}
+
+func TestSyncMerge(t *testing.T) {
+	ours, err := blockchain.New(block.NewSHA512Genesis())
+	if err != nil {
+		t.Fatal(err)
+	}
+	theirs := blockchain.Copy(ours)
+	ours.SetWriter("ours")
+	theirs.SetWriter("theirs")
+	if _, err := ours.AddPayload(block.MetadataPayload{"snapshot": "ours"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := theirs.AddPayload(block.MetadataPayload{"snapshot": "theirs"}); err != nil {
+		t.Fatal(err)
+	}
+
+	node, l := newTestNode(t, ours)
+	defer l.Close()
+	node.SetMerge(true)
+	peerNode, peer := newTestNode(t, theirs)
+	defer peer.Close()
+	peerNode.SetMerge(true)
+
+	//Each node keeps both writes and the nodes converge
+	changed, err := node.Sync(context.Background(), peer.Addr().String())
+	if err != nil || !changed || ours.Length() != 3 {
+		t.Fatal("expected merged chain, got", changed, err)
+	}
+	changed, err = peerNode.Sync(context.Background(), l.Addr().String())
+	if err != nil || !changed {
+		t.Fatal("expected peer to adopt merged chain, got", changed, err)
+	}
+	if !blockchain.Equal(ours, theirs) {
+		t.Error("expected nodes to converge")
+	}
+}
+
+func TestSyncTrust(t *testing.T) {
+	ours, err := blockchain.New(block.NewSHA512Genesis())
+	if err != nil {
+		t.Fatal(err)
+	}
+	theirs := blockchain.Copy(ours)
+	for i := 0; i < 3; i++ {
+		theirs.AddSHA512([]byte{byte(i)})
+	}
+	_, peerKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	peer := NewNode(theirs)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go peer.Serve(l)
+	addr := l.Addr().String()
+
+	//Unauthenticated peers aren't synced
+	node := NewNode(ours)
+	if _, err := node.Sync(context.Background(), addr); err != ErrUnauthenticated {
+		t.Error("expected unauthenticated sync to be refused, got", err)
+	}
+
+	//Blocks must be signed by the trusted signers
+	node.SetTrustedSigners([]crypto.PublicKey{peerKey.Public()}, 1)
+	if _, err := node.Sync(context.Background(), addr); errors.Cause(err) != block.ErrQuorumNotMet || ours.Length() != 1 {
+		t.Error("expected unsigned blocks to be rejected, got", err)
+	}
+	for i := 1; i < theirs.Length(); i++ {
+		if err := theirs.At(i).Sign(peerKey); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//Peers can't claim chains longer than the node fetches
+	node.SetMaxFetch(2)
+	if _, err := node.Sync(context.Background(), addr); errors.Cause(err) != ErrPeer || ours.Length() != 1 {
+		t.Error("expected the long chain to be rejected, got", err)
+	}
+	node.SetMaxFetch(DefaultMaxFetch)
+	changed, err := node.Sync(context.Background(), addr)
+	if err != nil || !changed || !blockchain.Equal(ours, theirs) {
+		t.Error("expected the signed chain to be adopted, got", changed, err)
+	}
+}
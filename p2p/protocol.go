@@ -0,0 +1,131 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package p2p
+
+import (
+	"encoding/json"
+	"net"
+	"time"
+
+	"github.com/govice/golinks/block"
+	"github.com/pkg/errors"
+)
+
+// Requests a node answers. Each request is answered by a single response
+// and a connection may carry any number of requests.
+const (
+	opHead   = "head"
+	opHash   = "hash"
+	opBlocks = "blocks"
+)
+
+// maxBatch caps the number of blocks returned by a single blocks request
+const maxBatch = 256
+
+// request is a JSON encoded protocol request. Index is the requested block
+// index and Count the number of blocks requested from Index.
+type request struct {
+	Op    string `json:"op"`
+	Index int    `json:"index,omitempty"`
+	Count int    `json:"count,omitempty"`
+}
+
+// response is a JSON encoded protocol response. Length and Hash describe the
+// chain head for head requests, Hash alone answers hash requests.
+type response struct {
+	Length int           `json:"length,omitempty"`
+	Hash   []byte        `json:"hash,omitempty"`
+	Blocks []block.Block `json:"blocks,omitempty"`
+	Error  string        `json:"error,omitempty"`
+}
+
+// conn is a client connection to a peer
+type conn struct {
+	net.Conn
+	enc     *json.Encoder
+	dec     *json.Decoder
+	timeout time.Duration
+}
+
+func newConn(c net.Conn, timeout time.Duration) *conn {
+	return &conn{
+		Conn:    c,
+		enc:     json.NewEncoder(c),
+		dec:     json.NewDecoder(c),
+		timeout: timeout,
+	}
+}
+
+// call sends req to the peer and reads its response
+func (c *conn) call(req *request) (*response, error) {
+	if err := c.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return nil, err
+	}
+	if err := c.enc.Encode(req); err != nil {
+		return nil, errors.Wrapf(err, "p2p: failed to send %s request", req.Op)
+	}
+	resp := &response{}
+	if err := c.dec.Decode(resp); err != nil {
+		return nil, errors.Wrapf(err, "p2p: failed to read %s response", req.Op)
+	}
+	if resp.Error != "" {
+		return nil, errors.Wrap(ErrPeer, resp.Error)
+	}
+	return resp, nil
+}
+
+// head returns the length and head block hash of the peer's chain
+func (c *conn) head() (int, []byte, error) {
+	resp, err := c.call(&request{Op: opHead})
+	if err != nil {
+		return 0, nil, err
+	}
+	if resp.Length < 1 {
+		return 0, nil, errors.Wrap(ErrPeer, "empty chain")
+	}
+	return resp.Length, resp.Hash, nil
+}
+
+// hash returns the hash of the peer's block at index
+func (c *conn) hash(index int) ([]byte, error) {
+	resp, err := c.call(&request{Op: opHash, Index: index})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Hash, nil
+}
+
+// blocks returns the peer's blocks from index to height
+func (c *conn) blocks(index, height int) ([]block.Block, error) {
+	var blocks []block.Block
+	for index < height {
+		count := height - index
+		if count > maxBatch {
+			count = maxBatch
+		}
+		resp, err := c.call(&request{Op: opBlocks, Index: index, Count: count})
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Blocks) == 0 || len(resp.Blocks) > count {
+			return nil, errors.Wrapf(ErrPeer, "bad batch of %d blocks from %d", len(resp.Blocks), index)
+		}
+		blocks = append(blocks, resp.Blocks...)
+		index += len(resp.Blocks)
+	}
+	return blocks, nil
+}
@@ -0,0 +1,82 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package policy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+// Config is the JSON description of a policy
+type Config struct {
+	// Allow are gitignore style patterns of paths expected to change
+	Allow []string     `json:"allow,omitempty"`
+	Rules []RuleConfig `json:"rules,omitempty"`
+	// FailOnlyOnModifications makes unmatched additions and renames warn
+	FailOnlyOnModifications bool `json:"failOnlyOnModifications,omitempty"`
+}
+
+// RuleConfig gives changes at matching paths an outcome
+type RuleConfig struct {
+	Paths []string `json:"paths"`
+	// Changes are the kinds of change matched, every kind when empty
+	Changes []string `json:"changes,omitempty"`
+	Outcome string   `json:"outcome"`
+	Reason  string   `json:"reason,omitempty"`
+}
+
+// Policy returns the policy described by c
+func (c *Config) Policy() (*Policy, error) {
+	p := NewPolicy()
+	if err := p.Allow(c.Allow...); err != nil {
+		return nil, err
+	}
+	for i, rc := range c.Rules {
+		outcome, err := ParseOutcome(rc.Outcome)
+		if err != nil {
+			return nil, errors.Wrapf(err, "rule %d", i+1)
+		}
+		var changes []Change
+		for _, name := range rc.Changes {
+			change, err := ParseChange(name)
+			if err != nil {
+				return nil, errors.Wrapf(err, "rule %d", i+1)
+			}
+			changes = append(changes, change)
+		}
+		if err := p.AddRule(rc.Paths, changes, outcome, rc.Reason); err != nil {
+			return nil, errors.Wrapf(err, "rule %d", i+1)
+		}
+	}
+	p.SetFailOnlyOnModifications(c.FailOnlyOnModifications)
+	return p, nil
+}
+
+// Load reads the JSON policy at path
+func Load(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "policy: failed to read "+path)
+	}
+	var c Config
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, errors.Wrap(err, "policy: failed to decode "+path)
+	}
+	return c.Policy()
+}
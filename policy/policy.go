@@ -0,0 +1,269 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+// Package policy decides whether drift between a link and its directory is
+// acceptable. Changed paths pass when they're on the allow-list, take the
+// outcome of the last path rule matching them, and otherwise fail, so CI jobs
+// and monitors can codify what drift they expect.
+package policy
+
+import (
+	"strconv"
+
+	"github.com/govice/golinks/blockmap"
+	"github.com/govice/golinks/ignore"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrUnknownOutcome is returned when parsing an unknown outcome name
+	ErrUnknownOutcome = errors.New("policy: unknown outcome")
+	// ErrUnknownChange is returned when parsing an unknown change name
+	ErrUnknownChange = errors.New("policy: unknown change")
+)
+
+// Outcome is the verdict on a change or a whole evaluation
+type Outcome int
+
+// Outcomes, in increasing severity
+const (
+	// Pass accepts the change
+	Pass Outcome = iota
+	// Warn accepts the change but reports it
+	Warn
+	// Fail rejects the change
+	Fail
+)
+
+var outcomeNames = []string{"pass", "warn", "fail"}
+
+func (o Outcome) String() string {
+	if o < Pass || int(o) >= len(outcomeNames) {
+		return "unknown"
+	}
+	return outcomeNames[o]
+}
+
+// MarshalText encodes the outcome as its name
+func (o Outcome) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+// UnmarshalText decodes an outcome name
+func (o *Outcome) UnmarshalText(text []byte) error {
+	outcome, err := ParseOutcome(string(text))
+	if err != nil {
+		return err
+	}
+	*o = outcome
+	return nil
+}
+
+// ParseOutcome returns the outcome named name
+func ParseOutcome(name string) (Outcome, error) {
+	for i, outcomeName := range outcomeNames {
+		if name == outcomeName {
+			return Outcome(i), nil
+		}
+	}
+	return Fail, errors.Wrap(ErrUnknownOutcome, name)
+}
+
+// Change is the kind of difference found at a path
+type Change string
+
+// Changes reported by diffs and verification reports
+const (
+	Added    Change = "added"
+	Removed  Change = "removed"
+	Modified Change = "modified"
+	Renamed  Change = "renamed"
+	// Metadata is a path whose permissions or ownership changed
+	Metadata Change = "metadata"
+)
+
+// ParseChange returns the change named name
+func ParseChange(name string) (Change, error) {
+	switch c := Change(name); c {
+	case Added, Removed, Modified, Renamed, Metadata:
+		return c, nil
+	}
+	return "", errors.Wrap(ErrUnknownChange, name)
+}
+
+// Finding is the verdict on a single changed path. Renames are reported at
+// their new path.
+type Finding struct {
+	Path    string  `json:"path"`
+	Change  Change  `json:"change"`
+	Outcome Outcome `json:"outcome"`
+	Reason  string  `json:"reason"`
+}
+
+// Result is the outcome of an evaluation, the most severe of its findings
+type Result struct {
+	Outcome  Outcome   `json:"outcome"`
+	Findings []Finding `json:"findings"`
+}
+
+// Failures returns the findings that failed
+func (r *Result) Failures() []Finding {
+	return r.filter(Fail)
+}
+
+// Warnings returns the findings that warned
+func (r *Result) Warnings() []Finding {
+	return r.filter(Warn)
+}
+
+func (r *Result) filter(outcome Outcome) []Finding {
+	var findings []Finding
+	for _, f := range r.Findings {
+		if f.Outcome == outcome {
+			findings = append(findings, f)
+		}
+	}
+	return findings
+}
+
+// rule gives changes of the listed kinds at matching paths an outcome
+type rule struct {
+	paths   *ignore.Matcher
+	changes []Change
+	outcome Outcome
+	reason  string
+}
+
+func (r rule) matches(path string, change Change) bool {
+	if len(r.changes) > 0 {
+		found := false
+		for _, c := range r.changes {
+			found = found || c == change
+		}
+		if !found {
+			return false
+		}
+	}
+	return r.paths.Match(path, blockmap.IsDirectory(path))
+}
+
+// Policy evaluates changes. The zero policy fails every change.
+type Policy struct {
+	allow             *ignore.Matcher
+	rules             []rule
+	onlyModifications bool
+}
+
+// NewPolicy returns a policy failing every change
+func NewPolicy() *Policy {
+	return &Policy{allow: &ignore.Matcher{}}
+}
+
+// Allow adds gitignore style patterns of paths expected to change. Allowed
+// changes pass regardless of the rules.
+func (p *Policy) Allow(patterns ...string) error {
+	if p.allow == nil {
+		p.allow = &ignore.Matcher{}
+	}
+	for _, pattern := range patterns {
+		if err := p.allow.Add(pattern); err != nil {
+			return errors.Wrap(err, "policy: invalid allow pattern")
+		}
+	}
+	return nil
+}
+
+// AddRule gives changes at paths matching the gitignore style patterns an
+// outcome, explained by reason. Only the listed kinds of change match, or
+// every kind when changes is empty. Later rules take precedence.
+func (p *Policy) AddRule(patterns []string, changes []Change, outcome Outcome, reason string) error {
+	m, err := ignore.New(patterns)
+	if err != nil {
+		return errors.Wrap(err, "policy: invalid rule pattern")
+	}
+	p.rules = append(p.rules, rule{paths: m, changes: changes, outcome: outcome, reason: reason})
+	return nil
+}
+
+// SetFailOnlyOnModifications makes added and renamed paths no rule matches
+// warn rather than fail, so new content is tolerated while changes to
+// existing content are not
+func (p *Policy) SetFailOnlyOnModifications(only bool) {
+	p.onlyModifications = only
+}
+
+// Evaluate judges the differences of a diff
+func (p *Policy) Evaluate(d *blockmap.DiffResult) *Result {
+	r := &Result{Findings: []Finding{}}
+	for _, path := range d.Added {
+		r.add(p.judge(path, Added))
+	}
+	for _, path := range d.Removed {
+		r.add(p.judge(path, Removed))
+	}
+	for _, path := range d.Modified {
+		r.add(p.judge(path, Modified))
+	}
+	for _, rename := range d.Renamed {
+		f := p.judge(rename.To, Renamed)
+		if f.Outcome != Pass && p.allow.Match(rename.From, blockmap.IsDirectory(rename.From)) {
+			f.Outcome, f.Reason = Pass, "allowed"
+		}
+		r.add(f)
+	}
+	return r
+}
+
+// EvaluateReport judges the drift in a verification report, with missing
+// paths judged as removals
+func (p *Policy) EvaluateReport(report *blockmap.VerificationReport) *Result {
+	r := p.Evaluate(&blockmap.DiffResult{Added: report.Added, Removed: report.Missing, Modified: report.Modified})
+	for _, path := range report.Metadata {
+		r.add(p.judge(path, Metadata))
+	}
+	return r
+}
+
+func (r *Result) add(f Finding) {
+	r.Findings = append(r.Findings, f)
+	if f.Outcome > r.Outcome {
+		r.Outcome = f.Outcome
+	}
+}
+
+// judge decides the outcome of a single change
+func (p *Policy) judge(path string, change Change) Finding {
+	f := Finding{Path: path, Change: change}
+	if p.allow.Match(path, blockmap.IsDirectory(path)) {
+		f.Outcome, f.Reason = Pass, "allowed"
+		return f
+	}
+	for i := len(p.rules) - 1; i >= 0; i-- {
+		if rule := p.rules[i]; rule.matches(path, change) {
+			f.Outcome, f.Reason = rule.outcome, rule.reason
+			if f.Reason == "" {
+				f.Reason = "matched rule " + strconv.Itoa(i+1)
+			}
+			return f
+		}
+	}
+	if p.onlyModifications && (change == Added || change == Renamed) {
+		f.Outcome, f.Reason = Warn, string(change)+" paths only warn"
+		return f
+	}
+	f.Outcome, f.Reason = Fail, "unexpected change"
+	return f
+}
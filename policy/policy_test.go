@@ -0,0 +1,150 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package policy
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/govice/golinks/blockmap"
+	"github.com/pkg/errors"
+)
+
+func TestPolicy_Evaluate(t *testing.T) {
+	p := NewPolicy()
+	if err := p.Allow("logs/", "*.tmp"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.AddRule([]string{"docs/"}, nil, Warn, "docs may change"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.AddRule([]string{"docs/LICENSE"}, []Change{Modified, Removed}, Fail, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		diff    blockmap.DiffResult
+		only    bool
+		outcome Outcome
+		reason  string
+	}{
+		{"no drift", blockmap.DiffResult{}, false, Pass, ""},
+		{"allowed directory", blockmap.DiffResult{Modified: []string{"logs/today.log"}}, false, Pass, "allowed"},
+		{"allowed pattern", blockmap.DiffResult{Removed: []string{"build/a.tmp"}}, false, Pass, "allowed"},
+		{"rule", blockmap.DiffResult{Modified: []string{"docs/guide.md"}}, false, Warn, "docs may change"},
+		{"later rule", blockmap.DiffResult{Modified: []string{"docs/LICENSE"}}, false, Fail, "matched rule 2"},
+		{"rule change kinds", blockmap.DiffResult{Added: []string{"docs/LICENSE"}}, false, Warn, "docs may change"},
+		{"unexpected", blockmap.DiffResult{Added: []string{"bin/tool"}}, false, Fail, "unexpected change"},
+		{"addition", blockmap.DiffResult{Added: []string{"bin/tool"}}, true, Warn, "added paths only warn"},
+		{"rename", blockmap.DiffResult{Renamed: []blockmap.Rename{{From: "a", To: "b"}}}, true, Warn, "renamed paths only warn"},
+		{"renamed out of allowed", blockmap.DiffResult{Renamed: []blockmap.Rename{{From: "logs/a", To: "b"}}}, false, Pass, "allowed"},
+		{"modification", blockmap.DiffResult{Modified: []string{"bin/tool"}}, true, Fail, "unexpected change"},
+		{"removal", blockmap.DiffResult{Removed: []string{"bin/tool"}}, true, Fail, "unexpected change"},
+	}
+	for _, test := range tests {
+		p.SetFailOnlyOnModifications(test.only)
+		result := p.Evaluate(&test.diff)
+		if result.Outcome != test.outcome {
+			t.Errorf("%s: expected %v, got %v", test.name, test.outcome, result.Outcome)
+		}
+		if test.reason != "" && (len(result.Findings) != 1 || result.Findings[0].Reason != test.reason) {
+			t.Errorf("%s: expected reason %q, got %+v", test.name, test.reason, result.Findings)
+		}
+	}
+}
+
+func TestPolicy_EvaluateReport(t *testing.T) {
+	p := NewPolicy()
+	if err := p.AddRule([]string{"*"}, []Change{Metadata}, Warn, "permissions drift"); err != nil {
+		t.Fatal(err)
+	}
+	p.SetFailOnlyOnModifications(true)
+	result := p.EvaluateReport(&blockmap.VerificationReport{
+		Added:    []string{"new"},
+		Missing:  []string{"gone"},
+		Metadata: []string{"mode"},
+	})
+	expected := []Finding{
+		{Path: "new", Change: Added, Outcome: Warn, Reason: "added paths only warn"},
+		{Path: "gone", Change: Removed, Outcome: Fail, Reason: "unexpected change"},
+		{Path: "mode", Change: Metadata, Outcome: Warn, Reason: "permissions drift"},
+	}
+	if result.Outcome != Fail || !reflect.DeepEqual(result.Findings, expected) {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if len(result.Failures()) != 1 || len(result.Warnings()) != 2 {
+		t.Errorf("expected one failure and two warnings, got %+v", result)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Result
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&decoded, result) {
+		t.Errorf("expected %+v to round trip, got %+v", result, decoded)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "policy.json")
+	config := `{
+		"allow": ["cache/"],
+		"rules": [{"paths": ["*.md"], "changes": ["modified"], "outcome": "warn"}],
+		"failOnlyOnModifications": true
+	}`
+	if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := p.Evaluate(&blockmap.DiffResult{Added: []string{"new"}, Modified: []string{"cache/a", "README.md"}})
+	if result.Outcome != Warn || len(result.Warnings()) != 2 {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	for _, bad := range []struct {
+		config string
+		err    error
+	}{
+		{`{"rules": [{"paths": ["*"], "outcome": "maybe"}]}`, ErrUnknownOutcome},
+		{`{"rules": [{"paths": ["*"], "changes": ["touched"], "outcome": "fail"}]}`, ErrUnknownChange},
+	} {
+		if err := ioutil.WriteFile(path, []byte(bad.config), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(path); errors.Cause(err) != bad.err {
+			t.Errorf("expected %v, got %v", bad.err, err)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+// Package remote verifies files served over HTTP against a blockmap without
+// keeping local copies of them.
+package remote
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/govice/golinks/archivemap"
+	"github.com/govice/golinks/blockmap"
+	"github.com/pkg/errors"
+)
+
+// Status is the outcome of verifying a single file
+type Status string
+
+// File verification outcomes
+const (
+	// Pass means the served file matches its archived hash
+	Pass Status = "pass"
+	// Fail means the served file differs from its archived hash
+	Fail Status = "fail"
+	// Missing means the server reported the file doesn't exist
+	Missing Status = "missing"
+	// Error means the file couldn't be fetched
+	Error Status = "error"
+)
+
+// errRangesUnsupported is returned when a server ignores range requests
+var errRangesUnsupported = errors.New("remote: server does not support range requests")
+
+// Result is the verification outcome of a single archived path
+type Result struct {
+	Path   string `json:"path"`
+	Status Status `json:"status"`
+	Err    string `json:"error,omitempty"`
+	// ChangedChunks are the chunks that failed when verified with range requests
+	ChangedChunks []archivemap.Chunk `json:"changedChunks,omitempty"`
+}
+
+// Report holds the result of every verified path sorted by path
+type Report struct {
+	Results []Result `json:"results"`
+}
+
+// Valid returns true if every verified file passed
+func (r *Report) Valid() bool {
+	return len(r.Failed()) == 0
+}
+
+// Failed returns the results of files that didn't pass
+func (r *Report) Failed() []Result {
+	var failed []Result
+	for _, result := range r.Results {
+		if result.Status != Pass {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// Verifier fetches archived files from a base URL and checks their hashes
+type Verifier struct {
+	base        *url.URL
+	httpClient  *http.Client
+	concurrency int
+	useRanges   bool
+}
+
+// NewVerifier returns a verifier fetching archived paths relative to baseURL
+func NewVerifier(baseURL string) (*Verifier, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "remote: invalid base URL")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, errors.New("remote: base URL must be an http or https URL")
+	}
+	return &Verifier{base: u, httpClient: http.DefaultClient, concurrency: 1}, nil
+}
+
+// SetHTTPClient sets the HTTP client used to fetch files
+func (v *Verifier) SetHTTPClient(client *http.Client) {
+	v.httpClient = client
+}
+
+// SetConcurrency sets the number of files fetched at once. Values less than
+// 1 are treated as 1.
+func (v *Verifier) SetConcurrency(n int) {
+	if n < 1 {
+		n = 1
+	}
+	v.concurrency = n
+}
+
+// SetRangeRequests verifies chunked entries one chunk at a time with range
+// requests when enabled, so the changed regions of a failing file are
+// reported. Servers ignoring ranges fall back to fetching the whole file.
+func (v *Verifier) SetRangeRequests(enabled bool) {
+	v.useRanges = enabled
+}
+
+// Verify fetches and checks every file archived in b
+func (v *Verifier) Verify(ctx context.Context, b *blockmap.BlockMap) *Report {
+	return v.VerifyPaths(ctx, b, b.FilePaths())
+}
+
+// VerifyPaths fetches and checks the given archived paths. Paths not in the
+// archive fail with an error result.
+func (v *Verifier) VerifyPaths(ctx context.Context, b *blockmap.BlockMap, paths []string) *Report {
+	sorted := append([]string{}, paths...)
+	sort.Strings(sorted)
+	report := &Report{Results: make([]Result, len(sorted))}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	workers := v.concurrency
+	if workers > len(sorted) {
+		workers = len(sorted)
+	}
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				report.Results[index] = v.verifyPath(ctx, b, sorted[index])
+			}
+		}()
+	}
+	for i := range sorted {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return report
+}
+
+// verifyPath checks a single archived path
+func (v *Verifier) verifyPath(ctx context.Context, b *blockmap.BlockMap, path string) Result {
+	result := Result{Path: path, Status: Pass}
+	expected, ok := b.Archive[path]
+	if !ok {
+		result.Status, result.Err = Error, "path is not archived"
+		return result
+	}
+
+	newHash, err := b.FileHash.Func()
+	if err != nil {
+		return errorResult(result, err)
+	}
+	entry := b.Entries[path]
+	if v.useRanges && len(entry.Chunks) > 0 {
+		changed, err := v.verifyChunks(ctx, path, entry, newHash)
+		if err == nil {
+			if len(changed) > 0 {
+				result.Status, result.ChangedChunks = Fail, changed
+			}
+			return result
+		}
+		if err != errRangesUnsupported {
+			return errorResult(result, err)
+		}
+	}
+
+	resp, err := v.get(ctx, path, "")
+	if err != nil {
+		return errorResult(result, err)
+	}
+	defer resp.Body.Close()
+	hash := newHash()
+	if _, err := io.Copy(hash, resp.Body); err != nil {
+		return errorResult(result, errors.Wrap(err, "remote: failed to read "+path))
+	}
+	if !bytes.Equal(hash.Sum(nil), b.Digest(expected)) {
+		result.Status = Fail
+	}
+	return result
+}
+
+// verifyChunks fetches each chunk of an entry with a range request and
+// returns the chunks whose hash doesn't match
+func (v *Verifier) verifyChunks(ctx context.Context, path string, entry archivemap.Entry, newHash func() hash.Hash) ([]archivemap.Chunk, error) {
+	var changed []archivemap.Chunk
+	for _, chunk := range entry.Chunks {
+		resp, err := v.get(ctx, path, fmt.Sprintf("bytes=%d-%d", chunk.Offset, chunk.Offset+chunk.Size-1))
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusPartialContent {
+			resp.Body.Close()
+			return nil, errRangesUnsupported
+		}
+		//A file of a different size can't match even if its chunks do
+		if total := resp.Header.Get("Content-Range"); !strings.HasSuffix(total, fmt.Sprintf("/%d", entry.Size)) {
+			resp.Body.Close()
+			return entry.Chunks, nil
+		}
+
+		hash := newHash()
+		_, err = io.Copy(hash, io.LimitReader(resp.Body, chunk.Size+1))
+		resp.Body.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "remote: failed to read "+path)
+		}
+		if !bytes.Equal(hash.Sum(nil), chunk.Hash) {
+			changed = append(changed, chunk)
+		}
+	}
+	return changed, nil
+}
+
+// get requests an archived path, with a Range header when byteRange is set
+func (v *Verifier) get(ctx context.Context, path, byteRange string) (*http.Response, error) {
+	u := *v.base
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	u.RawPath = strings.TrimSuffix(v.base.EscapedPath(), "/") + "/" + strings.Join(segments, "/")
+	u.Path = strings.TrimSuffix(v.base.Path, "/") + "/" + path
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "remote: failed to create request")
+	}
+	req = req.WithContext(ctx)
+	if byteRange != "" {
+		req.Header.Set("Range", byteRange)
+	}
+	resp, err := v.httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "remote: request failed")
+	}
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusPartialContent {
+		return resp, nil
+	}
+	resp.Body.Close()
+	return nil, &statusError{code: resp.StatusCode}
+}
+
+// statusError is an unexpected HTTP response status
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("remote: unexpected status %d %s", e.code, http.StatusText(e.code))
+}
+
+// errorResult records a fetch error, distinguishing missing files
+func errorResult(result Result, err error) Result {
+	result.Status, result.Err = Error, err.Error()
+	if se, ok := errors.Cause(err).(*statusError); ok && (se.code == http.StatusNotFound || se.code == http.StatusGone) {
+		result.Status = Missing
+	}
+	return result
+}
@@ -0,0 +1,141 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/govice/golinks/blockmap"
+)
+
+func writeMirror(t *testing.T) (string, *blockmap.BlockMap) {
+	root, err := ioutil.TempDir("", "remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"a":           []byte("alpha"),
+		"dir/b c":     []byte("bravo"),
+		"dir/large":   bytes.Repeat([]byte("0123456789"), 1000),
+		"dir/missing": []byte("gone soon"),
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b := blockmap.New(root)
+	b.SetChunking(blockmap.FixedChunks, 1000, 2000)
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	return root, b
+}
+
+func statuses(report *Report) map[string]Status {
+	result := make(map[string]Status)
+	for _, r := range report.Results {
+		result[r.Path] = r.Status
+	}
+	return result
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	root, b := writeMirror(t)
+	defer os.RemoveAll(root)
+	server := httptest.NewServer(http.StripPrefix("/mirror", http.FileServer(http.Dir(root))))
+	defer server.Close()
+
+	v, err := NewVerifier(server.URL + "/mirror/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.SetConcurrency(4)
+	v.SetRangeRequests(true)
+	if report := v.Verify(context.Background(), b); !report.Valid() || len(report.Results) != 4 {
+		t.Fatalf("expected a valid mirror, got %+v", report)
+	}
+
+	//Change the third chunk of the large file and remove a file
+	large := filepath.Join(root, "dir", "large")
+	data, _ := ioutil.ReadFile(large)
+	data[2500] = 'x'
+	if err := ioutil.WriteFile(large, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(root, "dir", "missing")); err != nil {
+		t.Fatal(err)
+	}
+
+	report := v.Verify(context.Background(), b)
+	expected := map[string]Status{"a": Pass, "dir/b c": Pass, "dir/large": Fail, "dir/missing": Missing}
+	if got := statuses(report); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	if failed := report.Failed(); len(failed) != 2 || len(failed[0].ChangedChunks) != 1 || failed[0].ChangedChunks[0].Offset != 2000 {
+		t.Errorf("expected the changed chunk at 2000 to be reported, got %+v", failed)
+	}
+
+	report = v.VerifyPaths(context.Background(), b, []string{"a", "unknown"})
+	if got := statuses(report); got["a"] != Pass || got["unknown"] != Error {
+		t.Errorf("unexpected results %v", got)
+	}
+}
+
+func TestVerifier_noRanges(t *testing.T) {
+	root, b := writeMirror(t)
+	defer os.RemoveAll(root)
+	files := http.FileServer(http.Dir(root))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del("Range")
+		files.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	v, err := NewVerifier(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.SetRangeRequests(true)
+	if report := v.Verify(context.Background(), b); !report.Valid() {
+		t.Errorf("expected whole file fallback to pass, got %+v", report)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(root, "dir", "large"), []byte("short"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	report := v.Verify(context.Background(), b)
+	if got := statuses(report); got["dir/large"] != Fail || len(report.Failed()) != 1 {
+		t.Errorf("unexpected results %v", got)
+	}
+
+	if _, err := NewVerifier("ftp://example.com"); err == nil {
+		t.Error("expected an error for a non http base URL")
+	}
+}
@@ -0,0 +1,290 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/govice/golinks/auth"
+	"github.com/govice/golinks/blockchain"
+	"github.com/govice/golinks/blockmap"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Metadata keys selecting and authenticating a request's namespace
+const (
+	NamespaceMetadata     = "golinks-namespace"
+	AuthorizationMetadata = "authorization"
+)
+
+// Quota limits a namespace's use of the server. Zero values are unlimited.
+type Quota struct {
+	// MaxBlocks limits the blocks appended to the namespace's chain after
+	// its genesis block
+	MaxBlocks int `json:"maxBlocks,omitempty"`
+	// MaxLinkSize limits the size in bytes of links sent to the server
+	MaxLinkSize int `json:"maxLinkSize,omitempty"`
+	// RequestsPerMinute limits the namespace's request rate
+	RequestsPerMinute int `json:"requestsPerMinute,omitempty"`
+}
+
+// Namespace is a tenant of the server with its own chain, access policy,
+// roots and quota. Requests select a namespace with the golinks-namespace
+// metadata key and authenticate with a bearer token in the authorization key,
+// see Credentials, or a verified TLS client certificate.
+type Namespace struct {
+	name   string
+	policy *auth.Policy
+	roots  []string
+	quota  Quota
+
+	mu    sync.RWMutex
+	chain *blockchain.Blockchain
+
+	rateMu   sync.Mutex
+	window   time.Time
+	requests int
+}
+
+// NewNamespace returns a namespace named name holding chain. Namespaces
+// without a policy or token accept every request.
+func NewNamespace(name string, chain *blockchain.Blockchain) *Namespace {
+	return &Namespace{name: name, chain: chain}
+}
+
+// Name returns the namespace's name
+func (ns *Namespace) Name() string {
+	return ns.name
+}
+
+// SetPolicy sets the policy authorizing requests to the namespace
+func (ns *Namespace) SetPolicy(p *auth.Policy) {
+	ns.policy = p
+}
+
+// SetToken grants the write role to requests carrying the bearer token
+func (ns *Namespace) SetToken(token string) {
+	if ns.policy == nil {
+		ns.policy = auth.NewPolicy()
+	}
+	ns.policy.AddToken(ns.name, token, auth.Write)
+}
+
+// SetTokenHash grants the write role to requests carrying a bearer token with
+// the SHA256 digest hash, so configuration files needn't hold the token
+func (ns *Namespace) SetTokenHash(hash []byte) {
+	if ns.policy == nil {
+		ns.policy = auth.NewPolicy()
+	}
+	ns.policy.AddTokenHash(ns.name, hash, auth.Write)
+}
+
+// SetRoots restricts the directories the namespace may generate and verify
+// links for to roots and the directories below them
+func (ns *Namespace) SetRoots(roots ...string) {
+	ns.roots = nil
+	for _, root := range roots {
+		ns.roots = append(ns.roots, filepath.Clean(root))
+	}
+}
+
+// SetQuota sets the namespace's quota
+func (ns *Namespace) SetQuota(quota Quota) {
+	ns.quota = quota
+}
+
+// Chain returns the namespace's chain
+func (ns *Namespace) Chain() *blockchain.Blockchain {
+	return ns.chain
+}
+
+// authorize checks the request in ctx may perform operations of the
+// required role in the namespace
+func (ns *Namespace) authorize(ctx context.Context, required auth.Role) error {
+	if ns.policy == nil {
+		return nil
+	}
+	_, err := ns.policy.AuthorizeContext(ctx, required)
+	switch errors.Cause(err) {
+	case nil:
+		return nil
+	case auth.ErrForbidden:
+		return status.Error(codes.PermissionDenied, err.Error()+" in namespace "+ns.name)
+	default:
+		return status.Error(codes.Unauthenticated, err.Error()+" for namespace "+ns.name)
+	}
+}
+
+// actor returns the audit actor of the request in ctx: the authenticated
+// principal's name at the client's address
+func (ns *Namespace) actor(ctx context.Context) string {
+	name := "anonymous"
+	if ns.policy != nil {
+		if principal, err := ns.policy.AuthorizeContext(ctx, auth.None); err == nil {
+			name = principal.Name
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		name += "@" + p.Addr.String()
+	}
+	return name
+}
+
+// allow counts a request against the namespace's request rate
+func (ns *Namespace) allow(now time.Time) error {
+	if ns.quota.RequestsPerMinute <= 0 {
+		return nil
+	}
+	ns.rateMu.Lock()
+	defer ns.rateMu.Unlock()
+	if now.Sub(ns.window) >= time.Minute {
+		ns.window, ns.requests = now, 0
+	}
+	if ns.requests >= ns.quota.RequestsPerMinute {
+		return status.Error(codes.ResourceExhausted, "request quota exceeded for namespace "+ns.name)
+	}
+	ns.requests++
+	return nil
+}
+
+// checkLink checks a link sent to the namespace against its size quota
+func (ns *Namespace) checkLink(link []byte) error {
+	if ns.quota.MaxLinkSize > 0 && len(link) > ns.quota.MaxLinkSize {
+		return status.Error(codes.ResourceExhausted, "link exceeds the size quota of namespace "+ns.name)
+	}
+	return nil
+}
+
+// checkRoot checks the namespace may access root. Symbolic links are
+// resolved first so a link inside a namespace root can't reach outside it.
+func (ns *Namespace) checkRoot(root string) error {
+	if len(ns.roots) == 0 {
+		return nil
+	}
+	root = filepath.Clean(root)
+	resolved := resolvePath(root)
+	for _, allowed := range ns.roots {
+		if rel, err := filepath.Rel(resolvePath(allowed), resolved); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil
+		}
+	}
+	return status.Error(codes.PermissionDenied, "root "+root+" is outside namespace "+ns.name)
+}
+
+// resolvePath returns path with its symbolic links evaluated, or path itself
+// if it can't be resolved
+func resolvePath(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return path
+}
+
+// checkLinkRoots checks the namespace may access every root a link walks,
+// including the roots of a link archiving several directories. Links
+// following symbolic links could walk anywhere, so namespaces restricted to
+// roots refuse them.
+func (ns *Namespace) checkLinkRoots(b *blockmap.BlockMap) error {
+	if len(ns.roots) > 0 && b.FollowSymlinks {
+		return status.Error(codes.PermissionDenied, "links following symbolic links are not allowed in namespace "+ns.name)
+	}
+	if err := ns.checkRoot(b.Root); err != nil {
+		return err
+	}
+	for _, root := range b.Roots {
+		if err := ns.checkRoot(root); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkAppend checks the namespace's chain may grow by another block. The
+// namespace's chain lock must be held.
+func (ns *Namespace) checkAppend() error {
+	if ns.quota.MaxBlocks > 0 && ns.chain.Length()-1 >= ns.quota.MaxBlocks {
+		return status.Error(codes.ResourceExhausted, "block quota exceeded for namespace "+ns.name)
+	}
+	return nil
+}
+
+// AddNamespace hosts ns on the server, replacing any namespace of the same name
+func (s *Server) AddNamespace(ns *Namespace) {
+	s.nsMu.Lock()
+	defer s.nsMu.Unlock()
+	if s.namespaces == nil {
+		s.namespaces = make(map[string]*Namespace)
+	}
+	s.namespaces[ns.name] = ns
+}
+
+// namespace returns the namespace selected by the request in ctx, checking
+// the request may perform operations of the required role in it. Requests
+// without a namespace use the server's default namespace.
+func (s *Server) namespace(ctx context.Context, required auth.Role) (*Namespace, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ns := s.def
+	if values := md.Get(NamespaceMetadata); len(values) > 0 && values[0] != "" {
+		s.nsMu.RLock()
+		ns = s.namespaces[values[0]]
+		s.nsMu.RUnlock()
+		if ns == nil {
+			return nil, status.Error(codes.NotFound, "unknown namespace "+values[0])
+		}
+	}
+	if ns.chain == nil {
+		return nil, status.Error(codes.InvalidArgument, "a namespace is required")
+	}
+	if err := ns.authorize(ctx, required); err != nil {
+		return nil, err
+	}
+	if err := ns.allow(time.Now()); err != nil {
+		return nil, err
+	}
+	return ns, nil
+}
+
+// Credentials attach a namespace and its bearer token to requests, for use
+// with grpc.WithPerRPCCredentials
+type Credentials struct {
+	Namespace string
+	Token     string
+	// Insecure allows sending the token without transport security
+	Insecure bool
+}
+
+// GetRequestMetadata implements credentials.PerRPCCredentials
+func (c Credentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	md := map[string]string{NamespaceMetadata: c.Namespace}
+	if c.Token != "" {
+		md[AuthorizationMetadata] = "Bearer " + c.Token
+	}
+	return md, nil
+}
+
+// RequireTransportSecurity implements credentials.PerRPCCredentials
+func (c Credentials) RequireTransportSecurity() bool {
+	return !c.Insecure
+}
@@ -0,0 +1,381 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+//go:generate protoc --go_out=plugins=grpc,paths=source_relative:. golinks.proto
+
+// Package server implements the Golinks gRPC service, exposing blockmap and
+// chain operations so golinks can run as a long-lived integrity daemon.
+package server
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/govice/golinks/audit"
+	"github.com/govice/golinks/auth"
+	"github.com/govice/golinks/block"
+	"github.com/govice/golinks/blockchain"
+	"github.com/govice/golinks/blockmap"
+	"github.com/govice/golinks/cache"
+	"github.com/govice/golinks/codec"
+	"github.com/govice/golinks/events"
+	"github.com/govice/golinks/metrics"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Server implements GolinksServer over the chains of one or more namespaces
+type Server struct {
+	def        *Namespace
+	nsMu       sync.RWMutex
+	namespaces map[string]*Namespace
+	metrics    *metrics.Collector
+	cache      cache.Cache
+	events     *events.Broker
+}
+
+// New returns a Server appending blocks to chain for requests without a
+// namespace. A nil chain requires every request to select a namespace added
+// with AddNamespace.
+func New(chain *blockchain.Blockchain) *Server {
+	return &Server{def: NewNamespace("", chain)}
+}
+
+// SetMetrics records generations and verifications served in c. A nil
+// collector disables metrics.
+func (s *Server) SetMetrics(c *metrics.Collector) {
+	s.metrics = c
+}
+
+// SetCache caches proof and diff replies in c, keyed by the digests of the
+// requested links, so repeated lookups don't decode the links again. Cache
+// failures are treated as misses. A nil cache disables caching.
+func (s *Server) SetCache(c cache.Cache) {
+	s.cache = c
+}
+
+// SetEvents publishes the result of every verification served to b. Events
+// of every namespace are published to b, so subscribers should be operators.
+// A nil broker disables events.
+func (s *Server) SetEvents(b *events.Broker) {
+	s.events = b
+}
+
+// SetPolicy authorizes requests to the default namespace with p. Reading
+// blocks, proofs and diffs requires the read role, generating and verifying
+// links the verify role and appending blocks the write role. A nil policy
+// accepts every request.
+func (s *Server) SetPolicy(p *auth.Policy) {
+	s.def.SetPolicy(p)
+}
+
+// Locker returns the lock guarding the server's default chain, so other
+// services sharing the chain can serialize their writes with the server's
+func (s *Server) Locker() sync.Locker {
+	return &s.def.mu
+}
+
+// Register registers the Golinks service with s
+func (s *Server) Register(srv *grpc.Server) {
+	RegisterGolinksServer(srv, s)
+}
+
+// Generate builds a blockmap for a directory on the server
+func (s *Server) Generate(ctx context.Context, req *GenerateRequest) (*GenerateReply, error) {
+	ns, err := s.namespace(ctx, auth.Verify)
+	if err != nil {
+		return nil, err
+	}
+	if req.Root == "" {
+		return nil, status.Error(codes.InvalidArgument, "root is required")
+	}
+	if err := ns.checkRoot(req.Root); err != nil {
+		return nil, err
+	}
+	format := req.Format
+	if format == "" {
+		format = codec.JSON.Name()
+	}
+	c, err := codec.ByName(format)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	b := blockmap.New(req.Root,
+		blockmap.WithIgnorePatterns(req.IgnorePatterns...),
+		blockmap.WithHashMode(blockmap.HashMode(req.HashMode)))
+	start := time.Now()
+	if s.metrics != nil {
+		b.OnProgress(s.metrics.Progress())
+	}
+	err = b.GenerateContext(ctx)
+	if s.metrics != nil {
+		s.metrics.ObserveGenerate(start, err)
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	link, err := codec.Encode(c, b)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &GenerateReply{RootHash: b.RootHash, Link: link}, nil
+}
+
+// Verify compares a link against the current contents of its root. The
+// request root overrides the root recorded in the link.
+func (s *Server) Verify(ctx context.Context, req *VerifyRequest) (*VerifyReply, error) {
+	ns, err := s.namespace(ctx, auth.Verify)
+	if err != nil {
+		return nil, err
+	}
+	if err := ns.checkLink(req.Link); err != nil {
+		return nil, err
+	}
+	b, err := decodeLink(req.Link)
+	if err != nil {
+		return nil, err
+	}
+	if req.Root != "" {
+		b.Root = req.Root
+	}
+	if err := ns.checkLinkRoots(b); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	if s.metrics != nil {
+		b.OnProgress(s.metrics.Progress())
+	}
+	report, err := b.VerifyContext(ctx)
+	if s.metrics != nil {
+		s.metrics.ObserveVerify(start, report, err)
+	}
+	s.publishVerification(ns, b.Root, report, err)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &VerifyReply{
+		Valid:           report.Valid(),
+		RootHashMatches: report.RootHashMatches,
+		Missing:         report.Missing,
+		Modified:        report.Modified,
+		Added:           report.Added,
+		Metadata:        report.Metadata,
+	}, nil
+}
+
+// publishVerification publishes a verification's result when events are enabled
+func (s *Server) publishVerification(ns *Namespace, root string, report *blockmap.VerificationReport, err error) {
+	if s.events == nil {
+		return
+	}
+	event := events.Event{Type: events.TypeVerification, Namespace: ns.name, Root: root, Report: report}
+	if err != nil {
+		event.Error = err.Error()
+	} else {
+		event.Valid = report.Valid()
+	}
+	s.events.Publish(event)
+}
+
+// Diff compares two links
+func (s *Server) Diff(ctx context.Context, req *DiffRequest) (*DiffReply, error) {
+	ns, err := s.namespace(ctx, auth.Read)
+	if err != nil {
+		return nil, err
+	}
+	for _, link := range [][]byte{req.A, req.B} {
+		if err := ns.checkLink(link); err != nil {
+			return nil, err
+		}
+	}
+	reply := &DiffReply{}
+	err = s.cached(ctx, "diff:"+linkKey(req.A)+":"+linkKey(req.B), reply, func() error {
+		a, err := decodeLink(req.A)
+		if err != nil {
+			return err
+		}
+		b, err := decodeLink(req.B)
+		if err != nil {
+			return err
+		}
+		diff := blockmap.Diff(a, b)
+		reply.Added, reply.Removed, reply.Modified = diff.Added, diff.Removed, diff.Modified
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// GetBlock looks up a chain block by index or block hash
+func (s *Server) GetBlock(ctx context.Context, req *GetBlockRequest) (*Block, error) {
+	ns, err := s.namespace(ctx, auth.Read)
+	if err != nil {
+		return nil, err
+	}
+	ns.mu.RLock()
+	defer ns.mu.RUnlock()
+
+	var blk *block.Block
+	switch lookup := req.Lookup.(type) {
+	case *GetBlockRequest_Index:
+		if lookup.Index >= 0 && lookup.Index < int64(ns.chain.Length()) {
+			blk = ns.chain.At(int(lookup.Index))
+		}
+	case *GetBlockRequest_Hash:
+		blk = ns.chain.FindByBlockHash(lookup.Hash)
+	default:
+		return nil, status.Error(codes.InvalidArgument, "index or hash is required")
+	}
+	if blk == nil {
+		return nil, status.Error(codes.NotFound, blockchain.ErrBlockNotFound.Error())
+	}
+	return blockReply(blk), nil
+}
+
+// AppendBlock records a link's root hash in a new chain block. Appends to
+// chains with an audit log are attributed to the authenticated client.
+func (s *Server) AppendBlock(ctx context.Context, req *AppendBlockRequest) (*Block, error) {
+	ns, err := s.namespace(ctx, auth.Write)
+	if err != nil {
+		return nil, err
+	}
+	if err := ns.checkLink(req.Link); err != nil {
+		return nil, err
+	}
+	b, err := decodeLink(req.Link)
+	if err != nil {
+		return nil, err
+	}
+
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	if err := ns.checkAppend(); err != nil {
+		return nil, err
+	}
+	blk, err := ns.chain.AddContext(audit.NewContext(ctx, ns.actor(ctx)), b)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return blockReply(blk), nil
+}
+
+// GetProof returns a merkle inclusion proof for a path in a link
+func (s *Server) GetProof(ctx context.Context, req *GetProofRequest) (*ProofReply, error) {
+	ns, err := s.namespace(ctx, auth.Read)
+	if err != nil {
+		return nil, err
+	}
+	if err := ns.checkLink(req.Link); err != nil {
+		return nil, err
+	}
+	reply := &ProofReply{}
+	err = s.cached(ctx, "proof:"+linkKey(req.Link)+":"+req.Path, reply, func() error {
+		b, err := decodeLink(req.Link)
+		if err != nil {
+			return err
+		}
+		root, err := b.MerkleRoot()
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		proof, err := b.Proof(req.Path)
+		if errors.Cause(err) == blockmap.ErrPathNotArchived {
+			return status.Error(codes.NotFound, err.Error())
+		} else if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+
+		reply.MerkleRoot, reply.Path, reply.Hash = root, proof.Path, proof.Hash
+		for _, sibling := range proof.Siblings {
+			reply.Siblings = append(reply.Siblings, &ProofNode{Hash: sibling.Hash, Left: sibling.Left})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// cached decodes the reply cached under key into reply, or fills reply with
+// compute and caches it
+func (s *Server) cached(ctx context.Context, key string, reply proto.Message, compute func() error) error {
+	if s.cache == nil {
+		return compute()
+	}
+	value, ok, err := s.cache.Get(ctx, key)
+	hit := err == nil && ok && proto.Unmarshal(value, reply) == nil
+	if s.metrics != nil {
+		s.metrics.ObserveCache(hit)
+	}
+	if hit {
+		return nil
+	}
+
+	proto.Reset(reply)
+	if err := compute(); err != nil {
+		return err
+	}
+	if value, err := proto.Marshal(reply); err == nil {
+		s.cache.Set(ctx, key, value)
+	}
+	return nil
+}
+
+// linkKey returns the hex SHA512 digest identifying an encoded link in cache
+// keys
+func linkKey(link []byte) string {
+	sum := sha512.Sum512(link)
+	return hex.EncodeToString(sum[:])
+}
+
+// MerkleProof converts a proof reply back into a blockmap proof for verification
+func (r *ProofReply) MerkleProof() *blockmap.MerkleProof {
+	proof := &blockmap.MerkleProof{Path: r.Path, Hash: r.Hash}
+	for _, sibling := range r.Siblings {
+		proof.Siblings = append(proof.Siblings, blockmap.ProofNode{Hash: sibling.Hash, Left: sibling.Left})
+	}
+	return proof
+}
+
+func decodeLink(link []byte) (*blockmap.BlockMap, error) {
+	b := blockmap.New("")
+	if err := b.Decode(link); err != nil {
+		return nil, status.Error(codes.InvalidArgument, errors.Wrap(err, "failed to decode link").Error())
+	}
+	return b, nil
+}
+
+func blockReply(blk *block.Block) *Block {
+	return &Block{
+		Index:      int64(blk.Index),
+		Timestamp:  blk.Timestamp,
+		Data:       blk.Data,
+		ParentHash: blk.ParentHash,
+		RootHash:   blk.RootHash,
+		Nonce:      blk.Nonce,
+		BlockHash:  blk.BlockHash,
+	}
+}
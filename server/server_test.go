@@ -0,0 +1,378 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/govice/golinks/audit"
+	"github.com/govice/golinks/auth"
+	"github.com/govice/golinks/block"
+	"github.com/govice/golinks/blockchain"
+	"github.com/govice/golinks/blockmap"
+	"github.com/govice/golinks/cache"
+	"github.com/govice/golinks/codec"
+	"github.com/govice/golinks/events"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestServer(t *testing.T) {
+	root, err := ioutil.TempDir("", "server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := ioutil.WriteFile(filepath.Join(root, "a"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "b"), []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	chain, err := blockchain.New(block.NewSHA512Genesis())
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	s := New(chain)
+	broker := events.NewBroker(events.DefaultHistory)
+	s.SetEvents(broker)
+	s.Register(srv)
+	go srv.Serve(listener)
+	defer srv.Stop()
+
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(
+		func(ctx context.Context, _ string) (net.Conn, error) { return listener.Dial() }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := NewGolinksClient(conn)
+	ctx := context.Background()
+
+	generated, err := client.Generate(ctx, &GenerateRequest{Root: root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(generated.RootHash) == 0 {
+		t.Error("expected root hash")
+	}
+
+	verified, err := client.Verify(ctx, &VerifyRequest{Link: generated.Link})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verified.Valid || !verified.RootHashMatches {
+		t.Errorf("expected valid link %+v", verified)
+	}
+	if published := broker.Since(0); len(published) != 1 || !published[0].Valid || published[0].Root != root {
+		t.Errorf("expected a verification event, got %+v", published)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(root, "a"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := client.Generate(ctx, &GenerateRequest{Root: root, Format: "cbor"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff, err := client.Diff(ctx, &DiffRequest{A: generated.Link, B: changed.Link})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Modified) != 1 || diff.Modified[0] != "a" {
+		t.Errorf("unexpected diff %+v", diff)
+	}
+
+	appended, err := client.AppendBlock(ctx, &AppendBlockRequest{Link: changed.Link})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if appended.Index != 1 || string(appended.RootHash) != string(changed.RootHash) {
+		t.Errorf("unexpected block %+v", appended)
+	}
+	byHash, err := client.GetBlock(ctx, &GetBlockRequest{Lookup: &GetBlockRequest_Hash{Hash: appended.BlockHash}})
+	if err != nil || byHash.Index != 1 {
+		t.Error("failed to get block by hash", err)
+	}
+	_, err = client.GetBlock(ctx, &GetBlockRequest{Lookup: &GetBlockRequest_Index{Index: 5}})
+	if status.Code(err) != codes.NotFound {
+		t.Error("expected not found, got", err)
+	}
+	source := NewBlockSource(ctx, client)
+	if blk, err := source.BlockAt(1); err != nil || blk.VerifySHA512() != nil {
+		t.Error("failed to fetch block from source", err)
+	}
+	if _, err := source.BlockAt(5); err != blockchain.ErrBlockNotFound {
+		t.Error("expected missing block, got", err)
+	}
+
+	proof, err := client.GetProof(ctx, &GetProofRequest{Link: changed.Link, Path: "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !blockmap.VerifyProof(proof.MerkleRoot, proof.MerkleProof()) {
+		t.Error("failed to verify proof")
+	}
+	_, err = client.GetProof(ctx, &GetProofRequest{Link: changed.Link, Path: "missing"})
+	if status.Code(err) != codes.NotFound {
+		t.Error("expected not found, got", err)
+	}
+
+	if _, err := client.Diff(ctx, &DiffRequest{A: []byte("garbage")}); status.Code(err) != codes.InvalidArgument {
+		t.Error("expected invalid argument, got", err)
+	}
+}
+
+func TestServer_Cache(t *testing.T) {
+	root, err := ioutil.TempDir("", "server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := ioutil.WriteFile(filepath.Join(root, "a"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	chain, err := blockchain.New(block.NewSHA512Genesis())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(chain)
+	c := cache.NewLRU(10)
+	s.SetCache(c)
+	ctx := context.Background()
+	generated, err := s.Generate(ctx, &GenerateRequest{Root: root})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := &GetProofRequest{Link: generated.Link, Path: "a"}
+	proof, err := s.GetProof(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Len() != 1 {
+		t.Fatal("expected the proof to be cached")
+	}
+	cached, err := s.GetProof(ctx, req)
+	if err != nil || !proto.Equal(proof, cached) {
+		t.Error("expected the cached proof, got", cached, err)
+	}
+
+	//Cached replies are served without decoding the link
+	key := "proof:" + linkKey(generated.Link) + ":a"
+	value, err := proto.Marshal(&ProofReply{Path: "cached"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Set(ctx, key, value)
+	if reply, err := s.GetProof(ctx, req); err != nil || reply.Path != "cached" {
+		t.Error("expected the reply from the cache, got", reply, err)
+	}
+
+	//Failures aren't cached
+	if _, err := s.GetProof(ctx, &GetProofRequest{Link: generated.Link, Path: "missing"}); status.Code(err) != codes.NotFound {
+		t.Error("expected not found, got", err)
+	}
+	if c.Len() != 1 {
+		t.Error("expected failed lookups not to be cached")
+	}
+}
+
+func TestServer_Namespaces(t *testing.T) {
+	root, err := ioutil.TempDir("", "server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := ioutil.WriteFile(filepath.Join(root, "a"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	auditDir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(auditDir)
+	auditLog, err := audit.Open(filepath.Join(auditDir, "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer auditLog.Close()
+
+	s := New(nil)
+	for _, name := range []string{"acme", "limited"} {
+		chain, err := blockchain.New(block.NewSHA512Genesis())
+		if err != nil {
+			t.Fatal(err)
+		}
+		chain.SetAuditLog(auditLog, name)
+		ns := NewNamespace(name, chain)
+		policy := auth.NewPolicy()
+		policy.AddToken("reader", name+"-reader", auth.Read)
+		ns.SetPolicy(policy)
+		ns.SetToken(name + "-token")
+		ns.SetRoots(root)
+		ns.SetQuota(Quota{MaxBlocks: 1})
+		if name == "limited" {
+			ns.SetQuota(Quota{RequestsPerMinute: 1, MaxLinkSize: 10})
+		}
+		s.AddNamespace(ns)
+	}
+	listener := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	s.Register(srv)
+	go srv.Serve(listener)
+	defer srv.Stop()
+
+	ctx := context.Background()
+	var conns []*grpc.ClientConn
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+	dial := func(creds Credentials) GolinksClient {
+		creds.Insecure = true
+		conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithPerRPCCredentials(creds),
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.Dial() }))
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns = append(conns, conn)
+		return NewGolinksClient(conn)
+	}
+
+	acme := dial(Credentials{Namespace: "acme", Token: "acme-token"})
+	generated, err := acme.Generate(ctx, &GenerateRequest{Root: root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := acme.AppendBlock(ctx, &AppendBlockRequest{Link: generated.Link}); err != nil {
+		t.Fatal(err)
+	}
+	escaping, err := decodeLink(generated.Link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	escaping.Roots = map[string]string{"x": filepath.Dir(root)}
+	escapingLink, err := codec.Encode(codec.JSON, escaping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	following, err := decodeLink(generated.Link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	following.FollowSymlinks = true
+	followingLink, err := codec.Encode(codec.JSON, following)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Dir(root), filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		client GolinksClient
+		call   func(GolinksClient) error
+		code   codes.Code
+	}{
+		{"block quota", acme, func(c GolinksClient) error {
+			_, err := c.AppendBlock(ctx, &AppendBlockRequest{Link: generated.Link})
+			return err
+		}, codes.ResourceExhausted},
+		{"root outside namespace", acme, func(c GolinksClient) error {
+			_, err := c.Generate(ctx, &GenerateRequest{Root: filepath.Dir(root)})
+			return err
+		}, codes.PermissionDenied},
+		{"link roots outside namespace", acme, func(c GolinksClient) error {
+			_, err := c.Verify(ctx, &VerifyRequest{Root: root, Link: escapingLink})
+			return err
+		}, codes.PermissionDenied},
+		{"root linked outside namespace", acme, func(c GolinksClient) error {
+			_, err := c.Generate(ctx, &GenerateRequest{Root: filepath.Join(root, "escape")})
+			return err
+		}, codes.PermissionDenied},
+		{"link following symlinks", acme, func(c GolinksClient) error {
+			_, err := c.Verify(ctx, &VerifyRequest{Root: root, Link: followingLink})
+			return err
+		}, codes.PermissionDenied},
+		{"no namespace", dial(Credentials{}), func(c GolinksClient) error {
+			_, err := c.GetBlock(ctx, &GetBlockRequest{Lookup: &GetBlockRequest_Index{Index: 0}})
+			return err
+		}, codes.InvalidArgument},
+		{"unknown namespace", dial(Credentials{Namespace: "other"}), func(c GolinksClient) error {
+			_, err := c.GetBlock(ctx, &GetBlockRequest{Lookup: &GetBlockRequest_Index{Index: 0}})
+			return err
+		}, codes.NotFound},
+		{"wrong token", dial(Credentials{Namespace: "acme", Token: "limited-token"}), func(c GolinksClient) error {
+			_, err := c.GetBlock(ctx, &GetBlockRequest{Lookup: &GetBlockRequest_Index{Index: 0}})
+			return err
+		}, codes.Unauthenticated},
+		{"reader appends", dial(Credentials{Namespace: "acme", Token: "acme-reader"}), func(c GolinksClient) error {
+			_, err := c.AppendBlock(ctx, &AppendBlockRequest{Link: generated.Link})
+			return err
+		}, codes.PermissionDenied},
+		{"reader verifies", dial(Credentials{Namespace: "acme", Token: "acme-reader"}), func(c GolinksClient) error {
+			_, err := c.Verify(ctx, &VerifyRequest{Root: root, Link: generated.Link})
+			return err
+		}, codes.PermissionDenied},
+		{"reader gets blocks", dial(Credentials{Namespace: "acme", Token: "acme-reader"}), func(c GolinksClient) error {
+			_, err := c.GetBlock(ctx, &GetBlockRequest{Lookup: &GetBlockRequest_Index{Index: 0}})
+			return err
+		}, codes.OK},
+		{"link size quota", dial(Credentials{Namespace: "limited", Token: "limited-token"}), func(c GolinksClient) error {
+			_, err := c.GetProof(ctx, &GetProofRequest{Link: generated.Link, Path: "a"})
+			return err
+		}, codes.ResourceExhausted},
+		{"request quota", dial(Credentials{Namespace: "limited", Token: "limited-token"}), func(c GolinksClient) error {
+			_, err := c.GetBlock(ctx, &GetBlockRequest{Lookup: &GetBlockRequest_Index{Index: 0}})
+			return err
+		}, codes.ResourceExhausted},
+	}
+	for _, test := range tests {
+		if err := test.call(test.client); status.Code(err) != test.code {
+			t.Errorf("%s: expected %v, got %v", test.name, test.code, err)
+		}
+	}
+
+	//Namespaces hold separate chains
+	if s.namespaces["acme"].Chain().Length() != 2 || s.namespaces["limited"].Chain().Length() != 1 {
+		t.Error("expected only the acme chain to grow")
+	}
+
+	//Appends are audited under the caller's principal
+	entries, err := auditLog.Entries(audit.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Target != "acme" || !strings.HasPrefix(entries[0].Actor, "acme@") {
+		t.Errorf("expected one append by acme, got %+v", entries)
+	}
+}
@@ -0,0 +1,63 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+
+	"github.com/govice/golinks/block"
+	"github.com/govice/golinks/blockchain"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// BlockSource fetches chain blocks from a Golinks service, such as for a
+// light client following the service's chain
+type BlockSource struct {
+	ctx    context.Context
+	client GolinksClient
+}
+
+// NewBlockSource returns a source fetching blocks through client with ctx
+func NewBlockSource(ctx context.Context, client GolinksClient) *BlockSource {
+	return &BlockSource{ctx: ctx, client: client}
+}
+
+// BlockAt returns the block at index, or blockchain.ErrBlockNotFound past the
+// chain head
+func (s *BlockSource) BlockAt(index int) (*block.Block, error) {
+	reply, err := s.client.GetBlock(s.ctx, &GetBlockRequest{Lookup: &GetBlockRequest_Index{Index: int64(index)}})
+	if status.Code(err) == codes.NotFound {
+		return nil, blockchain.ErrBlockNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return reply.Block(), nil
+}
+
+// Block converts a block reply back into a chain block
+func (b *Block) Block() *block.Block {
+	return &block.Block{
+		Index:      int(b.Index),
+		Timestamp:  b.Timestamp,
+		Data:       b.Data,
+		ParentHash: b.ParentHash,
+		RootHash:   b.RootHash,
+		Nonce:      b.Nonce,
+		BlockHash:  b.BlockHash,
+	}
+}
@@ -0,0 +1,195 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package sigstore
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultFulcio is the address of the public Sigstore certificate authority
+const DefaultFulcio = "https://fulcio.sigstore.dev"
+
+// Fulcio requests short-lived code signing certificates binding a key to an
+// OIDC identity
+type Fulcio struct {
+	ca         *url.URL
+	httpClient *http.Client
+}
+
+// NewFulcio returns a client for the certificate authority at address, such
+// as DefaultFulcio
+func NewFulcio(address string) (*Fulcio, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, errors.Wrap(err, "sigstore: invalid Fulcio address")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, errors.New("sigstore: Fulcio address must be an http or https URL")
+	}
+	return &Fulcio{ca: u, httpClient: http.DefaultClient}, nil
+}
+
+// SetHTTPClient sets the HTTP client used for requests
+func (f *Fulcio) SetHTTPClient(client *http.Client) {
+	f.httpClient = client
+}
+
+type certificateChain struct {
+	Certificates []string `json:"certificates"`
+}
+
+// Certificate requests a certificate for signer's public key, proving the
+// identity with the OIDC identity token. The PEM chain is returned leaf
+// first.
+func (f *Fulcio) Certificate(ctx context.Context, identityToken string, signer crypto.Signer) ([]byte, error) {
+	subject, err := TokenSubject(identityToken)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return nil, errors.Wrap(err, "sigstore: failed to encode public key")
+	}
+	digest := sha256.Sum256([]byte(subject))
+	proof, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return nil, errors.Wrap(err, "sigstore: failed to sign proof of possession")
+	}
+
+	var request struct {
+		Credentials struct {
+			OIDCIdentityToken string `json:"oidcIdentityToken"`
+		} `json:"credentials"`
+		PublicKeyRequest struct {
+			PublicKey struct {
+				Algorithm string `json:"algorithm"`
+				Content   string `json:"content"`
+			} `json:"publicKey"`
+			ProofOfPossession []byte `json:"proofOfPossession"`
+		} `json:"publicKeyRequest"`
+	}
+	request.Credentials.OIDCIdentityToken = identityToken
+	request.PublicKeyRequest.PublicKey.Algorithm = "ECDSA"
+	request.PublicKeyRequest.PublicKey.Content = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey}))
+	request.PublicKeyRequest.ProofOfPossession = proof
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, errors.Wrap(err, "sigstore: failed to encode certificate request")
+	}
+
+	var response struct {
+		Embedded *struct {
+			Chain certificateChain `json:"chain"`
+		} `json:"signedCertificateEmbeddedSct"`
+		Detached *struct {
+			Chain certificateChain `json:"chain"`
+		} `json:"signedCertificateDetachedSct"`
+	}
+	if err := f.do(ctx, http.MethodPost, "api/v2/signingCert", bytes.NewReader(body), &response); err != nil {
+		return nil, err
+	}
+	var chain certificateChain
+	switch {
+	case response.Embedded != nil:
+		chain = response.Embedded.Chain
+	case response.Detached != nil:
+		chain = response.Detached.Chain
+	}
+	if len(chain.Certificates) == 0 {
+		return nil, errors.New("sigstore: Fulcio returned no certificates")
+	}
+	var pemChain []byte
+	for _, certificate := range chain.Certificates {
+		pemChain = append(pemChain, strings.TrimSpace(certificate)+"\n"...)
+	}
+	return pemChain, nil
+}
+
+// TrustBundle fetches the certificate authority's chains. The last
+// certificate of each chain is a root and the others are intermediates.
+func (f *Fulcio) TrustBundle(ctx context.Context) (roots, intermediates *x509.CertPool, err error) {
+	var response struct {
+		Chains []certificateChain `json:"chains"`
+	}
+	if err := f.do(ctx, http.MethodGet, "api/v2/trustBundle", nil, &response); err != nil {
+		return nil, nil, err
+	}
+	roots, intermediates = x509.NewCertPool(), x509.NewCertPool()
+	for _, chain := range response.Chains {
+		for i, encoded := range chain.Certificates {
+			certificates, err := ParseCertificates([]byte(encoded))
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, certificate := range certificates {
+				if i == len(chain.Certificates)-1 {
+					roots.AddCert(certificate)
+				} else {
+					intermediates.AddCert(certificate)
+				}
+			}
+		}
+	}
+	return roots, intermediates, nil
+}
+
+// do calls the Fulcio API and decodes its JSON response into v
+func (f *Fulcio) do(ctx context.Context, method, path string, body io.Reader, v interface{}) error {
+	u := *f.ca
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + path
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return errors.Wrap(err, "sigstore: failed to create request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := f.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "sigstore: request failed")
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return errors.Wrap(err, "sigstore: failed to read response")
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		var apiErr struct{ Message string }
+		if json.Unmarshal(data, &apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(data))
+		}
+		return errors.Errorf("sigstore: Fulcio returned status %d: %s", resp.StatusCode, apiErr.Message)
+	}
+	return errors.Wrap(json.Unmarshal(data, v), "sigstore: failed to decode response")
+}
@@ -0,0 +1,240 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+// Package sigstore signs link root hashes without long-lived keys. An
+// ephemeral key is certified by Fulcio for an OIDC identity, signs the root
+// hash and the signature is recorded in the Rekor transparency log, whose
+// inclusion proof shows the signature was made while the certificate was
+// valid.
+package sigstore
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"time"
+
+	"github.com/govice/golinks/tlog"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrBadSignature is returned when the signature doesn't verify with the
+	// certified key
+	ErrBadSignature = errors.New("sigstore: invalid signature")
+	// ErrEntryMismatch is returned when the log entry records a different
+	// signature or certificate than the bundle
+	ErrEntryMismatch = errors.New("sigstore: log entry doesn't record the signature")
+	// ErrIdentity is returned when the certificate names another identity or
+	// issuer than expected
+	ErrIdentity = errors.New("sigstore: unexpected certificate identity")
+)
+
+// Certificate extensions naming the OIDC issuer of the identity
+var (
+	oidIssuer   = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+	oidIssuerV2 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}
+)
+
+// Bundle is a keyless signature over a root hash: the PEM certificate chain
+// of the ephemeral key, leaf first, its signature over the SHA256 digest of
+// the root hash and the log entry recording them
+type Bundle struct {
+	Certificate []byte      `json:"certificate"`
+	Signature   []byte      `json:"signature"`
+	Entry       *tlog.Entry `json:"entry"`
+}
+
+// Sign signs hash with an ephemeral key certified by fulcio for the identity
+// token and records the signature in rekor
+func Sign(ctx context.Context, hash []byte, identityToken string, fulcio *Fulcio, rekor *tlog.Client) (*Bundle, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "sigstore: failed to generate key")
+	}
+	certificate, err := fulcio.Certificate(ctx, identityToken, key)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(hash)
+	signature, err := key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return nil, errors.Wrap(err, "sigstore: failed to sign hash")
+	}
+	leaf, err := leafPEM(certificate)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := rekor.AppendSignature(ctx, hash, signature, leaf)
+	if err != nil {
+		return nil, err
+	}
+	return &Bundle{Certificate: certificate, Signature: signature, Entry: entry}, nil
+}
+
+// Records reports whether the bundle's log entry records hash
+func (b *Bundle) Records(hash []byte) bool {
+	return b.Entry != nil && b.Entry.Records(hash)
+}
+
+// Verifier checks bundles. Identity and Issuer are only checked when set.
+type Verifier struct {
+	// Roots and Intermediates verify certificate chains. Intermediates in a
+	// bundle's chain are also used.
+	Roots         *x509.CertPool
+	Intermediates *x509.CertPool
+	// LogKey is the public key of the transparency log, verifying the log
+	// entry's signed timestamp. It is required, the time a certificate is
+	// checked at is only trusted once the log signed it.
+	LogKey crypto.PublicKey
+	// Identity is the email or URI the certificate must be issued to
+	Identity string
+	// Issuer is the OIDC issuer that must have asserted the identity
+	Issuer string
+}
+
+// Verify checks that the bundle signs hash with a certificate chaining to the
+// roots, valid when the log integrated the entry, and that the log entry
+// records the signature and is included in the log. The certificate is
+// returned.
+func (v *Verifier) Verify(hash []byte, b *Bundle) (*x509.Certificate, error) {
+	if v.LogKey == nil {
+		return nil, tlog.ErrNoLogKey
+	}
+	if b.Entry == nil {
+		return nil, errors.New("sigstore: bundle has no log entry")
+	}
+	certificates, err := ParseCertificates(b.Certificate)
+	if err != nil {
+		return nil, err
+	}
+	leaf := certificates[0]
+	intermediates := x509.NewCertPool()
+	if v.Intermediates != nil {
+		intermediates = v.Intermediates.Clone()
+	}
+	for _, certificate := range certificates[1:] {
+		intermediates.AddCert(certificate)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         v.Roots,
+		Intermediates: intermediates,
+		CurrentTime:   time.Unix(b.Entry.IntegratedTime, 0),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}); err != nil {
+		return nil, errors.Wrap(err, "sigstore: untrusted certificate")
+	}
+
+	key, ok := leaf.PublicKey.(*ecdsa.PublicKey)
+	digest := sha256.Sum256(hash)
+	if !ok || !ecdsa.VerifyASN1(key, digest[:], b.Signature) {
+		return nil, ErrBadSignature
+	}
+
+	if err := b.Entry.Verify(hash, v.LogKey); err != nil {
+		return nil, err
+	}
+	signature, verifier, err := b.Entry.Signature()
+	if err != nil {
+		return nil, err
+	}
+	recorded, err := ParseCertificates(verifier)
+	if err != nil || !bytes.Equal(signature, b.Signature) || !recorded[0].Equal(leaf) {
+		return nil, ErrEntryMismatch
+	}
+
+	if v.Identity != "" && !hasIdentity(leaf, v.Identity) {
+		return nil, errors.Wrap(ErrIdentity, v.Identity)
+	}
+	if v.Issuer != "" && Issuer(leaf) != v.Issuer {
+		return nil, errors.Wrap(ErrIdentity, "issuer "+v.Issuer)
+	}
+	return leaf, nil
+}
+
+// Identities returns the emails and URIs a certificate is issued to
+func Identities(c *x509.Certificate) []string {
+	identities := append([]string{}, c.EmailAddresses...)
+	for _, u := range c.URIs {
+		identities = append(identities, u.String())
+	}
+	return identities
+}
+
+func hasIdentity(c *x509.Certificate, identity string) bool {
+	for _, i := range Identities(c) {
+		if i == identity {
+			return true
+		}
+	}
+	return false
+}
+
+// Issuer returns the OIDC issuer recorded in a Fulcio certificate
+func Issuer(c *x509.Certificate) string {
+	for _, ext := range c.Extensions {
+		switch {
+		case ext.Id.Equal(oidIssuerV2):
+			var issuer string
+			if _, err := asn1.Unmarshal(ext.Value, &issuer); err == nil {
+				return issuer
+			}
+		case ext.Id.Equal(oidIssuer):
+			return string(ext.Value)
+		}
+	}
+	return ""
+}
+
+// ParseCertificates decodes a PEM certificate chain
+func ParseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certificates []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "sigstore: failed to parse certificate")
+		}
+		certificates = append(certificates, certificate)
+	}
+	if len(certificates) == 0 {
+		return nil, errors.New("sigstore: no certificates found")
+	}
+	return certificates, nil
+}
+
+// leafPEM returns the first certificate of a PEM chain
+func leafPEM(chain []byte) ([]byte, error) {
+	certificates, err := ParseCertificates(chain)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificates[0].Raw}), nil
+}
@@ -0,0 +1,299 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package sigstore
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/govice/golinks/tlog"
+	"github.com/pkg/errors"
+)
+
+const testIssuer = "https://accounts.example.com"
+
+// testFulcio certifies keys for the email of any well-formed token
+type testFulcio struct {
+	t        *testing.T
+	key      *ecdsa.PrivateKey
+	root     *x509.Certificate
+	lifetime time.Duration
+}
+
+func newTestFulcio(t *testing.T) *testFulcio {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test fulcio"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testFulcio{t: t, key: key, root: root, lifetime: 10 * time.Minute}
+}
+
+func (f *testFulcio) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Credentials struct {
+			OIDCIdentityToken string `json:"oidcIdentityToken"`
+		} `json:"credentials"`
+		PublicKeyRequest struct {
+			PublicKey struct {
+				Content string `json:"content"`
+			} `json:"publicKey"`
+			ProofOfPossession []byte `json:"proofOfPossession"`
+		} `json:"publicKeyRequest"`
+	}
+	if r.URL.Path != "/api/v2/signingCert" || json.NewDecoder(r.Body).Decode(&request) != nil {
+		http.Error(w, `{"message":"bad request"}`, http.StatusBadRequest)
+		return
+	}
+	subject, err := TokenSubject(request.Credentials.OIDCIdentityToken)
+	if err != nil {
+		http.Error(w, `{"message":"invalid token"}`, http.StatusUnauthorized)
+		return
+	}
+	block, _ := pem.Decode([]byte(request.PublicKeyRequest.PublicKey.Content))
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		f.t.Error(err)
+		return
+	}
+	digest := sha256.Sum256([]byte(subject))
+	if !ecdsa.VerifyASN1(key.(*ecdsa.PublicKey), digest[:], request.PublicKeyRequest.ProofOfPossession) {
+		http.Error(w, `{"message":"invalid proof of possession"}`, http.StatusBadRequest)
+		return
+	}
+
+	issuer, _ := asn1.Marshal(testIssuer)
+	template := &x509.Certificate{
+		SerialNumber:    big.NewInt(time.Now().UnixNano()),
+		NotBefore:       time.Now().Add(-time.Minute),
+		NotAfter:        time.Now().Add(f.lifetime),
+		EmailAddresses:  []string{subject},
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		ExtraExtensions: []pkix.Extension{{Id: oidIssuerV2, Value: issuer}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, f.root, key, f.key)
+	if err != nil {
+		f.t.Error(err)
+		return
+	}
+	var response struct {
+		Embedded struct {
+			Chain certificateChain `json:"chain"`
+		} `json:"signedCertificateEmbeddedSct"`
+	}
+	response.Embedded.Chain.Certificates = []string{
+		string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: f.root.Raw})),
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// testRekor logs every entry as the only leaf of its own tree, signing its
+// entry timestamps with key
+type testRekor struct {
+	key *ecdsa.PrivateKey
+}
+
+func (l *testRekor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	var entry struct {
+		Body           string `json:"body"`
+		IntegratedTime int64  `json:"integratedTime"`
+		LogID          string `json:"logID"`
+		LogIndex       int64  `json:"logIndex"`
+		Verification   struct {
+			SignedEntryTimestamp []byte `json:"signedEntryTimestamp"`
+			InclusionProof       struct {
+				Hashes   []string `json:"hashes"`
+				LogIndex int64    `json:"logIndex"`
+				RootHash string   `json:"rootHash"`
+				TreeSize int64    `json:"treeSize"`
+			} `json:"inclusionProof"`
+		} `json:"verification"`
+	}
+	entry.Body = base64.StdEncoding.EncodeToString(body)
+	entry.IntegratedTime = time.Now().Unix()
+	entry.LogID = "c0ffee"
+	entry.Verification.InclusionProof.RootHash = hex.EncodeToString(tlog.LeafHash(body))
+	entry.Verification.InclusionProof.TreeSize = 1
+	entry.Verification.InclusionProof.Hashes = []string{}
+	set, _ := json.Marshal(struct {
+		Body           string `json:"body"`
+		IntegratedTime int64  `json:"integratedTime"`
+		LogID          string `json:"logID"`
+		LogIndex       int64  `json:"logIndex"`
+	}{entry.Body, entry.IntegratedTime, entry.LogID, entry.LogIndex})
+	digest := sha256.Sum256(set)
+	entry.Verification.SignedEntryTimestamp, _ = ecdsa.SignASN1(rand.Reader, l.key, digest[:])
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"0": entry})
+}
+
+func testToken(claims string) string {
+	encode := base64.RawURLEncoding.EncodeToString
+	return encode([]byte(`{"alg":"none"}`)) + "." + encode([]byte(claims)) + ".sig"
+}
+
+func TestTokenSubject(t *testing.T) {
+	tests := []struct {
+		token   string
+		subject string
+	}{
+		{testToken(`{"sub":"123","email":"dev@example.com"}`), "dev@example.com"},
+		{testToken(`{"sub":"repo:govice/golinks:ref:refs/heads/main"}`), "repo:govice/golinks:ref:refs/heads/main"},
+		{testToken(`{}`), ""},
+		{"not a token", ""},
+	}
+	for _, test := range tests {
+		subject, err := TokenSubject(test.token)
+		if subject != test.subject || (err == nil) != (test.subject != "") {
+			t.Errorf("%s: expected %q, got %q %v", test.token, test.subject, subject, err)
+		}
+	}
+}
+
+func TestSign(t *testing.T) {
+	ca := newTestFulcio(t)
+	fulcioServer := httptest.NewServer(ca)
+	defer fulcioServer.Close()
+	logKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rekorServer := httptest.NewServer(&testRekor{logKey})
+	defer rekorServer.Close()
+	fulcio, err := NewFulcio(fulcioServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rekor, err := tlog.NewClient(rekorServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := []byte("root hash")
+	ctx := context.Background()
+	b, err := Sign(ctx, hash, testToken(`{"email":"dev@example.com"}`), fulcio, rekor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !b.Records(hash) || b.Records([]byte("other")) {
+		t.Error("expected the bundle to record only its hash")
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.root)
+	v := &Verifier{Roots: roots, LogKey: &logKey.PublicKey, Identity: "dev@example.com", Issuer: testIssuer}
+	certificate, err := v.Verify(hash, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Issuer(certificate) != testIssuer || fmt.Sprint(Identities(certificate)) != "[dev@example.com]" {
+		t.Errorf("unexpected certificate identity %v from %q", Identities(certificate), Issuer(certificate))
+	}
+
+	other := newTestFulcio(t)
+	otherRoots := x509.NewCertPool()
+	otherRoots.AddCert(other.root)
+	tampered := *b
+	tampered.Signature = append([]byte{}, b.Signature...)
+	tampered.Signature[len(tampered.Signature)-1] ^= 0xff
+	swapped, err := Sign(ctx, hash, testToken(`{"email":"dev@example.com"}`), fulcio, rekor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	swapped.Entry = b.Entry
+
+	tests := []struct {
+		name     string
+		verifier *Verifier
+		bundle   *Bundle
+		hash     []byte
+		err      error
+	}{
+		{"other identity", &Verifier{Roots: roots, LogKey: &logKey.PublicKey, Identity: "other@example.com"}, b, hash, ErrIdentity},
+		{"other issuer", &Verifier{Roots: roots, LogKey: &logKey.PublicKey, Issuer: "https://other.example.com"}, b, hash, ErrIdentity},
+		{"other hash", &Verifier{Roots: roots, LogKey: &logKey.PublicKey}, b, []byte("other"), ErrBadSignature},
+		{"tampered signature", &Verifier{Roots: roots, LogKey: &logKey.PublicKey}, &tampered, hash, ErrBadSignature},
+		{"swapped entry", &Verifier{Roots: roots, LogKey: &logKey.PublicKey}, swapped, hash, ErrEntryMismatch},
+	}
+	for _, test := range tests {
+		if _, err := test.verifier.Verify(test.hash, test.bundle); errors.Cause(err) != test.err {
+			t.Errorf("%s: expected %v, got %v", test.name, test.err, err)
+		}
+	}
+	if _, err := (&Verifier{Roots: roots}).Verify(hash, b); err != tlog.ErrNoLogKey {
+		t.Error("expected verification without the log key to be refused, got", err)
+	}
+	if _, err := (&Verifier{Roots: otherRoots, LogKey: &logKey.PublicKey}).Verify(hash, b); err == nil {
+		t.Error("expected a certificate from another authority to be rejected")
+	}
+
+	//Certificates must be valid when the log integrated the signature
+	ca.lifetime = -30 * time.Second
+	expired, err := Sign(ctx, hash, testToken(`{"email":"dev@example.com"}`), fulcio, rekor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Verify(hash, expired); err == nil {
+		t.Error("expected a signature logged after the certificate expired to be rejected")
+	}
+
+	//Backdating the entry into the certificate's lifetime breaks the log's signature
+	backdated := *expired
+	entry := *expired.Entry
+	entry.IntegratedTime -= 60
+	backdated.Entry = &entry
+	if _, err := v.Verify(hash, &backdated); errors.Cause(err) != tlog.ErrBadTimestamp {
+		t.Error("expected a backdated entry to be rejected, got", err)
+	}
+}
@@ -0,0 +1,111 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package sigstore
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Audience is the OIDC audience of identity tokens exchanged with Fulcio
+const Audience = "sigstore"
+
+// ErrNoIdentityToken is returned when the environment holds no identity token
+var ErrNoIdentityToken = errors.New("sigstore: no identity token, set $SIGSTORE_ID_TOKEN")
+
+// TokenSubject returns the identity an OIDC token asserts, its email claim
+// or else its subject, which Fulcio expects a proof of possession over. The
+// token's signature is checked by Fulcio, not here.
+func TokenSubject(identityToken string) (string, error) {
+	parts := strings.Split(identityToken, ".")
+	if len(parts) != 3 {
+		return "", errors.New("sigstore: identity token is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return "", errors.Wrap(err, "sigstore: failed to decode identity token")
+	}
+	var claims struct {
+		Email   string `json:"email"`
+		Subject string `json:"sub"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", errors.Wrap(err, "sigstore: failed to decode identity token")
+	}
+	if claims.Email != "" {
+		return claims.Email, nil
+	}
+	if claims.Subject == "" {
+		return "", errors.New("sigstore: identity token has no subject")
+	}
+	return claims.Subject, nil
+}
+
+// IdentityToken returns the identity token in $SIGSTORE_ID_TOKEN, or
+// requests one for the sigstore audience from GitHub Actions when the
+// workflow has the id-token permission
+func IdentityToken(ctx context.Context) (string, error) {
+	if token := os.Getenv("SIGSTORE_ID_TOKEN"); token != "" {
+		return token, nil
+	}
+	requestURL, requestToken := os.Getenv("ACTIONS_ID_TOKEN_REQUEST_URL"), os.Getenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN")
+	if requestURL == "" || requestToken == "" {
+		return "", ErrNoIdentityToken
+	}
+
+	u, err := url.Parse(requestURL)
+	if err != nil {
+		return "", errors.Wrap(err, "sigstore: invalid GitHub Actions token URL")
+	}
+	query := u.Query()
+	query.Set("audience", Audience)
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", errors.Wrap(err, "sigstore: failed to create request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+requestToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "sigstore: GitHub Actions token request failed")
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", errors.Wrap(err, "sigstore: failed to read GitHub Actions token")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("sigstore: GitHub Actions returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	var token struct {
+		Value string `json:"value"`
+	}
+	if err := json.Unmarshal(data, &token); err != nil || token.Value == "" {
+		return "", errors.New("sigstore: GitHub Actions returned no token")
+	}
+	return token.Value, nil
+}
@@ -0,0 +1,201 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+// Package snapshot stores successive blockmaps of a root so earlier states
+// can be listed, loaded and diffed. Each snapshot is a link file named by
+// the UTC time it was taken, and old snapshots are pruned by a Policy.
+package snapshot
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/govice/golinks/blockmap"
+	"github.com/govice/golinks/codec"
+	"github.com/pkg/errors"
+)
+
+// timeFormat names snapshot files so they sort chronologically
+const timeFormat = "20060102T150405.000000000Z"
+
+var (
+	// ErrNotFound is returned when loading a snapshot that isn't stored
+	ErrNotFound = errors.New("snapshot: not found")
+	// ErrNoSnapshot is returned when no snapshot was taken at or before a time
+	ErrNoSnapshot = errors.New("snapshot: no snapshot at time")
+)
+
+// Snapshot describes a stored blockmap
+type Snapshot struct {
+	// ID names the snapshot within its store
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+	Path string    `json:"path"`
+}
+
+// Policy selects the snapshots removed by Prune. The newest snapshot is
+// always kept.
+type Policy struct {
+	// KeepLast keeps only the n newest snapshots, zero keeps any number
+	KeepLast int
+	// MaxAge removes snapshots older than the duration, zero keeps any age
+	MaxAge time.Duration
+}
+
+// Store holds the snapshots of one root in a directory
+type Store struct {
+	dir   string
+	codec codec.Codec
+	now   func() time.Time
+}
+
+// Open returns the store in dir, creating the directory if needed
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "snapshot: failed to create store")
+	}
+	return &Store{dir: dir, codec: codec.JSON, now: time.Now}, nil
+}
+
+// Dir returns the directory holding the snapshots
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// SetCodec sets the format new snapshots are written in. Snapshots in any
+// format can be loaded.
+func (s *Store) SetCodec(c codec.Codec) {
+	s.codec = c
+}
+
+// Save stores b as a new snapshot taken now
+func (s *Store) Save(b *blockmap.BlockMap) (*Snapshot, error) {
+	t := s.now().UTC()
+	id := t.Format(timeFormat)
+	if err := b.SaveCodec(s.dir, id, s.codec); err != nil {
+		return nil, errors.Wrap(err, "snapshot: failed to save")
+	}
+	return &Snapshot{ID: id, Time: t, Path: s.path(id)}, nil
+}
+
+// List returns every stored snapshot, oldest first
+func (s *Store) List() ([]Snapshot, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "snapshot: failed to list store")
+	}
+
+	var snapshots []Snapshot
+	for _, file := range files {
+		id := strings.TrimSuffix(file.Name(), blockmap.OutputName)
+		if file.IsDir() || id == file.Name() {
+			continue
+		}
+		t, err := time.Parse(timeFormat, id)
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, Snapshot{ID: id, Time: t, Path: s.path(id)})
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].Time.Before(snapshots[j].Time)
+	})
+	return snapshots, nil
+}
+
+// Load returns the blockmap of the snapshot with id
+func (s *Store) Load(id string) (*blockmap.BlockMap, error) {
+	//IDs are times so they can't name files outside the store
+	if _, err := time.Parse(timeFormat, id); err != nil {
+		return nil, errors.Wrap(ErrNotFound, id)
+	}
+	file, err := os.Open(s.path(id))
+	if os.IsNotExist(err) {
+		return nil, errors.Wrap(ErrNotFound, id)
+	} else if err != nil {
+		return nil, errors.Wrap(err, "snapshot: failed to open "+id)
+	}
+	defer file.Close()
+
+	b := blockmap.New("")
+	if _, err := b.ReadFrom(file); err != nil {
+		return nil, errors.Wrap(err, "snapshot: failed to load "+id)
+	}
+	return b, nil
+}
+
+// At returns the latest snapshot taken at or before t and its blockmap
+func (s *Store) At(t time.Time) (*Snapshot, *blockmap.BlockMap, error) {
+	snapshots, err := s.List()
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		if !snapshots[i].Time.After(t) {
+			b, err := s.Load(snapshots[i].ID)
+			if err != nil {
+				return nil, nil, err
+			}
+			return &snapshots[i], b, nil
+		}
+	}
+	return nil, nil, errors.Wrap(ErrNoSnapshot, t.Format(time.RFC3339))
+}
+
+// Diff reports the paths added, removed and modified between the snapshots from and to
+func (s *Store) Diff(from, to string) (*blockmap.DiffResult, error) {
+	a, err := s.Load(from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := s.Load(to)
+	if err != nil {
+		return nil, err
+	}
+	return blockmap.Diff(a, b), nil
+}
+
+// Prune removes the snapshots selected by policy and returns them
+func (s *Store) Prune(policy Policy) ([]Snapshot, error) {
+	snapshots, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []Snapshot
+	cutoff := s.now().Add(-policy.MaxAge)
+	for i, snapshot := range snapshots {
+		newer := len(snapshots) - 1 - i
+		if newer == 0 {
+			break
+		}
+		if (policy.KeepLast > 0 && newer >= policy.KeepLast) || (policy.MaxAge > 0 && snapshot.Time.Before(cutoff)) {
+			if err := os.Remove(snapshot.Path); err != nil && !os.IsNotExist(err) {
+				return removed, errors.Wrap(err, "snapshot: failed to remove "+snapshot.ID)
+			}
+			removed = append(removed, snapshot)
+		}
+	}
+	return removed, nil
+}
+
+// path returns the link file of the snapshot with id
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id+blockmap.OutputName)
+}
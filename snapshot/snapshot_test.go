@@ -0,0 +1,125 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+package snapshot
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/govice/golinks/blockmap"
+	"github.com/govice/golinks/codec"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	s.now = func() time.Time { return now }
+
+	root, err := ioutil.TempDir("", "snapshotroot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	var saved []*Snapshot
+	for i, files := range []map[string]string{
+		{"a": "1"},
+		{"a": "2", "b": "1"},
+		{"b": "1"},
+	} {
+		for _, name := range []string{"a", "b"} {
+			os.Remove(filepath.Join(root, name))
+			if content, ok := files[name]; ok {
+				if err := ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		b := blockmap.New(root)
+		if err := b.Generate(); err != nil {
+			t.Fatal(err)
+		}
+		if i == 1 {
+			s.SetCodec(codec.CBOR)
+		}
+		snapshot, err := s.Save(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		saved = append(saved, snapshot)
+		now = now.Add(24 * time.Hour)
+	}
+
+	snapshots, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 3 || snapshots[0].ID != saved[0].ID || snapshots[2].ID != saved[2].ID {
+		t.Fatalf("unexpected snapshots %+v", snapshots)
+	}
+
+	snapshot, b, err := s.At(start.Add(36 * time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.ID != saved[1].ID || len(b.Archive) != 2 {
+		t.Errorf("expected the second snapshot, got %+v", snapshot)
+	}
+	if _, _, err := s.At(start.Add(-time.Hour)); !errors.Is(err, ErrNoSnapshot) {
+		t.Errorf("expected ErrNoSnapshot, got %v", err)
+	}
+	if _, err := s.Load("../" + saved[0].ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	diff, err := s.Diff(saved[0].ID, saved[2].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(diff.Added, []string{"b"}) || !reflect.DeepEqual(diff.Removed, []string{"a"}) {
+		t.Errorf("unexpected diff %+v", diff)
+	}
+
+	//Now is three days after the oldest snapshot
+	removed, err := s.Prune(Policy{MaxAge: 60 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0].ID != saved[0].ID {
+		t.Errorf("expected the oldest snapshot to be pruned, got %+v", removed)
+	}
+	removed, err = s.Prune(Policy{KeepLast: 1, MaxAge: time.Nanosecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshots, _ := s.List(); len(removed) != 1 || len(snapshots) != 1 || snapshots[0].ID != saved[2].ID {
+		t.Errorf("expected only the newest snapshot to be kept, got %+v", snapshots)
+	}
+}
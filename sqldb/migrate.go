@@ -0,0 +1,92 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package sqldb
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+// migrationsTable records the schema versions applied to a database
+const migrationsTable = "golinks_migrations"
+
+// Migration is a versioned schema change. Statements may use {blob} for the
+// dialect's binary column type.
+type Migration struct {
+	Version    int
+	Statements []string
+}
+
+// Migrate applies the migrations of component not yet applied to db in
+// version order, each in its own transaction
+func Migrate(db *sql.DB, d *Dialect, component string, migrations []Migration) error {
+	_, err := db.Exec("CREATE TABLE IF NOT EXISTS " + migrationsTable + ` (
+		component TEXT NOT NULL,
+		version INTEGER NOT NULL,
+		PRIMARY KEY (component, version))`)
+	if err != nil {
+		return errors.Wrap(err, "sqldb: failed to create migrations table")
+	}
+
+	applied := make(map[int]bool)
+	rows, err := db.Query(d.Rebind("SELECT version FROM "+migrationsTable+" WHERE component = ?"), component)
+	if err != nil {
+		return errors.Wrap(err, "sqldb: failed to read migrations")
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return errors.Wrap(err, "sqldb: failed to read migrations")
+		}
+		applied[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return errors.Wrap(err, "sqldb: failed to read migrations")
+	}
+	rows.Close()
+
+	for _, m := range migrations {
+		if applied[m.Version] {
+			continue
+		}
+		if err := apply(db, d, component, m); err != nil {
+			return errors.Wrapf(err, "sqldb: failed to migrate %s to version %d", component, m.Version)
+		}
+	}
+	return nil
+}
+
+func apply(db *sql.DB, d *Dialect, component string, m Migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, statement := range m.Statements {
+		if _, err := tx.Exec(d.expand(statement)); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	_, err = tx.Exec(d.Rebind("INSERT INTO "+migrationsTable+" (component, version) VALUES (?, ?)"), component, m.Version)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,107 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+// Package sqldb adapts golinks storage to SQL databases through database/sql.
+// It describes the SQL dialects golinks supports and applies versioned schema
+// migrations, so chains and link indexes can live alongside existing
+// operational data in PostgreSQL or SQLite. Drivers are not imported here;
+// programs import the drivers they use.
+package sqldb
+
+import (
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrUnknownDialect is returned for a driver golinks has no dialect for
+var ErrUnknownDialect = errors.New("sqldb: unknown SQL dialect")
+
+// Dialect describes the differences between the SQL databases golinks stores
+// data in
+type Dialect struct {
+	Name string
+	// Blob is the column type of binary values
+	Blob string
+	// numbered is true if bind parameters are numbered, as in $1, rather than ?
+	numbered bool
+}
+
+var (
+	// Postgres is the dialect of PostgreSQL
+	Postgres = &Dialect{Name: "postgres", Blob: "BYTEA", numbered: true}
+	// SQLite is the dialect of SQLite
+	SQLite = &Dialect{Name: "sqlite3", Blob: "BLOB"}
+)
+
+// DialectFor returns the dialect of a database/sql driver name
+func DialectFor(driver string) (*Dialect, error) {
+	switch driver {
+	case "postgres", "pgx":
+		return Postgres, nil
+	case "sqlite3", "sqlite":
+		return SQLite, nil
+	}
+	return nil, errors.Wrap(ErrUnknownDialect, driver)
+}
+
+// Open opens the database described by spec, either a postgres:// URL or a
+// driver name and data source name separated by a colon such as
+// sqlite3:golinks.db. The driver must be registered with database/sql.
+func Open(spec string) (*sql.DB, *Dialect, error) {
+	driver, dsn := "postgres", spec
+	if !strings.HasPrefix(spec, "postgres://") && !strings.HasPrefix(spec, "postgresql://") {
+		i := strings.Index(spec, ":")
+		if i < 0 {
+			return nil, nil, errors.Errorf("sqldb: database %q is not of the form driver:dsn", spec)
+		}
+		driver, dsn = spec[:i], spec[i+1:]
+	}
+	dialect, err := DialectFor(driver)
+	if err != nil {
+		return nil, nil, err
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "sqldb: failed to open database")
+	}
+	return db, dialect, nil
+}
+
+// Rebind rewrites the ? bind parameters of query for the dialect
+func (d *Dialect) Rebind(query string) string {
+	if !d.numbered {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// expand replaces the {blob} column type in statement for the dialect
+func (d *Dialect) expand(statement string) string {
+	return strings.Replace(statement, "{blob}", d.Blob, -1)
+}
@@ -0,0 +1,78 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package sqldb
+
+import (
+	"errors"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestRebind(t *testing.T) {
+	query := "SELECT a FROM t WHERE b = ? AND c = ?"
+	if got := SQLite.Rebind(query); got != query {
+		t.Error("unexpected SQLite query", got)
+	}
+	if got := Postgres.Rebind(query); got != "SELECT a FROM t WHERE b = $1 AND c = $2" {
+		t.Error("unexpected PostgreSQL query", got)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	if _, _, err := Open("mysql:dsn"); !errors.Is(err, ErrUnknownDialect) {
+		t.Error("expected unknown dialect, got", err)
+	}
+	if _, _, err := Open("golinks.db"); err == nil {
+		t.Error("expected error opening a database without a driver")
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	db, dialect, err := Open("sqlite3::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	migrations := []Migration{
+		{Version: 1, Statements: []string{"CREATE TABLE things (id INTEGER PRIMARY KEY, value {blob})"}},
+	}
+	if err := Migrate(db, dialect, "test", migrations); err != nil {
+		t.Fatal(err)
+	}
+	migrations = append(migrations, Migration{Version: 2, Statements: []string{"ALTER TABLE things ADD COLUMN name TEXT"}})
+	if err := Migrate(db, dialect, "test", migrations); err != nil {
+		t.Fatal("expected applied migrations to be skipped,", err)
+	}
+	if _, err := db.Exec("INSERT INTO things (id, value, name) VALUES (1, x'00', 'a')"); err != nil {
+		t.Error("expected migrated schema,", err)
+	}
+
+	//A failed migration is rolled back
+	migrations = append(migrations, Migration{Version: 3, Statements: []string{
+		"CREATE TABLE others (id INTEGER)",
+		"garbage",
+	}})
+	if err := Migrate(db, dialect, "test", migrations); err == nil {
+		t.Error("expected failed migration")
+	}
+	if _, err := db.Exec("SELECT id FROM others"); err == nil {
+		t.Error("expected failed migration to be rolled back")
+	}
+}
@@ -0,0 +1,420 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+// Package sync mirrors a source directory to a destination by comparing
+// their blockmaps. Only files whose content differs are written, reusing
+// unchanged regions of chunked files and moving renamed files within the
+// destination rather than copying them again.
+package sync
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/govice/golinks/blockmap"
+	"github.com/govice/golinks/logging"
+	"github.com/pkg/errors"
+)
+
+// Action is what was done to a destination path
+type Action string
+
+const (
+	// Create writes a file missing from the destination
+	Create Action = "create"
+	// Update rewrites a destination file with the source content
+	Update Action = "update"
+	// Rename moves a destination file holding the source content to its
+	// source path
+	Rename Action = "rename"
+	// Delete removes a destination file missing from the source
+	Delete Action = "delete"
+)
+
+// ErrChanged is returned when a written file doesn't match its source hash
+// because the source changed while mirroring
+var ErrChanged = errors.New("sync: source changed while mirroring")
+
+// ErrUnsafePath is returned when a path of the source, such as a key of an
+// untrusted link holding "../", would be mirrored outside the destination
+var ErrUnsafePath = errors.New("sync: path escapes the mirrored directory")
+
+// Op is a change made to the destination
+type Op struct {
+	Action Action `json:"action"`
+	Path   string `json:"path"`
+	// From is the destination file a renamed file was moved from
+	From string `json:"from,omitempty"`
+	// Transferred is the number of bytes copied from the source
+	Transferred int64 `json:"transferred"`
+	// Reused is the number of bytes copied within the destination
+	Reused int64 `json:"reused"`
+}
+
+// Result lists the changes made to the destination, or that would be made
+// in a dry run
+type Result struct {
+	Ops         []Op  `json:"ops"`
+	Transferred int64 `json:"transferred"`
+	Reused      int64 `json:"reused"`
+	DryRun      bool  `json:"dryRun"`
+}
+
+// Option configures a mirror
+type Option func(*config)
+
+type config struct {
+	dryRun    bool
+	delete    bool
+	source    *blockmap.BlockMap
+	blockmaps []blockmap.Option
+	logger    logging.Logger
+}
+
+// WithDryRun plans the changes without touching the destination
+func WithDryRun() Option {
+	return func(c *config) { c.dryRun = true }
+}
+
+// WithDelete removes destination files that aren't in the source
+func WithDelete() Option {
+	return func(c *config) { c.delete = true }
+}
+
+// WithSource mirrors the files described by b, such as a loaded link,
+// instead of generating a blockmap of the source
+func WithSource(b *blockmap.BlockMap) Option {
+	return func(c *config) { c.source = b }
+}
+
+// WithBlockMapOptions configures the blockmaps generated of the source and
+// destination. Chunking lets modified files reuse their unchanged regions.
+func WithBlockMapOptions(opts ...blockmap.Option) Option {
+	return func(c *config) { c.blockmaps = opts }
+}
+
+// WithLogger logs each change to logger
+func WithLogger(logger logging.Logger) Option {
+	return func(c *config) { c.logger = logger }
+}
+
+// Mirror makes the files under dst match the files under src. Files are
+// built next to their destination and moved into place once every file is
+// written and verified against its source hash, so reused regions are read
+// before anything is replaced. Directories are created as needed; only
+// regular files are mirrored.
+func Mirror(src, dst string, opts ...Option) (*Result, error) {
+	c := config{logger: logging.Discard}
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	source := c.source
+	if source == nil {
+		source = blockmap.New(src, c.blockmaps...)
+		if err := source.Generate(); err != nil {
+			return nil, err
+		}
+	}
+	if !c.dryRun {
+		if err := os.MkdirAll(dst, 0755); err != nil {
+			return nil, errors.Wrap(err, "sync: failed to create destination")
+		}
+	}
+	plan, err := source.PlanDeltaTo(dst)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &mirror{config: c, src: src, dst: dst, source: source, plan: plan, open: make(map[string]*os.File)}
+	defer m.close()
+	if err := m.checkPaths(); err != nil {
+		return nil, err
+	}
+	return m.apply()
+}
+
+// mirror applies a delta plan
+type mirror struct {
+	config
+	src, dst string
+	source   *blockmap.BlockMap
+	plan     *blockmap.DeltaPlan
+	open     map[string]*os.File
+	temps    []string
+}
+
+// pending is a file ready to be moved into place
+type pending struct {
+	op   Op
+	temp string
+}
+
+func (m *mirror) apply() (*Result, error) {
+	result := &Result{DryRun: m.dryRun}
+	deleted := make(map[string]bool)
+	if m.delete {
+		for _, path := range m.plan.Delete {
+			deleted[path] = true
+		}
+	}
+
+	//Build every file before changing the destination since reused
+	//regions refer to its current content
+	var moves []pending
+	for _, file := range m.plan.Files {
+		op := Op{Action: Action(file.Action), Path: file.Path}
+		for _, r := range file.Transfer {
+			op.Transferred += r.Size
+		}
+		for _, r := range file.Reuse {
+			op.Reused += r.Size
+		}
+
+		//A file moved to a path that is deleted anyway is renamed
+		if len(file.Transfer) == 0 && len(file.Reuse) == 1 && file.Reuse[0].Size == file.Size &&
+			file.Reuse[0].Path != file.Path && deleted[file.Reuse[0].Path] {
+			op.Action, op.From, op.Reused = Rename, file.Reuse[0].Path, 0
+			delete(deleted, op.From)
+			moves = append(moves, pending{op: op})
+			continue
+		}
+
+		temp := ""
+		if !m.dryRun {
+			var err error
+			if temp, err = m.build(file); err != nil {
+				return nil, err
+			}
+		}
+		moves = append(moves, pending{op: op, temp: temp})
+	}
+
+	for _, move := range moves {
+		if !m.dryRun {
+			if err := m.move(move); err != nil {
+				return nil, err
+			}
+		}
+		m.logger.Log(logging.Info, "mirrored file", logging.F("action", move.op.Action), logging.F("path", move.op.Path))
+		result.Ops = append(result.Ops, move.op)
+		result.Transferred += move.op.Transferred
+		result.Reused += move.op.Reused
+	}
+
+	paths := make([]string, 0, len(deleted))
+	for path := range deleted {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if !m.dryRun {
+			if err := m.remove(path); err != nil {
+				return nil, err
+			}
+		}
+		m.logger.Log(logging.Info, "mirrored file", logging.F("action", Delete), logging.F("path", path))
+		result.Ops = append(result.Ops, Op{Action: Delete, Path: path})
+	}
+	return result, nil
+}
+
+// build writes a file from source ranges and reused destination ranges to
+// a temporary file next to its destination and verifies its hash
+func (m *mirror) build(file blockmap.DeltaFile) (string, error) {
+	target := m.destPath(file.Path)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return "", errors.Wrap(err, "sync: failed to create directory")
+	}
+	out, err := ioutil.TempFile(filepath.Dir(target), "."+filepath.Base(target)+".golinks-sync-")
+	if err != nil {
+		return "", errors.Wrap(err, "sync: failed to create "+file.Path)
+	}
+	m.temps = append(m.temps, out.Name())
+
+	newHash, err := m.source.FileHash.Func()
+	if err != nil {
+		out.Close()
+		return "", err
+	}
+	hash := newHash()
+	w := io.MultiWriter(out, hash)
+
+	type segment struct {
+		offset, size int64
+		path         string
+		from         int64
+		local        bool
+	}
+	var segments []segment
+	for _, r := range file.Transfer {
+		segments = append(segments, segment{offset: r.Offset, size: r.Size, path: file.Path, from: r.Offset})
+	}
+	for _, r := range file.Reuse {
+		segments = append(segments, segment{offset: r.Offset, size: r.Size, path: r.Path, from: r.From, local: true})
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].offset < segments[j].offset })
+
+	for _, s := range segments {
+		f, err := m.openFile(s.path, s.local)
+		if err == nil {
+			_, err = io.Copy(w, io.NewSectionReader(f, s.from, s.size))
+		}
+		if err != nil {
+			out.Close()
+			return "", errors.Wrap(err, "sync: failed to write "+file.Path)
+		}
+	}
+	if err := out.Close(); err != nil {
+		return "", errors.Wrap(err, "sync: failed to write "+file.Path)
+	}
+	if !bytes.Equal(hash.Sum(nil), file.Hash) {
+		return "", errors.Wrap(ErrChanged, file.Path)
+	}
+
+	entry := m.source.Entries[file.Path]
+	mode := os.FileMode(0644)
+	if entry.Mode != 0 {
+		mode = entry.Mode.Perm()
+	}
+	if err := os.Chmod(out.Name(), mode); err != nil {
+		return "", errors.Wrap(err, "sync: failed to set mode of "+file.Path)
+	}
+	return out.Name(), m.setModTime(out.Name(), entry.ModTime)
+}
+
+// move puts a built or renamed file in place
+func (m *mirror) move(move pending) error {
+	target := m.destPath(move.op.Path)
+	from := move.temp
+	if move.op.Action == Rename {
+		from = m.destPath(move.op.From)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return errors.Wrap(err, "sync: failed to create directory")
+		}
+	}
+	if err := os.Rename(from, target); err != nil {
+		return errors.Wrap(err, "sync: failed to move "+move.op.Path)
+	}
+	if move.op.Action == Rename {
+		m.pruneDirs(move.op.From)
+	}
+	return nil
+}
+
+// remove deletes a destination file
+func (m *mirror) remove(path string) error {
+	target := m.destPath(path)
+	if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "sync: failed to delete "+path)
+	}
+	m.pruneDirs(path)
+	return nil
+}
+
+// pruneDirs removes the empty parent directories of a removed destination
+// path that aren't in the source
+func (m *mirror) pruneDirs(path string) {
+	for dir := filepath.Dir(m.destPath(path)); dir != filepath.Clean(m.dst); dir = filepath.Dir(dir) {
+		rel, err := filepath.Rel(m.dst, dir)
+		if err != nil {
+			return
+		}
+		if _, err := os.Stat(filepath.Join(m.src, rel)); err == nil {
+			return
+		}
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
+
+// setModTime sets the modification time of a built file to its source's so
+// later comparisons can reuse cached hashes
+func (m *mirror) setModTime(path string, modTime int64) error {
+	if modTime == 0 {
+		return nil
+	}
+	t := time.Unix(0, modTime)
+	return errors.Wrap(os.Chtimes(path, t, t), "sync: failed to set modification time")
+}
+
+// openFile returns an open source file, or destination file when local
+func (m *mirror) openFile(path string, local bool) (*os.File, error) {
+	key := "src:" + path
+	full := filepath.Join(m.src, filepath.FromSlash(m.source.FileName(path)))
+	if local {
+		key, full = "dst:"+path, m.destPath(path)
+	}
+	if f, ok := m.open[key]; ok {
+		return f, nil
+	}
+	f, err := os.Open(full)
+	if err != nil {
+		return nil, err
+	}
+	m.open[key] = f
+	return f, nil
+}
+
+// close closes the open files and removes temporary files left by a failure
+func (m *mirror) close() {
+	for _, f := range m.open {
+		f.Close()
+	}
+	for _, temp := range m.temps {
+		os.Remove(temp)
+	}
+}
+
+// checkPaths rejects plans reading or writing any path outside the source
+// or destination
+func (m *mirror) checkPaths() error {
+	paths := append([]string{}, m.plan.Delete...)
+	for _, file := range m.plan.Files {
+		paths = append(paths, file.Path)
+		for _, r := range file.Reuse {
+			paths = append(paths, r.Path)
+		}
+	}
+	for _, path := range paths {
+		if !contained(path) || !contained(m.plan.Name(path)) {
+			return errors.Wrap(ErrUnsafePath, path)
+		}
+	}
+	return nil
+}
+
+// contained reports whether a slash separated path stays below the
+// directory it is joined to
+func contained(path string) bool {
+	p := filepath.FromSlash(path)
+	if path == "" || strings.HasPrefix(path, "/") || filepath.IsAbs(p) || filepath.VolumeName(p) != "" {
+		return false
+	}
+	p = filepath.Clean(p)
+	return p != "." && p != ".." && !strings.HasPrefix(p, ".."+string(filepath.Separator))
+}
+
+// destPath returns the destination file of a path of the plan
+func (m *mirror) destPath(path string) string {
+	return filepath.Join(m.dst, filepath.FromSlash(m.plan.Name(path)))
+}
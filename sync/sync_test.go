@@ -0,0 +1,178 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+package sync
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/govice/golinks/blockmap"
+	"github.com/pkg/errors"
+)
+
+func TestMirror(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	write := func(root, name string, data []byte) {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	large := make([]byte, 64<<10)
+	rand.New(rand.NewSource(1)).Read(large)
+	modified := append([]byte{}, large...)
+	copy(modified[20<<10:], []byte("changed"))
+
+	write(src, "large", large)
+	write(src, "dir/moved", []byte("moved content"))
+	write(src, "new", []byte("new"))
+	write(src, "same", []byte("same"))
+	write(dst, "large", modified)
+	write(dst, "old/name", []byte("moved content"))
+	write(dst, "same", []byte("same"))
+	write(dst, "extra", []byte("extra"))
+
+	chunking := WithBlockMapOptions(blockmap.WithChunking(blockmap.FixedChunks, 4096, 8192))
+
+	//A dry run reports the changes without making them
+	result, err := Mirror(src, dst, chunking, WithDelete(), WithDryRun())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Op{
+		{Action: Rename, Path: "dir/moved", From: "old/name"},
+		{Action: Update, Path: "large", Transferred: 4096, Reused: 60 << 10},
+		{Action: Create, Path: "new", Transferred: 3},
+		{Action: Delete, Path: "extra"},
+	}
+	if !reflect.DeepEqual(result.Ops, want) || !result.DryRun {
+		t.Errorf("unexpected dry run %+v", result.Ops)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(dst, "extra")); err != nil || string(data) != "extra" {
+		t.Error("dry run changed the destination")
+	}
+
+	result, err = Mirror(src, dst, chunking, WithDelete())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Ops, want) || result.Transferred != 4099 {
+		t.Errorf("unexpected result %+v", result)
+	}
+	a, b := blockmap.New(src), blockmap.New(dst)
+	if err := a.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if !blockmap.Equal(a, b) {
+		t.Errorf("destination doesn't match source: %+v", blockmap.Diff(a, b))
+	}
+	if _, err := os.Stat(filepath.Join(dst, "old")); !os.IsNotExist(err) {
+		t.Error("expected the emptied directory to be removed")
+	}
+
+	//Without delete extraneous files are kept and mirroring again changes nothing
+	write(dst, "extra", []byte("extra"))
+	result, err = Mirror(src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Ops) != 0 {
+		t.Errorf("expected no changes, got %+v", result.Ops)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "extra")); err != nil {
+		t.Error("expected extraneous file to be kept")
+	}
+
+	//Links can't mirror files outside the destination
+	for _, key := range []string{"../escaped", "dir/../../escaped", "/escaped"} {
+		link := blockmap.New(src)
+		if err := link.Generate(); err != nil {
+			t.Fatal(err)
+		}
+		link.Archive[key] = link.Archive["new"]
+		link.Entries[key] = link.Entries["new"]
+		if _, err := Mirror(src, dst, WithSource(link)); errors.Cause(err) != ErrUnsafePath {
+			t.Errorf("%s: expected unsafe path error, got %v", key, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "escaped")); !os.IsNotExist(err) {
+			t.Errorf("%s: a file was written outside the destination", key)
+		}
+	}
+}
+
+func TestMirror_NormalizedNames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src, dst := filepath.Join(dir, "src"), filepath.Join(dir, "dst")
+	const nfd = "cafe\u0301"
+	for _, root := range []string{src, dst} {
+		if err := os.MkdirAll(root, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, nfd), []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, "moved"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dst, nfd+".old"), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	//Files keep their names, and are read and replaced by them
+	if _, err := Mirror(src, dst, WithDelete()); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, nfd), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Mirror(src, dst, WithDelete()); err != nil {
+		t.Fatal(err)
+	}
+	names, err := ioutil.ReadDir(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, info := range names {
+		got = append(got, info.Name())
+	}
+	if !reflect.DeepEqual(got, []string{nfd, "moved"}) {
+		t.Errorf("unexpected destination files %q", got)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(dst, nfd)); err != nil || string(data) != "changed" {
+		t.Errorf("unexpected content %q %v", data, err)
+	}
+}
@@ -0,0 +1,225 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+// Package tlog publishes hashes to a Rekor-style transparency log and verifies
+// the log's inclusion proofs. A published entry proves a hash was recorded in
+// an append-only public log, so tampering with local copies of the hash is
+// evident even if every local record is rewritten.
+package tlog
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultLog is the address of the public Sigstore Rekor log
+const DefaultLog = "https://rekor.sigstore.dev"
+
+// Client appends entries to and fetches entries from a log's HTTP API
+type Client struct {
+	log        *url.URL
+	httpClient *http.Client
+}
+
+// NewClient returns a client for the log at address, such as DefaultLog
+func NewClient(address string) (*Client, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, errors.Wrap(err, "tlog: invalid log address")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return nil, errors.New("tlog: log address must be an http or https URL")
+	}
+	return &Client{log: u, httpClient: http.DefaultClient}, nil
+}
+
+// SetHTTPClient sets the HTTP client used for requests
+func (c *Client) SetHTTPClient(client *http.Client) {
+	c.httpClient = client
+}
+
+// Append records hash in the log as a hashed artifact signed by signer, which
+// must hold an ECDSA or RSA key, and returns the log entry with its inclusion
+// proof
+func (c *Client) Append(ctx context.Context, hash []byte, signer crypto.Signer) (*Entry, error) {
+	digest := sha256.Sum256(hash)
+	signature, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return nil, errors.Wrap(err, "tlog: failed to sign hash")
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return nil, errors.Wrap(err, "tlog: failed to encode public key")
+	}
+	return c.AppendSignature(ctx, hash, signature, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey}))
+}
+
+// AppendSignature records hash in the log as a hashed artifact with a
+// signature already made over the SHA256 digest of hash. verifier is the PEM
+// public key or certificate the log checks the signature with.
+func (c *Client) AppendSignature(ctx context.Context, hash, signature, verifier []byte) (*Entry, error) {
+	digest := sha256.Sum256(hash)
+	var proposed hashedRekord
+	proposed.APIVersion = "0.0.1"
+	proposed.Kind = "hashedrekord"
+	proposed.Spec.Data.Hash.Algorithm = "sha256"
+	proposed.Spec.Data.Hash.Value = hex.EncodeToString(digest[:])
+	proposed.Spec.Signature.Content = signature
+	proposed.Spec.Signature.PublicKey.Content = verifier
+	body, err := json.Marshal(proposed)
+	if err != nil {
+		return nil, errors.Wrap(err, "tlog: failed to encode entry")
+	}
+	return c.do(ctx, http.MethodPost, "api/v1/log/entries", bytes.NewReader(body))
+}
+
+// Entry fetches the entry with uuid from the log, including an inclusion
+// proof against the log's current tree
+func (c *Client) Entry(ctx context.Context, uuid string) (*Entry, error) {
+	return c.do(ctx, http.MethodGet, "api/v1/log/entries/"+url.PathEscape(uuid), nil)
+}
+
+// do calls the log API and decodes the single entry it responds with
+func (c *Client) do(ctx context.Context, method, path string, body io.Reader) (*Entry, error) {
+	u := *c.log
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + path
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, errors.Wrap(err, "tlog: failed to create request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "tlog: request failed")
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, errors.Wrap(err, "tlog: failed to read response")
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		var apiErr struct{ Message string }
+		if json.Unmarshal(data, &apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(data))
+		}
+		return nil, errors.Errorf("tlog: log returned status %d: %s", resp.StatusCode, apiErr.Message)
+	}
+
+	var entries map[string]logEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, errors.Wrap(err, "tlog: failed to decode response")
+	}
+	if len(entries) != 1 {
+		return nil, errors.Errorf("tlog: expected one entry in response, got %d", len(entries))
+	}
+	for uuid, entry := range entries {
+		return entry.decode(uuid)
+	}
+	return nil, nil
+}
+
+// hashedRekord is a log entry recording a signed artifact digest
+type hashedRekord struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Spec       struct {
+		Data struct {
+			Hash struct {
+				Algorithm string `json:"algorithm"`
+				Value     string `json:"value"`
+			} `json:"hash"`
+		} `json:"data"`
+		Signature struct {
+			Content   []byte `json:"content"`
+			PublicKey struct {
+				Content []byte `json:"content"`
+			} `json:"publicKey"`
+		} `json:"signature"`
+	} `json:"spec"`
+}
+
+// logEntry is an entry as returned by the log API
+type logEntry struct {
+	Body           string `json:"body"`
+	IntegratedTime int64  `json:"integratedTime"`
+	LogID          string `json:"logID"`
+	LogIndex       int64  `json:"logIndex"`
+	Verification   struct {
+		InclusionProof *struct {
+			Checkpoint string   `json:"checkpoint"`
+			Hashes     []string `json:"hashes"`
+			LogIndex   int64    `json:"logIndex"`
+			RootHash   string   `json:"rootHash"`
+			TreeSize   int64    `json:"treeSize"`
+		} `json:"inclusionProof"`
+		SignedEntryTimestamp []byte `json:"signedEntryTimestamp"`
+	} `json:"verification"`
+}
+
+func (e logEntry) decode(uuid string) (*Entry, error) {
+	body, err := base64.StdEncoding.DecodeString(e.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "tlog: failed to decode entry body")
+	}
+	proof := e.Verification.InclusionProof
+	if proof == nil {
+		return nil, errors.Wrap(ErrInclusion, "log returned no inclusion proof")
+	}
+	entry := &Entry{
+		UUID:                 uuid,
+		LogID:                e.LogID,
+		LogIndex:             e.LogIndex,
+		IntegratedTime:       e.IntegratedTime,
+		Body:                 body,
+		SignedEntryTimestamp: e.Verification.SignedEntryTimestamp,
+		Proof: InclusionProof{
+			LogIndex:   proof.LogIndex,
+			TreeSize:   proof.TreeSize,
+			Checkpoint: proof.Checkpoint,
+		},
+	}
+	if entry.Proof.RootHash, err = hex.DecodeString(proof.RootHash); err != nil {
+		return nil, errors.Wrap(err, "tlog: failed to decode inclusion proof")
+	}
+	for _, h := range proof.Hashes {
+		decoded, err := hex.DecodeString(h)
+		if err != nil {
+			return nil, errors.Wrap(err, "tlog: failed to decode inclusion proof")
+		}
+		entry.Proof.Hashes = append(entry.Proof.Hashes, decoded)
+	}
+	return entry, nil
+}
@@ -0,0 +1,245 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package tlog
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrInclusion is returned when an inclusion proof doesn't lead to the
+	// log's root hash
+	ErrInclusion = errors.New("tlog: invalid inclusion proof")
+	// ErrEntryMismatch is returned when a log entry doesn't record the
+	// expected hash
+	ErrEntryMismatch = errors.New("tlog: log entry does not record hash")
+	// ErrBadTimestamp is returned when a signed entry timestamp isn't signed
+	// by the log
+	ErrBadTimestamp = errors.New("tlog: invalid signed entry timestamp")
+	// ErrBadCheckpoint is returned when an inclusion proof's checkpoint isn't
+	// signed by the log or doesn't commit to the proof's tree
+	ErrBadCheckpoint = errors.New("tlog: invalid checkpoint")
+	// ErrNoLogKey is returned when verifying an entry without the log's key.
+	// Without it the entry and the root hash it is proven against are
+	// whatever the holder of the entry wrote.
+	ErrNoLogKey = errors.New("tlog: verifying a log entry requires the log's public key")
+)
+
+// Entry is a log entry with the proof of its inclusion in the log. Body is
+// the canonical entry hashed into the log and SignedEntryTimestamp the log's
+// signature promising to include it.
+type Entry struct {
+	UUID                 string         `json:"uuid"`
+	LogID                string         `json:"logID"`
+	LogIndex             int64          `json:"logIndex"`
+	IntegratedTime       int64          `json:"integratedTime"`
+	Body                 []byte         `json:"body"`
+	SignedEntryTimestamp []byte         `json:"signedEntryTimestamp,omitempty"`
+	Proof                InclusionProof `json:"inclusionProof"`
+}
+
+// InclusionProof is an RFC 6962 audit path from an entry to the root of a
+// log tree of TreeSize entries
+type InclusionProof struct {
+	LogIndex   int64    `json:"logIndex"`
+	TreeSize   int64    `json:"treeSize"`
+	RootHash   []byte   `json:"rootHash"`
+	Hashes     [][]byte `json:"hashes"`
+	Checkpoint string   `json:"checkpoint,omitempty"`
+}
+
+// Records reports whether the entry records the hash published by Append
+func (e *Entry) Records(hash []byte) bool {
+	var recorded hashedRekord
+	if err := json.Unmarshal(e.Body, &recorded); err != nil {
+		return false
+	}
+	digest := sha256.Sum256(hash)
+	return recorded.Spec.Data.Hash.Algorithm == "sha256" && recorded.Spec.Data.Hash.Value == hex.EncodeToString(digest[:])
+}
+
+// Signature returns the signature the entry records and the PEM public key
+// or certificate it is checked with
+func (e *Entry) Signature() (signature, verifier []byte, err error) {
+	var recorded hashedRekord
+	if err := json.Unmarshal(e.Body, &recorded); err != nil {
+		return nil, nil, errors.Wrap(err, "tlog: failed to decode entry body")
+	}
+	return recorded.Spec.Signature.Content, recorded.Spec.Signature.PublicKey.Content, nil
+}
+
+// Verify checks the entry records hash, its inclusion proof leads to the
+// proof's root hash and its signed entry timestamp is signed by logKey,
+// binding the entry to the log without contacting it. A checkpoint in the
+// proof must also be signed by logKey for the proof's tree.
+func (e *Entry) Verify(hash []byte, logKey crypto.PublicKey) error {
+	if logKey == nil {
+		return ErrNoLogKey
+	}
+	if !e.Records(hash) {
+		return ErrEntryMismatch
+	}
+	if err := e.Proof.Verify(LeafHash(e.Body)); err != nil {
+		return err
+	}
+	if err := e.verifyTimestamp(logKey); err != nil {
+		return err
+	}
+	if e.Proof.Checkpoint != "" {
+		return e.Proof.verifyCheckpoint(logKey)
+	}
+	return nil
+}
+
+// verifyTimestamp checks the signed entry timestamp, a signature over the
+// canonical JSON of the entry's body, time, log and index
+func (e *Entry) verifyTimestamp(logKey crypto.PublicKey) error {
+	payload, err := json.Marshal(struct {
+		Body           string `json:"body"`
+		IntegratedTime int64  `json:"integratedTime"`
+		LogID          string `json:"logID"`
+		LogIndex       int64  `json:"logIndex"`
+	}{base64.StdEncoding.EncodeToString(e.Body), e.IntegratedTime, e.LogID, e.LogIndex})
+	if err != nil {
+		return errors.Wrap(err, "tlog: failed to encode entry timestamp")
+	}
+	digest := sha256.Sum256(payload)
+	switch key := logKey.(type) {
+	case *ecdsa.PublicKey:
+		if ecdsa.VerifyASN1(key, digest[:], e.SignedEntryTimestamp) {
+			return nil
+		}
+	case ed25519.PublicKey:
+		if ed25519.Verify(key, payload, e.SignedEntryTimestamp) {
+			return nil
+		}
+	default:
+		return errors.Errorf("tlog: unsupported log key %T", logKey)
+	}
+	return ErrBadTimestamp
+}
+
+// verifyCheckpoint checks the proof's checkpoint, a signed note of the log's
+// origin, tree size and base64 root hash, is signed by logKey and commits to
+// the proof's tree size and root hash
+func (p InclusionProof) verifyCheckpoint(logKey crypto.PublicKey) error {
+	end := strings.Index(p.Checkpoint, "\n\n")
+	if end < 0 {
+		return errors.Wrap(ErrBadCheckpoint, "note has no signatures")
+	}
+	text := p.Checkpoint[:end+1]
+	lines := strings.Split(text, "\n")
+	if len(lines) < 4 {
+		return errors.Wrap(ErrBadCheckpoint, "note is too short")
+	}
+	size, err := strconv.ParseInt(lines[1], 10, 64)
+	if err != nil || size != p.TreeSize {
+		return errors.Wrap(ErrBadCheckpoint, "tree size does not match the proof")
+	}
+	root, err := base64.StdEncoding.DecodeString(lines[2])
+	if err != nil || !bytes.Equal(root, p.RootHash) {
+		return errors.Wrap(ErrBadCheckpoint, "root hash does not match the proof")
+	}
+
+	digest := sha256.Sum256([]byte(text))
+	for _, line := range strings.Split(p.Checkpoint[end+2:], "\n") {
+		if !strings.HasPrefix(line, "\u2014 ") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		//The signature follows a four byte hint of the signing key
+		signature, err := base64.StdEncoding.DecodeString(fields[2])
+		if err != nil || len(signature) <= 4 {
+			continue
+		}
+		signature = signature[4:]
+		switch key := logKey.(type) {
+		case *ecdsa.PublicKey:
+			if ecdsa.VerifyASN1(key, digest[:], signature) {
+				return nil
+			}
+		case ed25519.PublicKey:
+			if ed25519.Verify(key, []byte(text), signature) {
+				return nil
+			}
+		default:
+			return errors.Errorf("tlog: unsupported log key %T", logKey)
+		}
+	}
+	return errors.Wrap(ErrBadCheckpoint, "no signature by the log")
+}
+
+// LeafHash returns the RFC 6962 hash of a log leaf
+func LeafHash(leaf []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0})
+	h.Write(leaf)
+	return h.Sum(nil)
+}
+
+// nodeHash returns the RFC 6962 hash of an interior node
+func nodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// Verify checks the audit path from leafHash at LogIndex leads to RootHash,
+// following RFC 9162 section 2.1.3.2
+func (p InclusionProof) Verify(leafHash []byte) error {
+	if p.LogIndex < 0 || p.LogIndex >= p.TreeSize {
+		return errors.Wrapf(ErrInclusion, "index %d outside tree of size %d", p.LogIndex, p.TreeSize)
+	}
+	fn, sn := p.LogIndex, p.TreeSize-1
+	r := leafHash
+	for _, sibling := range p.Hashes {
+		if sn == 0 {
+			return errors.Wrap(ErrInclusion, "audit path too long")
+		}
+		if fn&1 == 1 || fn == sn {
+			r = nodeHash(sibling, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = nodeHash(r, sibling)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 || !bytes.Equal(r, p.RootHash) {
+		return ErrInclusion
+	}
+	return nil
+}
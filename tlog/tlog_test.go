@@ -0,0 +1,224 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package tlog
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testLog is a minimal Rekor-style log holding its entries in memory
+type testLog struct {
+	mu     sync.Mutex
+	key    *ecdsa.PrivateKey
+	leaves [][]byte
+}
+
+func (l *testLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	index := len(l.leaves)
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/log/entries":
+		body, _ := ioutil.ReadAll(r.Body)
+		l.leaves = append(l.leaves, body)
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/api/v1/log/entries/"):
+		fmt.Sscanf(strings.TrimPrefix(r.URL.Path, "/api/v1/log/entries/"), "%d", &index)
+		if index >= len(l.leaves) {
+			http.Error(w, `{"message":"entry not found"}`, http.StatusNotFound)
+			return
+		}
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+		return
+	}
+
+	entry := logEntry{
+		Body:           base64.StdEncoding.EncodeToString(l.leaves[index]),
+		IntegratedTime: 1600000000,
+		LogID:          "c0ffee",
+		LogIndex:       int64(index),
+	}
+	set, _ := json.Marshal(struct {
+		Body           string `json:"body"`
+		IntegratedTime int64  `json:"integratedTime"`
+		LogID          string `json:"logID"`
+		LogIndex       int64  `json:"logIndex"`
+	}{entry.Body, entry.IntegratedTime, entry.LogID, entry.LogIndex})
+	digest := sha256.Sum256(set)
+	entry.Verification.SignedEntryTimestamp, _ = ecdsa.SignASN1(rand.Reader, l.key, digest[:])
+	entry.Verification.InclusionProof = &struct {
+		Checkpoint string   `json:"checkpoint"`
+		Hashes     []string `json:"hashes"`
+		LogIndex   int64    `json:"logIndex"`
+		RootHash   string   `json:"rootHash"`
+		TreeSize   int64    `json:"treeSize"`
+	}{
+		Checkpoint: l.checkpoint(),
+		LogIndex:   int64(index),
+		RootHash:   hex.EncodeToString(treeHash(l.leaves)),
+		TreeSize:   int64(len(l.leaves)),
+	}
+	for _, h := range auditPath(index, l.leaves) {
+		entry.Verification.InclusionProof.Hashes = append(entry.Verification.InclusionProof.Hashes, hex.EncodeToString(h))
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]logEntry{fmt.Sprint(index): entry})
+}
+
+// checkpoint returns the signed note of the log's current tree
+func (l *testLog) checkpoint() string {
+	text := fmt.Sprintf("test log - 1\n%d\n%s\n", len(l.leaves), base64.StdEncoding.EncodeToString(treeHash(l.leaves)))
+	digest := sha256.Sum256([]byte(text))
+	signature, _ := ecdsa.SignASN1(rand.Reader, l.key, digest[:])
+	return text + "\n\u2014 test " + base64.StdEncoding.EncodeToString(append([]byte{1, 2, 3, 4}, signature...)) + "\n"
+}
+
+// split returns the largest power of two smaller than n
+func split(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+// treeHash is the RFC 6962 Merkle tree hash of leaves
+func treeHash(leaves [][]byte) []byte {
+	if len(leaves) == 1 {
+		return LeafHash(leaves[0])
+	}
+	k := split(len(leaves))
+	return nodeHash(treeHash(leaves[:k]), treeHash(leaves[k:]))
+}
+
+// auditPath is the RFC 6962 audit path of leaf m
+func auditPath(m int, leaves [][]byte) [][]byte {
+	if len(leaves) == 1 {
+		return nil
+	}
+	k := split(len(leaves))
+	if m < k {
+		return append(auditPath(m, leaves[:k]), treeHash(leaves[k:]))
+	}
+	return append(auditPath(m-k, leaves[k:]), treeHash(leaves[:k]))
+}
+
+func TestClient_Append(t *testing.T) {
+	logKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(&testLog{key: logKey})
+	defer server.Close()
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var entries []*Entry
+	for i := 0; i < 7; i++ {
+		hash := []byte(fmt.Sprint("root hash ", i))
+		entry, err := client.Append(context.Background(), hash, signer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := entry.Verify(hash, &logKey.PublicKey); err != nil {
+			t.Fatalf("entry %d: %v", i, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	//Earlier entries are proven against the grown tree when refreshed
+	for i, entry := range entries {
+		refreshed, err := client.Entry(context.Background(), entry.UUID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if refreshed.Proof.TreeSize != 7 {
+			t.Errorf("expected tree size 7, got %d", refreshed.Proof.TreeSize)
+		}
+		if err := refreshed.Verify([]byte(fmt.Sprint("root hash ", i)), &logKey.PublicKey); err != nil {
+			t.Errorf("refreshed entry %d: %v", i, err)
+		}
+	}
+
+	entry := entries[3]
+	signature, verifier, err := entry.Signature()
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte("root hash 3"))
+	if !strings.HasPrefix(string(verifier), "-----BEGIN PUBLIC KEY-----") || !ecdsa.VerifyASN1(&signer.PublicKey, digest[:], signature) {
+		t.Errorf("expected the entry to record the signature and key, got %q", verifier)
+	}
+	if err := entry.Verify([]byte("root hash 3"), nil); err != ErrNoLogKey {
+		t.Error("expected a missing log key error, got", err)
+	}
+	if err := entry.Verify([]byte("other"), &logKey.PublicKey); err != ErrEntryMismatch {
+		t.Error("expected entry mismatch, got", err)
+	}
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err := entry.Verify([]byte("root hash 3"), &otherKey.PublicKey); err != ErrBadTimestamp {
+		t.Error("expected bad timestamp, got", err)
+	}
+	forged := *entry
+	forged.Proof.RootHash = append([]byte{}, entry.Proof.RootHash...)
+	forged.Proof.RootHash[0] ^= 0xff
+	if err := forged.Verify([]byte("root hash 3"), &logKey.PublicKey); !errors.Is(err, ErrInclusion) {
+		t.Error("expected invalid inclusion proof, got", err)
+	}
+	forged.Proof = entry.Proof
+	forged.Proof.Hashes = entry.Proof.Hashes[1:]
+	if err := forged.Verify([]byte("root hash 3"), &logKey.PublicKey); !errors.Is(err, ErrInclusion) {
+		t.Error("expected invalid inclusion proof, got", err)
+	}
+
+	//A checkpoint must be signed by the log for the proven tree
+	forged.Proof = entry.Proof
+	forged.Proof.Checkpoint = entries[4].Proof.Checkpoint
+	if err := forged.Verify([]byte("root hash 3"), &logKey.PublicKey); !errors.Is(err, ErrBadCheckpoint) {
+		t.Error("expected a checkpoint of another tree to be rejected, got", err)
+	}
+	forged.Proof.Checkpoint = strings.Replace(entry.Proof.Checkpoint, "test log", "forged log", 1)
+	if err := forged.Verify([]byte("root hash 3"), &logKey.PublicKey); !errors.Is(err, ErrBadCheckpoint) {
+		t.Error("expected a forged checkpoint to be rejected, got", err)
+	}
+
+	if _, err := client.Entry(context.Background(), "100"); err == nil || !strings.Contains(err.Error(), "entry not found") {
+		t.Error("expected missing entry error, got", err)
+	}
+}
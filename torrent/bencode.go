@@ -0,0 +1,84 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+package torrent
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// encode writes v to w in bencoding. Strings, byte slices, integers, lists
+// and dictionaries with string keys are supported; dictionary keys are
+// written in raw byte order as the format requires.
+func encode(w io.Writer, v interface{}) error {
+	var err error
+	switch v := v.(type) {
+	case string:
+		_, err = fmt.Fprintf(w, "%d:%s", len(v), v)
+	case []byte:
+		if _, err = fmt.Fprintf(w, "%d:", len(v)); err == nil {
+			_, err = w.Write(v)
+		}
+	case int:
+		_, err = fmt.Fprintf(w, "i%de", v)
+	case int64:
+		_, err = fmt.Fprintf(w, "i%de", v)
+	case []interface{}:
+		if _, err = io.WriteString(w, "l"); err != nil {
+			return err
+		}
+		for _, item := range v {
+			if err := encode(w, item); err != nil {
+				return err
+			}
+		}
+		_, err = io.WriteString(w, "e")
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		if _, err = io.WriteString(w, "d"); err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err := encode(w, key); err != nil {
+				return err
+			}
+			if err := encode(w, v[key]); err != nil {
+				return err
+			}
+		}
+		_, err = io.WriteString(w, "e")
+	default:
+		return errors.Errorf("torrent: can't bencode %T", v)
+	}
+	return err
+}
+
+// bencode returns the bencoding of v
+func bencode(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encode(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,377 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+// Package torrent exports blockmaps as BitTorrent metainfo files so the files
+// of a snapshot can be distributed over BitTorrent. Pieces are hashed from
+// the files under the blockmap's root, which are checked against their
+// archived hashes as they're read, so a torrent always carries the content
+// the blockmap describes.
+package torrent
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/govice/golinks/blockmap"
+	"github.com/pkg/errors"
+)
+
+// Version selects the metainfo layout
+type Version int
+
+const (
+	// V1 hashes pieces of the concatenated files with SHA-1 as in BEP 3
+	V1 Version = 1
+	// V2 hashes each file as a SHA-256 merkle tree of 16KiB blocks as in BEP 52
+	V2 Version = 2
+)
+
+// BlockSize is the size of the merkle tree leaves of V2 torrents
+const BlockSize = 16 << 10
+
+// DefaultPieceLength is the piece length used without WithPieceLength
+const DefaultPieceLength = 256 << 10
+
+var (
+	// ErrPieceLength is returned for piece lengths that aren't a power of two
+	// of at least BlockSize
+	ErrPieceLength = errors.New("torrent: piece length must be a power of two of at least 16KiB")
+	// ErrUnknownVersion is returned for metainfo versions other than V1 and V2
+	ErrUnknownVersion = errors.New("torrent: unknown metainfo version")
+	// ErrFileChanged is returned when a file no longer matches its archived
+	// hash while its pieces are hashed
+	ErrFileChanged = errors.New("torrent: file changed since blockmap generation")
+)
+
+// Option configures the exported torrent
+type Option func(*config)
+
+type config struct {
+	name        string
+	pieceLength int64
+	announce    []string
+	comment     string
+	version     Version
+}
+
+// WithName names the torrent, by default the base name of the blockmap's root
+func WithName(name string) Option {
+	return func(c *config) { c.name = name }
+}
+
+// WithPieceLength sets the piece length, a power of two of at least BlockSize
+func WithPieceLength(n int64) Option {
+	return func(c *config) { c.pieceLength = n }
+}
+
+// WithAnnounce sets the tracker URLs, each in its own tier
+func WithAnnounce(urls ...string) Option {
+	return func(c *config) { c.announce = urls }
+}
+
+// WithComment sets the comment of the torrent
+func WithComment(comment string) Option {
+	return func(c *config) { c.comment = comment }
+}
+
+// WithVersion selects the metainfo layout, V1 by default
+func WithVersion(v Version) Option {
+	return func(c *config) { c.version = v }
+}
+
+// Write writes a metainfo file of the files archived in b to w. Directory
+// entries aren't part of the torrent. The root hash of b is recorded outside
+// the info dictionary so the torrent can be matched back to its blockmap.
+func Write(b *blockmap.BlockMap, w io.Writer, opts ...Option) error {
+	metainfo, err := build(b, opts...)
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(encode(w, metainfo), "torrent: failed to write metainfo")
+}
+
+// build returns the metainfo dictionary of b
+func build(b *blockmap.BlockMap, opts ...Option) (map[string]interface{}, error) {
+	c := config{pieceLength: DefaultPieceLength, version: V1}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	if c.pieceLength < BlockSize || c.pieceLength&(c.pieceLength-1) != 0 {
+		return nil, ErrPieceLength
+	}
+	if b.RootHash == nil {
+		return nil, blockmap.ErrUnhashed
+	}
+	paths := b.FilePaths()
+	if len(paths) == 0 {
+		return nil, blockmap.ErrEmptyArchive
+	}
+	if c.name == "" {
+		c.name = "golinks"
+		if b.Root != "" {
+			c.name = filepath.Base(b.Root)
+		}
+	}
+
+	info := map[string]interface{}{
+		"name":         c.name,
+		"piece length": c.pieceLength,
+	}
+	metainfo := map[string]interface{}{
+		"info":              info,
+		"created by":        "golinks",
+		"golinks root hash": hex.EncodeToString(b.RootHash),
+	}
+	switch c.version {
+	case V1:
+		files, pieces, err := hashV1(b, paths, c.pieceLength)
+		if err != nil {
+			return nil, err
+		}
+		info["files"] = files
+		info["pieces"] = pieces
+	case V2:
+		tree, layers, err := hashV2(b, paths, c.pieceLength)
+		if err != nil {
+			return nil, err
+		}
+		info["meta version"] = 2
+		info["file tree"] = tree
+		metainfo["piece layers"] = layers
+	default:
+		return nil, errors.Wrapf(ErrUnknownVersion, "%d", c.version)
+	}
+
+	if len(c.announce) > 0 {
+		metainfo["announce"] = c.announce[0]
+	}
+	if len(c.announce) > 1 {
+		var tiers []interface{}
+		for _, url := range c.announce {
+			tiers = append(tiers, []interface{}{url})
+		}
+		metainfo["announce-list"] = tiers
+	}
+	if c.comment != "" {
+		metainfo["comment"] = c.comment
+	}
+	return metainfo, nil
+}
+
+// hashV1 returns the file list of the files at paths and the SHA-1 hashes
+// of the pieces of their concatenated content
+func hashV1(b *blockmap.BlockMap, paths []string, pieceLength int64) ([]interface{}, []byte, error) {
+	pieces := &pieceHasher{length: pieceLength, hash: sha1.New()}
+	var files []interface{}
+	for _, path := range paths {
+		n, err := readFile(b, path, pieces)
+		if err != nil {
+			return nil, nil, err
+		}
+		var components []interface{}
+		for _, component := range strings.Split(path, "/") {
+			components = append(components, component)
+		}
+		files = append(files, map[string]interface{}{
+			"length": n,
+			"path":   components,
+		})
+	}
+	return files, pieces.sum(), nil
+}
+
+// hashV2 returns the file tree of the files at paths and the piece layers of
+// the files larger than a piece
+func hashV2(b *blockmap.BlockMap, paths []string, pieceLength int64) (map[string]interface{}, map[string]interface{}, error) {
+	tree := make(map[string]interface{})
+	layers := make(map[string]interface{})
+	for _, path := range paths {
+		merkle := &merkleHasher{}
+		n, err := readFile(b, path, merkle)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		file := map[string]interface{}{"length": n}
+		if n > 0 {
+			root, layer := merkle.sum(pieceLength / BlockSize)
+			file["pieces root"] = root
+			if n > pieceLength {
+				layers[string(root)] = layer
+			}
+		}
+
+		dir := tree
+		components := strings.Split(path, "/")
+		for _, component := range components[:len(components)-1] {
+			next, ok := dir[component].(map[string]interface{})
+			if !ok {
+				next = make(map[string]interface{})
+				dir[component] = next
+			}
+			dir = next
+		}
+		dir[components[len(components)-1]] = map[string]interface{}{"": file}
+	}
+	return tree, layers, nil
+}
+
+// readFile copies the archived file at path to w and checks it against its
+// archived hash, returning the number of bytes read
+func readFile(b *blockmap.BlockMap, path string, w io.Writer) (int64, error) {
+	src, err := b.Open(path)
+	if err != nil {
+		return 0, errors.Wrap(err, "torrent: failed to open "+path)
+	}
+	defer src.Close()
+
+	//Chunked files are recorded by the hash of their chunks and are checked
+	//separately
+	if entry := b.Entries[path]; entry.Chunks != nil {
+		result, err := b.VerifyFile(path)
+		if err != nil {
+			return 0, err
+		}
+		if !result.Valid() {
+			return 0, errors.Wrap(ErrFileChanged, path)
+		}
+		n, err := io.Copy(w, src)
+		return n, errors.Wrap(err, "torrent: failed to read "+path)
+	}
+
+	newHash, err := b.FileHash.Func()
+	if err != nil {
+		return 0, err
+	}
+	fileHash := newHash()
+	n, err := io.Copy(io.MultiWriter(w, fileHash), src)
+	if err != nil {
+		return 0, errors.Wrap(err, "torrent: failed to read "+path)
+	}
+	if !bytes.Equal(fileHash.Sum(nil), b.Digest(b.Archive[path])) {
+		return 0, errors.Wrap(ErrFileChanged, path)
+	}
+	return n, nil
+}
+
+// pieceHasher hashes a stream in pieces of a fixed length
+type pieceHasher struct {
+	length  int64
+	hash    hash.Hash
+	written int64
+	pieces  []byte
+}
+
+func (p *pieceHasher) Write(data []byte) (int, error) {
+	n := len(data)
+	for len(data) > 0 {
+		size := p.length - p.written
+		if int64(len(data)) < size {
+			size = int64(len(data))
+		}
+		p.hash.Write(data[:size])
+		p.written += size
+		data = data[size:]
+		if p.written == p.length {
+			p.pieces = p.hash.Sum(p.pieces)
+			p.hash.Reset()
+			p.written = 0
+		}
+	}
+	return n, nil
+}
+
+// sum returns the concatenated piece hashes including a final short piece
+func (p *pieceHasher) sum() []byte {
+	if p.written > 0 {
+		p.pieces = p.hash.Sum(p.pieces)
+		p.hash.Reset()
+		p.written = 0
+	}
+	return p.pieces
+}
+
+// merkleHasher hashes a file into the SHA-256 leaves of its BEP 52 merkle tree
+type merkleHasher struct {
+	block  []byte
+	leaves [][]byte
+}
+
+func (m *merkleHasher) Write(data []byte) (int, error) {
+	n := len(data)
+	for len(data) > 0 {
+		size := BlockSize - len(m.block)
+		if len(data) < size {
+			size = len(data)
+		}
+		m.block = append(m.block, data[:size]...)
+		data = data[size:]
+		if len(m.block) == BlockSize {
+			m.flush()
+		}
+	}
+	return n, nil
+}
+
+func (m *merkleHasher) flush() {
+	sum := sha256.Sum256(m.block)
+	m.leaves = append(m.leaves, sum[:])
+	m.block = m.block[:0]
+}
+
+// sum returns the merkle root and the concatenated hashes of the layer whose
+// nodes each cover blocksPerPiece leaves. Leaves past the end of the file
+// are zero hashes.
+func (m *merkleHasher) sum(blocksPerPiece int64) ([]byte, []byte) {
+	if len(m.block) > 0 {
+		m.flush()
+	}
+	pieces := (int64(len(m.leaves)) + blocksPerPiece - 1) / blocksPerPiece
+
+	level := m.leaves
+	width := 1
+	for width < len(level) {
+		width *= 2
+	}
+	for len(level) < width {
+		level = append(level, make([]byte, sha256.Size))
+	}
+
+	var layer []byte
+	for covered := int64(1); ; covered *= 2 {
+		if covered == blocksPerPiece {
+			for _, node := range level[:pieces] {
+				layer = append(layer, node...)
+			}
+		}
+		if len(level) == 1 {
+			return level[0], layer
+		}
+		next := make([][]byte, len(level)/2)
+		for i := range next {
+			h := sha256.New()
+			h.Write(level[2*i])
+			h.Write(level[2*i+1])
+			next[i] = h.Sum(nil)
+		}
+		level = next
+	}
+}
@@ -0,0 +1,184 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+package torrent
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/govice/golinks/blockmap"
+	"github.com/pkg/errors"
+)
+
+func TestBencode(t *testing.T) {
+	v := map[string]interface{}{
+		"b":    []interface{}{"x", 1, int64(-2)},
+		"a":    []byte{0xff},
+		"dict": map[string]interface{}{},
+	}
+	out, err := bencode(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "d1:a1:\xff1:bl1:xi1ei-2ee4:dictdee"; string(out) != want {
+		t.Errorf("expected %q, got %q", want, out)
+	}
+	if _, err := bencode(1.5); err == nil {
+		t.Error("expected floats to be rejected")
+	}
+}
+
+func testBlockMap(t *testing.T, files map[string][]byte) *blockmap.BlockMap {
+	root, err := ioutil.TempDir("", "torrent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b := blockmap.New(root)
+	if err := b.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestWriteV1(t *testing.T) {
+	a := bytes.Repeat([]byte("a"), 20<<10)
+	c := bytes.Repeat([]byte("c"), 30<<10)
+	b := testBlockMap(t, map[string][]byte{"a": a, "dir/c": c, "empty": nil})
+	defer os.RemoveAll(b.Root)
+
+	metainfo, err := build(b, WithPieceLength(16<<10), WithAnnounce("http://one", "http://two"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := metainfo["info"].(map[string]interface{})
+	if info["name"] != filepath.Base(b.Root) || info["piece length"] != int64(16<<10) {
+		t.Errorf("unexpected info %v", info)
+	}
+	files := info["files"].([]interface{})
+	if len(files) != 3 || files[1].(map[string]interface{})["length"] != int64(30<<10) {
+		t.Errorf("unexpected files %v", files)
+	}
+
+	content := append(append([]byte{}, a...), c...)
+	var want []byte
+	for len(content) > 0 {
+		size := 16 << 10
+		if len(content) < size {
+			size = len(content)
+		}
+		sum := sha1.Sum(content[:size])
+		want = append(want, sum[:]...)
+		content = content[size:]
+	}
+	if !bytes.Equal(info["pieces"].([]byte), want) {
+		t.Error("unexpected piece hashes")
+	}
+	if metainfo["announce"] != "http://one" || len(metainfo["announce-list"].([]interface{})) != 2 {
+		t.Errorf("unexpected trackers %v", metainfo)
+	}
+
+	var buf bytes.Buffer
+	if err := Write(b, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("d10:created by7:golinks17:golinks root hash128:")) {
+		t.Errorf("unexpected metainfo %.60q", buf.Bytes())
+	}
+
+	//Files that changed since generation aren't exported
+	if err := ioutil.WriteFile(filepath.Join(b.Root, "a"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(b, &buf); errors.Cause(err) != ErrFileChanged {
+		t.Errorf("expected ErrFileChanged, got %v", err)
+	}
+	if err := Write(b, &buf, WithPieceLength(1000)); err != ErrPieceLength {
+		t.Errorf("expected ErrPieceLength, got %v", err)
+	}
+}
+
+func TestWriteV2(t *testing.T) {
+	small := []byte("small")
+	large := bytes.Repeat([]byte("l"), 40<<10)
+	b := testBlockMap(t, map[string][]byte{"small": small, "dir/large": large, "empty": nil})
+	defer os.RemoveAll(b.Root)
+
+	metainfo, err := build(b, WithVersion(V2), WithPieceLength(32<<10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := metainfo["info"].(map[string]interface{})
+	tree := info["file tree"].(map[string]interface{})
+	file := func(node interface{}) map[string]interface{} {
+		return node.(map[string]interface{})[""].(map[string]interface{})
+	}
+
+	smallSum := sha256.Sum256(small)
+	if root := file(tree["small"])["pieces root"].([]byte); !bytes.Equal(root, smallSum[:]) {
+		t.Error("expected the root of a single block file to be its hash")
+	}
+	if _, ok := file(tree["empty"])["pieces root"]; ok {
+		t.Error("expected empty files to have no pieces root")
+	}
+
+	node := func(left, right []byte) []byte {
+		sum := sha256.Sum256(append(append([]byte{}, left...), right...))
+		return sum[:]
+	}
+	var leaves [][]byte
+	for _, block := range [][]byte{large[:16<<10], large[16<<10 : 32<<10], large[32<<10:]} {
+		sum := sha256.Sum256(block)
+		leaves = append(leaves, sum[:])
+	}
+	first, second := node(leaves[0], leaves[1]), node(leaves[2], make([]byte, 32))
+	largeFile := file(tree["dir"].(map[string]interface{})["large"])
+	root := largeFile["pieces root"].([]byte)
+	if !bytes.Equal(root, node(first, second)) {
+		t.Error("unexpected pieces root")
+	}
+	layers := metainfo["piece layers"].(map[string]interface{})
+	if len(layers) != 1 || !bytes.Equal(layers[string(root)].([]byte), append(first, second...)) {
+		t.Error("unexpected piece layers")
+	}
+	if info["meta version"] != 2 || largeFile["length"] != int64(40<<10) {
+		t.Errorf("unexpected info %v", info)
+	}
+}
+
+func TestWrite_NormalizedNames(t *testing.T) {
+	b := testBlockMap(t, map[string][]byte{"cafe\u0301": []byte("decomposed")})
+	defer os.RemoveAll(b.Root)
+	if _, ok := b.Archive["caf\u00e9"]; !ok {
+		t.Fatalf("expected an NFC key %v", b.Archive)
+	}
+	if err := Write(b, ioutil.Discard); err != nil {
+		t.Error("failed to read a file with a normalized key:", err)
+	}
+}
@@ -22,18 +22,111 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/govice/golinks/logging"
 )
 
 //Walker contains the structure for a file walker
 type Walker struct {
 	workers int
 	root    string
-	archive []string
+	entries []Entry
+	skip    func(path string, info os.FileInfo, err error)
+	logger  logging.Logger
+	follow  bool
+	sameDev bool
+	rootDev *uint64
+	dirFn   func(path string, info os.FileInfo) error
+	policy  ErrorPolicy
+	errFn   func(path string, err error) error
+	errs    []*PathError
+}
+
+//ErrorPolicy selects how the walker handles paths that fail
+type ErrorPolicy int
+
+const (
+	//FailFast stops the walk at the first error returned by the walk function. Paths that
+	//can't be read are skipped.
+	FailFast ErrorPolicy = iota
+	//CollectErrors continues past every failed path, including paths that can't be read,
+	//and returns a *MultiError holding them once the walk is done
+	CollectErrors
+	//ErrorCallback passes every failed path, including paths that can't be read, to the
+	//function set with SetErrorFunc. The walk stops when it returns an error.
+	ErrorCallback
+)
+
+//PathError records a path that failed during a walk
+type PathError struct {
+	Path string
+	Err  error
+}
+
+func (e *PathError) Error() string {
+	return "walker: " + e.Path + ": " + e.Err.Error()
+}
+
+//Unwrap returns the underlying error
+func (e *PathError) Unwrap() error { return e.Err }
+
+//MultiError is returned by walks with the CollectErrors policy when any path failed
+type MultiError struct {
+	Errs []*PathError
+}
+
+func (e *MultiError) Error() string {
+	if len(e.Errs) == 1 {
+		return e.Errs[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more failed paths)", e.Errs[0].Error(), len(e.Errs)-1)
+}
+
+//Is reports whether the error of any failed path matches target, so errors.Is can match
+//them, such as os.ErrPermission
+func (e *MultiError) Is(target error) bool {
+	for _, err := range e.Errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+//As finds the first failed path error matching target, so errors.As can reach them
+func (e *MultiError) As(target interface{}) bool {
+	for _, err := range e.Errs {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+//Paths returns the failed paths in walk order
+func (e *MultiError) Paths() []string {
+	paths := make([]string, len(e.Errs))
+	for i, err := range e.Errs {
+		paths[i] = err.Path
+	}
+	return paths
+}
+
+//Entry is a file found by Walk with the information read while walking
+type Entry struct {
+	Path string
+	Info os.FileInfo
 }
 
+//ErrSymlinkLoop is passed to the skip function for linked directories containing their link
+var ErrSymlinkLoop = errors.New("walker: symlink loop")
+
+//ErrOtherDevice is passed to the skip function for directories on another device than the root
+var ErrOtherDevice = errors.New("walker: directory is on another device")
+
 //New returns a new Walker
 func New(root string) Walker {
-	return Walker{1, root, nil}
+	return Walker{1, root, nil, nil, logging.Discard, false, false, nil, nil, FailFast, nil, nil}
 }
 
 //Workers returns the number of current workers
@@ -46,43 +139,247 @@ func (w Walker) Root() string {
 	return w.root
 }
 
-//Archive returns the walkers archive if set
+//Archive returns the paths of the walkers archive if set
 func (w Walker) Archive() []string {
-	return w.archive
+	if len(w.entries) == 0 {
+		return nil
+	}
+	archive := make([]string, len(w.entries))
+	for i, e := range w.entries {
+		archive[i] = e.Path
+	}
+	return archive
+}
+
+//Entries returns the walkers archive with the file information of each path so it
+//doesn't have to be read again. Linked files carry the information of their target.
+func (w Walker) Entries() []Entry {
+	return w.entries
 }
 
 //PrintArchive prints all files in the existing archive
 func (w Walker) PrintArchive() {
-	if len(w.archive) == 0 {
+	if len(w.entries) == 0 {
 		fmt.Println("archive empty")
 		return
 	}
-	for _, r := range w.archive {
-		fmt.Printf("%s\n", r)
+	for _, e := range w.entries {
+		fmt.Printf("%s\n", e.Path)
 	}
 }
 
+//SetSkipFunc sets a function called for every path the walker skips. err is the error that
+//caused the path to be skipped, or nil for files that aren't regular files. info may be nil
+//when the path could not be read.
+func (w *Walker) SetSkipFunc(fn func(path string, info os.FileInfo, err error)) {
+	w.skip = fn
+}
+
+//SetLogger sets the logger receiving skipped paths at debug level. A nil logger discards messages.
+func (w *Walker) SetLogger(logger logging.Logger) {
+	if logger == nil {
+		logger = logging.Discard
+	}
+	w.logger = logger
+}
+
+//SetFollowSymlinks sets whether symbolic links are followed. Linked files are reported under
+//the path of the link and linked directories are walked unless they contain the link.
+func (w *Walker) SetFollowSymlinks(follow bool) {
+	w.follow = follow
+}
+
+//SetSameDevice keeps the walk on the device holding the root, skipping directories on other
+//devices such as mount points for /proc or network filesystems
+func (w *Walker) SetSameDevice(same bool) {
+	w.sameDev = same
+}
+
+//SetDirFunc sets a function called for every directory walked, including the root. Returning
+//filepath.SkipDir skips the directory's contents and any other error stops the walk.
+func (w *Walker) SetDirFunc(fn func(path string, info os.FileInfo) error) {
+	w.dirFn = fn
+}
+
+//SetErrorPolicy sets how failed paths are handled, FailFast by default
+func (w *Walker) SetErrorPolicy(policy ErrorPolicy) {
+	w.policy = policy
+}
+
+//SetErrorFunc sets the function called for every failed path with the ErrorCallback policy.
+//Returning nil continues the walk past the path and any other error stops it.
+func (w *Walker) SetErrorFunc(fn func(path string, err error) error) {
+	w.errFn = fn
+}
+
 //Walk handles walking of a walkers root filesystem. Inaccessable directories are skipped.
 func (w *Walker) Walk() error {
+	return w.WalkFunc(func(path string, info os.FileInfo) error {
+		w.entries = append(w.entries, Entry{path, info})
+		return nil
+	})
+}
+
+//WalkFunc walks the walkers root filesystem calling fn for each readable regular file
+//as it is found rather than collecting the archive. Inaccessable directories are skipped.
+//Walking stops at the first error returned by fn unless the error policy continues past it.
+func (w *Walker) WalkFunc(fn func(path string, info os.FileInfo) error) error {
 	if w.root == "" {
 		return errors.New("Walk: Archive Empty")
 	}
-	e := filepath.Walk(w.root, func(path string, f os.FileInfo, err error) error {
+	w.rootDev = nil
+	w.errs = nil
+	if w.sameDev {
+		if info, err := os.Stat(w.root); err == nil {
+			if dev, ok := device(info); ok {
+				w.rootDev = &dev
+			}
+		}
+	}
+	if err := w.walk(w.root, w.root, fn); err != nil {
+		return err
+	}
+	if len(w.errs) > 0 {
+		return &MultiError{w.errs}
+	}
+	return nil
+}
+
+//walk walks dir reporting paths relative to prefix so linked directories are reported under the link
+func (w *Walker) walk(dir, prefix string, fn func(path string, info os.FileInfo) error) error {
+	return filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
+		path = prefix + strings.TrimPrefix(path, dir)
 		if err != nil {
+			if err := w.unreadable(path, f, err); err != nil {
+				return err
+			}
 			return filepath.SkipDir
 		}
 
 		if strings.Contains(path, "Docker.raw") {
 			return nil
 		}
-		if !f.IsDir() && f.Mode().IsRegular() {
-			f, err := os.Open(path)
-			if !os.IsPermission(err) {
-				w.archive = append(w.archive, path)
-			}
-			f.Close()
+		if w.follow && f.Mode()&os.ModeSymlink != 0 {
+			return w.followLink(path, f, fn)
 		}
-		return err
+		if f.IsDir() && !w.onRootDevice(f) {
+			w.skipped(path, f, ErrOtherDevice)
+			return filepath.SkipDir
+		}
+		if f.IsDir() && w.dirFn != nil {
+			return w.failed(path, w.dirFn(path, f))
+		}
+		if !f.IsDir() {
+			return w.visitFile(path, f, fn)
+		}
+		return nil
 	})
-	return e
+}
+
+//visitFile calls fn for readable regular files and skips everything else
+func (w *Walker) visitFile(path string, f os.FileInfo, fn func(path string, info os.FileInfo) error) error {
+	if !f.Mode().IsRegular() {
+		w.skipped(path, f, nil)
+		return nil
+	}
+	file, err := os.Open(path)
+	if os.IsPermission(err) {
+		return w.unreadable(path, f, err)
+	}
+	file.Close()
+	return w.failed(path, fn(path, f))
+}
+
+//followLink visits the target of the symbolic link at path
+func (w *Walker) followLink(path string, f os.FileInfo, fn func(path string, info os.FileInfo) error) error {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return w.unreadable(path, f, err)
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return w.unreadable(path, f, err)
+	}
+	if !info.IsDir() {
+		return w.visitFile(path, info, fn)
+	}
+	if !w.onRootDevice(info) {
+		w.skipped(path, f, ErrOtherDevice)
+		return nil
+	}
+
+	//Walking a directory containing the link would never end
+	parent, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		return w.unreadable(path, f, err)
+	}
+	if rel, err := filepath.Rel(target, parent); err == nil && !strings.HasPrefix(rel, "..") {
+		w.skipped(path, f, ErrSymlinkLoop)
+		return nil
+	}
+	//So would walking a directory already being walked through another link
+	if w.onStack(path, info) {
+		w.skipped(path, f, ErrSymlinkLoop)
+		return nil
+	}
+	return w.walk(target, path, fn)
+}
+
+//onStack returns true if dir is one of the directories walked to reach path, compared by
+//device and inode since linked directories are reported under their links
+func (w *Walker) onStack(path string, dir os.FileInfo) bool {
+	for parent := filepath.Dir(path); ; parent = filepath.Dir(parent) {
+		if info, err := os.Stat(parent); err == nil && os.SameFile(info, dir) {
+			return true
+		}
+		if len(parent) <= len(w.root) || parent == filepath.Dir(parent) {
+			return false
+		}
+	}
+}
+
+//onRootDevice returns false for files on another device than the root when the walk stays on it
+func (w *Walker) onRootDevice(info os.FileInfo) bool {
+	if w.rootDev == nil {
+		return true
+	}
+	dev, ok := device(info)
+	return !ok || dev == *w.rootDev
+}
+
+//failed applies the error policy to an error returned for path by a walk function
+func (w *Walker) failed(path string, err error) error {
+	if err == nil || err == filepath.SkipDir || w.policy == FailFast {
+		return err
+	}
+	if w.policy == ErrorCallback {
+		if w.errFn == nil {
+			return nil
+		}
+		return w.errFn(path, err)
+	}
+	w.errs = append(w.errs, &PathError{Path: path, Err: err})
+	return nil
+}
+
+//unreadable skips a path that couldn't be read, failing it unless the policy is FailFast
+func (w *Walker) unreadable(path string, info os.FileInfo, err error) error {
+	w.skipped(path, info, err)
+	if w.policy == FailFast {
+		return nil
+	}
+	return w.failed(path, err)
+}
+
+func (w *Walker) skipped(path string, info os.FileInfo, err error) {
+	if w.logger != nil {
+		fields := []logging.Field{logging.F("path", path)}
+		if err != nil {
+			fields = append(fields, logging.F("error", err))
+		}
+		w.logger.Log(logging.Debug, "walker skipped path", fields...)
+	}
+	if w.skip != nil {
+		w.skip(path, info, err)
+	}
 }
@@ -17,11 +17,13 @@
 package walker
 
 import (
+	"errors"
 	"io/ioutil"
 	"log"
 	"math/rand"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -84,6 +86,15 @@ func TestWalker_Walker(t *testing.T) {
 			t.Error(err)
 		}
 		//w.PrintArchive()
+		entries := w.Entries()
+		if len(entries) != SmallArchive*SmallDir || len(w.Archive()) != len(entries) {
+			t.Errorf("expected %d entries, got %d", SmallArchive*SmallDir, len(entries))
+		}
+		for _, e := range entries {
+			if e.Info == nil || e.Info.Size() != int64(SmallFile) || e.Info.Name() != filepath.Base(e.Path) {
+				t.Errorf("unexpected information %v for %s", e.Info, e.Path)
+			}
+		}
 	})
 
 	t.Run("Walk non-permissive", func(t *testing.T) {
@@ -123,8 +134,336 @@ func TestWalker_Walker(t *testing.T) {
 		}
 		os.Chmod(nonperm, 0755)
 
-		if len(w.archive) != 0 {
-			t.Error("archive length", len(w.archive), "does not match expected:", 0)
+		if len(w.entries) != 0 {
+			t.Error("archive length", len(w.entries), "does not match expected:", 0)
+		}
+	})
+}
+
+func TestWalker_WalkFunc(t *testing.T) {
+	root, err := ioutil.TempDir("", "walkfunc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	for _, name := range []string{"a", "b", "c"} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := New(root)
+	visited := 0
+	err = w.WalkFunc(func(path string, info os.FileInfo) error {
+		visited++
+		if info.Size() != 1 {
+			t.Error("unexpected file info for", path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	if visited != 3 {
+		t.Error("expected 3 files to be visited, got", visited)
+	}
+	if len(w.Archive()) != 0 {
+		t.Error("WalkFunc should not collect an archive")
+	}
+
+	stop := errors.New("stop")
+	visited = 0
+	err = w.WalkFunc(func(path string, info os.FileInfo) error {
+		visited++
+		return stop
+	})
+	if err != stop || visited != 1 {
+		t.Error("expected walk to stop at first callback error", err, visited)
+	}
+}
+
+func TestWalker_SetSkipFunc(t *testing.T) {
+	root, err := ioutil.TempDir("", "skipfunc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	if err := ioutil.WriteFile(filepath.Join(root, "a"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "a"), filepath.Join(root, "link")); err != nil {
+		t.Skip("symlinks unsupported:", err)
+	}
+
+	w := New(root)
+	var skipped []string
+	w.SetSkipFunc(func(path string, info os.FileInfo, err error) {
+		if err != nil || info == nil || info.Mode()&os.ModeSymlink == 0 {
+			t.Error("unexpected skip of", path, err)
+		}
+		skipped = append(skipped, filepath.Base(path))
+	})
+	if err := w.Walk(); err != nil {
+		t.Fatal(err)
+	}
+	if len(skipped) != 1 || skipped[0] != "link" || len(w.Archive()) != 1 {
+		t.Errorf("unexpected skipped %v archive %v", skipped, w.Archive())
+	}
+}
+
+func TestWalker_SetFollowSymlinks(t *testing.T) {
+	root, err := ioutil.TempDir("", "follow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	if err := os.Mkdir(filepath.Join(root, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "dir", "a"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "dir", "a"), filepath.Join(root, "file")); err != nil {
+		t.Skip("symlinks unsupported:", err)
+	}
+	for link, target := range map[string]string{"linked": "dir", "dir/loop": ".", "dangling": "missing"} {
+		if err := os.Symlink(filepath.Join(root, target), filepath.Join(root, link)); err != nil {
+			t.Fatal(err)
 		}
+	}
+
+	w := New(root)
+	w.SetFollowSymlinks(true)
+	skipped := make(map[string]error)
+	w.SetSkipFunc(func(path string, info os.FileInfo, err error) {
+		rel, _ := filepath.Rel(root, path)
+		skipped[rel] = err
 	})
+	if err := w.Walk(); err != nil {
+		t.Fatal(err)
+	}
+
+	var archive []string
+	for _, path := range w.Archive() {
+		rel, _ := filepath.Rel(root, path)
+		archive = append(archive, rel)
+	}
+	if len(archive) != 3 || archive[0] != "dir/a" || archive[1] != "file" || archive[2] != "linked/a" {
+		t.Errorf("unexpected archive %v", archive)
+	}
+	for _, e := range w.Entries() {
+		if !e.Info.Mode().IsRegular() {
+			t.Errorf("expected the target information of %s, got mode %v", e.Path, e.Info.Mode())
+		}
+	}
+	if !errors.Is(skipped["dir/loop"], ErrSymlinkLoop) || !errors.Is(skipped["linked/loop"], ErrSymlinkLoop) {
+		t.Errorf("expected symlink loops to be skipped %v", skipped)
+	}
+	if !os.IsNotExist(skipped["dangling"]) || len(skipped) != 3 {
+		t.Errorf("unexpected skipped paths %v", skipped)
+	}
+}
+
+func TestWalker_SiblingLinks(t *testing.T) {
+	root, err := ioutil.TempDir("", "siblings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for _, dir := range []string{"a", "b"} {
+		if err := os.Mkdir(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(root, dir, "file"), []byte(dir), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//Directories linking to each other never contain their own links
+	if err := os.Symlink(filepath.Join(root, "b"), filepath.Join(root, "a", "toB")); err != nil {
+		t.Skip("symlinks unsupported:", err)
+	}
+	if err := os.Symlink(filepath.Join(root, "a"), filepath.Join(root, "b", "toA")); err != nil {
+		t.Fatal(err)
+	}
+
+	w := New(root)
+	w.SetFollowSymlinks(true)
+	var skipped []string
+	w.SetSkipFunc(func(path string, info os.FileInfo, err error) {
+		if errors.Is(err, ErrSymlinkLoop) {
+			rel, _ := filepath.Rel(root, path)
+			skipped = append(skipped, filepath.ToSlash(rel))
+		}
+	})
+	if err := w.Walk(); err != nil {
+		t.Fatal(err)
+	}
+
+	var archive []string
+	for _, path := range w.Archive() {
+		rel, _ := filepath.Rel(root, path)
+		archive = append(archive, filepath.ToSlash(rel))
+	}
+	if strings.Join(archive, ",") != "a/file,a/toB/file,b/file,b/toA/file" {
+		t.Errorf("unexpected archive %v", archive)
+	}
+	if strings.Join(skipped, ",") != "a/toB/toA,b/toA/toB" {
+		t.Errorf("expected the links back to be skipped %v", skipped)
+	}
+}
+
+func TestWalker_SetSameDevice(t *testing.T) {
+	root := "/dev"
+	info, err := os.Stat(root)
+	if err != nil {
+		t.Skip("no /dev:", err)
+	}
+	rootDev, ok := device(info)
+	if !ok {
+		t.Skip("devices unavailable")
+	}
+	//Find a mount point below the root
+	entries, err := ioutil.ReadDir(root)
+	if err != nil {
+		t.Skip(err)
+	}
+	mount := ""
+	for _, entry := range entries {
+		if dev, _ := device(entry); entry.IsDir() && dev != rootDev {
+			mount = filepath.Join(root, entry.Name())
+			break
+		}
+	}
+	if mount == "" {
+		t.Skip("no mount point below", root)
+	}
+
+	w := New(root)
+	w.SetSameDevice(true)
+	var crossed []string
+	w.SetSkipFunc(func(path string, info os.FileInfo, err error) {
+		if errors.Is(err, ErrOtherDevice) {
+			crossed = append(crossed, path)
+		}
+	})
+	err = w.WalkFunc(func(path string, info os.FileInfo) error {
+		if strings.HasPrefix(path, mount+string(filepath.Separator)) {
+			t.Error("walked into mount point", path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, path := range crossed {
+		found = found || path == mount
+	}
+	if !found {
+		t.Errorf("expected %s to be skipped, skipped %v", mount, crossed)
+	}
+}
+
+func TestWalker_SetDirFunc(t *testing.T) {
+	root, err := ioutil.TempDir("", "dirfunc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for _, dir := range []string{"a/b", "empty", "skip/inner"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "skip", "file"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w := New(root)
+	var dirs []string
+	w.SetDirFunc(func(path string, info os.FileInfo) error {
+		rel, _ := filepath.Rel(root, path)
+		dirs = append(dirs, filepath.ToSlash(rel))
+		if rel == "skip" {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err := w.Walk(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{".", "a", "a/b", "empty", "skip"}
+	if strings.Join(dirs, ",") != strings.Join(want, ",") || len(w.Archive()) != 0 {
+		t.Errorf("unexpected directories %v archive %v", dirs, w.Archive())
+	}
+}
+
+func TestWalker_SetErrorPolicy(t *testing.T) {
+	root, err := ioutil.TempDir("", "errorpolicy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	for _, name := range []string{"a", "b", "c"} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(root, "missing"), filepath.Join(root, "dangling")); err != nil {
+		t.Skip("symlinks unsupported:", err)
+	}
+
+	bad := errors.New("bad")
+	fn := func(path string, info os.FileInfo) error {
+		if filepath.Base(path) == "b" {
+			return nil
+		}
+		return bad
+	}
+
+	w := New(root)
+	w.SetFollowSymlinks(true)
+	if err := w.WalkFunc(fn); err != bad {
+		t.Error("expected the walk to fail fast, got", err)
+	}
+
+	w.SetErrorPolicy(CollectErrors)
+	err = w.WalkFunc(fn)
+	var multi *MultiError
+	if !errors.As(err, &multi) || !errors.Is(err, bad) || !errors.Is(err, os.ErrNotExist) {
+		t.Fatal("expected a multi-error of every failed path, got", err)
+	}
+	var statErr *os.PathError
+	if !errors.As(err, &statErr) || !os.IsNotExist(statErr) {
+		t.Error("expected errors.As to reach the error of a failed path, got", statErr)
+	}
+	var failed []string
+	for _, path := range multi.Paths() {
+		failed = append(failed, filepath.Base(path))
+	}
+	if strings.Join(failed, ",") != "a,c,dangling" {
+		t.Error("unexpected failed paths", failed)
+	}
+
+	w.SetErrorPolicy(ErrorCallback)
+	failed = nil
+	w.SetErrorFunc(func(path string, err error) error {
+		failed = append(failed, filepath.Base(path))
+		return nil
+	})
+	if err := w.WalkFunc(fn); err != nil || strings.Join(failed, ",") != "a,c,dangling" {
+		t.Error("expected the callback to continue past every failed path", err, failed)
+	}
+
+	stop := errors.New("stop")
+	w.SetErrorFunc(func(path string, err error) error {
+		return stop
+	})
+	if err := w.WalkFunc(fn); err != stop {
+		t.Error("expected the callback to stop the walk, got", err)
+	}
 }
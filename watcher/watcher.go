@@ -0,0 +1,211 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+// Package watcher keeps a blockmap up to date with its root directory using
+// filesystem notifications, emitting an event for every archived path whose
+// hash changes.
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/govice/golinks/archivemap"
+	"github.com/govice/golinks/blockmap"
+	"github.com/pkg/errors"
+)
+
+// Event reports a changed archive path. OldHash is nil for added files and
+// NewHash is nil for removed files. RootHash is the blockmap root hash after
+// the change was applied.
+type Event struct {
+	blockmap.Change
+	RootHash []byte
+}
+
+// Watcher monitors a blockmap root and incrementally updates the blockmap
+type Watcher struct {
+	mu       sync.RWMutex
+	blockmap *blockmap.BlockMap
+	fsw      *fsnotify.Watcher
+	events   chan Event
+	errors   chan error
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// New generates a blockmap for root and starts watching it
+func New(root string) (*Watcher, error) {
+	return NewBlockMap(blockmap.New(root))
+}
+
+// NewBlockMap generates b and starts watching its root. b must not be
+// modified by the caller once watched.
+func NewBlockMap(b *blockmap.BlockMap) (*Watcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, errors.Wrap(err, "watcher: failed to create watcher")
+	}
+	w := &Watcher{
+		blockmap: b,
+		fsw:      fsw,
+		events:   make(chan Event, 64),
+		errors:   make(chan error, 16),
+		done:     make(chan struct{}),
+	}
+
+	//Watch before generating so changes during generation aren't missed
+	if err := w.watchTree(b.Root); err != nil {
+		fsw.Close()
+		return nil, err
+	}
+	if err := b.Generate(); err != nil {
+		fsw.Close()
+		return nil, errors.Wrap(err, "watcher: failed to generate blockmap")
+	}
+
+	w.wg.Add(1)
+	go w.run()
+	return w, nil
+}
+
+// Events returns the channel of archive changes. It must be drained for the
+// watcher to make progress and is closed by Close.
+func (w *Watcher) Events() <-chan Event {
+	return w.events
+}
+
+// Errors returns the channel of errors encountered while updating. It is
+// closed by Close. Errors are dropped while the channel is full so an
+// undrained error channel doesn't stall updates.
+func (w *Watcher) Errors() <-chan error {
+	return w.errors
+}
+
+// RootHash returns the current root hash
+func (w *Watcher) RootHash() []byte {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return append([]byte{}, w.blockmap.RootHash...)
+}
+
+// BlockMap returns a copy of the current blockmap
+func (w *Watcher) BlockMap() *blockmap.BlockMap {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	b := *w.blockmap
+	b.Archive = make(archivemap.ArchiveMap, len(w.blockmap.Archive))
+	for path, hash := range w.blockmap.Archive {
+		b.Archive[path] = hash
+	}
+	b.Entries = make(archivemap.EntryMap, len(w.blockmap.Entries))
+	for path, entry := range w.blockmap.Entries {
+		b.Entries[path] = entry
+	}
+	return &b
+}
+
+// Close stops watching and closes the event and error channels
+func (w *Watcher) Close() error {
+	close(w.done)
+	err := w.fsw.Close()
+	w.wg.Wait()
+	close(w.events)
+	close(w.errors)
+	return err
+}
+
+func (w *Watcher) run() {
+	defer w.wg.Done()
+	for {
+		select {
+		case <-w.done:
+			return
+		case ev, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+			w.handle(ev)
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return
+			}
+			w.sendError(errors.Wrap(err, "watcher: notification error"))
+		}
+	}
+}
+
+func (w *Watcher) handle(ev fsnotify.Event) {
+	if ev.Op&fsnotify.Create != 0 {
+		if info, err := os.Lstat(ev.Name); err == nil && info.IsDir() {
+			if err := w.watchTree(ev.Name); err != nil {
+				w.sendError(err)
+			}
+		}
+	}
+
+	//Every operation updates the path, including Chmod so recorded modes stay current
+	relPath, err := filepath.Rel(w.blockmap.Root, ev.Name)
+	if err != nil || relPath == "." {
+		return
+	}
+
+	w.mu.Lock()
+	changes, err := w.blockmap.UpdatePath(relPath)
+	rootHash := append([]byte{}, w.blockmap.RootHash...)
+	w.mu.Unlock()
+	if err != nil {
+		w.sendError(errors.Wrap(err, "watcher: failed to update "+relPath))
+		return
+	}
+
+	for _, change := range changes {
+		select {
+		case w.events <- Event{Change: change, RootHash: rootHash}:
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *Watcher) sendError(err error) {
+	select {
+	case w.errors <- err:
+	default:
+	}
+}
+
+// watchTree adds a watch for dir and every directory below it
+func (w *Watcher) watchTree(dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			//Skip directories removed or unreadable while walking
+			if os.IsNotExist(err) || os.IsPermission(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if err := w.fsw.Add(path); err != nil {
+			return errors.Wrap(err, "watcher: failed to watch "+path)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,154 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package watcher
+
+import (
+	"crypto/sha512"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/govice/golinks/blockmap"
+	"github.com/govice/golinks/fs"
+)
+
+// until waits for an event matching match. Writes may be observed part way
+// through, so intermediate events are skipped.
+func until(t *testing.T, w *Watcher, match func(Event) bool) {
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-w.Events():
+			if match(ev) {
+				return
+			}
+		case err := <-w.Errors():
+			t.Fatal(err)
+		case <-timeout:
+			t.Fatal("timed out waiting for event")
+		}
+	}
+}
+
+func hashOf(t *testing.T, content string) []byte {
+	hash, err := fs.HashReader(strings.NewReader(content), sha512.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+func TestWatcher(t *testing.T) {
+	root, err := ioutil.TempDir("", "watcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := ioutil.WriteFile(filepath.Join(root, "a"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := New(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	initial := w.RootHash()
+
+	if err := ioutil.WriteFile(filepath.Join(root, "a"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	until(t, w, func(ev Event) bool {
+		return ev.Path == "a" && ev.OldHash != nil && string(ev.NewHash) == string(hashOf(t, "changed"))
+	})
+
+	//Files in new directories are picked up
+	if err := os.Mkdir(filepath.Join(root, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "dir", "b"), []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	until(t, w, func(ev Event) bool {
+		return ev.Path == "dir/b" && string(ev.NewHash) == string(hashOf(t, "b"))
+	})
+
+	if err := os.Remove(filepath.Join(root, "a")); err != nil {
+		t.Fatal(err)
+	}
+	until(t, w, func(ev Event) bool { return ev.Path == "a" && ev.NewHash == nil })
+
+	//Mode changes don't change hashes but update the recorded entry
+	if err := os.Chmod(filepath.Join(root, "dir", "b"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for timeout := time.After(5 * time.Second); w.BlockMap().Entries["dir/b"].Mode.Perm() != 0600; {
+		select {
+		case err := <-w.Errors():
+			t.Fatal(err)
+		case <-timeout:
+			t.Fatal("timed out waiting for mode change")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	full := blockmap.New(root)
+	if err := full.Generate(); err != nil {
+		t.Fatal(err)
+	}
+	if !blockmap.Equal(full, w.BlockMap()) {
+		t.Error("watched blockmap does not match generated blockmap")
+	}
+	if string(w.RootHash()) == string(initial) {
+		t.Error("root hash was not updated")
+	}
+}
+
+func TestWatcher_sendError(t *testing.T) {
+	root, err := ioutil.TempDir("", "watcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	w, err := New(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	//Errors beyond the buffer are dropped rather than blocking updates
+	sent := make(chan struct{})
+	go func() {
+		for i := 0; i < cap(w.errors)+1; i++ {
+			w.sendError(errors.New("failed"))
+		}
+		close(sent)
+	}()
+	select {
+	case <-sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sendError blocked on a full error channel")
+	}
+	if len(w.errors) != cap(w.errors) {
+		t.Errorf("expected %d buffered errors, got %d", cap(w.errors), len(w.errors))
+	}
+}
@@ -0,0 +1,74 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package worm
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/govice/golinks/blockchain"
+	"github.com/govice/golinks/snapshot"
+	"github.com/pkg/errors"
+)
+
+// ExportSnapshots appends the snapshots of store that the container doesn't
+// hold yet, oldest first, and returns how many were written. Link files are
+// exported as stored.
+func ExportSnapshots(w *Writer, store *snapshot.Store) (int, error) {
+	snapshots, err := store.List()
+	if err != nil {
+		return 0, err
+	}
+	written := 0
+	for _, s := range snapshots {
+		data, err := ioutil.ReadFile(s.Path)
+		if err != nil {
+			return written, errors.Wrap(err, "worm: failed to read snapshot "+s.ID)
+		}
+		if w.Has(KindSnapshot, s.ID, data) {
+			continue
+		}
+		if _, err := w.Write(KindSnapshot, s.ID, data); err != nil {
+			return written, err
+		}
+		written++
+	}
+	return written, nil
+}
+
+// ExportChain appends the blocks of chain that the container doesn't hold
+// yet and returns how many were written. Blocks are named by index, so a
+// block replaced by a fork is exported again next to the original.
+func ExportChain(w *Writer, chain *blockchain.Blockchain) (int, error) {
+	written := 0
+	for i := 0; i < chain.Length(); i++ {
+		data, err := json.Marshal(chain.At(i))
+		if err != nil {
+			return written, errors.Wrap(err, "worm: failed to encode block")
+		}
+		name := strconv.Itoa(i)
+		if w.Has(KindBlock, name, data) {
+			continue
+		}
+		if _, err := w.Write(KindBlock, name, data); err != nil {
+			return written, err
+		}
+		written++
+	}
+	return written, nil
+}
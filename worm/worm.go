@@ -0,0 +1,363 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+// Package worm writes snapshots and chain blocks to append-only container
+// files for write-once-read-many storage. Records are length prefixed and each
+// ends in a SHA-512 hash chained to the record before it, so a container
+// verifies itself: altered, reordered, dropped or truncated records are
+// detected without any other metadata.
+package worm
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha512"
+	"encoding/binary"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Magic starts every container
+const Magic = "GLWORM\x00\x01"
+
+// maxRecordSize bounds the data of records read from a container
+const maxRecordSize = 1 << 30
+
+var (
+	// ErrNotContainer is returned when reading a file that isn't a container
+	ErrNotContainer = errors.New("worm: not a container")
+	// ErrTampered is returned when a record's hash doesn't chain from the
+	// records before it
+	ErrTampered = errors.New("worm: container has been tampered with")
+	// ErrTruncated is returned when a container ends within a record
+	ErrTruncated = errors.New("worm: container is truncated")
+)
+
+// Kind is the type of data a record holds
+type Kind byte
+
+// Record kinds
+const (
+	// KindSnapshot records hold a snapshot's link file as stored
+	KindSnapshot Kind = 1
+	// KindBlock records hold a chain block as JSON
+	KindBlock Kind = 2
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindSnapshot:
+		return "snapshot"
+	case KindBlock:
+		return "block"
+	}
+	return "kind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// Record is one entry of a container. On disk a record is its kind byte, the
+// write time in Unix nanoseconds, the name length as a uint16 and the name,
+// the data length as a uint64 and the data, all big-endian, followed by Hash.
+type Record struct {
+	Kind Kind      `json:"kind"`
+	Time time.Time `json:"time"`
+	// Name is the snapshot ID or block index
+	Name string `json:"name"`
+	Data []byte `json:"-"`
+	// Hash is the SHA-512 of the previous record's hash and this record's
+	// bytes before the hash. The first record chains from the hash of Magic.
+	Hash []byte `json:"hash"`
+	// Offset is the position of the record in the container
+	Offset int64 `json:"offset"`
+}
+
+// genesisHash is the hash the first record chains from
+func genesisHash() []byte {
+	sum := sha512.Sum512([]byte(Magic))
+	return sum[:]
+}
+
+// encode returns the bytes of r before its hash
+func (r *Record) encode() ([]byte, error) {
+	if len(r.Name) > 0xffff {
+		return nil, errors.New("worm: record name too long")
+	}
+	var buf bytes.Buffer
+	buf.WriteByte(byte(r.Kind))
+	binary.Write(&buf, binary.BigEndian, r.Time.UnixNano())
+	binary.Write(&buf, binary.BigEndian, uint16(len(r.Name)))
+	buf.WriteString(r.Name)
+	binary.Write(&buf, binary.BigEndian, uint64(len(r.Data)))
+	buf.Write(r.Data)
+	return buf.Bytes(), nil
+}
+
+func chainHash(prev, encoded []byte) []byte {
+	h := sha512.New()
+	h.Write(prev)
+	h.Write(encoded)
+	return h.Sum(nil)
+}
+
+// Writer appends records to a container
+type Writer struct {
+	w      io.Writer
+	file   *os.File
+	now    func() time.Time
+	last   []byte
+	offset int64
+	//written holds the data hashes of the records of each kind and name, so
+	//unchanged data isn't exported twice
+	written map[Kind]map[string][]byte
+}
+
+// NewWriter starts a new container in w
+func NewWriter(w io.Writer) (*Writer, error) {
+	if _, err := io.WriteString(w, Magic); err != nil {
+		return nil, errors.Wrap(err, "worm: failed to write container header")
+	}
+	return newWriter(w, genesisHash(), int64(len(Magic))), nil
+}
+
+func newWriter(w io.Writer, last []byte, offset int64) *Writer {
+	return &Writer{
+		w:       w,
+		now:     time.Now,
+		last:    last,
+		offset:  offset,
+		written: map[Kind]map[string][]byte{},
+	}
+}
+
+// OpenFile opens the container at path for appending, creating it if needed.
+// The records already in the container are verified first. The file is only
+// ever opened for appending, so it may live on storage that rejects
+// overwrites.
+func OpenFile(path string) (*Writer, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "worm: failed to open container")
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, errors.Wrap(err, "worm: failed to open container")
+	}
+
+	var w *Writer
+	if info.Size() == 0 {
+		w, err = NewWriter(file)
+	} else {
+		w, err = resume(path, file)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	w.file = file
+	return w, nil
+}
+
+// resume verifies the container at path and returns a writer appending to it
+// through file
+func resume(path string, file *os.File) (*Writer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "worm: failed to open container")
+	}
+	defer f.Close()
+	r, err := NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	w := newWriter(file, r.last, r.offset)
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		w.remember(rec)
+	}
+	w.last, w.offset = r.last, r.offset
+	return w, nil
+}
+
+// Write appends a record of kind named name holding data and returns it.
+// Records of files opened with OpenFile are synced before Write returns.
+func (w *Writer) Write(kind Kind, name string, data []byte) (*Record, error) {
+	r := &Record{Kind: kind, Time: w.now().UTC(), Name: name, Data: data, Offset: w.offset}
+	encoded, err := r.encode()
+	if err != nil {
+		return nil, err
+	}
+	r.Hash = chainHash(w.last, encoded)
+	if _, err := w.w.Write(append(encoded, r.Hash...)); err != nil {
+		return nil, errors.Wrap(err, "worm: failed to write record")
+	}
+	if w.file != nil {
+		if err := w.file.Sync(); err != nil {
+			return nil, errors.Wrap(err, "worm: failed to sync container")
+		}
+	}
+	w.last = r.Hash
+	w.offset += int64(len(encoded) + len(r.Hash))
+	w.remember(r)
+	return r, nil
+}
+
+// Has returns true if the container holds a record of kind named name with
+// the same data
+func (w *Writer) Has(kind Kind, name string, data []byte) bool {
+	sum := sha512.Sum512(data)
+	return bytes.Equal(w.written[kind][name], sum[:])
+}
+
+func (w *Writer) remember(r *Record) {
+	if w.written[r.Kind] == nil {
+		w.written[r.Kind] = map[string][]byte{}
+	}
+	sum := sha512.Sum512(r.Data)
+	w.written[r.Kind][r.Name] = sum[:]
+}
+
+// Close closes the file of a container opened with OpenFile
+func (w *Writer) Close() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// Reader reads and verifies the records of a container in order
+type Reader struct {
+	r      *bufio.Reader
+	last   []byte
+	offset int64
+}
+
+// NewReader reads the container header from r
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(Magic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != Magic {
+		return nil, ErrNotContainer
+	}
+	return &Reader{r: br, last: genesisHash(), offset: int64(len(Magic))}, nil
+}
+
+// Next returns the next record, or io.EOF after the last one. Records that
+// don't chain from the records before them return ErrTampered.
+func (r *Reader) Next() (*Record, error) {
+	kind, err := r.r.ReadByte()
+	if err == io.EOF {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, errors.Wrap(err, "worm: failed to read record")
+	}
+
+	var (
+		nanos   int64
+		nameLen uint16
+		dataLen uint64
+	)
+	if err := binary.Read(r.r, binary.BigEndian, &nanos); err != nil {
+		return nil, r.truncated()
+	}
+	if err := binary.Read(r.r, binary.BigEndian, &nameLen); err != nil {
+		return nil, r.truncated()
+	}
+	name := make([]byte, nameLen)
+	if _, err := io.ReadFull(r.r, name); err != nil {
+		return nil, r.truncated()
+	}
+	if err := binary.Read(r.r, binary.BigEndian, &dataLen); err != nil {
+		return nil, r.truncated()
+	}
+	if dataLen > maxRecordSize {
+		return nil, errors.Wrapf(ErrTampered, "record at offset %d is too large", r.offset)
+	}
+	data := make([]byte, dataLen)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		return nil, r.truncated()
+	}
+	hash := make([]byte, sha512.Size)
+	if _, err := io.ReadFull(r.r, hash); err != nil {
+		return nil, r.truncated()
+	}
+
+	rec := &Record{Kind: Kind(kind), Time: time.Unix(0, nanos).UTC(), Name: string(name), Data: data, Offset: r.offset}
+	encoded, err := rec.encode()
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(chainHash(r.last, encoded), hash) {
+		return nil, errors.Wrapf(ErrTampered, "record at offset %d", r.offset)
+	}
+	rec.Hash = hash
+	r.last = hash
+	r.offset += int64(len(encoded) + len(hash))
+	return rec, nil
+}
+
+func (r *Reader) truncated() error {
+	return errors.Wrapf(ErrTruncated, "record at offset %d", r.offset)
+}
+
+// Verify reads every record of the container in r, returning them without
+// their data
+func Verify(r io.Reader) ([]Record, error) {
+	records, err := readAll(r)
+	for i := range records {
+		records[i].Data = nil
+	}
+	return records, err
+}
+
+// VerifyFile verifies the container at path, see Verify
+func VerifyFile(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "worm: failed to open container")
+	}
+	defer f.Close()
+	return Verify(f)
+}
+
+// readAll returns the records of the container in r, and the records read
+// before any error
+func readAll(r io.Reader) ([]Record, error) {
+	cr, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	var records []Record
+	for {
+		rec, err := cr.Next()
+		if err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return records, err
+		}
+		records = append(records, *rec)
+	}
+}
@@ -0,0 +1,171 @@
+/*
+ *Copyright 2018-2019 Kevin Gentile
+ *
+ *Licensed under the Apache License, Version 2.0 (the "License");
+ *you may not use this file except in compliance with the License.
+ *You may obtain a copy of the License at
+ *
+ *http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *Unless required by applicable law or agreed to in writing, software
+ *distributed under the License is distributed on an "AS IS" BASIS,
+ *WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *See the License for the specific language governing permissions and
+ *limitations under the License.
+ */
+
+package worm
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/govice/golinks/block"
+	"github.com/govice/golinks/blockchain"
+	"github.com/govice/golinks/blockmap"
+	"github.com/govice/golinks/snapshot"
+)
+
+func TestExport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "worm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "root")
+	if err := os.Mkdir(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	store, err := snapshot.Open(filepath.Join(dir, "snapshots"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, err := blockchain.New(block.NewSHA512Genesis())
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshotOf := func(content string) {
+		if err := ioutil.WriteFile(filepath.Join(root, "a"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		b := blockmap.New(root)
+		if err := b.Generate(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Save(b); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := chain.Add(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	export := func(snapshots, blocks int) {
+		w, err := OpenFile(filepath.Join(dir, "export.worm"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+		if n, err := ExportSnapshots(w, store); err != nil || n != snapshots {
+			t.Errorf("exported %d snapshots, expected %d: %v", n, snapshots, err)
+		}
+		if n, err := ExportChain(w, chain); err != nil || n != blocks {
+			t.Errorf("exported %d blocks, expected %d: %v", n, blocks, err)
+		}
+	}
+
+	snapshotOf("1")
+	export(1, 2)
+	//Only new snapshots and blocks are appended
+	snapshotOf("2")
+	export(1, 1)
+	export(0, 0)
+
+	path := filepath.Join(dir, "export.worm")
+	records, err := VerifyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kinds []Kind
+	for _, r := range records {
+		kinds = append(kinds, r.Kind)
+	}
+	expected := []Kind{KindSnapshot, KindBlock, KindBlock, KindSnapshot, KindBlock}
+	if len(kinds) != len(expected) {
+		t.Fatalf("unexpected records %v", kinds)
+	}
+	for i := range expected {
+		if kinds[i] != expected[i] {
+			t.Fatalf("unexpected records %v", kinds)
+		}
+	}
+
+	//The exported link file loads as the snapshot
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := store.Load(first.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exported := blockmap.New("")
+	if _, err := exported.ReadFrom(bytes.NewReader(first.Data)); err != nil {
+		t.Fatal(err)
+	}
+	if !blockmap.Equal(loaded, exported) {
+		t.Error("exported snapshot differs from the stored one")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var offsets []int64
+	for _, name := range []string{"a", "b", "c"} {
+		r, err := w.Write(KindSnapshot, name, []byte("data of "+name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets = append(offsets, r.Offset)
+	}
+	container := buf.Bytes()
+	if records, err := Verify(bytes.NewReader(container)); err != nil || len(records) != 3 {
+		t.Fatal("failed to verify container", err)
+	}
+
+	altered := append([]byte{}, container...)
+	altered[offsets[1]+20] ^= 1
+	dropped := append(append([]byte{}, container[:offsets[1]]...), container[offsets[2]:]...)
+	for name, c := range map[string][]byte{"altered": altered, "dropped": dropped} {
+		records, err := Verify(bytes.NewReader(c))
+		if !errors.Is(err, ErrTampered) {
+			t.Errorf("expected %s record to be detected, got %v", name, err)
+		}
+		if len(records) != 1 {
+			t.Errorf("expected the records before the %s one, got %d", name, len(records))
+		}
+	}
+	if _, err := Verify(bytes.NewReader(container[:len(container)-1])); !errors.Is(err, ErrTruncated) {
+		t.Error("expected truncation to be detected, got", err)
+	}
+	if _, err := Verify(bytes.NewReader([]byte("not a container"))); err != ErrNotContainer {
+		t.Error("expected not container error, got", err)
+	}
+}